@@ -0,0 +1,8 @@
+#!/bin/sh
+set -eu
+cd "$(dirname "$0")/.."
+
+# Lays out every e2e test twice with the children of objects shuffled, with both
+# GOMAXPROCS=1 and GOMAXPROCS=4, and fails if any output differs.
+# Pass e.g. -run 'TestE2E/stable' to check a subset.
+SKIP_SVG_CHECK=1 go test --timeout=60m ./e2etests -cpu 1,4 -count 1 "$@" -args -d2-determinism -d2-shuffle
@@ -501,7 +501,11 @@ type UnquotedString struct {
 	Range Range              `json:"range"`
 	Value []InterpolationBox `json:"value"`
 	// Pattern holds the parsed glob pattern if in a key and the unquoted string represents a valid pattern.
+	// Patterns beginning with ! match what the rest of them doesn't, like !*-db.
 	Pattern []string `json:"pattern,omitempty"`
+	// Filters are the attributes a pattern is filtered by, written in brackets after it like
+	// *[shape=cylinder, style.fill!=red]. = is an Ampersand filter and != a NotAmpersand one.
+	Filters []*Key `json:"filters,omitempty"`
 }
 
 func (s *UnquotedString) Coalesce() {
@@ -657,7 +661,7 @@ func (mk1 *Key) D2OracleEquals(mk2 *Key) bool {
 	if (mk1 == nil) || (mk2 == nil) {
 		return false
 	}
-	if mk1.Ampersand != mk2.Ampersand {
+	if mk1.Ampersand != mk2.Ampersand || mk1.NotAmpersand != mk2.NotAmpersand {
 		return false
 	}
 	if (mk1.Key == nil) != (mk2.Key == nil) {
@@ -736,7 +740,7 @@ func (mk1 *Key) Equals(mk2 *Key) bool {
 	if (mk1 == nil) || (mk2 == nil) {
 		return false
 	}
-	if mk1.Ampersand != mk2.Ampersand {
+	if mk1.Ampersand != mk2.Ampersand || mk1.NotAmpersand != mk2.NotAmpersand {
 		return false
 	}
 	if (mk1.Key == nil) != (mk2.Key == nil) {
@@ -1037,6 +1041,31 @@ type Substitution struct {
 
 	Spread bool         `json:"spread"`
 	Path   []*StringBox `json:"path"`
+	// Expression, if given instead of Path, is computed from vars, like ${base-width * 2}.
+	// See IsExpression.
+	Expression string `json:"expression,omitempty"`
+}
+
+// IsExpression returns whether s, what's written between the braces of a substitution, is an
+// expression rather than the key of a var: whether it has an operator outside of quotes.
+// Operators are + * / % ( ) and - with spaces around it, since var names can contain -.
+func IsExpression(s string) bool {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case strings.ContainsRune("+*/%()", r):
+			return true
+		case r == '-' && i > 0 && s[i-1] == ' ' && i+1 < len(s) && s[i+1] == ' ':
+			return true
+		}
+	}
+	return false
 }
 
 type Import struct {
@@ -1045,6 +1074,13 @@ type Import struct {
 	Spread bool         `json:"spread"`
 	Pre    string       `json:"pre"`
 	Path   []*StringBox `json:"path"`
+	// Subtree, if given, is the key of the only part of the file that's imported, written after
+	// # like @lib#database. Unlike @lib.database, the key itself is imported along with its
+	// children, and the connections between them.
+	Subtree *KeyPath `json:"subtree,omitempty"`
+	// Args are passed to the vars of the imported file, written in parentheses after its path
+	// like @service(name: auth, color: blue), so that one file can be imported as a template.
+	Args []*Key `json:"args,omitempty"`
 }
 
 // MapNodeBox is used to box MapNode for JSON persistence.
@@ -1423,5 +1459,11 @@ func (i *Import) PathWithPre() string {
 	if len(i.Path) == 0 {
 		return ""
 	}
-	return path.Join(i.Pre, i.Path[0].Unbox().ScalarString())
+	p := i.Path[0].Unbox().ScalarString()
+	// The URLs of remote imports are kept as is, as joining them would clean the // after their
+	// scheme
+	if i.Pre == "" && strings.Contains(p, "://") {
+		return p
+	}
+	return path.Join(i.Pre, p)
 }
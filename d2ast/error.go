@@ -8,8 +8,63 @@ package d2ast
 type Error struct {
 	Range   Range  `json:"range"`
 	Message string `json:"errmsg"`
+	// Code is the kind of error, one of the DIAGNOSTIC_ codes, set where the error is made.
+	// Errors without one are DIAGNOSTIC_INVALID.
+	Code string `json:"-"`
+	// Fix is the edit that would likely fix the error, if there's one
+	Fix *Fix `json:"-"`
 }
 
 func (e Error) Error() string {
 	return e.Message
 }
+
+// Fix replaces Range with NewText. Insertions have empty ranges.
+type Fix struct {
+	// Title describes the fix, e.g. to offer it in editors
+	Title   string `json:"title"`
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// Diagnostic codes are the kinds of problems in D2 source. Unlike messages, they stay the same
+// across releases.
+const (
+	// DIAGNOSTIC_SYNTAX is input that doesn't parse
+	DIAGNOSTIC_SYNTAX = "syntax"
+	// DIAGNOSTIC_UNTERMINATED is a string, map, array or other delimited value that isn't closed
+	DIAGNOSTIC_UNTERMINATED = "unterminated"
+	// DIAGNOSTIC_IMPORT is an import that is malformed or fails
+	DIAGNOSTIC_IMPORT = "import"
+	// DIAGNOSTIC_UNKNOWN_SHAPE is a shape or arrowhead that doesn't exist
+	DIAGNOSTIC_UNKNOWN_SHAPE = "unknown-shape"
+	// DIAGNOSTIC_UNKNOWN_STYLE is a style keyword that doesn't exist
+	DIAGNOSTIC_UNKNOWN_STYLE = "unknown-style"
+	// DIAGNOSTIC_UNDEFINED_VARIABLE is a substitution or condition of a var that isn't defined
+	DIAGNOSTIC_UNDEFINED_VARIABLE = "undefined-variable"
+	// DIAGNOSTIC_UNDEFINED_CLASS is a class that isn't defined
+	DIAGNOSTIC_UNDEFINED_CLASS = "undefined-class"
+	// DIAGNOSTIC_BOARD_NOT_FOUND is a link, board shape or cross-board edge to a board or
+	// object that doesn't exist
+	DIAGNOSTIC_BOARD_NOT_FOUND = "board-not-found"
+	// DIAGNOSTIC_INVALID_NEAR is a near key that can't be used where it's set
+	DIAGNOSTIC_INVALID_NEAR = "invalid-near"
+	// DIAGNOSTIC_INVALID_VALUE is a reserved keyword set to a value it doesn't accept
+	DIAGNOSTIC_INVALID_VALUE = "invalid-value"
+	// DIAGNOSTIC_MISPLACED_KEYWORD is a reserved keyword set on something it doesn't apply to
+	DIAGNOSTIC_MISPLACED_KEYWORD = "misplaced-keyword"
+	// DIAGNOSTIC_ASSERTION_FAILED is an assert that doesn't hold
+	DIAGNOSTIC_ASSERTION_FAILED = "assertion-failed"
+	// DIAGNOSTIC_INVALID_ASSERTION is an assert that isn't a valid assertion
+	DIAGNOSTIC_INVALID_ASSERTION = "invalid-assertion"
+	// DIAGNOSTIC_UNUSED_CLASS is a warning of a class that nothing uses
+	DIAGNOSTIC_UNUSED_CLASS = "unused-class"
+	// DIAGNOSTIC_SHADOWED_VAR is a warning of a var with the same name as a var of a map it's in
+	DIAGNOSTIC_SHADOWED_VAR = "shadowed-var"
+	// DIAGNOSTIC_DUPLICATE_EDGE is a warning of a connection the same as one before it
+	DIAGNOSTIC_DUPLICATE_EDGE = "duplicate-edge"
+	// DIAGNOSTIC_EMPTY_GLOB is a warning of a glob that matches nothing
+	DIAGNOSTIC_EMPTY_GLOB = "empty-glob"
+	// DIAGNOSTIC_INVALID is every other problem
+	DIAGNOSTIC_INVALID = "invalid"
+)
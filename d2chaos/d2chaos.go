@@ -269,7 +269,8 @@ func (gs *dslGenState) randStr(n int, inKey bool) string {
 func (gs *dslGenState) randShape() string {
 	for {
 		s := shapes[gs.rand.Intn(len(shapes))]
-		if s != d2target.ShapeImage && s != d2target.ShapeText {
+		// Board shapes need a board to embed and custom shapes need an SVG
+		if s != d2target.ShapeImage && s != d2target.ShapeText && s != d2target.ShapeBoard && s != d2target.ShapeCustom {
 			return s
 		}
 	}
@@ -0,0 +1,86 @@
+package d2cli
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"oss.terrastruct.com/util-go/xdefer"
+
+	"oss.terrastruct.com/util-go/xmain"
+
+	"oss.terrastruct.com/d2/d2converters/d2graphml"
+	"oss.terrastruct.com/d2/d2converters/d2mermaid"
+	"oss.terrastruct.com/d2/d2converters/d2structurizr"
+)
+
+func convertCmd(ctx context.Context, ms *xmain.State, from string, positions bool) (err error) {
+	args := ms.Opts.Flags.Args()[1:]
+	if len(args) == 0 || len(args) > 2 {
+		return xmain.UsageErrorf("convert must be passed an input file and optionally an output file")
+	}
+
+	inputPath := args[0]
+	if from == "" {
+		switch strings.ToLower(filepath.Ext(inputPath)) {
+		case ".mmd", ".mermaid":
+			from = "mermaid"
+		case ".graphml":
+			from = "graphml"
+		case ".dsl":
+			from = "structurizr"
+		default:
+			return xmain.UsageErrorf("--from must be given when the input is not a .mmd, .mermaid, .graphml, or .dsl file")
+		}
+	}
+	if from != "mermaid" && from != "graphml" && from != "structurizr" {
+		return xmain.UsageErrorf("--from must be mermaid, graphml, or structurizr.\nYou provided: %s", from)
+	}
+	if positions && from != "graphml" {
+		return xmain.UsageErrorf("--positions can only be used when converting from graphml")
+	}
+
+	var outputPath string
+	if len(args) == 2 {
+		outputPath = args[1]
+	} else if inputPath == "-" {
+		outputPath = "-"
+	} else {
+		outputPath = renameExt(inputPath, ".d2")
+	}
+	if inputPath != "-" {
+		inputPath = ms.AbsPath(inputPath)
+	}
+	if outputPath != "-" {
+		outputPath = ms.AbsPath(outputPath)
+	}
+
+	defer xdefer.Errorf(&err, "failed to convert %s", ms.HumanPath(inputPath))
+
+	input, err := ms.ReadPath(inputPath)
+	if err != nil {
+		return err
+	}
+	var output string
+	switch from {
+	case "mermaid":
+		output, err = d2mermaid.Convert(string(input))
+	case "graphml":
+		output, err = d2graphml.Convert(string(input), &d2graphml.ConvertOpts{
+			Positions: positions,
+		})
+	case "structurizr":
+		output, err = d2structurizr.Convert(string(input))
+	}
+	if err != nil {
+		return err
+	}
+	err = ms.WritePath(outputPath, []byte(output))
+	if err != nil {
+		return err
+	}
+	if outputPath != "-" {
+		ms.Log.Success.Printf("successfully converted %s to %s", ms.HumanPath(inputPath), ms.HumanPath(outputPath))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package d2cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"oss.terrastruct.com/util-go/xmain"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// writeDiagnostics writes the errors of the compile that failed with err to stderr as report
+// errors, one JSON record per line
+func writeDiagnostics(ms *xmain.State, err error) error {
+	return writeReportErrors(ms, reportErrors(ms, err))
+}
+
+func writeReportErrors(ms *xmain.State, errs []ReportError) error {
+	enc := json.NewEncoder(ms.Stderr)
+	for _, e := range errs {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deniedWarningsError fails a compile with warnings under --deny-warnings
+type deniedWarningsError int
+
+func (n deniedWarningsError) Error() string {
+	if n == 1 {
+		return "1 warning, and --deny-warnings is set"
+	}
+	return fmt.Sprintf("%d warnings, and --deny-warnings is set", int(n))
+}
+
+// writeWarnings writes the warnings of g as --diagnostics asks, and fails with them if
+// --deny-warnings is set
+func writeWarnings(ms *xmain.State, g *d2graph.Graph) error {
+	if len(g.Warnings) == 0 {
+		return nil
+	}
+	if ms.Env.Getenv("D2_DIAGNOSTICS") == "json" {
+		err := writeReportErrors(ms, reportDiagnostics(ms, d2compiler.WarningDiagnostics(g)))
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, w := range g.Warnings {
+			r := reportRange(ms, w.Range)
+			ms.Log.Warn.Printf("%s:%d:%d: %s (%s)", r.Path, r.Start.Line, r.Start.Column, w.Message, w.Code)
+		}
+	}
+	if deny, _ := strconv.ParseBool(ms.Env.Getenv("D2_DENY_WARNINGS")); deny {
+		return deniedWarningsError(len(g.Warnings))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package d2cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/util-go/xdefer"
+
+	"oss.terrastruct.com/util-go/xmain"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+const (
+	diffAddedColor    = "#0D9F4F"
+	diffRemovedColor  = "#D13C3C"
+	diffModifiedColor = "#E0A100"
+)
+
+func diffCmd(ctx context.Context, ms *xmain.State) (err error) {
+	args := ms.Opts.Flags.Args()[1:]
+	if len(args) < 2 || len(args) > 3 {
+		return xmain.UsageErrorf("diff must be passed the old and the new file and optionally an output file for the diff board")
+	}
+	oldPath := ms.AbsPath(args[0])
+	newPath := ms.AbsPath(args[1])
+
+	defer xdefer.Errorf(&err, "failed to diff %s and %s", ms.HumanPath(oldPath), ms.HumanPath(newPath))
+
+	oldInput, err := ms.ReadPath(oldPath)
+	if err != nil {
+		return err
+	}
+	newInput, err := ms.ReadPath(newPath)
+	if err != nil {
+		return err
+	}
+	oldGraph, err := compileDiffInput(ms, oldPath, oldInput)
+	if err != nil {
+		return err
+	}
+	newGraph, err := compileDiffInput(ms, newPath, newInput)
+	if err != nil {
+		return err
+	}
+
+	d := d2graph.Diff(oldGraph, newGraph)
+	fmt.Fprint(ms.Stdout, diffSummary(d))
+
+	if len(args) == 3 {
+		outputPath := args[2]
+		if outputPath != "-" {
+			outputPath = ms.AbsPath(outputPath)
+		}
+		err = ms.WritePath(outputPath, []byte(diffBoard(string(newInput), d)))
+		if err != nil {
+			return err
+		}
+		if outputPath != "-" {
+			ms.Log.Success.Printf("successfully wrote diff board to %s", ms.HumanPath(outputPath))
+		}
+	}
+	return nil
+}
+
+func compileDiffInput(ms *xmain.State, inputPath string, input []byte) (*d2graph.Graph, error) {
+	fetcher, err := importFetcher(ms, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	g, _, err := d2compiler.Compile(inputPath, bytes.NewReader(input), &d2compiler.CompileOptions{
+		IconDir:     ms.Env.Getenv("D2_ICON_DIR"),
+		FetchImport: fetcher.Fetch,
+		Defines:     defines(ms),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, writeLockfile(ms, inputPath, fetcher)
+}
+
+// diffSummary lists additions with +, removals with - and modifications with ~ followed by
+// the attributes that changed
+func diffSummary(d *d2graph.GraphDiff) string {
+	if d.Empty() {
+		return "no differences\n"
+	}
+	var sb strings.Builder
+	for _, obj := range d.AddedObjects {
+		fmt.Fprintf(&sb, "+ %s\n", d2graph.ObjectKey(obj))
+	}
+	for _, obj := range d.RemovedObjects {
+		fmt.Fprintf(&sb, "- %s\n", d2graph.ObjectKey(obj))
+	}
+	for _, od := range d.RenamedObjects {
+		fmt.Fprintf(&sb, "~ %s (renamed from %s)\n", d2graph.ObjectKey(od.New), d2graph.ObjectKey(od.Old))
+		writeDiffChanges(&sb, od.Changes)
+	}
+	for _, od := range d.ModifiedObjects {
+		fmt.Fprintf(&sb, "~ %s\n", d2graph.ObjectKey(od.New))
+		writeDiffChanges(&sb, od.Changes)
+	}
+	for _, e := range d.AddedEdges {
+		fmt.Fprintf(&sb, "+ %s\n", d2graph.EdgeKey(e))
+	}
+	for _, e := range d.RemovedEdges {
+		fmt.Fprintf(&sb, "- %s\n", d2graph.EdgeKey(e))
+	}
+	for _, ed := range d.ModifiedEdges {
+		fmt.Fprintf(&sb, "~ %s\n", d2graph.EdgeKey(ed.New))
+		writeDiffChanges(&sb, ed.Changes)
+	}
+	return sb.String()
+}
+
+func writeDiffChanges(sb *strings.Builder, changes []d2graph.AttributeChange) {
+	for _, c := range changes {
+		fmt.Fprintf(sb, "    %s: %s -> %s\n", c.Attribute, diffValue(c.Old), diffValue(c.New))
+	}
+}
+
+func diffValue(v string) string {
+	if v == "" {
+		return "(unset)"
+	}
+	return d2format.Format(d2ast.RawString(v, false))
+}
+
+// diffBoard returns the new D2 source with styles appended to color what changed: additions
+// are green, modifications are yellow and removals are added back red and dashed.
+func diffBoard(newInput string, d *d2graph.GraphDiff) string {
+	if d.Empty() {
+		return newInput
+	}
+	var sb strings.Builder
+	sb.WriteString(strings.TrimRight(newInput, "\n"))
+	sb.WriteString("\n\n# diff\n")
+
+	for _, obj := range d.AddedObjects {
+		fmt.Fprintf(&sb, "%s.style.stroke: %q\n", d2graph.ObjectKey(obj), diffAddedColor)
+	}
+	for _, od := range d.RenamedObjects {
+		fmt.Fprintf(&sb, "%s.style.stroke: %q\n", d2graph.ObjectKey(od.New), diffModifiedColor)
+	}
+	for _, od := range d.ModifiedObjects {
+		fmt.Fprintf(&sb, "%s.style.stroke: %q\n", d2graph.ObjectKey(od.New), diffModifiedColor)
+	}
+	for _, e := range d.AddedEdges {
+		fmt.Fprintf(&sb, "%s.style.stroke: %q\n", d2graph.EdgeKey(e), diffAddedColor)
+	}
+	for _, ed := range d.ModifiedEdges {
+		fmt.Fprintf(&sb, "%s.style.stroke: %q\n", d2graph.EdgeKey(ed.New), diffModifiedColor)
+	}
+
+	for _, obj := range d.RemovedObjects {
+		fmt.Fprintf(&sb, "%s: {\n", d2graph.ObjectKey(obj))
+		if obj.Label.Value != obj.IDVal {
+			fmt.Fprintf(&sb, "  label: %s\n", d2format.Format(d2ast.RawString(obj.Label.Value, false)))
+		}
+		// Removed tables and classes come back as plain shapes since their rows are gone
+		switch obj.Shape.Value {
+		case "", d2target.ShapeSQLTable, d2target.ShapeClass:
+		default:
+			fmt.Fprintf(&sb, "  shape: %s\n", obj.Shape.Value)
+		}
+		writeRemovedStyle(&sb)
+		sb.WriteString("}\n")
+	}
+	for _, e := range d.RemovedEdges {
+		fmt.Fprintf(&sb, "%s %s %s: {\n", d2graph.ObjectKey(e.Src), e.ArrowString(), d2graph.ObjectKey(e.Dst))
+		if e.Label.Value != "" {
+			fmt.Fprintf(&sb, "  label: %s\n", d2format.Format(d2ast.RawString(e.Label.Value, false)))
+		}
+		writeRemovedStyle(&sb)
+		sb.WriteString("}\n")
+	}
+	return sb.String()
+}
+
+func writeRemovedStyle(sb *strings.Builder) {
+	fmt.Fprintf(sb, "  style.stroke: %q\n", diffRemovedColor)
+	fmt.Fprintf(sb, "  style.font-color: %q\n", diffRemovedColor)
+	sb.WriteString("  style.stroke-dash: 3\n")
+}
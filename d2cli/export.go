@@ -2,6 +2,9 @@ package d2cli
 
 import (
 	"path/filepath"
+	"strings"
+
+	"oss.terrastruct.com/util-go/xmain"
 )
 
 type exportExtension string
@@ -11,8 +14,17 @@ const PNG exportExtension = ".png"
 const PPTX exportExtension = ".pptx"
 const PDF exportExtension = ".pdf"
 const SVG exportExtension = ".svg"
+const JPG exportExtension = ".jpg"
+const JPEG exportExtension = ".jpeg"
+const WEBP exportExtension = ".webp"
+const EXCALIDRAW exportExtension = ".excalidraw"
+const STRUCTURIZR exportExtension = ".dsl"
+const GRAPHML exportExtension = ".graphml"
+const GEXF exportExtension = ".gexf"
+const JSON exportExtension = ".json"
+const TXT exportExtension = ".txt"
 
-var SUPPORTED_EXTENSIONS = []exportExtension{SVG, PNG, PDF, PPTX, GIF}
+var SUPPORTED_EXTENSIONS = []exportExtension{SVG, PNG, PDF, PPTX, GIF, JPG, JPEG, WEBP, EXCALIDRAW, STRUCTURIZR, GRAPHML, GEXF, JSON, TXT}
 
 func getExportExtension(outputPath string) exportExtension {
 	ext := filepath.Ext(outputPath)
@@ -25,6 +37,25 @@ func getExportExtension(outputPath string) exportExtension {
 	return exportExtension(SVG)
 }
 
+// parseExportFormat parses the value of --format, which is an extension with or without its dot
+func parseExportFormat(format string) (exportExtension, bool) {
+	ext := exportExtension("." + strings.TrimPrefix(strings.ToLower(format), "."))
+	for _, kext := range SUPPORTED_EXTENSIONS {
+		if kext == ext {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+// getOutputFormat is the format set with --format, or else the one of the output path's extension
+func getOutputFormat(ms *xmain.State, outputPath string) exportExtension {
+	if ext, ok := parseExportFormat(ms.Env.Getenv("D2_FORMAT")); ok {
+		return ext
+	}
+	return getExportExtension(outputPath)
+}
+
 func (ex exportExtension) supportsAnimation() bool {
 	return ex == SVG || ex == GIF
 }
@@ -34,7 +65,12 @@ func (ex exportExtension) requiresAnimationInterval() bool {
 }
 
 func (ex exportExtension) requiresPNGRenderer() bool {
-	return ex == PNG || ex == PDF || ex == PPTX || ex == GIF
+	return ex == PNG || ex == PDF || ex == PPTX || ex == GIF || ex.isRasterImage()
+}
+
+// isRasterImage is true for formats where a single board is written as one raster image
+func (ex exportExtension) isRasterImage() bool {
+	return ex == PNG || ex == JPG || ex == JPEG || ex == WEBP
 }
 
 func (ex exportExtension) supportsDarkTheme() bool {
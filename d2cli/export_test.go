@@ -65,6 +65,30 @@ func TestOutputFormat(t *testing.T) {
 			requiresAnimationInterval: false,
 			requiresPngRender:         true,
 		},
+		{
+			outputPath:                "/out.jpg",
+			extension:                 JPG,
+			supportsDarkTheme:         false,
+			supportsAnimation:         false,
+			requiresAnimationInterval: false,
+			requiresPngRender:         true,
+		},
+		{
+			outputPath:                "/out.jpeg",
+			extension:                 JPEG,
+			supportsDarkTheme:         false,
+			supportsAnimation:         false,
+			requiresAnimationInterval: false,
+			requiresPngRender:         true,
+		},
+		{
+			outputPath:                "/out.webp",
+			extension:                 WEBP,
+			supportsDarkTheme:         false,
+			supportsAnimation:         false,
+			requiresAnimationInterval: false,
+			requiresPngRender:         true,
+		},
 		{
 			outputPath:                "/out.gif",
 			extension:                 GIF,
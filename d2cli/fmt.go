@@ -3,8 +3,11 @@ package d2cli
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"oss.terrastruct.com/util-go/xdefer"
 
@@ -14,14 +17,19 @@ import (
 	"oss.terrastruct.com/d2/d2parser"
 )
 
-func fmtCmd(ctx context.Context, ms *xmain.State) (err error) {
+func fmtCmd(ctx context.Context, ms *xmain.State, check bool, indent string, width int, sortStyles bool) (err error) {
 	defer xdefer.Errorf(&err, "failed to fmt")
 
 	ms.Opts = xmain.NewOpts(ms.Env, ms.Opts.Flags.Args()[1:])
 	if len(ms.Opts.Args) == 0 {
 		return xmain.UsageErrorf("fmt must be passed at least one file to be formatted")
 	}
+	opts, err := fmtOptions(indent, width, sortStyles)
+	if err != nil {
+		return err
+	}
 
+	var unformatted []string
 	for _, inputPath := range ms.Opts.Args {
 		if inputPath != "-" {
 			inputPath = ms.AbsPath(inputPath)
@@ -41,12 +49,51 @@ func fmtCmd(ctx context.Context, ms *xmain.State) (err error) {
 			return err
 		}
 
-		output := []byte(d2format.Format(m))
-		if !bytes.Equal(output, input) {
+		output := []byte(d2format.FormatWithOptions(m, opts))
+		if check {
+			if !bytes.Equal(output, input) {
+				unformatted = append(unformatted, inputPath)
+			}
+			continue
+		}
+		// Stdin is always written back to stdout, so fmt can be used as a filter
+		if inputPath == "-" || !bytes.Equal(output, input) {
 			if err := ms.WritePath(inputPath, output); err != nil {
 				return err
 			}
 		}
 	}
+
+	if len(unformatted) > 0 {
+		for _, inputPath := range unformatted {
+			if inputPath == "-" {
+				fmt.Fprintln(ms.Stdout, "<stdin>")
+			} else {
+				fmt.Fprintln(ms.Stdout, ms.HumanPath(inputPath))
+			}
+		}
+		return xmain.ExitErrorf(1, "%d file(s) not formatted", len(unformatted))
+	}
 	return nil
 }
+
+// fmtOptions parses the --indent, a number of spaces or tab, --width and --sort-styles flags
+func fmtOptions(indent string, width int, sortStyles bool) (*d2format.Options, error) {
+	opts := &d2format.Options{
+		Width:      width,
+		SortStyles: sortStyles,
+	}
+	if strings.EqualFold(indent, "tab") {
+		opts.Indent = "\t"
+	} else {
+		n, err := strconv.Atoi(indent)
+		if err != nil || n < 1 || n > 8 {
+			return nil, xmain.UsageErrorf("--indent must be a number of spaces from 1 to 8 or tab, got %q", indent)
+		}
+		opts.Indent = strings.Repeat(" ", n)
+	}
+	if width < 0 {
+		return nil, xmain.UsageErrorf("--width must not be negative, got %d", width)
+	}
+	return opts, nil
+}
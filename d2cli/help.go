@@ -13,6 +13,7 @@ import (
 
 	"oss.terrastruct.com/d2/d2plugin"
 	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/iconpack"
 	"oss.terrastruct.com/d2/lib/version"
 )
 
@@ -21,7 +22,11 @@ func help(ms *xmain.State) {
 Usage:
   %[1]s [--watch=false] [--theme=0] file.d2 [file.svg | file.png]
   %[1]s layout [name]
-  %[1]s fmt file.d2 ...
+  %[1]s fmt [--check] [--indent=2] [--width=0] [--sort-styles] file.d2 ...
+  %[1]s convert [--from=mermaid|graphml|structurizr] file.mmd [file.d2]
+  %[1]s lint [--format=json] [--lint-config=.d2lint.json] file.d2
+  %[1]s lsp
+  %[1]s rename [--write] old.key new.key file.d2
 
 %[1]s compiles and renders file.d2 to file.svg | file.png
 It defaults to file.svg if an output path is not provided.
@@ -37,10 +42,16 @@ Subcommands:
   %[1]s layout - Lists available layout engine options with short help
   %[1]s layout [name] - Display long help for a particular layout engine, including its configuration options
   %[1]s themes - Lists available themes
-  %[1]s fmt file.d2 ... - Format passed files
+  %[1]s icons search query - Search the built-in icon packs for icons to write like icon: aws/s3
+  %[1]s fmt file.d2 ... - Format passed files, or stdin to stdout with -. --check lists the files that aren't formatted and exits with code 1 instead
+  %[1]s convert file.mmd [file.d2] - Convert a Mermaid flowchart or sequence diagram, a GraphML graph such as one from yEd, or a Structurizr DSL workspace, into D2
+  %[1]s diff old.d2 new.d2 [diff.d2] - Summarize what changed between two diagrams and optionally write a diff board coloring additions, removals and modifications
+  %[1]s lint file.d2 - Check a diagram for orphan shapes, duplicate labels, layers nothing links to, unreadable labels, and oversized images, exiting with code 1 if any are found
+  %[1]s lsp - Serve the Language Server Protocol over stdin and stdout, for diagnostics, go to definition, completion, hover, rename and formatting in editors
+  %[1]s rename old.key new.key file.d2 - Rename an object everywhere it's written in a file, including connections, globs and maps, and print the diff. --write also writes the renamed file
 
 See more docs and the source code at https://oss.terrastruct.com/d2.
-Hosted icons at https://icons.terrastruct.com.
+Hosted icons at https://icons.terrastruct.com, and built into d2 with %[1]s icons.
 Playground runner at https://play.d2lang.com.
 `, filepath.Base(ms.Name), version.Version, ms.Opts.Defaults())
 }
@@ -59,6 +70,31 @@ func themesCmd(ctx context.Context, ms *xmain.State) {
 	fmt.Fprintf(ms.Stdout, "Available themes:\n%s", d2themescatalog.CLIString())
 }
 
+func iconsCmd(ctx context.Context, ms *xmain.State) error {
+	args := ms.Opts.Flags.Args()[1:]
+	if len(args) == 0 {
+		fmt.Fprintf(ms.Stdout, `Built-in icon packs: %s
+
+Icons are written like icon: aws/s3. Find them with:
+  %s icons search query
+`, strings.Join(iconpack.Packs, ", "), filepath.Base(ms.Name))
+		return nil
+	}
+	if args[0] != "search" || len(args) == 1 {
+		return xmain.UsageErrorf("icons subcommand takes no arguments, or search and a query")
+	}
+	query := strings.Join(args[1:], " ")
+	icons := iconpack.Search(query)
+	if len(icons) == 0 {
+		fmt.Fprintf(ms.Stdout, "No icons match %q\n", query)
+		return nil
+	}
+	for _, i := range icons {
+		fmt.Fprintf(ms.Stdout, "%s - %s\n", i.Name, i.URL())
+	}
+	return nil
+}
+
 func shortLayoutHelp(ctx context.Context, ms *xmain.State, ps []d2plugin.Plugin) error {
 	var pluginLines []string
 	pinfos, err := d2plugin.ListPluginInfos(ctx, ps)
@@ -0,0 +1,54 @@
+package d2cli
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/util-go/xmain"
+
+	"oss.terrastruct.com/d2/lib/remoteimport"
+)
+
+// importFetcher returns the fetcher of the remote imports of the diagram at inputPath, which
+// are pinned in the d2.lock next to it. --frozen is read from D2_FROZEN. Git imports are
+// fetched over the protocols in GIT_ALLOW_PROTOCOL, or https and ssh if it isn't set.
+func importFetcher(ms *xmain.State, inputPath string) (*remoteimport.Fetcher, error) {
+	lockfile, err := remoteimport.ReadLockfile(lockfilePath(ms, inputPath))
+	if err != nil {
+		return nil, err
+	}
+	f := &remoteimport.Fetcher{
+		Lockfile: lockfile,
+	}
+	f.Frozen, _ = strconv.ParseBool(ms.Env.Getenv("D2_FROZEN"))
+	if protocols := ms.Env.Getenv("GIT_ALLOW_PROTOCOL"); protocols != "" {
+		f.GitProtocols = strings.Split(protocols, ":")
+	}
+	if dir, err := remoteimport.DefaultCacheDir(); err == nil {
+		f.CacheDir = dir
+	}
+	return f, nil
+}
+
+// writeLockfile writes the d2.lock next to the diagram at inputPath if f pinned new imports
+func writeLockfile(ms *xmain.State, inputPath string, f *remoteimport.Fetcher) error {
+	if f.Frozen || !f.Changed() {
+		return nil
+	}
+	p := lockfilePath(ms, inputPath)
+	err := f.Lockfile.Write(p)
+	if err != nil {
+		return err
+	}
+	ms.Log.Info.Printf("pinned remote imports in %s", ms.HumanPath(p))
+	return nil
+}
+
+func lockfilePath(ms *xmain.State, inputPath string) string {
+	dir := ms.PWD
+	if inputPath != "-" {
+		dir = filepath.Dir(inputPath)
+	}
+	return filepath.Join(dir, remoteimport.LockfileName)
+}
@@ -0,0 +1,151 @@
+package d2cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"oss.terrastruct.com/util-go/xdefer"
+
+	"oss.terrastruct.com/util-go/xmain"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2lint"
+)
+
+// lintConfigName is the config file lint reads next to the input when --lint-config isn't given
+const lintConfigName = ".d2lint.json"
+
+// LintProblem is a d2lint.Problem as printed by lint --format=json
+type LintProblem struct {
+	Rule    string       `json:"rule"`
+	Message string       `json:"message"`
+	Board   []string     `json:"board,omitempty"`
+	Range   *ReportRange `json:"range"`
+}
+
+func lintCmd(ctx context.Context, ms *xmain.State, format, configPath string) error {
+	args := ms.Opts.Flags.Args()[1:]
+	if len(args) != 1 {
+		return xmain.UsageErrorf("lint must be passed one input file")
+	}
+	if format != "" && format != "json" {
+		return xmain.UsageErrorf("--format must be json or not given for lint.\nYou provided: %s", format)
+	}
+	inputPath := args[0]
+	if inputPath != "-" {
+		inputPath = ms.AbsPath(inputPath)
+		d, err := os.Stat(inputPath)
+		if err == nil && d.IsDir() {
+			inputPath = filepath.Join(inputPath, "index.d2")
+		}
+	}
+
+	problems, err := lint(ms, inputPath, configPath)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		out := []LintProblem{}
+		for _, p := range problems {
+			out = append(out, LintProblem{
+				Rule:    p.Rule,
+				Message: p.Message,
+				Board:   p.Board,
+				Range:   reportRange(ms, p.Range),
+			})
+		}
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ms.Stdout, "%s\n", b)
+	} else {
+		for _, p := range problems {
+			r := reportRange(ms, p.Range)
+			fmt.Fprintf(ms.Stdout, "%s:%d:%d: %s (%s)\n", r.Path, r.Start.Line, r.Start.Column, p.Message, p.Rule)
+		}
+	}
+
+	if len(problems) > 0 {
+		return xmain.ExitErrorf(1, "%d problem(s) found", len(problems))
+	}
+	return nil
+}
+
+// lint compiles the input and lints it with the config at configPath
+func lint(ms *xmain.State, inputPath, configPath string) (_ []d2lint.Problem, err error) {
+	defer xdefer.Errorf(&err, "failed to lint %s", ms.HumanPath(inputPath))
+
+	config, err := readLintConfig(ms, inputPath, configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := ms.ReadPath(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, err := importFetcher(ms, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	g, d2config, err := d2compiler.Compile(inputPath, bytes.NewReader(input), &d2compiler.CompileOptions{
+		IconDir:     ms.Env.Getenv("D2_ICON_DIR"),
+		FetchImport: fetcher.Fetch,
+		Defines:     defines(ms),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = writeLockfile(ms, inputPath, fetcher)
+	if err != nil {
+		return nil, err
+	}
+	opts := &d2lint.Options{
+		Config:    *config,
+		InputPath: inputPath,
+	}
+	if d2config != nil && d2config.ThemeID != nil {
+		opts.ThemeID = *d2config.ThemeID
+	}
+	return d2lint.Lint(g, opts)
+}
+
+// readLintConfig reads the config at configPath, or else at lintConfigName next to the input
+// if there's one
+func readLintConfig(ms *xmain.State, inputPath, configPath string) (*d2lint.Config, error) {
+	if configPath == "" {
+		dir := ms.PWD
+		if inputPath != "-" {
+			dir = filepath.Dir(inputPath)
+		}
+		configPath = filepath.Join(dir, lintConfigName)
+		if _, err := os.Stat(configPath); errors.Is(err, fs.ErrNotExist) {
+			return &d2lint.Config{}, nil
+		}
+	} else {
+		configPath = ms.AbsPath(configPath)
+	}
+
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var config d2lint.Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to read lint config %s: %w", ms.HumanPath(configPath), err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid lint config %s: %w", ms.HumanPath(configPath), err)
+	}
+	return &config, nil
+}
@@ -0,0 +1,18 @@
+package d2cli
+
+import (
+	"context"
+
+	"oss.terrastruct.com/util-go/xmain"
+
+	"oss.terrastruct.com/d2/d2lsp"
+)
+
+// lspCmd serves the Language Server Protocol over stdin and stdout for editors. Logs still go
+// to stderr, which editors show in their output panels.
+func lspCmd(ctx context.Context, ms *xmain.State) error {
+	if len(ms.Opts.Flags.Args()) > 1 {
+		return xmain.UsageErrorf("lsp subcommand accepts no arguments")
+	}
+	return d2lsp.Serve(ctx, ms.Stdin, ms.Stdout)
+}
@@ -1,10 +1,13 @@
 package d2cli
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image/color"
+	stdpng "image/png"
 	"io"
 	"io/fs"
 	"os"
@@ -15,6 +18,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/golang/freetype/truetype"
 	"github.com/playwright-community/playwright-go"
 	"github.com/spf13/pflag"
 	"go.uber.org/multierr"
@@ -24,17 +28,27 @@ import (
 
 	"oss.terrastruct.com/d2/d2ast"
 	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2ratio"
 	"oss.terrastruct.com/d2/d2lib"
 	"oss.terrastruct.com/d2/d2parser"
 	"oss.terrastruct.com/d2/d2plugin"
 	"oss.terrastruct.com/d2/d2renderers/d2animate"
+	"oss.terrastruct.com/d2/d2renderers/d2ascii"
+	"oss.terrastruct.com/d2/d2renderers/d2excalidraw"
 	"oss.terrastruct.com/d2/d2renderers/d2fonts"
+	"oss.terrastruct.com/d2/d2renderers/d2graphml"
+	"oss.terrastruct.com/d2/d2renderers/d2json"
+	"oss.terrastruct.com/d2/d2renderers/d2latex"
+	"oss.terrastruct.com/d2/d2renderers/d2structurizr"
 	"oss.terrastruct.com/d2/d2renderers/d2svg"
 	"oss.terrastruct.com/d2/d2renderers/d2svg/appendix"
 	"oss.terrastruct.com/d2/d2target"
 	"oss.terrastruct.com/d2/d2themes"
 	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/attribution"
 	"oss.terrastruct.com/d2/lib/background"
+	fontlib "oss.terrastruct.com/d2/lib/font"
+	"oss.terrastruct.com/d2/lib/imagemap"
 	"oss.terrastruct.com/d2/lib/imgbundler"
 	ctxlog "oss.terrastruct.com/d2/lib/log"
 	"oss.terrastruct.com/d2/lib/pdf"
@@ -74,6 +88,7 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 		ms.Log.Warn.Printf("Invalid DEBUG flag value ignored")
 		debugFlag = go2.Pointer(false)
 	}
+	bundleIconsFlag := ms.Opts.String("D2_BUNDLE_ICONS", "bundle-icons", "", imgbundler.ModeInline, "how remote images such as icons are bundled. 'inline' fetches and inlines them on every render, 'cache' also inlines them but reuses copies saved in the user's cache directory so repeated and offline renders don't refetch them, and 'skip' leaves them as links.")
 	imgCacheFlag, err := ms.Opts.Bool("IMG_CACHE", "img-cache", "", true, "in watch mode, images used in icons are cached for subsequent compilations. This should be disabled if images might change.")
 	if err != nil {
 		return err
@@ -83,6 +98,7 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 	if err != nil {
 		return err
 	}
+	themePathFlag := ms.Opts.String("D2_THEME_PATH", "theme-path", "", "", "path to a theme file, .json or .d2, or a directory of them, whose themes can then be used by their IDs like the built-in ones. Theme files set a palette and optionally fonts and default styles for shapes and connections.")
 	darkThemeFlag, err := ms.Opts.Int64("D2_DARK_THEME", "dark-theme", "", -1, "the theme to use when the viewer's browser is in dark mode. When left unset -theme is used for both light and dark mode. Be aware that explicit styles set in D2 code will still be applied and this may produce unexpected results. We plan on resolving this by making style maps in D2 light/dark mode specific. See https://github.com/terrastruct/d2/issues/831.")
 	if err != nil {
 		return err
@@ -95,6 +111,18 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 	if err != nil {
 		return err
 	}
+	animateTransitionFlag, err := ms.Opts.Int64("D2_ANIMATE_TRANSITION", "animate-transition", "", 0, "if given with --animate-interval, each board morphs from the one before over this many milliseconds, moving the shapes they share into place and fading in the rest, instead of cutting to it. Can only be used with SVG exports.")
+	if err != nil {
+		return err
+	}
+	qualityFlag, err := ms.Opts.Int64("D2_QUALITY", "quality", "", png.DEFAULT_QUALITY, "quality of lossy raster exports (JPEG and WebP), from 1 to 100.")
+	if err != nil {
+		return err
+	}
+	renderTimeoutFlag, err := ms.Opts.Int64("D2_RENDER_TIMEOUT", "render-timeout", "", 60, "the maximum number of seconds to spend converting each board into an image for PNG, JPEG, WebP, PDF, PPTX, and GIF exports, e.g. while waiting on remote images. Boards that time out are retried once with a restarted browser. Set to 0 for no limit.")
+	if err != nil {
+		return err
+	}
 	timeoutFlag, err := ms.Opts.Int64("D2_TIMEOUT", "timeout", "", 120, "the maximum number of seconds that D2 runs for before timing out and exiting. When rendering a large diagram, it is recommended to increase this value")
 	if err != nil {
 		return err
@@ -113,16 +141,101 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 	if err != nil {
 		return err
 	}
+	edgeJumpsFlag, err := ms.Opts.Bool("D2_EDGE_JUMPS", "edge-jumps", "", false, "draw a hop where a connection crosses another, for dense diagrams where crossings can't be avoided")
+	if err != nil {
+		return err
+	}
+	sourceMapFlag, err := ms.Opts.Bool("D2_SOURCE_MAP", "source-map", "", false, "set data-d2-loc attributes on the elements of shapes and connections in SVGs to where they're declared in the input, like data-d2-loc=\"x.d2:3:1\", so editors can go from the render to the source")
+	if err != nil {
+		return err
+	}
+	codeThemeFlag := ms.Opts.String("D2_CODE_THEME", "code-theme", "", d2svg.DEFAULT_CODE_THEME, "the style code and the code blocks of markdown are highlighted with, e.g. monokai. See https://xyproto.github.io/splash/docs/ for the options.")
+	darkCodeThemeFlag := ms.Opts.String("D2_DARK_CODE_THEME", "dark-code-theme", "", d2svg.DEFAULT_DARK_CODE_THEME, "the style code is highlighted with in dark mode")
 	scaleFlag, err := ms.Opts.Float64("SCALE", "scale", "", -1, "scale the output. E.g., 0.5 to halve the default size. Default -1 means that SVG's will fit to screen and all others will use their default render size. Setting to 1 turns off SVG fitting to screen.")
 	if err != nil {
 		return err
 	}
+	quantizeFlag, err := ms.Opts.Float64("D2_QUANTIZE", "quantize", "", 0, "round the coordinates of SVG elements to multiples of this step, e.g. 1 for integers, so that rerendered SVGs checked into version control have small diffs. Must divide 1 evenly, e.g. 1, 0.5, or 0.1.")
+	if err != nil {
+		return err
+	}
+	mediumFlag := ms.Opts.String("D2_MEDIUM", "medium", "", "", "the medium to export for, which sets the default font sizes, stroke widths, and padding. screen keeps the defaults, print thins strokes and padding for paper, and slide enlarges texts and strokes for presentations. Styles set in the diagram and --pad take precedence.")
+	targetRatioFlag := ms.Opts.String("D2_TARGET_RATIO", "target-ratio", "", "", "the aspect ratio, width:height, to lay out boards close to, e.g. --target-ratio=16:9 for slides. Each group of connected shapes is laid out down or right, whichever fits better, long chains wrap onto rows, and the groups are packed together.")
+	stylesheetFlag := ms.Opts.String("D2_STYLESHEET", "stylesheet", "", "", "path to a D2 file of classes, e.g. corp.d2css with classes: {service: {...}}, which every board can use as if it defined them, so diagrams share classes without importing them. Classes defined in the diagram take precedence.")
+	iconDirFlag := ms.Opts.String("D2_ICON_DIR", "icon-dir", "", "", "directory of icon packs, which icons like @aws/s3 are found in, e.g. aws/s3.svg. They're inlined into the diagram, like icons which are relative paths, e.g. ./assets/db.svg, so diagrams with them build offline.")
+	compactFlag, err := ms.Opts.Bool("D2_COMPACT", "compact", "", false, "slide shapes together after layout as far as their connections allow, instead of spacing every rank the same, for less whitespace in sparse diagrams")
+	if err != nil {
+		return err
+	}
+	highlightStepsFlag, err := ms.Opts.Bool("D2_HIGHLIGHT_STEPS", "highlight-steps", "", false, "highlight what each step adds with a green stroke, and add what it removes back faded, compared to the step before it, so walkthroughs emphasize what changes without styling every step by hand")
+	if err != nil {
+		return err
+	}
+	snapFlag, err := ms.Opts.Int64("D2_SNAP", "snap", "", 0, "snap the sides of shapes, and the points of connections drawn with only horizontal and vertical segments, to a grid of this many pixels after layout, for neater diagrams and smaller diffs of rerendered SVGs. E.g. --snap=8. 0 doesn't snap. Overrides vars.d2-config.snap.")
+	if err != nil {
+		return err
+	}
+	boardFlag := ms.Opts.String("D2_BOARD", "board", "", "", "comma separated patterns of the boards to render, so that parts of large multi-board diagrams can be re-exported quickly. Boards are written with / between their parts, like the files of multi-board exports, and * matches any characters within a part, e.g. --board='scenarios/prod/*' renders the boards in scenario prod. ** matches any number of parts. Boards that aren't selected aren't laid out.")
+	hideLayerGroupsFlag := ms.Opts.String("D2_HIDE_LAYER_GROUPS", "hide-layer-groups", "", "", "comma separated `names` of layer groups, set with style.layer-group, to draw hidden. SVGs still have them in <g> elements with IDs like layer-group-<name>, so they can be toggled on, as watch mode does. E.g. --hide-layer-groups='after,optional'.")
+	collapseFlag := ms.Opts.String("D2_COLLAPSE", "collapse", "", "", "comma separated IDs of containers to draw without their contents, so one diagram can yield an overview. Connections to their contents are drawn to them instead. E.g. --collapse='backend,frontend'.")
+	depthFlag, err := ms.Opts.Int64("D2_DEPTH", "depth", "", 0, "collapse the containers nested at this depth, where top level objects are at depth 1, so nothing is drawn deeper. 0 draws everything.")
+	if err != nil {
+		return err
+	}
+	focusFlag := ms.Opts.String("D2_FOCUS", "focus", "", "", "ID of an object to only draw the neighborhood of: it, its contents, and the objects up to --radius connections away from them, in their containers. E.g. --focus='backend.api' --radius=2.")
+	radiusFlag, err := ms.Opts.Int64("D2_RADIUS", "radius", "", 1, "how many connections away from --focus objects are drawn.")
+	if err != nil {
+		return err
+	}
+	pdfRendererFlag := ms.Opts.String("D2_PDF_RENDERER", "pdf-renderer", "", "browser", "how boards are drawn into PDF exports. browser renders every board to an image in a headless browser. auto draws boards as vectors without a browser, falling back to the browser for boards using shapes or styles the vector renderer doesn't support.")
 	targetFlag := ms.Opts.String("", "target", "", "*", "target board to render. Pass an empty string to target root board. If target ends with '*', it will be rendered with all of its scenarios, steps, and layers. Otherwise, only the target board will be rendered. E.g. --target='' to render root board only or --target='layers.x.*' to render layer 'x' with all of its children.")
+	cropFlag := ms.Opts.String("D2_CROP", "crop", "", "", "ID of an object or connection to crop raster exports (PNG, JPEG, and WebP) to, rendered at full resolution. E.g. --crop='container.a' exports only the bounding box of 'container.a'.")
+	imageMapFlag := ms.Opts.String("D2_IMAGE_MAP", "image-map", "", "", "also write the clickable regions of raster exports (PNG, JPEG, and WebP) next to each image, so links and tooltips survive rasterization. html writes a page showing the image with an HTML image map to <output>.map.html and json writes the region of every object keyed by ID to <output>.map.json.")
+	formatFlag := ms.Opts.String("D2_FORMAT", "format", "", "", "format to export to, instead of the one inferred from the output file extension. E.g. --format=graphml to export the diagram's structure and layout as GraphML. One of svg, png, pdf, pptx, gif, jpg, jpeg, webp, excalidraw, dsl, graphml, gexf, json, or txt.")
+	fromFlag := ms.Opts.String("", "from", "", "", "the format of the diagram passed to the convert subcommand, mermaid, graphml, or structurizr. Inferred from the file extension (.mmd, .mermaid, .graphml, or .dsl) when not given.")
+	positionsFlag, err := ms.Opts.Bool("", "positions", "", false, "keep the positions of nodes with top and left when converting from GraphML. Only some layout engines support them.")
+	if err != nil {
+		return err
+	}
+	fmtCheckFlag, err := ms.Opts.Bool("", "check", "", false, "make the fmt subcommand list the files that aren't formatted and exit with code 1 instead of formatting them, e.g. for CI and pre-commit hooks.")
+	if err != nil {
+		return err
+	}
+	fmtIndentFlag := ms.Opts.String("", "indent", "", "2", "what the fmt subcommand indents each level of nesting with, a number of spaces or tab.")
+	fmtWidthFlag, err := ms.Opts.Int64("", "width", "", 0, "make the fmt subcommand break maps and arrays written on one line onto one line per item when the line is longer than this. 0 never breaks them.")
+	if err != nil {
+		return err
+	}
+	fmtSortStylesFlag, err := ms.Opts.Bool("", "sort-styles", "", false, "make the fmt subcommand sort the keys of style maps alphabetically.")
+	if err != nil {
+		return err
+	}
+	renameWriteFlag, err := ms.Opts.Bool("", "write", "", false, "make the rename subcommand write the renamed file instead of only printing the diff of it.")
+	if err != nil {
+		return err
+	}
+	frozenFlag, err := ms.Opts.Bool("D2_FROZEN", "frozen", "", false, "fail instead of fetching remote imports that d2.lock doesn't pin, and never update d2.lock, e.g. for CI.")
+	if err != nil {
+		return err
+	}
+	defineFlag := ms.Opts.String("D2_DEFINE", "define", "", "", "comma separated vars to set on the root board, overriding the vars of the diagram with the same names, e.g. --define='env=prod,region=eu'. Parts of the diagram in if: env == prod { ... } are only compiled when their condition holds, so one diagram can be rendered per environment.")
+	lintConfigFlag := ms.Opts.String("D2_LINT_CONFIG", "lint-config", "", "", "path to the JSON config of the rules of the lint subcommand. Defaults to .d2lint.json next to the input if there's one.")
+	iconAttributionFlag := ms.Opts.String("D2_ICON_ATTRIBUTION", "icon-attribution", "", "", "path to write a JSON manifest of the remote icons used by all boards to, grouped by icon pack with each pack's source and license, for reviewing licenses before shipping diagrams. Icons from unknown sources are listed separately. Pass - to write it to stdout.")
+	denyWarningsFlag, err := ms.Opts.Bool("D2_DENY_WARNINGS", "deny-warnings", "", false, "fail if the input has warnings, like unused classes or globs that match nothing, for CI. Warnings are suppressed with a '# d2-ignore' comment on or above their line.")
+	if err != nil {
+		return err
+	}
+	diagnosticsFlag := ms.Opts.String("D2_DIAGNOSTICS", "diagnostics", "", "text", "how to write the problems in the input. text writes them as messages, and json writes each to stderr as a line of JSON, an error like those of --report with its severity, diagnostic code and suggested fixes, for CI annotations and editors.")
+	iconAttributionFooterFlag, err := ms.Opts.Bool("D2_ICON_ATTRIBUTION_FOOTER", "icon-attribution-footer", "", false, "add a footer crediting the icon packs used by each board to SVG, PNG, JPEG, and WebP exports.")
+	if err != nil {
+		return err
+	}
+	reportFlag := ms.Opts.String("D2_REPORT", "report", "", "", "path to write a JSON report of the compile to, for CI. It has whether the compile succeeded, errors with their codes and source ranges, warnings, the compiled boards, and the SHA-256 of every file written. Pass - to write it to stdout.")
 
-	fontRegularFlag := ms.Opts.String("D2_FONT_REGULAR", "font-regular", "", "", "path to .ttf file to use for the regular font. If none provided, Source Sans Pro Regular is used.")
-	fontItalicFlag := ms.Opts.String("D2_FONT_ITALIC", "font-italic", "", "", "path to .ttf file to use for the italic font. If none provided, Source Sans Pro Regular-Italic is used.")
-	fontBoldFlag := ms.Opts.String("D2_FONT_BOLD", "font-bold", "", "", "path to .ttf file to use for the bold font. If none provided, Source Sans Pro Bold is used.")
-	fontSemiboldFlag := ms.Opts.String("D2_FONT_SEMIBOLD", "font-semibold", "", "", "path to .ttf file to use for the semibold font. If none provided, Source Sans Pro Semibold is used.")
+	fontRegularFlag := ms.Opts.String("D2_FONT_REGULAR", "font-regular", "", "", "path to .ttf or .woff file to use for the regular font. If none provided, Source Sans Pro Regular is used.")
+	fontItalicFlag := ms.Opts.String("D2_FONT_ITALIC", "font-italic", "", "", "path to .ttf or .woff file to use for the italic font. If none provided, Source Sans Pro Regular-Italic is used.")
+	fontBoldFlag := ms.Opts.String("D2_FONT_BOLD", "font-bold", "", "", "path to .ttf or .woff file to use for the bold font. If none provided, Source Sans Pro Bold is used.")
+	fontSemiboldFlag := ms.Opts.String("D2_FONT_SEMIBOLD", "font-semibold", "", "", "path to .ttf or .woff file to use for the semibold font. If none provided, Source Sans Pro Semibold is used.")
 
 	plugins, err := d2plugin.ListPlugins(ctx)
 	if err != nil {
@@ -133,6 +246,7 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 		return err
 	}
 
+	ms.Opts.Flags.SetNormalizeFunc(normalizeFlagName)
 	err = ms.Opts.Flags.Parse(ms.Opts.Args)
 	if !errors.Is(err, pflag.ErrHelp) && err != nil {
 		return xmain.UsageErrorf("failed to parse flags: %v", err)
@@ -143,11 +257,37 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 		return nil
 	}
 
+	if *themePathFlag != "" {
+		err = registerThemes(ms.AbsPath(*themePathFlag))
+		if err != nil {
+			return xmain.UsageErrorf("--theme-path: %v", err)
+		}
+	}
+	// Fonts set by the flags take precedence over those of the theme
+	if fonts := d2themescatalog.Find(*themeFlag).Fonts; fonts != nil {
+		for _, f := range []struct{ flag, font *string }{
+			{fontRegularFlag, &fonts.Regular},
+			{fontItalicFlag, &fonts.Italic},
+			{fontBoldFlag, &fonts.Bold},
+			{fontSemiboldFlag, &fonts.Semibold},
+		} {
+			if *f.flag == "" {
+				*f.flag = *f.font
+			}
+		}
+	}
+
 	fontFamily, err := loadFonts(ms, *fontRegularFlag, *fontItalicFlag, *fontBoldFlag, *fontSemiboldFlag)
 	if err != nil {
 		return xmain.UsageErrorf("failed to load specified fonts: %v", err)
 	}
 
+	ms.Env.Setenv("D2_FROZEN", strconv.FormatBool(*frozenFlag))
+	if _, err := parseDefines(*defineFlag); err != nil {
+		return xmain.UsageErrorf("--define: %v", err)
+	}
+	ms.Env.Setenv("D2_DEFINE", *defineFlag)
+
 	if len(ms.Opts.Flags.Args()) > 0 {
 		switch ms.Opts.Flags.Arg(0) {
 		case "init-playwright":
@@ -157,8 +297,20 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 		case "themes":
 			themesCmd(ctx, ms)
 			return nil
+		case "icons":
+			return iconsCmd(ctx, ms)
 		case "fmt":
-			return fmtCmd(ctx, ms)
+			return fmtCmd(ctx, ms, *fmtCheckFlag, *fmtIndentFlag, int(*fmtWidthFlag), *fmtSortStylesFlag)
+		case "convert":
+			return convertCmd(ctx, ms, *fromFlag, *positionsFlag)
+		case "diff":
+			return diffCmd(ctx, ms)
+		case "lint":
+			return lintCmd(ctx, ms, *formatFlag, *lintConfigFlag)
+		case "lsp":
+			return lspCmd(ctx, ms)
+		case "rename":
+			return renameCmd(ctx, ms, *renameWriteFlag)
 		case "version":
 			if len(ms.Opts.Flags.Args()) > 1 {
 				return xmain.UsageErrorf("version subcommand accepts no arguments")
@@ -174,12 +326,30 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 	if *imgCacheFlag {
 		ms.Env.Setenv("IMG_CACHE", "1")
 	}
+	switch *bundleIconsFlag {
+	case imgbundler.ModeCache, imgbundler.ModeInline, imgbundler.ModeSkip:
+		ms.Env.Setenv("D2_BUNDLE_ICONS", *bundleIconsFlag)
+	default:
+		return xmain.UsageErrorf("--bundle-icons must be one of %s, %s, or %s.\nYou provided: %s", imgbundler.ModeCache, imgbundler.ModeInline, imgbundler.ModeSkip, *bundleIconsFlag)
+	}
+	// Typesetting LaTeX is slow, so expressions are kept for the next build
+	if dir, err := os.UserCacheDir(); err == nil {
+		d2latex.CacheDir = filepath.Join(dir, "d2", "latex")
+	}
 	if *browserFlag != "" {
 		ms.Env.Setenv("BROWSER", *browserFlag)
 	}
 	if timeoutFlag != nil {
 		os.Setenv("D2_TIMEOUT", fmt.Sprintf("%d", *timeoutFlag))
 	}
+	if *qualityFlag < 1 || *qualityFlag > 100 {
+		return xmain.UsageErrorf("--quality must be between 1 and 100.\nYou provided: %d", *qualityFlag)
+	}
+	ms.Env.Setenv("D2_QUALITY", strconv.FormatInt(*qualityFlag, 10))
+	if *renderTimeoutFlag < 0 {
+		return xmain.UsageErrorf("--render-timeout must be 0 or greater.\nYou provided: %d", *renderTimeoutFlag)
+	}
+	ms.Env.Setenv("D2_RENDER_TIMEOUT", strconv.FormatInt(*renderTimeoutFlag, 10))
 
 	var inputPath string
 	var outputPath string
@@ -198,11 +368,22 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 	if len(ms.Opts.Flags.Args()) >= 1 {
 		inputPath = ms.Opts.Flags.Arg(0)
 	}
+	var outputFormat exportExtension
+	if *formatFlag != "" {
+		var ok bool
+		outputFormat, ok = parseExportFormat(*formatFlag)
+		if !ok {
+			return xmain.UsageErrorf("--format must be one of svg, png, pdf, pptx, gif, jpg, jpeg, webp, excalidraw, dsl, graphml, gexf, json, or txt.\nYou provided: %s", *formatFlag)
+		}
+		ms.Env.Setenv("D2_FORMAT", *formatFlag)
+	}
 	if len(ms.Opts.Flags.Args()) >= 2 {
 		outputPath = ms.Opts.Flags.Arg(1)
 	} else {
 		if inputPath == "-" {
 			outputPath = "-"
+		} else if outputFormat != "" {
+			outputPath = renameExt(inputPath, string(outputFormat))
 		} else {
 			outputPath = renameExt(inputPath, ".svg")
 		}
@@ -214,10 +395,10 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 			inputPath = filepath.Join(inputPath, "index.d2")
 		}
 	}
-	if filepath.Ext(outputPath) == ".ppt" {
+	if filepath.Ext(outputPath) == ".ppt" && outputFormat == "" {
 		return xmain.UsageErrorf("D2 does not support ppt exports, did you mean \"pptx\"?")
 	}
-	outputFormat := getExportExtension(outputPath)
+	outputFormat = getOutputFormat(ms, outputPath)
 	if outputPath != "-" {
 		outputPath = ms.AbsPath(outputPath)
 		if *animateIntervalFlag > 0 && !outputFormat.supportsAnimation() {
@@ -226,6 +407,106 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 			return xmain.UsageErrorf("-animate-interval must be greater than 0 for %s outputs.\nYou provided: %d", outputFormat, *animateIntervalFlag)
 		}
 	}
+	if *animateTransitionFlag != 0 {
+		if *animateTransitionFlag < 0 || *animateTransitionFlag >= *animateIntervalFlag {
+			return xmain.UsageErrorf("--animate-transition must be greater than 0 and less than --animate-interval.\nYou provided: %d", *animateTransitionFlag)
+		}
+		if outputFormat != SVG {
+			return xmain.UsageErrorf("--animate-transition can only be used when exporting to SVG.\nYou provided: %s", outputFormat)
+		}
+		ms.Env.Setenv("D2_ANIMATE_TRANSITION", strconv.FormatInt(*animateTransitionFlag, 10))
+	}
+	if *cropFlag != "" {
+		if !outputFormat.isRasterImage() {
+			return xmain.UsageErrorf("--crop can only be used when exporting to PNG, JPEG, or WebP.\nYou provided: %s", outputFormat)
+		}
+		ms.Env.Setenv("D2_CROP", *cropFlag)
+	}
+	if *imageMapFlag != "" {
+		if *imageMapFlag != "html" && *imageMapFlag != "json" {
+			return xmain.UsageErrorf("--image-map must be html or json, got %q", *imageMapFlag)
+		}
+		if !outputFormat.isRasterImage() {
+			return xmain.UsageErrorf("--image-map can only be used when exporting to PNG, JPEG, or WebP.\nYou provided: %s", outputFormat)
+		}
+		if *cropFlag != "" {
+			return xmain.UsageErrorf("--image-map cannot be combined with --crop")
+		}
+		if outputPath == "-" {
+			return xmain.UsageErrorf("--image-map cannot be used when the output is written to stdout")
+		}
+		ms.Env.Setenv("D2_IMAGE_MAP", *imageMapFlag)
+	}
+	if *depthFlag < 0 {
+		return xmain.UsageErrorf("--depth must be 0 or more, got %d", *depthFlag)
+	}
+	if *radiusFlag < 0 {
+		return xmain.UsageErrorf("--radius must be 0 or more, got %d", *radiusFlag)
+	}
+	ms.Env.Setenv("D2_COLLAPSE", *collapseFlag)
+	ms.Env.Setenv("D2_DEPTH", strconv.FormatInt(*depthFlag, 10))
+	ms.Env.Setenv("D2_FOCUS", *focusFlag)
+	ms.Env.Setenv("D2_RADIUS", strconv.FormatInt(*radiusFlag, 10))
+	ms.Env.Setenv("D2_COMPACT", strconv.FormatBool(*compactFlag))
+	ms.Env.Setenv("D2_HIGHLIGHT_STEPS", strconv.FormatBool(*highlightStepsFlag))
+	if *targetRatioFlag != "" {
+		if _, err := d2ratio.ParseRatio(*targetRatioFlag); err != nil {
+			return xmain.UsageErrorf("--target-ratio: %v", err)
+		}
+		ms.Env.Setenv("D2_TARGET_RATIO", *targetRatioFlag)
+	}
+	if *stylesheetFlag != "" {
+		ms.Env.Setenv("D2_STYLESHEET", ms.AbsPath(*stylesheetFlag))
+	}
+	if *iconDirFlag != "" {
+		ms.Env.Setenv("D2_ICON_DIR", ms.AbsPath(*iconDirFlag))
+	}
+	if *mediumFlag != "" {
+		if _, err := d2graph.FindMedium(*mediumFlag); err != nil {
+			return xmain.UsageErrorf("--medium: %v", err)
+		}
+		ms.Env.Setenv("D2_MEDIUM", *mediumFlag)
+	}
+	if *iconAttributionFlag != "" {
+		if *iconAttributionFlag == "-" && outputPath == "-" {
+			return xmain.UsageErrorf("--icon-attribution cannot be written to stdout when the output is also written to stdout")
+		}
+		if *iconAttributionFlag != "-" {
+			*iconAttributionFlag = ms.AbsPath(*iconAttributionFlag)
+		}
+		ms.Env.Setenv("D2_ICON_ATTRIBUTION", *iconAttributionFlag)
+	}
+	if *iconAttributionFooterFlag {
+		if outputFormat != SVG && !outputFormat.isRasterImage() {
+			return xmain.UsageErrorf("--icon-attribution-footer can only be used when exporting to SVG, PNG, JPEG, or WebP.\nYou provided: %s", outputFormat)
+		}
+		ms.Env.Setenv("D2_ICON_ATTRIBUTION_FOOTER", "1")
+	} else {
+		ms.Env.Setenv("D2_ICON_ATTRIBUTION_FOOTER", "0")
+	}
+	if *reportFlag != "" {
+		if *watchFlag {
+			return xmain.UsageErrorf("--report cannot be used with --watch")
+		}
+		if *reportFlag == "-" && outputPath == "-" {
+			return xmain.UsageErrorf("--report cannot be written to stdout when the output is also written to stdout")
+		}
+		if *reportFlag != "-" {
+			*reportFlag = ms.AbsPath(*reportFlag)
+		}
+	}
+
+	ms.Env.Setenv("D2_DENY_WARNINGS", strconv.FormatBool(*denyWarningsFlag))
+	ms.Env.Setenv("D2_DIAGNOSTICS", *diagnosticsFlag)
+	switch *diagnosticsFlag {
+	case "text":
+	case "json":
+		if *watchFlag {
+			return xmain.UsageErrorf("--diagnostics=json cannot be used with --watch")
+		}
+	default:
+		return xmain.UsageErrorf("--diagnostics must be text or json, got %q", *diagnosticsFlag)
+	}
 
 	match := d2themescatalog.Find(*themeFlag)
 	if match == (d2themes.Theme{}) {
@@ -264,6 +545,22 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 			centerFlag = nil
 		}
 	}
+	if ms.Env.Getenv("D2_EDGE_JUMPS") == "" {
+		if _, ok := flagSet["edge-jumps"]; !ok {
+			edgeJumpsFlag = nil
+		}
+	}
+	if ms.Env.Getenv("D2_SNAP") == "" {
+		if _, ok := flagSet["snap"]; !ok {
+			snapFlag = nil
+		}
+	}
+	if snapFlag != nil {
+		if *snapFlag < 0 {
+			return xmain.UsageErrorf("--snap must be 0 or more, got %d", *snapFlag)
+		}
+		ms.Env.Setenv("D2_SNAP", strconv.FormatInt(*snapFlag, 10))
+	}
 
 	if *darkThemeFlag == -1 {
 		darkThemeFlag = nil // TODO this is a temporary solution: https://github.com/terrastruct/util-go/issues/7
@@ -279,6 +576,22 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 	if scaleFlag != nil && *scaleFlag > 0. {
 		scale = scaleFlag
 	}
+	var quantize *float64
+	if quantizeFlag != nil && *quantizeFlag != 0 {
+		err = d2svg.ValidateQuantize(*quantizeFlag)
+		if err != nil {
+			return xmain.UsageErrorf("--%s", err)
+		}
+		quantize = quantizeFlag
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+	}{{"code-theme", *codeThemeFlag}, {"dark-code-theme", *darkCodeThemeFlag}} {
+		if err := d2svg.ValidateCodeTheme(f.value); err != nil {
+			return xmain.UsageErrorf("--%s: %v", f.name, err)
+		}
+	}
 
 	if !outputFormat.supportsDarkTheme() {
 		if darkThemeFlag != nil {
@@ -286,27 +599,46 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 			darkThemeFlag = nil
 		}
 	}
+	switch *pdfRendererFlag {
+	case pdfRendererBrowser, pdfRendererAuto:
+	default:
+		return xmain.UsageErrorf("--pdf-renderer must be %s or %s, got %q", pdfRendererBrowser, pdfRendererAuto, *pdfRendererFlag)
+	}
+
 	var pw png.Playwright
-	if outputFormat.requiresPNGRenderer() {
+	// With --pdf-renderer=auto, the browser is only started once a board needs it
+	lazyBrowser := outputFormat == PDF && *pdfRendererFlag == pdfRendererAuto && !*watchFlag
+	if outputFormat.requiresPNGRenderer() && !lazyBrowser {
 		pw, err = png.InitPlaywright()
 		if err != nil {
 			return err
 		}
-		defer func() {
-			cleanupErr := pw.Cleanup()
-			if err == nil {
-				err = cleanupErr
-			}
-		}()
 	}
+	defer func() {
+		if pw.PW == nil {
+			return
+		}
+		cleanupErr := pw.Cleanup()
+		if err == nil {
+			err = cleanupErr
+		}
+	}()
 
 	renderOpts := d2svg.RenderOpts{
-		Pad:         padFlag,
-		Sketch:      sketchFlag,
-		Center:      centerFlag,
-		ThemeID:     themeFlag,
-		DarkThemeID: darkThemeFlag,
-		Scale:       scale,
+		Pad:           padFlag,
+		Sketch:        sketchFlag,
+		Center:        centerFlag,
+		EdgeJumps:     edgeJumpsFlag,
+		CodeTheme:     *codeThemeFlag,
+		DarkCodeTheme: *darkCodeThemeFlag,
+		ThemeID:       themeFlag,
+		DarkThemeID:   darkThemeFlag,
+		Scale:         scale,
+		Quantize:      quantize,
+		SourceMap:     *sourceMapFlag,
+	}
+	if *hideLayerGroupsFlag != "" {
+		renderOpts.HiddenLayerGroups = strings.Split(*hideLayerGroupsFlag, ",")
 	}
 
 	if *watchFlag {
@@ -316,6 +648,9 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 		if *targetFlag != "*" {
 			return xmain.UsageErrorf("-w[atch] cannot be combined with --target")
 		}
+		if *boardFlag != "" {
+			return xmain.UsageErrorf("-w[atch] cannot be combined with --board")
+		}
 		w, err := newWatcher(ctx, ms, watcherOpts{
 			plugins:         plugins,
 			layout:          layoutFlag,
@@ -327,6 +662,7 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 			outputPath:      outputPath,
 			bundle:          *bundleFlag,
 			forceAppendix:   *forceAppendixFlag,
+			pdfRenderer:     *pdfRendererFlag,
 			pw:              pw,
 			fontFamily:      fontFamily,
 		})
@@ -355,11 +691,39 @@ func Run(ctx context.Context, ms *xmain.State) (err error) {
 		}
 		boardPath = key.IDA()
 	}
+	var boards []string
+	if *boardFlag != "" {
+		if *targetFlag != "*" {
+			return xmain.UsageErrorf("--board cannot be combined with --target")
+		}
+		for _, b := range strings.Split(*boardFlag, ",") {
+			boards = append(boards, strings.TrimSpace(b))
+		}
+	}
 
 	ctx, cancel := timelib.WithTimeout(ctx, time.Minute*2)
 	defer cancel()
 
-	_, written, err := compile(ctx, ms, plugins, nil, layoutFlag, renderOpts, fontFamily, *animateIntervalFlag, inputPath, outputPath, boardPath, noChildren, *bundleFlag, *forceAppendixFlag, pw.Page)
+	var r *reporter
+	if *reportFlag != "" {
+		var stop func()
+		r, stop = newReporter(ms)
+		defer stop()
+	}
+
+	_, written, err := compile(ctx, ms, plugins, nil, layoutFlag, renderOpts, fontFamily, *animateIntervalFlag, inputPath, outputPath, boardPath, boards, noChildren, *bundleFlag, *forceAppendixFlag, *pdfRendererFlag, &pw, nil, false, r)
+	if r != nil {
+		reportErr := r.write(ms, *reportFlag, inputPath, outputPath, err)
+		if reportErr != nil {
+			ms.Log.Error.Printf("failed to write report: %v", reportErr)
+		}
+	}
+	if err != nil && *diagnosticsFlag == "json" {
+		if diagErr := writeDiagnostics(ms, err); diagErr != nil {
+			return diagErr
+		}
+		return xmain.ExitError{Code: 1}
+	}
 	if err != nil {
 		if written {
 			return fmt.Errorf("failed to fully compile (partial render written) %s: %w", ms.HumanPath(inputPath), err)
@@ -434,7 +798,10 @@ func RouterResolver(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plu
 	}
 }
 
-func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs fs.FS, layout *string, renderOpts d2svg.RenderOpts, fontFamily *d2fonts.FontFamily, animateInterval int64, inputPath, outputPath string, boardPath []string, noChildren, bundle, forceAppendix bool, page playwright.Page) (_ []byte, written bool, _ error) {
+// errBoardNotFound is the error of compiling a board path that isn't a board of the diagram
+var errBoardNotFound = errors.New("not found")
+
+func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs fs.FS, layout *string, renderOpts d2svg.RenderOpts, fontFamily *d2fonts.FontFamily, animateInterval int64, inputPath, outputPath string, boardPath, boards []string, noChildren, bundle, forceAppendix bool, pdfRenderer string, pw *png.Playwright, layoutCache *d2lib.LayoutCache, partial bool, r *reporter) (_ []byte, written bool, _ error) {
 	start := time.Now()
 	input, err := ms.ReadPath(inputPath)
 	if err != nil {
@@ -454,6 +821,45 @@ func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs
 		Layout:         layout,
 		RouterResolver: RouterResolver(ctx, ms, plugins),
 		FS:             fs,
+		Boards:         boards,
+		Focus:          ms.Env.Getenv("D2_FOCUS"),
+		LayoutCache:    layoutCache,
+		Partial:        partial,
+	}
+	opts.Compact, _ = strconv.ParseBool(ms.Env.Getenv("D2_COMPACT"))
+	opts.HighlightSteps, _ = strconv.ParseBool(ms.Env.Getenv("D2_HIGHLIGHT_STEPS"))
+	// --target-ratio is validated by Run
+	if ratio := ms.Env.Getenv("D2_TARGET_RATIO"); ratio != "" {
+		opts.TargetRatio, _ = d2ratio.ParseRatio(ratio)
+	}
+	if medium := ms.Env.Getenv("D2_MEDIUM"); medium != "" {
+		opts.Medium = &medium
+	}
+	opts.IconDir = ms.Env.Getenv("D2_ICON_DIR")
+	fetcher, err := importFetcher(ms, inputPath)
+	if err != nil {
+		return nil, false, err
+	}
+	opts.FetchImport = fetcher.Fetch
+	opts.Defines = defines(ms)
+	if stylesheet := ms.Env.Getenv("D2_STYLESHEET"); stylesheet != "" {
+		opts.Stylesheet, err = parseStylesheet(fs, stylesheet)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	// --collapse, --depth, --focus, and --radius are validated by Run
+	for _, id := range strings.Split(ms.Env.Getenv("D2_COLLAPSE"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			opts.Collapse = append(opts.Collapse, id)
+		}
+	}
+	opts.Depth, _ = strconv.Atoi(ms.Env.Getenv("D2_DEPTH"))
+	opts.FocusRadius, _ = strconv.Atoi(ms.Env.Getenv("D2_RADIUS"))
+	// --snap is validated by Run, and only set when given, so vars.d2-config.snap applies otherwise
+	if snap := ms.Env.Getenv("D2_SNAP"); snap != "" {
+		v, _ := strconv.ParseInt(snap, 10, 64)
+		opts.Snap = &v
 	}
 
 	if os.Getenv("D2_LSP_MODE") == "1" {
@@ -482,19 +888,34 @@ func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs
 
 	diagram, g, err := d2lib.Compile(ctx, string(input), opts, &renderOpts)
 	if err != nil {
+		if diagram != nil {
+			// What did parse is previewed, but not written over the last output
+			return renderPartial(diagram, boardPath, renderOpts), false, err
+		}
 		return nil, false, err
 	}
 	cancel()
+	err = writeWarnings(ms, g)
+	if err != nil {
+		return nil, false, err
+	}
+	err = writeLockfile(ms, inputPath, fetcher)
+	if err != nil {
+		return nil, false, err
+	}
 
 	diagram = diagram.GetBoard(boardPath)
 	if diagram == nil {
-		return nil, false, fmt.Errorf(`render target "%s" not found`, strings.Join(boardPath, "."))
+		return nil, false, fmt.Errorf(`render target "%s" %w`, strings.Join(boardPath, "."), errBoardNotFound)
 	}
 	if noChildren {
 		diagram.Layers = nil
 		diagram.Scenarios = nil
 		diagram.Steps = nil
 	}
+	if r != nil {
+		r.diagram = diagram
+	}
 
 	plugin, _ := d2plugin.FindPlugin(ctx, plugins, *opts.Layout)
 
@@ -526,10 +947,17 @@ func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs
 		return nil, false, err
 	}
 
-	ext := getExportExtension(outputPath)
+	if attributionPath := ms.Env.Getenv("D2_ICON_ATTRIBUTION"); attributionPath != "" {
+		err = writeIconAttribution(ms, attributionPath, diagram)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	ext := getOutputFormat(ms, outputPath)
 	switch ext {
 	case GIF:
-		svg, pngs, err := renderPNGsForGIF(ctx, ms, plugin, renderOpts, ruler, page, inputPath, diagram)
+		svg, pngs, err := renderPNGsForGIF(ctx, ms, plugin, renderOpts, ruler, pw, inputPath, diagram)
 		if err != nil {
 			return nil, false, err
 		}
@@ -553,13 +981,33 @@ func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs
 		path := []pdf.BoardTitle{
 			{Name: diagram.Root.Label, BoardID: "root"},
 		}
-		pdf, err := renderPDF(ctx, ms, plugin, renderOpts, inputPath, outputPath, page, ruler, diagram, nil, path, pageMap, diagram.Root.Label != "")
+		pdf, err := renderPDF(ctx, ms, plugin, renderOpts, inputPath, outputPath, pdfRenderer, pw, ruler, diagram, nil, path, pageMap, diagram.Root.Label != "")
 		if err != nil {
 			return pdf, false, err
 		}
 		dur := time.Since(start)
 		ms.Log.Success.Printf("successfully compiled %s to %s in %s", ms.HumanPath(inputPath), ms.HumanPath(outputPath), dur)
 		return pdf, true, nil
+	case JSON:
+		// One document describes all the boards
+		out, err := d2json.Render(diagram, &d2json.RenderOpts{
+			ThemeID:        renderOpts.ThemeID,
+			ThemeOverrides: renderOpts.ThemeOverrides,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		err = os.MkdirAll(filepath.Dir(outputPath), 0755)
+		if err != nil {
+			return nil, false, err
+		}
+		err = ms.WritePath(outputPath, out)
+		if err != nil {
+			return nil, false, err
+		}
+		dur := time.Since(start)
+		ms.Log.Success.Printf("successfully compiled %s to %s in %s", ms.HumanPath(inputPath), ms.HumanPath(outputPath), dur)
+		return out, true, nil
 	case PPTX:
 		var username string
 		if user, err := user.Current(); err == nil {
@@ -574,7 +1022,7 @@ func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs
 		path := []pptx.BoardTitle{
 			{Name: "root", BoardID: "root", LinkToSlide: boardIdToIndex["root"] + 1},
 		}
-		svg, err := renderPPTX(ctx, ms, p, plugin, renderOpts, ruler, inputPath, outputPath, page, diagram, path, boardIdToIndex)
+		svg, err := renderPPTX(ctx, ms, p, plugin, renderOpts, ruler, inputPath, outputPath, pw, diagram, path, boardIdToIndex)
 		if err != nil {
 			return nil, false, err
 		}
@@ -602,9 +1050,9 @@ func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs
 		var boards [][]byte
 		var err error
 		if noChildren {
-			boards, err = renderSingle(ctx, ms, compileDur, plugin, renderOpts, inputPath, outputPath, bundle, forceAppendix, page, ruler, diagram)
+			boards, err = renderSingle(ctx, ms, compileDur, plugin, renderOpts, inputPath, outputPath, bundle, forceAppendix, pw, ruler, diagram)
 		} else {
-			boards, err = render(ctx, ms, compileDur, plugin, renderOpts, inputPath, outputPath, bundle, forceAppendix, page, ruler, diagram)
+			boards, err = render(ctx, ms, compileDur, plugin, renderOpts, inputPath, outputPath, bundle, forceAppendix, len(opts.Boards) > 0, pw, ruler, diagram)
 		}
 		if err != nil {
 			return nil, false, err
@@ -613,7 +1061,8 @@ func compile(ctx context.Context, ms *xmain.State, plugins []d2plugin.Plugin, fs
 		if len(boards) > 0 {
 			out = boards[0]
 			if animateInterval > 0 {
-				out, err = d2animate.Wrap(diagram, boards, renderOpts, int(animateInterval))
+				transition, _ := strconv.Atoi(ms.Env.Getenv("D2_ANIMATE_TRANSITION"))
+				out, err = d2animate.WrapWithTransitions(diagram, boards, renderOpts, int(animateInterval), transition)
 				if err != nil {
 					return nil, false, err
 				}
@@ -739,7 +1188,7 @@ func relink(currDiagramPath string, d *d2target.Diagram, linkToOutput map[string
 	return nil
 }
 
-func render(ctx context.Context, ms *xmain.State, compileDur time.Duration, plugin d2plugin.Plugin, opts d2svg.RenderOpts, inputPath, outputPath string, bundle, forceAppendix bool, page playwright.Page, ruler *textmeasure.Ruler, diagram *d2target.Diagram) ([][]byte, error) {
+func render(ctx context.Context, ms *xmain.State, compileDur time.Duration, plugin d2plugin.Plugin, opts d2svg.RenderOpts, inputPath, outputPath string, bundle, forceAppendix, partial bool, pw *png.Playwright, ruler *textmeasure.Ruler, diagram *d2target.Diagram) ([][]byte, error) {
 	if diagram.Name != "" {
 		ext := filepath.Ext(outputPath)
 		outputPath = strings.TrimSuffix(outputPath, ext)
@@ -756,7 +1205,10 @@ func render(ctx context.Context, ms *xmain.State, compileDur time.Duration, plug
 		// Boards with subboards must be self-contained folders.
 		ext := filepath.Ext(boardOutputPath)
 		boardOutputPath = strings.TrimSuffix(boardOutputPath, ext)
-		os.RemoveAll(boardOutputPath)
+		if !partial {
+			// Partial exports with --board leave the other boards' files in place
+			os.RemoveAll(boardOutputPath)
+		}
 		boardOutputPath = filepath.Join(boardOutputPath, "index")
 		boardOutputPath += ext
 	}
@@ -785,21 +1237,21 @@ func render(ctx context.Context, ms *xmain.State, compileDur time.Duration, plug
 
 	var boards [][]byte
 	for _, dl := range diagram.Layers {
-		childrenBoards, err := render(ctx, ms, compileDur, plugin, opts, inputPath, layersOutputPath, bundle, forceAppendix, page, ruler, dl)
+		childrenBoards, err := render(ctx, ms, compileDur, plugin, opts, inputPath, layersOutputPath, bundle, forceAppendix, partial, pw, ruler, dl)
 		if err != nil {
 			return nil, err
 		}
 		boards = append(boards, childrenBoards...)
 	}
 	for _, dl := range diagram.Scenarios {
-		childrenBoards, err := render(ctx, ms, compileDur, plugin, opts, inputPath, scenariosOutputPath, bundle, forceAppendix, page, ruler, dl)
+		childrenBoards, err := render(ctx, ms, compileDur, plugin, opts, inputPath, scenariosOutputPath, bundle, forceAppendix, partial, pw, ruler, dl)
 		if err != nil {
 			return nil, err
 		}
 		boards = append(boards, childrenBoards...)
 	}
 	for _, dl := range diagram.Steps {
-		childrenBoards, err := render(ctx, ms, compileDur, plugin, opts, inputPath, stepsOutputPath, bundle, forceAppendix, page, ruler, dl)
+		childrenBoards, err := render(ctx, ms, compileDur, plugin, opts, inputPath, stepsOutputPath, bundle, forceAppendix, partial, pw, ruler, dl)
 		if err != nil {
 			return nil, err
 		}
@@ -808,7 +1260,7 @@ func render(ctx context.Context, ms *xmain.State, compileDur time.Duration, plug
 
 	if !diagram.IsFolderOnly {
 		start := time.Now()
-		out, err := _render(ctx, ms, plugin, opts, inputPath, boardOutputPath, bundle, forceAppendix, page, ruler, diagram)
+		out, err := _render(ctx, ms, plugin, opts, inputPath, boardOutputPath, bundle, forceAppendix, pw, ruler, diagram)
 		if err != nil {
 			return boards, err
 		}
@@ -822,9 +1274,9 @@ func render(ctx context.Context, ms *xmain.State, compileDur time.Duration, plug
 	return boards, nil
 }
 
-func renderSingle(ctx context.Context, ms *xmain.State, compileDur time.Duration, plugin d2plugin.Plugin, opts d2svg.RenderOpts, inputPath, outputPath string, bundle, forceAppendix bool, page playwright.Page, ruler *textmeasure.Ruler, diagram *d2target.Diagram) ([][]byte, error) {
+func renderSingle(ctx context.Context, ms *xmain.State, compileDur time.Duration, plugin d2plugin.Plugin, opts d2svg.RenderOpts, inputPath, outputPath string, bundle, forceAppendix bool, pw *png.Playwright, ruler *textmeasure.Ruler, diagram *d2target.Diagram) ([][]byte, error) {
 	start := time.Now()
-	out, err := _render(ctx, ms, plugin, opts, inputPath, outputPath, bundle, forceAppendix, page, ruler, diagram)
+	out, err := _render(ctx, ms, plugin, opts, inputPath, outputPath, bundle, forceAppendix, pw, ruler, diagram)
 	if err != nil {
 		return [][]byte{}, err
 	}
@@ -835,24 +1287,74 @@ func renderSingle(ctx context.Context, ms *xmain.State, compileDur time.Duration
 	return [][]byte{out}, nil
 }
 
-func _render(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opts d2svg.RenderOpts, inputPath, outputPath string, bundle, forceAppendix bool, page playwright.Page, ruler *textmeasure.Ruler, diagram *d2target.Diagram) ([]byte, error) {
-	toPNG := getExportExtension(outputPath) == PNG
+// appendAttribution adds a footer crediting the icon packs used by the board, if requested
+func appendAttribution(ms *xmain.State, ruler *textmeasure.Ruler, svg []byte, diagram *d2target.Diagram) []byte {
+	if ms.Env.Getenv("D2_ICON_ATTRIBUTION_FOOTER") != "1" {
+		return svg
+	}
+	return appendix.AppendAttribution(ruler, svg, attribution.CollectBoard(diagram).Lines())
+}
+
+func writeIconAttribution(ms *xmain.State, attributionPath string, diagram *d2target.Diagram) error {
+	out, err := attribution.Collect(diagram).JSON()
+	if err != nil {
+		return err
+	}
+	if attributionPath != "-" {
+		err = os.MkdirAll(filepath.Dir(attributionPath), 0755)
+		if err != nil {
+			return err
+		}
+	}
+	err = ms.WritePath(attributionPath, out)
+	if err != nil {
+		return fmt.Errorf("failed to write icon attribution: %w", err)
+	}
+	if attributionPath != "-" {
+		ms.Log.Info.Printf("wrote icon attribution to %s", ms.HumanPath(attributionPath))
+	}
+	return nil
+}
+
+// renderPartial renders the SVG of the board at boardPath of the diagram of input that
+// partially parsed, or nothing if it can't
+func renderPartial(diagram *d2target.Diagram, boardPath []string, renderOpts d2svg.RenderOpts) []byte {
+	diagram = diagram.GetBoard(boardPath)
+	if diagram == nil {
+		return nil
+	}
+	svg, err := d2svg.Render(diagram, &renderOpts)
+	if err != nil {
+		return nil
+	}
+	return svg
+}
+
+func _render(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opts d2svg.RenderOpts, inputPath, outputPath string, bundle, forceAppendix bool, pw *png.Playwright, ruler *textmeasure.Ruler, diagram *d2target.Diagram) ([]byte, error) {
+	ext := getOutputFormat(ms, outputPath)
+	toRaster := ext.isRasterImage()
 	var scale *float64
 	if opts.Scale != nil {
 		scale = opts.Scale
-	} else if toPNG {
+	} else if toRaster {
 		scale = go2.Pointer(1.)
 	}
 	svg, err := d2svg.Render(diagram, &d2svg.RenderOpts{
 		Pad:                opts.Pad,
 		Sketch:             opts.Sketch,
 		Center:             opts.Center,
+		EdgeJumps:          opts.EdgeJumps,
+		HiddenLayerGroups:  opts.HiddenLayerGroups,
+		SourceMap:          opts.SourceMap,
+		CodeTheme:          opts.CodeTheme,
+		DarkCodeTheme:      opts.DarkCodeTheme,
 		ThemeID:            opts.ThemeID,
 		DarkThemeID:        opts.DarkThemeID,
 		MasterID:           opts.MasterID,
 		ThemeOverrides:     opts.ThemeOverrides,
 		DarkThemeOverrides: opts.DarkThemeOverrides,
 		Scale:              scale,
+		Quantize:           opts.Quantize,
 	})
 	if err != nil {
 		return nil, err
@@ -868,28 +1370,79 @@ func _render(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opts
 	svg, bundleErr := imgbundler.BundleLocal(ctx, l, inputPath, svg, cacheImages)
 	if bundle {
 		var bundleErr2 error
-		svg, bundleErr2 = imgbundler.BundleRemote(ctx, l, svg, cacheImages)
+		svg, bundleErr2 = bundleRemote(ctx, ms, l, svg, cacheImages)
 		bundleErr = multierr.Combine(bundleErr, bundleErr2)
 	}
-	if forceAppendix && !toPNG {
+	if forceAppendix && !toRaster {
 		svg = appendix.Append(diagram, ruler, svg)
 	}
+	if !toRaster {
+		svg = appendAttribution(ms, ruler, svg, diagram)
+	}
 
 	out := svg
-	if toPNG {
+	if toRaster {
 		svg := appendix.Append(diagram, ruler, svg)
+		svg = appendAttribution(ms, ruler, svg, diagram)
 
 		if !bundle {
 			var bundleErr2 error
-			svg, bundleErr2 = imgbundler.BundleRemote(ctx, l, svg, cacheImages)
+			svg, bundleErr2 = bundleRemote(ctx, ms, l, svg, cacheImages)
 			bundleErr = multierr.Combine(bundleErr, bundleErr2)
 		}
 
-		out, err = ConvertSVG(ms, page, svg)
+		if crop := ms.Env.Getenv("D2_CROP"); crop != "" {
+			out, err = ScreenshotObject(ctx, ms, pw, svg, crop)
+		} else {
+			out, err = ConvertSVG(ctx, ms, pw, svg)
+		}
+		if err != nil {
+			return svg, err
+		}
+		if format := ms.Env.Getenv("D2_IMAGE_MAP"); format != "" && opts.MasterID == "" {
+			err = writeImageMap(ms, diagram, svg, out, outputPath, format)
+			if err != nil {
+				return svg, err
+			}
+		}
+		out, err = encodeRaster(ctx, ms, pw, ext, out)
+		if err != nil {
+			return svg, err
+		}
+	} else if ext == EXCALIDRAW {
+		out, err = d2excalidraw.Render(diagram, &d2excalidraw.RenderOpts{
+			ThemeID:        opts.ThemeID,
+			ThemeOverrides: opts.ThemeOverrides,
+			Sketch:         opts.Sketch,
+		})
 		if err != nil {
 			return svg, err
 		}
-		out, err = png.AddExif(out)
+	} else if ext == STRUCTURIZR {
+		out, err = d2structurizr.RenderDSL(diagram, &d2structurizr.RenderOpts{
+			Name: getFileName(inputPath),
+		})
+		if err != nil {
+			return svg, err
+		}
+	} else if ext == GRAPHML {
+		out, err = d2graphml.RenderGraphML(diagram, &d2graphml.RenderOpts{
+			ThemeID:        opts.ThemeID,
+			ThemeOverrides: opts.ThemeOverrides,
+		})
+		if err != nil {
+			return svg, err
+		}
+	} else if ext == GEXF {
+		out, err = d2graphml.RenderGEXF(diagram, &d2graphml.RenderOpts{
+			ThemeID:        opts.ThemeID,
+			ThemeOverrides: opts.ThemeOverrides,
+		})
+		if err != nil {
+			return svg, err
+		}
+	} else if ext == TXT {
+		out, err = d2ascii.Render(diagram)
 		if err != nil {
 			return svg, err
 		}
@@ -915,14 +1468,111 @@ func _render(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opts
 	return svg, nil
 }
 
-func renderPDF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opts d2svg.RenderOpts, inputPath, outputPath string, page playwright.Page, ruler *textmeasure.Ruler, diagram *d2target.Diagram, doc *pdf.GoFPDF, boardPath []pdf.BoardTitle, pageMap map[string]int, includeNav bool) (svg []byte, err error) {
+// writeImageMap writes the clickable regions of a raster export next to it, see --image-map.
+// pngImg is the image before it's encoded into the format of the export.
+func writeImageMap(ms *xmain.State, diagram *d2target.Diagram, svg, pngImg []byte, outputPath, format string) error {
+	cfg, err := stdpng.DecodeConfig(bytes.NewReader(pngImg))
+	if err != nil {
+		return err
+	}
+	viewboxSlice := appendix.FindViewboxSlice(svg)
+	viewboxX, err := strconv.ParseFloat(viewboxSlice[0], 64)
+	if err != nil {
+		return err
+	}
+	viewboxY, err := strconv.ParseFloat(viewboxSlice[1], 64)
+	if err != nil {
+		return err
+	}
+	viewboxWidth, err := strconv.ParseFloat(viewboxSlice[2], 64)
+	if err != nil {
+		return err
+	}
+	regions := imagemap.Regions(diagram, viewboxX, viewboxY, float64(cfg.Width)/viewboxWidth)
+
+	var out []byte
+	if format == "json" {
+		out, err = imagemap.JSON(regions)
+		if err != nil {
+			return err
+		}
+	} else {
+		out = imagemap.Page(diagram, regions, filepath.Base(outputPath), cfg.Width, cfg.Height)
+	}
+	mapPath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".map." + format
+	err = os.MkdirAll(filepath.Dir(mapPath), 0755)
+	if err != nil {
+		return err
+	}
+	return ms.WritePath(mapPath, out)
+}
+
+// hasLayerGroup returns whether a shape or connection of diagram is in one of groups
+func hasLayerGroup(diagram *d2target.Diagram, groups []string) bool {
+	for _, s := range diagram.Shapes {
+		if s.LayerGroup != "" && go2.Contains(groups, s.LayerGroup) {
+			return true
+		}
+	}
+	for _, c := range diagram.Connections {
+		if c.LayerGroup != "" && go2.Contains(groups, c.LayerGroup) {
+			return true
+		}
+	}
+	return false
+}
+
+// PDF renderers, see --pdf-renderer
+const (
+	pdfRendererBrowser = "browser"
+	pdfRendererAuto    = "auto"
+)
+
+func renderPDF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opts d2svg.RenderOpts, inputPath, outputPath, pdfRenderer string, pw *png.Playwright, ruler *textmeasure.Ruler, diagram *d2target.Diagram, doc *pdf.GoFPDF, boardPath []pdf.BoardTitle, pageMap map[string]int, includeNav bool) (svg []byte, err error) {
 	var isRoot bool
 	if doc == nil {
 		doc = pdf.Init()
 		isRoot = true
 	}
 
-	if !diagram.IsFolderOnly {
+	drawn := false
+	if !diagram.IsFolderOnly && pdfRenderer == pdfRendererAuto {
+		unsupported := pdf.VectorUnsupported(diagram, *opts.ThemeID, *opts.Sketch)
+		if unsupported == nil && hasLayerGroup(diagram, opts.HiddenLayerGroups) {
+			// Only the SVG renderer hides layer groups
+			unsupported = errors.New("hidden layer groups")
+		}
+		if unsupported == nil {
+			err = doc.AddVectorPage(diagram, boardPath, *opts.ThemeID, *opts.Pad, pageMap, includeNav)
+			if err != nil {
+				return nil, err
+			}
+			// Still rendered for watch mode's preview
+			svg, err = d2svg.Render(diagram, &d2svg.RenderOpts{
+				Pad:               opts.Pad,
+				Sketch:            opts.Sketch,
+				Center:            opts.Center,
+				EdgeJumps:         opts.EdgeJumps,
+				HiddenLayerGroups: opts.HiddenLayerGroups,
+				CodeTheme:         opts.CodeTheme,
+				ThemeID:           opts.ThemeID,
+			})
+			if err != nil {
+				return nil, err
+			}
+			drawn = true
+		} else {
+			ms.Log.Info.Printf("rendering board %s in a browser, as it uses %s", boardPath[len(boardPath)-1].BoardID, unsupported)
+		}
+	}
+	if !diagram.IsFolderOnly && !drawn {
+		if pw.Browser == nil {
+			*pw, err = png.InitPlaywright()
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		rootFill := diagram.Root.Fill
 		// gofpdf will print the png img with a slight filter
 		// make the bg fill within the png transparent so that the pdf bg fill is the only bg color present
@@ -936,11 +1586,14 @@ func renderPDF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opt
 		}
 
 		svg, err = d2svg.Render(diagram, &d2svg.RenderOpts{
-			Pad:     opts.Pad,
-			Sketch:  opts.Sketch,
-			Center:  opts.Center,
-			Scale:   scale,
-			ThemeID: opts.ThemeID,
+			Pad:               opts.Pad,
+			Sketch:            opts.Sketch,
+			Center:            opts.Center,
+			EdgeJumps:         opts.EdgeJumps,
+			HiddenLayerGroups: opts.HiddenLayerGroups,
+			CodeTheme:         opts.CodeTheme,
+			Scale:             scale,
+			ThemeID:           opts.ThemeID,
 		})
 		if err != nil {
 			return nil, err
@@ -954,14 +1607,14 @@ func renderPDF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opt
 		cacheImages := ms.Env.Getenv("IMG_CACHE") == "1"
 		l := simplelog.FromCmdLog(ms.Log)
 		svg, bundleErr := imgbundler.BundleLocal(ctx, l, inputPath, svg, cacheImages)
-		svg, bundleErr2 := imgbundler.BundleRemote(ctx, l, svg, cacheImages)
+		svg, bundleErr2 := bundleRemote(ctx, ms, l, svg, cacheImages)
 		bundleErr = multierr.Combine(bundleErr, bundleErr2)
 		if bundleErr != nil {
 			return svg, bundleErr
 		}
 		svg = appendix.Append(diagram, ruler, svg)
 
-		pngImg, err := ConvertSVG(ms, page, svg)
+		pngImg, err := ConvertSVG(ctx, ms, pw, svg)
 		if err != nil {
 			return svg, err
 		}
@@ -986,7 +1639,7 @@ func renderPDF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opt
 			Name:    dl.Root.Label,
 			BoardID: strings.Join([]string{boardPath[len(boardPath)-1].BoardID, LAYERS, dl.Name}, "."),
 		})
-		_, err := renderPDF(ctx, ms, plugin, opts, inputPath, "", page, ruler, dl, doc, path, pageMap, includeNav)
+		_, err := renderPDF(ctx, ms, plugin, opts, inputPath, "", pdfRenderer, pw, ruler, dl, doc, path, pageMap, includeNav)
 		if err != nil {
 			return nil, err
 		}
@@ -996,7 +1649,7 @@ func renderPDF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opt
 			Name:    dl.Root.Label,
 			BoardID: strings.Join([]string{boardPath[len(boardPath)-1].BoardID, SCENARIOS, dl.Name}, "."),
 		})
-		_, err := renderPDF(ctx, ms, plugin, opts, inputPath, "", page, ruler, dl, doc, path, pageMap, includeNav)
+		_, err := renderPDF(ctx, ms, plugin, opts, inputPath, "", pdfRenderer, pw, ruler, dl, doc, path, pageMap, includeNav)
 		if err != nil {
 			return nil, err
 		}
@@ -1006,7 +1659,7 @@ func renderPDF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opt
 			Name:    dl.Root.Label,
 			BoardID: strings.Join([]string{boardPath[len(boardPath)-1].BoardID, STEPS, dl.Name}, "."),
 		})
-		_, err := renderPDF(ctx, ms, plugin, opts, inputPath, "", page, ruler, dl, doc, path, pageMap, includeNav)
+		_, err := renderPDF(ctx, ms, plugin, opts, inputPath, "", pdfRenderer, pw, ruler, dl, doc, path, pageMap, includeNav)
 		if err != nil {
 			return nil, err
 		}
@@ -1022,7 +1675,7 @@ func renderPDF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opt
 	return svg, nil
 }
 
-func renderPPTX(ctx context.Context, ms *xmain.State, presentation *pptx.Presentation, plugin d2plugin.Plugin, opts d2svg.RenderOpts, ruler *textmeasure.Ruler, inputPath, outputPath string, page playwright.Page, diagram *d2target.Diagram, boardPath []pptx.BoardTitle, boardIDToIndex map[string]int) ([]byte, error) {
+func renderPPTX(ctx context.Context, ms *xmain.State, presentation *pptx.Presentation, plugin d2plugin.Plugin, opts d2svg.RenderOpts, ruler *textmeasure.Ruler, inputPath, outputPath string, pw *png.Playwright, diagram *d2target.Diagram, boardPath []pptx.BoardTitle, boardIDToIndex map[string]int) ([]byte, error) {
 	var svg []byte
 	if !diagram.IsFolderOnly {
 		// gofpdf will print the png img with a slight filter
@@ -1039,10 +1692,13 @@ func renderPPTX(ctx context.Context, ms *xmain.State, presentation *pptx.Present
 		var err error
 
 		svg, err = d2svg.Render(diagram, &d2svg.RenderOpts{
-			Pad:    opts.Pad,
-			Sketch: opts.Sketch,
-			Center: opts.Center,
-			Scale:  scale,
+			Pad:               opts.Pad,
+			Sketch:            opts.Sketch,
+			Center:            opts.Center,
+			EdgeJumps:         opts.EdgeJumps,
+			HiddenLayerGroups: opts.HiddenLayerGroups,
+			CodeTheme:         opts.CodeTheme,
+			Scale:             scale,
 		})
 		if err != nil {
 			return nil, err
@@ -1056,7 +1712,7 @@ func renderPPTX(ctx context.Context, ms *xmain.State, presentation *pptx.Present
 		cacheImages := ms.Env.Getenv("IMG_CACHE") == "1"
 		l := simplelog.FromCmdLog(ms.Log)
 		svg, bundleErr := imgbundler.BundleLocal(ctx, l, inputPath, svg, cacheImages)
-		svg, bundleErr2 := imgbundler.BundleRemote(ctx, l, svg, cacheImages)
+		svg, bundleErr2 := bundleRemote(ctx, ms, l, svg, cacheImages)
 		bundleErr = multierr.Combine(bundleErr, bundleErr2)
 		if bundleErr != nil {
 			return nil, bundleErr
@@ -1064,7 +1720,7 @@ func renderPPTX(ctx context.Context, ms *xmain.State, presentation *pptx.Present
 
 		svg = appendix.Append(diagram, ruler, svg)
 
-		pngImg, err := ConvertSVG(ms, page, svg)
+		pngImg, err := ConvertSVG(ctx, ms, pw, svg)
 		if err != nil {
 			return nil, err
 		}
@@ -1120,7 +1776,7 @@ func renderPPTX(ctx context.Context, ms *xmain.State, presentation *pptx.Present
 			BoardID:     boardID,
 			LinkToSlide: boardIDToIndex[boardID] + 1,
 		})
-		_, err := renderPPTX(ctx, ms, presentation, plugin, opts, ruler, inputPath, "", page, dl, path, boardIDToIndex)
+		_, err := renderPPTX(ctx, ms, presentation, plugin, opts, ruler, inputPath, "", pw, dl, path, boardIDToIndex)
 		if err != nil {
 			return nil, err
 		}
@@ -1132,7 +1788,7 @@ func renderPPTX(ctx context.Context, ms *xmain.State, presentation *pptx.Present
 			BoardID:     boardID,
 			LinkToSlide: boardIDToIndex[boardID] + 1,
 		})
-		_, err := renderPPTX(ctx, ms, presentation, plugin, opts, ruler, inputPath, "", page, dl, path, boardIDToIndex)
+		_, err := renderPPTX(ctx, ms, presentation, plugin, opts, ruler, inputPath, "", pw, dl, path, boardIDToIndex)
 		if err != nil {
 			return nil, err
 		}
@@ -1144,7 +1800,7 @@ func renderPPTX(ctx context.Context, ms *xmain.State, presentation *pptx.Present
 			BoardID:     boardID,
 			LinkToSlide: boardIDToIndex[boardID] + 1,
 		})
-		_, err := renderPPTX(ctx, ms, presentation, plugin, opts, ruler, inputPath, "", page, dl, path, boardIDToIndex)
+		_, err := renderPPTX(ctx, ms, presentation, plugin, opts, ruler, inputPath, "", pw, dl, path, boardIDToIndex)
 		if err != nil {
 			return nil, err
 		}
@@ -1173,6 +1829,15 @@ func DiscardSlog(ctx context.Context) context.Context {
 	return ctxlog.With(ctx, slog.Make(sloghuman.Sink(io.Discard)))
 }
 
+// normalizeFlagName maps the aliases of flags to their names
+func normalizeFlagName(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	switch name {
+	case "theme-dark":
+		return "dark-theme"
+	}
+	return pflag.NormalizedName(name)
+}
+
 func populateLayoutOpts(ctx context.Context, ms *xmain.State, ps []d2plugin.Plugin) error {
 	pluginFlags, err := d2plugin.ListPluginFlags(ctx, ps)
 	if err != nil {
@@ -1196,14 +1861,26 @@ func initPlaywright() error {
 	return pw.Cleanup()
 }
 
+// loadFont reads the .ttf or .woff font at path, returning it as TrueType
 func loadFont(ms *xmain.State, path string) ([]byte, error) {
-	if filepath.Ext(path) != ".ttf" {
-		return nil, fmt.Errorf("expected .ttf file but %s has extension %s", path, filepath.Ext(path))
+	ext := filepath.Ext(path)
+	if ext != ".ttf" && ext != ".woff" {
+		return nil, fmt.Errorf("expected .ttf or .woff file but %s has extension %s", path, ext)
 	}
 	ttf, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read font at %s: %v", path, err)
 	}
+	if ext == ".woff" {
+		ttf, err = fontlib.Woff2Sfnt(ttf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font at %s: %v", path, err)
+		}
+	}
+	// Labels are measured with the font, which needs TrueType outlines
+	if _, err := truetype.Parse(ttf); err != nil {
+		return nil, fmt.Errorf("failed to read font at %s: %v", path, err)
+	}
 	ms.Log.Info.Printf("font %s loaded", filepath.Base(path))
 	return ttf, nil
 }
@@ -1247,6 +1924,77 @@ func loadFonts(ms *xmain.State, pathToRegular, pathToItalic, pathToBold, pathToS
 	return d2fonts.AddFontFamily("custom", regularTTF, italicTTF, boldTTF, semiboldTTF)
 }
 
+// parseStylesheet parses the stylesheet at path, opening it with fsys if given so it's watched
+// like imports
+func parseStylesheet(fsys fs.FS, path string) (*d2ast.Map, error) {
+	var f io.ReadCloser
+	var err error
+	if fsys == nil {
+		f, err = os.Open(path)
+	} else {
+		f, err = fsys.Open(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stylesheet: %w", err)
+	}
+	defer f.Close()
+	return d2parser.Parse(path, f, nil)
+}
+
+// defines returns the vars --define sets, which Run validates
+func defines(ms *xmain.State) map[string]string {
+	d, _ := parseDefines(ms.Env.Getenv("D2_DEFINE"))
+	return d
+}
+
+// parseDefines parses the comma separated name=value pairs of --define
+func parseDefines(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	defines := make(map[string]string)
+	for _, d := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(d, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name=value, got %q", d)
+		}
+		defines[name] = strings.TrimSpace(value)
+	}
+	return defines, nil
+}
+
+// registerThemes registers the theme file at path, or the theme files in the directory at path
+func registerThemes(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	var themes []d2themes.Theme
+	if info.IsDir() {
+		themes, err = d2themescatalog.LoadDir(path)
+	} else {
+		var theme d2themes.Theme
+		theme, err = d2themescatalog.Load(path)
+		themes = append(themes, theme)
+	}
+	if err != nil {
+		return err
+	}
+	ids := make(map[int64]string, len(themes))
+	for _, theme := range themes {
+		if name, ok := ids[theme.ID]; ok {
+			return fmt.Errorf("themes %#v and %#v have the same ID %d", name, theme.Name, theme.ID)
+		}
+		ids[theme.ID] = theme.Name
+		err = d2themescatalog.Register(theme)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 const LAYERS = "layers"
 const STEPS = "steps"
 const SCENARIOS = "scenarios"
@@ -1276,7 +2024,7 @@ func buildBoardIDToIndex(diagram *d2target.Diagram, dictionary map[string]int, p
 	return dictionary
 }
 
-func renderPNGsForGIF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opts d2svg.RenderOpts, ruler *textmeasure.Ruler, page playwright.Page, inputPath string, diagram *d2target.Diagram) (svg []byte, pngs [][]byte, err error) {
+func renderPNGsForGIF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plugin, opts d2svg.RenderOpts, ruler *textmeasure.Ruler, pw *png.Playwright, inputPath string, diagram *d2target.Diagram) (svg []byte, pngs [][]byte, err error) {
 	if !diagram.IsFolderOnly {
 
 		var scale *float64
@@ -1286,10 +2034,13 @@ func renderPNGsForGIF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plug
 			scale = go2.Pointer(1.)
 		}
 		svg, err = d2svg.Render(diagram, &d2svg.RenderOpts{
-			Pad:    opts.Pad,
-			Sketch: opts.Sketch,
-			Center: opts.Center,
-			Scale:  scale,
+			Pad:               opts.Pad,
+			Sketch:            opts.Sketch,
+			Center:            opts.Center,
+			EdgeJumps:         opts.EdgeJumps,
+			HiddenLayerGroups: opts.HiddenLayerGroups,
+			CodeTheme:         opts.CodeTheme,
+			Scale:             scale,
 		})
 		if err != nil {
 			return nil, nil, err
@@ -1303,7 +2054,7 @@ func renderPNGsForGIF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plug
 		cacheImages := ms.Env.Getenv("IMG_CACHE") == "1"
 		l := simplelog.FromCmdLog(ms.Log)
 		svg, bundleErr := imgbundler.BundleLocal(ctx, l, inputPath, svg, cacheImages)
-		svg, bundleErr2 := imgbundler.BundleRemote(ctx, l, svg, cacheImages)
+		svg, bundleErr2 := bundleRemote(ctx, ms, l, svg, cacheImages)
 		bundleErr = multierr.Combine(bundleErr, bundleErr2)
 		if bundleErr != nil {
 			return nil, nil, bundleErr
@@ -1311,7 +2062,7 @@ func renderPNGsForGIF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plug
 
 		svg = appendix.Append(diagram, ruler, svg)
 
-		pngImg, err := ConvertSVG(ms, page, svg)
+		pngImg, err := ConvertSVG(ctx, ms, pw, svg)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1319,21 +2070,21 @@ func renderPNGsForGIF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plug
 	}
 
 	for _, dl := range diagram.Layers {
-		_, layerPNGs, err := renderPNGsForGIF(ctx, ms, plugin, opts, ruler, page, inputPath, dl)
+		_, layerPNGs, err := renderPNGsForGIF(ctx, ms, plugin, opts, ruler, pw, inputPath, dl)
 		if err != nil {
 			return nil, nil, err
 		}
 		pngs = append(pngs, layerPNGs...)
 	}
 	for _, dl := range diagram.Scenarios {
-		_, scenarioPNGs, err := renderPNGsForGIF(ctx, ms, plugin, opts, ruler, page, inputPath, dl)
+		_, scenarioPNGs, err := renderPNGsForGIF(ctx, ms, plugin, opts, ruler, pw, inputPath, dl)
 		if err != nil {
 			return nil, nil, err
 		}
 		pngs = append(pngs, scenarioPNGs...)
 	}
 	for _, dl := range diagram.Steps {
-		_, stepsPNGs, err := renderPNGsForGIF(ctx, ms, plugin, opts, ruler, page, inputPath, dl)
+		_, stepsPNGs, err := renderPNGsForGIF(ctx, ms, plugin, opts, ruler, pw, inputPath, dl)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1343,13 +2094,79 @@ func renderPNGsForGIF(ctx context.Context, ms *xmain.State, plugin d2plugin.Plug
 	return svg, pngs, nil
 }
 
-func ConvertSVG(ms *xmain.State, page playwright.Page, svg []byte) ([]byte, error) {
+func ConvertSVG(ctx context.Context, ms *xmain.State, pw *png.Playwright, svg []byte) ([]byte, error) {
+	cancel := background.Repeat(func() {
+		ms.Log.Info.Printf("converting to PNG...")
+	}, time.Second*5)
+	defer cancel()
+
+	var out []byte
+	err := pw.Retry(ctx, renderTimeout(ms), func(ctx context.Context, page playwright.Page) (err error) {
+		out, err = png.ConvertSVG(ctx, page, svg)
+		return err
+	})
+	return out, err
+}
+
+func ScreenshotObject(ctx context.Context, ms *xmain.State, pw *png.Playwright, svg []byte, id string) ([]byte, error) {
 	cancel := background.Repeat(func() {
 		ms.Log.Info.Printf("converting to PNG...")
 	}, time.Second*5)
 	defer cancel()
 
-	return png.ConvertSVG(page, svg)
+	var out []byte
+	err := pw.Retry(ctx, renderTimeout(ms), func(ctx context.Context, page playwright.Page) (err error) {
+		out, err = png.ScreenshotObject(ctx, page, svg, id)
+		return err
+	})
+	return out, err
+}
+
+// bundleRemote inlines the remote images of svg as configured by --bundle-icons
+func bundleRemote(ctx context.Context, ms *xmain.State, l simplelog.Logger, svg []byte, cacheImages bool) ([]byte, error) {
+	switch ms.Env.Getenv("D2_BUNDLE_ICONS") {
+	case imgbundler.ModeSkip:
+		return svg, nil
+	case imgbundler.ModeCache:
+		dir, err := imgbundler.DefaultDiskCacheDir()
+		if err != nil {
+			return svg, fmt.Errorf("failed to find image cache directory: %w", err)
+		}
+		return imgbundler.BundleRemoteCached(ctx, l, svg, cacheImages, &imgbundler.DiskCache{Dir: dir})
+	default:
+		return imgbundler.BundleRemote(ctx, l, svg, cacheImages)
+	}
+}
+
+// renderTimeout is how long each board gets to convert to an image, set by --render-timeout
+func renderTimeout(ms *xmain.State) time.Duration {
+	seconds, err := strconv.ParseInt(ms.Env.Getenv("D2_RENDER_TIMEOUT"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// encodeRaster converts a PNG from ConvertSVG into the raster format of the export
+func encodeRaster(ctx context.Context, ms *xmain.State, pw *png.Playwright, ext exportExtension, pngImg []byte) ([]byte, error) {
+	quality := png.DEFAULT_QUALITY
+	if q, err := strconv.Atoi(ms.Env.Getenv("D2_QUALITY")); err == nil {
+		quality = q
+	}
+	switch ext {
+	case JPG, JPEG:
+		// JPEGs can't be transparent, so anything transparent is flattened onto white
+		return png.EncodeJPEG(pngImg, quality, color.White)
+	case WEBP:
+		var out []byte
+		err := pw.Retry(ctx, renderTimeout(ms), func(ctx context.Context, page playwright.Page) (err error) {
+			out, err = png.EncodeWebP(ctx, page, pngImg, quality)
+			return err
+		})
+		return out, err
+	default:
+		return png.AddExif(pngImg)
+	}
 }
 
 func AnimatePNGs(ms *xmain.State, pngs [][]byte, animIntervalMs int) ([]byte, error) {
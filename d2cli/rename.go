@@ -0,0 +1,205 @@
+package d2cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"oss.terrastruct.com/util-go/xdefer"
+
+	"oss.terrastruct.com/util-go/xmain"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+	"oss.terrastruct.com/d2/d2parser"
+)
+
+// renameDiffContext is how many unchanged lines are printed around the lines rename changes
+const renameDiffContext = 3
+
+func renameCmd(ctx context.Context, ms *xmain.State, write bool) (err error) {
+	args := ms.Opts.Flags.Args()[1:]
+	if len(args) != 3 {
+		return xmain.UsageErrorf("rename must be passed the key to rename, its new key and the file to rename it in")
+	}
+	key, newKey := args[0], args[1]
+	inputPath := ms.AbsPath(args[2])
+	d, err := os.Stat(inputPath)
+	if err == nil && d.IsDir() {
+		inputPath = filepath.Join(inputPath, "index.d2")
+	}
+
+	defer xdefer.Errorf(&err, "failed to rename %s to %s in %s", key, newKey, ms.HumanPath(inputPath))
+
+	input, err := ms.ReadPath(inputPath)
+	if err != nil {
+		return err
+	}
+	output, err := rename(ms, inputPath, input, key, newKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(ms.Stdout, unifiedDiff(ms.HumanPath(inputPath), string(input), output))
+	if !write || output == string(input) {
+		return nil
+	}
+	err = ms.WritePath(inputPath, []byte(output))
+	if err != nil {
+		return err
+	}
+	ms.Log.Success.Printf("successfully renamed %s to %s in %s", key, newKey, ms.HumanPath(inputPath))
+	return nil
+}
+
+// rename renames the object at key on the root board of input to newKey with d2oracle, so
+// that every connection, glob and map it's written in is updated, and returns the new input.
+// Objects moved to another parent keep their children. Files input imports aren't changed.
+func rename(ms *xmain.State, inputPath string, input []byte, key, newKey string) (string, error) {
+	kp, err := d2parser.ParseKey(key)
+	if err != nil {
+		return "", err
+	}
+	newKP, err := d2parser.ParseKey(newKey)
+	if err != nil {
+		return "", err
+	}
+
+	fetcher, err := importFetcher(ms, inputPath)
+	if err != nil {
+		return "", err
+	}
+	g, _, err := d2compiler.Compile(inputPath, bytes.NewReader(input), &d2compiler.CompileOptions{
+		IconDir:     ms.Env.Getenv("D2_ICON_DIR"),
+		FetchImport: fetcher.Fetch,
+		Defines:     defines(ms),
+	})
+	if err != nil {
+		return "", err
+	}
+	err = writeLockfile(ms, inputPath, fetcher)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := g.Root.HasChild(d2graph.Key(kp)); !ok {
+		return "", fmt.Errorf("%#v does not exist", key)
+	}
+	if _, ok := g.Root.HasChild(d2graph.Key(newKP)); ok {
+		return "", fmt.Errorf("%#v already exists", newKey)
+	}
+
+	ids, newIDs := d2graph.Key(kp), d2graph.Key(newKP)
+	if len(ids) == len(newIDs) && strings.EqualFold(strings.Join(ids[:len(ids)-1], "."), strings.Join(newIDs[:len(newIDs)-1], ".")) {
+		newName := newKP.Path[len(newKP.Path)-1].Unbox().ScalarString()
+		g, _, err = d2oracle.Rename(g, nil, key, newName)
+	} else {
+		g, err = d2oracle.Move(g, nil, key, newKey, true)
+	}
+	if err != nil {
+		return "", err
+	}
+	return d2format.Format(g.AST), nil
+}
+
+// unifiedDiff returns the lines that differ between old and new, the contents of the file at
+// path, as a unified diff like diff -u prints. It's empty if they're the same.
+func unifiedDiff(path, old, new string) string {
+	if old == new {
+		return ""
+	}
+	a := splitLines(old)
+	b := splitLines(new)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type diffLine struct {
+		op   byte
+		text string
+		// i and j are the indices of the line in a and b, or of the next line if it's not in
+		// one of them
+		i, j int
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i], i, j})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", path, path)
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+		// A hunk runs from the context before a change to the context after the last change
+		// that's within twice the context of the one before it
+		end := start
+		for k := start; k < len(lines) && k <= end+2*renameDiffContext; k++ {
+			if lines[k].op != ' ' {
+				end = k
+			}
+		}
+		from := max(start-renameDiffContext, 0)
+		to := min(end+renameDiffContext+1, len(lines))
+
+		var oldLen, newLen int
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				oldLen++
+			}
+			if l.op != '-' {
+				newLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(lines[from].i, oldLen), hunkRange(lines[from].j, newLen))
+		for _, l := range lines[from:to] {
+			fmt.Fprintf(&sb, "%c%s\n", l.op, l.text)
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,266 @@
+package d2cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"oss.terrastruct.com/util-go/xmain"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// Report codes classify the errors in a report
+const (
+	// REPORT_COMPILE errors are problems in the D2 source and always have a range. They're the
+	// only ones with warning severity, when --diagnostics=json writes warnings.
+	REPORT_COMPILE = "compile"
+	// REPORT_TIMEOUT errors mean D2 ran past --timeout
+	REPORT_TIMEOUT = "timeout"
+	// REPORT_WARNINGS errors mean --deny-warnings failed a compile with warnings
+	REPORT_WARNINGS = "warnings"
+	// REPORT_RENDER errors are everything else, e.g. layout, image, and file errors
+	REPORT_RENDER = "render"
+)
+
+// Report is the JSON envelope written by --report, meant for CI to consume
+type Report struct {
+	Success  bool          `json:"success"`
+	Input    string        `json:"input"`
+	Output   string        `json:"output"`
+	Errors   []ReportError `json:"errors"`
+	Warnings []string      `json:"warnings"`
+	// Boards are the paths of the boards that were compiled, e.g. ["layers", "x"].
+	// The root board's path is empty.
+	Boards    [][]string       `json:"boards"`
+	Artifacts []ReportArtifact `json:"artifacts"`
+}
+
+type ReportError struct {
+	Code string `json:"code"`
+	// Severity is warning for the warnings written by --diagnostics=json, and error otherwise
+	Severity d2compiler.Severity `json:"severity"`
+	// Diagnostic is the kind of problem of compile errors, one of d2ast's DIAGNOSTIC_ codes.
+	// Unlike messages, they stay the same across releases.
+	Diagnostic string       `json:"diagnostic,omitempty"`
+	Message    string       `json:"message"`
+	Range      *ReportRange `json:"range,omitempty"`
+	// Fixes are the edits that would likely fix compile errors, if any
+	Fixes []ReportFix `json:"fixes,omitempty"`
+}
+
+// ReportFix replaces Range with NewText. Insertions have empty ranges.
+type ReportFix struct {
+	// Title describes the fix, e.g. to offer it in editors
+	Title   string       `json:"title"`
+	Range   *ReportRange `json:"range"`
+	NewText string       `json:"newText"`
+}
+
+// ReportRange is a d2ast.Range with 1-indexed lines and columns, as editors and CI annotations use
+type ReportRange struct {
+	Path  string         `json:"path"`
+	Start ReportPosition `json:"start"`
+	End   ReportPosition `json:"end"`
+}
+
+type ReportPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type ReportArtifact struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// reporter collects what goes into a report over the course of a compile
+type reporter struct {
+	start    time.Time
+	warnings bytes.Buffer
+	diagram  *d2target.Diagram
+}
+
+// newReporter starts capturing warnings logged to ms until the returned function is called
+func newReporter(ms *xmain.State) (*reporter, func()) {
+	r := &reporter{
+		// Truncated since some filesystems only record modification times to the second
+		start: time.Now().Truncate(time.Second),
+	}
+	w := ms.Log.Warn.Writer()
+	ms.Log.Warn.SetOutput(io.MultiWriter(w, &r.warnings))
+	return r, func() {
+		ms.Log.Warn.SetOutput(w)
+	}
+}
+
+func (r *reporter) write(ms *xmain.State, reportPath, inputPath, outputPath string, compileErr error) error {
+	report := Report{
+		Success:   compileErr == nil,
+		Input:     ms.HumanPath(inputPath),
+		Output:    ms.HumanPath(outputPath),
+		Errors:    []ReportError{},
+		Warnings:  []string{},
+		Boards:    [][]string{},
+		Artifacts: []ReportArtifact{},
+	}
+
+	if compileErr != nil {
+		report.Errors = reportErrors(ms, compileErr)
+	}
+	for _, line := range strings.Split(r.warnings.String(), "\n") {
+		if line != "" {
+			report.Warnings = append(report.Warnings, line)
+		}
+	}
+	if r.diagram != nil {
+		report.Boards = reportBoards(r.diagram, []string{})
+	}
+	artifacts, err := r.artifacts(ms, outputPath)
+	if err != nil {
+		return err
+	}
+	report.Artifacts = artifacts
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ms.WritePath(reportPath, append(b, '\n'))
+}
+
+func reportErrors(ms *xmain.State, err error) []ReportError {
+	if diags := d2compiler.Diagnostics(err); len(diags) > 0 {
+		return reportDiagnostics(ms, diags)
+	}
+	code := REPORT_RENDER
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = REPORT_TIMEOUT
+	} else if errors.As(err, new(deniedWarningsError)) {
+		code = REPORT_WARNINGS
+	}
+	return []ReportError{{
+		Code:     code,
+		Severity: d2compiler.SeverityError,
+		Message:  err.Error(),
+	}}
+}
+
+// reportDiagnostics returns the errors or warnings diags as REPORT_COMPILE errors, in order
+func reportDiagnostics(ms *xmain.State, diags []d2compiler.Diagnostic) []ReportError {
+	var errs []ReportError
+	for _, d := range diags {
+		e := ReportError{
+			Code:       REPORT_COMPILE,
+			Severity:   d.Severity,
+			Diagnostic: d.Code,
+			Message:    d.Message,
+			Range:      reportRange(ms, d.Range),
+		}
+		for _, f := range d.Fixes {
+			e.Fixes = append(e.Fixes, ReportFix{
+				Title:   f.Title,
+				Range:   reportRange(ms, f.Range),
+				NewText: f.NewText,
+			})
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+func reportRange(ms *xmain.State, r d2ast.Range) *ReportRange {
+	return &ReportRange{
+		Path: ms.HumanPath(r.Path),
+		Start: ReportPosition{
+			Line:   r.Start.Line + 1,
+			Column: r.Start.Column + 1,
+		},
+		End: ReportPosition{
+			Line:   r.End.Line + 1,
+			Column: r.End.Column + 1,
+		},
+	}
+}
+
+func reportBoards(diagram *d2target.Diagram, path []string) [][]string {
+	boards := [][]string{path}
+	for _, kind := range []struct {
+		name   string
+		boards []*d2target.Diagram
+	}{
+		{"layers", diagram.Layers},
+		{"scenarios", diagram.Scenarios},
+		{"steps", diagram.Steps},
+	} {
+		for _, b := range kind.boards {
+			boardPath := append(append([]string{}, path...), kind.name, b.Name)
+			boards = append(boards, reportBoards(b, boardPath)...)
+		}
+	}
+	return boards
+}
+
+// artifacts hashes the files written for outputPath during this compile.
+// Multiple boards are written into a directory named after outputPath without its extension.
+func (r *reporter) artifacts(ms *xmain.State, outputPath string) ([]ReportArtifact, error) {
+	artifacts := []ReportArtifact{}
+	if outputPath == "-" {
+		return artifacts, nil
+	}
+
+	ext := filepath.Ext(outputPath)
+	paths := []string{outputPath}
+	dir := strings.TrimSuffix(outputPath, ext)
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(path) == ext {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Skip stale files left over from previous compiles
+		if fi.ModTime().Before(r.start) {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		artifacts = append(artifacts, ReportArtifact{
+			Path:   ms.HumanPath(path),
+			SHA256: hex.EncodeToString(sum[:]),
+			Size:   fi.Size(),
+		})
+	}
+	return artifacts, nil
+}
@@ -6,11 +6,14 @@ window.addEventListener("DOMContentLoaded", () => {
 function init(reconnectDelay) {
   const d2ErrDiv = window.document.querySelector("#d2-err");
   const d2SVG = window.document.querySelector("#d2-svg-container");
+  const d2LayerGroups = window.document.querySelector("#d2-layer-groups");
+  // Layer groups toggled in this page, by name, kept across reloads
+  const toggledLayerGroups = {};
 
   const devMode = document.body.dataset.d2DevMode === "true";
   const ws = new WebSocket(`ws://${window.location.host}/watch`);
-  let isInit = true;
-  let ratio;
+  // The zoom and scroll of the page are kept across updates, reconnects and page reloads
+  const view = loadView();
   ws.onopen = () => {
     reconnectDelay = 1000;
     console.info("watch websocket opened");
@@ -26,42 +29,60 @@ function init(reconnectDelay) {
       // we can't just set `d2SVG.innerHTML = msg.svg` need to parse this as xml not html
       const parsedXML = new DOMParser().parseFromString(msg.svg, "text/xml");
       d2SVG.replaceChildren(parsedXML.documentElement);
-      changeFavicon("/static/favicon.ico");
       const svgEl = d2SVG.querySelector("#d2-svg");
       // just use inner SVG in watch mode
       svgEl.parentElement.replaceWith(svgEl);
-      let width = parseInt(svgEl.getAttribute("width"), 10);
-      let height = parseInt(svgEl.getAttribute("height"), 10);
-      if (isInit) {
-        if (msg.scale) {
-          ratio = msg.scale;
+      const width = parseInt(svgEl.getAttribute("width"), 10);
+      const height = parseInt(svgEl.getAttribute("height"), 10);
+      if (view.ratio === undefined) {
+        view.ratio = fitRatio(msg.scale, width, height);
+      }
+      const applyRatio = () => {
+        if (view.ratio) {
+          // body padding is 8px
+          svgEl.setAttribute("width", width * view.ratio - 16);
+          svgEl.setAttribute("height", height * view.ratio - 16);
         } else {
-          if (width > height) {
-            if (width > window.innerWidth) {
-              ratio = window.innerWidth / width;
-            }
-          } else if (height > window.innerHeight) {
-            ratio = window.innerHeight / height;
-          }
+          svgEl.setAttribute("width", width);
+          svgEl.setAttribute("height", height);
         }
-        // Scale svg fit to zoom
-        isInit = false;
-      }
-      if (ratio) {
-        // body padding is 8px
-        svgEl.setAttribute("width", width * ratio - 16);
-        svgEl.setAttribute("height", height * ratio - 16);
-      }
+      };
+      applyRatio();
+      window.onkeydown = (e) => {
+        if (e.target !== document.body || e.metaKey || e.ctrlKey || e.altKey) {
+          return;
+        }
+        if (e.key === "+" || e.key === "=") {
+          view.ratio = (view.ratio || 1) * 1.25;
+        } else if (e.key === "-") {
+          view.ratio = (view.ratio || 1) / 1.25;
+        } else if (e.key === "0") {
+          view.ratio = fitRatio(msg.scale, width, height);
+        } else {
+          return;
+        }
+        applyRatio();
+        saveView(view);
+      };
+      window.scrollTo(view.scrollX, view.scrollY);
 
-      d2ErrDiv.style.display = "none";
+      renderLayerGroupToggles(d2LayerGroups, svgEl, toggledLayerGroups);
     }
     if (msg.err) {
-      d2ErrDiv.innerText = msg.err;
-      d2ErrDiv.style.display = "block";
+      renderErr(d2ErrDiv, msg.err, msg.errs);
+      d2SVG.classList.add("d2-stale");
       changeFavicon("/static/favicon-err.ico");
-      d2ErrDiv.scrollIntoView();
+    } else {
+      d2ErrDiv.style.display = "none";
+      d2SVG.classList.remove("d2-stale");
+      changeFavicon("/static/favicon.ico");
     }
   };
+  window.onscroll = () => {
+    view.scrollX = window.scrollX;
+    view.scrollY = window.scrollY;
+    saveView(view);
+  };
   ws.onerror = (ev) => {
     console.error("watch websocket connection error", ev);
   };
@@ -77,6 +98,114 @@ function init(reconnectDelay) {
   };
 }
 
+// fitRatio is the ratio that fits an SVG of width and height in the window, or the scale
+// given to d2, or undefined if it fits as is
+const fitRatio = function (scale, width, height) {
+  if (scale) {
+    return scale;
+  }
+  if (width > height) {
+    if (width > window.innerWidth) {
+      return window.innerWidth / width;
+    }
+  } else if (height > window.innerHeight) {
+    return window.innerHeight / height;
+  }
+  return null;
+};
+
+// Views are kept per board, which each have their own path
+const viewKey = function () {
+  return `d2-watch-view:${window.location.pathname}`;
+};
+
+const loadView = function () {
+  try {
+    const view = JSON.parse(window.sessionStorage.getItem(viewKey()));
+    if (view) {
+      return view;
+    }
+  } catch (e) {
+    console.debug("failed to load watch view", e);
+  }
+  return { scrollX: 0, scrollY: 0 };
+};
+
+const saveView = function (view) {
+  try {
+    window.sessionStorage.setItem(viewKey(), JSON.stringify(view));
+  } catch (e) {
+    console.debug("failed to save watch view", e);
+  }
+};
+
+// renderErr shows err over the diagram, with the lines of input around each of errs
+const renderErr = function (container, err, errs) {
+  container.replaceChildren();
+  const summary = document.createElement("div");
+  summary.className = "d2-err-summary";
+  summary.innerText = err;
+  container.append(summary);
+  for (const e of errs || []) {
+    if (!e.source || !e.range) {
+      continue;
+    }
+    const title = document.createElement("div");
+    title.className = "d2-err-title";
+    title.innerText = `${e.range.path}:${e.range.start.line}:${e.range.start.column}: ${e.message}`;
+    const pre = document.createElement("pre");
+    pre.className = "d2-err-source";
+    for (const line of e.source) {
+      const lineEl = document.createElement("div");
+      if (line.line >= e.range.start.line && line.line <= e.range.end.line) {
+        lineEl.className = "d2-err-line";
+      }
+      const number = document.createElement("span");
+      number.className = "d2-err-line-number";
+      number.innerText = line.line;
+      lineEl.append(number, line.text);
+      pre.append(lineEl);
+    }
+    container.append(title, pre);
+  }
+  container.style.display = "block";
+};
+
+// renderLayerGroupToggles adds a checkbox for each layer group of the SVG to show or hide it
+const renderLayerGroupToggles = function (container, svgEl, toggled) {
+  container.replaceChildren();
+  // Boards of the same SVG can each have the group
+  const groups = new Map();
+  for (const group of svgEl.querySelectorAll("g.layer-group")) {
+    const name = group.dataset.layerGroup;
+    if (!groups.has(name)) {
+      groups.set(name, []);
+    }
+    groups.get(name).push(group);
+  }
+  for (const [name, elements] of groups) {
+    const setShown = (shown) => {
+      for (const el of elements) {
+        el.style.display = shown ? "" : "none";
+      }
+    };
+    if (name in toggled) {
+      setShown(toggled[name]);
+    }
+    const label = document.createElement("label");
+    const checkbox = document.createElement("input");
+    checkbox.type = "checkbox";
+    checkbox.checked = elements[0].style.display !== "none";
+    checkbox.addEventListener("change", () => {
+      toggled[name] = checkbox.checked;
+      setShown(checkbox.checked);
+    });
+    label.append(checkbox, name);
+    container.append(label);
+  }
+  container.style.display = groups.size ? "flex" : "none";
+};
+
 const changeFavicon = function (iconURL) {
   const faviconLink = document.getElementById("favicon");
   faviconLink.href = iconURL;
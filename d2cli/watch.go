@@ -27,6 +27,8 @@ import (
 
 	"oss.terrastruct.com/util-go/xmain"
 
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2parser"
 	"oss.terrastruct.com/d2/d2plugin"
 	"oss.terrastruct.com/d2/d2renderers/d2fonts"
 	"oss.terrastruct.com/d2/d2renderers/d2svg"
@@ -55,6 +57,7 @@ type watcherOpts struct {
 	pwd             string
 	bundle          bool
 	forceAppendix   bool
+	pdfRenderer     string
 	pw              png.Playwright
 	fontFamily      *d2fonts.FontFamily
 }
@@ -69,6 +72,9 @@ type watcher struct {
 	watcherOpts
 
 	compileCh chan struct{}
+	// layoutCache keeps the boards laid out by the last compile, so only the boards edited
+	// since are laid out again
+	layoutCache *d2lib.LayoutCache
 
 	fw               *fsnotify.Watcher
 	l                net.Listener
@@ -85,12 +91,59 @@ type watcher struct {
 
 	resMu sync.Mutex
 	res   *compileResult
+	// lastSVG is the last diagram compiled, kept on the page under the errors of later compiles
+	lastSVG string
 }
 
 type compileResult struct {
 	SVG   string   `json:"svg"`
 	Scale *float64 `json:"scale,omitEmpty"`
 	Err   string   `json:"err"`
+	// Errs are the errors of Err positioned in the input, shown over the diagram
+	Errs []watchError `json:"errs,omitempty"`
+}
+
+// watchError is a compile error with the lines of input around it
+type watchError struct {
+	ReportError
+	Source []sourceLine `json:"source,omitempty"`
+}
+
+type sourceLine struct {
+	// Line is 1-indexed, like ReportRange
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// watchErrorContext is the number of lines shown before and after the line of an error
+const watchErrorContext = 2
+
+func watchErrors(ms *xmain.State, err error) []watchError {
+	var pe *d2parser.ParseError
+	if !errors.As(err, &pe) || pe.Empty() {
+		return nil
+	}
+	// reportErrors positions each error of pe in order
+	reported := reportErrors(ms, err)
+	var errs []watchError
+	for i, e := range pe.Errors {
+		we := watchError{
+			ReportError: reported[i],
+		}
+		if input, err := ms.ReadPath(e.Range.Path); err == nil {
+			lines := strings.Split(string(input), "\n")
+			start := max(0, e.Range.Start.Line-watchErrorContext)
+			end := min(len(lines)-1, e.Range.Start.Line+watchErrorContext)
+			for l := start; l <= end; l++ {
+				we.Source = append(we.Source, sourceLine{
+					Line: l + 1,
+					Text: strings.TrimSuffix(lines[l], "\r"),
+				})
+			}
+		}
+		errs = append(errs, we)
+	}
+	return errs
 }
 
 func newWatcher(ctx context.Context, ms *xmain.State, opts watcherOpts) (*watcher, error) {
@@ -104,8 +157,9 @@ func newWatcher(ctx context.Context, ms *xmain.State, opts watcherOpts) (*watche
 		ms:          ms,
 		watcherOpts: opts,
 
-		compileCh: make(chan struct{}, 1),
-		wsclients: make(map[*wsclient]struct{}),
+		compileCh:   make(chan struct{}, 1),
+		layoutCache: d2lib.NewLayoutCache(),
+		wsclients:   make(map[*wsclient]struct{}),
 	}
 	err := w.init()
 	if err != nil {
@@ -411,12 +465,13 @@ func (w *watcher) compileLoop(ctx context.Context) error {
 			recompiledPrefix = "re"
 		}
 
-		if (filepath.Ext(w.outputPath) == ".png" || filepath.Ext(w.outputPath) == ".pdf") && !w.pw.Browser.IsConnected() {
+		if getOutputFormat(w.ms, w.outputPath).requiresPNGRenderer() && !w.pw.Browser.IsConnected() {
 			newPW, err := w.pw.RestartBrowser()
 			if err != nil {
 				broadcastErr := fmt.Errorf("issue encountered with PNG exporter: %w", err)
 				w.ms.Log.Error.Print(broadcastErr)
 				w.broadcast(&compileResult{
+					SVG: w.lastSVG,
 					Err: broadcastErr.Error(),
 				})
 				continue
@@ -430,27 +485,39 @@ func (w *watcher) compileLoop(ctx context.Context) error {
 		if w.boardPath != "" {
 			boardPath = strings.Split(w.boardPath, string(os.PathSeparator))
 		}
-		svg, _, err := compile(ctx, w.ms, w.plugins, &fs, w.layout, w.renderOpts, w.fontFamily, w.animateInterval, w.inputPath, w.outputPath, boardPath, false, w.bundle, w.forceAppendix, w.pw.Page)
+		svg, _, err := compile(ctx, w.ms, w.plugins, &fs, w.layout, w.renderOpts, w.fontFamily, w.animateInterval, w.inputPath, w.outputPath, boardPath, nil, false, w.bundle, w.forceAppendix, w.pdfRenderer, &w.pw, w.layoutCache, true, nil)
 		w.boardpathMu.Unlock()
 		errs := ""
+		var positionedErrs []watchError
 		if err != nil {
+			positionedErrs = watchErrors(w.ms, err)
 			if len(svg) > 0 {
 				err = fmt.Errorf("failed to fully %scompile (rendering partial svg): %w", recompiledPrefix, err)
 			} else {
 				err = fmt.Errorf("failed to %scompile: %w", recompiledPrefix, err)
 			}
 			errs = err.Error()
-			w.ms.Log.Error.Print(errs)
+			if errors.Is(err, errBoardNotFound) {
+				// The board path is from the page's URL, which links that aren't to boards lead to
+				// too, so the diagram itself is fine
+				w.ms.Log.Warn.Print(errs)
+			} else {
+				w.ms.Log.Error.Print(errs)
+			}
 		}
 		err = w.replaceWatchList(ctx, fs.opened)
 		if err != nil {
 			return err
 		}
 
+		if len(svg) > 0 {
+			w.lastSVG = string(svg)
+		}
 		w.broadcast(&compileResult{
-			SVG:   string(svg),
+			SVG:   w.lastSVG,
 			Scale: w.renderOpts.Scale,
 			Err:   errs,
+			Errs:  positionedErrs,
 		})
 
 		if firstCompile {
@@ -510,6 +577,7 @@ func (w *watcher) handleRoot(hw http.ResponseWriter, r *http.Request) {
 </head>
 <body data-d2-dev-mode=%t>
 	<div id="d2-err" style="display: none"></div>
+	<div id="d2-layer-groups" style="display: none"></div>
 	<div id="d2-svg-container"></div>
 </body>
 </html>`, filepath.Base(w.outputPath), w.devMode)
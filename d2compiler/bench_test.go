@@ -0,0 +1,66 @@
+package d2compiler_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+)
+
+// largeInput generates a file of n shapes in containers of 10, each connected to the next,
+// like diagrams generated from other sources are
+func largeInput(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "c%d.n%d: Node %d\n", i/10, i, i)
+	}
+	for i := 0; i+1 < n; i++ {
+		fmt.Fprintf(&sb, "c%d.n%d -> c%d.n%d\n", i/10, i, (i+1)/10, i+1)
+	}
+	return sb.String()
+}
+
+// TestCompileLarge checks that keys are resolved the same in maps big enough to be indexed
+func TestCompileLarge(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&sb, "n%d\n", i)
+	}
+	sb.WriteString(`N5.style.fill: red
+n5 -> n6
+N5 -> N6
+n6 <- n5
+x: {
+  a
+}
+X.A.label: hi
+`)
+	g, _, err := d2compiler.Compile("", strings.NewReader(sb.String()), nil)
+	tassert.Nil(t, err)
+	tassert.Equal(t, 101, len(g.Root.ChildrenArray))
+	tassert.Equal(t, "red", g.Root.ChildrenArray[5].Style.Fill.Value)
+	tassert.Equal(t, "hi", g.Root.ChildrenArray[100].ChildrenArray[0].Label.Value)
+	tassert.Equal(t, 3, len(g.Edges))
+	tassert.Equal(t, "(n5 -> n6)[1]", g.Edges[1].AbsID())
+	tassert.Equal(t, "(n6 <- n5)[0]", g.Edges[2].AbsID())
+}
+
+func BenchmarkCompile(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		input := largeInput(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				_, _, err := d2compiler.Compile("", strings.NewReader(input), nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
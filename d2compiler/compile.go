@@ -1,11 +1,17 @@
 package d2compiler
 
 import (
+	"encoding/base64"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"mime"
+	"net/http"
 	"net/url"
+	"os"
+	"path"
 	"strconv"
 	"strings"
 
@@ -18,6 +24,8 @@ import (
 	"oss.terrastruct.com/d2/d2parser"
 	"oss.terrastruct.com/d2/d2target"
 	"oss.terrastruct.com/d2/lib/color"
+	"oss.terrastruct.com/d2/lib/iconpack"
+	"oss.terrastruct.com/d2/lib/shape"
 	"oss.terrastruct.com/d2/lib/textmeasure"
 )
 
@@ -26,6 +34,21 @@ type CompileOptions struct {
 	// FS is the file system used for resolving imports in the d2 text.
 	// It should correspond to the root path.
 	FS fs.FS
+	// Stylesheet, if given, is a file of classes shared by every board, which the d2 text can
+	// override.
+	Stylesheet *d2ast.Map
+	// IconDir is the directory of icon packs, which icons like "@aws/s3" are found in.
+	IconDir string
+	// FetchImport, if given, returns the file at the URL of a remote import, see
+	// d2ir.CompileOptions.FetchImport.
+	FetchImport func(url string) ([]byte, error)
+	// Defines set the vars of the root board, see d2ir.CompileOptions.Defines.
+	Defines map[string]string
+	// Partial, if set, returns the graph of the parts of the d2 text that parse when others
+	// don't, along with the parse errors, so tooling keeps working while the text is mid-edit.
+	// The graph is nil if those parts have errors of their own. Its AST has what didn't parse
+	// removed, so it must not be formatted back into the text.
+	Partial bool
 }
 
 func Compile(p string, r io.Reader, opts *CompileOptions) (*d2graph.Graph, *d2target.Config, error) {
@@ -37,24 +60,35 @@ func Compile(p string, r io.Reader, opts *CompileOptions) (*d2graph.Graph, *d2ta
 		UTF16Pos: opts.UTF16Pos,
 	})
 	if err != nil {
-		return nil, nil, err
+		var parseErr *d2parser.ParseError
+		if !errors.As(err, &parseErr) {
+			return nil, nil, err
+		}
+		// Keep compiling what did parse so that errors elsewhere are reported in the same pass
+		g, config, err := compileRest(ast, parseErr, opts)
+		if !opts.Partial {
+			return nil, nil, err
+		}
+		return g, config, err
 	}
 
 	ir, _, err := d2ir.Compile(ast, &d2ir.CompileOptions{
-		UTF16Pos: opts.UTF16Pos,
-		FS:       opts.FS,
+		UTF16Pos:    opts.UTF16Pos,
+		FS:          opts.FS,
+		FetchImport: opts.FetchImport,
+		Stylesheet:  opts.Stylesheet,
+		Defines:     opts.Defines,
 	})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	g, err := compileIR(ast, ir)
+	g, err := compileIR(ast, ir, opts)
 	if err != nil {
 		return nil, nil, err
 	}
-	g.FS = opts.FS
-	g.SortObjectsByAST()
-	g.SortEdgesByAST()
+	setupGraph(g, opts)
+	g.Warnings = warnings(ast, ir, g)
 	config, err := compileConfig(ir)
 	if err != nil {
 		return nil, nil, err
@@ -62,9 +96,113 @@ func Compile(p string, r io.Reader, opts *CompileOptions) (*d2graph.Graph, *d2ta
 	return g, config, nil
 }
 
-func compileIR(ast *d2ast.Map, m *d2ir.Map) (*d2graph.Graph, error) {
+// setupGraph sets what g needs beyond what compiling it sets
+func setupGraph(g *d2graph.Graph, opts *CompileOptions) {
+	g.FS = opts.FS
+	g.IconDir = opts.IconDir
+	g.FetchImport = opts.FetchImport
+	g.SortObjectsByAST()
+	g.SortEdgesByAST()
+}
+
+// compileRest compiles the parts of ast that parsed and returns its errors merged with the parse errors.
+// Compile errors on lines with parse errors, or on keys that contained them, are dropped
+// as they're most likely caused by the parse error rather than being independent.
+// If those parts compile without errors, their graph and config are returned too.
+func compileRest(ast *d2ast.Map, parseErr *d2parser.ParseError, opts *CompileOptions) (g *d2graph.Graph, config *d2target.Config, err error) {
+	badRanges := pruneParseErrors(ast, parseErr.Errors)
+	for _, e := range parseErr.Errors {
+		badRanges = append(badRanges, e.Range)
+	}
+
+	ir, _, err := d2ir.Compile(ast, &d2ir.CompileOptions{
+		UTF16Pos:    opts.UTF16Pos,
+		FS:          opts.FS,
+		FetchImport: opts.FetchImport,
+		Stylesheet:  opts.Stylesheet,
+		Defines:     opts.Defines,
+	})
+	if err == nil {
+		g, err = compileIR(ast, ir, opts)
+	}
+	if err == nil {
+		setupGraph(g, opts)
+		config, err = compileConfig(ir)
+		if err != nil {
+			return nil, nil, parseErr
+		}
+		return g, config, parseErr
+	}
+	var compileErr *d2parser.ParseError
+	if !errors.As(err, &compileErr) {
+		return nil, nil, parseErr
+	}
+
+	type line struct {
+		path string
+		line int
+	}
+	badLines := make(map[line]struct{})
+	for _, r := range badRanges {
+		badLines[line{r.Path, r.Start.Line}] = struct{}{}
+	}
+	merged := &d2parser.ParseError{
+		Errors: append([]d2ast.Error(nil), parseErr.Errors...),
+	}
+	for _, e := range compileErr.Errors {
+		if _, ok := badLines[line{e.Range.Path, e.Range.Start.Line}]; ok {
+			continue
+		}
+		merged.Errors = append(merged.Errors, e)
+	}
+	return nil, nil, merged
+}
+
+// pruneParseErrors removes the nodes of m that contain parse errors.
+// Keys whose errors are all within their map value are kept with that map pruned instead,
+// and their ranges are returned.
+func pruneParseErrors(m *d2ast.Map, errs []d2ast.Error) (pruned []d2ast.Range) {
+	contains := func(r d2ast.Range, e d2ast.Error) bool {
+		return e.Range.Path == r.Path && r.Start.Byte <= e.Range.Start.Byte && e.Range.Start.Byte <= r.End.Byte
+	}
+
+	nodes := m.Nodes[:0]
+	for _, n := range m.Nodes {
+		var inNode []d2ast.Error
+		for _, e := range errs {
+			if contains(n.Unbox().GetRange(), e) {
+				inNode = append(inNode, e)
+			}
+		}
+		if len(inNode) == 0 {
+			nodes = append(nodes, n)
+			continue
+		}
+		if n.MapKey == nil || n.MapKey.Value.Map == nil {
+			continue
+		}
+		inValue := true
+		for _, e := range inNode {
+			if !contains(n.MapKey.Value.Map.Range, e) {
+				inValue = false
+				break
+			}
+		}
+		if inValue {
+			pruned = append(pruned, n.MapKey.Range)
+			pruned = append(pruned, pruneParseErrors(n.MapKey.Value.Map, inNode)...)
+			nodes = append(nodes, n)
+		}
+	}
+	m.Nodes = nodes
+	return pruned
+}
+
+func compileIR(ast *d2ast.Map, m *d2ir.Map, opts *CompileOptions) (*d2graph.Graph, error) {
 	c := &compiler{
-		err: &d2parser.ParseError{},
+		err:     &d2parser.ParseError{},
+		fs:      opts.FS,
+		iconDir: opts.IconDir,
 	}
 
 	g := d2graph.NewGraph()
@@ -78,6 +216,10 @@ func compileIR(ast *d2ast.Map, m *d2ir.Map) (*d2graph.Graph, error) {
 	if len(c.err.Errors) > 0 {
 		return nil, c.err
 	}
+	c.validateBoardEmbeds(g)
+	if len(c.err.Errors) > 0 {
+		return nil, c.err
+	}
 	return g, nil
 }
 
@@ -92,6 +234,9 @@ func (c *compiler) compileBoard(g *d2graph.Graph, ir *d2ir.Map) *d2graph.Graph {
 	c.validateNear(g)
 	c.validateEdges(g)
 	c.validatePositionsCompatibility(g)
+	if len(c.err.Errors) == 0 {
+		c.validateAssertions(g)
+	}
 
 	c.compileBoardsField(g, ir, "layers")
 	c.compileBoardsField(g, ir, "scenarios")
@@ -151,6 +296,9 @@ func findFieldAST(ast *d2ast.Map, f *d2ir.Field) *d2ast.Map {
 
 	currAST := ast
 	for len(path) > 0 {
+		if currAST == nil {
+			return nil
+		}
 		head := path[0]
 		found := false
 		for _, n := range currAST.Nodes {
@@ -202,17 +350,28 @@ func findFieldAST(ast *d2ast.Map, f *d2ir.Field) *d2ast.Map {
 
 type compiler struct {
 	err *d2parser.ParseError
+
+	fs      fs.FS
+	iconDir string
 }
 
 func (c *compiler) errorf(n d2ast.Node, f string, v ...interface{}) {
-	err := d2parser.Errorf(n, f, v...).(d2ast.Error)
+	c.codeErrorf("", n, f, v...)
+}
+
+// codeErrorf adds an error with its diagnostic code, and returns it so that a fix can be set
+// on it. Errors the same as one already added aren't added again.
+func (c *compiler) codeErrorf(code string, n d2ast.Node, f string, v ...interface{}) *d2ast.Error {
+	err := d2parser.CodeErrorf(code, n, f, v...).(d2ast.Error)
 	if c.err.ErrorsLookup == nil {
 		c.err.ErrorsLookup = make(map[d2ast.Error]struct{})
 	}
-	if _, ok := c.err.ErrorsLookup[err]; !ok {
-		c.err.Errors = append(c.err.Errors, err)
-		c.err.ErrorsLookup[err] = struct{}{}
+	if _, ok := c.err.ErrorsLookup[err]; ok {
+		return &err
 	}
+	c.err.Errors = append(c.err.Errors, err)
+	c.err.ErrorsLookup[err] = struct{}{}
+	return &c.err.Errors[len(c.err.Errors)-1]
 }
 
 func (c *compiler) compileMap(obj *d2graph.Object, m *d2ir.Map) {
@@ -236,10 +395,11 @@ func (c *compiler) compileMap(obj *d2graph.Object, m *d2ir.Map) {
 		}
 
 		for _, className := range classNames {
-			classMap := m.GetClassMap(className)
-			if classMap != nil {
+			classMaps := c.classMaps(m, className)
+			for _, classMap := range classMaps {
 				c.compileMap(obj, classMap)
-			} else {
+			}
+			if len(classMaps) == 0 {
 				if strings.Contains(className, ",") {
 					split := strings.Split(className, ",")
 					allFound := true
@@ -251,7 +411,7 @@ func (c *compiler) compileMap(obj *d2graph.Object, m *d2ir.Map) {
 						}
 					}
 					if allFound {
-						c.errorf(class.LastRef().AST(), `class "%s" not found. Did you mean to use ";" to separate array items?`, className)
+						c.codeErrorf(d2ast.DIAGNOSTIC_UNDEFINED_CLASS, class.LastRef().AST(), `class "%s" not found. Did you mean to use ";" to separate array items?`, className)
 					}
 				}
 			}
@@ -265,6 +425,7 @@ func (c *compiler) compileMap(obj *d2graph.Object, m *d2ir.Map) {
 			c.compileField(obj, shape)
 		}
 	}
+	isClass := m.IsClass()
 	for _, f := range m.Fields {
 		if f.Name == "shape" {
 			continue
@@ -272,15 +433,25 @@ func (c *compiler) compileMap(obj *d2graph.Object, m *d2ir.Map) {
 		if _, ok := d2graph.BoardKeywords[f.Name]; ok {
 			continue
 		}
+		// Classes set the arrowheads of the connections of the objects they're used on.
+		if isClass && (f.Name == "extends" || f.Name == "source-arrowhead" || f.Name == "target-arrowhead") {
+			continue
+		}
 		c.compileField(obj, f)
 	}
 
-	if !m.IsClass() {
+	if !isClass {
 		switch obj.Shape.Value {
 		case d2target.ShapeClass:
 			c.compileClass(obj)
 		case d2target.ShapeSQLTable:
 			c.compileSQLTable(obj)
+		case d2target.ShapeCustom:
+			c.compileCustomShape(obj)
+		case d2target.ShapeBoard:
+			if obj.Board == nil {
+				c.errorf(obj.Shape.MapKey, `board shapes need a "board" to embed, like layers.details`)
+			}
 		}
 
 		for _, e := range m.Edges {
@@ -307,6 +478,10 @@ func (c *compiler) compileField(obj *d2graph.Object, f *d2ir.Field) {
 					continue
 				}
 				for _, cf := range classesField.Map().Fields {
+					if cf.Name == "extends" {
+						c.validateClassExtends(f.Map(), classesField, cf)
+						continue
+					}
 					if _, ok := d2graph.ReservedKeywords[cf.Name]; !ok {
 						c.errorf(cf.LastRef().AST(), "%s is an invalid class field, must be reserved keyword", cf.Name)
 					}
@@ -319,8 +494,11 @@ func (c *compiler) compileField(obj *d2graph.Object, f *d2ir.Field) {
 		return
 	} else if f.Name == "vars" {
 		return
-	} else if f.Name == "source-arrowhead" || f.Name == "target-arrowhead" {
-		c.errorf(f.LastRef().AST(), `%#v can only be used on connections`, f.Name)
+	} else if f.Name == "assert" {
+		c.compileAssert(obj, f)
+		return
+	} else if f.Name == "source-arrowhead" || f.Name == "target-arrowhead" || f.Name == "source-label" || f.Name == "target-label" {
+		c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastRef().AST(), `%#v can only be used on connections`, f.Name)
 		return
 
 	} else if isReserved {
@@ -336,6 +514,9 @@ func (c *compiler) compileField(obj *d2graph.Object, f *d2ir.Field) {
 			c.errorf(obj.Style.Animated.MapKey, `key "animated" can only be applied to edges`)
 		}
 		return
+	} else if strings.EqualFold(f.Name, "code") && strings.EqualFold(obj.Shape.Value, d2target.ShapeCode) {
+		c.compileCode(&obj.Attributes, f)
+		return
 	}
 
 	if obj.Parent != nil {
@@ -349,6 +530,7 @@ func (c *compiler) compileField(obj *d2graph.Object, f *d2ir.Field) {
 		}
 	}
 
+	parent := obj
 	obj = obj.EnsureChild(d2graphIDA([]string{f.Name}))
 	if f.Primary() != nil {
 		c.compileLabel(&obj.Attributes, f)
@@ -356,6 +538,9 @@ func (c *compiler) compileField(obj *d2graph.Object, f *d2ir.Field) {
 	if f.Map() != nil {
 		c.compileMap(obj, f.Map())
 	}
+	if d2target.IsRowShape(obj.Shape.Value) && !strings.EqualFold(parent.Shape.Value, d2target.ShapeSQLTable) && !strings.EqualFold(parent.Shape.Value, d2target.ShapeClass) {
+		c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, obj.Shape.MapKey, "shape %q can only be used on sql_table columns and class members", obj.Shape.Value)
+	}
 
 	if obj.Label.MapKey == nil {
 		obj.Label.MapKey = f.LastPrimaryKey()
@@ -456,12 +641,95 @@ func (c *compiler) compilePosition(attrs *d2graph.Attributes, f *d2ir.Field) {
 				}
 			} else {
 				if f.LastPrimaryKey() != nil {
-					c.errorf(f.LastPrimaryKey(), `unexpected field %s`, f.Name)
+					c.codeErrorf(d2ast.DIAGNOSTIC_SYNTAX, f.LastPrimaryKey(), `unexpected field %s`, f.Name)
 				}
 			}
 		}
 		if len(f.Map().Edges) > 0 {
-			c.errorf(f.LastPrimaryKey(), "unexpected edges in map")
+			c.codeErrorf(d2ast.DIAGNOSTIC_SYNTAX, f.LastPrimaryKey(), "unexpected edges in map")
+		}
+	}
+}
+
+func (c *compiler) compileNearOptions(attrs *d2graph.Attributes, f *d2ir.Field) {
+	attrs.NearSide = nil
+	attrs.NearGap = nil
+	if f.Map() == nil {
+		return
+	}
+	for _, f := range f.Map().Fields {
+		if f.Primary() == nil {
+			if f.LastPrimaryKey() != nil {
+				c.errorf(f.LastPrimaryKey(), `invalid "near" field %s`, f.Name)
+			}
+			continue
+		}
+		scalar := f.Primary().Value
+		switch f.Name {
+		case "side":
+			if !go2.Contains(d2graph.NearSidesArray, scalar.ScalarString()) {
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, `expected "side" to be one of (%s)`, strings.Join(d2graph.NearSidesArray, ", "))
+				continue
+			}
+			attrs.NearSide = &d2graph.Scalar{}
+			attrs.NearSide.Value = scalar.ScalarString()
+			attrs.NearSide.MapKey = f.LastPrimaryKey()
+		case "gap":
+			v, err := strconv.Atoi(scalar.ScalarString())
+			if err != nil {
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer gap %#v: %s", scalar.ScalarString(), err)
+				continue
+			}
+			if v < 0 {
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "gap must be a non-negative integer: %#v", scalar.ScalarString())
+				continue
+			}
+			attrs.NearGap = &d2graph.Scalar{}
+			attrs.NearGap.Value = scalar.ScalarString()
+			attrs.NearGap.MapKey = f.LastPrimaryKey()
+		default:
+			c.codeErrorf(d2ast.DIAGNOSTIC_SYNTAX, f.LastPrimaryKey(), `unexpected field %s`, f.Name)
+		}
+	}
+}
+
+// validateClassExtends checks that the classes the extends field of class lists exist and
+// don't extend class back.
+func (c *compiler) validateClassExtends(classes *d2ir.Map, class, extends *d2ir.Field) {
+	if extends.Map() != nil {
+		c.errorf(extends.LastRef().AST(), `"extends" must be a class or an array of classes, like extends: [service; persistent]`)
+		return
+	}
+	var visit func(name string, path []string) bool
+	visit = func(name string, path []string) bool {
+		if strings.EqualFold(name, class.Name) {
+			c.errorf(extends.LastRef().AST(), `class %q cannot extend itself: %s`, class.Name, strings.Join(append(path, name), " -> "))
+			return false
+		}
+		for _, p := range path[1:] {
+			if strings.EqualFold(p, name) {
+				// A cycle that doesn't go through class is reported on the classes in it.
+				return true
+			}
+		}
+		parent := classes.GetField(name)
+		if parent == nil || parent.Map() == nil {
+			return true
+		}
+		for _, grandparent := range classExtends(parent.Map().GetField("extends")) {
+			if !visit(grandparent, append(path, name)) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, name := range classExtends(extends) {
+		if classes.GetField(name) == nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_UNDEFINED_CLASS, extends.LastRef().AST(), `class %q extends %q, which doesn't exist`, class.Name, name)
+			continue
+		}
+		if !visit(name, []string{class.Name}) {
+			return
 		}
 	}
 }
@@ -493,6 +761,10 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 				}
 			case "label", "icon":
 				c.compilePosition(attrs, f)
+			case "near":
+				if f.LastPrimaryKey() != nil {
+					c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastPrimaryKey(), `"near" must be set to a value before its "side" or "gap"`)
+				}
 			default:
 				c.errorf(f.LastPrimaryKey(), "reserved field %v does not accept composite", f.Name)
 			}
@@ -505,10 +777,11 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 		c.compileLabel(attrs, f)
 		c.compilePosition(attrs, f)
 	case "shape":
-		in := d2target.IsShape(scalar.ScalarString())
+		in := d2target.IsShape(scalar.ScalarString()) || d2target.IsRowShape(scalar.ScalarString())
 		_, isArrowhead := d2target.Arrowheads[scalar.ScalarString()]
 		if !in && !isArrowhead {
-			c.errorf(scalar, "unknown shape %q", scalar.ScalarString())
+			e := c.codeErrorf(d2ast.DIAGNOSTIC_UNKNOWN_SHAPE, scalar, "unknown shape %q", scalar.ScalarString())
+			e.Fix = suggest(e.Range, scalar.ScalarString(), d2target.Shapes, "shape")
 			return
 		}
 		attrs.Shape.Value = scalar.ScalarString()
@@ -518,9 +791,14 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 		}
 		attrs.Shape.MapKey = f.LastPrimaryKey()
 	case "icon":
-		iconURL, err := url.Parse(scalar.ScalarString())
+		icon, err := c.resolveIcon(scalar.ScalarString(), scalar.GetRange().Path)
+		if err != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "bad icon %#v: %s", scalar.ScalarString(), err)
+			return
+		}
+		iconURL, err := url.Parse(icon)
 		if err != nil {
-			c.errorf(scalar, "bad icon url %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "bad icon url %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		attrs.Icon = iconURL
@@ -528,11 +806,12 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "near":
 		nearKey, err := d2parser.ParseKey(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "bad near key %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, scalar, "bad near key %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		nearKey.Range = scalar.GetRange()
 		attrs.NearKey = nearKey
+		c.compileNearOptions(attrs, f)
 	case "tooltip":
 		attrs.Tooltip = &d2graph.Scalar{}
 		attrs.Tooltip.Value = scalar.ScalarString()
@@ -540,7 +819,7 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "width":
 		_, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer width %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer width %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		attrs.WidthAttr = &d2graph.Scalar{}
@@ -549,7 +828,7 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "height":
 		_, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer height %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer height %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		attrs.HeightAttr = &d2graph.Scalar{}
@@ -558,11 +837,11 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "top":
 		v, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer top %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer top %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		if v < 0 {
-			c.errorf(scalar, "top must be a non-negative integer: %#v", scalar.ScalarString())
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "top must be a non-negative integer: %#v", scalar.ScalarString())
 			return
 		}
 		attrs.Top = &d2graph.Scalar{}
@@ -571,11 +850,11 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "left":
 		v, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer left %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer left %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		if v < 0 {
-			c.errorf(scalar, "left must be a non-negative integer: %#v", scalar.ScalarString())
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "left must be a non-negative integer: %#v", scalar.ScalarString())
 			return
 		}
 		attrs.Left = &d2graph.Scalar{}
@@ -585,10 +864,101 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 		attrs.Link = &d2graph.Scalar{}
 		attrs.Link.Value = scalar.ScalarString()
 		attrs.Link.MapKey = f.LastPrimaryKey()
+	case "hidden":
+		v, err := strconv.ParseBool(scalar.ScalarString())
+		if err != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, `expected "hidden" to be true or false`)
+			return
+		}
+		attrs.Hidden = &d2graph.Scalar{}
+		attrs.Hidden.Value = strconv.FormatBool(v)
+		attrs.Hidden.MapKey = f.LastPrimaryKey()
+	case "collapsed":
+		v, err := strconv.ParseBool(scalar.ScalarString())
+		if err != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, `expected "collapsed" to be true or false`)
+			return
+		}
+		attrs.Collapsed = &d2graph.Scalar{}
+		attrs.Collapsed.Value = strconv.FormatBool(v)
+		attrs.Collapsed.MapKey = f.LastPrimaryKey()
+	case "direction-mirror":
+		v, err := strconv.ParseBool(scalar.ScalarString())
+		if err != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, `expected "direction-mirror" to be true or false`)
+			return
+		}
+		attrs.DirectionMirror = &d2graph.Scalar{}
+		attrs.DirectionMirror.Value = strconv.FormatBool(v)
+		attrs.DirectionMirror.MapKey = f.LastPrimaryKey()
+	case "straighten":
+		v, err := strconv.ParseBool(scalar.ScalarString())
+		if err != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, `expected "straighten" to be true or false`)
+			return
+		}
+		attrs.Straighten = &d2graph.Scalar{}
+		attrs.Straighten.Value = strconv.FormatBool(v)
+		attrs.Straighten.MapKey = f.LastPrimaryKey()
+	case "min-length":
+		v, err := strconv.Atoi(scalar.ScalarString())
+		if err != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer min-length %#v: %s", scalar.ScalarString(), err)
+			return
+		}
+		if v < 1 {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "min-length must be a positive number of ranks: %#v", scalar.ScalarString())
+			return
+		}
+		attrs.MinLength = &d2graph.Scalar{}
+		attrs.MinLength.Value = scalar.ScalarString()
+		attrs.MinLength.MapKey = f.LastPrimaryKey()
+	case "max-rows":
+		v, err := strconv.Atoi(scalar.ScalarString())
+		if err != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer max-rows %#v: %s", scalar.ScalarString(), err)
+			return
+		}
+		if v < 1 {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "max-rows must be a positive number of rows: %#v", scalar.ScalarString())
+			return
+		}
+		attrs.MaxRows = &d2graph.Scalar{}
+		attrs.MaxRows.Value = scalar.ScalarString()
+		attrs.MaxRows.MapKey = f.LastPrimaryKey()
+	case "stereotype":
+		attrs.Stereotype = &d2graph.Scalar{}
+		attrs.Stereotype.Value = scalar.ScalarString()
+		attrs.Stereotype.MapKey = f.LastPrimaryKey()
+	case "group-by":
+		if !strings.EqualFold(scalar.ScalarString(), "visibility") {
+			c.errorf(scalar, `"group-by" must be "visibility", got %#v`, scalar.ScalarString())
+			return
+		}
+		attrs.GroupBy = &d2graph.Scalar{}
+		attrs.GroupBy.Value = scalar.ScalarString()
+		attrs.GroupBy.MapKey = f.LastPrimaryKey()
+	case "modifier":
+		modifiers := []string{"static", "abstract"}
+		if !go2.Contains(modifiers, strings.ToLower(scalar.ScalarString())) {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, `"modifier" must be one of %v, got %#v`, strings.Join(modifiers, ", "), scalar.ScalarString())
+			return
+		}
+		attrs.Modifier = &d2graph.Scalar{}
+		attrs.Modifier.Value = scalar.ScalarString()
+		attrs.Modifier.MapKey = f.LastPrimaryKey()
+	case "shape-src":
+		attrs.ShapeSrc = &d2graph.Scalar{}
+		attrs.ShapeSrc.Value = scalar.ScalarString()
+		attrs.ShapeSrc.MapKey = f.LastPrimaryKey()
+	case "board":
+		attrs.Board = &d2graph.Scalar{}
+		attrs.Board.Value = scalar.ScalarString()
+		attrs.Board.MapKey = f.LastPrimaryKey()
 	case "direction":
-		dirs := []string{"up", "down", "right", "left"}
+		dirs := []string{"up", "down", "right", "left", "auto"}
 		if !go2.Contains(dirs, scalar.ScalarString()) {
-			c.errorf(scalar, `direction must be one of %v, got %q`, strings.Join(dirs, ", "), scalar.ScalarString())
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, `direction must be one of %v, got %q`, strings.Join(dirs, ", "), scalar.ScalarString())
 			return
 		}
 		attrs.Direction.Value = scalar.ScalarString()
@@ -602,11 +972,11 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "grid-rows":
 		v, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer grid-rows %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer grid-rows %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		if v <= 0 {
-			c.errorf(scalar, "grid-rows must be a positive integer: %#v", scalar.ScalarString())
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "grid-rows must be a positive integer: %#v", scalar.ScalarString())
 			return
 		}
 		attrs.GridRows = &d2graph.Scalar{}
@@ -615,11 +985,11 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "grid-columns":
 		v, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer grid-columns %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer grid-columns %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		if v <= 0 {
-			c.errorf(scalar, "grid-columns must be a positive integer: %#v", scalar.ScalarString())
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "grid-columns must be a positive integer: %#v", scalar.ScalarString())
 			return
 		}
 		attrs.GridColumns = &d2graph.Scalar{}
@@ -628,11 +998,11 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "grid-gap":
 		v, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer grid-gap %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer grid-gap %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		if v < 0 {
-			c.errorf(scalar, "grid-gap must be a non-negative integer: %#v", scalar.ScalarString())
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "grid-gap must be a non-negative integer: %#v", scalar.ScalarString())
 			return
 		}
 		attrs.GridGap = &d2graph.Scalar{}
@@ -641,11 +1011,11 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "vertical-gap":
 		v, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer vertical-gap %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer vertical-gap %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		if v < 0 {
-			c.errorf(scalar, "vertical-gap must be a non-negative integer: %#v", scalar.ScalarString())
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "vertical-gap must be a non-negative integer: %#v", scalar.ScalarString())
 			return
 		}
 		attrs.VerticalGap = &d2graph.Scalar{}
@@ -654,11 +1024,11 @@ func (c *compiler) compileReserved(attrs *d2graph.Attributes, f *d2ir.Field) {
 	case "horizontal-gap":
 		v, err := strconv.Atoi(scalar.ScalarString())
 		if err != nil {
-			c.errorf(scalar, "non-integer horizontal-gap %#v: %s", scalar.ScalarString(), err)
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "non-integer horizontal-gap %#v: %s", scalar.ScalarString(), err)
 			return
 		}
 		if v < 0 {
-			c.errorf(scalar, "horizontal-gap must be a non-negative integer: %#v", scalar.ScalarString())
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, "horizontal-gap must be a non-negative integer: %#v", scalar.ScalarString())
 			return
 		}
 		attrs.HorizontalGap = &d2graph.Scalar{}
@@ -685,7 +1055,8 @@ func (c *compiler) compileStyle(attrs *d2graph.Attributes, m *d2ir.Map) {
 
 func (c *compiler) compileStyleField(attrs *d2graph.Attributes, f *d2ir.Field) {
 	if _, ok := d2graph.StyleKeywords[strings.ToLower(f.Name)]; !ok {
-		c.errorf(f.LastRef().AST(), `invalid style keyword: "%s"`, f.Name)
+		e := c.codeErrorf(d2ast.DIAGNOSTIC_UNKNOWN_STYLE, f.LastRef().AST(), `invalid style keyword: "%s"`, f.Name)
+		e.Fix = suggest(e.Range, f.Name, styleKeywords(), "style keyword")
 		return
 	}
 	if f.Primary() == nil {
@@ -695,7 +1066,7 @@ func (c *compiler) compileStyleField(attrs *d2graph.Attributes, f *d2ir.Field) {
 	scalar := f.Primary().Value
 	err := attrs.Style.Apply(f.Name, scalar.ScalarString())
 	if err != nil {
-		c.errorf(scalar, err.Error())
+		c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, err.Error())
 		return
 	}
 }
@@ -750,6 +1121,20 @@ func compileStyleFieldInit(attrs *d2graph.Attributes, f *d2ir.Field) {
 		attrs.Style.DoubleBorder = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
 	case "text-transform":
 		attrs.Style.TextTransform = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
+	case "text-align":
+		attrs.Style.TextAlign = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
+	case "text-direction":
+		attrs.Style.TextDirection = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
+	case "latex-scale":
+		attrs.Style.LatexScale = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
+	case "border-style":
+		attrs.Style.BorderStyle = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
+	case "header":
+		attrs.Style.Header = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
+	case "bundle":
+		attrs.Style.Bundle = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
+	case "layer-group":
+		attrs.Style.LayerGroup = &d2graph.Scalar{MapKey: f.LastPrimaryKey()}
 	}
 }
 
@@ -760,6 +1145,7 @@ func (c *compiler) compileEdge(obj *d2graph.Object, e *d2ir.Edge) {
 		return
 	}
 
+	c.compileClassArrowheads(edge, d2ir.ParentMap(e))
 	if e.Primary() != nil {
 		c.compileLabel(&edge.Attributes, e)
 	}
@@ -784,6 +1170,78 @@ func (c *compiler) compileEdge(obj *d2graph.Object, e *d2ir.Edge) {
 	}
 }
 
+// compileClassArrowheads gives edge the source-arrowhead of the classes of its source and
+// the target-arrowhead of the classes of its target, which its own arrowheads override.
+func (c *compiler) compileClassArrowheads(edge *d2graph.Edge, m *d2ir.Map) {
+	for _, className := range edge.Src.Classes {
+		for _, classMap := range c.classMaps(m, className) {
+			if f := classMap.GetField("source-arrowhead"); f != nil {
+				c.compileArrowheads(edge, f)
+			}
+		}
+	}
+	for _, className := range edge.Dst.Classes {
+		for _, classMap := range c.classMaps(m, className) {
+			if f := classMap.GetField("target-arrowhead"); f != nil {
+				c.compileArrowheads(edge, f)
+			}
+		}
+	}
+}
+
+// classMaps returns the map of the class name after the maps of the classes it extends, in
+// the order they're applied: a class overrides the classes it extends, which override each
+// other in the order they're listed. Each class is only applied once.
+func (c *compiler) classMaps(m *d2ir.Map, name string) []*d2ir.Map {
+	var maps []*d2ir.Map
+	seen := make(map[string]struct{})
+	var visit func(name string)
+	visit = func(name string) {
+		if _, ok := seen[name]; ok {
+			return
+		}
+		seen[name] = struct{}{}
+		classMap := m.GetClassMap(name)
+		if classMap == nil {
+			return
+		}
+		for _, parent := range classExtends(classMap.GetField("extends")) {
+			visit(parent)
+		}
+		maps = append(maps, classMap)
+	}
+	visit(name)
+	return maps
+}
+
+// classExtends returns the names of the classes the extends field of a class lists, like
+// extends: [service; persistent]. Names can also be separated by commas.
+func classExtends(f *d2ir.Field) []string {
+	if f == nil {
+		return nil
+	}
+	var values []string
+	if f.Primary() != nil {
+		values = append(values, f.Primary().Value.ScalarString())
+	} else if arr, ok := f.Composite.(*d2ir.Array); ok {
+		for _, v := range arr.Values {
+			if scalar, ok := v.(*d2ir.Scalar); ok {
+				values = append(values, scalar.Value.ScalarString())
+			}
+		}
+	}
+	var names []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
 func (c *compiler) compileEdgeMap(edge *d2graph.Edge, m *d2ir.Map) {
 	class := m.GetField("class")
 	if class != nil {
@@ -805,13 +1263,16 @@ func (c *compiler) compileEdgeMap(edge *d2graph.Edge, m *d2ir.Map) {
 		}
 
 		for _, className := range classNames {
-			classMap := m.GetClassMap(className)
-			if classMap != nil {
+			for _, classMap := range c.classMaps(m, className) {
 				c.compileEdgeMap(edge, classMap)
 			}
 		}
 	}
+	isClass := m.IsClass()
 	for _, f := range m.Fields {
+		if isClass && f.Name == "extends" {
+			continue
+		}
 		_, ok := d2graph.ReservedKeywords[f.Name]
 		if !ok {
 			c.errorf(f.References[0].AST(), `edge map keys must be reserved keywords`)
@@ -828,6 +1289,14 @@ func (c *compiler) compileEdgeField(edge *d2graph.Edge, f *d2ir.Field) {
 		c.errorf(f.LastRef().AST(), "%v must be style.%v", f.Name, f.Name)
 		return
 	}
+	if keyword == "source-label" || keyword == "target-label" {
+		c.compileEndLabel(edge, f)
+		return
+	}
+	if keyword == "assert" {
+		c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastRef().AST(), `"assert" can only be set on shapes and boards`)
+		return
+	}
 	_, isReserved := d2graph.SimpleReservedKeywords[keyword]
 	if isReserved {
 		c.compileReserved(&edge.Attributes, f)
@@ -837,6 +1306,12 @@ func (c *compiler) compileEdgeField(edge *d2graph.Edge, f *d2ir.Field) {
 			return
 		}
 		c.compileStyle(&edge.Attributes, f.Map())
+		if edge.Style.FontSize != nil && edge.Style.FontSize.Value == d2graph.AUTO_FONT_SIZE {
+			c.errorf(edge.Style.FontSize.MapKey, `"font-size: auto" can only be applied to shapes`)
+		}
+		if edge.Style.Bundle != nil {
+			c.errorf(edge.Style.Bundle.MapKey, `key "bundle" can only be applied to shapes`)
+		}
 		return
 	}
 
@@ -845,6 +1320,65 @@ func (c *compiler) compileEdgeField(edge *d2graph.Edge, f *d2ir.Field) {
 	}
 }
 
+// compileCode compiles the options of code shapes, like code.line-numbers. Only code has them,
+// so "code" is an ordinary name anywhere else.
+func (c *compiler) compileCode(attrs *d2graph.Attributes, f *d2ir.Field) {
+	if f.Map() == nil || len(f.Map().Fields) == 0 {
+		c.errorf(f.LastRef().AST(), `"code" expected to be set to a map of key-values, or contain an additional keyword like "code.line-numbers: true"`)
+		return
+	}
+	for _, f := range f.Map().Fields {
+		if f.Primary() == nil {
+			c.errorf(f.LastRef().AST(), `invalid "code" field`)
+			continue
+		}
+		scalar := f.Primary().Value
+		switch strings.ToLower(f.Name) {
+		case "line-numbers":
+			if _, err := strconv.ParseBool(scalar.ScalarString()); err != nil {
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, scalar, `expected "code.line-numbers" to be boolean`)
+				continue
+			}
+			attrs.LineNumbers = &d2graph.Scalar{Value: scalar.ScalarString(), MapKey: f.LastPrimaryKey()}
+		case "highlight":
+			lines, err := d2target.ParseLineRanges(scalar.ScalarString())
+			if err != nil {
+				c.errorf(scalar, `invalid "code.highlight": %s`, err)
+				continue
+			}
+			if n := strings.Count(attrs.Label.Value, "\n") + 1; lines[len(lines)-1] > n {
+				c.errorf(scalar, `"code.highlight" goes past the last line, %d`, n)
+				continue
+			}
+			attrs.HighlightLines = &d2graph.Scalar{Value: scalar.ScalarString(), MapKey: f.LastPrimaryKey()}
+		default:
+			c.errorf(f.LastRef().AST(), `"code" keys are "line-numbers" and "highlight", got %#v`, f.Name)
+		}
+	}
+}
+
+// compileEndLabel compiles source-label and target-label, which label the ends of a connection.
+// They're the labels of its arrowheads, so they're placed the same, with or without arrowheads.
+func (c *compiler) compileEndLabel(edge *d2graph.Edge, f *d2ir.Field) {
+	if f.Primary() == nil {
+		c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastRef().AST(), `%#v must be set to a label`, f.Name)
+		return
+	}
+	var attrs *d2graph.Attributes
+	if f.Name == "source-label" {
+		if edge.SrcArrowhead == nil {
+			edge.SrcArrowhead = &d2graph.Attributes{}
+		}
+		attrs = edge.SrcArrowhead
+	} else {
+		if edge.DstArrowhead == nil {
+			edge.DstArrowhead = &d2graph.Attributes{}
+		}
+		attrs = edge.DstArrowhead
+	}
+	c.compileLabel(attrs, f)
+}
+
 func (c *compiler) compileArrowheads(edge *d2graph.Edge, f *d2ir.Field) {
 	var attrs *d2graph.Attributes
 	if f.Name == "source-arrowhead" {
@@ -867,7 +1401,10 @@ func (c *compiler) compileArrowheads(edge *d2graph.Edge, f *d2ir.Field) {
 		for _, f2 := range f.Map().Fields {
 			keyword := strings.ToLower(f2.Name)
 			_, isReserved := d2graph.SimpleReservedKeywords[keyword]
-			if isReserved {
+			if keyword == "source-label" || keyword == "target-label" {
+				c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f2.LastRef().AST(), `%#v can only be used on connections`, f2.Name)
+				continue
+			} else if isReserved {
 				c.compileReserved(attrs, f2)
 				continue
 			} else if f2.Name == "style" {
@@ -898,7 +1435,45 @@ var FullToShortLanguageAliases map[string]string
 
 func (c *compiler) compileClass(obj *d2graph.Object) {
 	obj.Class = &d2target.Class{}
+	if obj.Stereotype != nil {
+		obj.Class.Stereotype = obj.Stereotype.Value
+	}
+	// Header and separator rows go with the members after them, so they stay in declaration order
+	// even though fields are drawn before methods
+	var pending []*d2graph.Object
+	flush := func(methods bool) {
+		for _, f := range pending {
+			name := ""
+			if strings.EqualFold(f.Shape.Value, d2target.ShapeRowHeader) {
+				name = f.Label.Value
+			}
+			shape := strings.ToLower(f.Shape.Value)
+			if methods {
+				obj.Class.Methods = append(obj.Class.Methods, d2target.ClassMethod{Name: name, Shape: shape})
+			} else {
+				obj.Class.Fields = append(obj.Class.Fields, d2target.ClassField{Name: name, Shape: shape})
+			}
+		}
+		pending = nil
+	}
 	for _, f := range obj.ChildrenArray {
+		if strings.EqualFold(f.Shape.Value, d2target.ShapeRowIndex) {
+			c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.Shape.MapKey, "shape %q can only be used on sql_table columns", f.Shape.Value)
+			continue
+		}
+		if d2target.IsRowShape(f.Shape.Value) {
+			if obj.GroupBy != nil {
+				c.errorf(f.Shape.MapKey, `header and separator rows can't be used with "group-by"`)
+				continue
+			}
+			pending = append(pending, f)
+			continue
+		}
+		var static, abstract bool
+		if f.Modifier != nil {
+			static = strings.EqualFold(f.Modifier.Value, "static")
+			abstract = strings.EqualFold(f.Modifier.Value, "abstract")
+		}
 		visibility := "public"
 		name := f.IDVal
 		// See https://www.uml-diagrams.org/visibility.html
@@ -916,6 +1491,7 @@ func (c *compiler) compileClass(obj *d2graph.Object) {
 		}
 
 		if !strings.Contains(f.IDVal, "(") {
+			flush(false)
 			typ := f.Label.Value
 			if typ == f.IDVal {
 				typ = ""
@@ -924,10 +1500,13 @@ func (c *compiler) compileClass(obj *d2graph.Object) {
 				Name:       name,
 				Type:       typ,
 				Visibility: visibility,
+				Static:     static,
+				Abstract:   abstract,
 			})
 		} else {
 			// TODO: Not great, AST should easily allow specifying alternate primary field
 			// as an explicit label should change the name.
+			flush(true)
 			returnType := f.Label.Value
 			if returnType == f.IDVal {
 				returnType = "void"
@@ -936,9 +1515,20 @@ func (c *compiler) compileClass(obj *d2graph.Object) {
 				Name:       name,
 				Return:     returnType,
 				Visibility: visibility,
+				Static:     static,
+				Abstract:   abstract,
 			})
 		}
 	}
+	flush(len(obj.Class.Methods) > 0)
+	if obj.GroupBy != nil {
+		obj.Class.Fields = groupByVisibility(obj.Class.Fields, func(f d2target.ClassField) string {
+			return f.Visibility
+		}, d2target.ClassField{Shape: d2target.ShapeRowSeparator})
+		obj.Class.Methods = groupByVisibility(obj.Class.Methods, func(m d2target.ClassMethod) string {
+			return m.Visibility
+		}, d2target.ClassMethod{Shape: d2target.ShapeRowSeparator})
+	}
 
 	for _, ch := range obj.ChildrenArray {
 		for i := 0; i < len(obj.Graph.Objects); i++ {
@@ -952,8 +1542,53 @@ func (c *compiler) compileClass(obj *d2graph.Object) {
 	obj.ChildrenArray = nil
 }
 
+// groupByVisibility orders class members public, protected, then private, keeping their order
+// within each, with separators between the groups
+func groupByVisibility[T any](members []T, visibility func(T) string, separator T) []T {
+	var grouped []T
+	for _, v := range []string{"public", "protected", "private"} {
+		start := len(grouped)
+		for _, m := range members {
+			if visibility(m) == v {
+				grouped = append(grouped, m)
+			}
+		}
+		if start > 0 && len(grouped) > start {
+			grouped = append(grouped[:start], append([]T{separator}, grouped[start:]...)...)
+		}
+	}
+	return grouped
+}
+
+// compileCustomShape reads the SVG of a custom shape. Like icons, paths like "./hexgear.svg"
+// are relative to the file they're written in.
+func (c *compiler) compileCustomShape(obj *d2graph.Object) {
+	if obj.ShapeSrc == nil {
+		c.errorf(obj.Shape.MapKey, `custom shapes need a "shape-src" SVG`)
+		return
+	}
+	p := obj.ShapeSrc.Value
+	if strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") {
+		p = path.Join(path.Dir(obj.ShapeSrc.MapKey.Range.Path), p)
+	}
+	b, err := c.readFile(p)
+	if err != nil {
+		c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, obj.ShapeSrc.MapKey, "bad shape-src %#v: %s", obj.ShapeSrc.Value, err)
+		return
+	}
+	def, err := shape.ParseCustomSVG(b)
+	if err != nil {
+		c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, obj.ShapeSrc.MapKey, "bad shape-src %#v: %s", obj.ShapeSrc.Value, err)
+		return
+	}
+	obj.CustomShape = def
+}
+
 func (c *compiler) compileSQLTable(obj *d2graph.Object) {
 	obj.SQLTable = &d2target.SQLTable{}
+	if obj.MaxRows != nil {
+		obj.SQLTable.MaxRows, _ = strconv.Atoi(obj.MaxRows.Value)
+	}
 	for _, col := range obj.ChildrenArray {
 		typ := col.Label.Value
 		if typ == col.IDVal {
@@ -961,11 +1596,32 @@ func (c *compiler) compileSQLTable(obj *d2graph.Object) {
 			// as an explicit label should change the name.
 			typ = ""
 		}
+		if col.Modifier != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, col.Modifier.MapKey, `"modifier" can only be set on class members`)
+		}
+		if strings.EqualFold(col.Shape.Value, d2target.ShapeRowIndex) {
+			obj.SQLTable.Indexes = append(obj.SQLTable.Indexes, d2target.SQLIndex{
+				Name:    d2target.Text{Label: col.IDVal},
+				Columns: d2target.Text{Label: typ},
+			})
+			continue
+		}
 		d2Col := d2target.SQLColumn{
 			Name:       d2target.Text{Label: col.IDVal},
 			Type:       d2target.Text{Label: typ},
 			Constraint: col.Constraint,
 		}
+		switch strings.ToLower(col.Shape.Value) {
+		case d2target.ShapeRowHeader:
+			d2Col = d2target.SQLColumn{
+				Name:  d2target.Text{Label: col.Label.Value},
+				Shape: d2target.ShapeRowHeader,
+			}
+		case d2target.ShapeRowSeparator:
+			d2Col = d2target.SQLColumn{
+				Shape: d2target.ShapeRowSeparator,
+			}
+		}
 		obj.SQLTable.Columns = append(obj.SQLTable.Columns, d2Col)
 	}
 
@@ -981,6 +1637,15 @@ func (c *compiler) compileSQLTable(obj *d2graph.Object) {
 	obj.ChildrenArray = nil
 }
 
+// canDoubleBorder returns whether obj's shape can be drawn with a double border
+func canDoubleBorder(obj *d2graph.Object) bool {
+	switch strings.ToLower(obj.Shape.Value) {
+	case "", d2target.ShapeSquare, d2target.ShapeRectangle, d2target.ShapeCircle, d2target.ShapeOval, d2target.ShapeDiamond:
+		return true
+	}
+	return false
+}
+
 func (c *compiler) validateKeys(obj *d2graph.Object, m *d2ir.Map) {
 	for _, f := range m.Fields {
 		if _, ok := d2graph.BoardKeywords[f.Name]; ok {
@@ -996,7 +1661,7 @@ func (c *compiler) validateKey(obj *d2graph.Object, f *d2ir.Field) {
 	if isReserved {
 		switch obj.Shape.Value {
 		case d2target.ShapeCircle, d2target.ShapeSquare:
-			checkEqual := (keyword == "width" && obj.HeightAttr != nil) || (keyword == "height" && obj.WidthAttr != nil)
+			checkEqual := (keyword == "width" || keyword == "height") && obj.WidthAttr != nil && obj.HeightAttr != nil
 			if checkEqual && obj.WidthAttr.Value != obj.HeightAttr.Value {
 				c.errorf(f.LastPrimaryKey(), "width and height must be equal for %s shapes", obj.Shape.Value)
 			}
@@ -1009,9 +1674,22 @@ func (c *compiler) validateKey(obj *d2graph.Object, f *d2ir.Field) {
 					c.errorf(obj.Style.ThreeDee.MapKey, `key "3d" can only be applied to squares, rectangles, and hexagons`)
 				}
 			}
-			if obj.Style.DoubleBorder != nil {
-				if obj.Shape.Value != "" && !strings.EqualFold(obj.Shape.Value, d2target.ShapeSquare) && !strings.EqualFold(obj.Shape.Value, d2target.ShapeRectangle) && !strings.EqualFold(obj.Shape.Value, d2target.ShapeCircle) && !strings.EqualFold(obj.Shape.Value, d2target.ShapeOval) {
-					c.errorf(obj.Style.DoubleBorder.MapKey, `key "double-border" can only be applied to squares, rectangles, circles, ovals`)
+			if obj.Style.DoubleBorder != nil && !canDoubleBorder(obj) {
+				c.errorf(obj.Style.DoubleBorder.MapKey, `key "double-border" can only be applied to squares, rectangles, circles, ovals, diamonds`)
+			}
+			if obj.Style.BorderStyle != nil && strings.EqualFold(obj.Style.BorderStyle.Value, "double") && !canDoubleBorder(obj) {
+				c.errorf(obj.Style.BorderStyle.MapKey, `"border-style: double" can only be applied to squares, rectangles, circles, ovals, diamonds`)
+			}
+			if obj.Style.Header != nil {
+				if obj.Shape.Value != "" && !strings.EqualFold(obj.Shape.Value, d2target.ShapeSquare) && !strings.EqualFold(obj.Shape.Value, d2target.ShapeRectangle) {
+					c.errorf(obj.Style.Header.MapKey, `key "header" can only be applied to squares and rectangles`)
+				}
+			}
+			if obj.Style.FontSize != nil && obj.Style.FontSize.Value == d2graph.AUTO_FONT_SIZE {
+				if strings.EqualFold(obj.Shape.Value, d2target.ShapeSQLTable) || strings.EqualFold(obj.Shape.Value, d2target.ShapeClass) {
+					c.errorf(obj.Style.FontSize.MapKey, `"font-size: auto" cannot be applied to %s shapes`, obj.Shape.Value)
+				} else if obj.WidthAttr == nil && obj.HeightAttr == nil {
+					c.errorf(obj.Style.FontSize.MapKey, `"font-size: auto" needs the shape to have a width or height`)
 				}
 			}
 		case "shape":
@@ -1024,9 +1702,38 @@ func (c *compiler) validateKey(obj *d2graph.Object, f *d2ir.Field) {
 			if !in && arrowheadIn {
 				c.errorf(f.LastPrimaryKey(), fmt.Sprintf(`invalid shape, can only set "%s" for arrowheads`, obj.Shape.Value))
 			}
+		case "direction-mirror":
+			if obj != obj.Graph.Root {
+				c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `"direction-mirror" can only be set on the root of a board`)
+			}
+		case "straighten", "min-length":
+			c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `%#v can only be set on connections`, f.Name)
+		case "max-rows":
+			if !strings.EqualFold(obj.Shape.Value, d2target.ShapeSQLTable) {
+				c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `"max-rows" can only be set on sql_table shapes`)
+			}
+		case "stereotype", "group-by":
+			if !strings.EqualFold(obj.Shape.Value, d2target.ShapeClass) {
+				c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `%#v can only be set on class shapes`, f.Name)
+			}
+		case "collapsed":
+			if !obj.IsContainer() {
+				c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `"collapsed" can only be set on containers`)
+			}
+		case "shape-src":
+			if !strings.EqualFold(obj.Shape.Value, d2target.ShapeCustom) {
+				c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `"shape-src" can only be set on custom shapes`)
+			}
+		case "board":
+			if !strings.EqualFold(obj.Shape.Value, d2target.ShapeBoard) {
+				c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `"board" can only be set on board shapes`)
+			}
+		case "modifier":
+			// Class members are gone from the graph by now, so any left are elsewhere
+			c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `"modifier" can only be set on class members`)
 		case "constraint":
 			if !strings.EqualFold(obj.Shape.Value, d2target.ShapeSQLTable) {
-				c.errorf(f.LastPrimaryKey(), `"constraint" keyword can only be used in "sql_table" shapes`)
+				c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.LastPrimaryKey(), `"constraint" keyword can only be used in "sql_table" shapes`)
 			}
 		}
 		return
@@ -1036,6 +1743,10 @@ func (c *compiler) validateKey(obj *d2graph.Object, f *d2ir.Field) {
 		c.errorf(f.LastRef().AST(), "image shapes cannot have children.")
 		return
 	}
+	if strings.EqualFold(obj.Shape.Value, d2target.ShapeBoard) {
+		c.errorf(f.LastRef().AST(), "board shapes cannot have children")
+		return
+	}
 
 	obj, ok := obj.HasChild([]string{f.Name})
 	if ok && f.Map() != nil {
@@ -1043,6 +1754,54 @@ func (c *compiler) validateKey(obj *d2graph.Object, f *d2ir.Field) {
 	}
 }
 
+// compileAssert adds the assertions of every assert key of f, so that the assertions of
+// imports, classes and globs add up instead of overriding each other.
+func (c *compiler) compileAssert(obj *d2graph.Object, f *d2ir.Field) {
+	seen := make(map[*d2ast.Key]struct{})
+	for _, ref := range f.References {
+		if !ref.Primary() {
+			continue
+		}
+		key := ref.Context_.Key
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if arr := key.Value.Array; arr != nil {
+			for _, n := range arr.Nodes {
+				switch v := n.Unbox().(type) {
+				case *d2ast.Comment, *d2ast.BlockComment:
+				case d2ast.Scalar:
+					obj.Assertions = append(obj.Assertions, d2graph.Assertion{Value: v.ScalarString(), Node: v})
+				default:
+					c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_ASSERTION, key, `"assert" must be an assertion or an array of assertions`)
+				}
+			}
+		} else if v := key.Value.ScalarBox().Unbox(); v != nil {
+			obj.Assertions = append(obj.Assertions, d2graph.Assertion{Value: v.ScalarString(), Node: v})
+		} else {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_ASSERTION, key, `"assert" must be an assertion or an array of assertions`)
+		}
+	}
+}
+
+// validateAssertions checks the assertions of the objects of board g, now that it's compiled
+func (c *compiler) validateAssertions(g *d2graph.Graph) {
+	for _, obj := range append([]*d2graph.Object{g.Root}, g.Objects...) {
+		for _, a := range obj.Assertions {
+			if err := obj.CheckAssertion(a.Value); err != nil {
+				code := d2ast.DIAGNOSTIC_INVALID_ASSERTION
+				var afe *d2graph.AssertionFailedError
+				if errors.As(err, &afe) {
+					code = d2ast.DIAGNOSTIC_ASSERTION_FAILED
+				}
+				c.codeErrorf(code, a.Node, "%v", err)
+			}
+		}
+	}
+}
+
 func (c *compiler) validateLabels(g *d2graph.Graph) {
 	for _, obj := range g.Objects {
 		if !strings.EqualFold(obj.Shape.Value, d2target.ShapeText) {
@@ -1074,7 +1833,7 @@ func (c *compiler) validateNear(g *d2graph.Graph) {
 					}
 				}
 				if nearIsAncestor {
-					c.errorf(obj.NearKey, "near keys cannot be set to an ancestor")
+					c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, obj.NearKey, "near keys cannot be set to an ancestor")
 					continue
 				}
 				nearIsDescendant := false
@@ -1085,35 +1844,43 @@ func (c *compiler) validateNear(g *d2graph.Graph) {
 					}
 				}
 				if nearIsDescendant {
-					c.errorf(obj.NearKey, "near keys cannot be set to an descendant")
+					c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, obj.NearKey, "near keys cannot be set to an descendant")
 					continue
 				}
 				if nearObj.OuterSequenceDiagram() != nil {
-					c.errorf(obj.NearKey, "near keys cannot be set to an object within sequence diagrams")
+					c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, obj.NearKey, "near keys cannot be set to an object within sequence diagrams")
 					continue
 				}
 				if nearObj.NearKey != nil {
 					_, nearObjNearIsConst := d2graph.NearConstants[d2graph.Key(nearObj.NearKey)[0]]
 					if nearObjNearIsConst {
-						c.errorf(obj.NearKey, "near keys cannot be set to an object with a constant near key")
+						c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, obj.NearKey, "near keys cannot be set to an object with a constant near key")
 						continue
 					}
 				}
 				if nearObj.ClosestGridDiagram() != nil {
-					c.errorf(obj.NearKey, "near keys cannot be set to descendants of special objects, like grid cells")
+					c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, obj.NearKey, "near keys cannot be set to descendants of special objects, like grid cells")
 					continue
 				}
 				if nearObj.OuterSequenceDiagram() != nil {
-					c.errorf(obj.NearKey, "near keys cannot be set to descendants of special objects, like sequence diagram actors")
+					c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, obj.NearKey, "near keys cannot be set to descendants of special objects, like sequence diagram actors")
 					continue
 				}
 			} else if isConst {
 				if obj.Parent != g.Root {
-					c.errorf(obj.NearKey, "constant near keys can only be set on root level shapes")
+					c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, obj.NearKey, "constant near keys can only be set on root level shapes")
+					continue
+				}
+				if obj.NearSide != nil {
+					c.errorf(obj.NearSide.MapKey, `"side" can only be set when near is another object`)
+					continue
+				}
+				if obj.NearGap != nil {
+					c.errorf(obj.NearGap.MapKey, `"gap" can only be set when near is another object`)
 					continue
 				}
 			} else {
-				c.errorf(obj.NearKey, "near key %#v must be the absolute path to a shape or one of the following constants: %s", d2format.Format(obj.NearKey), strings.Join(d2graph.NearConstantsArray, ", "))
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_NEAR, obj.NearKey, "near key %#v must be the absolute path to a shape or one of the following constants: %s", d2format.Format(obj.NearKey), strings.Join(d2graph.NearConstantsArray, ", "))
 				continue
 			}
 		}
@@ -1138,13 +1905,13 @@ func (c *compiler) validatePositionsCompatibility(g *d2graph.Graph) {
 			if pos != nil {
 				if o.Parent != nil {
 					if strings.EqualFold(o.Parent.Shape.Value, d2target.ShapeHierarchy) {
-						c.errorf(pos.MapKey, `position keywords cannot be used with shape "hierarchy"`)
+						c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, pos.MapKey, `position keywords cannot be used with shape "hierarchy"`)
 					}
 					if o.OuterSequenceDiagram() != nil {
-						c.errorf(pos.MapKey, `position keywords cannot be used inside shape "sequence_diagram"`)
+						c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, pos.MapKey, `position keywords cannot be used inside shape "sequence_diagram"`)
 					}
 					if o.Parent.GridColumns != nil || o.Parent.GridRows != nil {
-						c.errorf(pos.MapKey, `position keywords cannot be used with grids`)
+						c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, pos.MapKey, `position keywords cannot be used with grids`)
 					}
 				}
 			}
@@ -1201,10 +1968,23 @@ func (c *compiler) validateBoardLinks(g *d2graph.Graph) {
 		}
 
 		if !hasBoard(g.RootBoard(), linkKey.IDA()) {
-			c.errorf(obj.Link.MapKey, "linked board not found")
+			c.codeErrorf(d2ast.DIAGNOSTIC_BOARD_NOT_FOUND, obj.Link.MapKey, "linked board not found")
 			continue
 		}
 	}
+	for _, obj := range g.Objects {
+		if obj.Board == nil {
+			continue
+		}
+		boardKey, err := d2parser.ParseKey(obj.Board.Value)
+		if err != nil || boardKey.Path[0].Unbox().ScalarString() != "root" {
+			c.errorf(obj.Board.MapKey, `"board" must be the path of a board, like layers.details`)
+			continue
+		}
+		if !hasBoard(g.RootBoard(), boardKey.IDA()) {
+			c.codeErrorf(d2ast.DIAGNOSTIC_BOARD_NOT_FOUND, obj.Board.MapKey, "embedded board not found")
+		}
+	}
 	for _, b := range g.Layers {
 		c.validateBoardLinks(b)
 	}
@@ -1216,6 +1996,61 @@ func (c *compiler) validateBoardLinks(g *d2graph.Graph) {
 	}
 }
 
+// validateBoardEmbeds checks that no board embeds itself, directly or through the boards it
+// embeds, since it'd be drawn inside itself forever.
+func (c *compiler) validateBoardEmbeds(g *d2graph.Graph) {
+	type embed struct {
+		board string
+		obj   *d2graph.Object
+	}
+	var all []embed
+	// embeds maps the path of each board to the paths of the boards it embeds
+	embeds := make(map[string][]string)
+	var collect func(b *d2graph.Graph, ida []string)
+	collect = func(b *d2graph.Graph, ida []string) {
+		p := d2format.Format(d2ast.MakeKeyPath(ida))
+		for _, obj := range b.Objects {
+			if obj.Board != nil {
+				all = append(all, embed{p, obj})
+				embeds[p] = append(embeds[p], obj.Board.Value)
+			}
+		}
+		for _, boards := range []struct {
+			keyword string
+			boards  []*d2graph.Graph
+		}{{"layers", b.Layers}, {"scenarios", b.Scenarios}, {"steps", b.Steps}} {
+			for _, child := range boards.boards {
+				collect(child, append(append([]string(nil), ida...), boards.keyword, child.Name))
+			}
+		}
+	}
+	collect(g, []string{"root"})
+
+	for _, e := range all {
+		if path := embedPath(embeds, e.obj.Board.Value, e.board, make(map[string]bool)); path != nil {
+			c.errorf(e.obj.Board.MapKey, "board %s embeds itself: %s", e.board, strings.Join(append([]string{e.board}, path...), " -> "))
+		}
+	}
+}
+
+// embedPath returns the boards from one board to another through the boards they embed, or nil
+// if the other board isn't embedded.
+func embedPath(embeds map[string][]string, from, to string, seen map[string]bool) []string {
+	if from == to {
+		return []string{to}
+	}
+	if seen[from] {
+		return nil
+	}
+	seen[from] = true
+	for _, next := range embeds[from] {
+		if path := embedPath(embeds, next, to, seen); path != nil {
+			return append([]string{from}, path...)
+		}
+	}
+	return nil
+}
+
 func hasBoard(root *d2graph.Graph, ida []string) bool {
 	if len(ida) == 0 {
 		return true
@@ -1431,6 +2266,23 @@ func compileConfig(ir *d2ir.Map) (*d2target.Config, error) {
 		config.LayoutEngine = go2.Pointer(f.Primary().Value.ScalarString())
 	}
 
+	f = configMap.GetField("edge-jumps")
+	if f != nil {
+		val, _ := strconv.ParseBool(f.Primary().Value.ScalarString())
+		config.EdgeJumps = &val
+	}
+
+	f = configMap.GetField("snap")
+	if f != nil {
+		val, _ := strconv.Atoi(f.Primary().Value.ScalarString())
+		config.Snap = go2.Pointer(int64(val))
+	}
+
+	f = configMap.GetField("legend")
+	if f != nil {
+		config.Legend = go2.Pointer(f.Primary().Value.ScalarString())
+	}
+
 	f = configMap.GetField("theme-overrides")
 	if f != nil {
 		overrides, err := compileThemeOverrides(f.Map())
@@ -1460,6 +2312,10 @@ func compileThemeOverrides(m *d2ir.Map) (*d2target.ThemeOverrides, error) {
 	err := &d2parser.ParseError{}
 FOR:
 	for _, f := range m.Fields {
+		if f.Primary() == nil {
+			err.Errors = append(err.Errors, d2parser.Errorf(f.LastRef().AST(), fmt.Sprintf(`"%s" needs a value`, f.Name)).(d2ast.Error))
+			continue
+		}
 		switch strings.ToUpper(f.Name) {
 		case "N1":
 			themeOverrides.N1 = go2.Pointer(f.Primary().Value.ScalarString())
@@ -1502,7 +2358,7 @@ FOR:
 			continue FOR
 		}
 		if !go2.Contains(color.NamedColors, strings.ToLower(f.Primary().Value.ScalarString())) && !color.ColorHexRegex.MatchString(f.Primary().Value.ScalarString()) {
-			err.Errors = append(err.Errors, d2parser.Errorf(f.LastPrimaryKey(), fmt.Sprintf(`expected "%s" to be a valid named color ("orange") or a hex code ("#f0ff3a")`, f.Name)).(d2ast.Error))
+			err.Errors = append(err.Errors, d2parser.CodeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastPrimaryKey(), fmt.Sprintf(`expected "%s" to be a valid named color ("orange") or a hex code ("#f0ff3a")`, f.Name)).(d2ast.Error))
 		}
 	}
 
@@ -1515,3 +2371,58 @@ FOR:
 	}
 	return nil, nil
 }
+
+// resolveIcon inlines icons which are files as data URIs, so diagrams with them render the same
+// offline. Icons like "@aws/s3" are files of the icon directory, with or without their
+// extension. Icons like "./assets/db.svg" are files relative to the file they're written in,
+// and are left as they are if they don't exist, for renderers to resolve. Icons of the built-in
+// icon packs, like "aws/s3", are replaced with their URLs. Other icons, like URLs, are returned
+// as they are.
+func (c *compiler) resolveIcon(icon, filePath string) (string, error) {
+	if i, ok := iconpack.Lookup(icon); ok {
+		return i.URL(), nil
+	}
+
+	var candidates []string
+	switch {
+	case strings.HasPrefix(icon, "@"):
+		if c.iconDir == "" {
+			return "", errors.New("icon packs need an icon directory")
+		}
+		p := path.Join(c.iconDir, icon[1:])
+		candidates = []string{p}
+		if path.Ext(p) == "" {
+			candidates = []string{p + ".svg", p + ".png"}
+		}
+	case strings.HasPrefix(icon, "./"), strings.HasPrefix(icon, "../"):
+		candidates = []string{path.Join(path.Dir(filePath), icon)}
+	default:
+		return icon, nil
+	}
+
+	for _, p := range candidates {
+		b, err := c.readFile(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		mimeType := mime.TypeByExtension(path.Ext(p))
+		if mimeType == "" {
+			mimeType = http.DetectContentType(b)
+		}
+		return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(b)), nil
+	}
+	if strings.HasPrefix(icon, "@") {
+		return "", fmt.Errorf("not found in icon directory %s", c.iconDir)
+	}
+	return icon, nil
+}
+
+func (c *compiler) readFile(p string) ([]byte, error) {
+	if c.fs == nil {
+		return os.ReadFile(p)
+	}
+	return fs.ReadFile(c.fs, p)
+}
@@ -26,6 +26,8 @@ func TestCompile(t *testing.T) {
 		text string
 		// For tests that use imports, define `index.d2` as text and other files here
 		files map[string]string
+		// iconDir is the directory of icon packs among files
+		iconDir string
 
 		expErr     string
 		assertions func(t *testing.T, g *d2graph.Graph)
@@ -147,6 +149,16 @@ x: {
 `,
 			expErr: `d2/testdata/d2compiler/TestCompile/equal_dimensions_on_circle.d2:3:2: width and height must be equal for circle shapes
 d2/testdata/d2compiler/TestCompile/equal_dimensions_on_circle.d2:4:2: width and height must be equal for circle shapes`,
+		},
+		{
+			name: "dimension_without_value_on_circle",
+
+			text: `hey: "" {
+	shape: circle
+	width
+	height: 230
+}
+`,
 		},
 		{
 			name: "single_dimension_on_circle",
@@ -262,7 +274,469 @@ containers: {
   }
 }
 `,
-			expErr: `d2/testdata/d2compiler/TestCompile/invalid-fill-pattern.d2:3:19: expected "fill-pattern" to be one of: none, dots, lines, grain, paper`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-fill-pattern.d2:3:19: expected "fill-pattern" to be one of: none, dots, lines, grain, paper, hatch`,
+		},
+		{
+			name: "gradient-fill",
+			text: `x.style.fill: "linear-gradient(to right, #fff, #ccc 80%)"
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				if g.Objects[0].Style.Fill.Value != "linear-gradient(to right, #fff, #ccc 80%)" {
+					t.Fatalf("expected gradient fill, got %q", g.Objects[0].Style.Fill.Value)
+				}
+			},
+		},
+		{
+			name: "invalid-gradient-fill",
+			text: `x.style.fill: "linear-gradient(to right, #fff, B1)"
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-gradient-fill.d2:1:15: expected "fill" to be a valid gradient: "B1" is not a named color or a hex code`,
+		},
+		{
+			name: "header",
+			text: `x: {
+  style.header: tab
+  y
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				if g.Objects[0].Style.Header.Value != "tab" {
+					t.Fatalf("expected header tab, got %q", g.Objects[0].Style.Header.Value)
+				}
+			},
+		},
+		{
+			name: "invalid-header",
+			text: `x: {
+  style.header: banner
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-header.d2:2:17: expected "header" to be one of (band, tab)`,
+		},
+		{
+			name: "header-shape",
+			text: `x: {
+  shape: circle
+  style.header: band
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/header-shape.d2:3:3: key "header" can only be applied to squares and rectangles`,
+		},
+		{
+			name: "border-style",
+			text: `x: {
+  shape: diamond
+  style.border-style: double
+}
+y.style.border-style: dotted
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				if g.Objects[0].Style.BorderStyle.Value != "double" {
+					t.Fatalf("expected border-style double, got %q", g.Objects[0].Style.BorderStyle.Value)
+				}
+				if g.Objects[1].Style.BorderStyle.Value != "dotted" {
+					t.Fatalf("expected border-style dotted, got %q", g.Objects[1].Style.BorderStyle.Value)
+				}
+			},
+		},
+		{
+			name: "invalid-border-style",
+			text: `x.style.border-style: wavy
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-border-style.d2:1:23: expected "border-style" to be one of (solid, dashed, dotted, double)`,
+		},
+		{
+			name: "border-style-double-shape",
+			text: `x: {
+  shape: hexagon
+  style.border-style: double
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/border-style-double-shape.d2:3:3: "border-style: double" can only be applied to squares, rectangles, circles, ovals, diamonds`,
+		},
+		{
+			name: "latex-scale",
+			text: `x: |latex
+e = mc^2
+| {
+  style.latex-scale: 1.5
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, 1.5, g.Objects[0].Style.LatexScaleValue())
+			},
+		},
+		{
+			name: "invalid-latex-scale",
+			text: `x.style.latex-scale: 0
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-latex-scale.d2:1:22: expected "latex-scale" to be a number greater than 0 and at most 10`,
+		},
+		{
+			name: "code-options",
+			text: `x: |go
+  a := 1
+  b := 2
+  c := 3
+|
+x.code: {
+  line-numbers: true
+  highlight: 1,2-3
+}
+code: |go
+  fmt.Println("hi")
+|
+code.width: 512
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, "true", g.Objects[0].LineNumbers.Value)
+				tassert.Equal(t, "1,2-3", g.Objects[0].HighlightLines.Value)
+				tassert.Equal(t, "code", g.Objects[1].ID)
+				tassert.Equal(t, "512", g.Objects[1].WidthAttr.Value)
+			},
+		},
+		{
+			name: "code-options-not-code",
+			text: `x.code.line-numbers: true
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, "x.code.line-numbers", g.Objects[2].AbsID())
+			},
+		},
+		{
+			name: "invalid-code-highlight",
+			text: `x: |go
+  a := 1
+|
+x.code.highlight: 1-2
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-code-highlight.d2:4:19: "code.highlight" goes past the last line, 1`,
+		},
+		{
+			name: "invalid-code-option",
+			text: `x: |go
+  a := 1
+|
+x.code.wrap: true
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-code-option.d2:4:8: "code" keys are "line-numbers" and "highlight", got "wrap"`,
+		},
+		{
+			name: "local-icon",
+			text: `db.icon: ./assets/db.svg
+api.icon: ./assets/missing.svg
+`,
+			files: map[string]string{
+				"assets/db.svg": `<svg xmlns="http://www.w3.org/2000/svg"/>`,
+			},
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, "data:image/svg+xml;base64,PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciLz4=", g.Objects[0].Icon.String())
+				// Left for renderers to resolve
+				tassert.Equal(t, "./assets/missing.svg", g.Objects[1].Icon.String())
+			},
+		},
+		{
+			name: "icon-pack",
+			text: `s3.icon: @aws/s3
+lambda.icon: "@aws/lambda.png"
+`,
+			files: map[string]string{
+				"icons/aws/s3.svg":     `<svg xmlns="http://www.w3.org/2000/svg"/>`,
+				"icons/aws/lambda.png": "\x89PNG\r\n\x1a\n",
+			},
+			iconDir: "icons",
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, "data:image/svg+xml;base64,PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciLz4=", g.Objects[0].Icon.String())
+				tassert.Equal(t, "data:image/png;base64,iVBORw0KGgo=", g.Objects[1].Icon.String())
+			},
+		},
+		{
+			name: "builtin-icon-pack",
+			text: `fn.icon: aws/lambda
+logo.icon: assets/logo
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, "https://icons.terrastruct.com/aws%2FCompute%2FAWS-Lambda.svg", g.Objects[0].Icon.String())
+				tassert.Equal(t, "assets/logo", g.Objects[1].Icon.String())
+			},
+		},
+		{
+			name: "icon-pack-missing",
+			text: `s3.icon: @aws/s4
+`,
+			files:   map[string]string{},
+			iconDir: "icons",
+			expErr:  `d2/testdata/d2compiler/TestCompile/icon-pack-missing.d2:1:10: bad icon "@aws/s4": not found in icon directory d2/testdata/d2compiler/TestCompile/icons`,
+		},
+		{
+			name: "icon-pack-no-dir",
+			text: `s3.icon: @aws/s3
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/icon-pack-no-dir.d2:1:10: bad icon "@aws/s3": icon packs need an icon directory`,
+		},
+		{
+			name: "custom-shape",
+			text: `gear: {
+  shape: custom
+  shape-src: ./shapes/hexgear.svg
+}
+`,
+			files: map[string]string{
+				"shapes/hexgear.svg": `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100">
+  <polygon id="d2-border" points="50,0 150,0 200,50 150,100 50,100 0,50"/>
+  <rect id="d2-label" x="50" y="25" width="100" height="50" fill="none"/>
+</svg>`,
+			},
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				def := g.Objects[0].CustomShape
+				tassert.NotNil(t, def)
+				tassert.Equal(t, [4]float64{0, 0, 200, 100}, def.ViewBox)
+				tassert.Equal(t, &[4]float64{50, 25, 100, 50}, def.LabelBox)
+				tassert.Equal(t, []float64{50, 0, 150, 0, 200, 50, 150, 100, 50, 100, 0, 50}, def.Border)
+				tassert.Contains(t, def.SVG, `<svg preserveAspectRatio="none" xmlns=`)
+			},
+		},
+		{
+			name: "custom-shape-no-src",
+			text: `gear.shape: custom
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/custom-shape-no-src.d2:1:1: custom shapes need a "shape-src" SVG`,
+		},
+		{
+			name: "custom-shape-bad-src",
+			text: `gear: {
+  shape: custom
+  shape-src: ./hexgear.svg
+}
+`,
+			files: map[string]string{
+				"hexgear.svg": `<svg xmlns="http://www.w3.org/2000/svg"/>`,
+			},
+			expErr: `d2/testdata/d2compiler/TestCompile/custom-shape-bad-src.d2:3:3: bad shape-src "./hexgear.svg": SVG needs a viewBox, or a width and height`,
+		},
+		{
+			name: "shape-src-not-custom",
+			text: `gear.shape-src: ./hexgear.svg
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/shape-src-not-custom.d2:1:1: "shape-src" can only be set on custom shapes`,
+		},
+		{
+			name: "board-shape",
+			text: `overview: {
+  shape: board
+  board: layers.detail
+}
+layers: {
+  detail: {
+    a -> b
+    zoom: {shape: board; board: _.layers.more}
+  }
+  more: {
+    c
+  }
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, "root.layers.detail", g.Objects[0].Board.Value)
+				tassert.Equal(t, "root.layers.more", g.Layers[0].Objects[2].Board.Value)
+			},
+		},
+		{
+			name: "assert",
+			text: `...@rules
+assert: "count(*-service) >= 2"
+users-service: {
+  class: service
+  api -> db
+}
+orders-service: {
+  class: service
+  api
+  db
+}
+`,
+			files: map[string]string{
+				"rules.d2": `assert: "**.shape != circle"
+classes: {
+  service.assert: [count(db) == 1; count(api) >= 1]
+}
+`,
+			},
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, 2, len(g.Root.Assertions))
+				tassert.Equal(t, 2, len(g.Objects[0].Assertions))
+			},
+		},
+		{
+			name: "assert-failed",
+			text: `assert: "count(*-service) >= 3"
+*-service.assert: count(db) == 1
+users-service: {
+  api -> db
+}
+orders-service
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/assert-failed.d2:1:9: assertion "count(*-service) >= 3" failed: counted 2
+d2/testdata/d2compiler/TestCompile/assert-failed.d2:2:19: assertion "count(db) == 1" failed in orders-service: counted 0`,
+		},
+		{
+			name: "assert-edge",
+			text: `a -> b: {assert: "*.shape == circle"}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/assert-edge.d2:1:10: "assert" can only be set on shapes and boards`,
+		},
+		{
+			name: "board-shape-no-board",
+			text: `overview.shape: board
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/board-shape-no-board.d2:1:1: board shapes need a "board" to embed, like layers.details`,
+		},
+		{
+			name: "board-not-board-shape",
+			text: `overview.board: layers.detail
+layers.detail: {
+  a
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/board-not-board-shape.d2:1:1: "board" can only be set on board shapes`,
+		},
+		{
+			name: "board-shape-not-found",
+			text: `overview: {
+  shape: board
+  board: layers.details
+}
+layers.detail: {
+  a
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/board-shape-not-found.d2:3:3: embedded board not found`,
+		},
+		{
+			name: "board-shape-not-board",
+			text: `overview: {
+  shape: board
+  board: a.b
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/board-shape-not-board.d2:3:3: "board" must be the path of a board, like layers.details`,
+		},
+		{
+			name: "board-shape-children",
+			text: `overview: {
+  shape: board
+  board: layers.detail
+  a
+}
+layers.detail: {
+  b
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/board-shape-children.d2:4:3: board shapes cannot have children`,
+		},
+		{
+			name: "board-shape-cycle",
+			text: `overview: {
+  shape: board
+  board: layers.detail
+}
+layers: {
+  detail: {
+    back: {
+      shape: board
+      board: _
+    }
+  }
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/board-shape-cycle.d2:3:3: board root embeds itself: root -> root.layers.detail -> root
+d2/testdata/d2compiler/TestCompile/board-shape-cycle.d2:9:7: board root.layers.detail embeds itself: root.layers.detail -> root -> root.layers.detail`,
+		},
+		{
+			name: "collapsed-not-container",
+			text: `a.collapsed: true
+b: {
+  collapsed: true
+  c
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/collapsed-not-container.d2:1:1: "collapsed" can only be set on containers`,
+		},
+		{
+			name: "collapsed-not-bool",
+			text: `b: {
+  collapsed: yes
+  c
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/collapsed-not-bool.d2:2:14: expected "collapsed" to be true or false`,
+		},
+		{
+			name: "layer-group",
+			text: `a.style.layer-group: after
+a -> b: {style.layer-group: after}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				if g.Objects[0].Style.LayerGroup == nil || g.Objects[0].Style.LayerGroup.Value != "after" {
+					t.Fatalf("unexpected layer group: %#v", g.Objects[0].Style.LayerGroup)
+				}
+				if g.Edges[0].Style.LayerGroup == nil || g.Edges[0].Style.LayerGroup.Value != "after" {
+					t.Fatalf("unexpected layer group: %#v", g.Edges[0].Style.LayerGroup)
+				}
+			},
+		},
+		{
+			name:   "layer-group-invalid",
+			text:   `a.style.layer-group: "before and after"`,
+			expErr: `d2/testdata/d2compiler/TestCompile/layer-group-invalid.d2:1:22: expected "layer-group" to be a name of letters, digits, "-" and "_"`,
+		},
+		{
+			name: "text-align",
+			text: `x: "first line\nsecond" {
+  style.text-align: left
+}
+x -> y: {
+  style.text-align: right
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				if g.Objects[0].Style.TextAlign.Value != "left" {
+					t.Fatalf("expected text-align left, got %q", g.Objects[0].Style.TextAlign.Value)
+				}
+				if g.Edges[0].Style.TextAlign.Value != "right" {
+					t.Fatalf("expected text-align right, got %q", g.Edges[0].Style.TextAlign.Value)
+				}
+			},
+		},
+		{
+			name: "invalid-text-align",
+			text: `x.style.text-align: justify
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-text-align.d2:1:21: expected "text-align" to be one of (left, center, right)`,
+		},
+		{
+			name: "text-direction",
+			text: `x: "D2 שלום" {
+  style.text-direction: rtl
+}
+x -> y: {
+  style.text-direction: LTR
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				if g.Objects[0].Style.TextDirection.Value != "rtl" {
+					t.Fatalf("expected text-direction rtl, got %q", g.Objects[0].Style.TextDirection.Value)
+				}
+				if g.Edges[0].Style.TextDirection.Value != "LTR" {
+					t.Fatalf("expected text-direction LTR, got %q", g.Edges[0].Style.TextDirection.Value)
+				}
+			},
+		},
+		{
+			name: "invalid-text-direction",
+			text: `x.style.text-direction: auto
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid-text-direction.d2:1:25: expected "text-direction" to be one of (ltr, rtl)`,
 		},
 		{
 			name: "shape_unquoted_hex",
@@ -275,6 +749,19 @@ containers: {
 `,
 			expErr: `d2/testdata/d2compiler/TestCompile/shape_unquoted_hex.d2:3:10: missing value after colon`,
 		},
+		{
+			name: "parse_and_compile_errors",
+
+			text: `x: {
+  shape: hexagonx
+}
+y ->
+z.width: abc
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/parse_and_compile_errors.d2:4:1: connection missing destination
+d2/testdata/d2compiler/TestCompile/parse_and_compile_errors.d2:2:10: unknown shape "hexagonx"
+d2/testdata/d2compiler/TestCompile/parse_and_compile_errors.d2:5:10: non-integer width "abc": strconv.Atoi: parsing "abc": invalid syntax`,
+		},
 		{
 			name: "edge_unquoted_hex",
 
@@ -1002,6 +1489,63 @@ x -> y: {
 				}
 			},
 		},
+		{
+			name: "edge_label_markdown_icon",
+
+			text: `x -> y: {
+  icon: https://icons.terrastruct.com/essentials%2F117-database.svg
+  label: |md *async* |
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				if len(g.Edges) != 1 {
+					t.Fatalf("expected 1 edge: %#v", g.Edges)
+				}
+				if g.Edges[0].Language != "markdown" {
+					t.Fatalf("expected markdown label: %#v", g.Edges[0].Language)
+				}
+				if g.Edges[0].Label.Value != "*async*" {
+					t.Fatalf("unexpected g.Edges[0].Label.Value : %#v", g.Edges[0].Label.Value)
+				}
+				if g.Edges[0].Icon == nil || g.Edges[0].Icon.Host != "icons.terrastruct.com" {
+					t.Fatalf("unexpected g.Edges[0].Icon: %#v", g.Edges[0].Icon)
+				}
+			},
+		},
+		{
+			name: "edge_end_labels",
+
+			text: `client -> server: HTTP {
+  source-label: request
+  target-label: response
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				if len(g.Edges) != 1 {
+					t.Fatalf("expected 1 edge: %#v", g.Edges)
+				}
+				e := g.Edges[0]
+				if e.Label.Value != "HTTP" {
+					t.Fatalf("unexpected label: %#v", e.Label.Value)
+				}
+				if e.SrcArrowhead == nil || e.SrcArrowhead.Label.Value != "request" {
+					t.Fatalf("unexpected source label: %#v", e.SrcArrowhead)
+				}
+				if e.DstArrowhead == nil || e.DstArrowhead.Label.Value != "response" {
+					t.Fatalf("unexpected target label: %#v", e.DstArrowhead)
+				}
+				if e.SrcArrow {
+					t.Fatalf("expected no source arrowhead")
+				}
+			},
+		},
+		{
+			name: "end_label_on_shape",
+
+			text: `x.source-label: request
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/end_label_on_shape.d2:1:3: "source-label" can only be used on connections`,
+		},
 		{
 			name: "edge_map_arrowhead",
 
@@ -1114,9 +1658,9 @@ x -> y: {
 		{
 			name: "object_arrowhead_shape",
 
-			text: `x: {shape: triangle}
+			text: `x: {shape: cf-many}
 `,
-			expErr: `d2/testdata/d2compiler/TestCompile/object_arrowhead_shape.d2:1:5: invalid shape, can only set "triangle" for arrowheads`,
+			expErr: `d2/testdata/d2compiler/TestCompile/object_arrowhead_shape.d2:1:5: invalid shape, can only set "cf-many" for arrowheads`,
 		},
 		{
 			name: "edge_flat_label_arrowhead",
@@ -1643,6 +2187,39 @@ z: {
 			`,
 			expErr: "",
 		},
+		{
+			name: "near_side",
+
+			text: `api
+note: {
+  near: api {side: bottom; gap: 40}
+}
+legend.near: api
+legend.near.side: left
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				assert.String(t, "api", d2format.Format(g.Objects[1].NearKey))
+				assert.String(t, "bottom", g.Objects[1].NearSide.Value)
+				assert.String(t, "40", g.Objects[1].NearGap.Value)
+				assert.String(t, "left", g.Objects[2].NearSide.Value)
+				tassert.Nil(t, g.Objects[2].NearGap)
+			},
+		},
+		{
+			name: "invalid_near_side",
+
+			text: `api
+note.near: api {side: middle}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid_near_side.d2:2:23: expected "side" to be one of (top, right, bottom, left)`,
+		},
+		{
+			name: "near_constant_side",
+
+			text: `note.near: top-left {gap: 10}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/near_constant_side.d2:1:22: "gap" can only be set when near is another object`,
+		},
 		{
 			name: "nested_near_constant",
 
@@ -1893,6 +2470,152 @@ x.y -> a.b: {
 				tassert.Equal(t, "true", g.Edges[0].Style.Animated.Value)
 			},
 		},
+		{
+			name: "table_indexes",
+
+			text: `users: {
+  shape: sql_table
+  max-rows: 1
+  id: int {constraint: primary_key}
+  email: string {constraint: unique}
+  idx_email: email {shape: index}
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				table := g.Objects[0].SQLTable
+				tassert.Equal(t, 2, len(table.Columns))
+				tassert.Equal(t, 1, table.MaxRows)
+				tassert.Equal(t, 1, table.HiddenColumns())
+				tassert.Equal(t, 1, len(table.Indexes))
+				tassert.Equal(t, "idx_email", table.Indexes[0].Name.Label)
+				tassert.Equal(t, "email", table.Indexes[0].Columns.Label)
+			},
+		},
+		{
+			name: "invalid_max_rows",
+
+			text: `users: {
+  shape: sql_table
+  max-rows: 0
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid_max_rows.d2:3:13: max-rows must be a positive number of rows: "0"`,
+		},
+		{
+			name: "max_rows_not_table",
+
+			text: `users: {
+  max-rows: 3
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/max_rows_not_table.d2:2:3: "max-rows" can only be set on sql_table shapes`,
+		},
+		{
+			name: "index_in_class",
+
+			text: `users: {
+  shape: class
+  idx: id {shape: index}
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/index_in_class.d2:3:12: shape "index" can only be used on sql_table columns`,
+		},
+		{
+			name: "class_stereotype",
+
+			text: `Polygon: {
+  shape: class
+  stereotype: interface
+  +count: int {modifier: static}
+  area(): float {modifier: abstract}
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				class := g.Objects[0].Class
+				tassert.Equal(t, "interface", class.Stereotype)
+				tassert.True(t, class.Fields[0].Static)
+				tassert.False(t, class.Fields[0].Abstract)
+				tassert.True(t, class.Methods[0].Abstract)
+			},
+		},
+		{
+			name: "class_group_by",
+
+			text: `User: {
+  shape: class
+  group-by: visibility
+  -password: string
+  +name: string
+  "#email": string
+  -hash(): string
+  +login(): bool
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				class := g.Objects[0].Class
+				var fields []string
+				for _, f := range class.Fields {
+					fields = append(fields, f.Name+f.Shape)
+				}
+				tassert.Equal(t, []string{"name", "separator", "email", "separator", "password"}, fields)
+				var methods []string
+				for _, m := range class.Methods {
+					methods = append(methods, m.Name+m.Shape)
+				}
+				tassert.Equal(t, []string{"login()", "separator", "hash()"}, methods)
+			},
+		},
+		{
+			name: "class_group_by_rows",
+
+			text: `User: {
+  shape: class
+  group-by: visibility
+  name: string
+  sep: {shape: separator}
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/class_group_by_rows.d2:5:9: header and separator rows can't be used with "group-by"`,
+		},
+		{
+			name: "invalid_modifier",
+
+			text: `User: {
+  shape: class
+  name: string {modifier: final}
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid_modifier.d2:3:27: "modifier" must be one of static, abstract, got "final"`,
+		},
+		{
+			name: "modifier_not_member",
+
+			text: `User: {
+  modifier: static
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/modifier_not_member.d2:2:3: "modifier" can only be set on class members`,
+		},
+		{
+			name: "stereotype_not_class",
+
+			text: `User: {
+  stereotype: interface
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/stereotype_not_class.d2:2:3: "stereotype" can only be set on class shapes`,
+		},
+		{
+			name: "uml_arrowheads",
+
+			text: `a -> b: {
+  target-arrowhead.shape: realization
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, d2target.UnfilledTriangleArrowhead, g.Edges[0].DstArrowhead.ToArrowhead())
+			},
+		},
 		{
 			name: "class_paren",
 
@@ -1922,13 +2645,97 @@ x.y -> a.b: {
   Is(): bool
 }`,
 			assertions: func(t *testing.T, g *d2graph.Graph) {
-				if len(g.Objects) != 1 {
-					t.Fatal(g.Objects)
-				}
-				assert.String(t, `GetType()`, g.Objects[0].SQLTable.Columns[0].Name.Label)
-				assert.String(t, `Is()`, g.Objects[0].SQLTable.Columns[1].Name.Label)
+				if len(g.Objects) != 1 {
+					t.Fatal(g.Objects)
+				}
+				assert.String(t, `GetType()`, g.Objects[0].SQLTable.Columns[0].Name.Label)
+				assert.String(t, `Is()`, g.Objects[0].SQLTable.Columns[1].Name.Label)
+			},
+		},
+		{
+			name: "sql_group_rows",
+
+			text: `users: {
+  shape: sql_table
+  id: int {constraint: primary_key}
+  indexes: {shape: header}
+  idx_email: btree(email)
+  sep: {shape: separator}
+  email: string
+}
+users.email -> x
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				cols := g.Objects[0].SQLTable.Columns
+				if len(cols) != 5 {
+					t.Fatal(cols)
+				}
+				assert.String(t, `header`, cols[1].Shape)
+				assert.String(t, `indexes`, cols[1].Name.Label)
+				assert.String(t, `idx_email`, cols[2].Name.Label)
+				assert.String(t, `separator`, cols[3].Shape)
+				assert.String(t, ``, cols[3].Name.Label)
+				tassert.Equal(t, 4, *g.Edges[0].SrcTableColumnIndex)
+			},
+		},
+		{
+			name: "class_group_rows",
+
+			text: `User: {
+  shape: class
+  +id: int
+  private: Private {shape: header}
+  -hash: string
+  getID(): int
+  sep: {shape: separator}
+  -rehash(): void
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				class := g.Objects[0].Class
+				if len(class.Fields) != 3 || len(class.Methods) != 3 {
+					t.Fatal(class.Fields, class.Methods)
+				}
+				assert.String(t, `header`, class.Fields[1].Shape)
+				assert.String(t, `Private`, class.Fields[1].Name)
+				assert.String(t, `hash`, class.Fields[2].Name)
+				assert.String(t, `separator`, class.Methods[1].Shape)
+				assert.String(t, `rehash()`, class.Methods[2].Name)
+			},
+		},
+		{
+			name: "row_shape_outside_table",
+
+			text: `a: {shape: header}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/row_shape_outside_table.d2:1:5: shape "header" can only be used on sql_table columns and class members`,
+		},
+		{
+			name: "font_size_auto",
+
+			text: `a: {
+  width: 100
+  style.font-size: auto
+}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				assert.String(t, "auto", g.Objects[0].Style.FontSize.Value)
 			},
 		},
+		{
+			name: "font_size_auto_unsized",
+
+			text: `a.style.font-size: auto
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/font_size_auto_unsized.d2:1:1: "font-size: auto" needs the shape to have a width or height`,
+		},
+		{
+			name: "font_size_auto_edge",
+
+			text: `a -> b: {style.font-size: auto}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/font_size_auto_edge.d2:1:10: "font-size: auto" can only be applied to shapes`,
+		},
 		{
 			name: "nested_sql",
 
@@ -2143,6 +2950,18 @@ ok: {
 				assert.String(t, "left", g.Objects[0].Direction.Value)
 			},
 		},
+		{
+			name: "auto_direction",
+
+			text: `direction: auto
+x: {
+  direction: auto
+}`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				assert.String(t, "auto", g.Root.Direction.Value)
+				assert.String(t, "auto", g.Objects[0].Direction.Value)
+			},
+		},
 		{
 			name: "constraint_label",
 
@@ -2158,7 +2977,103 @@ ok: {
 			text: `x: {
   direction: diagonal
 }`,
-			expErr: `d2/testdata/d2compiler/TestCompile/invalid_direction.d2:2:14: direction must be one of up, down, right, left, got "diagonal"`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid_direction.d2:2:14: direction must be one of up, down, right, left, auto, got "diagonal"`,
+		},
+		{
+			name: "hidden",
+
+			text: `x.hidden: true
+x -> y: {hidden: false}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				assert.String(t, "true", g.Objects[0].Hidden.Value)
+				assert.String(t, "false", g.Edges[0].Hidden.Value)
+			},
+		},
+		{
+			name: "direction-mirror",
+
+			text: `direction-mirror: true
+a -> b
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				assert.String(t, "true", g.Root.DirectionMirror.Value)
+				assert.True(t, g.IsDirectionMirrored())
+			},
+		},
+		{
+			name: "invalid_direction-mirror",
+
+			text:   `direction-mirror: left`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid_direction-mirror.d2:1:19: expected "direction-mirror" to be true or false`,
+		},
+		{
+			name: "nested_direction-mirror",
+
+			text:   `x.direction-mirror: true`,
+			expErr: `d2/testdata/d2compiler/TestCompile/nested_direction-mirror.d2:1:1: "direction-mirror" can only be set on the root of a board`,
+		},
+		{
+			name: "edge_preferences",
+
+			text: `a -> b
+b -> c: {straighten: true}
+a -> c: {min-length: 2}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Nil(t, g.Edges[0].Straighten)
+				assert.String(t, "true", g.Edges[1].Straighten.Value)
+				assert.String(t, "2", g.Edges[2].MinLength.Value)
+			},
+		},
+		{
+			name: "edge_straighten_bool_forms",
+
+			text: `a -> b: {straighten: 1}
+b -> c: {straighten: F}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				assert.String(t, "true", g.Edges[0].Straighten.Value)
+				assert.String(t, "false", g.Edges[1].Straighten.Value)
+			},
+		},
+		{
+			name: "invalid_min-length",
+
+			text:   `a -> b: {min-length: 0}`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid_min-length.d2:1:22: min-length must be a positive number of ranks: "0"`,
+		},
+		{
+			name: "object_straighten",
+
+			text:   `a.straighten: true`,
+			expErr: `d2/testdata/d2compiler/TestCompile/object_straighten.d2:1:1: "straighten" can only be set on connections`,
+		},
+		{
+			name: "bundle",
+
+			text: `style.bundle: true
+hub -> a
+hub -> b
+a.style.bundle: false
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				assert.String(t, "true", g.Root.Style.Bundle.Value)
+				tassert.Nil(t, g.Objects[0].Style.Bundle)
+				assert.String(t, "false", g.Objects[1].Style.Bundle.Value)
+			},
+		},
+		{
+			name: "edge_bundle",
+
+			text:   `a -> b: {style.bundle: true}`,
+			expErr: `d2/testdata/d2compiler/TestCompile/edge_bundle.d2:1:10: key "bundle" can only be applied to shapes`,
+		},
+		{
+			name: "invalid_hidden",
+
+			text:   `x.hidden: maybe`,
+			expErr: `d2/testdata/d2compiler/TestCompile/invalid_hidden.d2:1:11: expected "hidden" to be true or false`,
 		},
 		{
 			name: "self-referencing",
@@ -2711,6 +3626,126 @@ a -> b: { class: [association; one target] }
 				tassert.Equal(t, "arrow", g.Edges[1].DstArrowhead.Shape.Value)
 			},
 		},
+		{
+			name: "extends-classes",
+			text: `classes: {
+  base: {
+    style.stroke: black
+    style.font-size: 20
+  }
+  service: {
+    extends: base
+    shape: hexagon
+    style.fill: blue
+  }
+  persistent: {
+    extends: base
+    shape: cylinder
+    style.fill: green
+  }
+  service-db: {
+    extends: [service; persistent]
+    style.stroke: red
+  }
+  edge-db: {
+    extends: service, persistent
+  }
+  thick: {
+    style.stroke-width: 4
+  }
+  path: {
+    extends: thick
+    label: then
+  }
+}
+api.class: service
+db.class: service-db
+cache.class: edge-db
+api -> db: {class: path}
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, "hexagon", g.Objects[0].Shape.Value)
+				tassert.Equal(t, "blue", g.Objects[0].Style.Fill.Value)
+				tassert.Equal(t, "black", g.Objects[0].Style.Stroke.Value)
+				tassert.Equal(t, "20", g.Objects[0].Style.FontSize.Value)
+
+				// The class overrides what it extends, and later parents override earlier ones
+				tassert.Equal(t, "cylinder", g.Objects[1].Shape.Value)
+				tassert.Equal(t, "green", g.Objects[1].Style.Fill.Value)
+				tassert.Equal(t, "red", g.Objects[1].Style.Stroke.Value)
+				tassert.Equal(t, "20", g.Objects[1].Style.FontSize.Value)
+				tassert.Equal(t, []string{"service-db"}, g.Objects[1].Classes)
+
+				tassert.Equal(t, "cylinder", g.Objects[2].Shape.Value)
+
+				tassert.Equal(t, "4", g.Edges[0].Style.StrokeWidth.Value)
+				tassert.Equal(t, "then", g.Edges[0].Label.Value)
+			},
+		},
+		{
+			name: "class-arrowheads",
+			text: `classes: {
+  table: {
+    shape: sql_table
+    target-arrowhead.shape: cf-many
+  }
+  table-source: {
+    extends: table
+    source-arrowhead: {
+      shape: cf-one
+      label: 1
+    }
+  }
+}
+users.class: table-source
+orders.class: table
+users <-> orders
+users <-> orders: {
+  target-arrowhead.shape: diamond
+}
+orders -> users
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				tassert.Equal(t, "cf-one", g.Edges[0].SrcArrowhead.Shape.Value)
+				tassert.Equal(t, "1", g.Edges[0].SrcArrowhead.Label.Value)
+				tassert.Equal(t, "cf-many", g.Edges[0].DstArrowhead.Shape.Value)
+				// The connection's own arrowheads override its objects' classes
+				tassert.Equal(t, "diamond", g.Edges[1].DstArrowhead.Shape.Value)
+				tassert.Equal(t, "cf-many", g.Edges[2].DstArrowhead.Shape.Value)
+				tassert.Equal(t, (*d2graph.Attributes)(nil), g.Edges[2].SrcArrowhead)
+			},
+		},
+		{
+			name: "extends-cycle",
+			text: `classes: {
+  a: {
+    extends: b
+  }
+  b: {
+    extends: [c; a]
+  }
+  c: {
+    style.fill: red
+  }
+}
+x.class: a
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/extends-cycle.d2:3:5: class "a" cannot extend itself: a -> b -> a
+d2/testdata/d2compiler/TestCompile/extends-cycle.d2:6:5: class "b" cannot extend itself: b -> a -> b`,
+		},
+		{
+			name: "extends-missing",
+			text: `classes: {
+  a: {
+    extends: [b; c]
+  }
+  b: {
+    style.fill: red
+  }
+}
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/extends-missing.d2:3:5: class "a" extends "c", which doesn't exist`,
+		},
 		{
 			name: "var_in_glob",
 			text: `vars: {
@@ -2842,6 +3877,19 @@ a
 			expErr: `d2/testdata/d2compiler/TestCompile/var-not-color.d2:4:7: expected "B1" to be a valid named color ("orange") or a hex code ("#f0ff3a")
 d2/testdata/d2compiler/TestCompile/var-not-color.d2:5:4: "potato" is not a valid theme code`,
 		},
+		{
+			name: "theme-override-without-value",
+			text: `vars: {
+  d2-config: {
+    theme-overrides: {
+      B1
+    }
+  }
+}
+a
+`,
+			expErr: `d2/testdata/d2compiler/TestCompile/theme-override-without-value.d2:4:7: "B1" needs a value`,
+		},
 		{
 			name: "no_arrowheads_in_shape",
 
@@ -2938,6 +3986,9 @@ layers: {
 					assert.Success(t, err)
 				})
 				opts.FS = fs
+				if tc.iconDir != "" {
+					opts.IconDir = fmt.Sprintf("d2/testdata/d2compiler/TestCompile/%v", tc.iconDir)
+				}
 			}
 			d2Path := fmt.Sprintf("d2/testdata/d2compiler/%v.d2", t.Name())
 			g, _, err := d2compiler.Compile(d2Path, strings.NewReader(tc.text), opts)
@@ -2982,6 +4033,7 @@ func TestCompile2(t *testing.T) {
 	t.Run("boards", testBoards)
 	t.Run("seqdiagrams", testSeqDiagrams)
 	t.Run("nulls", testNulls)
+	t.Run("redirects", testRedirects)
 	t.Run("vars", testVars)
 	t.Run("globs", testGlobs)
 }
@@ -3237,6 +4289,17 @@ a.style.opacity: null
 					assert.Equal(t, (*d2graph.Scalar)(nil), g.Objects[0].Attributes.Style.Opacity)
 				},
 			},
+			{
+				name: "edge-attribute",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+a -> b: {style.opacity: 0.2}
+(a -> b)[0].style.opacity: null
+`, "")
+					assert.Equal(t, 1, len(g.Edges))
+					assert.Equal(t, (*d2graph.Scalar)(nil), g.Edges[0].Attributes.Style.Opacity)
+				},
+			},
 		}
 
 		for _, tc := range tca {
@@ -3381,21 +4444,172 @@ y: null
 y: null
 x -> y
 `, "")
-					assert.Equal(t, 2, len(g.Objects))
-					assert.Equal(t, 1, len(g.Edges))
+					assert.Equal(t, 2, len(g.Objects))
+					assert.Equal(t, 1, len(g.Edges))
+				},
+			},
+			{
+				name: "delete-children",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+x.y.z
+a.b.c
+
+x: null
+a.b: null
+`, "")
+					assert.Equal(t, 1, len(g.Objects))
+				},
+			},
+		}
+
+		for _, tc := range tca {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				if tc.skip {
+					t.SkipNow()
+				}
+				tc.run(t)
+			})
+		}
+	})
+
+	t.Run("multiboard", func(t *testing.T) {
+		t.Parallel()
+
+		tca := []struct {
+			name string
+			skip bool
+			run  func(t *testing.T)
+		}{
+			{
+				name: "scenario",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+x
+
+scenarios: {
+  a: {
+    x: null
+  }
+}
+`, "")
+					assert.Equal(t, 0, len(g.Scenarios[0].Objects))
+				},
+			},
+			{
+				name: "scenario-edge",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+x -> y
+
+scenarios: {
+  a: {
+    (x -> y)[0]: null
+  }
+}
+`, "")
+					assert.Equal(t, 1, len(g.Edges))
+					assert.Equal(t, 2, len(g.Scenarios[0].Objects))
+					assert.Equal(t, 0, len(g.Scenarios[0].Edges))
+				},
+			},
+			{
+				name: "scenario-attribute",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+x.style.opacity: 0.4
+
+scenarios: {
+  a: {
+    x.style.opacity: null
+  }
+}
+`, "")
+					assert.Equal(t, "0.4", g.Objects[0].Attributes.Style.Opacity.Value)
+					assert.Equal(t, (*d2graph.Scalar)(nil), g.Scenarios[0].Objects[0].Attributes.Style.Opacity)
+				},
+			},
+			{
+				name: "scenario-edge-attribute",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+x -> y: {style.stroke: red}
+
+scenarios: {
+  a: {
+    (x -> y)[0].style.stroke: null
+  }
+}
+`, "")
+					assert.Equal(t, "red", g.Edges[0].Attributes.Style.Stroke.Value)
+					assert.Equal(t, 1, len(g.Scenarios[0].Edges))
+					assert.Equal(t, (*d2graph.Scalar)(nil), g.Scenarios[0].Edges[0].Attributes.Style.Stroke)
+				},
+			},
+			{
+				name: "scenario-implicit-edge",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+x -> y
+y -> z
+
+scenarios: {
+  a: {
+    y: null
+  }
+}
+`, "")
+					assert.Equal(t, 2, len(g.Edges))
+					assert.Equal(t, 2, len(g.Scenarios[0].Objects))
+					assert.Equal(t, 0, len(g.Scenarios[0].Edges))
+				},
+			},
+			{
+				name: "step",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+x -> y
+
+steps: {
+  1: {
+    z
+  }
+  2: {
+    x: null
+  }
+  3: {
+    y.label: gone
+  }
+}
+`, "")
+					assert.Equal(t, 3, len(g.Steps[0].Objects))
+					assert.Equal(t, 2, len(g.Steps[1].Objects))
+					assert.Equal(t, 0, len(g.Steps[1].Edges))
+					assert.Equal(t, 2, len(g.Steps[2].Objects))
 				},
 			},
 			{
-				name: "delete-children",
+				name: "layer-nested",
 				run: func(t *testing.T) {
 					g, _ := assertCompile(t, `
-x.y.z
-a.b.c
+a.b -> c
 
-x: null
-a.b: null
+scenarios: {
+  s: {
+    a.b: null
+    layers: {
+      l: {
+        a.b
+      }
+    }
+  }
+}
 `, "")
-					assert.Equal(t, 1, len(g.Objects))
+					assert.Equal(t, 2, len(g.Scenarios[0].Objects))
+					assert.Equal(t, 0, len(g.Scenarios[0].Edges))
+					assert.Equal(t, 2, len(g.Scenarios[0].Layers[0].Objects))
 				},
 			},
 		}
@@ -3411,43 +4625,116 @@ a.b: null
 			})
 		}
 	})
+}
 
-	t.Run("multiboard", func(t *testing.T) {
-		t.Parallel()
+func testRedirects(t *testing.T) {
+	t.Parallel()
 
-		tca := []struct {
-			name string
-			skip bool
-			run  func(t *testing.T)
-		}{
-			{
-				name: "scenario",
-				run: func(t *testing.T) {
-					g, _ := assertCompile(t, `
-x
+	tca := []struct {
+		name string
+		skip bool
+		run  func(t *testing.T)
+	}{
+		{
+			name: "target",
+			run: func(t *testing.T) {
+				g, _ := assertCompile(t, `
+a -> b: hi {style.stroke: red}
+(a -> b)[0].target: c
+`, "")
+				assert.Equal(t, 1, len(g.Edges))
+				assert.Equal(t, "(a -> c)[0]", g.Edges[0].AbsID())
+				assert.Equal(t, "hi", g.Edges[0].Label.Value)
+				assert.Equal(t, "red", g.Edges[0].Style.Stroke.Value)
+				assert.Equal(t, 3, len(g.Objects))
+			},
+		},
+		{
+			name: "source",
+			run: func(t *testing.T) {
+				g, _ := assertCompile(t, `
+a -> b
+c -> b
+(a -> b)[0]: {source: c}
+(c -> b)[1].style.stroke: blue
+`, "")
+				assert.Equal(t, 2, len(g.Edges))
+				assert.Equal(t, "(c -> b)[0]", g.Edges[0].AbsID())
+				assert.Equal(t, "(c -> b)[1]", g.Edges[1].AbsID())
+				assert.Equal(t, "blue", g.Edges[1].Style.Stroke.Value)
+			},
+		},
+		{
+			name: "nested",
+			run: func(t *testing.T) {
+				g, _ := assertCompile(t, `
+x: {
+  a -> b
+}
+x.(a -> b)[0].target: c.d
+`, "")
+				assert.Equal(t, 1, len(g.Edges))
+				assert.Equal(t, "x.(a -> c.d)[0]", g.Edges[0].AbsID())
+			},
+		},
+		{
+			name: "scenario",
+			run: func(t *testing.T) {
+				g, _ := assertCompile(t, `
+a -> b
 
 scenarios: {
-  a: {
-    x: null
+  s: {
+    (a -> b)[0].target: c
+    (a -> c)[0].label: redirected
   }
 }
 `, "")
-					assert.Equal(t, 0, len(g.Scenarios[0].Objects))
-				},
+				assert.Equal(t, "(a -> b)[0]", g.Edges[0].AbsID())
+				assert.Equal(t, 1, len(g.Scenarios[0].Edges))
+				assert.Equal(t, "(a -> c)[0]", g.Scenarios[0].Edges[0].AbsID())
+				assert.Equal(t, "redirected", g.Scenarios[0].Edges[0].Label.Value)
 			},
-		}
-
-		for _, tc := range tca {
-			tc := tc
-			t.Run(tc.name, func(t *testing.T) {
-				t.Parallel()
-				if tc.skip {
-					t.SkipNow()
+		},
+		{
+			name: "many_edges",
+			run: func(t *testing.T) {
+				// Past the number of edges that are looked up by an index
+				var sb strings.Builder
+				for i := 0; i < 20; i++ {
+					fmt.Fprintf(&sb, "n%d -> m%d\n", i, i)
 				}
-				tc.run(t)
-			})
-		}
-	})
+				g, _ := assertCompile(t, sb.String()+`(n1 -> m1)[0].target: z
+(n1 -> z)[0].style.stroke: red
+`, "")
+				assert.Equal(t, 20, len(g.Edges))
+				assert.Equal(t, "(n1 -> z)[0]", g.Edges[1].AbsID())
+				assert.Equal(t, "red", g.Edges[1].Style.Stroke.Value)
+			},
+		},
+		{
+			name: "invalid",
+			run: func(t *testing.T) {
+				assertCompile(t, `
+a -> b
+(a -> b)[0].target: {c}
+(a -> b)[0].source: label
+`, `d2/testdata/d2compiler/TestCompile2/redirects/invalid.d2:3:13: target must be set to the path of an object
+d2/testdata/d2compiler/TestCompile2/redirects/invalid.d2:4:21: reserved keywords are prohibited in edges`)
+			},
+		},
+	}
+
+	for _, tc := range tca {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if tc.skip {
+				t.SkipNow()
+			}
+			tc.run(t)
+		})
+	}
 }
 
 func testVars(t *testing.T) {
@@ -3561,7 +4848,7 @@ a.style.double-border: true
 					assertCompile(t, `
 a.shape: hexagon
 a.style.double-border: true
-`, `d2/testdata/d2compiler/TestCompile2/vars/basic/invalid-double-border.d2:3:1: key "double-border" can only be applied to squares, rectangles, circles, ovals`)
+`, `d2/testdata/d2compiler/TestCompile2/vars/basic/invalid-double-border.d2:3:1: key "double-border" can only be applied to squares, rectangles, circles, ovals, diamonds`)
 				},
 			},
 			{
@@ -4131,6 +5418,64 @@ x -> y
 `, `d2/testdata/d2compiler/TestCompile2/vars/config/invalid.d2:4:5: expected a boolean for "sketch", got "lol"`)
 				},
 			},
+			{
+				name: "legend",
+				run: func(t *testing.T) {
+					_, config := assertCompile(t, `
+vars: {
+	d2-config: {
+    legend: right
+  }
+}
+
+x -> y
+`, "")
+					assert.Equal(t, "right", *config.Legend)
+				},
+			},
+			{
+				name: "invalid-legend",
+				run: func(t *testing.T) {
+					assertCompile(t, `
+vars: {
+	d2-config: {
+    legend: top
+  }
+}
+
+x -> y
+`, `d2/testdata/d2compiler/TestCompile2/vars/config/invalid-legend.d2:4:5: expected "bottom" or "right" for "legend", got "top"`)
+				},
+			},
+			{
+				name: "snap",
+				run: func(t *testing.T) {
+					_, config := assertCompile(t, `
+vars: {
+	d2-config: {
+    snap: 8
+  }
+}
+
+x -> y
+`, "")
+					assert.Equal(t, int64(8), *config.Snap)
+				},
+			},
+			{
+				name: "invalid-snap",
+				run: func(t *testing.T) {
+					assertCompile(t, `
+vars: {
+	d2-config: {
+    snap: -8
+  }
+}
+
+x -> y
+`, `d2/testdata/d2compiler/TestCompile2/vars/config/invalid-snap.d2:4:5: "snap" must be 0 or more, got -8`)
+				},
+			},
 			{
 				name: "not-root",
 				run: func(t *testing.T) {
@@ -4159,6 +5504,85 @@ x: {
 		}
 	})
 
+	t.Run("expressions", func(t *testing.T) {
+		t.Parallel()
+
+		tca := []struct {
+			name string
+			skip bool
+			run  func(t *testing.T)
+		}{
+			{
+				name: "arithmetic",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+vars: {
+  base-width: 100
+  gap: 3
+}
+a: {
+  width: ${base-width * 2}
+  height: ${(base-width - gap * 10) / 2}
+}
+b.width: ${base-width*1.5}
+c: ${-gap % 2}
+`, "")
+					assert.Equal(t, "200", g.Objects[0].WidthAttr.Value)
+					assert.Equal(t, "35", g.Objects[0].HeightAttr.Value)
+					assert.Equal(t, "150", g.Objects[1].WidthAttr.Value)
+					assert.Equal(t, "-1", g.Objects[2].Label.Value)
+				},
+			},
+			{
+				name: "interpolation",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+vars: {
+  name: api
+  replicas: 2
+  colors: {
+    primary: blue
+  }
+}
+svc: "${name + '-svc'} x${replicas + 1}" {
+  style.fill: ${"light" + colors.primary}
+}
+`, "")
+					assert.Equal(t, "api-svc x3", g.Objects[0].Label.Value)
+					assert.Equal(t, "lightblue", g.Objects[0].Style.Fill.Value)
+				},
+			},
+			{
+				name: "plain-after-plain",
+				run: func(t *testing.T) {
+					g, _ := assertCompile(t, `
+vars: {
+  a: one
+  b: two
+}
+x: "${a}-${b}"
+y: ${a}-${b}
+z: "${a + 1}-${b}"
+`, "")
+					assert.Equal(t, "one-two", g.Objects[0].Label.Value)
+					assert.Equal(t, "one-two", g.Objects[1].Label.Value)
+					assert.Equal(t, "one1-two", g.Objects[2].Label.Value)
+				},
+			},
+		}
+
+		for _, tc := range tca {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				if tc.skip {
+					t.SkipNow()
+				}
+				tc.run(t)
+			})
+		}
+	})
+
 	t.Run("errors", func(t *testing.T) {
 		t.Parallel()
 
@@ -4167,6 +5591,25 @@ x: {
 			skip bool
 			run  func(t *testing.T)
 		}{
+			{
+				name: "expression-not-number",
+				run: func(t *testing.T) {
+					assertCompile(t, `
+vars: {
+  x: hey
+}
+hi: ${x * 2}
+`, `d2/testdata/d2compiler/TestCompile2/vars/errors/expression-not-number.d2:5:1: failed to compute ${x * 2}: "hey" isn't a number`)
+				},
+			},
+			{
+				name: "expression-missing",
+				run: func(t *testing.T) {
+					assertCompile(t, `
+hi: ${(z + 1}
+`, `d2/testdata/d2compiler/TestCompile2/vars/errors/expression-missing.d2:2:1: failed to compute ${(z + 1}: could not resolve variable "z"`)
+				},
+			},
 			{
 				name: "missing",
 				run: func(t *testing.T) {
@@ -4528,3 +5971,94 @@ func assertCompile(t *testing.T, text string, expErr string) (*d2graph.Graph, *d
 	assert.Success(t, err)
 	return g, config
 }
+
+func TestCompilePartial(t *testing.T) {
+	t.Parallel()
+
+	text := `a -> b
+c ->
+d.shape: circle
+`
+	g, _, err := d2compiler.Compile("x.d2", strings.NewReader(text), nil)
+	assert.ErrorString(t, err, "x.d2:2:1: connection missing destination")
+	tassert.Nil(t, g)
+
+	g, _, err = d2compiler.Compile("x.d2", strings.NewReader(text), &d2compiler.CompileOptions{Partial: true})
+	assert.ErrorString(t, err, "x.d2:2:1: connection missing destination")
+	if tassert.NotNil(t, g) {
+		var ids []string
+		for _, obj := range g.Objects {
+			ids = append(ids, obj.AbsID())
+		}
+		tassert.Equal(t, []string{"a", "b", "d"}, ids)
+		tassert.Equal(t, 1, len(g.Edges))
+		tassert.Equal(t, "circle", g.Objects[2].Shape.Value)
+	}
+
+	// The parts that parse have errors of their own
+	g, _, err = d2compiler.Compile("x.d2", strings.NewReader(text+"e.shape: blob\n"), &d2compiler.CompileOptions{Partial: true})
+	assert.ErrorString(t, err, "x.d2:2:1: connection missing destination\nx.d2:4:10: unknown shape \"blob\"")
+	tassert.Nil(t, g)
+}
+
+func TestCompilePartialTruncated(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		text   string
+		expErr string
+	}{
+		{
+			name: "underscore_edge",
+			text: `x: {
+  a -> b
+  (_.a -> _`,
+			expErr: `x.d2:1:4: maps must be terminated with }
+x.d2:3:4: invalid underscore`,
+		},
+		{
+			name: "theme_overrides",
+			text: `vars: {
+  d2-config: {
+    theme-overrides: {
+      B1`,
+			expErr: `x.d2:3:22: maps must be terminated with }
+x.d2:2:14: maps must be terminated with }
+x.d2:1:7: maps must be terminated with }`,
+		},
+		{
+			name: "vars",
+			text: `vars: {
+  y
+    z: 2
+  }
+}
+b: ${y.z}`,
+			expErr: `x.d2:5:1: unexpected map termination character } in file map
+x.d2:6:1: could not resolve variable "y.z"`,
+		},
+		{
+			name: "layer_classes",
+			text: `classes: {
+  c: { style.fill: red }
+}
+layers: {
+  l: {
+    classes`,
+			expErr: `x.d2:5:6: maps must be terminated with }
+x.d2:4:9: maps must be terminated with }`,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, partial := range []bool{false, true} {
+				_, _, err := d2compiler.Compile("x.d2", strings.NewReader(tc.text), &d2compiler.CompileOptions{Partial: partial})
+				assert.ErrorString(t, err, tc.expErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package d2compiler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2parser"
+)
+
+// Diagnostic is a problem in D2 source as a structured record, so that editors and CI can
+// annotate it without parsing error messages
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	// Code is the kind of problem, one of d2ast's DIAGNOSTIC_ codes
+	Code string `json:"code"`
+	// Message describes the problem, without its range
+	Message string      `json:"message"`
+	Range   d2ast.Range `json:"range"`
+	// Fixes are the edits that would likely fix the problem, if any
+	Fixes []d2ast.Fix `json:"fixes,omitempty"`
+}
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostics returns the errors of err, as returned by Compile, as diagnostics. Errors that
+// aren't problems in the source, like failing to read it, have no diagnostics.
+func Diagnostics(err error) []Diagnostic {
+	var pe *d2parser.ParseError
+	if !errors.As(err, &pe) {
+		return nil
+	}
+	var diags []Diagnostic
+	for _, e := range pe.Errors {
+		diags = append(diags, NewDiagnostic(SeverityError, e))
+	}
+	return diags
+}
+
+// WarningDiagnostics returns the warnings of g as diagnostics
+func WarningDiagnostics(g *d2graph.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for _, w := range g.Warnings {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     w.Code,
+			Message:  w.Message,
+			Range:    w.Range,
+		})
+	}
+	return diags
+}
+
+// NewDiagnostic returns the diagnostic of the error or warning e
+func NewDiagnostic(severity Severity, e d2ast.Error) Diagnostic {
+	d := Diagnostic{
+		Severity: severity,
+		Code:     e.Code,
+		Message:  strings.TrimPrefix(e.Message, e.Range.String()+": "),
+		Range:    e.Range,
+	}
+	if d.Code == "" {
+		d.Code = d2ast.DIAGNOSTIC_INVALID
+	}
+	if e.Fix != nil {
+		d.Fixes = []d2ast.Fix{*e.Fix}
+	}
+	return d
+}
+
+// suggest returns the fix replacing r, the unknown word, with the closest of words if it's
+// likely a typo of it
+func suggest(r d2ast.Range, word string, words []string, kind string) *d2ast.Fix {
+	word = strings.ToLower(word)
+	best, bestDist := "", len(word)/3+1
+	for _, w := range words {
+		if dist := editDistance(word, w); dist < bestDist {
+			best, bestDist = w, dist
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return &d2ast.Fix{
+		Title:   fmt.Sprintf("Change to %s %s", kind, best),
+		Range:   r,
+		NewText: best,
+	}
+}
+
+func styleKeywords() []string {
+	var keywords []string
+	for k := range d2graph.StyleKeywords {
+		keywords = append(keywords, k)
+	}
+	sort.Strings(keywords)
+	return keywords
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,62 @@
+package d2compiler_test
+
+import (
+	"strings"
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2compiler"
+)
+
+func TestDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		text string
+		code string
+		// fix is the NewText of the first fix, if any
+		fix string
+	}{
+		{text: `x: {`, code: d2ast.DIAGNOSTIC_UNTERMINATED, fix: "}"},
+		{text: `x: "y`, code: d2ast.DIAGNOSTIC_UNTERMINATED, fix: `"`},
+		{text: `x: [1; 2`, code: d2ast.DIAGNOSTIC_UNTERMINATED, fix: "]"},
+		{text: `x -> `, code: d2ast.DIAGNOSTIC_SYNTAX},
+		{text: `...@x`, code: d2ast.DIAGNOSTIC_IMPORT},
+		{text: `@x`, code: d2ast.DIAGNOSTIC_IMPORT, fix: "...@x"},
+		{text: `x.shape: rectangel`, code: d2ast.DIAGNOSTIC_UNKNOWN_SHAPE, fix: "rectangle"},
+		{text: `x.shape: blob`, code: d2ast.DIAGNOSTIC_UNKNOWN_SHAPE},
+		{text: `x.style.fil: red`, code: d2ast.DIAGNOSTIC_UNKNOWN_STYLE, fix: "fill"},
+		{text: `x: ${y}`, code: d2ast.DIAGNOSTIC_UNDEFINED_VARIABLE},
+		{text: `classes.a.extends: b`, code: d2ast.DIAGNOSTIC_UNDEFINED_CLASS},
+		{text: `x.link: layers.y`, code: d2ast.DIAGNOSTIC_BOARD_NOT_FOUND},
+		{text: "x -> layers.y.z\nlayers.y: {}", code: d2ast.DIAGNOSTIC_BOARD_NOT_FOUND},
+		{text: `x.near: y`, code: d2ast.DIAGNOSTIC_INVALID_NEAR},
+		{text: `x.style.opacity: 2`, code: d2ast.DIAGNOSTIC_INVALID_VALUE},
+		{text: `direction: diagonal`, code: d2ast.DIAGNOSTIC_INVALID_VALUE},
+		{text: `x.source-arrowhead: diamond`, code: d2ast.DIAGNOSTIC_MISPLACED_KEYWORD},
+		{text: "x\nassert: count(*) == 2", code: d2ast.DIAGNOSTIC_ASSERTION_FAILED},
+		{text: `assert: "*.shape"`, code: d2ast.DIAGNOSTIC_INVALID_ASSERTION},
+	}
+	for _, tc := range testCases {
+		_, _, err := d2compiler.Compile("x.d2", strings.NewReader(tc.text), nil)
+		diags := d2compiler.Diagnostics(err)
+		if !tassert.NotEmpty(t, diags, tc.text) {
+			continue
+		}
+		d := diags[0]
+		tassert.Equal(t, tc.code, d.Code, "%s: %s", tc.text, d.Message)
+		tassert.Equal(t, d2compiler.SeverityError, d.Severity)
+		tassert.False(t, strings.HasPrefix(d.Message, "x.d2:"), d.Message)
+		if tc.fix == "" {
+			tassert.Empty(t, d.Fixes, tc.text)
+			continue
+		}
+		if tassert.NotEmpty(t, d.Fixes, tc.text) {
+			tassert.Equal(t, tc.fix, d.Fixes[0].NewText, tc.text)
+		}
+	}
+
+	tassert.Nil(t, d2compiler.Diagnostics(nil))
+}
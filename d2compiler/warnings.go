@@ -0,0 +1,382 @@
+package d2compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2ir"
+)
+
+// SUPPRESS_WARNINGS starts the comments that suppress warnings, e.g. # d2-ignore, or only the
+// ones with the codes it lists, e.g. # d2-ignore unused-class, duplicate-edge
+const SUPPRESS_WARNINGS = "d2-ignore"
+
+// warnings returns the warnings of g, compiled from ast through m, that aren't suppressed
+func warnings(ast *d2ast.Map, m *d2ir.Map, g *d2graph.Graph) []d2graph.Warning {
+	var ws []d2graph.Warning
+	ws = append(ws, unusedClassWarnings(ast, g)...)
+	ws = append(ws, shadowedVarWarnings(ast)...)
+	ws = append(ws, duplicateEdgeWarnings(g)...)
+	ws = append(ws, emptyGlobWarnings(ast, m)...)
+
+	suppressed := suppressions(ast)
+	seen := make(map[d2graph.Warning]struct{})
+	var kept []d2graph.Warning
+	for _, w := range ws {
+		if _, ok := seen[w]; ok {
+			continue
+		}
+		seen[w] = struct{}{}
+		if suppressed.has(w) {
+			continue
+		}
+		kept = append(kept, w)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Range.Before(kept[j].Range)
+	})
+	return kept
+}
+
+// unusedClassWarnings warns of the classes ast defines that no shape, connection or other
+// class in any board uses. Classes from imports and stylesheets are libraries, so they're not
+// expected to all be used.
+func unusedClassWarnings(ast *d2ast.Map, g *d2graph.Graph) []d2graph.Warning {
+	used := make(map[string]struct{})
+	var useGraph func(g *d2graph.Graph)
+	useGraph = func(g *d2graph.Graph) {
+		for _, c := range g.Root.Classes {
+			used[c] = struct{}{}
+		}
+		for _, obj := range g.Objects {
+			for _, c := range obj.Classes {
+				used[c] = struct{}{}
+			}
+		}
+		for _, e := range g.Edges {
+			for _, c := range e.Classes {
+				used[c] = struct{}{}
+			}
+		}
+		for _, boards := range [][]*d2graph.Graph{g.Layers, g.Scenarios, g.Steps} {
+			for _, b := range boards {
+				useGraph(b)
+			}
+		}
+	}
+	useGraph(g)
+
+	type class struct {
+		name string
+		n    d2ast.Node
+	}
+	var classes []class
+	addClass := func(sb *d2ast.StringBox, value *d2ast.Map) {
+		classes = append(classes, class{sb.Unbox().ScalarString(), sb.Unbox()})
+		if value == nil {
+			return
+		}
+		for _, n := range value.Nodes {
+			if n.MapKey == nil || n.MapKey.Key == nil || len(n.MapKey.Key.Path) != 1 || n.MapKey.Key.Path[0].Unbox().ScalarString() != "extends" {
+				continue
+			}
+			for _, name := range scalarValues(n.MapKey) {
+				for _, name := range strings.Split(name, ",") {
+					used[strings.TrimSpace(name)] = struct{}{}
+				}
+			}
+		}
+	}
+	walkKeys(ast, func(mk *d2ast.Key) bool {
+		if mk.Key == nil || len(mk.Edges) > 0 || mk.Key.Path[0].Unbox().ScalarString() != "classes" {
+			return true
+		}
+		switch {
+		case len(mk.Key.Path) == 1 && mk.Value.Map != nil:
+			for _, n := range mk.Value.Map.Nodes {
+				if n.MapKey != nil && n.MapKey.Key != nil && len(n.MapKey.Edges) == 0 {
+					addClass(n.MapKey.Key.Path[0], n.MapKey.Value.Map)
+				}
+			}
+		case len(mk.Key.Path) == 2:
+			addClass(mk.Key.Path[1], mk.Value.Map)
+		}
+		return false
+	})
+
+	var ws []d2graph.Warning
+	for _, c := range classes {
+		if _, ok := used[c.name]; !ok {
+			ws = append(ws, d2graph.Warning{
+				Code:    d2ast.DIAGNOSTIC_UNUSED_CLASS,
+				Range:   c.n.GetRange(),
+				Message: fmt.Sprintf("class %q is never used", c.name),
+			})
+		}
+	}
+	return ws
+}
+
+// shadowedVarWarnings warns of the vars that have the same name as a var of a map they're
+// in, which they hide from the rest of their map. Boards overriding the vars of the board
+// they're in is how vars are meant to vary between boards, so that isn't warned of.
+func shadowedVarWarnings(ast *d2ast.Map) []d2graph.Warning {
+	var ws []d2graph.Warning
+	var walk func(m *d2ast.Map, outer map[string]d2ast.Range)
+	walk = func(m *d2ast.Map, outer map[string]d2ast.Range) {
+		inner := make(map[string]d2ast.Range, len(outer))
+		for name, r := range outer {
+			inner[name] = r
+		}
+		declared := make(map[string]struct{})
+		declare := func(sb *d2ast.StringBox) {
+			name := sb.Unbox().ScalarString()
+			r := sb.Unbox().GetRange()
+			if _, ok := declared[name]; ok {
+				return
+			}
+			declared[name] = struct{}{}
+			if o, ok := outer[name]; ok {
+				ws = append(ws, d2graph.Warning{
+					Code:    d2ast.DIAGNOSTIC_SHADOWED_VAR,
+					Range:   r,
+					Message: fmt.Sprintf("var %q shadows the var of the same name at %s", name, o),
+				})
+			}
+			inner[name] = r
+		}
+		for _, n := range m.Nodes {
+			mk := n.MapKey
+			if mk == nil || mk.Key == nil || len(mk.Edges) > 0 || mk.Key.Path[0].Unbox().ScalarString() != "vars" {
+				continue
+			}
+			if len(mk.Key.Path) == 1 && mk.Value.Map != nil {
+				for _, n := range mk.Value.Map.Nodes {
+					if n.MapKey != nil && n.MapKey.Key != nil && len(n.MapKey.Edges) == 0 {
+						declare(n.MapKey.Key.Path[0])
+					}
+				}
+			}
+		}
+
+		for _, n := range m.Nodes {
+			mk := n.MapKey
+			if mk == nil || mk.Value.Map == nil {
+				continue
+			}
+			if mk.Key != nil && len(mk.Edges) == 0 {
+				switch mk.Key.Path[0].Unbox().ScalarString() {
+				case "vars", "classes":
+					continue
+				}
+			}
+			board := -1
+			if mk.Key != nil {
+				for i, sb := range mk.Key.Path {
+					if _, ok := d2graph.BoardKeywords[sb.Unbox().ScalarString()]; ok {
+						board = i
+						break
+					}
+				}
+			}
+			switch {
+			case board == -1:
+				walk(mk.Value.Map, inner)
+			case board == len(mk.Key.Path)-1:
+				// The fields of layers and the like are boards
+				for _, n := range mk.Value.Map.Nodes {
+					if n.MapKey != nil && n.MapKey.Value.Map != nil {
+						walk(n.MapKey.Value.Map, nil)
+					}
+				}
+			default:
+				walk(mk.Value.Map, nil)
+			}
+		}
+	}
+	walk(ast, nil)
+	return ws
+}
+
+// duplicateEdgeWarnings warns of the connections of each board between the same shapes in
+// the same direction with the same label as a connection before them, which are drawn on top
+// of each other. Messages of sequence diagrams are repeated on purpose, so they aren't warned
+// of.
+func duplicateEdgeWarnings(g *d2graph.Graph) []d2graph.Warning {
+	var ws []d2graph.Warning
+	seen := make(map[string]*d2graph.Edge)
+	for _, e := range g.Edges {
+		if len(e.References) == 0 || e.References[0].Edge == nil || e.Src.OuterSequenceDiagram() != nil {
+			continue
+		}
+		k := fmt.Sprintf("%s\x00%t\x00%s\x00%t\x00%s", e.Src.AbsID(), e.SrcArrow, e.Dst.AbsID(), e.DstArrow, e.Label.Value)
+		first, ok := seen[k]
+		if !ok {
+			seen[k] = e
+			continue
+		}
+		ws = append(ws, d2graph.Warning{
+			Code:    d2ast.DIAGNOSTIC_DUPLICATE_EDGE,
+			Range:   e.References[0].Edge.Range,
+			Message: fmt.Sprintf("connection %s duplicates %s, which has the same shapes and label, so they're drawn on top of each other", e.AbsID(), first.AbsID()),
+		})
+	}
+	for _, boards := range [][]*d2graph.Graph{g.Layers, g.Scenarios, g.Steps} {
+		for _, b := range boards {
+			ws = append(ws, duplicateEdgeWarnings(b)...)
+		}
+	}
+	return ws
+}
+
+// emptyGlobWarnings warns of the globs of ast that don't match anything in any board they
+// apply to, which are likely typos. Globs that delete what they match are expected to match
+// nothing once they're applied, so they're not warned of.
+func emptyGlobWarnings(ast *d2ast.Map, m *d2ir.Map) []d2graph.Warning {
+	applied := make(map[d2ast.Range]struct{})
+	var walkIR func(m *d2ir.Map)
+	walkIR = func(m *d2ir.Map) {
+		for _, f := range m.Fields {
+			for _, ref := range f.References {
+				if ref.Context_ != nil && ref.Context_.Key != nil {
+					applied[ref.Context_.Key.Range] = struct{}{}
+				}
+			}
+			if fm := f.Map(); fm != nil {
+				walkIR(fm)
+			}
+		}
+		for _, e := range m.Edges {
+			for _, ref := range e.References {
+				if ref.Context_ != nil && ref.Context_.Key != nil {
+					applied[ref.Context_.Key.Range] = struct{}{}
+				}
+			}
+			if e.Map_ != nil {
+				walkIR(e.Map_)
+			}
+		}
+	}
+	walkIR(m)
+
+	var ws []d2graph.Warning
+	walkKeys(ast, func(mk *d2ast.Key) bool {
+		if mk.Key != nil && len(mk.Edges) == 0 {
+			switch mk.Key.Path[0].Unbox().ScalarString() {
+			case "vars", "classes":
+				return false
+			}
+		}
+		if !mk.HasGlob() || mk.Value.Null != nil || mk.Primary.Null != nil {
+			return true
+		}
+		if _, ok := applied[mk.Range]; ok {
+			return true
+		}
+		k := *mk
+		k.Primary = d2ast.ScalarBox{}
+		k.Value = d2ast.ValueBox{}
+		ws = append(ws, d2graph.Warning{
+			Code:    d2ast.DIAGNOSTIC_EMPTY_GLOB,
+			Range:   mk.Range,
+			Message: fmt.Sprintf("%s matches nothing", d2format.Format(&k)),
+		})
+		return false
+	})
+	return ws
+}
+
+// walkKeys calls fn with the keys of m and of the maps in their values, except the values
+// fn returns false for
+func walkKeys(m *d2ast.Map, fn func(*d2ast.Key) bool) {
+	for _, n := range m.Nodes {
+		if n.MapKey == nil {
+			continue
+		}
+		if fn(n.MapKey) && n.MapKey.Value.Map != nil {
+			walkKeys(n.MapKey.Value.Map, fn)
+		}
+	}
+}
+
+// scalarValues returns the value of mk if it's a scalar, or the scalars of its value if it's
+// an array
+func scalarValues(mk *d2ast.Key) []string {
+	if s := mk.Value.ScalarBox().Unbox(); s != nil {
+		return []string{s.ScalarString()}
+	}
+	var values []string
+	if mk.Value.Array != nil {
+		for _, n := range mk.Value.Array.Nodes {
+			if s, ok := n.Unbox().(d2ast.Scalar); ok {
+				values = append(values, s.ScalarString())
+			}
+		}
+	}
+	return values
+}
+
+// warningSuppressions are the codes of the warnings each line's d2-ignore comment suppresses,
+// where nil suppresses all of them
+type warningSuppressions map[suppressionLine][]string
+
+type suppressionLine struct {
+	path string
+	line int
+}
+
+// suppressions finds the d2-ignore comments of ast. A comment after a key suppresses the
+// warnings on its line, and a comment on a line of its own the warnings on the line after it.
+func suppressions(ast *d2ast.Map) warningSuppressions {
+	s := make(warningSuppressions)
+	var walk func(m *d2ast.Map)
+	walk = func(m *d2ast.Map) {
+		prevEnd := -1
+		for _, n := range m.Nodes {
+			switch {
+			case n.Comment != nil:
+				// Comments on consecutive lines are one comment
+				r := n.Comment.Range
+				for i, text := range strings.Split(n.Comment.Value, "\n") {
+					fields := strings.Fields(strings.ReplaceAll(text, ",", " "))
+					if len(fields) == 0 || fields[0] != SUPPRESS_WARNINGS {
+						continue
+					}
+					line := r.Start.Line + i
+					if line != prevEnd {
+						line++
+					}
+					s[suppressionLine{r.Path, line}] = fields[1:]
+				}
+			case n.MapKey != nil && n.MapKey.Value.Map != nil:
+				walk(n.MapKey.Value.Map)
+			}
+			if n.Unbox() != nil {
+				prevEnd = n.Unbox().GetRange().End.Line
+			}
+		}
+	}
+	walk(ast)
+	return s
+}
+
+// has returns whether a d2-ignore comment suppresses w
+func (s warningSuppressions) has(w d2graph.Warning) bool {
+	codes, ok := s[suppressionLine{w.Range.Path, w.Range.Start.Line}]
+	if !ok {
+		return false
+	}
+	if len(codes) == 0 {
+		return true
+	}
+	for _, code := range codes {
+		if code == w.Code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package d2compiler_test
+
+import (
+	"strings"
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+)
+
+func TestWarnings(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		text string
+		// exp are the warnings, as path:line:col: message
+		exp []string
+	}{
+		{
+			name: "unused_class",
+			text: `classes: {
+  used: {style.fill: red}
+  unused: {style.fill: blue}
+  base: {style.bold: true}
+  derived: {extends: base}
+}
+classes.edge: {style.stroke: red}
+a.class: used
+layers: {
+  x: {
+    a -> b: {class: derived}
+  }
+}
+`,
+			exp: []string{
+				`x.d2:3:3: class "unused" is never used`,
+				`x.d2:7:9: class "edge" is never used`,
+			},
+		},
+		{
+			name: "shadowed_var",
+			text: `vars: {
+  color: red
+  size: 12
+}
+a: {
+  vars: {
+    color: blue
+  }
+  b.style.fill: ${color}
+}
+layers: {
+  x: {
+    vars: {
+      color: green
+    }
+  }
+}
+`,
+			exp: []string{
+				`x.d2:7:5: var "color" shadows the var of the same name at x.d2:2:3`,
+			},
+		},
+		{
+			name: "duplicate_edge",
+			text: `a -> b
+a -> b: label
+a -> b
+b -> a
+a <- b
+s: {
+  shape: sequence_diagram
+  x -> y
+  x -> y
+}
+`,
+			exp: []string{
+				`x.d2:3:1: connection (a -> b)[2] duplicates (a -> b)[0], which has the same shapes and label, so they're drawn on top of each other`,
+			},
+		},
+		{
+			name: "empty_glob",
+			text: `a
+*.style.fill: red
+db*.shape: cylinder
+(* -> *)[*].style.stroke: red
+q*: null
+layers: {
+  x: {
+    c
+    ***.style.fill: red
+  }
+}
+`,
+			exp: []string{
+				`x.d2:3:1: db*.shape matches nothing`,
+				`x.d2:4:1: (* -> *)[*].style.stroke matches nothing`,
+			},
+		},
+		{
+			name: "suppressed",
+			text: `a -> b
+a -> b # d2-ignore
+# d2-ignore duplicate-edge
+a -> b
+# d2-ignore unused-class
+a -> b
+classes: {
+  # d2-ignore
+  unused: {style.fill: red}
+}
+`,
+			exp: []string{
+				`x.d2:6:1: connection (a -> b)[3] duplicates (a -> b)[0], which has the same shapes and label, so they're drawn on top of each other`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g, _, err := d2compiler.Compile("x.d2", strings.NewReader(tc.text), nil)
+			tassert.Nil(t, err)
+			var got []string
+			for _, w := range g.Warnings {
+				got = append(got, w.String())
+			}
+			tassert.Equal(t, tc.exp, got)
+
+			diags := d2compiler.WarningDiagnostics(g)
+			for _, d := range diags {
+				tassert.Equal(t, d2compiler.SeverityWarning, d.Severity)
+			}
+		})
+	}
+}
@@ -0,0 +1,492 @@
+// d2graphml converts GraphML documents into D2 scripts, with support for the graphics yEd
+// saves in them.
+//
+// Nodes become objects labeled and styled as in yEd, group nodes and nested graphs become
+// containers, and edges become connections with their arrowheads and labels. Without yEd
+// graphics, labels are read from data with the attribute name "label" or "name". Node
+// positions can optionally be kept with top and left, relative to the node's container.
+package d2graphml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2converters/internal/d2script"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+type ConvertOpts struct {
+	// Positions keeps the geometry of nodes with top, left, width, and height. Only some layout
+	// engines support top and left.
+	Positions bool
+}
+
+// element is any XML element. yEd's graphics are in their own namespace and vary by node
+// type, so the document is walked generically rather than unmarshaled into fixed types.
+type element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []*element `xml:",any"`
+}
+
+func (e *element) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (e *element) child(name string) *element {
+	for _, c := range e.Children {
+		if c.XMLName.Local == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// find returns the first descendant named name, depth first
+func (e *element) find(name string) *element {
+	for _, c := range e.Children {
+		if c.XMLName.Local == name {
+			return c
+		}
+		if found := c.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+type key struct {
+	attrName   string
+	yfilesType string
+}
+
+type object struct {
+	id       string
+	d2ID     string
+	label    string
+	shape    string
+	styles   [][2]string
+	geometry *geometry
+
+	parent   *object
+	children []*object
+	// ids of the object's children
+	ids *d2script.IDs
+}
+
+type geometry struct {
+	x, y, width, height float64
+}
+
+type edge struct {
+	id                 string
+	src, dst           string
+	label              string
+	srcArrow, dstArrow string
+	styles             [][2]string
+}
+
+type converter struct {
+	opts    ConvertOpts
+	keys    map[string]key
+	root    *object
+	objects map[string]*object
+	edges   []*edge
+}
+
+// Convert converts a GraphML document into a formatted D2 script
+func Convert(input string, opts *ConvertOpts) (string, error) {
+	if opts == nil {
+		opts = &ConvertOpts{}
+	}
+	var doc element
+	err := xml.Unmarshal([]byte(input), &doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse GraphML: %w", err)
+	}
+	if doc.XMLName.Local != "graphml" {
+		return "", fmt.Errorf("expected a graphml document but found <%s>", doc.XMLName.Local)
+	}
+
+	c := &converter{
+		opts:    *opts,
+		keys:    make(map[string]key),
+		root:    &object{ids: d2script.NewIDs()},
+		objects: make(map[string]*object),
+	}
+	for _, el := range doc.Children {
+		if el.XMLName.Local == "key" {
+			c.keys[el.attr("id")] = key{
+				attrName:   el.attr("attr.name"),
+				yfilesType: el.attr("yfiles.type"),
+			}
+		}
+	}
+	g := doc.child("graph")
+	if g == nil {
+		return "", fmt.Errorf("GraphML document has no graph")
+	}
+	c.graph(g, c.root, g.attr("edgedefault") != "undirected")
+
+	for _, e := range c.edges {
+		for _, id := range []string{e.src, e.dst} {
+			if _, ok := c.objects[id]; !ok {
+				return "", fmt.Errorf("edge %q references unknown node %q", e.id, id)
+			}
+		}
+	}
+
+	var w d2script.Writer
+	c.write(&w)
+	return w.Format()
+}
+
+func (c *converter) graph(g *element, parent *object, directed bool) {
+	if ed := g.attr("edgedefault"); ed != "" {
+		directed = ed != "undirected"
+	}
+	for _, el := range g.Children {
+		switch el.XMLName.Local {
+		case "node":
+			c.node(el, parent, directed)
+		case "edge":
+			c.edge(el, directed)
+		}
+	}
+}
+
+func (c *converter) node(el *element, parent *object, directed bool) {
+	obj := &object{
+		id:     el.attr("id"),
+		parent: parent,
+		ids:    d2script.NewIDs(),
+	}
+	for _, d := range el.Children {
+		if d.XMLName.Local != "data" {
+			continue
+		}
+		k := c.keys[d.attr("key")]
+		if k.yfilesType == "nodegraphics" {
+			c.nodeGraphics(obj, d)
+			continue
+		}
+		switch strings.ToLower(k.attrName) {
+		case "label", "name":
+			if obj.label == "" {
+				obj.label = strings.TrimSpace(d.Text)
+			}
+		}
+	}
+
+	name := obj.label
+	if name == "" || strings.Contains(name, "\n") {
+		// yEd IDs are paths like n0::n1
+		name = obj.id[strings.LastIndex(obj.id, ":")+1:]
+	}
+	obj.d2ID = parent.ids.Unique(name)
+	if obj.label == obj.d2ID {
+		obj.label = ""
+	}
+	parent.children = append(parent.children, obj)
+	c.objects[obj.id] = obj
+
+	if g := el.child("graph"); g != nil {
+		c.graph(g, obj, directed)
+	}
+}
+
+// nodeGraphics reads the label, shape, style, and geometry of a yEd node
+func (c *converter) nodeGraphics(obj *object, data *element) {
+	var realizer *element
+	for _, el := range data.Children {
+		realizer = el
+	}
+	if realizer == nil {
+		return
+	}
+	// Group nodes have realizers for their open and closed states
+	if realizers := realizer.child("Realizers"); realizers != nil {
+		active, _ := strconv.Atoi(realizers.attr("active"))
+		if active < 0 || active >= len(realizers.Children) {
+			return
+		}
+		realizer = realizers.Children[active]
+	}
+
+	if label := realizer.find("NodeLabel"); label != nil && label.attr("visible") != "false" {
+		obj.label = strings.TrimSpace(label.Text)
+	}
+	if geo := realizer.child("Geometry"); geo != nil {
+		obj.geometry = &geometry{
+			x:      parseFloat(geo.attr("x")),
+			y:      parseFloat(geo.attr("y")),
+			width:  parseFloat(geo.attr("width")),
+			height: parseFloat(geo.attr("height")),
+		}
+	}
+	if shape := realizer.child("Shape"); shape != nil {
+		obj.shape, obj.styles = yShape(shape.attr("type"), obj.geometry)
+	} else if config := realizer.attr("configuration"); config != "" {
+		obj.shape = genericShape(config)
+	}
+	if fill := realizer.child("Fill"); fill != nil && fill.attr("hasColor") != "false" && fill.attr("transparent") != "true" {
+		if color := fill.attr("color"); color != "" {
+			obj.styles = append(obj.styles, [2]string{"fill", color})
+		}
+	}
+	obj.styles = append(obj.styles, lineStyles(realizer.child("BorderStyle"))...)
+}
+
+// yShape maps yEd's shape node types to D2 shapes and styles
+func yShape(typ string, geo *geometry) (string, [][2]string) {
+	switch typ {
+	case "roundrectangle":
+		return "", [][2]string{{"border-radius", "8"}}
+	case "ellipse":
+		if geo != nil && geo.width == geo.height {
+			return d2target.ShapeCircle, nil
+		}
+		return d2target.ShapeOval, nil
+	case "diamond":
+		return d2target.ShapeDiamond, nil
+	case "hexagon":
+		return d2target.ShapeHexagon, nil
+	case "parallelogram":
+		return d2target.ShapeParallelogram, nil
+	}
+	return "", nil
+}
+
+// genericShape maps the configurations of yEd's generic nodes, e.g. the flowchart palette,
+// to D2 shapes
+func genericShape(config string) string {
+	config = strings.TrimPrefix(config, "com.yworks.flowchart.")
+	switch config {
+	case "dataBase":
+		return d2target.ShapeCylinder
+	case "document":
+		return d2target.ShapeDocument
+	case "decision":
+		return d2target.ShapeDiamond
+	case "start1", "start2", "terminator":
+		return d2target.ShapeOval
+	case "data":
+		return d2target.ShapeParallelogram
+	case "cloud":
+		return d2target.ShapeCloud
+	case "storedData", "directData":
+		return d2target.ShapeStoredData
+	case "preparation":
+		return d2target.ShapeHexagon
+	case "paperType", "card":
+		return d2target.ShapePage
+	}
+	return ""
+}
+
+func lineStyles(style *element) [][2]string {
+	if style == nil || style.attr("hasColor") == "false" {
+		return nil
+	}
+	var styles [][2]string
+	if color := style.attr("color"); color != "" {
+		styles = append(styles, [2]string{"stroke", color})
+	}
+	switch style.attr("type") {
+	case "dashed", "dotted", "dashed_dotted":
+		styles = append(styles, [2]string{"stroke-dash", "3"})
+	}
+	if width := parseFloat(style.attr("width")); width > 1 {
+		styles = append(styles, [2]string{"stroke-width", strconv.Itoa(int(math.Min(15, math.Round(width))))})
+	}
+	return styles
+}
+
+func (c *converter) edge(el *element, directed bool) {
+	e := &edge{
+		id:  el.attr("id"),
+		src: el.attr("source"),
+		dst: el.attr("target"),
+	}
+	if d := el.attr("directed"); d != "" {
+		directed = d == "true"
+	}
+	if directed {
+		e.dstArrow = "triangle"
+	}
+	for _, d := range el.Children {
+		if d.XMLName.Local != "data" {
+			continue
+		}
+		k := c.keys[d.attr("key")]
+		if k.yfilesType == "edgegraphics" {
+			for _, realizer := range d.Children {
+				if label := realizer.find("EdgeLabel"); label != nil && label.attr("visible") != "false" {
+					e.label = strings.TrimSpace(label.Text)
+				}
+				if arrows := realizer.child("Arrows"); arrows != nil {
+					e.srcArrow = yArrow(arrows.attr("source"))
+					e.dstArrow = yArrow(arrows.attr("target"))
+				}
+				e.styles = lineStyles(realizer.child("LineStyle"))
+			}
+			continue
+		}
+		switch strings.ToLower(k.attrName) {
+		case "label", "name":
+			if e.label == "" {
+				e.label = strings.TrimSpace(d.Text)
+			}
+		}
+	}
+	c.edges = append(c.edges, e)
+}
+
+// yArrow maps yEd's arrow types to D2 arrowhead shapes, with "" for none
+func yArrow(typ string) string {
+	switch typ {
+	case "", "none":
+		return ""
+	case "diamond":
+		return string(d2target.FilledDiamondArrowhead)
+	case "white_diamond":
+		return string(d2target.DiamondArrowhead)
+	case "circle":
+		return string(d2target.FilledCircleArrowhead)
+	case "transparent_circle":
+		return string(d2target.CircleArrowhead)
+	case "white_delta":
+		return string(d2target.UnfilledTriangleArrowhead)
+	case "t_shape":
+		return string(d2target.TeeArrowhead)
+	case "crows_foot_one":
+		return string(d2target.CfOne)
+	case "crows_foot_many":
+		return string(d2target.CfMany)
+	case "crows_foot_one_mandatory":
+		return string(d2target.CfOneRequired)
+	case "crows_foot_many_mandatory":
+		return string(d2target.CfManyRequired)
+	}
+	return string(d2target.TriangleArrowhead)
+}
+
+func (c *converter) write(w *d2script.Writer) {
+	var origin geometry
+	origin.x, origin.y = math.Inf(1), math.Inf(1)
+	for _, obj := range c.root.children {
+		if obj.geometry != nil {
+			origin.x = math.Min(origin.x, obj.geometry.x)
+			origin.y = math.Min(origin.y, obj.geometry.y)
+		}
+	}
+	for _, obj := range c.root.children {
+		c.writeObject(w, obj, origin)
+	}
+
+	for _, e := range c.edges {
+		op := "-"
+		if e.srcArrow != "" {
+			op = "<" + op
+		}
+		if e.dstArrow != "" {
+			op += ">"
+		} else {
+			op += "-"
+		}
+		k := fmt.Sprintf("%s %s %s", d2script.Key(c.path(c.objects[e.src])...), op, d2script.Key(c.path(c.objects[e.dst])...))
+		var attrs [][2]string
+		if e.srcArrow != "" && e.srcArrow != string(d2target.TriangleArrowhead) {
+			attrs = append(attrs, [2]string{"source-arrowhead.shape", e.srcArrow})
+		}
+		if e.dstArrow != "" && e.dstArrow != string(d2target.TriangleArrowhead) {
+			attrs = append(attrs, [2]string{"target-arrowhead.shape", e.dstArrow})
+		}
+		for _, s := range e.styles {
+			attrs = append(attrs, [2]string{"style." + s[0], d2script.Value(s[1])})
+		}
+		if e.label != "" {
+			k += ": " + d2script.Value(e.label)
+		}
+		if len(attrs) == 0 {
+			w.Line("%s", k)
+			continue
+		}
+		if e.label == "" {
+			k += ":"
+		}
+		w.Open("%s", k)
+		for _, a := range attrs {
+			w.Line("%s: %s", a[0], a[1])
+		}
+		w.Close()
+	}
+}
+
+func (c *converter) writeObject(w *d2script.Writer, obj *object, origin geometry) {
+	k := d2script.Key(obj.d2ID)
+	if obj.label != "" {
+		k += ": " + d2script.Value(obj.label)
+	}
+	var attrs [][2]string
+	if obj.shape != "" {
+		attrs = append(attrs, [2]string{"shape", obj.shape})
+	}
+	for _, s := range obj.styles {
+		attrs = append(attrs, [2]string{"style." + s[0], d2script.Value(s[1])})
+	}
+	if c.opts.Positions && obj.geometry != nil && !math.IsInf(origin.x, 0) {
+		attrs = append(attrs,
+			[2]string{"top", strconv.Itoa(int(math.Round(obj.geometry.y - origin.y)))},
+			[2]string{"left", strconv.Itoa(int(math.Round(obj.geometry.x - origin.x)))},
+		)
+		// Containers are sized by their children
+		if len(obj.children) == 0 {
+			attrs = append(attrs,
+				[2]string{"width", strconv.Itoa(int(math.Round(obj.geometry.width)))},
+				[2]string{"height", strconv.Itoa(int(math.Round(obj.geometry.height)))},
+			)
+		}
+	}
+	if len(attrs) == 0 && len(obj.children) == 0 {
+		w.Line("%s", k)
+		return
+	}
+	if obj.label == "" {
+		k += ":"
+	}
+	w.Open("%s", k)
+	for _, a := range attrs {
+		w.Line("%s: %s", a[0], a[1])
+	}
+	childOrigin := geometry{x: math.Inf(1), y: math.Inf(1)}
+	if obj.geometry != nil {
+		childOrigin = *obj.geometry
+	}
+	for _, child := range obj.children {
+		c.writeObject(w, child, childOrigin)
+	}
+	w.Close()
+}
+
+func (c *converter) path(obj *object) []string {
+	var ida []string
+	for ; obj != c.root; obj = obj.parent {
+		ida = append([]string{obj.d2ID}, ida...)
+	}
+	return ida
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
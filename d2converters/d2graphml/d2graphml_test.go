@@ -0,0 +1,215 @@
+package d2graphml_test
+
+import (
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2converters/d2graphml"
+)
+
+const yEd = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:y="http://www.yworks.com/xml/graphml">
+  <key for="node" id="d6" yfiles.type="nodegraphics"/>
+  <key for="edge" id="d10" yfiles.type="edgegraphics"/>
+  <graph edgedefault="directed" id="G">
+    <node id="n0" yfiles.foldertype="group">
+      <data key="d6">
+        <y:ProxyAutoBoundsNode>
+          <y:Realizers active="0">
+            <y:GroupNode>
+              <y:Geometry height="200.0" width="300.0" x="100.0" y="50.0"/>
+              <y:Fill color="#F5F5F5" transparent="false"/>
+              <y:BorderStyle color="#000000" type="dashed" width="1.0"/>
+              <y:NodeLabel>Backend</y:NodeLabel>
+              <y:Shape type="roundrectangle"/>
+            </y:GroupNode>
+            <y:GroupNode>
+              <y:Geometry height="50.0" width="50.0" x="100.0" y="50.0"/>
+              <y:NodeLabel>Folded</y:NodeLabel>
+            </y:GroupNode>
+          </y:Realizers>
+        </y:ProxyAutoBoundsNode>
+      </data>
+      <graph edgedefault="directed" id="n0:">
+        <node id="n0::n0">
+          <data key="d6">
+            <y:ShapeNode>
+              <y:Geometry height="30.0" width="80.0" x="120.0" y="100.0"/>
+              <y:Fill color="#FFCC00" transparent="false"/>
+              <y:NodeLabel>API</y:NodeLabel>
+              <y:Shape type="rectangle"/>
+            </y:ShapeNode>
+          </data>
+        </node>
+        <node id="n0::n1">
+          <data key="d6">
+            <y:GenericNode configuration="com.yworks.flowchart.dataBase">
+              <y:Geometry height="40.0" width="40.0" x="250.0" y="180.0"/>
+              <y:Fill hasColor="false" transparent="false"/>
+              <y:NodeLabel>users
+db</y:NodeLabel>
+            </y:GenericNode>
+          </data>
+        </node>
+      </graph>
+    </node>
+    <node id="n1">
+      <data key="d6">
+        <y:ShapeNode>
+          <y:Geometry height="40.0" width="40.0" x="0.0" y="0.0"/>
+          <y:NodeLabel>label</y:NodeLabel>
+          <y:Shape type="ellipse"/>
+        </y:ShapeNode>
+      </data>
+    </node>
+    <edge id="e0" source="n1" target="n0::n0">
+      <data key="d10">
+        <y:PolyLineEdge>
+          <y:LineStyle color="#000000" type="line" width="1.0"/>
+          <y:Arrows source="none" target="standard"/>
+          <y:EdgeLabel>calls</y:EdgeLabel>
+        </y:PolyLineEdge>
+      </data>
+    </edge>
+    <edge id="e1" source="n0::n0" target="n0::n1">
+      <data key="d10">
+        <y:PolyLineEdge>
+          <y:LineStyle color="#FF0000" type="dashed" width="3.0"/>
+          <y:Arrows source="crows_foot_one" target="crows_foot_many"/>
+        </y:PolyLineEdge>
+      </data>
+    </edge>
+  </graph>
+</graphml>
+`
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		in        string
+		positions bool
+		exp       string
+		expErr    string
+	}{
+		{
+			name: "yed",
+			in:   yEd,
+			exp: `Backend: {
+  style.border-radius: 8
+  style.fill: "#F5F5F5"
+  style.stroke: "#000000"
+  style.stroke-dash: 3
+  API: {
+    style.fill: "#FFCC00"
+  }
+  n1: "users\ndb" {
+    shape: cylinder
+  }
+}
+label_2: label {
+  shape: circle
+}
+label_2 -> Backend.API: calls {
+  style.stroke: "#000000"
+}
+Backend.API <-> Backend.n1: {
+  source-arrowhead.shape: cf-one
+  target-arrowhead.shape: cf-many
+  style.stroke: "#FF0000"
+  style.stroke-dash: 3
+  style.stroke-width: 3
+}
+`,
+		},
+		{
+			name:      "positions",
+			positions: true,
+			in:        yEd,
+			exp: `Backend: {
+  style.border-radius: 8
+  style.fill: "#F5F5F5"
+  style.stroke: "#000000"
+  style.stroke-dash: 3
+  top: 50
+  left: 100
+  API: {
+    style.fill: "#FFCC00"
+    top: 50
+    left: 20
+    width: 80
+    height: 30
+  }
+  n1: "users\ndb" {
+    shape: cylinder
+    top: 130
+    left: 150
+    width: 40
+    height: 40
+  }
+}
+label_2: label {
+  shape: circle
+  top: 0
+  left: 0
+  width: 40
+  height: 40
+}
+label_2 -> Backend.API: calls {
+  style.stroke: "#000000"
+}
+Backend.API <-> Backend.n1: {
+  source-arrowhead.shape: cf-one
+  target-arrowhead.shape: cf-many
+  style.stroke: "#FF0000"
+  style.stroke-dash: 3
+  style.stroke-width: 3
+}
+`,
+		},
+		{
+			name: "plain",
+			in: `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="k0" for="node" attr.name="name" attr.type="string"/>
+  <graph edgedefault="undirected">
+    <node id="a"><data key="k0">Alice</data></node>
+    <node id="b"/>
+    <edge source="a" target="b"/>
+    <edge source="b" target="a" directed="true"/>
+  </graph>
+</graphml>`,
+			exp: `Alice
+b
+Alice -- b
+b -> Alice
+`,
+		},
+		{
+			name:   "unknown_node",
+			in:     `<graphml><graph><node id="a"/><edge id="e0" source="a" target="b"/></graph></graphml>`,
+			expErr: `edge "e0" references unknown node "b"`,
+		},
+		{
+			name:   "not_graphml",
+			in:     `<svg></svg>`,
+			expErr: `expected a graphml document but found <svg>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := d2graphml.Convert(tc.in, &d2graphml.ConvertOpts{Positions: tc.positions})
+			if tc.expErr != "" {
+				assert.ErrorString(t, err, tc.expErr)
+				return
+			}
+			assert.Success(t, err)
+			assert.String(t, tc.exp, out)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// d2mermaid converts Mermaid diagrams into D2 scripts.
+//
+// Subsets of flowcharts and sequence diagrams are supported: nodes and their shapes,
+// links, subgraphs, classes and styles for flowcharts, and participants, messages, notes,
+// and blocks like loop and alt for sequence diagrams. Anything else is ignored, so the
+// result is a starting point rather than an exact reproduction.
+package d2mermaid
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2converters/internal/d2script"
+)
+
+// Convert converts a Mermaid flowchart or sequence diagram into a formatted D2 script
+func Convert(input string) (string, error) {
+	lines := statements(input)
+	if len(lines) == 0 {
+		return "", fmt.Errorf("empty diagram")
+	}
+
+	var w d2script.Writer
+	header := lines[0]
+	kind := strings.Fields(header.text)[0]
+	var err error
+	switch kind {
+	case "flowchart", "graph":
+		err = convertFlowchart(&w, header, lines[1:])
+	case "sequenceDiagram":
+		err = convertSequence(&w, lines[1:])
+	default:
+		return "", fmt.Errorf("line %d: unsupported diagram type %q, only flowchart and sequenceDiagram are supported", header.line, kind)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return w.Format()
+}
+
+type statement struct {
+	text string
+	line int
+}
+
+// statements splits input into trimmed statements, dropping comments and blank lines.
+// Statements can be separated by newlines or semicolons.
+func statements(input string) []statement {
+	var stmts []statement
+	sc := bufio.NewScanner(strings.NewReader(input))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(text, "%%") {
+			continue
+		}
+		for _, s := range splitOutsideQuotes(text, ';') {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				stmts = append(stmts, statement{text: s, line: line})
+			}
+		}
+	}
+	return stmts
+}
+
+func splitOutsideQuotes(s string, sep rune) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// label cleans up Mermaid label text
+func label(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	for _, br := range []string{"<br>", "<br/>", "<br />"} {
+		s = strings.ReplaceAll(s, br, "\n")
+	}
+	return s
+}
+
+// ids maps Mermaid IDs to D2 IDs. Mermaid IDs are case sensitive and can be D2 keywords,
+// so those are renamed to stay distinct and valid.
+type ids struct {
+	d2IDs  map[string]string
+	unique *d2script.IDs
+}
+
+func newIDs() *ids {
+	return &ids{
+		d2IDs:  make(map[string]string),
+		unique: d2script.NewIDs(),
+	}
+}
+
+func (ids *ids) get(id string) string {
+	if d2ID, ok := ids.d2IDs[id]; ok {
+		return d2ID
+	}
+	d2ID := ids.unique.Unique(id)
+	ids.d2IDs[id] = d2ID
+	return d2ID
+}
@@ -0,0 +1,206 @@
+package d2mermaid_test
+
+import (
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2converters/d2mermaid"
+)
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		in     string
+		exp    string
+		expErr string
+	}{
+		{
+			name: "flowchart",
+			in: `flowchart LR
+  A[Start] --> B{Is it?}
+  B -->|Yes| C[OK]; C --> D(Rethink)
+  D -.-> B
+  B -- No ----> E((End))
+  A & B ==> F([pill]):::hot
+  %% comment
+  classDef hot fill:#f96,stroke-width:4px
+  style E fill:#bbf,color:#fff
+  click A "https://example.com"
+`,
+			exp: `direction: right
+classes: {
+  hot: {
+    style.fill: "#f96"
+    style.stroke-width: 4
+  }
+}
+A: Start {
+  link: https://example.com
+}
+B: Is it? {
+  shape: diamond
+}
+C: OK
+D: Rethink {
+  style.border-radius: 8
+}
+E: End {
+  shape: circle
+  style.fill: "#bbf"
+  style.font-color: "#fff"
+}
+F: pill {
+  shape: oval
+  class: hot
+}
+A -> B
+B -> C: Yes
+C -> D
+D -> B: {
+  style.stroke-dash: 3
+}
+B -> E: No
+A -> F: {
+  style.stroke-width: 4
+}
+B -> F: {
+  style.stroke-width: 4
+}
+`,
+		},
+		{
+			name: "subgraphs",
+			in: `graph TD
+  a --> b
+  subgraph one [First]
+    direction LR
+    b --> c[(db)]
+    subgraph two
+      d
+    end
+  end
+  c --- d
+`,
+			exp: `a
+one: First {
+  direction: right
+  b
+  c: db {
+    shape: cylinder
+  }
+  two: {
+    d
+  }
+}
+a -> one.b
+one.b -> one.c
+one.c -- one.two.d
+`,
+		},
+		{
+			name: "keywords",
+			in: `flowchart
+  shape --> Shape --> label
+`,
+			exp: `shape_2: shape
+Shape_3: Shape
+label_2: label
+shape_2 -> Shape_3
+Shape_3 -> label_2
+`,
+		},
+		{
+			name: "sequence",
+			in: `sequenceDiagram
+  participant A as Alice
+  actor B as Bob
+  A->>+B: Hello Bob
+  B-->>-A: Hi
+  loop Every minute
+    A-)C: ping
+  end
+  alt ok
+    C->>A: yes
+  else not ok
+    C-xA: no
+    Note over A,C: a note
+  end
+  Note right of B: thinking
+`,
+			exp: `shape: sequence_diagram
+A: Alice
+B: Bob {
+  shape: person
+}
+C
+A -> B: Hello Bob
+B -> A: Hi {
+  style.stroke-dash: 3
+}
+loop 1: loop Every minute {
+  A -> C: ping
+}
+alt 2: alt ok {
+  C -> A: yes
+}
+else 3: else not ok {
+  C -> A: no
+  A.note 1: a note
+}
+B.note 2: thinking
+`,
+		},
+		{
+			name: "empty_style",
+			in: `flowchart
+  A --> B
+  style A stroke-dasharray:,fill:#f9f
+  style B stroke-dasharray:
+`,
+			exp: `A: {
+  style.fill: "#f9f"
+}
+B
+A -> B
+`,
+		},
+		{
+			name:   "style_without_id",
+			in:     "flowchart\n  A --> B\n  style\n",
+			expErr: `line 3: style needs the ID of a node`,
+		},
+		{
+			name:   "unsupported",
+			in:     "pie\n  \"a\": 1\n",
+			expErr: `line 1: unsupported diagram type "pie", only flowchart and sequenceDiagram are supported`,
+		},
+		{
+			name:   "unclosed_subgraph",
+			in:     "flowchart\n  subgraph a\n  b\n",
+			expErr: `subgraph "a" is missing its end`,
+		},
+		{
+			name:   "bad_statement",
+			in:     "sequenceDiagram\n  A->>B: hi\n  what is this\n",
+			expErr: `line 3: unsupported statement "what is this"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := d2mermaid.Convert(tc.in)
+			if tc.expErr != "" {
+				assert.ErrorString(t, err, tc.expErr)
+				return
+			}
+			assert.Success(t, err)
+			assert.String(t, tc.exp, out)
+		})
+	}
+}
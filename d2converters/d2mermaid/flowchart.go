@@ -0,0 +1,544 @@
+package d2mermaid
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"oss.terrastruct.com/d2/d2converters/internal/d2script"
+)
+
+type fcObject struct {
+	d2ID  string
+	label string
+	shape string
+	// extra style pairs implied by the Mermaid shape, e.g. border-radius for rounded nodes
+	shapeStyles [][2]string
+	styles      [][2]string
+	classes     []string
+	link        string
+	direction   string
+
+	isSubgraph bool
+	parent     *fcObject
+	children   []*fcObject
+}
+
+type fcEdge struct {
+	src, dst           *fcObject
+	srcArrow, dstArrow string
+	label              string
+	thick, dotted      bool
+}
+
+type flowchart struct {
+	ids       *ids
+	root      *fcObject
+	objects   map[string]*fcObject
+	edges     []*fcEdge
+	classDefs [][2]string
+	classes   map[string][][2]string
+	// subgraphs being declared, innermost last
+	stack []*fcObject
+}
+
+var directions = map[string]string{
+	"TB": "down",
+	"TD": "down",
+	"BT": "up",
+	"LR": "right",
+	"RL": "left",
+}
+
+func convertFlowchart(w *d2script.Writer, header statement, stmts []statement) error {
+	fc := &flowchart{
+		ids:     newIDs(),
+		root:    &fcObject{},
+		objects: make(map[string]*fcObject),
+		classes: make(map[string][][2]string),
+	}
+	if fields := strings.Fields(header.text); len(fields) > 1 {
+		fc.root.direction = directions[strings.ToUpper(fields[1])]
+	}
+
+	for _, stmt := range stmts {
+		err := fc.statement(stmt.text)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", stmt.line, err)
+		}
+	}
+	if len(fc.stack) > 0 {
+		sg := fc.stack[len(fc.stack)-1]
+		name := sg.label
+		if name == "" {
+			name = sg.d2ID
+		}
+		return fmt.Errorf("subgraph %q is missing its end", name)
+	}
+
+	fc.write(w)
+	return nil
+}
+
+func (fc *flowchart) current() *fcObject {
+	if len(fc.stack) == 0 {
+		return fc.root
+	}
+	return fc.stack[len(fc.stack)-1]
+}
+
+func (fc *flowchart) statement(s string) error {
+	keyword, rest, _ := strings.Cut(s, " ")
+	rest = strings.TrimSpace(rest)
+	switch keyword {
+	case "subgraph":
+		return fc.subgraph(rest)
+	case "end":
+		if len(fc.stack) == 0 {
+			return fmt.Errorf("end without subgraph")
+		}
+		fc.stack = fc.stack[:len(fc.stack)-1]
+		return nil
+	case "direction":
+		fc.current().direction = directions[strings.ToUpper(rest)]
+		return nil
+	case "classDef":
+		names, props, _ := strings.Cut(rest, " ")
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := fc.classes[name]; !ok {
+				fc.classDefs = append(fc.classDefs, [2]string{name})
+			}
+			fc.classes[name] = parseStyles(props)
+		}
+		return nil
+	case "class":
+		nodes, class, _ := strings.Cut(rest, " ")
+		for _, id := range strings.Split(nodes, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				return fmt.Errorf("class needs the IDs of nodes")
+			}
+			obj := fc.object(id)
+			obj.classes = append(obj.classes, strings.TrimSpace(class))
+		}
+		return nil
+	case "style":
+		id, props, _ := strings.Cut(rest, " ")
+		if id == "" {
+			return fmt.Errorf("style needs the ID of a node")
+		}
+		obj := fc.object(id)
+		obj.styles = append(obj.styles, parseStyles(props)...)
+		return nil
+	case "click":
+		id, action, _ := strings.Cut(rest, " ")
+		if id == "" {
+			return fmt.Errorf("click needs the ID of a node")
+		}
+		action = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(action), "href"))
+		if strings.HasPrefix(action, `"`) {
+			if url, _, ok := strings.Cut(action[1:], `"`); ok {
+				fc.object(id).link = url
+			}
+		}
+		return nil
+	case "linkStyle", "accTitle", "accDescr", "title":
+		return nil
+	}
+	return fc.chain(s)
+}
+
+func (fc *flowchart) subgraph(rest string) error {
+	var id, title string
+	if i := strings.IndexByte(rest, '['); i > 0 && strings.HasSuffix(rest, "]") {
+		id = strings.TrimSpace(rest[:i])
+		title = label(rest[i+1 : len(rest)-1])
+	} else {
+		title = label(rest)
+		id = title
+	}
+	if id == "" {
+		return fmt.Errorf("subgraph needs an ID or title")
+	}
+	sg := fc.object(id)
+	sg.isSubgraph = true
+	if title != id {
+		sg.label = title
+	}
+	fc.place(sg)
+	fc.stack = append(fc.stack, sg)
+	return nil
+}
+
+// object returns the node or subgraph with id, creating it in the root if it's new
+func (fc *flowchart) object(id string) *fcObject {
+	if obj, ok := fc.objects[id]; ok {
+		return obj
+	}
+	obj := &fcObject{
+		d2ID:   fc.ids.get(id),
+		parent: fc.root,
+	}
+	if obj.d2ID != id {
+		obj.label = id
+	}
+	fc.root.children = append(fc.root.children, obj)
+	fc.objects[id] = obj
+	return obj
+}
+
+// place moves obj into the subgraph being declared, as Mermaid puts nodes into the first
+// subgraph that mentions them
+func (fc *flowchart) place(obj *fcObject) {
+	cur := fc.current()
+	if cur == fc.root || obj.parent != fc.root || obj == cur {
+		return
+	}
+	for p := cur; p != nil; p = p.parent {
+		if p == obj {
+			return
+		}
+	}
+	siblings := fc.root.children
+	for i, c := range siblings {
+		if c == obj {
+			fc.root.children = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	obj.parent = cur
+	cur.children = append(cur.children, obj)
+}
+
+var (
+	textLinkRegex   = regexp.MustCompile(`^([<ox]?)(--|==|-\.)\s+(.+?)\s+(-{2,}|={2,}|\.-+)([>ox]?)`)
+	simpleLinkRegex = regexp.MustCompile(`^([<ox]?)(-{2,}|={2,}|-\.+-)([>ox]?)(?:\s*\|([^|]*)\|)?`)
+)
+
+// chain parses statements like A[Start] --> B & C -->|label| D
+func (fc *flowchart) chain(s string) error {
+	var prev []*fcObject
+	for {
+		var group []*fcObject
+		for {
+			var obj *fcObject
+			var err error
+			obj, s, err = fc.node(s)
+			if err != nil {
+				return err
+			}
+			group = append(group, obj)
+			s = strings.TrimSpace(s)
+			if !strings.HasPrefix(s, "&") {
+				break
+			}
+			s = strings.TrimSpace(s[1:])
+		}
+		if prev != nil {
+			e := fc.edges[len(fc.edges)-1]
+			fc.edges = fc.edges[:len(fc.edges)-1]
+			for _, src := range prev {
+				for _, dst := range group {
+					e2 := *e
+					e2.src, e2.dst = src, dst
+					fc.edges = append(fc.edges, &e2)
+				}
+			}
+		}
+		if s == "" {
+			return nil
+		}
+
+		e := &fcEdge{}
+		var start, line, end string
+		if m := textLinkRegex.FindStringSubmatch(s); m != nil {
+			start, line, end = m[1], m[2]+m[4], m[5]
+			e.label = label(m[3])
+			s = s[len(m[0]):]
+		} else if m := simpleLinkRegex.FindStringSubmatch(s); m != nil {
+			start, line, end = m[1], m[2], m[3]
+			e.label = label(m[4])
+			s = s[len(m[0]):]
+		} else {
+			return fmt.Errorf("expected a link at %q", s)
+		}
+		e.srcArrow = arrowhead(start)
+		e.dstArrow = arrowhead(end)
+		e.thick = strings.Contains(line, "=")
+		e.dotted = strings.Contains(line, ".")
+		fc.edges = append(fc.edges, e)
+		s = strings.TrimSpace(s)
+		prev = group
+	}
+}
+
+func arrowhead(marker string) string {
+	switch marker {
+	case "":
+		return ""
+	case "o":
+		return "circle"
+	default:
+		return "triangle"
+	}
+}
+
+var nodeShapes = []struct {
+	open, close string
+	shape       string
+	styles      [][2]string
+}{
+	{"(((", ")))", "circle", [][2]string{{"double-border", "true"}}},
+	{"([", "])", "oval", nil},
+	{"[[", "]]", "", [][2]string{{"double-border", "true"}}},
+	{"[(", ")]", "cylinder", nil},
+	{"((", "))", "circle", nil},
+	{"{{", "}}", "hexagon", nil},
+	{"[/", "/]", "parallelogram", nil},
+	{"[\\", "\\]", "parallelogram", nil},
+	{"[/", "\\]", "", nil},
+	{"[\\", "/]", "", nil},
+	{"(", ")", "", [][2]string{{"border-radius", "8"}}},
+	{"[", "]", "", nil},
+	{"{", "}", "diamond", nil},
+	{">", "]", "", nil},
+}
+
+// node parses a node reference with its optional shape, label and class, e.g. A{Decide}:::big
+func (fc *flowchart) node(s string) (*fcObject, string, error) {
+	i := 0
+	for i < len(s) {
+		r := rune(s[i])
+		if r == '-' && i+1 < len(s) && isIDChar(rune(s[i+1])) && s[i+1] != '-' {
+			i++
+			continue
+		}
+		if !isIDChar(r) {
+			break
+		}
+		i++
+	}
+	if i == 0 {
+		return nil, s, fmt.Errorf("expected a node at %q", s)
+	}
+	id := s[:i]
+	s = s[i:]
+	obj := fc.object(id)
+	fc.place(obj)
+
+	for _, ns := range nodeShapes {
+		if !strings.HasPrefix(s, ns.open) {
+			continue
+		}
+		body := s[len(ns.open):]
+		var text string
+		if strings.HasPrefix(body, `"`) {
+			end := strings.IndexByte(body[1:], '"')
+			if end == -1 || !strings.HasPrefix(body[end+2:], ns.close) {
+				continue
+			}
+			text = body[1 : end+1]
+			s = body[end+2+len(ns.close):]
+		} else {
+			end := strings.Index(body, ns.close)
+			if end == -1 {
+				continue
+			}
+			text = body[:end]
+			s = body[end+len(ns.close):]
+		}
+		obj.label = label(text)
+		obj.shape = ns.shape
+		obj.shapeStyles = ns.styles
+		break
+	}
+
+	if strings.HasPrefix(s, ":::") {
+		s = s[3:]
+		j := 0
+		for j < len(s) && (isIDChar(rune(s[j])) || s[j] == '-') {
+			j++
+		}
+		obj.classes = append(obj.classes, s[:j])
+		s = s[j:]
+	}
+	return obj, s, nil
+}
+
+func isIDChar(r rune) bool {
+	return r == '_' || r >= 0x80 || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parseStyles converts CSS like fill:#f9f,stroke-width:4px into D2 style keywords and values.
+// Properties D2 has no equivalent for are dropped.
+func parseStyles(css string) [][2]string {
+	var styles [][2]string
+	for _, decl := range splitOutsideParens(css) {
+		prop, val, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		prop = strings.TrimSpace(prop)
+		val = strings.TrimSpace(val)
+		switch prop {
+		case "fill", "stroke", "opacity":
+			styles = append(styles, [2]string{prop, val})
+		case "color":
+			styles = append(styles, [2]string{"font-color", val})
+		case "stroke-width", "font-size":
+			if n, ok := pixels(val); ok {
+				styles = append(styles, [2]string{prop, n})
+			}
+		case "stroke-dasharray":
+			dashes := strings.Fields(strings.ReplaceAll(val, ",", " "))
+			if len(dashes) == 0 {
+				continue
+			}
+			if n, ok := pixels(dashes[0]); ok {
+				styles = append(styles, [2]string{"stroke-dash", n})
+			}
+		}
+	}
+	return styles
+}
+
+func pixels(s string) (string, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "px"), 64)
+	if err != nil {
+		return "", false
+	}
+	return strconv.Itoa(int(f)), true
+}
+
+func splitOutsideParens(s string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func (fc *flowchart) write(w *d2script.Writer) {
+	if fc.root.direction != "" && fc.root.direction != "down" {
+		w.Line("direction: %s", fc.root.direction)
+	}
+	if len(fc.classDefs) > 0 {
+		w.Open("classes:")
+		for _, def := range fc.classDefs {
+			w.Open("%s:", d2script.Key(def[0]))
+			writeStyles(w, fc.classes[def[0]])
+			w.Close()
+		}
+		w.Close()
+	}
+	for _, obj := range fc.root.children {
+		fc.writeObject(w, obj)
+	}
+	for _, e := range fc.edges {
+		op := "-"
+		if e.srcArrow != "" {
+			op = "<" + op
+		}
+		if e.dstArrow != "" {
+			op += ">"
+		} else {
+			op += "-"
+		}
+		k := fmt.Sprintf("%s %s %s", d2script.Key(fc.path(e.src)...), op, d2script.Key(fc.path(e.dst)...))
+		var attrs [][2]string
+		if e.srcArrow == "circle" {
+			attrs = append(attrs, [2]string{"source-arrowhead.shape", "circle"})
+		}
+		if e.dstArrow == "circle" {
+			attrs = append(attrs, [2]string{"target-arrowhead.shape", "circle"})
+		}
+		if e.thick {
+			attrs = append(attrs, [2]string{"style.stroke-width", "4"})
+		}
+		if e.dotted {
+			attrs = append(attrs, [2]string{"style.stroke-dash", "3"})
+		}
+		if e.label != "" {
+			k += ": " + d2script.Value(e.label)
+		}
+		if len(attrs) == 0 {
+			w.Line("%s", k)
+			continue
+		}
+		w.Open("%s", k)
+		for _, a := range attrs {
+			w.Line("%s: %s", a[0], a[1])
+		}
+		w.Close()
+	}
+}
+
+func (fc *flowchart) writeObject(w *d2script.Writer, obj *fcObject) {
+	k := d2script.Key(obj.d2ID)
+	if obj.label != "" {
+		k += ": " + d2script.Value(obj.label)
+	}
+	styles := append(append([][2]string{}, obj.shapeStyles...), obj.styles...)
+	if obj.shape == "" && len(styles) == 0 && len(obj.classes) == 0 && obj.link == "" && obj.direction == "" && len(obj.children) == 0 {
+		w.Line("%s", k)
+		return
+	}
+	if !strings.Contains(k, ":") {
+		k += ":"
+	}
+	w.Open("%s", k)
+	if obj.direction != "" {
+		w.Line("direction: %s", obj.direction)
+	}
+	if obj.shape != "" {
+		w.Line("shape: %s", obj.shape)
+	}
+	switch len(obj.classes) {
+	case 0:
+	case 1:
+		w.Line("class: %s", d2script.Value(obj.classes[0]))
+	default:
+		var classes []string
+		for _, c := range obj.classes {
+			classes = append(classes, d2script.Value(c))
+		}
+		w.Line("class: [%s]", strings.Join(classes, "; "))
+	}
+	if obj.link != "" {
+		w.Line("link: %s", d2script.Value(obj.link))
+	}
+	writeStyles(w, styles)
+	for _, child := range obj.children {
+		fc.writeObject(w, child)
+	}
+	w.Close()
+}
+
+func writeStyles(w *d2script.Writer, styles [][2]string) {
+	for _, s := range styles {
+		w.Line("style.%s: %s", s[0], d2script.Value(s[1]))
+	}
+}
+
+func (fc *flowchart) path(obj *fcObject) []string {
+	var ida []string
+	for ; obj != fc.root; obj = obj.parent {
+		ida = append([]string{obj.d2ID}, ida...)
+	}
+	return ida
+}
@@ -0,0 +1,232 @@
+package d2mermaid
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2converters/internal/d2script"
+)
+
+type seqParticipant struct {
+	d2ID  string
+	label string
+	actor bool
+}
+
+type seqItem interface {
+	write(w *d2script.Writer)
+}
+
+type seqMessage struct {
+	src, dst string
+	op       string
+	label    string
+	dashed   bool
+}
+
+type seqNote struct {
+	actor string
+	d2ID  string
+	label string
+}
+
+type seqGroup struct {
+	d2ID  string
+	label string
+	items []seqItem
+}
+
+type sequence struct {
+	ids          *ids
+	participants map[string]*seqParticipant
+	order        []*seqParticipant
+	root         *seqGroup
+	// open blocks, innermost last. Blocks without a D2 equivalent, like box and rect, are nil.
+	stack  []*seqGroup
+	notes  int
+	groups int
+}
+
+var (
+	participantRegex = regexp.MustCompile(`^(?:create\s+)?(participant|actor)\s+(.+?)(?:\s+as\s+(.+))?$`)
+	messageRegex     = regexp.MustCompile(`^(.+?)\s*(<<-->>|<<->>|-->>|->>|-->|->|--x|-x|--\)|-\))\s*[+-]?\s*([^:]+?)\s*(?::\s*(.*))?$`)
+	noteRegex        = regexp.MustCompile(`(?i)^note\s+(?:left of|right of|over)\s+([^:]+?)\s*:\s*(.*)$`)
+)
+
+var seqBlocks = map[string]bool{
+	"loop":     true,
+	"alt":      true,
+	"opt":      true,
+	"par":      true,
+	"critical": true,
+	"break":    true,
+}
+
+func convertSequence(w *d2script.Writer, stmts []statement) error {
+	s := &sequence{
+		ids:          newIDs(),
+		participants: make(map[string]*seqParticipant),
+		root:         &seqGroup{},
+	}
+	for _, stmt := range stmts {
+		err := s.statement(stmt.text)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", stmt.line, err)
+		}
+	}
+	if len(s.stack) > 0 {
+		return fmt.Errorf("block is missing its end")
+	}
+
+	w.Line("shape: sequence_diagram")
+	for _, p := range s.order {
+		k := d2script.Key(p.d2ID)
+		if p.label != "" {
+			k += ": " + d2script.Value(p.label)
+		}
+		if p.actor {
+			if p.label == "" {
+				k += ":"
+			}
+			w.Open("%s", k)
+			w.Line("shape: person")
+			w.Close()
+		} else {
+			w.Line("%s", k)
+		}
+	}
+	for _, item := range s.root.items {
+		item.write(w)
+	}
+	return nil
+}
+
+func (s *sequence) statement(text string) error {
+	keyword, rest, _ := strings.Cut(text, " ")
+	rest = strings.TrimSpace(rest)
+	switch keyword {
+	case "autonumber", "activate", "deactivate", "title", "destroy", "link", "links", "properties", "details", "accTitle", "accDescr":
+		return nil
+	case "box", "rect":
+		s.stack = append(s.stack, nil)
+		return nil
+	case "end":
+		if len(s.stack) == 0 {
+			return fmt.Errorf("end without block")
+		}
+		s.stack = s.stack[:len(s.stack)-1]
+		return nil
+	case "else", "and", "option":
+		if len(s.stack) == 0 || s.stack[len(s.stack)-1] == nil {
+			return fmt.Errorf("%s outside of a block", keyword)
+		}
+		s.stack = s.stack[:len(s.stack)-1]
+		s.stack = append(s.stack, s.group(keyword, rest))
+		return nil
+	}
+	if seqBlocks[keyword] {
+		s.stack = append(s.stack, s.group(keyword, rest))
+		return nil
+	}
+
+	if m := participantRegex.FindStringSubmatch(text); m != nil {
+		p := s.participant(m[2])
+		p.actor = m[1] == "actor"
+		if m[3] != "" {
+			p.label = label(m[3])
+		}
+		return nil
+	}
+	if m := noteRegex.FindStringSubmatch(text); m != nil {
+		// D2 notes belong to a single actor, so notes over several go on the first
+		actor, _, _ := strings.Cut(m[1], ",")
+		s.notes++
+		s.current().items = append(s.current().items, &seqNote{
+			actor: s.participant(strings.TrimSpace(actor)).d2ID,
+			d2ID:  fmt.Sprintf("note %d", s.notes),
+			label: label(m[2]),
+		})
+		return nil
+	}
+	if m := messageRegex.FindStringSubmatch(text); m != nil {
+		msg := &seqMessage{
+			src:    s.participant(strings.TrimSpace(m[1])).d2ID,
+			dst:    s.participant(m[3]).d2ID,
+			label:  label(m[4]),
+			dashed: strings.HasPrefix(strings.TrimPrefix(m[2], "<<"), "--"),
+		}
+		switch {
+		case strings.HasPrefix(m[2], "<<"):
+			msg.op = "<->"
+		case m[2] == "->" || m[2] == "-->":
+			msg.op = "--"
+		default:
+			msg.op = "->"
+		}
+		s.current().items = append(s.current().items, msg)
+		return nil
+	}
+	return fmt.Errorf("unsupported statement %q", text)
+}
+
+func (s *sequence) current() *seqGroup {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i] != nil {
+			return s.stack[i]
+		}
+	}
+	return s.root
+}
+
+// group adds a block like loop or alt to the current block
+func (s *sequence) group(kind, text string) *seqGroup {
+	s.groups++
+	g := &seqGroup{
+		d2ID:  fmt.Sprintf("%s %d", kind, s.groups),
+		label: strings.TrimSpace(kind + " " + label(text)),
+	}
+	s.current().items = append(s.current().items, g)
+	return g
+}
+
+func (s *sequence) participant(id string) *seqParticipant {
+	if p, ok := s.participants[id]; ok {
+		return p
+	}
+	p := &seqParticipant{
+		d2ID: s.ids.get(id),
+	}
+	if p.d2ID != id {
+		p.label = id
+	}
+	s.participants[id] = p
+	s.order = append(s.order, p)
+	return p
+}
+
+func (m *seqMessage) write(w *d2script.Writer) {
+	k := fmt.Sprintf("%s %s %s", d2script.Key(m.src), m.op, d2script.Key(m.dst))
+	if m.label != "" {
+		k += ": " + d2script.Value(m.label)
+	}
+	if !m.dashed {
+		w.Line("%s", k)
+		return
+	}
+	w.Open("%s", k)
+	w.Line("style.stroke-dash: 3")
+	w.Close()
+}
+
+func (n *seqNote) write(w *d2script.Writer) {
+	w.Line("%s: %s", d2script.Key(n.actor, n.d2ID), d2script.Value(n.label))
+}
+
+func (g *seqGroup) write(w *d2script.Writer) {
+	w.Open("%s: %s", d2script.Key(g.d2ID), d2script.Value(g.label))
+	for _, item := range g.items {
+		item.write(w)
+	}
+	w.Close()
+}
@@ -0,0 +1,725 @@
+// d2structurizr converts Structurizr DSL workspaces into D2 scripts, so that C4 models can
+// be migrated into D2.
+//
+// The root board is the system landscape: all people and software systems and the
+// relationships between them. Every system landscape, system context, container, and
+// component view becomes a layer named by its key. An element has the same D2 ID in every
+// board, the path of its identifiers from its software system down, so it can be followed
+// across views. Relationships between elements that a view doesn't show are drawn between
+// their closest shown ancestors, as Structurizr implies them.
+//
+// Deployment, dynamic, filtered, and custom views, styles, and themes are ignored. Views can
+// include and exclude * and element identifiers, but not expressions.
+package d2structurizr
+
+import (
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2converters/internal/d2script"
+)
+
+// Element types, as named in Structurizr
+const (
+	Person         = "Person"
+	SoftwareSystem = "Software System"
+	Container      = "Container"
+	Component      = "Component"
+)
+
+// Element levels, by the keywords that declare them
+var elementTypes = map[string]string{
+	"person":         Person,
+	"softwaresystem": SoftwareSystem,
+	"container":      Container,
+	"component":      Component,
+}
+
+type element struct {
+	typ         string
+	name        string
+	description string
+	technology  string
+	tags        []string
+	url         string
+	// hierarchical is the element's DSL identifier qualified by those of its ancestors,
+	// e.g. system.container, if it has one
+	hierarchical string
+	parent       *element
+	children     []*element
+	// d2ID is unique among the element's siblings, so an element's path of D2 IDs is the same
+	// in every board
+	d2ID     string
+	childIDs *d2script.IDs
+}
+
+func (e *element) path() []string {
+	if e.parent == nil {
+		return []string{e.d2ID}
+	}
+	return append(e.parent.path(), e.d2ID)
+}
+
+// contains is true when e is an ancestor of o, or o itself
+func (e *element) contains(o *element) bool {
+	for ; o != nil; o = o.parent {
+		if o == e {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *element) hasTag(tag string) bool {
+	for _, t := range e.tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+type relationship struct {
+	src, dst    *element
+	description string
+	technology  string
+}
+
+// unresolved is a relationship whose elements are looked up once the whole model is read,
+// as identifiers can be used before they are declared
+type unresolved struct {
+	src, dst string
+	// scope is the element the relationship was declared in, for relative identifiers
+	scope       *element
+	description string
+	technology  string
+	line        int
+}
+
+type view struct {
+	typ         string
+	key         string
+	scope       *element
+	title       string
+	description string
+	direction   string
+	include     []string
+	exclude     []string
+	line        int
+}
+
+type workspace struct {
+	name          string
+	elements      []*element
+	relationships []*relationship
+	views         []*view
+
+	// identifiers maps DSL identifiers, both flat and hierarchical, to elements
+	identifiers map[string]*element
+	rootIDs     *d2script.IDs
+	unresolved  []unresolved
+}
+
+// Convert converts a Structurizr DSL workspace into a formatted D2 script
+func Convert(input string) (string, error) {
+	stmts, err := parse(input)
+	if err != nil {
+		return "", err
+	}
+	if len(stmts) == 0 || stmts[0].keyword() != "workspace" {
+		return "", fmt.Errorf("expected a workspace")
+	}
+	ws := &workspace{
+		identifiers: make(map[string]*element),
+		rootIDs:     d2script.NewIDs(),
+	}
+	err = ws.readWorkspace(stmts[0])
+	if err != nil {
+		return "", err
+	}
+
+	var w d2script.Writer
+	ws.write(&w)
+
+	return w.Format()
+}
+
+func (ws *workspace) readWorkspace(s *statement) error {
+	for _, t := range s.tokens[1:] {
+		if !t.quoted && strings.EqualFold(t.text, "extends") {
+			return fmt.Errorf("line %d: workspaces that extend other workspaces are not supported", s.line)
+		}
+	}
+	if len(s.tokens) > 1 {
+		ws.name = s.tokens[1].text
+	}
+	var views *statement
+	for _, c := range s.block {
+		switch c.keyword() {
+		case "name":
+			if len(c.tokens) > 1 {
+				ws.name = c.tokens[1].text
+			}
+		case "model":
+			err := ws.readModel(c.block, nil)
+			if err != nil {
+				return err
+			}
+		case "views":
+			views = c
+		case "!include":
+			return fmt.Errorf("line %d: !include is not supported", c.line)
+		}
+	}
+	for _, u := range ws.unresolved {
+		src, err := ws.resolve(u.src, u.scope, u.line)
+		if err != nil {
+			return err
+		}
+		dst, err := ws.resolve(u.dst, u.scope, u.line)
+		if err != nil {
+			return err
+		}
+		ws.relationships = append(ws.relationships, &relationship{
+			src:         src,
+			dst:         dst,
+			description: u.description,
+			technology:  u.technology,
+		})
+	}
+	if views != nil {
+		return ws.readViews(views.block)
+	}
+	return nil
+}
+
+// readModel reads the statements of the model or of an element's block. parent is nil for
+// the model.
+func (ws *workspace) readModel(stmts []*statement, parent *element) error {
+	for _, s := range stmts {
+		identifier := ""
+		tokens := s.tokens
+		if len(tokens) >= 2 && !tokens[1].quoted && tokens[1].text == "=" {
+			identifier = tokens[0].text
+			tokens = tokens[2:]
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		rel := -1
+		for i, t := range tokens {
+			if !t.quoted && t.text == "->" {
+				rel = i
+				break
+			}
+		}
+		if rel != -1 {
+			err := ws.readRelationship(s, tokens, rel, parent)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		kw := strings.ToLower(tokens[0].text)
+		if tokens[0].quoted {
+			kw = ""
+		}
+		if typ, ok := elementTypes[kw]; ok {
+			err := ws.readElement(s, typ, identifier, tokens[1:], parent)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		switch kw {
+		case "group", "enterprise":
+			// Groups only organize elements, which belong to the enclosing element
+			err := ws.readModel(s.block, parent)
+			if err != nil {
+				return err
+			}
+		case "description":
+			if parent != nil && len(tokens) > 1 {
+				parent.description = tokens[1].text
+			}
+		case "technology":
+			if parent != nil && len(tokens) > 1 {
+				parent.technology = tokens[1].text
+			}
+		case "tags", "tag":
+			if parent != nil {
+				for _, t := range tokens[1:] {
+					parent.tags = append(parent.tags, splitTags(t.text)...)
+				}
+			}
+		case "url":
+			if parent != nil && len(tokens) > 1 {
+				parent.url = tokens[1].text
+			}
+		case "!include":
+			return fmt.Errorf("line %d: !include is not supported", s.line)
+		}
+	}
+	return nil
+}
+
+func (ws *workspace) readElement(s *statement, typ, identifier string, args []token, parent *element) error {
+	if len(args) == 0 {
+		return fmt.Errorf("line %d: %s must have a name", s.line, strings.ToLower(typ))
+	}
+	parentType := ""
+	if parent != nil {
+		parentType = parent.typ
+	}
+	switch {
+	case typ == Person, typ == SoftwareSystem:
+		if parent != nil {
+			return fmt.Errorf("line %d: a %s must be declared in the model, not in a %s", s.line, strings.ToLower(typ), strings.ToLower(parentType))
+		}
+	case typ == Container && parentType != SoftwareSystem:
+		return fmt.Errorf("line %d: a container must be declared in a software system", s.line)
+	case typ == Component && parentType != Container:
+		return fmt.Errorf("line %d: a component must be declared in a container", s.line)
+	}
+
+	e := &element{
+		typ:      typ,
+		name:     args[0].text,
+		parent:   parent,
+		childIDs: d2script.NewIDs(),
+	}
+	// The positional arguments after the name are the description, the technology of
+	// containers and components, and tags
+	rest := args[1:]
+	if len(rest) > 0 {
+		e.description = rest[0].text
+		rest = rest[1:]
+	}
+	if (typ == Container || typ == Component) && len(rest) > 0 {
+		e.technology = rest[0].text
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		e.tags = splitTags(rest[0].text)
+	}
+
+	d2Name := identifier
+	if d2Name == "" {
+		d2Name = e.name
+	}
+	if parent == nil {
+		e.d2ID = ws.rootIDs.Unique(d2Name)
+		ws.elements = append(ws.elements, e)
+	} else {
+		e.d2ID = parent.childIDs.Unique(d2Name)
+		parent.children = append(parent.children, e)
+	}
+	if identifier != "" {
+		e.hierarchical = identifier
+		if parent != nil && parent.hierarchical != "" {
+			e.hierarchical = parent.hierarchical + "." + identifier
+		}
+		ws.identifiers[strings.ToLower(identifier)] = e
+		ws.identifiers[strings.ToLower(e.hierarchical)] = e
+	}
+	return ws.readModel(s.block, e)
+}
+
+// readRelationship reads a relationship whose arrow is tokens[arrow]. Relationships
+// declared in an element's block without a source are from the element.
+func (ws *workspace) readRelationship(s *statement, tokens []token, arrow int, parent *element) error {
+	var src string
+	switch arrow {
+	case 0:
+		if parent == nil {
+			return fmt.Errorf("line %d: relationship must have a source", s.line)
+		}
+		src = "this"
+	case 1:
+		src = tokens[0].text
+	default:
+		return fmt.Errorf("line %d: relationship must have one source", s.line)
+	}
+	if arrow+1 >= len(tokens) {
+		return fmt.Errorf("line %d: relationship must have a destination", s.line)
+	}
+	u := unresolved{
+		src:   src,
+		dst:   tokens[arrow+1].text,
+		scope: parent,
+		line:  s.line,
+	}
+	rest := tokens[arrow+2:]
+	if len(rest) > 0 {
+		u.description = rest[0].text
+	}
+	if len(rest) > 1 {
+		u.technology = rest[1].text
+	}
+	for _, c := range s.block {
+		if len(c.tokens) < 2 {
+			continue
+		}
+		switch c.keyword() {
+		case "description":
+			u.description = c.tokens[1].text
+		case "technology":
+			u.technology = c.tokens[1].text
+		}
+	}
+	ws.unresolved = append(ws.unresolved, u)
+	return nil
+}
+
+// resolve looks up an identifier, first relative to the hierarchical identifiers of scope
+// and its ancestors
+func (ws *workspace) resolve(identifier string, scope *element, line int) (*element, error) {
+	if strings.EqualFold(identifier, "this") {
+		if scope == nil {
+			return nil, fmt.Errorf("line %d: this can only be used in an element", line)
+		}
+		return scope, nil
+	}
+	for e := scope; e != nil; e = e.parent {
+		if e.hierarchical == "" {
+			continue
+		}
+		if r, ok := ws.identifiers[strings.ToLower(e.hierarchical+"."+identifier)]; ok {
+			return r, nil
+		}
+	}
+	if r, ok := ws.identifiers[strings.ToLower(identifier)]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("line %d: unknown identifier %q", line, identifier)
+}
+
+// View types, as named in the keys Structurizr generates
+const (
+	viewSystemLandscape = "SystemLandscape"
+	viewSystemContext   = "SystemContext"
+	viewContainer       = "Container"
+	viewComponent       = "Component"
+)
+
+var viewTypes = map[string]string{
+	"systemlandscape": viewSystemLandscape,
+	"systemcontext":   viewSystemContext,
+	"container":       viewContainer,
+	"component":       viewComponent,
+}
+
+func (ws *workspace) readViews(stmts []*statement) error {
+	counts := make(map[string]int)
+	for _, s := range stmts {
+		typ, ok := viewTypes[s.keyword()]
+		if !ok {
+			continue
+		}
+		v := &view{
+			typ:  typ,
+			line: s.line,
+		}
+		args := s.tokens[1:]
+		if typ != viewSystemLandscape {
+			if len(args) == 0 {
+				return fmt.Errorf("line %d: %s view must have a scope", s.line, s.tokens[0].text)
+			}
+			scope, err := ws.resolve(args[0].text, nil, s.line)
+			if err != nil {
+				return err
+			}
+			want := SoftwareSystem
+			if typ == viewComponent {
+				want = Container
+			}
+			if scope.typ != want {
+				return fmt.Errorf("line %d: the scope of a %s view must be a %s, not a %s", s.line, s.tokens[0].text, strings.ToLower(want), strings.ToLower(scope.typ))
+			}
+			v.scope = scope
+			args = args[1:]
+		}
+		counts[typ]++
+		v.key = fmt.Sprintf("%s-%03d", typ, counts[typ])
+		if len(args) > 0 {
+			v.key = args[0].text
+		}
+		if len(args) > 1 {
+			v.description = args[1].text
+		}
+
+		for _, c := range s.block {
+			switch c.keyword() {
+			case "include", "exclude":
+				for _, t := range c.tokens[1:] {
+					if t.text == "->" || strings.Contains(t.text, "==") {
+						return fmt.Errorf("line %d: only * and identifiers can be included and excluded, expressions are not supported", c.line)
+					}
+				}
+				if c.keyword() == "include" {
+					v.include = append(v.include, c.args(1)...)
+				} else {
+					v.exclude = append(v.exclude, c.args(1)...)
+				}
+			case "autolayout":
+				v.direction = "down"
+				if len(c.tokens) > 1 {
+					switch strings.ToLower(c.tokens[1].text) {
+					case "bt":
+						v.direction = "up"
+					case "lr":
+						v.direction = "right"
+					case "rl":
+						v.direction = "left"
+					}
+				}
+			case "title":
+				if len(c.tokens) > 1 {
+					v.title = c.tokens[1].text
+				}
+			case "description":
+				if len(c.tokens) > 1 {
+					v.description = c.tokens[1].text
+				}
+			}
+		}
+		ws.views = append(ws.views, v)
+	}
+	return nil
+}
+
+// board is what a view shows
+type board struct {
+	shown         map[*element]bool
+	relationships []*relationship
+}
+
+// board computes the elements and relationships shown by a view
+func (ws *workspace) board(v *view) (*board, error) {
+	b := &board{
+		shown: make(map[*element]bool),
+	}
+	for _, identifier := range v.include {
+		if identifier == "*" {
+			for _, e := range ws.defaultElements(v) {
+				b.shown[e] = true
+			}
+			continue
+		}
+		e, err := ws.resolve(identifier, nil, v.line)
+		if err != nil {
+			return nil, err
+		}
+		b.shown[e] = true
+	}
+	for _, identifier := range v.exclude {
+		if identifier == "*" {
+			b.shown = make(map[*element]bool)
+			continue
+		}
+		e, err := ws.resolve(identifier, nil, v.line)
+		if err != nil {
+			return nil, err
+		}
+		delete(b.shown, e)
+	}
+
+	// Relationships are implied between the closest shown ancestors of their elements
+	type edgeKey struct {
+		src, dst    *element
+		description string
+		technology  string
+	}
+	seen := make(map[edgeKey]struct{})
+	for _, r := range ws.relationships {
+		src, dst := b.closest(r.src), b.closest(r.dst)
+		if src == nil || dst == nil || src.contains(dst) || dst.contains(src) {
+			continue
+		}
+		k := edgeKey{src, dst, r.description, r.technology}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		b.relationships = append(b.relationships, &relationship{
+			src:         src,
+			dst:         dst,
+			description: r.description,
+			technology:  r.technology,
+		})
+	}
+	return b, nil
+}
+
+func (b *board) closest(e *element) *element {
+	for ; e != nil; e = e.parent {
+		if b.shown[e] {
+			return e
+		}
+	}
+	return nil
+}
+
+// isBoundary is true for elements that aren't shown but contain shown elements
+func (b *board) isBoundary(e *element) bool {
+	if b.shown[e] {
+		return false
+	}
+	for _, c := range e.children {
+		if b.shown[c] || b.isBoundary(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultElements returns the elements a view includes with *: the elements in its scope
+// and the elements they have relationships with
+func (ws *workspace) defaultElements(v *view) []*element {
+	var focus []*element
+	switch v.typ {
+	case viewSystemLandscape:
+		return ws.elements
+	case viewSystemContext:
+		focus = []*element{v.scope}
+	default:
+		focus = v.scope.children
+	}
+	inFocus := make(map[*element]bool)
+	for _, e := range focus {
+		inFocus[e] = true
+	}
+
+	// lift finds the element that represents e at the level of the view
+	lift := func(e *element) *element {
+		if v.typ != viewSystemContext {
+			for a := v.scope; a != nil; a = a.parent {
+				if a != e && a.contains(e) {
+					for e.parent != a {
+						e = e.parent
+					}
+					return e
+				}
+			}
+		}
+		for e.parent != nil {
+			e = e.parent
+		}
+		return e
+	}
+
+	elements := append([]*element{}, focus...)
+	added := make(map[*element]bool)
+	for _, r := range ws.relationships {
+		src, dst := lift(r.src), lift(r.dst)
+		for _, pair := range [][2]*element{{src, dst}, {dst, src}} {
+			other := pair[1]
+			if !inFocus[pair[0]] || inFocus[other] || added[other] || other.contains(v.scope) {
+				continue
+			}
+			added[other] = true
+			elements = append(elements, other)
+		}
+	}
+	return elements
+}
+
+func (ws *workspace) write(w *d2script.Writer) {
+	if ws.name != "" {
+		w.Line("label: %s", d2script.Value(ws.name))
+	}
+	landscape := &view{
+		typ:     viewSystemLandscape,
+		include: []string{"*"},
+	}
+	b, _ := ws.board(landscape)
+	ws.writeBoard(w, b)
+
+	if len(ws.views) == 0 {
+		return
+	}
+	w.Open("layers")
+	layerIDs := d2script.NewIDs()
+	for _, v := range ws.views {
+		b, err := ws.board(v)
+		if err != nil {
+			// Views are checked when read
+			continue
+		}
+		w.Open(d2script.Key(layerIDs.Unique(v.key)))
+		if v.title != "" {
+			w.Line("label: %s", d2script.Value(v.title))
+		} else if v.description != "" {
+			w.Line("label: %s", d2script.Value(v.description))
+		}
+		if v.direction != "" {
+			w.Line("direction: %s", v.direction)
+		}
+		ws.writeBoard(w, b)
+		w.Close()
+	}
+	w.Close()
+}
+
+func (ws *workspace) writeBoard(w *d2script.Writer, b *board) {
+	for _, e := range ws.elements {
+		writeElement(w, b, e)
+	}
+	for _, r := range b.relationships {
+		label := r.description
+		if r.technology != "" {
+			label += "\n[" + r.technology + "]"
+		}
+		edge := fmt.Sprintf("%s -> %s", d2script.Key(r.src.path()...), d2script.Key(r.dst.path()...))
+		if label != "" {
+			edge += ": " + d2script.Value(strings.TrimSpace(label))
+		}
+		w.Line("%s", edge)
+	}
+}
+
+func writeElement(w *d2script.Writer, b *board, e *element) {
+	boundary := b.isBoundary(e)
+	if !b.shown[e] && !boundary {
+		return
+	}
+	typ := e.typ
+	if e.technology != "" {
+		typ += ": " + e.technology
+	}
+	w.Open("%s: %s", d2script.Key(e.d2ID), d2script.Value(e.name+"\n["+typ+"]"))
+	switch {
+	case boundary:
+		w.Line("style.stroke-dash: 3")
+		w.Line("style.fill: transparent")
+	case e.typ == Person:
+		w.Line("shape: person")
+	case e.hasTag("Database"):
+		w.Line("shape: cylinder")
+	case e.hasTag("Queue"):
+		w.Line("shape: queue")
+	}
+	if e.description != "" {
+		w.Line("tooltip: %s", d2script.Value(e.description))
+	}
+	if e.url != "" {
+		w.Line("link: %s", d2script.Value(e.url))
+	}
+	for _, c := range e.children {
+		writeElement(w, b, c)
+	}
+	w.Close()
+}
+
+// splitTags splits comma separated tags
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,186 @@
+package d2structurizr_test
+
+import (
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2converters/d2structurizr"
+)
+
+const bank = `workspace "Big Bank" {
+  !identifiers hierarchical
+
+  model {
+    customer = person "Customer" "A customer of the bank"
+    group "Bank" {
+      ibs = softwareSystem "Internet Banking" {
+        web = container "Web App" "" "Go" {
+          auth = component "Auth"
+          accounts = component "Accounts" {
+            technology "Go"
+            -> db "Reads from" "SQL"
+          }
+          auth -> accounts "Looks up"
+        }
+        db = container "Database" "" "PostgreSQL" "Database"
+      }
+      mail = softwareSystem "E-mail" {
+        url "https://mail.example.com"
+      }
+    }
+    customer -> ibs.web "Uses" "HTTPS"
+    ibs.web.auth -> mail "Sends e-mail with"
+    mail -> customer "Sends e-mails to"
+  }
+
+  views {
+    systemContext ibs "Context" {
+      include *
+      autoLayout lr
+    }
+    component ibs.web {
+      include *
+      exclude mail
+      title "Components"
+    }
+    styles {
+      element "Person" {
+        background #08427b
+      }
+    }
+  }
+}`
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		in     string
+		exp    string
+		expErr string
+	}{
+		{
+			name: "bank",
+			in:   bank,
+			exp: `label: Big Bank
+customer: "Customer\n[Person]" {
+  shape: person
+  tooltip: A customer of the bank
+}
+ibs: "Internet Banking\n[Software System]"
+mail: "E-mail\n[Software System]" {
+  link: https://mail.example.com
+}
+customer -> ibs: "Uses\n[HTTPS]"
+ibs -> mail: Sends e-mail with
+mail -> customer: Sends e-mails to
+
+layers: {
+  Context: {
+    direction: right
+    customer: "Customer\n[Person]" {
+      shape: person
+      tooltip: A customer of the bank
+    }
+    ibs: "Internet Banking\n[Software System]"
+    mail: "E-mail\n[Software System]" {
+      link: https://mail.example.com
+    }
+    customer -> ibs: "Uses\n[HTTPS]"
+    ibs -> mail: Sends e-mail with
+    mail -> customer: Sends e-mails to
+  }
+  Component-001: {
+    label: Components
+    ibs: "Internet Banking\n[Software System]" {
+      style.stroke-dash: 3
+      style.fill: transparent
+      web: "Web App\n[Container: Go]" {
+        style.stroke-dash: 3
+        style.fill: transparent
+        auth: "Auth\n[Component]"
+        accounts: "Accounts\n[Component: Go]"
+      }
+      db: "Database\n[Container: PostgreSQL]" {
+        shape: cylinder
+      }
+    }
+    ibs.web.accounts -> ibs.db: "Reads from\n[SQL]"
+    ibs.web.auth -> ibs.web.accounts: Looks up
+  }
+}
+`,
+		},
+		{
+			name: "anonymous",
+			in: `workspace {
+  model {
+    person "User"
+    softwareSystem "Layers"
+  }
+}`,
+			exp: `User: "User\n[Person]" {
+  shape: person
+}
+Layers_2: "Layers\n[Software System]"
+`,
+		},
+		{
+			name: "unknown_identifier",
+			in: `workspace {
+  model {
+    a = softwareSystem "A"
+    a -> b
+  }
+}`,
+			expErr: `line 4: unknown identifier "b"`,
+		},
+		{
+			name: "misplaced_component",
+			in: `workspace {
+  model {
+    a = softwareSystem "A" {
+      component "B"
+    }
+  }
+}`,
+			expErr: `line 4: a component must be declared in a container`,
+		},
+		{
+			name: "view_scope",
+			in: `workspace {
+  model {
+    a = softwareSystem "A"
+  }
+  views {
+    component a {
+      include *
+    }
+  }
+}`,
+			expErr: `line 6: the scope of a component view must be a container, not a software system`,
+		},
+		{
+			name:   "not_workspace",
+			in:     `a -> b`,
+			expErr: `expected a workspace`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := d2structurizr.Convert(tc.in)
+			if tc.expErr != "" {
+				assert.ErrorString(t, err, tc.expErr)
+				return
+			}
+			assert.Success(t, err)
+			assert.String(t, tc.exp, out)
+		})
+	}
+}
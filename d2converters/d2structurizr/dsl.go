@@ -0,0 +1,189 @@
+package d2structurizr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// statement is a line of Structurizr DSL, with the statements of its block if it opens one
+type statement struct {
+	tokens []token
+	block  []*statement
+	line   int
+}
+
+type token struct {
+	text string
+	// quoted tokens are never keywords or operators
+	quoted bool
+}
+
+func (s *statement) keyword() string {
+	if len(s.tokens) == 0 || s.tokens[0].quoted {
+		return ""
+	}
+	return strings.ToLower(s.tokens[0].text)
+}
+
+// args returns the text of the tokens from i on
+func (s *statement) args(i int) []string {
+	var args []string
+	for ; i < len(s.tokens); i++ {
+		args = append(args, s.tokens[i].text)
+	}
+	return args
+}
+
+// parse splits Structurizr DSL into a tree of statements
+func parse(input string) ([]*statement, error) {
+	p := &parser{
+		input: []rune(input),
+		line:  1,
+	}
+	stmts, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("line %d: unexpected }", p.line)
+	}
+	return stmts, nil
+}
+
+type parser struct {
+	input []rune
+	pos   int
+	line  int
+}
+
+// block parses statements until the end of the input or a closing brace, which is left
+// unconsumed
+func (p *parser) block() ([]*statement, error) {
+	var stmts []*statement
+	cur := &statement{line: p.line}
+	flush := func() {
+		if len(cur.tokens) > 0 || cur.block != nil {
+			stmts = append(stmts, cur)
+		}
+		cur = &statement{line: p.line}
+	}
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		switch {
+		case r == '\n':
+			p.pos++
+			flush()
+			p.line++
+			cur.line = p.line
+		case unicode.IsSpace(r):
+			p.pos++
+		case (r == '#' && len(cur.tokens) == 0) || p.hasPrefix("//"):
+			// # only starts comments at the start of statements, as it also starts colors
+			for p.pos < len(p.input) && p.input[p.pos] != '\n' {
+				p.pos++
+			}
+		case p.hasPrefix("/*"):
+			end := strings.Index(string(p.input[p.pos+2:]), "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: unterminated comment", p.line)
+			}
+			comment := string(p.input[p.pos : p.pos+2+end+2])
+			p.line += strings.Count(comment, "\n")
+			p.pos += len([]rune(comment))
+		case r == '{':
+			p.pos++
+			line := p.line
+			block, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			if p.pos >= len(p.input) {
+				return nil, fmt.Errorf("line %d: unclosed {", line)
+			}
+			p.pos++
+			cur.block = block
+			if cur.block == nil {
+				cur.block = []*statement{}
+			}
+			flush()
+		case r == '}':
+			flush()
+			return stmts, nil
+		case r == '"':
+			s, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			cur.tokens = append(cur.tokens, token{text: s, quoted: true})
+		case r == '\\' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '\n':
+			// Line continuation
+			p.pos += 2
+			p.line++
+		default:
+			start := p.pos
+			for p.pos < len(p.input) {
+				r := p.input[p.pos]
+				if unicode.IsSpace(r) || r == '{' || r == '}' || r == '"' {
+					break
+				}
+				p.pos++
+			}
+			cur.tokens = append(cur.tokens, splitArrows(string(p.input[start:p.pos]))...)
+		}
+	}
+	flush()
+	return stmts, nil
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.input[p.pos:min(p.pos+len(s), len(p.input))]), s)
+}
+
+func (p *parser) quoted() (string, error) {
+	line := p.line
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		switch {
+		case r == '"':
+			p.pos++
+			return sb.String(), nil
+		case r == '\\' && p.pos+1 < len(p.input):
+			p.pos++
+			switch p.input[p.pos] {
+			case 'n':
+				sb.WriteRune('\n')
+			default:
+				sb.WriteRune(p.input[p.pos])
+			}
+		case r == '\n':
+			return "", fmt.Errorf("line %d: unterminated string", line)
+		default:
+			sb.WriteRune(r)
+		}
+		p.pos++
+	}
+	return "", fmt.Errorf("line %d: unterminated string", line)
+}
+
+// splitArrows splits relationship arrows written without spaces, e.g. a->b
+func splitArrows(s string) []token {
+	var tokens []token
+	for {
+		i := strings.Index(s, "->")
+		if i == -1 {
+			break
+		}
+		if i > 0 {
+			tokens = append(tokens, token{text: s[:i]})
+		}
+		tokens = append(tokens, token{text: "->"})
+		s = s[i+2:]
+	}
+	if s != "" {
+		tokens = append(tokens, token{text: s})
+	}
+	return tokens
+}
@@ -0,0 +1,84 @@
+// Package d2script writes the D2 scripts the converters in d2converters produce.
+package d2script
+
+import (
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2parser"
+)
+
+// Writer accumulates D2 lines. Indentation is cosmetic as the output is formatted by Format.
+type Writer struct {
+	sb    strings.Builder
+	depth int
+}
+
+// Line writes a line at the current depth
+func (w *Writer) Line(format string, args ...interface{}) {
+	w.sb.WriteString(strings.Repeat("  ", w.depth))
+	fmt.Fprintf(&w.sb, format, args...)
+	w.sb.WriteByte('\n')
+}
+
+// Open writes a line opening a map, which the lines until Close are in
+func (w *Writer) Open(format string, args ...interface{}) {
+	w.Line(format+" {", args...)
+	w.depth++
+}
+
+// Close closes the map of the last Open
+func (w *Writer) Close() {
+	w.depth--
+	w.Line("}")
+}
+
+// Format returns what was written, formatted. It's parsed first, both to normalize its
+// formatting and to make sure it's valid D2.
+func (w *Writer) Format() (string, error) {
+	m, err := d2parser.Parse("", strings.NewReader(w.sb.String()), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to produce valid D2: %w", err)
+	}
+	return d2format.Format(m), nil
+}
+
+// Key formats ida as a D2 key, quoting where needed
+func Key(ida ...string) string {
+	return d2format.Format(d2ast.MakeKeyPath(ida))
+}
+
+// Value formats s as a D2 string value, quoting where needed
+func Value(s string) string {
+	return d2format.Format(d2ast.RawString(s, false))
+}
+
+// IDs hands out D2 IDs that are unique within a container. D2 IDs are case insensitive and
+// can't be keywords, so names that would clash are suffixed to stay distinct and valid.
+type IDs struct {
+	used map[string]struct{}
+}
+
+func NewIDs() *IDs {
+	return &IDs{
+		used: make(map[string]struct{}),
+	}
+}
+
+// Unique returns a D2 ID for name that no other call returned
+func (ids *IDs) Unique(name string) string {
+	d2ID := name
+	for i := 2; ; i++ {
+		_, reserved := d2graph.ReservedKeywords[strings.ToLower(d2ID)]
+		_, used := ids.used[strings.ToLower(d2ID)]
+		if !reserved && !used {
+			break
+		}
+		d2ID = fmt.Sprintf("%s_%d", name, i)
+	}
+	ids.used[strings.ToLower(d2ID)] = struct{}{}
+	return d2ID
+}
@@ -44,6 +44,7 @@ func Export(ctx context.Context, g *d2graph.Graph, fontFamily *d2fonts.FontFamil
 	for i := range g.Edges {
 		diagram.Connections[i] = toConnection(g.Edges[i], g.Theme)
 	}
+	ExportRanges(g, diagram)
 
 	return diagram, nil
 }
@@ -80,6 +81,45 @@ func applyTheme(shape *d2target.Shape, obj *d2graph.Object, theme *d2themes.Them
 	}
 }
 
+// applyThemeStyles applies the default styles of themes loaded from files, which the styles of
+// obj override
+func applyThemeStyles(shape *d2target.Shape, obj *d2graph.Object, theme *d2themes.Theme) {
+	if theme == nil || theme.Styles == nil {
+		return
+	}
+	// Sequence diagrams and their groups are drawn without borders
+	if theme.Styles.StrokeWidth > 0 && !obj.IsSequenceDiagram() && !obj.IsSequenceDiagramGroup() {
+		shape.StrokeWidth = theme.Styles.StrokeWidth
+	}
+
+	shapeType := strings.ToLower(obj.Shape.Value)
+	if shapeType == "" {
+		shapeType = d2target.ShapeRectangle
+	}
+	style, ok := theme.Styles.Shapes[shapeType]
+	if !ok {
+		return
+	}
+	if style.Fill != "" {
+		shape.Fill = style.Fill
+	}
+	if style.Stroke != "" {
+		shape.Stroke = style.Stroke
+	}
+	if style.FontColor != "" {
+		shape.Color = style.FontColor
+	}
+	if style.StrokeWidth > 0 {
+		shape.StrokeWidth = style.StrokeWidth
+	}
+	if style.BorderRadius > 0 {
+		shape.BorderRadius = style.BorderRadius
+	}
+}
+
+// DASHED_BORDER_STROKE_DASH is the stroke-dash of "border-style: dashed" shapes without one
+const DASHED_BORDER_STROKE_DASH = 5
+
 func applyStyles(shape *d2target.Shape, obj *d2graph.Object) {
 	if obj.Style.Opacity != nil {
 		shape.Opacity, _ = strconv.ParseFloat(obj.Style.Opacity.Value, 64)
@@ -126,12 +166,33 @@ func applyStyles(shape *d2target.Shape, obj *d2graph.Object) {
 	if obj.Style.Underline != nil {
 		shape.Underline, _ = strconv.ParseBool(obj.Style.Underline.Value)
 	}
+	if obj.Style.TextAlign != nil {
+		shape.TextAlign = strings.ToLower(obj.Style.TextAlign.Value)
+	}
+	if obj.Style.TextDirection != nil {
+		shape.TextDirection = strings.ToLower(obj.Style.TextDirection.Value)
+	}
+	shape.LatexScale = obj.Style.LatexScaleValue()
 	if obj.Style.Font != nil {
 		shape.FontFamily = obj.Style.Font.Value
 	}
 	if obj.Style.DoubleBorder != nil {
 		shape.DoubleBorder, _ = strconv.ParseBool(obj.Style.DoubleBorder.Value)
 	}
+	if obj.Style.BorderStyle != nil {
+		shape.StrokeDotted = false
+		shape.DoubleBorder = false
+		switch strings.ToLower(obj.Style.BorderStyle.Value) {
+		case "dashed":
+			if obj.Style.StrokeDash == nil {
+				shape.StrokeDash = DASHED_BORDER_STROKE_DASH
+			}
+		case "dotted":
+			shape.StrokeDotted = true
+		case "double":
+			shape.DoubleBorder = true
+		}
+	}
 }
 
 func toShape(obj *d2graph.Object, g *d2graph.Graph) d2target.Shape {
@@ -162,12 +223,27 @@ func toShape(obj *d2graph.Object, g *d2graph.Graph) d2target.Shape {
 	applyStyles(shape, obj)
 	applyTheme(shape, obj, g.Theme)
 	shape.Color = text.GetColor(shape.Italic)
+	applyThemeStyles(shape, obj, g.Theme)
 	applyStyles(shape, obj)
+	if obj.Style.Header != nil && obj.IsContainer() {
+		shape.Header = strings.ToLower(obj.Style.Header.Value)
+		// Headers are filled with the stroke, so the label is drawn in the fill
+		if obj.Style.FontColor == nil {
+			shape.Color = shape.Fill
+		}
+	}
+	if obj.Style.LayerGroup != nil {
+		shape.LayerGroup = obj.Style.LayerGroup.Value
+	}
 
 	switch obj.Shape.Value {
 	case d2target.ShapeCode, d2target.ShapeText:
 		shape.Language = obj.Language
 		shape.Label = obj.Label.Value
+		shape.LineNumbers = obj.HasLineNumbers()
+		if obj.HighlightLines != nil {
+			shape.HighlightLines, _ = d2target.ParseLineRanges(obj.HighlightLines.Value)
+		}
 	case d2target.ShapeClass:
 		shape.Class = *obj.Class
 		// The label is the header for classes and tables, which is set in client to be 4 px larger than the object's set font size
@@ -179,6 +255,10 @@ func toShape(obj *d2graph.Object, g *d2graph.Graph) d2target.Shape {
 		if obj.ContentAspectRatio != nil {
 			shape.ContentAspectRatio = go2.Pointer(*obj.ContentAspectRatio)
 		}
+	case d2target.ShapeCustom:
+		shape.CustomShape = obj.CustomShape
+	case d2target.ShapeBoard:
+		shape.Board = obj.Board.Value
 	}
 	shape.Label = text.Text
 	shape.LabelWidth = text.Dimensions.Width
@@ -197,6 +277,10 @@ func toShape(obj *d2graph.Object, g *d2graph.Graph) d2target.Shape {
 	if obj.Link != nil {
 		shape.Link = obj.Link.Value
 		shape.PrettyLink = toPrettyLink(g, obj.Link.Value)
+	} else if obj.Board != nil {
+		// Board shapes jump to the board they embed unless they link elsewhere
+		shape.Link = obj.Board.Value
+		shape.PrettyLink = toPrettyLink(g, obj.Board.Value)
 	}
 	shape.Icon = obj.Icon
 	if obj.IconPosition != nil {
@@ -250,6 +334,12 @@ func toPrettyLink(g *d2graph.Graph, link string) string {
 	return link
 }
 
+// isRealization returns whether an arrowhead is the UML realization preset, which dashes its
+// connection
+func isRealization(arrowhead *d2graph.Attributes) bool {
+	return arrowhead != nil && strings.EqualFold(arrowhead.Shape.Value, string(d2target.RealizationArrowhead))
+}
+
 func toConnection(edge *d2graph.Edge, theme *d2themes.Theme) d2target.Connection {
 	connection := d2target.BaseConnection()
 	connection.ID = edge.AbsID()
@@ -306,12 +396,17 @@ func toConnection(edge *d2graph.Edge, theme *d2themes.Theme) d2target.Connection
 
 	if edge.Style.StrokeDash != nil {
 		connection.StrokeDash, _ = strconv.ParseFloat(edge.Style.StrokeDash.Value, 64)
+	} else if (edge.SrcArrow && isRealization(edge.SrcArrowhead)) || (edge.DstArrow && isRealization(edge.DstArrowhead)) {
+		connection.StrokeDash = DASHED_BORDER_STROKE_DASH
 	}
 	connection.Stroke = edge.GetStroke(connection.StrokeDash)
 	if edge.Style.Stroke != nil {
 		connection.Stroke = edge.Style.Stroke.Value
 	}
 
+	if theme != nil && theme.Styles != nil && theme.Styles.StrokeWidth > 0 {
+		connection.StrokeWidth = theme.Styles.StrokeWidth
+	}
 	if edge.Style.StrokeWidth != nil {
 		connection.StrokeWidth, _ = strconv.Atoi(edge.Style.StrokeWidth.Value)
 	}
@@ -328,6 +423,9 @@ func toConnection(edge *d2graph.Edge, theme *d2themes.Theme) d2target.Connection
 	if edge.Style.Animated != nil {
 		connection.Animated, _ = strconv.ParseBool(edge.Style.Animated.Value)
 	}
+	if edge.Style.LayerGroup != nil {
+		connection.LayerGroup = edge.Style.LayerGroup.Value
+	}
 
 	if edge.Tooltip != nil {
 		connection.Tooltip = edge.Tooltip.Value
@@ -348,6 +446,12 @@ func toConnection(edge *d2graph.Edge, theme *d2themes.Theme) d2target.Connection
 	if edge.Style.Underline != nil {
 		connection.Underline, _ = strconv.ParseBool(edge.Style.Underline.Value)
 	}
+	if edge.Style.TextAlign != nil {
+		connection.TextAlign = strings.ToLower(edge.Style.TextAlign.Value)
+	}
+	if edge.Style.TextDirection != nil {
+		connection.TextDirection = strings.ToLower(edge.Style.TextDirection.Value)
+	}
 	if theme != nil && theme.SpecialRules.Mono {
 		connection.FontFamily = "mono"
 	}
@@ -355,6 +459,7 @@ func toConnection(edge *d2graph.Edge, theme *d2themes.Theme) d2target.Connection
 		connection.FontFamily = edge.Style.Font.Value
 	}
 	connection.Label = text.Text
+	connection.Language = text.Language
 	connection.LabelWidth = text.Dimensions.Width
 	connection.LabelHeight = text.Dimensions.Height
 
@@ -0,0 +1,61 @@
+package d2exporter
+
+import (
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// ExportRanges sets where the shapes and connections of d, exported from g, are declared in
+// the input. Export sets them, but they aren't kept with boards reused from a layout cache,
+// as edits elsewhere in the input move them.
+func ExportRanges(g *d2graph.Graph, d *d2target.Diagram) {
+	objects := make(map[string]*d2graph.Object, len(g.Objects))
+	for _, obj := range g.Objects {
+		objects[obj.AbsID()] = obj
+	}
+	for i := range d.Shapes {
+		if obj, ok := objects[d.Shapes[i].ID]; ok {
+			d.Shapes[i].Range = objectRange(obj)
+		}
+	}
+	edges := make(map[string]*d2graph.Edge, len(g.Edges))
+	for _, e := range g.Edges {
+		edges[e.AbsID()] = e
+	}
+	for i := range d.Connections {
+		if e, ok := edges[d.Connections[i].ID]; ok {
+			d.Connections[i].Range = edgeRange(e)
+		}
+	}
+}
+
+// objectRange is the range of the key that first declares obj, or of its ID where it's first
+// referenced if that key declares something else too, like an edge or a child of obj
+func objectRange(obj *d2graph.Object) *d2ast.Range {
+	if len(obj.References) == 0 {
+		return nil
+	}
+	ref := obj.References[0]
+	if ref.MapKey != nil && !ref.InEdge() && ref.KeyPathIndex == len(ref.Key.Path)-1 {
+		r := ref.MapKey.Range
+		return &r
+	}
+	if ref.KeyPathIndex < len(ref.Key.Path) {
+		if s := ref.Key.Path[ref.KeyPathIndex].Unbox(); s != nil {
+			r := s.GetRange()
+			return &r
+		}
+	}
+	r := ref.Key.Range
+	return &r
+}
+
+// edgeRange is the range of the edge where it's first declared
+func edgeRange(e *d2graph.Edge) *d2ast.Range {
+	if len(e.References) == 0 || e.References[0].Edge == nil {
+		return nil
+	}
+	r := e.References[0].Edge.Range
+	return &r
+}
@@ -2,6 +2,7 @@ package d2format
 
 import (
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -10,23 +11,73 @@ import (
 
 // TODO: edges with shared path should be fmted as <rel>.(x -> y)
 func Format(n d2ast.Node) string {
-	var p printer
+	return FormatWithOptions(n, nil)
+}
+
+// Options configures FormatWithOptions. The zero value formats like Format.
+type Options struct {
+	// Indent is indented per level of nesting, two spaces if empty
+	Indent string
+	// Width, if positive, is the length of line past which maps and arrays written on one
+	// line are broken onto one line per item
+	Width int
+	// SortStyles sorts the keys of style maps alphabetically, as the order of styles doesn't
+	// matter. Keys separated by comments or blank lines are sorted separately.
+	SortStyles bool
+}
+
+func FormatWithOptions(n d2ast.Node, opts *Options) string {
+	if opts == nil {
+		opts = &Options{}
+	}
+	p := printer{
+		opts: *opts,
+	}
+	if p.opts.Indent == "" {
+		p.opts.Indent = "  "
+	}
 	p.node(n)
 	return p.sb.String()
 }
 
 type printer struct {
 	sb        strings.Builder
+	opts      Options
 	indentStr string
 	inKey     bool
+	// inStyle is whether the next map printed is the value of a style key
+	inStyle bool
 }
 
 func (p *printer) indent() {
-	p.indentStr += " " + " "
+	p.indentStr += p.opts.Indent
 }
 
 func (p *printer) deindent() {
-	p.indentStr = p.indentStr[:len(p.indentStr)-2]
+	p.indentStr = p.indentStr[:len(p.indentStr)-len(p.opts.Indent)]
+}
+
+// column is the length of the line being printed so far
+func (p *printer) column() int {
+	s := p.sb.String()
+	return len(s) - (strings.LastIndexByte(s, '\n') + 1)
+}
+
+// oneLine returns whether n, written on one line in the input, still fits on one line
+func (p *printer) oneLine(n d2ast.Node) bool {
+	if !n.GetRange().OneLine() {
+		return false
+	}
+	if p.opts.Width <= 0 {
+		return true
+	}
+	sub := printer{
+		opts:  p.opts,
+		inKey: p.inKey,
+	}
+	sub.opts.Width = 0
+	sub.node(n)
+	return p.column()+sub.sb.Len() <= p.opts.Width
 }
 
 func (p *printer) newline() {
@@ -191,6 +242,9 @@ func (p *printer) blockString(bs *d2ast.BlockString) {
 func (p *printer) path(els []*d2ast.StringBox) {
 	for i, s := range els {
 		p.node(s.Unbox())
+		if s.UnquotedString != nil && len(s.UnquotedString.Filters) > 0 {
+			p.globFilters(s.UnquotedString.Filters)
+		}
 		if i < len(els)-1 {
 			p.sb.WriteByte('.')
 		}
@@ -202,7 +256,11 @@ func (p *printer) substitution(s *d2ast.Substitution) {
 		p.sb.WriteString("...")
 	}
 	p.sb.WriteString("${")
-	p.path(s.Path)
+	if s.Expression != "" {
+		p.sb.WriteString(s.Expression)
+	} else {
+		p.path(s.Path)
+	}
 	p.sb.WriteByte('}')
 }
 
@@ -223,11 +281,26 @@ func (p *printer) _import(i *d2ast.Import) {
 		i = &i2
 	}
 	p.path(i.Path)
+	if i.Subtree != nil {
+		p.sb.WriteByte('#')
+		p.path(i.Subtree.Path)
+	}
+	if len(i.Args) > 0 {
+		p.sb.WriteByte('(')
+		for j, arg := range i.Args {
+			if j > 0 {
+				p.sb.WriteString(", ")
+			}
+			p.mapKey(arg)
+		}
+		p.sb.WriteByte(')')
+	}
 }
 
 func (p *printer) array(a *d2ast.Array) {
+	oneLine := p.oneLine(a)
 	p.sb.WriteByte('[')
-	if !a.Range.OneLine() {
+	if !oneLine {
 		p.indent()
 	}
 
@@ -245,7 +318,7 @@ func (p *printer) array(a *d2ast.Array) {
 			}
 		}
 
-		if !a.Range.OneLine() {
+		if !oneLine {
 			if prev != a {
 				if n.GetRange().Start.Line-prev.GetRange().End.Line > 1 {
 					p.sb.WriteByte('\n')
@@ -260,7 +333,7 @@ func (p *printer) array(a *d2ast.Array) {
 		prev = n
 	}
 
-	if !a.Range.OneLine() {
+	if !oneLine {
 		p.deindent()
 		p.newline()
 	}
@@ -268,9 +341,16 @@ func (p *printer) array(a *d2ast.Array) {
 }
 
 func (p *printer) _map(m *d2ast.Map) {
+	nodes := m.Nodes
+	if p.inStyle {
+		p.inStyle = false
+		nodes = sortStyles(m.Nodes)
+	}
+
+	oneLine := p.oneLine(m)
 	if !m.IsFileMap() {
 		p.sb.WriteByte('{')
-		if !m.Range.OneLine() {
+		if !oneLine {
 			p.indent()
 		}
 	}
@@ -281,8 +361,10 @@ func (p *printer) _map(m *d2ast.Map) {
 
 	prev := d2ast.Node(m)
 	for i := 0; i < len(m.Nodes); i++ {
-		nb := m.Nodes[i]
+		nb := nodes[i]
 		n := nb.Unbox()
+		// Sorted keys are printed where the ones they replaced were
+		pos := m.Nodes[i].Unbox()
 		// extract out layer, scenario, and step nodes and skip
 		if nb.IsBoardNode() {
 			switch nb.MapKey.Key.Path[0].Unbox().ScalarString() {
@@ -306,9 +388,9 @@ func (p *printer) _map(m *d2ast.Map) {
 			}
 		}
 
-		if !m.Range.OneLine() {
+		if !oneLine {
 			if prev != m {
-				if n.GetRange().Start.Line-prev.GetRange().End.Line > 1 {
+				if pos.GetRange().Start.Line-prev.GetRange().End.Line > 1 {
 					p.sb.WriteByte('\n')
 				}
 			}
@@ -320,7 +402,7 @@ func (p *printer) _map(m *d2ast.Map) {
 		}
 
 		p.node(n)
-		prev = n
+		prev = pos
 	}
 
 	boards := []d2ast.MapNodeBox{}
@@ -344,7 +426,7 @@ func (p *printer) _map(m *d2ast.Map) {
 	}
 
 	if !m.IsFileMap() {
-		if !m.Range.OneLine() {
+		if !oneLine {
 			p.deindent()
 			p.newline()
 		}
@@ -358,6 +440,8 @@ func (p *printer) _map(m *d2ast.Map) {
 func (p *printer) mapKey(mk *d2ast.Key) {
 	if mk.Ampersand {
 		p.sb.WriteByte('&')
+	} else if mk.NotAmpersand {
+		p.sb.WriteString("!&")
 	}
 	if mk.Key != nil {
 		p.key(mk.Key)
@@ -407,10 +491,64 @@ func (p *printer) mapKey(mk *d2ast.Key) {
 		} else {
 			p.sb.WriteByte(' ')
 		}
+		p.inStyle = p.opts.SortStyles && mk.Value.Map != nil && isStyleKey(mk)
 		p.node(mk.Value.Unbox())
 	}
 }
 
+func isStyleKey(mk *d2ast.Key) bool {
+	kp := mk.Key
+	if len(mk.Edges) > 0 {
+		kp = mk.EdgeKey
+	}
+	return kp != nil && len(kp.Path) > 0 && kp.Path[len(kp.Path)-1].Unbox().ScalarString() == "style"
+}
+
+// sortStyles sorts each run of keys in nodes, on consecutive lines without comments between
+// them, by their keys
+func sortStyles(nodes []d2ast.MapNodeBox) []d2ast.MapNodeBox {
+	sorted := append([]d2ast.MapNodeBox(nil), nodes...)
+	start := 0
+	for i := 1; i <= len(sorted); i++ {
+		if i < len(sorted) && sorted[i].MapKey != nil && sorted[i-1].MapKey != nil &&
+			sorted[i].MapKey.Range.Start.Line-sorted[i-1].MapKey.Range.End.Line <= 1 {
+			continue
+		}
+		run := sorted[start:i]
+		sort.SliceStable(run, func(a, b int) bool {
+			return styleSortKey(run[a]) < styleSortKey(run[b])
+		})
+		start = i
+	}
+	return sorted
+}
+
+func styleSortKey(nb d2ast.MapNodeBox) string {
+	if nb.MapKey == nil || nb.MapKey.Key == nil {
+		return ""
+	}
+	return Format(nb.MapKey.Key)
+}
+
+func (p *printer) globFilters(filters []*d2ast.Key) {
+	inKey := p.inKey
+	p.sb.WriteByte('[')
+	for i, f := range filters {
+		if i > 0 {
+			p.sb.WriteString(", ")
+		}
+		p.key(f.Key)
+		if f.NotAmpersand {
+			p.sb.WriteString("!=")
+		} else {
+			p.sb.WriteByte('=')
+		}
+		p.node(f.Value.Unbox())
+	}
+	p.sb.WriteByte(']')
+	p.inKey = inKey
+}
+
 func (p *printer) key(k *d2ast.KeyPath) {
 	p.inKey = true
 	if k != nil {
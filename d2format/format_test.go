@@ -657,6 +657,49 @@ x: @../file
 x: @"x/../file"
 `,
 			exp: `x: @file
+`,
+		},
+		{
+			name: "import/subtree",
+			in: `
+...@./file.d2#db.primary
+x: @file#"db"
+`,
+			exp: `...@file#db.primary
+x: @file#"db"
+`,
+		},
+		{
+			name: "substitution_expression",
+			in: `a: ${ base-width*2 }
+b: "${name + '-svc'}"
+`,
+			exp: `a: ${base-width*2}
+b: "${name + '-svc'}"
+`,
+		},
+		{
+			name: "import/args",
+			in: `
+x: @svc(  name :auth,color: "#0ff" )
+...@svc#db(size: 2)
+`,
+			exp: `x: @svc(name: auth, color: "#0ff")
+...@svc#db(size: 2)
+`,
+		},
+		{
+			name: "glob_filters",
+			in: `
+*[ shape=cylinder,style.fill!="red" ].style.stroke: blue
+!*-db: {
+  *[shape != circle]: service
+}
+`,
+			exp: `*[shape=cylinder, style.fill!="red"].style.stroke: blue
+!*-db: {
+  *[shape!=circle]: service
+}
 `,
 		},
 		{
@@ -861,3 +904,125 @@ func TestEdge(t *testing.T) {
 	assert.String(t, `x -> y`, d2format.Format(mk.Edges[0]))
 	assert.String(t, `[0]`, d2format.Format(mk.EdgeIndex))
 }
+
+func TestFormatWithOptions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		opts d2format.Options
+		in   string
+		exp  string
+	}{
+		{
+			name: "indent",
+			opts: d2format.Options{Indent: "\t"},
+			in: `a: {
+  b: {
+    c
+  }
+  d: |md
+    # hi
+  |
+}
+`,
+			exp: `a: {
+	b: {
+		c
+	}
+	d: |md
+		# hi
+	|
+}
+`,
+		},
+		{
+			name: "width",
+			opts: d2format.Options{Width: 30},
+			in: `short: {shape: circle}
+long: {shape: hexagon; style.fill: red; label: "a long label"}
+nested: {a: {shape: circle; style.fill: yellow; label: hello}}
+arr: [1; 2; 3; 4; 5; 6; 7; 8; 9; 10; 11; 12]
+`,
+			exp: `short: {shape: circle}
+long: {
+  shape: hexagon
+  style.fill: red
+  label: "a long label"
+}
+nested: {
+  a: {
+    shape: circle
+    style.fill: yellow
+    label: hello
+  }
+}
+arr: [
+  1
+  2
+  3
+  4
+  5
+  6
+  7
+  8
+  9
+  10
+  11
+  12
+]
+`,
+		},
+		{
+			name: "sort_styles",
+			opts: d2format.Options{SortStyles: true},
+			in: `a: {
+  style: {
+    stroke: red
+    fill: blue
+    # grouped separately
+    opacity: 0.5
+    bold: true
+
+    italic: true
+    font-color: green
+  }
+  shape: circle
+  label: a
+}
+a.style: {stroke-dash: 3; fill: red}
+(a -> b)[0].style: {stroke: red; animated: true}
+`,
+			exp: `a: {
+  style: {
+    fill: blue
+    stroke: red
+    # grouped separately
+    bold: true
+    opacity: 0.5
+
+    font-color: green
+    italic: true
+  }
+  shape: circle
+  label: a
+}
+a.style: {fill: red; stroke-dash: 3}
+(a -> b)[0].style: {animated: true; stroke: red}
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ast, err := d2parser.Parse(fmt.Sprintf("%s.d2", t.Name()), strings.NewReader(tc.in), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.String(t, tc.exp, d2format.FormatWithOptions(ast, &tc.opts))
+		})
+	}
+}
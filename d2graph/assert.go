@@ -0,0 +1,201 @@
+package d2graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+)
+
+// Assertion is a rule set with assert that an object and what's in it must hold, checked
+// once its board is compiled
+type Assertion struct {
+	Value string `json:"value"`
+	// Node is where the assertion is written, for errors
+	Node d2ast.Node `json:"-"`
+}
+
+// AssertionFailedError is the error of an assertion that doesn't hold, as opposed to one that
+// isn't valid
+type AssertionFailedError struct {
+	msg string
+}
+
+func (e *AssertionFailedError) Error() string {
+	return e.msg
+}
+
+var assertCountOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// CheckAssertion checks an assertion on obj, returning an error if it doesn't hold or isn't
+// valid. Assertions are queries like Query's, relative to obj, in one of two forms:
+//
+//   - A query of an attribute compared to a value with == or !=, e.g. *.shape != circle,
+//     holds if what the query selects all have, or all don't have, the value. Attributes that
+//     aren't set have no value, and values can use * like queries.
+//   - count of a query compared to a number with ==, !=, <, <=, > or >=, e.g.
+//     count(*.db) >= 1.
+func (obj *Object) CheckAssertion(assertion string) error {
+	s := strings.TrimSpace(assertion)
+	if strings.HasPrefix(s, "count(") {
+		end := strings.LastIndex(s, ")")
+		if end == -1 {
+			return fmt.Errorf("invalid assertion %q: missing )", assertion)
+		}
+		pattern := s[len("count("):end]
+		op, want := cutAssertOp(s[end+1:], assertCountOps)
+		if op == "" {
+			return fmt.Errorf("invalid assertion %q: expected count(...) to be compared to a number with one of %s", assertion, strings.Join(assertCountOps, " "))
+		}
+		n, err := strconv.Atoi(want)
+		if err != nil {
+			return fmt.Errorf("invalid assertion %q: expected a number after %s, got %q", assertion, op, want)
+		}
+		objects, edges, err := obj.query(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid assertion %q: %w", assertion, err)
+		}
+		got := len(objects) + len(edges)
+		holds := map[string]bool{
+			"==": got == n,
+			"!=": got != n,
+			"<=": got <= n,
+			">=": got >= n,
+			"<":  got < n,
+			">":  got > n,
+		}[op]
+		if !holds {
+			return &AssertionFailedError{fmt.Sprintf("assertion %q failed%s: counted %d", assertion, obj.assertionScope(), got)}
+		}
+		return nil
+	}
+
+	var pattern, op, want string
+	var quote rune
+	for i, r := range s {
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		if r == '"' || r == '\'' {
+			quote = r
+			continue
+		}
+		if strings.HasPrefix(s[i:], "==") || strings.HasPrefix(s[i:], "!=") {
+			pattern, op, want = strings.TrimSpace(s[:i]), s[i:i+2], strings.TrimSpace(s[i+2:])
+			break
+		}
+	}
+	if op == "" {
+		return fmt.Errorf("invalid assertion %q: expected an attribute compared to a value, like *.shape != circle, or a count, like count(*.db) >= 1", assertion)
+	}
+	if len(want) >= 2 && (want[0] == '"' || want[0] == '\'') && want[len(want)-1] == want[0] {
+		want = want[1 : len(want)-1]
+	}
+
+	mk, err := parseQueryKey(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid assertion %q: %w", assertion, err)
+	}
+	// What the query selects without the attribute, to find what has the attribute unset
+	all := mk.Copy()
+	if len(mk.Edges) == 0 {
+		objPattern, attr, err := splitQueryAttribute(keyPath(mk.Key))
+		if err != nil {
+			return fmt.Errorf("invalid assertion %q: %w", assertion, err)
+		}
+		if len(attr) == 0 {
+			return fmt.Errorf("invalid assertion %q: expected %s to end with the attribute to compare, like *.shape", assertion, pattern)
+		}
+		all.Key = &d2ast.KeyPath{Path: objPattern}
+	} else {
+		if mk.EdgeKey == nil {
+			return fmt.Errorf("invalid assertion %q: expected %s to end with the attribute to compare, like (* -> *)[*].style.stroke", assertion, pattern)
+		}
+		all.EdgeKey = nil
+	}
+
+	selected := make(map[string]struct{})
+	matchObjects, matchEdges, err := obj.queryKey(pattern, mk, want, true)
+	if err != nil {
+		return fmt.Errorf("invalid assertion %q: %w", assertion, err)
+	}
+	for _, o := range matchObjects {
+		selected[o.AbsID()] = struct{}{}
+	}
+	for _, e := range matchEdges {
+		selected[e.AbsID()] = struct{}{}
+	}
+	allObjects, allEdges, err := obj.queryKey(pattern, all, "", false)
+	if err != nil {
+		return fmt.Errorf("invalid assertion %q: %w", assertion, err)
+	}
+	var ids []string
+	for _, o := range allObjects {
+		ids = append(ids, o.AbsID())
+	}
+	for _, e := range allEdges {
+		ids = append(ids, e.AbsID())
+	}
+
+	var violations []string
+	for _, id := range ids {
+		if _, ok := selected[id]; ok == (op == "!=") {
+			violations = append(violations, id)
+		}
+	}
+	if len(violations) > 0 {
+		return &AssertionFailedError{fmt.Sprintf("assertion %q failed on %s", assertion, strings.Join(violations, ", "))}
+	}
+	return nil
+}
+
+// cutAssertOp cuts the first of ops from the start of s and returns it and what's after it
+func cutAssertOp(s string, ops []string) (string, string) {
+	s = strings.TrimSpace(s)
+	for _, op := range ops {
+		if strings.HasPrefix(s, op) {
+			return op, strings.TrimSpace(s[len(op):])
+		}
+	}
+	return "", ""
+}
+
+// query is Query relative to obj
+func (obj *Object) query(pattern string) ([]*Object, []*Edge, error) {
+	keyPattern, value, hasValue := splitQueryValue(pattern)
+	mk, err := parseQueryKey(keyPattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return obj.queryKey(pattern, mk, value, hasValue)
+}
+
+// queryKey is queryKey of the graph of obj relative to obj
+func (obj *Object) queryKey(pattern string, mk *d2ast.Key, value string, hasValue bool) ([]*Object, []*Edge, error) {
+	if obj.Parent != nil {
+		var prefix []*d2ast.StringBox
+		for _, id := range idVals(obj) {
+			prefix = append(prefix, d2ast.MakeValueBox(d2ast.RawString(id, true)).StringBox())
+		}
+		mk = mk.Copy()
+		var path []*d2ast.StringBox
+		if mk.Key != nil {
+			path = mk.Key.Path
+		}
+		mk.Key = &d2ast.KeyPath{Path: append(prefix, path...)}
+	}
+	return obj.Graph.queryKey(pattern, mk, value, hasValue)
+}
+
+// assertionScope describes the object an assertion failed on in its error, if it's not the
+// root
+func (obj *Object) assertionScope() string {
+	if obj.Parent == nil {
+		return ""
+	}
+	return " in " + obj.AbsID()
+}
@@ -0,0 +1,65 @@
+package d2graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+)
+
+func TestCheckAssertion(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`users-service: {
+  api
+  db: {shape: cylinder}
+  api -> db
+}
+orders-service: {
+  api: {shape: circle}
+}
+queue: {shape: queue}
+users-service.api -> queue: {style.stroke: red}
+`), nil)
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		on        string
+		assertion string
+		err       string
+	}{
+		{assertion: "*.shape != circle"},
+		{assertion: "**.shape != circle", err: `assertion "**.shape != circle" failed on orders-service.api`},
+		{assertion: "*-service.shape == rectangle"},
+		{assertion: "**.shape == rect*", err: `assertion "**.shape == rect*" failed on users-service.db, orders-service.api, queue`},
+		{assertion: `queue.shape == "queue"`},
+		{assertion: "(** -> **)[*].style.stroke == red", err: `assertion "(** -> **)[*].style.stroke == red" failed on users-service.(api -> db)[0]`},
+		{assertion: "count(*-service) == 2"},
+		{assertion: "count(**.shape=cylinder) >= 1"},
+		{assertion: "count(** -> queue) < 1", err: `assertion "count(** -> queue) < 1" failed: counted 1`},
+		{on: "users-service", assertion: "count(db) == 1"},
+		{on: "users-service", assertion: "count(api -> db) > 0"},
+		{on: "orders-service", assertion: "count(db) >= 1", err: `assertion "count(db) >= 1" failed in orders-service: counted 0`},
+		{on: "orders-service", assertion: "*.shape == circle"},
+		{assertion: "*.shape", err: `invalid assertion "*.shape": expected an attribute compared to a value, like *.shape != circle, or a count, like count(*.db) >= 1`},
+		{assertion: "* == circle", err: `invalid assertion "* == circle": expected * to end with the attribute to compare, like *.shape`},
+		{assertion: "count(*) => 1", err: `invalid assertion "count(*) => 1": expected count(...) to be compared to a number with one of == != <= >= < >`},
+		{assertion: "count(*) > many", err: `invalid assertion "count(*) > many": expected a number after >, got "many"`},
+	}
+	for _, tc := range testCases {
+		obj := g.Root
+		if tc.on != "" {
+			var ok bool
+			obj, ok = g.Root.HasChild([]string{tc.on})
+			assert.True(t, ok, tc.on)
+		}
+		err := obj.CheckAssertion(tc.assertion)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+			continue
+		}
+		assert.Nil(t, err, tc.assertion)
+	}
+}
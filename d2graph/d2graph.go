@@ -8,6 +8,7 @@ import (
 	"io/fs"
 	"math"
 	"net/url"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,6 +30,7 @@ import (
 	"oss.terrastruct.com/d2/lib/geo"
 	"oss.terrastruct.com/d2/lib/label"
 	"oss.terrastruct.com/d2/lib/shape"
+	"oss.terrastruct.com/d2/lib/sliceindex"
 	"oss.terrastruct.com/d2/lib/textmeasure"
 )
 
@@ -36,10 +38,24 @@ const INNER_LABEL_PADDING int = 5
 const DEFAULT_SHAPE_SIZE = 100.
 const MIN_SHAPE_SIZE = 5
 
+// AUTO_FONT_SIZE as a font-size shrinks the label of a fixed size shape until it fits,
+// down to MIN_AUTO_FONT_SIZE
+const AUTO_FONT_SIZE = "auto"
+const MIN_AUTO_FONT_SIZE = 8
+
+// JSON_SCHEMA_VERSION is the version of the schema of JSON exports of laid out diagrams
+// (d2renderers/d2json). It's bumped whenever a field is removed or changes meaning, while
+// new fields can be added without bumping it.
+const JSON_SCHEMA_VERSION = 1
+
 type Graph struct {
-	FS     fs.FS  `json:"-"`
-	Parent *Graph `json:"-"`
-	Name   string `json:"name"`
+	FS fs.FS `json:"-"`
+	// IconDir is the directory of icon packs the graph was compiled with
+	IconDir string `json:"-"`
+	// FetchImport fetches the remote imports of the graph when it's recompiled
+	FetchImport func(url string) ([]byte, error) `json:"-"`
+	Parent      *Graph                           `json:"-"`
+	Name        string                           `json:"name"`
 	// IsFolderOnly indicates a board or scenario itself makes no modifications from its
 	// base. Folder only boards do not have a render and are used purely for organizing
 	// the board tree.
@@ -60,6 +76,25 @@ type Graph struct {
 
 	// Object.Level uses the location of a nested graph
 	RootLevel int `json:"rootLevel,omitempty"`
+
+	// Warnings are the problems in the input that don't stop it from compiling, like classes
+	// that are never used. Only the root board has them.
+	Warnings []Warning `json:"-"`
+
+	// edgeIndex groups Edges by what they connect, for Connect to count the edges before each
+	edgeIndex sliceindex.Index[edgeIndexKey, *Edge]
+}
+
+// Warning is a problem in the input that doesn't stop it from compiling
+type Warning struct {
+	// Code is the kind of problem, one of d2ast's DIAGNOSTIC_ codes
+	Code    string      `json:"code"`
+	Range   d2ast.Range `json:"range"`
+	Message string      `json:"message"`
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Range, w.Message)
 }
 
 func NewGraph() *Graph {
@@ -107,11 +142,18 @@ type Object struct {
 	*geo.Box      `json:"box,omitempty"`
 	LabelPosition *string `json:"labelPosition,omitempty"`
 	IconPosition  *string `json:"iconPosition,omitempty"`
+	// WrappedLabel is the label with the line breaks it's wrapped at to fit its shape, which
+	// it's measured and rendered with. The label itself is kept as written.
+	WrappedLabel string `json:"wrappedLabel,omitempty"`
 
 	ContentAspectRatio *float64 `json:"contentAspectRatio,omitempty"`
 
 	Class    *d2target.Class    `json:"class,omitempty"`
 	SQLTable *d2target.SQLTable `json:"sql_table,omitempty"`
+	// CustomShape is the definition read from the shape-src of custom shapes
+	CustomShape *shape.CustomDefinition `json:"customShape,omitempty"`
+	// Assertions are set with assert and checked once the board of the object is compiled
+	Assertions []Assertion `json:"assertions,omitempty"`
 
 	Children      map[string]*Object `json:"-"`
 	ChildrenArray []*Object          `json:"-"`
@@ -129,6 +171,11 @@ type Attributes struct {
 	Icon    *url.URL `json:"icon,omitempty"`
 	Tooltip *Scalar  `json:"tooltip,omitempty"`
 	Link    *Scalar  `json:"link,omitempty"`
+	Hidden  *Scalar  `json:"hidden,omitempty"`
+	// Collapsed containers are drawn without their descendants, see CollapseMarked
+	Collapsed *Scalar `json:"collapsed,omitempty"`
+	// DirectionMirror is only set on the root of boards
+	DirectionMirror *Scalar `json:"directionMirror,omitempty"`
 
 	WidthAttr  *Scalar `json:"width,omitempty"`
 	HeightAttr *Scalar `json:"height,omitempty"`
@@ -136,10 +183,31 @@ type Attributes struct {
 	Top  *Scalar `json:"top,omitempty"`
 	Left *Scalar `json:"left,omitempty"`
 
+	// Connections only, as preferences for layout engines
+	Straighten *Scalar `json:"straighten,omitempty"`
+	MinLength  *Scalar `json:"minLength,omitempty"`
+
 	// TODO consider separate Attributes struct for shape-specific and edge-specific
 	// Shapes only
 	NearKey  *d2ast.KeyPath `json:"near_key"`
 	Language string         `json:"language,omitempty"`
+	// sql_table shapes only
+	MaxRows *Scalar `json:"maxRows,omitempty"`
+	// Class shapes only
+	Stereotype *Scalar `json:"stereotype,omitempty"`
+	GroupBy    *Scalar `json:"groupBy,omitempty"`
+	// Custom shapes only, the path of the SVG they're drawn from
+	ShapeSrc *Scalar `json:"shapeSrc,omitempty"`
+	// Board shapes only, the path of the board they embed
+	Board *Scalar `json:"board,omitempty"`
+	// Class members only, "static" or "abstract"
+	Modifier *Scalar `json:"modifier,omitempty"`
+	// Code shapes only, from code.line-numbers and code.highlight
+	LineNumbers    *Scalar `json:"lineNumbers,omitempty"`
+	HighlightLines *Scalar `json:"highlightLines,omitempty"`
+	// Where to place the shape when it's near another object
+	NearSide *Scalar `json:"nearSide,omitempty"`
+	NearGap  *Scalar `json:"nearGap,omitempty"`
 	// TODO: default to ShapeRectangle instead of empty string
 	Shape Scalar `json:"shape"`
 
@@ -227,7 +295,23 @@ type Style struct {
 	Underline     *Scalar `json:"underline,omitempty"`
 	Filled        *Scalar `json:"filled,omitempty"`
 	DoubleBorder  *Scalar `json:"doubleBorder,omitempty"`
+	BorderStyle   *Scalar `json:"borderStyle,omitempty"`
 	TextTransform *Scalar `json:"textTransform,omitempty"`
+	TextAlign     *Scalar `json:"textAlign,omitempty"`
+	TextDirection *Scalar `json:"textDirection,omitempty"`
+	LatexScale    *Scalar `json:"latexScale,omitempty"`
+	Header        *Scalar `json:"header,omitempty"`
+	Bundle        *Scalar `json:"bundle,omitempty"`
+	LayerGroup    *Scalar `json:"layerGroup,omitempty"`
+}
+
+// LatexScaleValue returns how many times their normal size LaTeX labels are, or 0 if unset
+func (s Style) LatexScaleValue() float64 {
+	if s.LatexScale == nil {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(s.LatexScale.Value, 64)
+	return f
 }
 
 // NoneTextTransform will return a boolean if the text should not have any
@@ -260,8 +344,12 @@ func (s *Style) Apply(key, value string) error {
 		if s.Fill == nil {
 			break
 		}
-		if !go2.Contains(color.NamedColors, strings.ToLower(value)) && !color.ColorHexRegex.MatchString(value) {
-			return errors.New(`expected "fill" to be a valid named color ("orange") or a hex code ("#f0ff3a")`)
+		if color.IsGradient(value) {
+			if _, err := color.ParseGradient(value); err != nil {
+				return fmt.Errorf(`expected "fill" to be a valid gradient: %v`, err)
+			}
+		} else if !go2.Contains(color.NamedColors, strings.ToLower(value)) && !color.ColorHexRegex.MatchString(value) {
+			return errors.New(`expected "fill" to be a valid named color ("orange"), a hex code ("#f0ff3a") or a gradient ("linear-gradient(#fff, #ccc)")`)
 		}
 		s.Fill.Value = value
 	case "fill-pattern":
@@ -338,9 +426,13 @@ func (s *Style) Apply(key, value string) error {
 		if s.FontSize == nil {
 			break
 		}
+		if strings.EqualFold(value, AUTO_FONT_SIZE) {
+			s.FontSize.Value = AUTO_FONT_SIZE
+			break
+		}
 		f, err := strconv.Atoi(value)
 		if err != nil || (f < 8 || f > 100) {
-			return errors.New(`expected "font-size" to be a number between 8 and 100`)
+			return errors.New(`expected "font-size" to be a number between 8 and 100, or auto`)
 		}
 		s.FontSize.Value = value
 	case "font-color":
@@ -405,6 +497,39 @@ func (s *Style) Apply(key, value string) error {
 			return errors.New(`expected "double-border" to be true or false`)
 		}
 		s.DoubleBorder.Value = value
+	case "border-style":
+		if s.BorderStyle == nil {
+			break
+		}
+		if !go2.Contains(BorderStyles, strings.ToLower(value)) {
+			return fmt.Errorf(`expected "border-style" to be one of (%s)`, strings.Join(BorderStyles, ", "))
+		}
+		s.BorderStyle.Value = value
+	case "latex-scale":
+		if s.LatexScale == nil {
+			break
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f <= 0 || f > 10 {
+			return errors.New(`expected "latex-scale" to be a number greater than 0 and at most 10`)
+		}
+		s.LatexScale.Value = value
+	case "text-align":
+		if s.TextAlign == nil {
+			break
+		}
+		if !go2.Contains(TextAligns, strings.ToLower(value)) {
+			return fmt.Errorf(`expected "text-align" to be one of (%s)`, strings.Join(TextAligns, ", "))
+		}
+		s.TextAlign.Value = value
+	case "text-direction":
+		if s.TextDirection == nil {
+			break
+		}
+		if !go2.Contains(TextDirections, strings.ToLower(value)) {
+			return fmt.Errorf(`expected "text-direction" to be one of (%s)`, strings.Join(TextDirections, ", "))
+		}
+		s.TextDirection.Value = value
 	case "text-transform":
 		if s.TextTransform == nil {
 			break
@@ -413,6 +538,31 @@ func (s *Style) Apply(key, value string) error {
 			return fmt.Errorf(`expected "text-transform" to be one of (%s)`, strings.Join(textTransforms, ", "))
 		}
 		s.TextTransform.Value = value
+	case "header":
+		if s.Header == nil {
+			break
+		}
+		if !go2.Contains(HeaderStyles, strings.ToLower(value)) {
+			return fmt.Errorf(`expected "header" to be one of (%s)`, strings.Join(HeaderStyles, ", "))
+		}
+		s.Header.Value = value
+	case "bundle":
+		if s.Bundle == nil {
+			break
+		}
+		_, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New(`expected "bundle" to be true or false`)
+		}
+		s.Bundle.Value = value
+	case "layer-group":
+		if s.LayerGroup == nil {
+			break
+		}
+		if !layerGroupRegexp.MatchString(value) {
+			return errors.New(`expected "layer-group" to be a name of letters, digits, "-" and "_"`)
+		}
+		s.LayerGroup.Value = value
 	default:
 		return fmt.Errorf("unknown style key: %s", key)
 	}
@@ -546,7 +696,7 @@ func (obj *Object) HasOutsideBottomLabel() bool {
 		return false
 	}
 	switch obj.Shape.Value {
-	case d2target.ShapeImage, d2target.ShapePerson:
+	case d2target.ShapeImage, d2target.ShapeBoard, d2target.ShapePerson, d2target.ShapeActor:
 		return true
 	default:
 		return false
@@ -583,6 +733,11 @@ func (obj *Object) AbsIDArray() []string {
 	return append(obj.Parent.AbsIDArray(), obj.ID)
 }
 
+// HasLineNumbers returns whether obj is code with code.line-numbers set
+func (obj *Object) HasLineNumbers() bool {
+	return obj.LineNumbers != nil && obj.LineNumbers.Value == "true"
+}
+
 func (obj *Object) Text() *d2target.MText {
 	isBold := !obj.IsContainer() && obj.Shape.Value != "text"
 	isItalic := false
@@ -606,7 +761,8 @@ func (obj *Object) Text() *d2target.MText {
 	} else {
 		isBold = false
 	}
-	if obj.Style.FontSize != nil {
+	// font-size: auto keeps the default until it's resolved in SetDimensions
+	if obj.Style.FontSize != nil && obj.Style.FontSize.Value != AUTO_FONT_SIZE {
 		fontSize, _ = strconv.Atoi(obj.Style.FontSize.Value)
 	}
 	// Class and Table objects have Label set to header
@@ -616,8 +772,12 @@ func (obj *Object) Text() *d2target.MText {
 	if obj.Class != nil {
 		isBold = false
 	}
+	text := obj.Label.Value
+	if obj.WrappedLabel != "" {
+		text = obj.WrappedLabel
+	}
 	return &d2target.MText{
-		Text:     obj.Label.Value,
+		Text:     text,
 		FontSize: fontSize,
 		IsBold:   isBold,
 		IsItalic: isItalic,
@@ -861,7 +1021,8 @@ func (obj *Object) AppendReferences(ida []string, ref Reference, unresolvedObj *
 	}
 }
 
-func (obj *Object) GetLabelSize(mtexts []*d2target.MText, ruler *textmeasure.Ruler, fontFamily *d2fonts.FontFamily) (*d2target.TextDimensions, error) {
+func (obj *Object) GetLabelSize(mtexts []*d2target.MText, ruler textmeasure.TextMeasurer, fontFamily *d2fonts.FontFamily) (*d2target.TextDimensions, error) {
+	ruler = measurerOrNil(ruler)
 	shapeType := strings.ToLower(obj.Shape.Value)
 
 	if obj.Style.Font != nil {
@@ -873,7 +1034,7 @@ func (obj *Object) GetLabelSize(mtexts []*d2target.MText, ruler *textmeasure.Rul
 	switch shapeType {
 	case d2target.ShapeText:
 		if obj.Language == "latex" {
-			width, height, err := d2latex.Measure(obj.Text().Text)
+			width, height, err := d2latex.Measure(obj.Text().Text, obj.Style.LatexScaleValue())
 			if err != nil {
 				return nil, err
 			}
@@ -906,7 +1067,7 @@ func (obj *Object) GetLabelSize(mtexts []*d2target.MText, ruler *textmeasure.Rul
 		if obj.Text().Text == "" {
 			return d2target.NewTextDimensions(0, 0), nil
 		}
-		if shapeType == d2target.ShapeImage {
+		if shapeType == d2target.ShapeImage || shapeType == d2target.ShapeBoard {
 			dims = d2target.NewTextDimensions(0, 0)
 		} else {
 			return nil, fmt.Errorf("dimensions for object label %#v not found", obj.Text())
@@ -916,7 +1077,103 @@ func (obj *Object) GetLabelSize(mtexts []*d2target.MText, ruler *textmeasure.Rul
 	return dims, nil
 }
 
-func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.Ruler, fontFamily *d2fonts.FontFamily, labelDims d2target.TextDimensions, withLabelPadding bool) (*d2target.TextDimensions, error) {
+// fitFontSize resolves font-size: auto to the largest size, no larger than the default,
+// at which the label fits inside the shape's desired width and height. Labels which don't fit on
+// one line at any size are wrapped to the width.
+func (obj *Object) fitFontSize(mtexts []*d2target.MText, ruler textmeasure.TextMeasurer, fontFamily *d2fonts.FontFamily, desiredWidth, desiredHeight int) error {
+	fontSize := obj.Text().FontSize
+	// Without a ruler only the default size has been measured
+	fits := ruler == nil || (desiredWidth == 0 && desiredHeight == 0)
+	if obj.LabelPosition != nil && label.FromString(*obj.LabelPosition).IsOutside() {
+		fits = true
+	}
+
+	if !fits {
+		maxWidth, maxHeight := math.Inf(1), math.Inf(1)
+		box := geo.NewBox(geo.NewPoint(0, 0), float64(desiredWidth), float64(desiredHeight))
+		innerBox := obj.newShape(box).GetInnerBox()
+		if desiredWidth != 0 {
+			maxWidth = innerBox.Width - float64(2*INNER_LABEL_PADDING)
+		}
+		if desiredHeight != 0 {
+			maxHeight = innerBox.Height - float64(2*INNER_LABEL_PADDING)
+		}
+		fitsAt := func(size int) (bool, error) {
+			obj.Style.FontSize.Value = strconv.Itoa(size)
+			dims, err := obj.GetLabelSize(mtexts, ruler, fontFamily)
+			if err != nil {
+				return false, err
+			}
+			return float64(dims.Width) <= maxWidth && float64(dims.Height) <= maxHeight, nil
+		}
+		for size := fontSize; size >= MIN_AUTO_FONT_SIZE && !fits; size-- {
+			ok, err := fitsAt(size)
+			if err != nil {
+				return err
+			}
+			if ok {
+				fontSize, fits = size, true
+			}
+		}
+
+		// Long labels, like sentences in scripts written without spaces, fit at no size on one
+		// line, so they're wrapped and shrunk only as much as is still needed
+		if !fits && obj.Language == "" && desiredWidth != 0 {
+			unwrapped := obj.Label.Value
+			for size := fontSize; size >= MIN_AUTO_FONT_SIZE && !fits; size-- {
+				obj.Style.FontSize.Value = strconv.Itoa(size)
+				obj.Label.Value = textmeasure.Wrap(unwrapped, int(maxWidth), func(s string) int {
+					t := *obj.Text()
+					t.Text = s
+					return GetTextDimensions(nil, ruler, &t, fontFamily).Width
+				})
+				ok, err := fitsAt(size)
+				if err != nil {
+					return err
+				}
+				if ok {
+					fontSize, fits = size, true
+				}
+			}
+			if !fits {
+				obj.Label.Value = unwrapped
+			}
+		}
+		if !fits {
+			fontSize = MIN_AUTO_FONT_SIZE
+		}
+	}
+	obj.Style.FontSize.Value = strconv.Itoa(fontSize)
+	return nil
+}
+
+// wrapLabel sets the wrapped label of CJK and right-to-left labels inside shapes to fit the
+// desired width of their shape, which they'd otherwise overflow
+func (obj *Object) wrapLabel(ruler textmeasure.TextMeasurer, fontFamily *d2fonts.FontFamily, desiredWidth int) {
+	obj.WrappedLabel = ""
+	if ruler == nil || desiredWidth == 0 || obj.Language != "" || !textmeasure.ContainsCJKOrRTL(obj.Label.Value) {
+		return
+	}
+	// Labels outside their shape aren't bound by its width. Before layout, only the ones set
+	// with label.near are positioned, and the others are outside by default on these shapes.
+	if obj.HasOutsideBottomLabel() || obj.LabelPosition != nil && label.FromString(*obj.LabelPosition).IsOutside() {
+		return
+	}
+	box := geo.NewBox(geo.NewPoint(0, 0), float64(desiredWidth), 0)
+	innerBox := obj.newShape(box).GetInnerBox()
+	maxWidth := innerBox.Width - float64(2*INNER_LABEL_PADDING)
+	wrapped := textmeasure.Wrap(obj.Label.Value, int(maxWidth), func(s string) int {
+		t := *obj.Text()
+		t.Text = s
+		return GetTextDimensions(nil, ruler, &t, fontFamily).Width
+	})
+	if wrapped != obj.Label.Value {
+		obj.WrappedLabel = wrapped
+	}
+}
+
+func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler textmeasure.TextMeasurer, fontFamily *d2fonts.FontFamily, labelDims d2target.TextDimensions, withLabelPadding bool) (*d2target.TextDimensions, error) {
+	ruler = measurerOrNil(ruler)
 	dims := d2target.TextDimensions{}
 	dslShape := strings.ToLower(obj.Shape.Value)
 
@@ -925,6 +1182,9 @@ func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.R
 		// 0.5em padding on each side
 		labelDims.Width += fontSize
 		labelDims.Height += fontSize
+		if obj.HasLineNumbers() {
+			labelDims.Width += d2target.CodeGutterWidth(obj.Label.Value, fontSize)
+		}
 	} else if withLabelPadding {
 		labelDims.Width += INNER_LABEL_PADDING
 		labelDims.Height += INNER_LABEL_PADDING
@@ -947,6 +1207,9 @@ func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.R
 	case d2target.ShapeImage:
 		return d2target.NewTextDimensions(128, 128), nil
 
+	case d2target.ShapeBoard:
+		return d2target.NewTextDimensions(256, 192), nil
+
 	case d2target.ShapeClass:
 		maxWidth := go2.Max(12, labelDims.Width)
 
@@ -955,7 +1218,17 @@ func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.R
 			fontSize, _ = strconv.Atoi(obj.Style.FontSize.Value)
 		}
 
+		if obj.Class.Stereotype != "" {
+			sdims := GetTextDimensions(mtexts, ruler, obj.Class.StereotypeText(fontSize), go2.Pointer(d2fonts.SourceCodePro))
+			if sdims == nil {
+				return nil, fmt.Errorf("dimensions for class stereotype %#v not found", obj.Class.Stereotype)
+			}
+			maxWidth = go2.Max(maxWidth, sdims.Width)
+		}
 		for _, f := range obj.Class.Fields {
+			if f.Shape == d2target.ShapeRowSeparator {
+				continue
+			}
 			fdims := GetTextDimensions(mtexts, ruler, f.Text(fontSize), go2.Pointer(d2fonts.SourceCodePro))
 			if fdims == nil {
 				return nil, fmt.Errorf("dimensions for class field %#v not found", f.Text(fontSize))
@@ -963,6 +1236,9 @@ func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.R
 			maxWidth = go2.Max(maxWidth, fdims.Width)
 		}
 		for _, m := range obj.Class.Methods {
+			if m.Shape == d2target.ShapeRowSeparator {
+				continue
+			}
 			mdims := GetTextDimensions(mtexts, ruler, m.Text(fontSize), go2.Pointer(d2fonts.SourceCodePro))
 			if mdims == nil {
 				return nil, fmt.Errorf("dimensions for class method %#v not found", m.Text(fontSize))
@@ -979,10 +1255,19 @@ func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.R
 
 		// All rows should be the same height
 		var anyRowText *d2target.MText
-		if len(obj.Class.Fields) > 0 {
-			anyRowText = obj.Class.Fields[0].Text(fontSize)
-		} else if len(obj.Class.Methods) > 0 {
-			anyRowText = obj.Class.Methods[0].Text(fontSize)
+		for _, f := range obj.Class.Fields {
+			if f.Shape != d2target.ShapeRowSeparator {
+				anyRowText = f.Text(fontSize)
+				break
+			}
+		}
+		if anyRowText == nil {
+			for _, m := range obj.Class.Methods {
+				if m.Shape != d2target.ShapeRowSeparator {
+					anyRowText = m.Text(fontSize)
+					break
+				}
+			}
 		}
 		if anyRowText != nil {
 			rowHeight := GetTextDimensions(mtexts, ruler, anyRowText, go2.Pointer(d2fonts.SourceCodePro)).Height + d2target.VerticalPadding
@@ -995,17 +1280,33 @@ func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.R
 		maxNameWidth := 0
 		maxTypeWidth := 0
 		maxConstraintWidth := 0
+		// Header rows span the whole row rather than the name column
+		maxHeaderWidth := 0
 
 		colFontSize := d2fonts.FONT_SIZE_L
 		if obj.Style.FontSize != nil {
 			colFontSize, _ = strconv.Atoi(obj.Style.FontSize.Value)
 		}
 
-		for i := range obj.SQLTable.Columns {
+		// Hidden columns don't widen the table
+		for i := range obj.SQLTable.VisibleColumns() {
 			// Note: we want to set dimensions of actual column not the for loop copy of the struct
 			c := &obj.SQLTable.Columns[i]
+			if c.Shape == d2target.ShapeRowSeparator {
+				continue
+			}
 
 			ctexts := c.Texts(colFontSize)
+			if c.Shape == d2target.ShapeRowHeader {
+				headerDims := GetTextDimensions(mtexts, ruler, ctexts[0], fontFamily)
+				if headerDims == nil {
+					return nil, fmt.Errorf("dimensions for sql_table header %#v not found", ctexts[0].Text)
+				}
+				c.Name.LabelWidth = headerDims.Width
+				c.Name.LabelHeight = headerDims.Height
+				maxHeaderWidth = go2.Max(maxHeaderWidth, headerDims.Width)
+				continue
+			}
 
 			nameDims := GetTextDimensions(mtexts, ruler, ctexts[0], fontFamily)
 			if nameDims == nil {
@@ -1024,21 +1325,54 @@ func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.R
 			maxTypeWidth = go2.Max(maxTypeWidth, typeDims.Width)
 
 			if l := len(c.Constraint); l > 0 {
-				constraintDims := GetTextDimensions(mtexts, ruler, ctexts[2], fontFamily)
-				if constraintDims == nil {
-					return nil, fmt.Errorf("dimensions for sql_table constraint %#v not found", ctexts[2].Text)
+				textWidth := 0
+				if ctexts[2].Text != "" {
+					constraintDims := GetTextDimensions(mtexts, ruler, ctexts[2], fontFamily)
+					if constraintDims == nil {
+						return nil, fmt.Errorf("dimensions for sql_table constraint %#v not found", ctexts[2].Text)
+					}
+					textWidth = constraintDims.Width
 				}
-				maxConstraintWidth = go2.Max(maxConstraintWidth, constraintDims.Width)
+				maxConstraintWidth = go2.Max(maxConstraintWidth, c.ConstraintWidth(textWidth, colFontSize))
 			}
 		}
 
+		// Indexes are laid out like columns, with the columns they're on as their type
+		for i := range obj.SQLTable.Indexes {
+			idx := &obj.SQLTable.Indexes[i]
+			texts := idx.Texts(colFontSize)
+			nameDims := GetTextDimensions(mtexts, ruler, texts[0], fontFamily)
+			if nameDims == nil {
+				return nil, fmt.Errorf("dimensions for sql_table index %#v not found", texts[0].Text)
+			}
+			idx.Name.LabelWidth = nameDims.Width
+			idx.Name.LabelHeight = nameDims.Height
+			maxNameWidth = go2.Max(maxNameWidth, nameDims.Width)
+
+			columnsDims := GetTextDimensions(mtexts, ruler, texts[1], fontFamily)
+			if columnsDims == nil {
+				return nil, fmt.Errorf("dimensions for sql_table index columns %#v not found", texts[1].Text)
+			}
+			idx.Columns.LabelWidth = columnsDims.Width
+			idx.Columns.LabelHeight = columnsDims.Height
+			maxTypeWidth = go2.Max(maxTypeWidth, columnsDims.Width)
+		}
+		if obj.SQLTable.HiddenColumns() > 0 {
+			moreDims := GetTextDimensions(mtexts, ruler, obj.SQLTable.MoreMText(colFontSize), fontFamily)
+			if moreDims == nil {
+				return nil, fmt.Errorf("dimensions for sql_table row %#v not found", obj.SQLTable.MoreText())
+			}
+			maxHeaderWidth = go2.Max(maxHeaderWidth, moreDims.Width)
+		}
+
 		// The rows get padded a little due to header font being larger than row font
-		dims.Height = go2.Max(12, labelDims.Height*(len(obj.SQLTable.Columns)+1))
+		dims.Height = go2.Max(12, labelDims.Height*(obj.SQLTable.Rows()+1))
 		headerWidth := d2target.HeaderPadding + labelDims.Width + d2target.HeaderPadding
 		rowsWidth := d2target.NamePadding + maxNameWidth + d2target.TypePadding + maxTypeWidth + d2target.TypePadding + maxConstraintWidth
 		if maxConstraintWidth != 0 {
 			rowsWidth += d2target.ConstraintPadding
 		}
+		rowsWidth = go2.Max(rowsWidth, d2target.NamePadding+maxHeaderWidth+d2target.NamePadding)
 		dims.Width = go2.Max(12, go2.Max(headerWidth, rowsWidth))
 	}
 
@@ -1050,7 +1384,7 @@ func (obj *Object) GetDefaultSize(mtexts []*d2target.MText, ruler *textmeasure.R
 func (obj *Object) SizeToContent(contentWidth, contentHeight, paddingX, paddingY float64) {
 	dslShape := strings.ToLower(obj.Shape.Value)
 	shapeType := d2target.DSL_SHAPE_TO_SHAPE_TYPE[dslShape]
-	s := shape.NewShape(shapeType, geo.NewBox(geo.NewPoint(0, 0), contentWidth, contentHeight))
+	s := obj.newShape(geo.NewBox(geo.NewPoint(0, 0), contentWidth, contentHeight))
 
 	var fitWidth, fitHeight float64
 	if shapeType == shape.PERSON_TYPE {
@@ -1129,6 +1463,9 @@ type Edge struct {
 
 	SrcTableColumnIndex *int `json:"srcTableColumnIndex,omitempty"`
 	DstTableColumnIndex *int `json:"dstTableColumnIndex,omitempty"`
+	// Class members are indexed with fields first, then methods, the order they're drawn in
+	SrcClassMemberIndex *int `json:"srcClassMemberIndex,omitempty"`
+	DstClassMemberIndex *int `json:"dstClassMemberIndex,omitempty"`
 
 	LabelPosition   *string  `json:"labelPosition,omitempty"`
 	LabelPercentage *float64 `json:"labelPercentage,omitempty"`
@@ -1193,7 +1530,7 @@ func (e *Edge) Text() *d2target.MText {
 	if e.Style.Bold != nil {
 		isBold, _ = strconv.ParseBool(e.Style.Bold.Value)
 	}
-	return &d2target.MText{
+	t := &d2target.MText{
 		Text:     e.Label.Value,
 		FontSize: fontSize,
 		IsBold:   isBold,
@@ -1201,6 +1538,20 @@ func (e *Edge) Text() *d2target.MText {
 
 		Dimensions: e.LabelDimensions,
 	}
+	if e.Language == "markdown" {
+		t.Shape = d2target.ShapeText
+		t.Language = e.Language
+	}
+	return t
+}
+
+// arrowheadText is the text of an arrowhead's label, which is never markdown
+func (e *Edge) arrowheadText(label string) *d2target.MText {
+	t := e.Text()
+	t.Text = label
+	t.Shape = ""
+	t.Language = ""
+	return t
 }
 
 func (e *Edge) Move(dx, dy float64) {
@@ -1258,11 +1609,49 @@ func (obj *Object) Connect(srcID, dstID []string, srcArrow, dstArrow bool, label
 	e.initIndex()
 
 	addSQLTableColumnIndices(e, srcID, dstID, obj, src, dst)
+	addClassMemberIndices(e, srcID, dstID, obj, src, dst)
 
 	obj.Graph.Edges = append(obj.Graph.Edges, e)
 	return e, nil
 }
 
+func addClassMemberIndices(e *Edge, srcID, dstID []string, obj, src, dst *Object) {
+	if src == dst {
+		// Ignore edge to member inside class.
+		return
+	}
+	if src.Shape.Value == d2target.ShapeClass && src.Class != nil {
+		if len(obj.AbsIDArray())+len(srcID) > len(src.AbsIDArray()) {
+			e.SrcClassMemberIndex = classMemberIndex(src.Class, srcID[len(srcID)-1])
+		}
+	}
+	if dst.Shape.Value == d2target.ShapeClass && dst.Class != nil {
+		if len(obj.AbsIDArray())+len(dstID) > len(dst.AbsIDArray()) {
+			e.DstClassMemberIndex = classMemberIndex(dst.Class, dstID[len(dstID)-1])
+		}
+	}
+}
+
+// classMemberIndex finds the row of the member with the given ID, which may include its visibility prefix
+func classMemberIndex(class *d2target.Class, id string) *int {
+	// IDs are formatted, so e.g. "close()" is still quoted
+	if kp, err := d2parser.ParseKey(id); err == nil && len(kp.Path) == 1 {
+		id = kp.Path[0].Unbox().ScalarString()
+	}
+	name := strings.TrimLeft(id, "+-#")
+	for i, f := range class.Fields {
+		if f.Shape == "" && f.Name == name {
+			return go2.Pointer(i)
+		}
+	}
+	for i, m := range class.Methods {
+		if m.Shape == "" && m.Name == name {
+			return go2.Pointer(len(class.Fields) + i)
+		}
+	}
+	return nil
+}
+
 func addSQLTableColumnIndices(e *Edge, srcID, dstID []string, obj, src, dst *Object) {
 	if src.Shape.Value == d2target.ShapeSQLTable {
 		if src == dst {
@@ -1273,7 +1662,7 @@ func addSQLTableColumnIndices(e *Edge, srcID, dstID []string, obj, src, dst *Obj
 		srcAbsID := src.AbsIDArray()
 		if len(objAbsID)+len(srcID) > len(srcAbsID) {
 			for i, d2col := range src.SQLTable.Columns {
-				if d2col.Name.Label == srcID[len(srcID)-1] {
+				if d2col.Shape == "" && d2col.Name.Label == srcID[len(srcID)-1] {
 					d2col.Reference = dst.AbsID()
 					e.SrcTableColumnIndex = new(int)
 					*e.SrcTableColumnIndex = i
@@ -1287,7 +1676,7 @@ func addSQLTableColumnIndices(e *Edge, srcID, dstID []string, obj, src, dst *Obj
 		dstAbsID := dst.AbsIDArray()
 		if len(objAbsID)+len(dstID) > len(dstAbsID) {
 			for i, d2col := range dst.SQLTable.Columns {
-				if d2col.Name.Label == dstID[len(dstID)-1] {
+				if d2col.Shape == "" && d2col.Name.Label == dstID[len(dstID)-1] {
 					d2col.Reference = dst.AbsID()
 					e.DstTableColumnIndex = new(int)
 					*e.DstTableColumnIndex = i
@@ -1301,7 +1690,11 @@ func addSQLTableColumnIndices(e *Edge, srcID, dstID []string, obj, src, dst *Obj
 // TODO: Treat undirectional/bidirectional edge here and in HasEdge flipped. Same with
 // SrcArrow.
 func (e *Edge) initIndex() {
-	for _, e2 := range e.Src.Graph.Edges {
+	g := e.Src.Graph
+	g.edgeIndex.Sync(g.Edges, func(e2 *Edge) edgeIndexKey {
+		return edgeIndexKey{e2.Src, e2.Dst}
+	})
+	for _, e2 := range g.edgeIndex.Get(edgeIndexKey{e.Src, e.Dst}) {
 		if e.Src == e2.Src &&
 			e.SrcArrow == e2.SrcArrow &&
 			e.Dst == e2.Dst &&
@@ -1311,6 +1704,12 @@ func (e *Edge) initIndex() {
 	}
 }
 
+// edgeIndexKey is what an edge connects. Edges are only reconnected after they're all
+// connected, by layouts and transforms, so the ones indexed keep their keys.
+type edgeIndexKey struct {
+	src, dst *Object
+}
+
 func findMeasured(mtexts []*d2target.MText, t1 *d2target.MText) *d2target.TextDimensions {
 	for i, t2 := range mtexts {
 		if t1.Text != t2.Text {
@@ -1333,13 +1732,13 @@ func findMeasured(mtexts []*d2target.MText, t1 *d2target.MText) *d2target.TextDi
 	return nil
 }
 
-func getMarkdownDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler, t *d2target.MText, fontFamily *d2fonts.FontFamily) (*d2target.TextDimensions, error) {
+func getMarkdownDimensions(mtexts []*d2target.MText, ruler textmeasure.TextMeasurer, t *d2target.MText, fontFamily *d2fonts.FontFamily) (*d2target.TextDimensions, error) {
 	if dims := findMeasured(mtexts, t); dims != nil {
 		return dims, nil
 	}
 
 	if ruler != nil {
-		width, height, err := textmeasure.MeasureMarkdown(t.Text, ruler, fontFamily, t.FontSize)
+		width, height, err := ruler.MeasureMarkdown(t.Text, fontFamily, t.FontSize)
 		if err != nil {
 			return nil, err
 		}
@@ -1353,7 +1752,8 @@ func getMarkdownDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler, t
 	return nil, fmt.Errorf("text not pre-measured and no ruler provided")
 }
 
-func GetTextDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler, t *d2target.MText, fontFamily *d2fonts.FontFamily) *d2target.TextDimensions {
+func GetTextDimensions(mtexts []*d2target.MText, ruler textmeasure.TextMeasurer, t *d2target.MText, fontFamily *d2fonts.FontFamily) *d2target.TextDimensions {
+	ruler = measurerOrNil(ruler)
 	if dims := findMeasured(mtexts, t); dims != nil {
 		return dims
 	}
@@ -1362,10 +1762,7 @@ func GetTextDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler, t *d2
 		var w int
 		var h int
 		if t.Language != "" {
-			originalLineHeight := ruler.LineHeightFactor
-			ruler.LineHeightFactor = textmeasure.CODE_LINE_HEIGHT
-			w, h = ruler.MeasureMono(d2fonts.SourceCodePro.Font(t.FontSize, d2fonts.FONT_STYLE_REGULAR), t.Text)
-			ruler.LineHeightFactor = originalLineHeight
+			w, h = ruler.MeasureCode(d2fonts.SourceCodePro.Font(t.FontSize, d2fonts.FONT_STYLE_REGULAR), t.Text)
 
 			// count empty leading and trailing lines since ruler will not be able to measure it
 			lines := strings.Split(t.Text, "\n")
@@ -1403,6 +1800,15 @@ func GetTextDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler, t *d2
 	return nil
 }
 
+// measurerOrNil returns nil for a nil *textmeasure.Ruler, which callers passed for "no
+// ruler" before measurers were an interface
+func measurerOrNil(ruler textmeasure.TextMeasurer) textmeasure.TextMeasurer {
+	if r, ok := ruler.(*textmeasure.Ruler); ok && r == nil {
+		return nil
+	}
+	return ruler
+}
+
 func appendTextDedup(texts []*d2target.MText, t *d2target.MText) []*d2target.MText {
 	if GetTextDimensions(texts, nil, t, nil) == nil {
 		return append(texts, t)
@@ -1410,9 +1816,10 @@ func appendTextDedup(texts []*d2target.MText, t *d2target.MText) []*d2target.MTe
 	return texts
 }
 
-func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler, fontFamily *d2fonts.FontFamily) error {
-	if ruler != nil && fontFamily != nil {
-		if ok := ruler.HasFontFamilyLoaded(fontFamily); !ok {
+func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler textmeasure.TextMeasurer, fontFamily *d2fonts.FontFamily) error {
+	ruler = measurerOrNil(ruler)
+	if r, ok := ruler.(*textmeasure.Ruler); ok && fontFamily != nil {
+		if ok := r.HasFontFamilyLoaded(fontFamily); !ok {
 			return fmt.Errorf("ruler does not have entire font family %s loaded, is a style missing?", *fontFamily)
 		}
 	}
@@ -1430,6 +1837,13 @@ func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler
 			scalar := *obj.Attributes.LabelPosition
 			position := LabelPositionsMapping[scalar.Value]
 			obj.LabelPosition = go2.Pointer(position.String())
+		} else if obj.HasLabel() && obj.Style.Header != nil && obj.IsContainer() {
+			// Headers hold the label, so children are laid out below it
+			if strings.EqualFold(obj.Style.Header.Value, "tab") {
+				obj.LabelPosition = go2.Pointer(label.InsideTopLeft.String())
+			} else {
+				obj.LabelPosition = go2.Pointer(label.InsideTopCenter.String())
+			}
 		}
 		if obj.Icon != nil && obj.Attributes.IconPosition != nil {
 			scalar := *obj.Attributes.IconPosition
@@ -1450,6 +1864,7 @@ func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler
 
 		if obj.Label.Value == "" &&
 			dslShape != d2target.ShapeImage &&
+			dslShape != d2target.ShapeBoard &&
 			dslShape != d2target.ShapeSQLTable &&
 			dslShape != d2target.ShapeClass {
 
@@ -1481,11 +1896,24 @@ func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler
 		}
 		obj.ApplyTextTransform()
 
+		if obj.Style.FontSize != nil && obj.Style.FontSize.Value == AUTO_FONT_SIZE {
+			err := obj.fitFontSize(mtexts, ruler, fontFamily, desiredWidth, desiredHeight)
+			if err != nil {
+				return err
+			}
+		} else {
+			obj.wrapLabel(ruler, fontFamily, desiredWidth)
+		}
+
 		labelDims, err := obj.GetLabelSize(mtexts, ruler, fontFamily)
 		if err != nil {
 			return err
 		}
 		obj.LabelDimensions = *labelDims
+		if obj.Style.Header != nil && obj.IsContainer() && obj.LabelPosition != nil && strings.HasPrefix(*obj.LabelPosition, "INSIDE_TOP") {
+			// Reserving the header's bottom padding keeps children clear of it
+			obj.LabelDimensions.Height += label.PADDING
+		}
 
 		// if there is a desired width or height, fit to content box without inner label padding for smallest minimum size
 		withInnerLabelPadding := desiredWidth == 0 && desiredHeight == 0 &&
@@ -1495,7 +1923,7 @@ func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler
 			return err
 		}
 
-		if dslShape == d2target.ShapeImage {
+		if dslShape == d2target.ShapeImage || dslShape == d2target.ShapeBoard {
 			if desiredWidth == 0 {
 				desiredWidth = defaultDims.Width
 			}
@@ -1504,13 +1932,13 @@ func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler
 			}
 			obj.Width = float64(go2.Max(MIN_SHAPE_SIZE, desiredWidth))
 			obj.Height = float64(go2.Max(MIN_SHAPE_SIZE, desiredHeight))
-			// images don't need further processing
+			// images and boards don't need further processing
 			continue
 		}
 
 		contentBox := geo.NewBox(geo.NewPoint(0, 0), float64(defaultDims.Width), float64(defaultDims.Height))
 		shapeType := d2target.DSL_SHAPE_TO_SHAPE_TYPE[dslShape]
-		s := shape.NewShape(shapeType, contentBox)
+		s := obj.newShape(contentBox)
 		paddingX, paddingY := s.GetDefaultPadding()
 		if desiredWidth != 0 {
 			paddingX = 0.
@@ -1557,15 +1985,11 @@ func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler
 		}
 
 		if edge.SrcArrowhead != nil && edge.SrcArrowhead.Label.Value != "" {
-			t := edge.Text()
-			t.Text = edge.SrcArrowhead.Label.Value
-			dims := GetTextDimensions(mtexts, ruler, t, usedFont)
+			dims := GetTextDimensions(mtexts, ruler, edge.arrowheadText(edge.SrcArrowhead.Label.Value), usedFont)
 			edge.SrcArrowhead.LabelDimensions = *dims
 		}
 		if edge.DstArrowhead != nil && edge.DstArrowhead.Label.Value != "" {
-			t := edge.Text()
-			t.Text = edge.DstArrowhead.Label.Value
-			dims := GetTextDimensions(mtexts, ruler, t, usedFont)
+			dims := GetTextDimensions(mtexts, ruler, edge.arrowheadText(edge.DstArrowhead.Label.Value), usedFont)
 			edge.DstArrowhead.LabelDimensions = *dims
 		}
 
@@ -1578,12 +2002,26 @@ func (g *Graph) SetDimensions(mtexts []*d2target.MText, ruler *textmeasure.Ruler
 		}
 		edge.ApplyTextTransform()
 
-		dims := GetTextDimensions(mtexts, ruler, edge.Text(), usedFont)
+		var dims *d2target.TextDimensions
+		if edge.Language == "markdown" {
+			var err error
+			dims, err = getMarkdownDimensions(mtexts, measurerOrNil(ruler), edge.Text(), usedFont)
+			if err != nil {
+				return err
+			}
+		} else {
+			dims = GetTextDimensions(mtexts, ruler, edge.Text(), usedFont)
+		}
 		if dims == nil {
 			return fmt.Errorf("dimensions for edge label %#v not found", edge.Text())
 		}
 
 		edge.LabelDimensions = *dims
+		// The label's space is shared with its icon
+		if edge.Icon != nil {
+			edge.LabelDimensions.Width += d2target.CONNECTION_ICON_SIZE + d2target.CONNECTION_ICON_GAP
+			edge.LabelDimensions.Height = go2.Max(edge.LabelDimensions.Height, d2target.CONNECTION_ICON_SIZE)
+		}
 	}
 	return nil
 }
@@ -1609,11 +2047,18 @@ func (g *Graph) Texts() []*d2target.MText {
 			if obj.Style.FontSize != nil {
 				fontSize, _ = strconv.Atoi(obj.Style.FontSize.Value)
 			}
+			if obj.Class.Stereotype != "" {
+				texts = appendTextDedup(texts, obj.Class.StereotypeText(fontSize))
+			}
 			for _, field := range obj.Class.Fields {
-				texts = appendTextDedup(texts, field.Text(fontSize))
+				if field.Shape != d2target.ShapeRowSeparator {
+					texts = appendTextDedup(texts, field.Text(fontSize))
+				}
 			}
 			for _, method := range obj.Class.Methods {
-				texts = appendTextDedup(texts, method.Text(fontSize))
+				if method.Shape != d2target.ShapeRowSeparator {
+					texts = appendTextDedup(texts, method.Text(fontSize))
+				}
 			}
 		} else if obj.SQLTable != nil {
 			colFontSize := d2fonts.FONT_SIZE_L
@@ -1621,10 +2066,21 @@ func (g *Graph) Texts() []*d2target.MText {
 				colFontSize, _ = strconv.Atoi(obj.Style.FontSize.Value)
 			}
 			for _, column := range obj.SQLTable.Columns {
+				if column.Shape == d2target.ShapeRowSeparator {
+					continue
+				}
 				for _, t := range column.Texts(colFontSize) {
 					texts = appendTextDedup(texts, t)
 				}
 			}
+			for _, idx := range obj.SQLTable.Indexes {
+				for _, t := range idx.Texts(colFontSize) {
+					texts = appendTextDedup(texts, t)
+				}
+			}
+			if obj.SQLTable.HiddenColumns() > 0 {
+				texts = appendTextDedup(texts, obj.SQLTable.MoreMText(colFontSize))
+			}
 		}
 	}
 	for _, edge := range g.Edges {
@@ -1637,14 +2093,10 @@ func (g *Graph) Texts() []*d2target.MText {
 			texts = appendTextDedup(texts, text)
 		}
 		if edge.SrcArrowhead != nil && edge.SrcArrowhead.Label.Value != "" {
-			t := edge.Text()
-			t.Text = edge.SrcArrowhead.Label.Value
-			texts = appendTextDedup(texts, t)
+			texts = appendTextDedup(texts, edge.arrowheadText(edge.SrcArrowhead.Label.Value))
 		}
 		if edge.DstArrowhead != nil && edge.DstArrowhead.Label.Value != "" {
-			t := edge.Text()
-			t.Text = edge.DstArrowhead.Label.Value
-			texts = appendTextDedup(texts, t)
+			texts = appendTextDedup(texts, edge.arrowheadText(edge.DstArrowhead.Label.Value))
 		}
 	}
 
@@ -1678,26 +2130,40 @@ var ReservedKeywords map[string]struct{}
 
 // Non Style/Holder keywords.
 var SimpleReservedKeywords = map[string]struct{}{
-	"label":          {},
-	"desc":           {},
-	"shape":          {},
-	"icon":           {},
-	"constraint":     {},
-	"tooltip":        {},
-	"link":           {},
-	"near":           {},
-	"width":          {},
-	"height":         {},
-	"direction":      {},
-	"top":            {},
-	"left":           {},
-	"grid-rows":      {},
-	"grid-columns":   {},
-	"grid-gap":       {},
-	"vertical-gap":   {},
-	"horizontal-gap": {},
-	"class":          {},
-	"vars":           {},
+	"label":            {},
+	"desc":             {},
+	"shape":            {},
+	"icon":             {},
+	"constraint":       {},
+	"tooltip":          {},
+	"link":             {},
+	"board":            {},
+	"assert":           {},
+	"near":             {},
+	"width":            {},
+	"height":           {},
+	"direction":        {},
+	"top":              {},
+	"left":             {},
+	"grid-rows":        {},
+	"grid-columns":     {},
+	"grid-gap":         {},
+	"vertical-gap":     {},
+	"horizontal-gap":   {},
+	"class":            {},
+	"vars":             {},
+	"hidden":           {},
+	"collapsed":        {},
+	"direction-mirror": {},
+	"straighten":       {},
+	"min-length":       {},
+	"max-rows":         {},
+	"stereotype":       {},
+	"group-by":         {},
+	"modifier":         {},
+	"shape-src":        {},
+	"source-label":     {},
+	"target-label":     {},
 }
 
 // ReservedKeywordHolders are reserved keywords that are meaningless on its own and must hold composites
@@ -1713,6 +2179,7 @@ var CompositeReservedKeywords = map[string]struct{}{
 	"constraint": {},
 	"label":      {},
 	"icon":       {},
+	"near":       {},
 }
 
 // StyleKeywords are reserved keywords which cannot exist outside of the "style" keyword
@@ -1733,15 +2200,28 @@ var StyleKeywords = map[string]struct{}{
 	"italic":         {},
 	"underline":      {},
 	"text-transform": {},
+	"text-align":     {},
+	"text-direction": {},
+	"latex-scale":    {},
 
 	// Only for shapes
 	"shadow":        {},
 	"multiple":      {},
 	"double-border": {},
+	"border-style":  {},
 
 	// Only for squares
 	"3d": {},
 
+	// Only for rectangular containers
+	"header": {},
+
+	// Only for shapes, or the root to apply to all of them
+	"bundle": {},
+
+	// Shapes and connections with the same layer group can be toggled together in SVGs
+	"layer-group": {},
+
 	// Only for edges
 	"animated": {},
 	"filled":   {},
@@ -1763,6 +2243,14 @@ var NearConstantsArray = []string{
 }
 var NearConstants map[string]struct{}
 
+// NearSidesArray are the values of `near.side`, for where a shape goes around the object it's near
+var NearSidesArray = []string{
+	"top",
+	"right",
+	"bottom",
+	"left",
+}
+
 // LabelPositionsArray are the values that labels and icons can set `near` to
 var LabelPositionsArray = []string{
 	"top-left",
@@ -1832,10 +2320,27 @@ var FillPatterns = []string{
 	"lines",
 	"grain",
 	"paper",
+	"hatch",
 }
 
 var textTransforms = []string{"none", "uppercase", "lowercase", "capitalize"}
 
+// HeaderStyles are how the labels of containers can be set apart from their children, as a
+// band across the top or as a tab in the top left corner
+var HeaderStyles = []string{"band", "tab"}
+
+// TextAligns are how the lines of labels are aligned with each other
+var TextAligns = []string{"left", "center", "right"}
+
+// TextDirections are which way labels read. Without one, it's detected from the first letter.
+var TextDirections = []string{"ltr", "rtl"}
+
+// layerGroupRegexp matches the names of layer groups, which are used in the IDs of SVG elements
+var layerGroupRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// BorderStyles are how the borders of shapes are drawn. Double is the same as double-border.
+var BorderStyles = []string{"solid", "dashed", "dotted", "double"}
+
 // BoardKeywords contains the keywords that create new boards.
 var BoardKeywords = map[string]struct{}{
 	"layers":    {},
@@ -1970,6 +2475,16 @@ func (obj *Object) Spacing() (margin, padding geo.Spacing) {
 	return obj.SpacingOpt(2*label.PADDING, 2*label.PADDING, true)
 }
 
+// OuterBox returns the box around obj and its margin, which holds its outside label and icon
+func (obj *Object) OuterBox() geo.Box {
+	margin, _ := obj.Spacing()
+	return geo.Box{
+		TopLeft: geo.NewPoint(obj.TopLeft.X-margin.Left, obj.TopLeft.Y-margin.Top),
+		Width:   obj.Width + margin.Left + margin.Right,
+		Height:  obj.Height + margin.Top + margin.Bottom,
+	}
+}
+
 func (obj *Object) SpacingOpt(labelPadding, iconPadding float64, maxIconSize bool) (margin, padding geo.Spacing) {
 	if obj.HasLabel() {
 		var position label.Position
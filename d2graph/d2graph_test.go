@@ -6,8 +6,11 @@ import (
 
 	"oss.terrastruct.com/util-go/assert"
 
+	"oss.terrastruct.com/d2/d2compiler"
 	"oss.terrastruct.com/d2/d2graph"
 	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/d2renderers/d2fonts"
+	"oss.terrastruct.com/d2/lib/textmeasure"
 )
 
 func TestKey(t *testing.T) {
@@ -48,3 +51,101 @@ func TestKey(t *testing.T) {
 		})
 	}
 }
+
+func TestAutoFontSize(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`fits: {
+  width: 300
+  style.font-size: auto
+}
+shrinks: a label much too long to fit in the shape {
+  width: 240
+  height: 60
+  style.font-size: auto
+}
+floor: an extremely long label that can never fit in such a tiny shape {
+  width: 40
+  style.font-size: auto
+}
+`), nil)
+	assert.Success(t, err)
+	ruler, err := textmeasure.NewRuler()
+	assert.Success(t, err)
+	err = g.SetDimensions(nil, ruler, nil)
+	assert.Success(t, err)
+
+	fits, shrinks, floor := g.Objects[0], g.Objects[1], g.Objects[2]
+	assert.String(t, "16", fits.Style.FontSize.Value)
+	assert.Equal(t, d2fonts.FONT_SIZE_M, fits.Text().FontSize)
+
+	if shrinks.Text().FontSize >= d2fonts.FONT_SIZE_M || shrinks.Text().FontSize <= d2graph.MIN_AUTO_FONT_SIZE {
+		t.Fatalf("expected a font size between the default and the floor, got %d", shrinks.Text().FontSize)
+	}
+	if shrinks.LabelDimensions.Width > 240 {
+		t.Fatalf("label is %d wide, wider than the shape", shrinks.LabelDimensions.Width)
+	}
+	assert.Equal(t, 240., shrinks.Width)
+
+	assert.Equal(t, d2graph.MIN_AUTO_FONT_SIZE, floor.Text().FontSize)
+}
+
+func TestAutoFontSizeWraps(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`cjk: 東京都の天気予報によると、明日は全国的に晴れて気温が上がる見込みです。 {
+  width: 160
+  style.font-size: auto
+}
+`), nil)
+	assert.Success(t, err)
+	ruler, err := textmeasure.NewRuler()
+	assert.Success(t, err)
+	err = g.SetDimensions(nil, ruler, nil)
+	assert.Success(t, err)
+
+	cjk := g.Objects[0]
+	assert.Equal(t, d2fonts.FONT_SIZE_M, cjk.Text().FontSize)
+	if !strings.Contains(cjk.Label.Value, "\n") {
+		t.Fatalf("expected the label to wrap, got %q", cjk.Label.Value)
+	}
+	if cjk.LabelDimensions.Width > 160 {
+		t.Fatalf("label is %d wide, wider than the shape", cjk.LabelDimensions.Width)
+	}
+	for _, line := range strings.Split(cjk.Label.Value, "\n") {
+		if strings.HasPrefix(line, "、") || strings.HasPrefix(line, "。") {
+			t.Fatalf("line starts with closing punctuation: %q", line)
+		}
+	}
+}
+
+func TestWrapLabel(t *testing.T) {
+	t.Parallel()
+
+	const text = "東京都の天気予報によると、明日は全国的に晴れて気温が上がる見込みです。"
+	g, _, err := d2compiler.Compile("", strings.NewReader(`inside: `+text+` {
+  width: 160
+}
+user: ユーザー {
+  shape: person
+  width: 130
+}
+`), nil)
+	assert.Success(t, err)
+	ruler, err := textmeasure.NewRuler()
+	assert.Success(t, err)
+	err = g.SetDimensions(nil, ruler, nil)
+	assert.Success(t, err)
+
+	inside, user := g.Objects[0], g.Objects[1]
+	assert.String(t, text, inside.Label.Value)
+	if !strings.Contains(inside.Text().Text, "\n") {
+		t.Fatalf("expected the label to wrap, got %q", inside.Text().Text)
+	}
+	if inside.LabelDimensions.Width > 160 {
+		t.Fatalf("label is %d wide, wider than the shape", inside.LabelDimensions.Width)
+	}
+
+	// Labels of people are below them
+	assert.String(t, "ユーザー", user.Text().Text)
+}
@@ -0,0 +1,382 @@
+package d2graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2format"
+)
+
+// GraphDiff is the difference between two graphs, as returned by Diff
+type GraphDiff struct {
+	// AddedObjects are objects of the new graph that the old graph doesn't have.
+	AddedObjects []*Object
+	// RemovedObjects are objects of the old graph that the new graph doesn't have.
+	RemovedObjects []*Object
+	// ModifiedObjects are objects in both graphs whose attributes changed.
+	ModifiedObjects []ObjectDiff
+	// RenamedObjects are objects whose IDs changed, along with any attributes that changed.
+	RenamedObjects []ObjectDiff
+
+	AddedEdges    []*Edge
+	RemovedEdges  []*Edge
+	ModifiedEdges []EdgeDiff
+}
+
+type ObjectDiff struct {
+	Old     *Object
+	New     *Object
+	Changes []AttributeChange
+}
+
+type EdgeDiff struct {
+	Old     *Edge
+	New     *Edge
+	Changes []AttributeChange
+}
+
+// AttributeChange is an attribute set to a different value, e.g. style.fill. Old or New is
+// empty when the attribute is only set on one side.
+type AttributeChange struct {
+	Attribute string
+	Old       string
+	New       string
+}
+
+func (d *GraphDiff) Empty() bool {
+	return len(d.AddedObjects) == 0 && len(d.RemovedObjects) == 0 && len(d.ModifiedObjects) == 0 &&
+		len(d.RenamedObjects) == 0 && len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 && len(d.ModifiedEdges) == 0
+}
+
+// diffAttributes are the attributes Diff compares, in the order changes are listed
+var diffAttributes = [][]string{
+	{"label"},
+	{"shape"},
+	{"icon"},
+	{"tooltip"},
+	{"link"},
+	{"near"},
+	{"width"},
+	{"height"},
+	{"top"},
+	{"left"},
+	{"straighten"},
+	{"min-length"},
+	{"max-rows"},
+	{"stereotype"},
+	{"group-by"},
+	{"modifier"},
+	{"shape-src"},
+	{"board"},
+	{"collapsed"},
+	{"direction"},
+	{"grid-rows"},
+	{"grid-columns"},
+	{"grid-gap"},
+	{"vertical-gap"},
+	{"horizontal-gap"},
+	{"class"},
+	{"label", "near"},
+	{"icon", "near"},
+	{"near", "side"},
+	{"near", "gap"},
+	{"style", "opacity"},
+	{"style", "stroke"},
+	{"style", "fill"},
+	{"style", "fill-pattern"},
+	{"style", "stroke-width"},
+	{"style", "stroke-dash"},
+	{"style", "border-radius"},
+	{"style", "shadow"},
+	{"style", "3d"},
+	{"style", "multiple"},
+	{"style", "double-border"},
+	{"style", "font"},
+	{"style", "font-size"},
+	{"style", "font-color"},
+	{"style", "bold"},
+	{"style", "italic"},
+	{"style", "underline"},
+	{"style", "text-transform"},
+	{"style", "text-align"},
+	{"style", "text-direction"},
+	{"style", "latex-scale"},
+	{"style", "header"},
+	{"style", "border-style"},
+	{"style", "bundle"},
+	{"style", "layer-group"},
+	{"style", "animated"},
+	{"style", "filled"},
+}
+
+// Diff compares the objects and edges of two boards. Objects are matched by their IDs within
+// matched parents, and edges by their matched endpoints and indexes. An object of the old graph
+// that isn't in the new one is renamed rather than removed when exactly one new object could
+// be it, see couldBeRenamed. Only the boards themselves are compared, not their layers, scenarios or steps.
+func Diff(old, new *Graph) *GraphDiff {
+	d := &GraphDiff{}
+
+	// Parents are matched before their children, so children of renamed containers still match
+	oldObjects := objectsByLevel(old)
+	newObjects := objectsByLevel(new)
+	oldToNew := map[*Object]*Object{old.Root: new.Root}
+	matched := make(map[*Object]struct{})
+	var unmatched []*Object
+	for _, obj := range oldObjects {
+		parent, ok := oldToNew[obj.Parent]
+		if !ok {
+			unmatched = append(unmatched, obj)
+			continue
+		}
+		newObj, ok := parent.Children[strings.ToLower(obj.ID)]
+		if !ok {
+			unmatched = append(unmatched, obj)
+			continue
+		}
+		oldToNew[obj] = newObj
+		matched[newObj] = struct{}{}
+	}
+
+	renamed := make(map[*Object]struct{})
+	candidates := make(map[*Object][]*Object)
+	candidateOf := make(map[*Object]int)
+	for _, obj := range unmatched {
+		parent, ok := oldToNew[obj.Parent]
+		if !ok {
+			continue
+		}
+		for _, newObj := range parent.ChildrenArray {
+			if _, ok := matched[newObj]; ok || !couldBeRenamed(obj, newObj, oldToNew) {
+				continue
+			}
+			candidates[obj] = append(candidates[obj], newObj)
+			candidateOf[newObj]++
+		}
+	}
+	for _, obj := range unmatched {
+		if len(candidates[obj]) != 1 || candidateOf[candidates[obj][0]] != 1 {
+			continue
+		}
+		newObj := candidates[obj][0]
+		oldToNew[obj] = newObj
+		matched[newObj] = struct{}{}
+		renamed[obj] = struct{}{}
+		d.RenamedObjects = append(d.RenamedObjects, ObjectDiff{
+			Old:     obj,
+			New:     newObj,
+			Changes: diffAttributeValues(&obj.Attributes, &newObj.Attributes, ""),
+		})
+		matchDescendants(obj, newObj, oldToNew, matched)
+	}
+
+	newToOld := make(map[*Object]*Object, len(oldToNew))
+	for o, n := range oldToNew {
+		newToOld[n] = o
+	}
+	for _, obj := range newObjects {
+		oldObj, ok := newToOld[obj]
+		if !ok {
+			d.AddedObjects = append(d.AddedObjects, obj)
+			continue
+		}
+		if _, ok := renamed[oldObj]; ok {
+			continue
+		}
+		changes := diffAttributeValues(&oldObj.Attributes, &obj.Attributes, "")
+		if len(changes) > 0 {
+			d.ModifiedObjects = append(d.ModifiedObjects, ObjectDiff{Old: oldObj, New: obj, Changes: changes})
+		}
+	}
+	for _, obj := range oldObjects {
+		if _, ok := oldToNew[obj]; !ok {
+			d.RemovedObjects = append(d.RemovedObjects, obj)
+		}
+	}
+
+	// Edges are keyed by the new objects their endpoints match
+	edgeKey := func(src, dst *Object, e *Edge) diffEdgeKey {
+		return diffEdgeKey{src: src, dst: dst, arrow: e.ArrowString(), index: e.Index}
+	}
+	oldEdges := make(map[diffEdgeKey]*Edge, len(old.Edges))
+	for _, e := range old.Edges {
+		src, srcOK := oldToNew[e.Src]
+		dst, dstOK := oldToNew[e.Dst]
+		if srcOK && dstOK {
+			oldEdges[edgeKey(src, dst, e)] = e
+		}
+	}
+	newEdges := make(map[diffEdgeKey]*Edge, len(new.Edges))
+	for _, e := range new.Edges {
+		key := edgeKey(e.Src, e.Dst, e)
+		newEdges[key] = e
+		oldEdge, ok := oldEdges[key]
+		if !ok {
+			d.AddedEdges = append(d.AddedEdges, e)
+			continue
+		}
+		changes := diffAttributeValues(&oldEdge.Attributes, &e.Attributes, "")
+		changes = append(changes, diffArrowhead(oldEdge.SrcArrowhead, e.SrcArrowhead, "source-arrowhead.")...)
+		changes = append(changes, diffArrowhead(oldEdge.DstArrowhead, e.DstArrowhead, "target-arrowhead.")...)
+		if len(changes) > 0 {
+			d.ModifiedEdges = append(d.ModifiedEdges, EdgeDiff{Old: oldEdge, New: e, Changes: changes})
+		}
+	}
+	for _, e := range old.Edges {
+		src, srcOK := oldToNew[e.Src]
+		dst, dstOK := oldToNew[e.Dst]
+		if !srcOK || !dstOK {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+			continue
+		}
+		if _, ok := newEdges[edgeKey(src, dst, e)]; !ok {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+
+	return d
+}
+
+type diffEdgeKey struct {
+	src, dst *Object
+	arrow    string
+	index    int
+}
+
+// objectsByLevel returns the objects of g with parents before their children, otherwise in
+// the order they were declared
+func objectsByLevel(g *Graph) []*Object {
+	objects := append([]*Object(nil), g.Objects...)
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].Level() < objects[j].Level()
+	})
+	return objects
+}
+
+// couldBeRenamed reports whether new could be old under another ID: nothing but its label
+// changed, and either it has the same children or it's connected to one of the same objects
+func couldBeRenamed(old, new *Object, oldToNew map[*Object]*Object) bool {
+	for _, c := range diffAttributeValues(&old.Attributes, &new.Attributes, "") {
+		if c.Attribute != "label" {
+			return false
+		}
+	}
+	if len(old.ChildrenArray) != len(new.ChildrenArray) {
+		return false
+	}
+	if len(old.ChildrenArray) > 0 {
+		sameChildren := true
+		for id := range old.Children {
+			if _, ok := new.Children[id]; !ok {
+				sameChildren = false
+			}
+		}
+		if sameChildren {
+			return true
+		}
+	}
+	oldNeighbors := neighbors(old)
+	newNeighbors := neighbors(new)
+	for n := range oldNeighbors {
+		if _, ok := newNeighbors[oldToNew[n]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func neighbors(obj *Object) map[*Object]struct{} {
+	neighbors := make(map[*Object]struct{})
+	for _, e := range obj.Graph.Edges {
+		if e.Src == obj && e.Dst != obj {
+			neighbors[e.Dst] = struct{}{}
+		} else if e.Dst == obj && e.Src != obj {
+			neighbors[e.Src] = struct{}{}
+		}
+	}
+	return neighbors
+}
+
+// matchDescendants matches the descendants of renamed containers that kept their IDs
+func matchDescendants(old, new *Object, oldToNew map[*Object]*Object, matched map[*Object]struct{}) {
+	for _, child := range old.ChildrenArray {
+		newChild, ok := new.Children[strings.ToLower(child.ID)]
+		if !ok {
+			continue
+		}
+		if _, ok := matched[newChild]; ok {
+			continue
+		}
+		oldToNew[child] = newChild
+		matched[newChild] = struct{}{}
+		matchDescendants(child, newChild, oldToNew, matched)
+	}
+}
+
+// ObjectKey returns the key referring to obj from the root, like Object.AbsID but quoted as
+// needed to be valid D2
+func ObjectKey(obj *Object) string {
+	return formatKeyPath(idVals(obj))
+}
+
+// EdgeKey returns the key referring to e from the root, like Edge.AbsID but quoted as needed
+// to be valid D2
+func EdgeKey(e *Edge) string {
+	src, dst := idVals(e.Src), idVals(e.Dst)
+	var common []string
+	for len(src) > 1 && len(dst) > 1 && strings.EqualFold(src[0], dst[0]) {
+		common = append(common, src[0])
+		src = src[1:]
+		dst = dst[1:]
+	}
+	key := fmt.Sprintf("(%s %s %s)[%d]", formatKeyPath(src), e.ArrowString(), formatKeyPath(dst), e.Index)
+	if len(common) > 0 {
+		key = formatKeyPath(common) + "." + key
+	}
+	return key
+}
+
+func formatKeyPath(ids []string) string {
+	return d2format.Format(d2ast.MakeKeyPath(ids))
+}
+
+func diffArrowhead(old, new *Attributes, prefix string) []AttributeChange {
+	oldUnset, newUnset := old == nil, new == nil
+	if oldUnset {
+		old = &Attributes{}
+	}
+	if newUnset {
+		new = &Attributes{}
+	}
+	changes := diffAttributeValues(old, new, prefix)
+	// An arrowhead that isn't set has no shape rather than the default shape of objects
+	for i, c := range changes {
+		if c.Attribute != prefix+"shape" {
+			continue
+		}
+		if oldUnset {
+			changes[i].Old = ""
+		}
+		if newUnset {
+			changes[i].New = ""
+		}
+	}
+	return changes
+}
+
+func diffAttributeValues(old, new *Attributes, prefix string) []AttributeChange {
+	var changes []AttributeChange
+	for _, attr := range diffAttributes {
+		oldValue, _ := attributeValue(old, attr)
+		newValue, _ := attributeValue(new, attr)
+		if oldValue != newValue {
+			changes = append(changes, AttributeChange{
+				Attribute: prefix + strings.Join(attr, "."),
+				Old:       oldValue,
+				New:       newValue,
+			})
+		}
+	}
+	return changes
+}
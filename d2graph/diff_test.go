@@ -0,0 +1,99 @@
+package d2graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	old, _, err := d2compiler.Compile("", strings.NewReader(`a -> b: {
+  source-arrowhead.shape: diamond
+}
+b -> c
+c: {shape: circle}
+d.style.fill: red
+`), nil)
+	assert.Nil(t, err)
+	new, _, err := d2compiler.Compile("", strings.NewReader(`a -> b
+b -> e
+c: {shape: circle}
+d.style.fill: blue
+d.label: D
+`), nil)
+	assert.Nil(t, err)
+
+	d := d2graph.Diff(old, new)
+	assert.False(t, d.Empty())
+
+	var added, removed []string
+	for _, obj := range d.AddedObjects {
+		added = append(added, obj.AbsID())
+	}
+	for _, e := range d.AddedEdges {
+		added = append(added, e.AbsID())
+	}
+	for _, obj := range d.RemovedObjects {
+		removed = append(removed, obj.AbsID())
+	}
+	for _, e := range d.RemovedEdges {
+		removed = append(removed, e.AbsID())
+	}
+	assert.Equal(t, []string{"e", "(b -> e)[0]"}, added)
+	assert.Equal(t, []string{"(b -> c)[0]"}, removed)
+
+	assert.Len(t, d.ModifiedObjects, 1)
+	assert.Equal(t, "d", d.ModifiedObjects[0].New.AbsID())
+	assert.Equal(t, []d2graph.AttributeChange{
+		{Attribute: "label", Old: "d", New: "D"},
+		{Attribute: "style.fill", Old: "red", New: "blue"},
+	}, d.ModifiedObjects[0].Changes)
+
+	assert.Len(t, d.ModifiedEdges, 1)
+	assert.Equal(t, []d2graph.AttributeChange{
+		{Attribute: "source-arrowhead.shape", Old: "diamond", New: ""},
+	}, d.ModifiedEdges[0].Changes)
+
+	assert.True(t, d2graph.Diff(new, new).Empty())
+}
+
+func TestDiffRenamed(t *testing.T) {
+	t.Parallel()
+
+	old, _, err := d2compiler.Compile("", strings.NewReader(`x: {
+  y -> z
+}
+x.y -> a
+b
+`), nil)
+	assert.Nil(t, err)
+	new, _, err := d2compiler.Compile("", strings.NewReader(`w: Workers {
+  y -> z
+}
+w.y -> a
+c
+`), nil)
+	assert.Nil(t, err)
+
+	d := d2graph.Diff(old, new)
+	assert.Len(t, d.RenamedObjects, 1)
+	assert.Equal(t, "x", d.RenamedObjects[0].Old.AbsID())
+	assert.Equal(t, "w", d.RenamedObjects[0].New.AbsID())
+	assert.Equal(t, []d2graph.AttributeChange{
+		{Attribute: "label", Old: "x", New: "Workers"},
+	}, d.RenamedObjects[0].Changes)
+
+	// Children of the renamed container and their connections still match, while unconnected
+	// objects aren't assumed to be renamed
+	assert.Len(t, d.AddedEdges, 0)
+	assert.Len(t, d.RemovedEdges, 0)
+	assert.Len(t, d.ModifiedObjects, 0)
+	assert.Len(t, d.AddedObjects, 1)
+	assert.Len(t, d.RemovedObjects, 1)
+}
@@ -0,0 +1,56 @@
+package d2graph
+
+// IsHidden reports whether hidden: true was set
+func (a *Attributes) IsHidden() bool {
+	return a.Hidden != nil && a.Hidden.Value == "true"
+}
+
+// IsCollapsed reports whether collapsed: true was set
+func (a *Attributes) IsCollapsed() bool {
+	return a.Collapsed != nil && a.Collapsed.Value == "true"
+}
+
+// RemoveHidden removes objects and connections with hidden: true, along with descendants of
+// hidden objects and connections to any of them.
+// It's meant to be called before layout so that, unlike opacity 0, hidden objects take up no space.
+func (g *Graph) RemoveHidden() {
+	isHidden := func(obj *Object) bool {
+		for ; obj != nil; obj = obj.Parent {
+			if obj.IsHidden() {
+				return true
+			}
+		}
+		return false
+	}
+
+	edges := g.Edges[:0]
+	for _, e := range g.Edges {
+		if e.IsHidden() || isHidden(e.Src) || isHidden(e.Dst) {
+			continue
+		}
+		edges = append(edges, e)
+	}
+	g.Edges = edges
+
+	objects := g.Objects[:0]
+	for _, obj := range g.Objects {
+		if isHidden(obj) {
+			if obj.IsHidden() && !isHidden(obj.Parent) {
+				obj.Parent.RemoveChild(obj)
+			}
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	g.Objects = objects
+
+	// Objects can't be near something that no longer exists
+	for _, obj := range g.Objects {
+		if obj.NearKey == nil || obj.IsConstantNear() {
+			continue
+		}
+		if _, ok := g.Root.HasChild(Key(obj.NearKey)); !ok {
+			obj.NearKey = nil
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package d2graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+)
+
+func TestRemoveHidden(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`a.b -> c
+a.d -> c
+c -> e: {hidden: true}
+a.b.hidden: true
+f.hidden: false
+g.near: a.b
+`), nil)
+	assert.Nil(t, err)
+	g.RemoveHidden()
+
+	ids := make([]string, 0, len(g.Objects))
+	for _, obj := range g.Objects {
+		ids = append(ids, obj.AbsID())
+	}
+	assert.Equal(t, []string{"a", "c", "a.d", "e", "f", "g"}, ids)
+
+	a := g.Root.ChildrenArray[0]
+	assert.Equal(t, 1, len(a.ChildrenArray))
+	assert.NotContains(t, a.Children, "b")
+
+	assert.Equal(t, 1, len(g.Edges))
+	assert.Equal(t, "(a.d -> c)[0]", g.Edges[0].AbsID())
+
+	assert.Nil(t, g.Objects[5].NearKey)
+}
+
+func TestRemoveHiddenBoolForms(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`a.hidden: 1
+b.hidden: TRUE
+c.hidden: F
+d
+x: {
+  collapsed: T
+  y
+}
+`), nil)
+	assert.Nil(t, err)
+	assert.True(t, g.Objects[0].IsHidden())
+	assert.True(t, g.Objects[1].IsHidden())
+	assert.False(t, g.Objects[2].IsHidden())
+	assert.True(t, g.Objects[4].IsCollapsed())
+	g.RemoveHidden()
+
+	ids := make([]string, 0, len(g.Objects))
+	for _, obj := range g.Objects {
+		ids = append(ids, obj.AbsID())
+	}
+	assert.Equal(t, []string{"c", "d", "x", "x.y"}, ids)
+}
@@ -364,13 +364,22 @@ func (obj *Object) ToShape() shape.Shape {
 	dslShape := strings.ToLower(obj.Shape.Value)
 	shapeType := d2target.DSL_SHAPE_TO_SHAPE_TYPE[dslShape]
 	contentBox := geo.NewBox(tl, obj.Width, obj.Height)
-	s := shape.NewShape(shapeType, contentBox)
+	s := obj.newShape(contentBox)
 	if shapeType == shape.CLOUD_TYPE && obj.ContentAspectRatio != nil {
 		s.SetInnerBoxAspectRatio(*obj.ContentAspectRatio)
 	}
 	return s
 }
 
+// newShape returns the shape of obj in box, drawn from its definition if it's a custom shape
+func (obj *Object) newShape(box *geo.Box) shape.Shape {
+	s := shape.NewShape(d2target.DSL_SHAPE_TO_SHAPE_TYPE[strings.ToLower(obj.Shape.Value)], box)
+	if obj.CustomShape != nil {
+		s.SetCustomDefinition(obj.CustomShape)
+	}
+	return s
+}
+
 func (obj *Object) GetLabelTopLeft() *geo.Point {
 	if obj.LabelPosition == nil {
 		return nil
@@ -411,6 +420,41 @@ func (obj *Object) GetIconTopLeft() *geo.Point {
 	return iconPosition.GetPointOnBox(box, label.PADDING, d2target.MAX_ICON_SIZE, d2target.MAX_ICON_SIZE)
 }
 
+// SrcRowIndex is the index of the sql_table column or class member the edge starts at, if any
+func (edge *Edge) SrcRowIndex() *int {
+	if edge.SrcTableColumnIndex != nil {
+		return edge.SrcTableColumnIndex
+	}
+	return edge.SrcClassMemberIndex
+}
+
+// DstRowIndex is the index of the sql_table column or class member the edge ends at, if any
+func (edge *Edge) DstRowIndex() *int {
+	if edge.DstTableColumnIndex != nil {
+		return edge.DstTableColumnIndex
+	}
+	return edge.DstClassMemberIndex
+}
+
+// GetRowBox returns the box of the sql_table column or class member at index, laid out the
+// way the renderer draws them, or nil if obj has no rows.
+func (obj *Object) GetRowBox(index int) *geo.Box {
+	var rowHeight, top float64
+	switch {
+	case obj.SQLTable != nil:
+		// the header takes up one row
+		rowHeight = obj.Height / float64(obj.SQLTable.Rows()+1)
+		top = obj.TopLeft.Y + rowHeight*float64(obj.SQLTable.RowIndex(index)+1)
+	case obj.Class != nil:
+		// the header takes up two rows
+		rowHeight = obj.Height / float64(len(obj.Class.Fields)+len(obj.Class.Methods)+2)
+		top = obj.TopLeft.Y + rowHeight*float64(index+2)
+	default:
+		return nil
+	}
+	return geo.NewBox(geo.NewPoint(obj.TopLeft.X, top), obj.Width, rowHeight)
+}
+
 func (edge *Edge) TraceToShape(points []*geo.Point, startIndex, endIndex int) (newStart, newEnd int) {
 	srcShape := edge.Src.ToShape()
 	dstShape := edge.Dst.ToShape()
@@ -0,0 +1,87 @@
+package d2graph_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/log"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+)
+
+const rowsScript = `users: {
+  shape: sql_table
+  id: int
+  name: string
+  email: string
+}
+Account: {
+  shape: class
+  +id: int
+  -owner: string
+  "close()": bool
+}
+users.email -> Account."close()"
+Account."-owner" -> users.id
+users -> Account
+`
+
+func TestRowIndices(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(rowsScript), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(g.Edges))
+
+	assert.Equal(t, 2, *g.Edges[0].SrcRowIndex())
+	assert.Equal(t, 2, *g.Edges[0].DstRowIndex())
+	assert.Equal(t, 2, *g.Edges[0].DstClassMemberIndex)
+	assert.Equal(t, 1, *g.Edges[1].SrcClassMemberIndex)
+	assert.Equal(t, 0, *g.Edges[1].DstTableColumnIndex)
+	assert.Nil(t, g.Edges[2].SrcRowIndex())
+	assert.Nil(t, g.Edges[2].DstRowIndex())
+
+	users, account := g.Edges[0].Src, g.Edges[0].Dst
+	users.Box = geo.NewBox(geo.NewPoint(0, 0), 100, 200)
+	account.Box = geo.NewBox(geo.NewPoint(0, 0), 100, 250)
+	assert.Equal(t, geo.NewBox(geo.NewPoint(0, 150), 100, 50), users.GetRowBox(2))
+	assert.Equal(t, geo.NewBox(geo.NewPoint(0, 200), 100, 50), account.GetRowBox(2))
+	assert.Nil(t, g.Root.GetRowBox(0))
+}
+
+func TestDagreRowEndpoints(t *testing.T) {
+	t.Parallel()
+
+	ruler, err := textmeasure.NewRuler()
+	assert.Nil(t, err)
+	ctx := log.WithTB(context.Background(), t, nil)
+	_, g, err := d2lib.Compile(ctx, rowsScript, &d2lib.CompileOptions{
+		Ruler: ruler,
+		LayoutResolver: func(engine string) (d2graph.LayoutGraph, error) {
+			return d2dagrelayout.DefaultLayout, nil
+		},
+	}, nil)
+	assert.Nil(t, err)
+
+	for _, e := range g.Edges[:2] {
+		start, end := e.Route[0], e.Route[len(e.Route)-1]
+		srcRow := e.Src.GetRowBox(*e.SrcRowIndex())
+		dstRow := e.Dst.GetRowBox(*e.DstRowIndex())
+		assert.InDelta(t, srcRow.Center().Y, start.Y, 0.01, e.AbsID())
+		assert.InDelta(t, dstRow.Center().Y, end.Y, 0.01, e.AbsID())
+		assert.True(t, onSide(e.Src, start), e.AbsID())
+		assert.True(t, onSide(e.Dst, end), e.AbsID())
+	}
+}
+
+func onSide(obj *d2graph.Object, p *geo.Point) bool {
+	return math.Abs(p.X-obj.TopLeft.X) < 1 || math.Abs(p.X-(obj.TopLeft.X+obj.Width)) < 1
+}
@@ -0,0 +1,81 @@
+package d2graph
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// Medium is where a diagram is shown, which sets the defaults of its texts and strokes so one
+// script reads well on each without restyling it
+type Medium struct {
+	Name string
+	// FontScale scales the default font sizes of labels
+	FontScale float64
+	// StrokeWidth is the default stroke width of shapes and connections
+	StrokeWidth int
+	// Pad is the default padding around the rendered diagram, in pixels
+	Pad int64
+}
+
+const (
+	MediumScreen = "screen"
+	MediumPrint  = "print"
+	MediumSlide  = "slide"
+)
+
+// Mediums are the mediums diagrams can be exported for. Screen keeps D2's defaults, print thins
+// strokes and margins for paper, and slide enlarges texts and strokes to be read from afar.
+var Mediums = []Medium{
+	{Name: MediumScreen, FontScale: 1, StrokeWidth: 2, Pad: 100},
+	{Name: MediumPrint, FontScale: 1, StrokeWidth: 1, Pad: 40},
+	{Name: MediumSlide, FontScale: 1.5, StrokeWidth: 3, Pad: 60},
+}
+
+// FindMedium returns the medium named name
+func FindMedium(name string) (Medium, error) {
+	var names []string
+	for _, m := range Mediums {
+		if m.Name == name {
+			return m, nil
+		}
+		names = append(names, m.Name)
+	}
+	return Medium{}, fmt.Errorf("unknown medium %#v, expected one of (%s)", name, strings.Join(names, ", "))
+}
+
+// ApplyMedium sets the font sizes and stroke widths of objects and connections without their own
+// to the defaults of m. It's meant to be called after the theme is applied and before layout, so
+// the texts are measured at their sizes.
+func (g *Graph) ApplyMedium(m Medium) {
+	scaled := func(fontSize int) *Scalar {
+		return &Scalar{Value: strconv.Itoa(int(math.Round(float64(fontSize) * m.FontScale)))}
+	}
+	stroke := &Scalar{Value: strconv.Itoa(m.StrokeWidth)}
+
+	for _, obj := range g.Objects {
+		if m.FontScale != 1 && obj.Style.FontSize == nil {
+			fontSize := obj.Text().FontSize
+			if obj.Class != nil || obj.SQLTable != nil {
+				fontSize -= d2target.HeaderFontAdd
+			}
+			obj.Style.FontSize = scaled(fontSize)
+		}
+		// Sequence diagrams and their groups are drawn without borders
+		if m.StrokeWidth != d2target.BaseShape().StrokeWidth && obj.Style.StrokeWidth == nil &&
+			!obj.IsSequenceDiagram() && !obj.IsSequenceDiagramGroup() {
+			obj.Style.StrokeWidth = stroke
+		}
+	}
+	for _, e := range g.Edges {
+		if m.FontScale != 1 && e.Style.FontSize == nil {
+			e.Style.FontSize = scaled(e.Text().FontSize)
+		}
+		if m.StrokeWidth != d2target.BaseConnection().StrokeWidth && e.Style.StrokeWidth == nil {
+			e.Style.StrokeWidth = stroke
+		}
+	}
+}
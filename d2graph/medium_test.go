@@ -0,0 +1,48 @@
+package d2graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+func TestApplyMedium(t *testing.T) {
+	t.Parallel()
+
+	slide, err := d2graph.FindMedium(d2graph.MediumSlide)
+	assert.Nil(t, err)
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`a: {b}
+c.style.font-size: 10
+c.style.stroke-width: 5
+a.b -> c
+`), nil)
+	assert.Nil(t, err)
+	g.ApplyMedium(slide)
+
+	a, b, c := g.Objects[0], g.Objects[1], g.Objects[2]
+	// Containers are labeled bigger than the shapes in them
+	assert.Equal(t, "42", a.Style.FontSize.Value)
+	assert.Equal(t, "24", b.Style.FontSize.Value)
+	assert.Equal(t, "3", b.Style.StrokeWidth.Value)
+	assert.Equal(t, "10", c.Style.FontSize.Value)
+	assert.Equal(t, "5", c.Style.StrokeWidth.Value)
+	assert.Equal(t, "24", g.Edges[0].Style.FontSize.Value)
+	assert.Equal(t, "3", g.Edges[0].Style.StrokeWidth.Value)
+
+	screen, err := d2graph.FindMedium(d2graph.MediumScreen)
+	assert.Nil(t, err)
+	g, _, err = d2compiler.Compile("", strings.NewReader(`a -> b`), nil)
+	assert.Nil(t, err)
+	g.ApplyMedium(screen)
+	assert.Nil(t, g.Objects[0].Style.FontSize)
+	assert.Nil(t, g.Objects[0].Style.StrokeWidth)
+	assert.Nil(t, g.Edges[0].Style.StrokeWidth)
+
+	_, err = d2graph.FindMedium("billboard")
+	assert.EqualError(t, err, `unknown medium "billboard", expected one of (screen, print, slide)`)
+}
@@ -0,0 +1,63 @@
+package d2graph
+
+import (
+	"math"
+
+	"oss.terrastruct.com/d2/lib/label"
+)
+
+// IsDirectionMirrored reports whether direction-mirror: true was set on the board
+func (g *Graph) IsDirectionMirrored() bool {
+	return g.Root.DirectionMirror != nil && g.Root.DirectionMirror.Value == "true"
+}
+
+// MirrorDirection flips the laid out graph horizontally in place, for diagrams that read
+// right-to-left. Positions, connection routes, and the sides labels and icons are placed on
+// are mirrored, but text and the outlines of asymmetric shapes are not.
+// It's meant to be called after layout, so it works the same with every layout engine and
+// direction.
+func (g *Graph) MirrorDirection() {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	for _, obj := range g.Objects {
+		if obj.Box == nil || obj.TopLeft == nil {
+			continue
+		}
+		minX = math.Min(minX, obj.TopLeft.X)
+		maxX = math.Max(maxX, obj.TopLeft.X+obj.Width)
+	}
+	for _, e := range g.Edges {
+		for _, p := range e.Route {
+			minX = math.Min(minX, p.X)
+			maxX = math.Max(maxX, p.X)
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return
+	}
+	mirror := func(x float64) float64 {
+		return minX + maxX - x
+	}
+
+	for _, obj := range g.Objects {
+		if obj.Box == nil || obj.TopLeft == nil {
+			continue
+		}
+		obj.TopLeft.X = mirror(obj.TopLeft.X + obj.Width)
+		obj.LabelPosition = mirrorPosition(obj.LabelPosition)
+		obj.IconPosition = mirrorPosition(obj.IconPosition)
+	}
+	for _, e := range g.Edges {
+		for _, p := range e.Route {
+			p.X = mirror(p.X)
+		}
+		e.LabelPosition = mirrorPosition(e.LabelPosition)
+	}
+}
+
+func mirrorPosition(position *string) *string {
+	if position == nil {
+		return nil
+	}
+	mirrored := label.FromString(*position).HorizontallyMirrored().String()
+	return &mirrored
+}
@@ -0,0 +1,51 @@
+package d2graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/label"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+func TestMirrorDirection(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`direction-mirror: true
+a -> b
+`), nil)
+	assert.Nil(t, err)
+	assert.True(t, g.IsDirectionMirrored())
+
+	a, b := g.Objects[0], g.Objects[1]
+	a.Box = geo.NewBox(geo.NewPoint(0, 0), 100, 50)
+	a.LabelPosition = go2.Pointer(label.OutsideTopLeft.String())
+	b.Box = geo.NewBox(geo.NewPoint(200, 0), 50, 50)
+	b.IconPosition = go2.Pointer(label.InsideMiddleRight.String())
+	g.Edges[0].Route = []*geo.Point{geo.NewPoint(100, 25), geo.NewPoint(200, 25)}
+	g.Edges[0].LabelPosition = go2.Pointer(label.InsideMiddleCenter.String())
+
+	g.MirrorDirection()
+
+	assert.Equal(t, 150., a.TopLeft.X)
+	assert.Equal(t, 0., b.TopLeft.X)
+	assert.Equal(t, label.OutsideTopRight.String(), *a.LabelPosition)
+	assert.Equal(t, label.InsideMiddleLeft.String(), *b.IconPosition)
+	assert.Equal(t, 150., g.Edges[0].Route[0].X)
+	assert.Equal(t, 50., g.Edges[0].Route[1].X)
+	assert.Equal(t, label.InsideMiddleCenter.String(), *g.Edges[0].LabelPosition)
+}
+
+func TestMirrorDirectionBoolForms(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`direction-mirror: 1
+a -> b
+`), nil)
+	assert.Nil(t, err)
+	assert.True(t, g.IsDirectionMirrored())
+}
@@ -0,0 +1,408 @@
+package d2graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// Query returns the objects or the edges of the board that pattern selects, in the order
+// they're declared.
+//
+// Patterns are keys as written in D2 with the same globs: * matches any characters within an
+// ID and ** matches objects at any depth, e.g. a.* or **.db. Edges are selected with edge
+// keys, e.g. a.* -> b.* or (x -> *)[0], and match edges going either way with the same
+// arrowheads, so b <- a matches a -> b. Indexes are those edges are declared with. A key can end with an attribute to only select what has it set, e.g.
+// **.tooltip, or with an attribute and a value after =, e.g. **.shape=sql_table or
+// (* -> *)[*].style.stroke=red. Values can use * too.
+func (g *Graph) Query(pattern string) ([]*Object, []*Edge, error) {
+	keyPattern, value, hasValue := splitQueryValue(pattern)
+	mk, err := parseQueryKey(keyPattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid query %q: %w", pattern, err)
+	}
+	return g.queryKey(pattern, mk, value, hasValue)
+}
+
+func parseQueryKey(keyPattern string) (*d2ast.Key, error) {
+	mk, err := d2parser.ParseMapKey(keyPattern)
+	if err != nil {
+		return nil, err
+	}
+	if mk.Value.Unbox() != nil {
+		return nil, errors.New("use = to match values")
+	}
+	return mk, nil
+}
+
+// queryKey is Query with the key of the pattern parsed
+func (g *Graph) queryKey(pattern string, mk *d2ast.Key, value string, hasValue bool) ([]*Object, []*Edge, error) {
+	var err error
+	if len(mk.Edges) == 0 {
+		objPattern, attr, err := splitQueryAttribute(keyPath(mk.Key))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid query %q: %w", pattern, err)
+		}
+		if len(objPattern) == 0 {
+			return nil, nil, fmt.Errorf("invalid query %q: expected an object or edge", pattern)
+		}
+		var objects []*Object
+		for _, obj := range g.Objects {
+			if matchQueryPath(objPattern, idVals(obj)) && matchQueryAttribute(&obj.Attributes, attr, value, hasValue) {
+				objects = append(objects, obj)
+			}
+		}
+		return objects, nil, nil
+	}
+
+	if len(mk.Edges) > 1 {
+		return nil, nil, fmt.Errorf("invalid query %q: edge chains can't be queried, query each edge instead", pattern)
+	}
+	scope := keyPath(mk.Key)
+	if _, attr, _ := splitQueryAttribute(scope); len(attr) > 0 {
+		return nil, nil, fmt.Errorf("invalid query %q: edges can't be in %s", pattern, strings.Join(attr, "."))
+	}
+	e := mk.Edges[0]
+	src := append(append([]*d2ast.StringBox{}, scope...), e.Src.Path...)
+	dst := append(append([]*d2ast.StringBox{}, scope...), e.Dst.Path...)
+	srcArrow := e.SrcArrow == "<"
+	dstArrow := e.DstArrow == ">"
+	var attr []string
+	if mk.EdgeKey != nil {
+		var objPattern []*d2ast.StringBox
+		objPattern, attr, err = splitQueryAttribute(mk.EdgeKey.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid query %q: %w", pattern, err)
+		}
+		if len(objPattern) > 0 {
+			return nil, nil, fmt.Errorf("invalid query %q: edges don't have children", pattern)
+		}
+	} else if hasValue {
+		return nil, nil, fmt.Errorf("invalid query %q: values can only be matched on attributes, e.g. (a -> b)[*].style.stroke=red", pattern)
+	}
+
+	var edges []*Edge
+	for _, edge := range g.Edges {
+		if mk.EdgeIndex != nil && mk.EdgeIndex.Int != nil && *mk.EdgeIndex.Int != edge.Index {
+			continue
+		}
+		srcPath, dstPath := idVals(edge.Src), idVals(edge.Dst)
+		forward := edge.SrcArrow == srcArrow && edge.DstArrow == dstArrow &&
+			matchQueryPath(src, srcPath) && matchQueryPath(dst, dstPath)
+		backward := edge.SrcArrow == dstArrow && edge.DstArrow == srcArrow &&
+			matchQueryPath(src, dstPath) && matchQueryPath(dst, srcPath)
+		if (forward || backward) && matchQueryEdgeAttribute(edge, attr, value, hasValue) {
+			edges = append(edges, edge)
+		}
+	}
+	return nil, edges, nil
+}
+
+// splitQueryValue splits the value to match after the first = outside of quotes
+func splitQueryValue(pattern string) (key, value string, ok bool) {
+	var quote rune
+	for i, r := range pattern {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '=':
+			value = strings.TrimSpace(pattern[i+1:])
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			return strings.TrimSpace(pattern[:i]), value, true
+		}
+	}
+	return pattern, "", false
+}
+
+func keyPath(kp *d2ast.KeyPath) []*d2ast.StringBox {
+	if kp == nil {
+		return nil
+	}
+	return kp.Path
+}
+
+// splitQueryAttribute splits a key path at its first reserved keyword
+func splitQueryAttribute(path []*d2ast.StringBox) ([]*d2ast.StringBox, []string, error) {
+	for i, sb := range path {
+		keyword := strings.ToLower(sb.Unbox().ScalarString())
+		if _, ok := ReservedKeywords[keyword]; !ok {
+			continue
+		}
+		if _, ok := BoardKeywords[keyword]; ok {
+			return nil, nil, errors.New("boards can't be queried, query the graph of the board instead")
+		}
+		attr := make([]string, 0, len(path)-i)
+		for _, sb := range path[i:] {
+			attr = append(attr, strings.ToLower(sb.Unbox().ScalarString()))
+		}
+		return path[:i], attr, nil
+	}
+	return path, nil, nil
+}
+
+// matchQueryPath matches the path of ID values of an object against a key pattern
+func matchQueryPath(pattern []*d2ast.StringBox, ids []string) bool {
+	if len(pattern) == 0 {
+		return len(ids) == 0
+	}
+	if len(ids) == 0 {
+		return false
+	}
+	sb := pattern[0]
+	if us := sb.UnquotedString; us != nil && d2ast.IsDoubleGlob(us.Pattern) {
+		// ** matches one or more objects
+		for i := 1; i <= len(ids); i++ {
+			if matchQueryPath(pattern[1:], ids[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if us := sb.UnquotedString; us != nil && us.Pattern != nil {
+		if !MatchGlob(us.ScalarString(), ids[0]) {
+			return false
+		}
+	} else if !strings.EqualFold(sb.Unbox().ScalarString(), ids[0]) {
+		return false
+	}
+	return matchQueryPath(pattern[1:], ids[1:])
+}
+
+// idVals returns the path of ID values, unquoted, from the root to obj
+func idVals(obj *Object) []string {
+	if obj.Parent == nil {
+		return nil
+	}
+	return append(idVals(obj.Parent), obj.IDVal)
+}
+
+func matchQueryEdgeAttribute(e *Edge, attr []string, value string, hasValue bool) bool {
+	if len(attr) == 1 && (attr[0] == "source-label" || attr[0] == "target-label") {
+		arrowhead := e.SrcArrowhead
+		if attr[0] == "target-label" {
+			arrowhead = e.DstArrowhead
+		}
+		if arrowhead == nil || arrowhead.Label.Value == "" {
+			return false
+		}
+		return !hasValue || MatchGlob(value, arrowhead.Label.Value)
+	}
+	if len(attr) > 1 {
+		switch attr[0] {
+		case "source-arrowhead":
+			if e.SrcArrowhead == nil {
+				return false
+			}
+			return matchQueryAttribute(e.SrcArrowhead, attr[1:], value, hasValue)
+		case "target-arrowhead":
+			if e.DstArrowhead == nil {
+				return false
+			}
+			return matchQueryAttribute(e.DstArrowhead, attr[1:], value, hasValue)
+		}
+	}
+	return matchQueryAttribute(&e.Attributes, attr, value, hasValue)
+}
+
+// matchQueryAttribute matches an attribute, given as its keywords, e.g. style.fill. Without a
+// value, it matches attributes that are set.
+func matchQueryAttribute(attrs *Attributes, attr []string, value string, hasValue bool) bool {
+	if len(attr) == 0 {
+		return true
+	}
+	v, ok := attributeValue(attrs, attr)
+	if !ok {
+		return false
+	}
+	if !hasValue {
+		return true
+	}
+	return MatchGlob(value, v)
+}
+
+// attributeValue returns the value of an attribute as written in D2
+func attributeValue(attrs *Attributes, attr []string) (string, bool) {
+	scalar := func(s *Scalar) (string, bool) {
+		if s == nil {
+			return "", false
+		}
+		return s.Value, true
+	}
+	if len(attr) == 2 && attr[0] == "near" {
+		switch attr[1] {
+		case "side":
+			return scalar(attrs.NearSide)
+		case "gap":
+			return scalar(attrs.NearGap)
+		}
+	}
+	if len(attr) == 2 && attr[1] == "near" {
+		switch attr[0] {
+		case "label":
+			return scalar(attrs.LabelPosition)
+		case "icon":
+			return scalar(attrs.IconPosition)
+		}
+	}
+	if len(attr) == 2 && attr[0] == "style" {
+		s := attrs.Style
+		switch attr[1] {
+		case "opacity":
+			return scalar(s.Opacity)
+		case "stroke":
+			return scalar(s.Stroke)
+		case "fill":
+			return scalar(s.Fill)
+		case "fill-pattern":
+			return scalar(s.FillPattern)
+		case "stroke-width":
+			return scalar(s.StrokeWidth)
+		case "stroke-dash":
+			return scalar(s.StrokeDash)
+		case "border-radius":
+			return scalar(s.BorderRadius)
+		case "shadow":
+			return scalar(s.Shadow)
+		case "3d":
+			return scalar(s.ThreeDee)
+		case "multiple":
+			return scalar(s.Multiple)
+		case "font":
+			return scalar(s.Font)
+		case "font-size":
+			return scalar(s.FontSize)
+		case "font-color":
+			return scalar(s.FontColor)
+		case "animated":
+			return scalar(s.Animated)
+		case "bold":
+			return scalar(s.Bold)
+		case "italic":
+			return scalar(s.Italic)
+		case "underline":
+			return scalar(s.Underline)
+		case "filled":
+			return scalar(s.Filled)
+		case "double-border":
+			return scalar(s.DoubleBorder)
+		case "border-style":
+			return scalar(s.BorderStyle)
+		case "text-transform":
+			return scalar(s.TextTransform)
+		case "text-align":
+			return scalar(s.TextAlign)
+		case "text-direction":
+			return scalar(s.TextDirection)
+		case "latex-scale":
+			return scalar(s.LatexScale)
+		case "header":
+			return scalar(s.Header)
+		case "bundle":
+			return scalar(s.Bundle)
+		case "layer-group":
+			return scalar(s.LayerGroup)
+		}
+		return "", false
+	}
+	if len(attr) != 1 {
+		return "", false
+	}
+	switch attr[0] {
+	case "label":
+		return attrs.Label.Value, attrs.Label.Value != ""
+	case "shape":
+		if attrs.Shape.Value == "" {
+			return d2target.ShapeRectangle, true
+		}
+		return attrs.Shape.Value, true
+	case "icon":
+		if attrs.Icon == nil {
+			return "", false
+		}
+		return attrs.Icon.String(), true
+	case "tooltip":
+		return scalar(attrs.Tooltip)
+	case "link":
+		return scalar(attrs.Link)
+	case "width":
+		return scalar(attrs.WidthAttr)
+	case "height":
+		return scalar(attrs.HeightAttr)
+	case "top":
+		return scalar(attrs.Top)
+	case "left":
+		return scalar(attrs.Left)
+	case "straighten":
+		return scalar(attrs.Straighten)
+	case "min-length":
+		return scalar(attrs.MinLength)
+	case "max-rows":
+		return scalar(attrs.MaxRows)
+	case "stereotype":
+		return scalar(attrs.Stereotype)
+	case "group-by":
+		return scalar(attrs.GroupBy)
+	case "modifier":
+		return scalar(attrs.Modifier)
+	case "shape-src":
+		return scalar(attrs.ShapeSrc)
+	case "board":
+		return scalar(attrs.Board)
+	case "collapsed":
+		return scalar(attrs.Collapsed)
+	case "near":
+		if attrs.NearKey == nil {
+			return "", false
+		}
+		return d2format.Format(attrs.NearKey), true
+	case "direction":
+		return attrs.Direction.Value, attrs.Direction.Value != ""
+	case "grid-rows":
+		return scalar(attrs.GridRows)
+	case "grid-columns":
+		return scalar(attrs.GridColumns)
+	case "grid-gap":
+		return scalar(attrs.GridGap)
+	case "vertical-gap":
+		return scalar(attrs.VerticalGap)
+	case "horizontal-gap":
+		return scalar(attrs.HorizontalGap)
+	case "class":
+		return strings.Join(attrs.Classes, ";"), len(attrs.Classes) > 0
+	}
+	return "", false
+}
+
+// MatchGlob matches s against a pattern where * matches any characters, case insensitively,
+// like globs in D2 keys
+func MatchGlob(pattern, s string) bool {
+	pattern = strings.ToLower(pattern)
+	s = strings.ToLower(s)
+	pieces := strings.Split(pattern, "*")
+	if len(pieces) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, pieces[0]) {
+		return false
+	}
+	s = s[len(pieces[0]):]
+	for _, piece := range pieces[1 : len(pieces)-1] {
+		i := strings.Index(s, piece)
+		if i == -1 {
+			return false
+		}
+		s = s[i+len(piece):]
+	}
+	return strings.HasSuffix(s, pieces[len(pieces)-1])
+}
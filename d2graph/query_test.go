@@ -0,0 +1,79 @@
+package d2graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+)
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`a: {
+  users: {shape: sql_table}
+  web: {tooltip: serves users}
+}
+b: {
+  orders: {shape: sql_table}
+  "my queue": {
+    shape: queue
+    style.fill: "#fde"
+  }
+}
+a.users -> b.orders
+a.web -> b.orders: {style.stroke: red}
+b.orders <- a.web
+a.web <-> b."my queue"
+`), nil)
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		pattern string
+		objects []string
+		edges   []string
+		err     string
+	}{
+		{pattern: "a.*", objects: []string{"a.users", "a.web"}},
+		{pattern: "A.W*", objects: []string{"a.web"}},
+		{pattern: "**.shape=sql_table", objects: []string{"a.users", "b.orders"}},
+		{pattern: "**.shape=rectangle", objects: []string{"a", "a.web", "b"}},
+		{pattern: "**.tooltip", objects: []string{"a.web"}},
+		{pattern: "**.tooltip=*users", objects: []string{"a.web"}},
+		{pattern: `b."my queue"`, objects: []string{`b.my queue`}},
+		{pattern: `*.*.style.fill="#fde"`, objects: []string{`b.my queue`}},
+		{pattern: "b.**", objects: []string{"b.orders", `b.my queue`}},
+		{pattern: "a.* -> b.*", edges: []string{"(a.users -> b.orders)[0]", "(a.web -> b.orders)[0]", "(b.orders <- a.web)[0]"}},
+		{pattern: "b.* <- a.*", edges: []string{"(a.users -> b.orders)[0]", "(a.web -> b.orders)[0]", "(b.orders <- a.web)[0]"}},
+		{pattern: "** <-> **", edges: []string{`(a.web <-> b.my queue)[0]`}},
+		{pattern: "a.(web -> *)", edges: []string{}},
+		{pattern: "(a.web -> b.orders)[0]", edges: []string{"(a.web -> b.orders)[0]", "(b.orders <- a.web)[0]"}},
+		{pattern: "(a.web -> b.orders)[1]", edges: []string{}},
+		{pattern: "(** -> **)[*].style.stroke=red", edges: []string{"(a.web -> b.orders)[0]"}},
+		{pattern: "a.web.shape: circle", err: `invalid query "a.web.shape: circle": use = to match values`},
+		{pattern: "layers.x", err: `invalid query "layers.x": boards can't be queried, query the graph of the board instead`},
+		{pattern: "a -> b=c", err: `invalid query "a -> b=c": values can only be matched on attributes, e.g. (a -> b)[*].style.stroke=red`},
+	}
+	for _, tc := range testCases {
+		objects, edges, err := g.Query(tc.pattern)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+			continue
+		}
+		assert.Nil(t, err, tc.pattern)
+		var objectIDs []string
+		for _, obj := range objects {
+			objectIDs = append(objectIDs, obj.AbsID())
+		}
+		edgeIDs := []string{}
+		for _, e := range edges {
+			edgeIDs = append(edgeIDs, e.AbsID())
+		}
+		assert.Equal(t, tc.objects, objectIDs, tc.pattern)
+		if tc.edges != nil {
+			assert.Equal(t, tc.edges, edgeIDs, tc.pattern)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package d2graph
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -9,7 +12,18 @@ import (
 	"oss.terrastruct.com/util-go/go2"
 )
 
+// SerializationVersion is the version of the formats of SerializeGraph and
+// SerializeGraphCompact, as major.minor. The major version changes when older releases can't
+// decode graphs anymore. Minor versions only add fields, which older releases ignore.
+const SerializationVersion = "1.0"
+
+// compactMagic starts graphs serialized with SerializeGraphCompact, followed by the version
+// and a newline. It can't start JSON.
+const compactMagic = "\x00d2graph "
+
 type SerializedGraph struct {
+	// Version is empty for graphs serialized before formats were versioned.
+	Version   string             `json:"version,omitempty"`
 	Root      SerializedObject   `json:"root"`
 	Edges     []SerializedEdge   `json:"edges"`
 	Objects   []SerializedObject `json:"objects"`
@@ -20,12 +34,21 @@ type SerializedObject map[string]interface{}
 
 type SerializedEdge map[string]interface{}
 
+// DeserializeGraph decodes a graph serialized with SerializeGraph or SerializeGraphCompact
+// into g. Fields it doesn't know of, from newer minor versions, are ignored.
 func DeserializeGraph(bytes []byte, g *Graph) error {
+	if strings.HasPrefix(string(bytes[:min(len(bytes), len(compactMagic))]), compactMagic) {
+		return deserializeGraphCompact(bytes, g)
+	}
+
 	var sg *SerializedGraph
 	err := json.Unmarshal(bytes, &sg)
 	if err != nil {
 		return err
 	}
+	if err := checkSerializationVersion(sg.Version); err != nil {
+		return err
+	}
 
 	var root Object
 	Convert(sg.Root, &root)
@@ -87,7 +110,9 @@ func DeserializeGraph(bytes []byte, g *Graph) error {
 }
 
 func SerializeGraph(g *Graph) ([]byte, error) {
-	sg := SerializedGraph{}
+	sg := SerializedGraph{
+		Version: SerializationVersion,
+	}
 
 	root, err := toSerializedObject(g.Root)
 	if err != nil {
@@ -119,6 +144,137 @@ func SerializeGraph(g *Graph) ([]byte, error) {
 	return json.Marshal(sg)
 }
 
+// checkSerializationVersion errors on graphs serialized with another major version
+func checkSerializationVersion(version string) error {
+	if version == "" {
+		return nil
+	}
+	major, _, _ := strings.Cut(version, ".")
+	currentMajor, _, _ := strings.Cut(SerializationVersion, ".")
+	if major != currentMajor {
+		return fmt.Errorf("graph was serialized with version %s, which is incompatible with version %s", version, SerializationVersion)
+	}
+	return nil
+}
+
+type compactGraph struct {
+	Root      compactObject   `json:"r"`
+	Objects   []compactObject `json:"o"`
+	Edges     []compactEdge   `json:"e"`
+	RootLevel int             `json:"l"`
+}
+
+type compactObject struct {
+	Object   *Object  `json:"o"`
+	AbsID    string   `json:"id"`
+	Children []string `json:"c,omitempty"`
+}
+
+type compactEdge struct {
+	Edge *Edge  `json:"e"`
+	Src  string `json:"s"`
+	Dst  string `json:"d"`
+}
+
+// SerializeGraphCompact serializes g like SerializeGraph into a compressed encoding, which is
+// several times smaller and faster to encode and decode, e.g. to cache graphs. Decode it with
+// DeserializeGraph.
+func SerializeGraphCompact(g *Graph) ([]byte, error) {
+	cg := compactGraph{
+		Root:      toCompactObject(g.Root),
+		RootLevel: g.RootLevel,
+	}
+	for _, o := range g.Objects {
+		cg.Objects = append(cg.Objects, toCompactObject(o))
+	}
+	for _, e := range g.Edges {
+		cg.Edges = append(cg.Edges, compactEdge{
+			Edge: e,
+			Src:  e.Src.AbsID(),
+			Dst:  e.Dst.AbsID(),
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(compactMagic + SerializationVersion + "\n")
+	fw, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(fw).Encode(cg); err != nil {
+		return nil, err
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toCompactObject(o *Object) compactObject {
+	co := compactObject{
+		Object: o,
+		AbsID:  o.AbsID(),
+	}
+	for _, c := range o.ChildrenArray {
+		co.Children = append(co.Children, c.AbsID())
+	}
+	return co
+}
+
+func deserializeGraphCompact(b []byte, g *Graph) error {
+	r := bufio.NewReader(bytes.NewReader(b[len(compactMagic):]))
+	version, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read graph version: %w", err)
+	}
+	if err := checkSerializationVersion(strings.TrimSuffix(version, "\n")); err != nil {
+		return err
+	}
+
+	var cg compactGraph
+	fr := flate.NewReader(r)
+	defer fr.Close()
+	if err := json.NewDecoder(fr).Decode(&cg); err != nil {
+		return err
+	}
+
+	if cg.Root.Object == nil {
+		cg.Root.Object = &Object{}
+	}
+	g.Root = cg.Root.Object
+	g.RootLevel = cg.RootLevel
+
+	idToObj := make(map[string]*Object, len(cg.Objects)+1)
+	idToObj[""] = g.Root
+	g.Objects = nil
+	for _, co := range cg.Objects {
+		idToObj[co.AbsID] = co.Object
+		g.Objects = append(g.Objects, co.Object)
+	}
+	for _, co := range append(cg.Objects, cg.Root) {
+		co.Object.Graph = g
+		if len(co.Children) == 0 {
+			continue
+		}
+		co.Object.Children = make(map[string]*Object, len(co.Children))
+		co.Object.ChildrenArray = nil
+		for _, id := range co.Children {
+			child := idToObj[id]
+			child.Parent = co.Object
+			co.Object.Children[strings.ToLower(child.ID)] = child
+			co.Object.ChildrenArray = append(co.Object.ChildrenArray, child)
+		}
+	}
+
+	g.Edges = nil
+	for _, ce := range cg.Edges {
+		ce.Edge.Src = idToObj[ce.Src]
+		ce.Edge.Dst = idToObj[ce.Dst]
+		g.Edges = append(g.Edges, ce.Edge)
+	}
+	return nil
+}
+
 func toSerializedObject(o *Object) (SerializedObject, error) {
 	var so SerializedObject
 	if err := Convert(o, &so); err != nil {
@@ -439,5 +595,14 @@ func CompareSerializedEdge(edge, other *Edge) error {
 			return fmt.Errorf("dst column differs: edge=%d, other=%d", edgeColumn, otherColumn)
 		}
 	}
+
+	if (edge.SrcClassMemberIndex == nil) != (other.SrcClassMemberIndex == nil) ||
+		(edge.SrcClassMemberIndex != nil && *edge.SrcClassMemberIndex != *other.SrcClassMemberIndex) {
+		return fmt.Errorf("src class member differs")
+	}
+	if (edge.DstClassMemberIndex == nil) != (other.DstClassMemberIndex == nil) ||
+		(edge.DstClassMemberIndex != nil && *edge.DstClassMemberIndex != *other.DstClassMemberIndex) {
+		return fmt.Errorf("dst class member differs")
+	}
 	return nil
 }
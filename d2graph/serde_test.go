@@ -69,3 +69,43 @@ func TestCasingRegression(t *testing.T) {
 	_, ok = newG.Root.HasChild([]string{"UserCreatedTypeField"})
 	assert.True(t, ok)
 }
+
+func TestSerializationCompact(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`a.a.b -> a.a.c: hi
+a.a.c <- d: {style.stroke: red}
+x: {shape: sql_table; id: int}
+`), nil)
+	assert.Nil(t, err)
+
+	b, err := d2graph.SerializeGraph(g)
+	assert.Nil(t, err)
+	compact, err := d2graph.SerializeGraphCompact(g)
+	assert.Nil(t, err)
+	assert.Less(t, len(compact)*4, len(b))
+
+	var newG d2graph.Graph
+	err = d2graph.DeserializeGraph(compact, &newG)
+	assert.Nil(t, err)
+	assert.Nil(t, d2graph.CompareSerializedGraph(g, &newG))
+	assert.Equal(t, "red", newG.Edges[1].Style.Stroke.Value)
+	assert.Equal(t, &newG, newG.Objects[0].Graph)
+}
+
+func TestSerializationVersion(t *testing.T) {
+	t.Parallel()
+
+	// Unversioned graphs and fields from newer minor versions are accepted
+	var g d2graph.Graph
+	err := d2graph.DeserializeGraph([]byte(`{"root": {}, "rootLevel": 0}`), &g)
+	assert.Nil(t, err)
+	err = d2graph.DeserializeGraph([]byte(`{"version": "1.9", "root": {}, "objects": [{"AbsID": "a", "id": "a", "newField": true}]}`), &g)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", g.Objects[0].ID)
+
+	err = d2graph.DeserializeGraph([]byte(`{"version": "2.0", "root": {}}`), &g)
+	assert.EqualError(t, err, "graph was serialized with version 2.0, which is incompatible with version "+d2graph.SerializationVersion)
+	err = d2graph.DeserializeGraph([]byte("\x00d2graph 2.0\n"), &g)
+	assert.EqualError(t, err, "graph was serialized with version 2.0, which is incompatible with version "+d2graph.SerializationVersion)
+}
@@ -0,0 +1,89 @@
+package d2graph
+
+import (
+	"oss.terrastruct.com/d2/d2target"
+)
+
+const (
+	// stepAddedColor is the stroke of what HighlightSteps finds added
+	stepAddedColor = "#0D9F4F"
+	// stepRemovedOpacity is the opacity of what HighlightSteps adds back after it was removed
+	stepRemovedOpacity = "0.3"
+)
+
+// HighlightSteps styles what changes between consecutive steps of g and its boards, so that
+// walkthroughs emphasize what each step changes without styling every step by hand. Objects
+// and connections a step adds get a green stroke, and ones it removes are added back faded.
+//
+// The first step is compared to the board its steps are in, unless that board is empty. Like
+// the transforms, it's meant to be called before layout.
+func (g *Graph) HighlightSteps() {
+	for _, boards := range [][]*Graph{g.Layers, g.Scenarios, g.Steps} {
+		for _, b := range boards {
+			b.HighlightSteps()
+		}
+	}
+	if len(g.Steps) == 0 {
+		return
+	}
+
+	// Steps are compared before any is styled, since each is compared to the one before it
+	diffs := make([]*GraphDiff, len(g.Steps))
+	for i, step := range g.Steps {
+		prev := g
+		if i > 0 {
+			prev = g.Steps[i-1]
+		} else if len(g.Objects) == 0 {
+			continue
+		}
+		diffs[i] = Diff(prev, step)
+	}
+	// Later steps are styled first, so what's added back to them isn't styled as added too
+	for i := len(g.Steps) - 1; i >= 0; i-- {
+		if diffs[i] != nil {
+			g.Steps[i].highlightDiff(diffs[i])
+		}
+	}
+}
+
+func (g *Graph) highlightDiff(d *GraphDiff) {
+	for _, obj := range d.AddedObjects {
+		obj.Style.Stroke = &Scalar{Value: stepAddedColor}
+	}
+	// In steps, an object with a new ID is a new object even if it could be the old one renamed
+	for _, od := range d.RenamedObjects {
+		od.New.Style.Stroke = &Scalar{Value: stepAddedColor}
+	}
+	for _, e := range d.AddedEdges {
+		e.Style.Stroke = &Scalar{Value: stepAddedColor}
+	}
+
+	removed := append([]*Object(nil), d.RemovedObjects...)
+	for _, od := range d.RenamedObjects {
+		removed = append(removed, od.Old)
+	}
+	for _, old := range removed {
+		obj := g.Root.EnsureChild(old.AbsIDArray())
+		obj.Label = old.Label
+		obj.Icon = old.Icon
+		obj.Style = old.Style
+		obj.Style.Opacity = &Scalar{Value: stepRemovedOpacity}
+		// Tables and classes come back as plain shapes since their rows are gone
+		switch old.Shape.Value {
+		case d2target.ShapeSQLTable, d2target.ShapeClass:
+		default:
+			obj.Shape = old.Shape
+		}
+	}
+	for _, old := range d.RemovedEdges {
+		e, err := g.Root.Connect(old.Src.AbsIDArray(), old.Dst.AbsIDArray(), old.SrcArrow, old.DstArrow, "")
+		if err != nil {
+			continue
+		}
+		e.Label = old.Label
+		e.Style = old.Style
+		e.Style.Opacity = &Scalar{Value: stepRemovedOpacity}
+		e.SrcArrowhead = old.SrcArrowhead
+		e.DstArrowhead = old.DstArrowhead
+	}
+}
@@ -0,0 +1,80 @@
+package d2graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+func TestHighlightSteps(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`steps: {
+  1: {
+    a -> b
+  }
+  2: {
+    c: {shape: cylinder}
+    b -> c
+  }
+  3: {
+    b: null
+    c.style.fill: red
+  }
+}
+`), nil)
+	assert.Nil(t, err)
+	g.HighlightSteps()
+
+	stroke := func(attrs d2graph.Attributes) string {
+		if attrs.Style.Stroke == nil {
+			return ""
+		}
+		return attrs.Style.Stroke.Value
+	}
+	opacity := func(attrs d2graph.Attributes) string {
+		if attrs.Style.Opacity == nil {
+			return ""
+		}
+		return attrs.Style.Opacity.Value
+	}
+
+	// The board the steps are in is empty, so the first step isn't highlighted
+	step1 := g.Steps[0]
+	assert.Equal(t, "", stroke(step1.Objects[0].Attributes))
+	assert.Equal(t, "", stroke(step1.Edges[0].Attributes))
+
+	step2 := g.Steps[1]
+	ids := make(map[string]d2graph.Attributes)
+	for _, obj := range step2.Objects {
+		ids[obj.AbsID()] = obj.Attributes
+	}
+	assert.Equal(t, "", stroke(ids["a"]))
+	assert.Equal(t, "", stroke(ids["b"]))
+	assert.Equal(t, "#0D9F4F", stroke(ids["c"]))
+	assert.Equal(t, "", stroke(step2.Edges[0].Attributes))
+	assert.Equal(t, "(b -> c)[0]", step2.Edges[1].AbsID())
+	assert.Equal(t, "#0D9F4F", stroke(step2.Edges[1].Attributes))
+
+	// b and its connections are added back faded after it's removed, and modifications aren't
+	// highlighted
+	step3 := g.Steps[2]
+	ids = make(map[string]d2graph.Attributes)
+	for _, obj := range step3.Objects {
+		ids[obj.AbsID()] = obj.Attributes
+	}
+	assert.Equal(t, 3, len(step3.Objects))
+	assert.Equal(t, "0.3", opacity(ids["b"]))
+	assert.Equal(t, "", opacity(ids["a"]))
+	assert.Equal(t, "", stroke(ids["c"]))
+	assert.Equal(t, "red", ids["c"].Style.Fill.Value)
+	assert.Equal(t, 2, len(step3.Edges))
+	for _, e := range step3.Edges {
+		assert.Equal(t, "0.3", opacity(e.Attributes))
+		assert.Equal(t, "", stroke(e.Attributes))
+	}
+}
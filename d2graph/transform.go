@@ -0,0 +1,241 @@
+package d2graph
+
+import (
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2parser"
+)
+
+// Transforms derive a smaller graph from the same source, e.g. an overview and a detailed
+// view of one part. Like RemoveHidden, they're meant to be called before layout.
+
+// CollapseContainer removes the descendants of the object with the absolute ID id, so it's
+// drawn as a single shape. Connections to descendants are moved to it, and ones between its
+// descendants are removed.
+func (g *Graph) CollapseContainer(id string) error {
+	obj, err := g.objectByID(id)
+	if err != nil {
+		return err
+	}
+	g.collapse([]*Object{obj})
+	return nil
+}
+
+// CollapseMarked collapses the containers with collapsed: true, like CollapseContainer, so a
+// diagram can be drawn as an overview from the same source.
+func (g *Graph) CollapseMarked() {
+	var containers []*Object
+	for _, obj := range g.Objects {
+		if !obj.IsCollapsed() || !obj.IsContainer() {
+			continue
+		}
+		// What's in a collapsed container is gone with it
+		nested := false
+		for p := obj.Parent; p != nil; p = p.Parent {
+			if p.IsCollapsed() {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			containers = append(containers, obj)
+		}
+	}
+	if len(containers) > 0 {
+		g.collapse(containers)
+	}
+}
+
+// FilterByDepth collapses all objects at depth, where top level objects are at depth 1, so
+// that nothing is nested deeper.
+func (g *Graph) FilterByDepth(depth int) error {
+	if depth < 1 {
+		return fmt.Errorf("depth must be at least 1, got %d", depth)
+	}
+	var containers []*Object
+	for _, obj := range g.Objects {
+		if int(obj.Level())-g.RootLevel == depth && obj.IsContainer() {
+			containers = append(containers, obj)
+		}
+	}
+	g.collapse(containers)
+	return nil
+}
+
+// FocusNeighborhood removes all but the object with the absolute ID id, its descendants, and
+// the objects up to radius connections away from them, ignoring direction. The containers of
+// what's kept are kept too, without their other children.
+func (g *Graph) FocusNeighborhood(id string, radius int) error {
+	focus, err := g.objectByID(id)
+	if err != nil {
+		return err
+	}
+	if radius < 0 {
+		return fmt.Errorf("radius must be at least 0, got %d", radius)
+	}
+
+	reached := make(map[*Object]struct{})
+	var frontier []*Object
+	for _, obj := range g.Objects {
+		if obj.IsDescendantOf(focus) {
+			reached[obj] = struct{}{}
+			frontier = append(frontier, obj)
+		}
+	}
+	for i := 0; i < radius && len(frontier) > 0; i++ {
+		var next []*Object
+		for _, e := range g.Edges {
+			for _, pair := range [][2]*Object{{e.Src, e.Dst}, {e.Dst, e.Src}} {
+				if _, ok := reached[pair[0]]; !ok {
+					continue
+				}
+				if _, ok := reached[pair[1]]; ok {
+					continue
+				}
+				if !contains(frontier, pair[0]) {
+					continue
+				}
+				reached[pair[1]] = struct{}{}
+				next = append(next, pair[1])
+			}
+		}
+		frontier = next
+	}
+
+	keep := map[*Object]struct{}{
+		g.Root: {},
+	}
+	for obj := range reached {
+		for ; obj.Parent != nil; obj = obj.Parent {
+			keep[obj] = struct{}{}
+		}
+	}
+	g.removeObjects(func(obj *Object) bool {
+		_, ok := keep[obj]
+		return !ok
+	})
+	return nil
+}
+
+func contains(objects []*Object, obj *Object) bool {
+	for _, o := range objects {
+		if o == obj {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Graph) objectByID(id string) (*Object, error) {
+	mk, err := d2parser.ParseMapKey(id)
+	if err != nil || mk.Key == nil || len(mk.Edges) > 0 {
+		return nil, fmt.Errorf("%q is not an object ID", id)
+	}
+	obj, ok := g.Root.HasChild(Key(mk.Key))
+	if !ok || obj == g.Root {
+		return nil, fmt.Errorf("object %q not found", id)
+	}
+	return obj, nil
+}
+
+// HasObject reports whether the board has an object with the absolute ID id
+func (g *Graph) HasObject(id string) bool {
+	_, err := g.objectByID(id)
+	return err == nil
+}
+
+// collapse removes the descendants of containers and moves their connections to them
+func (g *Graph) collapse(containers []*Object) {
+	collapsedInto := func(obj *Object) *Object {
+		for _, c := range containers {
+			if obj != c && obj.IsDescendantOf(c) {
+				return c
+			}
+		}
+		return obj
+	}
+
+	edges := g.Edges[:0]
+	seen := make(map[string]struct{})
+	for _, e := range g.Edges {
+		src, dst := collapsedInto(e.Src), collapsedInto(e.Dst)
+		if src == e.Src && dst == e.Dst {
+			edges = append(edges, e)
+			continue
+		}
+		if src == dst {
+			continue
+		}
+		// Many connections to what's inside become one to the container
+		key := strings.ToLower(src.AbsID()) + e.ArrowString() + strings.ToLower(dst.AbsID())
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		e.Src, e.Dst = src, dst
+		e.SrcTableColumnIndex, e.DstTableColumnIndex = nil, nil
+		e.SrcClassMemberIndex, e.DstClassMemberIndex = nil, nil
+		edges = append(edges, e)
+	}
+	g.Edges = edges
+	g.reindexEdges()
+
+	g.removeObjects(func(obj *Object) bool {
+		return collapsedInto(obj) != obj
+	})
+}
+
+// removeObjects removes the objects remove is true for and their connections. remove must be
+// true for the descendants of removed objects.
+func (g *Graph) removeObjects(remove func(*Object) bool) {
+	edges := g.Edges[:0]
+	for _, e := range g.Edges {
+		if remove(e.Src) || remove(e.Dst) {
+			continue
+		}
+		edges = append(edges, e)
+	}
+	g.Edges = edges
+
+	objects := g.Objects[:0]
+	for _, obj := range g.Objects {
+		if remove(obj) {
+			if !remove(obj.Parent) {
+				obj.Parent.RemoveChild(obj)
+			}
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	g.Objects = objects
+
+	// Objects can't be near something that no longer exists
+	for _, obj := range g.Objects {
+		if obj.NearKey == nil || obj.IsConstantNear() {
+			continue
+		}
+		if _, ok := g.Root.HasChild(Key(obj.NearKey)); !ok {
+			obj.NearKey = nil
+		}
+	}
+}
+
+// reindexEdges gives connections that were moved onto the same objects distinct indexes, so
+// their IDs stay unique
+func (g *Graph) reindexEdges() {
+	used := make(map[string]map[int]struct{})
+	for _, e := range g.Edges {
+		key := strings.ToLower(e.Src.AbsID()) + e.ArrowString() + strings.ToLower(e.Dst.AbsID())
+		if used[key] == nil {
+			used[key] = make(map[int]struct{})
+		}
+		for {
+			if _, ok := used[key][e.Index]; !ok {
+				break
+			}
+			e.Index++
+		}
+		used[key][e.Index] = struct{}{}
+	}
+}
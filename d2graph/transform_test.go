@@ -0,0 +1,138 @@
+package d2graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+const transformScript = `a: {
+  x -> y
+  x.deep
+}
+b: {z}
+c
+a.x -> b.z
+a.y -> b.z
+b -> c
+d -> c
+e -> d
+`
+
+func TestTransforms(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		transform func(g *d2graph.Graph) error
+		objects   []string
+		edges     []string
+		err       string
+	}{
+		{
+			name:      "collapse",
+			transform: func(g *d2graph.Graph) error { return g.CollapseContainer("a") },
+			objects:   []string{"a", "b", "b.z", "c", "d", "e"},
+			edges:     []string{"(a -> b.z)[0]", "(b -> c)[0]", "(d -> c)[0]", "(e -> d)[0]"},
+		},
+		{
+			name:      "collapse_missing",
+			transform: func(g *d2graph.Graph) error { return g.CollapseContainer("a.nope") },
+			err:       `object "a.nope" not found`,
+		},
+		{
+			name:      "depth",
+			transform: func(g *d2graph.Graph) error { return g.FilterByDepth(1) },
+			objects:   []string{"a", "b", "c", "d", "e"},
+			edges:     []string{"(a -> b)[0]", "(b -> c)[0]", "(d -> c)[0]", "(e -> d)[0]"},
+		},
+		{
+			name:      "depth_2",
+			transform: func(g *d2graph.Graph) error { return g.FilterByDepth(2) },
+			objects:   []string{"a", "a.x", "a.y", "b", "b.z", "c", "d", "e"},
+			edges:     []string{"a.(x -> y)[0]", "(a.x -> b.z)[0]", "(a.y -> b.z)[0]", "(b -> c)[0]", "(d -> c)[0]", "(e -> d)[0]"},
+		},
+		{
+			name:      "focus",
+			transform: func(g *d2graph.Graph) error { return g.FocusNeighborhood("c", 1) },
+			objects:   []string{"b", "c", "d"},
+			edges:     []string{"(b -> c)[0]", "(d -> c)[0]"},
+		},
+		{
+			name:      "focus_radius",
+			transform: func(g *d2graph.Graph) error { return g.FocusNeighborhood("b", 2) },
+			objects:   []string{"a", "a.x", "a.y", "b", "b.z", "c", "d"},
+			edges:     []string{"a.(x -> y)[0]", "(a.x -> b.z)[0]", "(a.y -> b.z)[0]", "(b -> c)[0]", "(d -> c)[0]"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g, _, err := d2compiler.Compile("", strings.NewReader(transformScript), nil)
+			assert.Nil(t, err)
+			err = tc.transform(g)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.Nil(t, err)
+
+			var objects []string
+			for _, obj := range g.Objects {
+				objects = append(objects, obj.AbsID())
+			}
+			var edges []string
+			for _, e := range g.Edges {
+				edges = append(edges, e.AbsID())
+			}
+			assert.ElementsMatch(t, tc.objects, objects)
+			assert.ElementsMatch(t, tc.edges, edges)
+			for _, obj := range append(g.Objects, g.Root) {
+				if obj.Parent != nil {
+					assert.Contains(t, obj.Parent.ChildrenArray, obj)
+				}
+				for _, child := range obj.ChildrenArray {
+					assert.Contains(t, g.Objects, child)
+				}
+			}
+		})
+	}
+}
+
+func TestCollapseMarked(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`a: {
+  collapsed: true
+  x -> y
+  x: {
+    collapsed: true
+    deep
+  }
+}
+b: {z}
+a.x.deep -> b.z
+a.y -> b.z
+b.z -> a
+`), nil)
+	assert.Nil(t, err)
+	g.CollapseMarked()
+
+	var objects []string
+	for _, obj := range g.Objects {
+		objects = append(objects, obj.AbsID())
+	}
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.AbsID())
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "b.z"}, objects)
+	assert.ElementsMatch(t, []string{"(a -> b.z)[0]", "(b.z -> a)[0]"}, edges)
+	assert.Empty(t, g.Objects[0].ChildrenArray)
+}
@@ -12,6 +12,7 @@ import (
 	"oss.terrastruct.com/d2/d2parser"
 	"oss.terrastruct.com/d2/d2themes"
 	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/sliceindex"
 )
 
 type globContext struct {
@@ -27,12 +28,14 @@ type globContext struct {
 type compiler struct {
 	err *d2parser.ParseError
 
-	fs      fs.FS
-	imports []string
+	fs          fs.FS
+	fetchImport func(url string) ([]byte, error)
+	imports     []string
 	// importStack is used to detect cyclic imports.
 	importStack []string
 	seenImports map[string]struct{}
 	utf16Pos    bool
+	defines     map[string]string
 
 	// Stack of globs that must be recomputed at each new object in and below the current scope.
 	globContextStack [][]*globContext
@@ -41,16 +44,34 @@ type compiler struct {
 	// Used to check whether ampersands are allowed in the current map.
 	mapRefContextStack   []*RefContext
 	lazyGlobBeingApplied bool
+
+	// What the ghosts of edges to other boards stand in for, validated once everything is
+	// compiled.
+	crossBoardTargets []crossBoardTarget
 }
 
 type CompileOptions struct {
 	UTF16Pos bool
 	// Pass nil to disable imports.
 	FS fs.FS
+	// FetchImport, if given, returns the file at the URL of a remote import, like
+	// "https://example.com/lib.d2", see remoteimport.Fetcher. Remote imports fail without it.
+	FetchImport func(url string) ([]byte, error)
+	// Stylesheet, if given, is a file of classes compiled before the script, so every board
+	// can use them and the script can override them.
+	Stylesheet *d2ast.Map
+	// Defines set the vars of the root board with the same names, like --define env=prod,
+	// overriding them. The conditions of ifs are evaluated with them first.
+	Defines map[string]string
 }
 
 func (c *compiler) errorf(n d2ast.Node, f string, v ...interface{}) {
-	c.err.Errors = append(c.err.Errors, d2parser.Errorf(n, f, v...).(d2ast.Error))
+	c.codeErrorf("", n, f, v...)
+}
+
+// codeErrorf is errorf for errors with a diagnostic code
+func (c *compiler) codeErrorf(code string, n d2ast.Node, f string, v ...interface{}) {
+	c.err.Errors = append(c.err.Errors, d2parser.CodeErrorf(code, n, f, v...).(d2ast.Error))
 }
 
 func Compile(ast *d2ast.Map, opts *CompileOptions) (*Map, []string, error) {
@@ -58,11 +79,13 @@ func Compile(ast *d2ast.Map, opts *CompileOptions) (*Map, []string, error) {
 		opts = &CompileOptions{}
 	}
 	c := &compiler{
-		err: &d2parser.ParseError{},
-		fs:  opts.FS,
+		err:         &d2parser.ParseError{},
+		fs:          opts.FS,
+		fetchImport: opts.FetchImport,
 
 		seenImports: make(map[string]struct{}),
 		utf16Pos:    opts.UTF16Pos,
+		defines:     opts.Defines,
 	}
 	m := &Map{}
 	m.initRoot()
@@ -74,15 +97,37 @@ func Compile(ast *d2ast.Map, opts *CompileOptions) (*Map, []string, error) {
 	})
 	defer c.popImportStack()
 
+	if opts.Stylesheet != nil {
+		c.compileStylesheet(m, opts.Stylesheet)
+	}
 	c.compileMap(m, ast, ast)
+	c.compileDefines(m, ast)
 	c.compileSubstitutions(m, nil)
 	c.overlayClasses(m)
+	c.validateCrossBoardTargets()
 	if !c.err.Empty() {
 		return nil, nil, c.err
 	}
 	return m, c.imports, nil
 }
 
+func (c *compiler) compileStylesheet(m *Map, stylesheet *d2ast.Map) {
+	valid := true
+	for _, n := range stylesheet.Nodes {
+		switch {
+		case n.Comment != nil, n.BlockComment != nil:
+		case n.MapKey != nil && n.MapKey.Key != nil && len(n.MapKey.Edges) == 0 &&
+			strings.EqualFold(n.MapKey.Key.Path[0].Unbox().ScalarString(), "classes"):
+		default:
+			c.errorf(n.Unbox(), "stylesheets can only define classes")
+			valid = false
+		}
+	}
+	if valid {
+		c.compileMap(m, stylesheet, stylesheet)
+	}
+}
+
 func (c *compiler) overlayClasses(m *Map) {
 	classes := m.GetField("classes")
 	if classes == nil || classes.Map() == nil {
@@ -109,7 +154,7 @@ func (c *compiler) overlayClasses(m *Map) {
 		if lClasses == nil {
 			lClasses = classes.Copy(l).(*Field)
 			l.Fields = append(l.Fields, lClasses)
-		} else {
+		} else if lClasses.Map() != nil {
 			base := classes.Copy(l).(*Field)
 			OverlayMap(base.Map(), lClasses.Map())
 			l.DeleteField("classes")
@@ -185,10 +230,10 @@ func (c *compiler) validateConfigs(configs *Field) {
 		}
 
 		switch f.Name {
-		case "sketch", "center":
+		case "sketch", "center", "edge-jumps":
 			_, err := strconv.ParseBool(val)
 			if err != nil {
-				c.errorf(f.LastRef().AST(), `expected a boolean for "%s", got "%s"`, f.Name, val)
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastRef().AST(), `expected a boolean for "%s", got "%s"`, f.Name, val)
 				continue
 			}
 		case "theme-overrides", "dark-theme-overrides":
@@ -199,20 +244,35 @@ func (c *compiler) validateConfigs(configs *Field) {
 		case "theme-id", "dark-theme-id":
 			valInt, err := strconv.Atoi(val)
 			if err != nil {
-				c.errorf(f.LastRef().AST(), `expected an integer for "%s", got "%s"`, f.Name, val)
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastRef().AST(), `expected an integer for "%s", got "%s"`, f.Name, val)
 				continue
 			}
 			if d2themescatalog.Find(int64(valInt)) == (d2themes.Theme{}) {
-				c.errorf(f.LastRef().AST(), `%d is not a valid theme ID`, valInt)
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastRef().AST(), `%d is not a valid theme ID`, valInt)
 				continue
 			}
 		case "pad":
 			_, err := strconv.Atoi(val)
 			if err != nil {
-				c.errorf(f.LastRef().AST(), `expected an integer for "%s", got "%s"`, f.Name, val)
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastRef().AST(), `expected an integer for "%s", got "%s"`, f.Name, val)
+				continue
+			}
+		case "snap":
+			valInt, err := strconv.Atoi(val)
+			if err != nil {
+				c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastRef().AST(), `expected an integer for "%s", got "%s"`, f.Name, val)
+				continue
+			}
+			if valInt < 0 {
+				c.errorf(f.LastRef().AST(), `"%s" must be 0 or more, got %d`, f.Name, valInt)
 				continue
 			}
 		case "layout-engine":
+		case "legend":
+			if val != "bottom" && val != "right" {
+				c.errorf(f.LastRef().AST(), `expected "bottom" or "right" for "%s", got "%s"`, f.Name, val)
+				continue
+			}
 		default:
 			c.errorf(f.LastRef().AST(), `"%s" is not a valid config`, f.Name)
 		}
@@ -221,13 +281,23 @@ func (c *compiler) validateConfigs(configs *Field) {
 
 func (c *compiler) resolveSubstitutions(varsStack []*Map, node Node) (removedField bool) {
 	var subbed bool
-	var resolvedField *Field
 
 	switch s := node.Primary().Value.(type) {
 	case *d2ast.UnquotedString:
 		for i, box := range s.Value {
 			if box.Substitution != nil {
+				var resolvedField *Field
+				if box.Substitution.Expression != "" {
+					var ok bool
+					resolvedField, ok = c.resolveExpression(varsStack, node, box.Substitution)
+					if !ok {
+						return
+					}
+				}
 				for _, vars := range varsStack {
+					if resolvedField != nil {
+						break
+					}
 					resolvedField = c.resolveSubstitution(vars, box.Substitution)
 					if resolvedField != nil {
 						if resolvedField.Primary() != nil {
@@ -239,7 +309,7 @@ func (c *compiler) resolveSubstitutions(varsStack []*Map, node Node) (removedFie
 					}
 				}
 				if resolvedField == nil {
-					c.errorf(node.LastRef().AST(), `could not resolve variable "%s"`, strings.Join(box.Substitution.IDA(), "."))
+					c.codeErrorf(d2ast.DIAGNOSTIC_UNDEFINED_VARIABLE, node.LastRef().AST(), `could not resolve variable "%s"`, strings.Join(box.Substitution.IDA(), "."))
 					return
 				}
 				if box.Substitution.Spread {
@@ -319,14 +389,22 @@ func (c *compiler) resolveSubstitutions(varsStack []*Map, node Node) (removedFie
 	case *d2ast.DoubleQuotedString:
 		for i, box := range s.Value {
 			if box.Substitution != nil {
+				var resolvedField *Field
+				if box.Substitution.Expression != "" {
+					var ok bool
+					resolvedField, ok = c.resolveExpression(varsStack, node, box.Substitution)
+					if !ok {
+						return
+					}
+				}
 				for _, vars := range varsStack {
-					resolvedField = c.resolveSubstitution(vars, box.Substitution)
 					if resolvedField != nil {
 						break
 					}
+					resolvedField = c.resolveSubstitution(vars, box.Substitution)
 				}
 				if resolvedField == nil {
-					c.errorf(node.LastRef().AST(), `could not resolve variable "%s"`, strings.Join(box.Substitution.IDA(), "."))
+					c.codeErrorf(d2ast.DIAGNOSTIC_UNDEFINED_VARIABLE, node.LastRef().AST(), `could not resolve variable "%s"`, strings.Join(box.Substitution.IDA(), "."))
 					return
 				}
 				if resolvedField.Primary() == nil && resolvedField.Composite != nil {
@@ -345,11 +423,10 @@ func (c *compiler) resolveSubstitutions(varsStack []*Map, node Node) (removedFie
 }
 
 func (c *compiler) resolveSubstitution(vars *Map, substitution *d2ast.Substitution) *Field {
-	if vars == nil {
-		return nil
-	}
-
 	for i, p := range substitution.Path {
+		if vars == nil {
+			return nil
+		}
 		f := vars.GetField(p.Unbox().ScalarString())
 		if f == nil {
 			return nil
@@ -464,8 +541,16 @@ func (c *compiler) compileMap(dst *Map, ast, scopeAST *d2ast.Map) {
 		return
 	}
 
+	c.compileNodes(dst, ast, scopeAST)
+}
+
+func (c *compiler) compileNodes(dst *Map, ast, scopeAST *d2ast.Map) {
 	for _, n := range ast.Nodes {
 		switch {
+		case n.MapKey != nil && isIf(n.MapKey):
+			if c.evalIf(dst, n.MapKey) {
+				c.compileNodes(dst, n.MapKey.Value.Map, scopeAST)
+			}
 		case n.MapKey != nil:
 			c.compileKey(&RefContext{
 				Key:      n.MapKey,
@@ -497,7 +582,7 @@ func (c *compiler) compileMap(dst *Map, ast, scopeAST *d2ast.Map) {
 				continue
 			}
 			if impn.Map() == nil {
-				c.errorf(n.Import, "cannot spread import non map into map")
+				c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, n.Import, "cannot spread import non map into map")
 				continue
 			}
 
@@ -555,6 +640,23 @@ func (c *compiler) ensureGlobContext(refctx *RefContext) *globContext {
 }
 
 func (c *compiler) compileKey(refctx *RefContext) {
+	if mk, ok := c.globFilterKey(refctx.Key); !ok {
+		return
+	} else if mk != refctx.Key {
+		refctx = refctx.Copy()
+		refctx.Key = mk
+	}
+	if mk, ghosts := c.crossBoardKey(refctx); mk != refctx.Key {
+		refctx = refctx.Copy()
+		refctx.Key = mk
+		c.compileKey(refctx)
+		for _, ghost := range ghosts {
+			refctx2 := refctx.Copy()
+			refctx2.Key = ghost
+			c.compileKey(refctx2)
+		}
+		return
+	}
 	if refctx.Key.HasGlob() {
 		// These printlns are for debugging infinite loops.
 		// println("og", refctx.Edge, refctx.Key, refctx.Scope, refctx.ScopeMap, refctx.ScopeAST)
@@ -572,14 +674,21 @@ func (c *compiler) compileKey(refctx *RefContext) {
 		}()
 		c.ensureGlobContext(refctx)
 	}
-	oldFields := refctx.ScopeMap.FieldCountRecursive()
-	oldEdges := refctx.ScopeMap.EdgeCountRecursive()
+	// Counting is linear in the size of the scope, so it's skipped while there are no globs
+	// to apply again, or else compiling every key of large files would be quadratic
+	hadGlobs := len(c.globContexts()) > 0
+	var oldFields, oldEdges int
+	if hadGlobs {
+		oldFields = refctx.ScopeMap.FieldCountRecursive()
+		oldEdges = refctx.ScopeMap.EdgeCountRecursive()
+	}
 	if len(refctx.Key.Edges) == 0 {
 		c.compileField(refctx.ScopeMap, refctx.Key.Key, refctx)
 	} else {
 		c.compileEdges(refctx)
 	}
-	if oldFields != refctx.ScopeMap.FieldCountRecursive() || oldEdges != refctx.ScopeMap.EdgeCountRecursive() {
+	// Globs first declared by the key, e.g. in its map, apply to what it created
+	if !hadGlobs && len(c.globContexts()) > 0 || hadGlobs && (oldFields != refctx.ScopeMap.FieldCountRecursive() || oldEdges != refctx.ScopeMap.EdgeCountRecursive()) {
 		for _, gctx2 := range c.globContexts() {
 			// println(d2format.Format(gctx2.refctx.Key), d2format.Format(refctx.Key))
 			old := c.lazyGlobBeingApplied
@@ -591,7 +700,7 @@ func (c *compiler) compileKey(refctx *RefContext) {
 }
 
 func (c *compiler) compileField(dst *Map, kp *d2ast.KeyPath, refctx *RefContext) {
-	if refctx.Key.Ampersand {
+	if refctx.Key.Ampersand || refctx.Key.NotAmpersand {
 		return
 	}
 
@@ -606,18 +715,120 @@ func (c *compiler) compileField(dst *Map, kp *d2ast.KeyPath, refctx *RefContext)
 	}
 }
 
+// globFilterKey rewrites mk if a glob in it is filtered in [] to the glob with the filters
+// in its map, so that *[shape=cylinder].style.fill: red compiles like
+//
+//	*: {
+//	  &shape: cylinder
+//	  style.fill: red
+//	}
+//
+// Globs after it are rewritten when that map is compiled.
+func (c *compiler) globFilterKey(mk *d2ast.Key) (*d2ast.Key, bool) {
+	if len(mk.Edges) > 0 || mk.EdgeKey != nil {
+		kps := []*d2ast.KeyPath{mk.Key, mk.EdgeKey}
+		for _, e := range mk.Edges {
+			kps = append(kps, e.Src, e.Dst)
+		}
+		for _, kp := range kps {
+			if globFilterIndex(kp) != -1 {
+				c.codeErrorf(d2ast.DIAGNOSTIC_SYNTAX, mk, "glob filters in [] cannot be used in edges")
+				return nil, false
+			}
+		}
+		return mk, true
+	}
+	i := globFilterIndex(mk.Key)
+	if i == -1 {
+		return mk, true
+	}
+
+	us := *mk.Key.Path[i].UnquotedString
+	us.Filters = nil
+	glob := &d2ast.KeyPath{
+		Range: mk.Key.Range,
+		Path:  append(append([]*d2ast.StringBox{}, mk.Key.Path[:i]...), &d2ast.StringBox{UnquotedString: &us}),
+	}
+	m := &d2ast.Map{Range: mk.Range}
+	for _, f := range mk.Key.Path[i].UnquotedString.Filters {
+		m.Nodes = append(m.Nodes, d2ast.MapNodeBox{MapKey: f})
+	}
+	if i < len(mk.Key.Path)-1 {
+		rest := mk.Copy()
+		rest.Ampersand = false
+		rest.NotAmpersand = false
+		rest.Key = &d2ast.KeyPath{
+			Range: mk.Key.Range,
+			Path:  mk.Key.Path[i+1:],
+		}
+		m.Nodes = append(m.Nodes, d2ast.MapNodeBox{MapKey: rest})
+	} else {
+		if mk.Primary.Null != nil || mk.Value.Null != nil {
+			c.errorf(mk, "globs filtered in [] cannot be set to null")
+			return nil, false
+		}
+		label := mk.Primary.Unbox()
+		if label == nil && mk.Value.Map == nil {
+			label = mk.Value.ScalarBox().Unbox()
+		}
+		if label != nil {
+			m.Nodes = append(m.Nodes, d2ast.MapNodeBox{MapKey: &d2ast.Key{
+				Range: mk.Range,
+				Key:   d2ast.MakeKeyPath([]string{"label"}),
+				Value: d2ast.MakeValueBox(label),
+			}})
+		}
+		if mk.Value.Map != nil {
+			m.Nodes = append(m.Nodes, mk.Value.Map.Nodes...)
+		}
+	}
+	return &d2ast.Key{
+		Range:        mk.Range,
+		Ampersand:    mk.Ampersand,
+		NotAmpersand: mk.NotAmpersand,
+		Key:          glob,
+		Value:        d2ast.MakeValueBox(m),
+	}, true
+}
+
+// globFilterIndex returns the index of the first element of kp filtered in [], or -1
+func globFilterIndex(kp *d2ast.KeyPath) int {
+	if kp == nil {
+		return -1
+	}
+	for i, sb := range kp.Path {
+		if sb.UnquotedString != nil && len(sb.UnquotedString.Filters) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
 func (c *compiler) ampersandFilter(refctx *RefContext) bool {
-	if !refctx.Key.Ampersand {
+	if !refctx.Key.Ampersand && !refctx.Key.NotAmpersand {
 		return true
 	}
 	if len(c.mapRefContextStack) == 0 || !c.mapRefContextStack[len(c.mapRefContextStack)-1].Key.SupportsGlobFilters() {
-		c.errorf(refctx.Key, "glob filters cannot be used outside globs")
+		c.codeErrorf(d2ast.DIAGNOSTIC_SYNTAX, refctx.Key, "glob filters cannot be used outside globs")
 		return false
 	}
 	if len(refctx.Key.Edges) > 0 {
 		return true
 	}
 
+	ok := c.matchAmpersandFilter(refctx)
+	if refctx.Key.NotAmpersand {
+		return !ok
+	}
+	return ok
+}
+
+// matchAmpersandFilter returns whether the field the filter in refctx is scoped to has the
+// value of the filter.
+func (c *compiler) matchAmpersandFilter(refctx *RefContext) bool {
+	if !c.checkAmpersandFilterValue(refctx) {
+		return false
+	}
 	fa, err := refctx.ScopeMap.EnsureField(refctx.Key.Key, refctx, false, c)
 	if err != nil {
 		c.err.Errors = append(c.err.Errors, err.(d2ast.Error))
@@ -672,9 +883,22 @@ func (c *compiler) ampersandFilter(refctx *RefContext) bool {
 	return true
 }
 
-func (c *compiler) _ampersandFilter(f *Field, refctx *RefContext) bool {
+// checkAmpersandFilterValue reports whether the filter in refctx has a scalar value to match
+// against, erroring if it doesn't.
+func (c *compiler) checkAmpersandFilterValue(refctx *RefContext) bool {
+	if refctx.Key.Value.Unbox() == nil {
+		c.codeErrorf(d2ast.DIAGNOSTIC_SYNTAX, refctx.Key, "glob filters need a value")
+		return false
+	}
 	if refctx.Key.Value.ScalarBox().Unbox() == nil {
-		c.errorf(refctx.Key, "glob filters cannot be composites")
+		c.codeErrorf(d2ast.DIAGNOSTIC_SYNTAX, refctx.Key, "glob filters cannot be composites")
+		return false
+	}
+	return true
+}
+
+func (c *compiler) _ampersandFilter(f *Field, refctx *RefContext) bool {
+	if !c.checkAmpersandFilterValue(refctx) {
 		return false
 	}
 
@@ -715,7 +939,7 @@ func (c *compiler) _compileField(f *Field, refctx *RefContext) {
 		}
 	}
 
-	if len(refctx.Key.Edges) == 0 && (refctx.Key.Primary.Null != nil || refctx.Key.Value.Null != nil) {
+	if (len(refctx.Key.Edges) == 0 || refctx.Key.EdgeKey != nil) && (refctx.Key.Primary.Null != nil || refctx.Key.Value.Null != nil) {
 		// For vars, if we delete the field, it may just resolve to an outer scope var of the same name
 		// Instead we keep it around, so that resolveSubstitutions can find it
 		if !IsVar(ParentMap(f)) {
@@ -776,6 +1000,11 @@ func (c *compiler) _compileField(f *Field, refctx *RefContext) {
 		case BoardScenario, BoardStep:
 			c.overlayClasses(f.Map())
 		}
+	} else if icon, ok := c.iconImport(f, refctx.Key.Value.Import); ok {
+		f.Primary_ = &Scalar{
+			parent: f,
+			Value:  icon,
+		}
 	} else if refctx.Key.Value.Import != nil {
 		n, ok := c._import(refctx.Key.Value.Import)
 		if !ok {
@@ -825,7 +1054,8 @@ func (c *compiler) _compileField(f *Field, refctx *RefContext) {
 			Value:  refctx.Key.Value.ScalarBox().Unbox(),
 		}
 		// If the link is a board, we need to transform it into an absolute path.
-		if f.Name == "link" {
+		// Embedded boards always are.
+		if f.Name == "link" || f.Name == "board" {
 			c.compileLink(f, refctx)
 		}
 	}
@@ -845,7 +1075,7 @@ func (c *compiler) ignoreLazyGlob(n Node) bool {
 
 func (c *compiler) updateLinks(m *Map) {
 	for _, f := range m.Fields {
-		if f.Name == "link" {
+		if (f.Name == "link" || f.Name == "board") && f.Primary() != nil {
 			val := f.Primary().Value.ScalarString()
 			link, err := d2parser.ParseKey(val)
 			if err != nil {
@@ -995,7 +1225,8 @@ func (c *compiler) compileEdges(refctx *RefContext) {
 func (c *compiler) _compileEdges(refctx *RefContext) {
 	eida := NewEdgeIDs(refctx.Key)
 	for i, eid := range eida {
-		if !eid.Glob && (refctx.Key.Primary.Null != nil || refctx.Key.Value.Null != nil) {
+		// (x -> y)[0].style.stroke: null deletes the attribute, not the edge
+		if !eid.Glob && refctx.Key.EdgeKey == nil && (refctx.Key.Primary.Null != nil || refctx.Key.Value.Null != nil) {
 			refctx.ScopeMap.DeleteEdge(eid)
 			continue
 		}
@@ -1013,7 +1244,7 @@ func (c *compiler) _compileEdges(refctx *RefContext) {
 				continue
 			}
 			for _, e := range ea {
-				if refctx.Key.Primary.Null != nil || refctx.Key.Value.Null != nil {
+				if refctx.Key.EdgeKey == nil && (refctx.Key.Primary.Null != nil || refctx.Key.Value.Null != nil) {
 					refctx.ScopeMap.DeleteEdge(e.ID)
 					continue
 				}
@@ -1074,7 +1305,79 @@ func (c *compiler) _compileEdges(refctx *RefContext) {
 					}
 				}
 			}
+			c.redirectEdge(e)
+		}
+	}
+}
+
+// redirectEdge moves an endpoint of e to the object given by its source or target keyword, e.g.
+//
+//	(a -> b)[0].target: c
+//
+// turns the connection into a -> c while keeping its label and styles. The keywords are
+// consumed here so later references, including in child boards, use the new endpoints.
+func (c *compiler) redirectEdge(e *Edge) {
+	if e.Map_ == nil {
+		return
+	}
+	for _, keyword := range []string{"source", "target"} {
+		f := e.Map_.GetField(keyword)
+		if f == nil {
+			continue
+		}
+		e.Map_.DeleteField(keyword)
+		if f.Primary_ == nil || f.Composite != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.LastRef().AST(), "%s must be set to the path of an object", keyword)
+			continue
+		}
+		kp, err := d2parser.ParseKey(f.Primary_.Value.ScalarString())
+		if err != nil || kp.HasGlob() {
+			c.codeErrorf(d2ast.DIAGNOSTIC_INVALID_VALUE, f.Primary_.Value, "%s must be set to the path of an object", keyword)
+			continue
+		}
+		ida := kp.IDA()
+		if findProhibitedEdgeKeyword(ida...) != -1 || findBoardKeyword(ida...) != -1 {
+			c.codeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, f.Primary_.Value, "reserved keywords are prohibited in edges")
+			continue
+		}
+
+		m := ParentMap(e)
+		fa, err := m.EnsureField(kp, nil, true, c)
+		if err != nil {
+			c.err.Errors = append(c.err.Errors, err.(d2ast.Error))
+			continue
+		}
+
+		oldID := e.ID
+		eid := e.ID.Copy()
+		if keyword == "source" {
+			eid.SrcPath = RelIDA(m, fa[0])
+		} else {
+			eid.DstPath = RelIDA(m, fa[0])
+		}
+		e.ID = eid
+		// The edge index is keyed by the endpoints of edges, so it's rebuilt with e's new ones
+		m.edgeIndex = sliceindex.Index[string, *Edge]{}
+		// The graph indexes connections between the same objects in declaration order,
+		// so both the old and new endpoints are renumbered to match
+		m.reindexEdges(oldID)
+		m.reindexEdges(eid)
+	}
+}
+
+func (m *Map) reindexEdges(eid *EdgeID) {
+	eid = eid.Copy()
+	eid.Index = nil
+	eid.Glob = true
+	index := 0
+	for _, e := range m.Edges {
+		if !e.ID.Match(eid) {
+			continue
 		}
+		i := index
+		e.ID = e.ID.Copy()
+		e.ID.Index = &i
+		index++
 	}
 }
 
@@ -1109,7 +1412,7 @@ func (c *compiler) compileArray(dst *Array, a *d2ast.Array, scopeAST *d2ast.Map)
 				if v.Spread {
 					a, ok := n.Composite.(*Array)
 					if !ok {
-						c.errorf(v, "can only spread import array into array")
+						c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, v, "can only spread import array into array")
 						continue
 					}
 					dst.Values = append(dst.Values, a.Values...)
@@ -1122,7 +1425,7 @@ func (c *compiler) compileArray(dst *Array, a *d2ast.Array, scopeAST *d2ast.Map)
 				}
 			case *Map:
 				if v.Spread {
-					c.errorf(v, "can only spread import array into array")
+					c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, v, "can only spread import array into array")
 					continue
 				}
 				irv = n
@@ -28,6 +28,7 @@ func TestCompile(t *testing.T) {
 	t.Run("imports", testCompileImports)
 	t.Run("patterns", testCompilePatterns)
 	t.Run("filters", testCompileFilters)
+	t.Run("ifs", testCompileIfs)
 }
 
 type testCase struct {
@@ -334,6 +335,26 @@ layers: {
 				assertQuery(t, m, 3, 0, nil, "layers.bingo")
 			},
 		},
+		{
+			name: "cross_board_edge",
+			run: func(t testing.TB) {
+				m, err := compile(t, `a -> layers.infra.db
+b -> layers.infra
+layers: {
+	infra: { db }
+}`)
+				assert.Success(t, err)
+
+				assertQuery(t, m, 0, 0, nil, `(a -> "layers.infra.db")[0]`)
+				assertQuery(t, m, 0, 0, nil, `(b -> "layers.infra")[0]`)
+				assertQuery(t, m, 0, 0, "db", `"layers.infra.db".label`)
+				assertQuery(t, m, 0, 0, "root.layers.infra", `"layers.infra.db".link`)
+				assertQuery(t, m, 0, 0, "3", `"layers.infra.db".style.stroke-dash`)
+				assertQuery(t, m, 0, 0, "infra", `"layers.infra".label`)
+				assertQuery(t, m, 0, 0, "root.layers.infra", `"layers.infra".link`)
+				assertQuery(t, m, 1, 0, nil, "layers.infra")
+			},
+		},
 	}
 	runa(t, tca)
 	t.Run("errs", func(t *testing.T) {
@@ -343,7 +364,8 @@ layers: {
 				name: "1/bad_edge",
 				run: func(t testing.TB) {
 					_, err := compile(t, `layers.x -> layers.y`)
-					assert.ErrorString(t, err, `TestCompile/layers/errs/1/bad_edge.d2:1:1: cannot create edges between boards`)
+					assert.ErrorString(t, err, `TestCompile/layers/errs/1/bad_edge.d2:1:1: edge to another board ends at layers.x, which doesn't exist
+TestCompile/layers/errs/1/bad_edge.d2:1:13: edge to another board ends at layers.y, which doesn't exist`)
 				},
 			},
 			{
@@ -357,7 +379,8 @@ layers: {
 				name: "3/bad_edge",
 				run: func(t testing.TB) {
 					_, err := compile(t, `layers.x.y -> steps.z.p`)
-					assert.ErrorString(t, err, `TestCompile/layers/errs/3/bad_edge.d2:1:1: cannot create edges between boards`)
+					assert.ErrorString(t, err, `TestCompile/layers/errs/3/bad_edge.d2:1:1: edge to another board ends at layers.x.y, which doesn't exist
+TestCompile/layers/errs/3/bad_edge.d2:1:15: edge to another board ends at steps.z.p, which doesn't exist`)
 				},
 			},
 			{
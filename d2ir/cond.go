@@ -0,0 +1,109 @@
+package d2ir
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+)
+
+// isIf returns whether k is an if, like if: env == prod { ... }, whose map is only compiled
+// when its condition holds. Only an unquoted if with both a condition and a map is one, so that
+// shapes named if, as in flowcharts, still compile, and "if" can always be quoted to be a shape.
+func isIf(k *d2ast.Key) bool {
+	return k.Key != nil && len(k.Key.Path) == 1 && len(k.Edges) == 0 &&
+		k.Primary.Unbox() != nil && k.Value.Map != nil &&
+		k.Key.Path[0].UnquotedString != nil &&
+		strings.EqualFold(k.Key.Path[0].Unbox().ScalarString(), "if")
+}
+
+// evalIf returns whether the condition of the if k in m holds. Conditions compare a var to a
+// value with == or !=, like env == prod, or are a var alone, which holds unless it's empty,
+// false or 0. Vars are looked up in the defines and then the vars of m and the maps it's in,
+// so only vars set before the if are seen.
+func (c *compiler) evalIf(m *Map, k *d2ast.Key) bool {
+	cond := k.Primary.Unbox().ScalarString()
+
+	name, op, want := cond, "", ""
+	for _, op2 := range []string{"==", "!="} {
+		if i := strings.Index(cond, op2); i != -1 {
+			name, op, want = cond[:i], op2, cond[i+len(op2):]
+			break
+		}
+	}
+	name = strings.TrimSpace(name)
+	want = strings.Trim(strings.TrimSpace(want), `"'`)
+	if name == "" || (op != "" && want == "") {
+		c.errorf(k.Primary.Unbox(), "invalid if condition %q, expected a var compared to a value like env == prod", cond)
+		return false
+	}
+
+	v, ok := c.lookupVar(m, name)
+	if !ok {
+		c.codeErrorf(d2ast.DIAGNOSTIC_UNDEFINED_VARIABLE, k.Primary.Unbox(), `could not resolve variable "%s"`, name)
+		return false
+	}
+	switch op {
+	case "==":
+		return v == want
+	case "!=":
+		return v != want
+	default:
+		b, err := strconv.ParseBool(v)
+		return v != "" && (err != nil || b)
+	}
+}
+
+func (c *compiler) lookupVar(m *Map, name string) (string, bool) {
+	if v, ok := c.defines[name]; ok {
+		return v, true
+	}
+	ida := strings.Split(name, ".")
+	for ; m != nil; m = ParentMap(m) {
+		vars := m.GetField("vars")
+		if vars == nil || vars.Map() == nil {
+			continue
+		}
+		f := vars.Map().GetField(ida...)
+		if f != nil && f.Primary() != nil {
+			return f.Primary().Value.ScalarString(), true
+		}
+	}
+	return "", false
+}
+
+// compileDefines sets the vars of m, the root board, to the defines
+func (c *compiler) compileDefines(m *Map, ast *d2ast.Map) {
+	if len(c.defines) == 0 {
+		return
+	}
+	names := make([]string, 0, len(c.defines))
+	for name := range c.defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vars := &d2ast.Map{}
+	for _, name := range names {
+		vars.Nodes = append(vars.Nodes, d2ast.MapNodeBox{
+			MapKey: &d2ast.Key{
+				Key:   d2ast.MakeKeyPath(strings.Split(name, ".")),
+				Value: d2ast.MakeValueBox(d2ast.RawString(c.defines[name], false)),
+			},
+		})
+	}
+	// Globs don't apply to vars
+	c.globContextStack = append(c.globContextStack, nil)
+	defer func() {
+		c.globContextStack = c.globContextStack[:len(c.globContextStack)-1]
+	}()
+	c.compileKey(&RefContext{
+		Key: &d2ast.Key{
+			Key:   d2ast.MakeKeyPath([]string{"vars"}),
+			Value: d2ast.MakeValueBox(vars),
+		},
+		Scope:    ast,
+		ScopeMap: m,
+		ScopeAST: ast,
+	})
+}
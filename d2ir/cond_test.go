@@ -0,0 +1,142 @@
+package d2ir_test
+
+import (
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2ir"
+	"oss.terrastruct.com/d2/d2parser"
+)
+
+func testCompileIfs(t *testing.T) {
+	t.Parallel()
+
+	tca := []testCase{
+		{
+			name: "vars",
+			run: func(t testing.TB) {
+				m, err := compile(t, `vars: {
+  env: staging
+  debug: true
+}
+api
+if: env == prod {
+  cdn -> api
+}
+if: env != prod {
+  api.label: API (${env})
+}
+if: debug {
+  logs
+}`)
+				assert.Success(t, err)
+				assertQuery(t, m, 6, 0, nil, "")
+				assertQuery(t, m, 0, 0, "API (staging)", "api.label")
+				assertQuery(t, m, 0, 0, nil, "logs")
+			},
+		},
+		{
+			name: "defines",
+			run: func(t testing.TB) {
+				m, err := compileDefines(t, `vars: {
+  env: staging
+}
+api: ${env}
+if: env == prod {
+  cdn -> api
+  cdn: {
+    if: region == "eu" {
+      shape: cloud
+    }
+  }
+}`, map[string]string{
+					"env":    "prod",
+					"region": "eu",
+				})
+				assert.Success(t, err)
+				assertQuery(t, m, 6, 1, nil, "")
+				assertQuery(t, m, 0, 0, "prod", "api")
+				assertQuery(t, m, 0, 0, "cloud", "cdn.shape")
+			},
+		},
+		{
+			name: "nested_vars",
+			run: func(t testing.TB) {
+				m, err := compile(t, `vars: {
+  env: prod
+}
+x: {
+  vars: {
+    env: staging
+  }
+  if: env == staging {
+    y
+  }
+}`)
+				assert.Success(t, err)
+				assertQuery(t, m, 0, 0, nil, "x.y")
+			},
+		},
+		{
+			name: "shapes_named_if",
+			run: func(t testing.TB) {
+				m, err := compile(t, `if
+if -> then
+if: Is it ok?
+if: {
+  shape: diamond
+}
+"if": Is it ok? {
+  style.bold: true
+}`)
+				assert.Success(t, err)
+				assertQuery(t, m, 5, 1, nil, "")
+				assertQuery(t, m, 3, 0, "Is it ok?", "if")
+				assertQuery(t, m, 0, 0, "diamond", "if.shape")
+				assertQuery(t, m, 0, 0, true, "if.style.bold")
+			},
+		},
+	}
+
+	runa(t, tca)
+
+	t.Run("errors", func(t *testing.T) {
+		tca := []testCase{
+			{
+				name: "undefined",
+				run: func(t testing.TB) {
+					_, err := compile(t, `if: env == prod {
+  x
+}`)
+					assert.ErrorString(t, err, `TestCompile/ifs/errors/undefined.d2:1:5: could not resolve variable "env"`)
+				},
+			},
+			{
+				name: "invalid",
+				run: func(t testing.TB) {
+					_, err := compile(t, `vars: { env: prod }
+if: env == {
+  x
+}`)
+					assert.ErrorString(t, err, `TestCompile/ifs/errors/invalid.d2:2:5: invalid if condition "env ==", expected a var compared to a value like env == prod`)
+				},
+			},
+		}
+		runa(t, tca)
+	})
+}
+
+func compileDefines(t testing.TB, text string, defines map[string]string) (*d2ir.Map, error) {
+	t.Helper()
+
+	ast, err := d2parser.Parse("index.d2", strings.NewReader(text), nil)
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := d2ir.Compile(ast, &d2ir.CompileOptions{
+		Defines: defines,
+	})
+	return m, err
+}
@@ -0,0 +1,135 @@
+package d2ir
+
+import (
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// crossBoardTarget is an object or board on another board that a ghost stands in for. It
+// must exist once everything is compiled.
+type crossBoardTarget struct {
+	scope *Map
+	ida   []string
+	kp    *d2ast.KeyPath
+}
+
+// crossBoardKey rewrites the endpoints of the edges of mk that are on other boards than the
+// edge, like a -> layers.infra.db, to ghosts: objects on the board of the edge that stand in
+// for them and link to their board. The ghost of layers.infra.db has the ID
+// "layers.infra.db", is labeled db and is dashed. Endpoints that are boards themselves, like
+// layers.infra, get ghosts too.
+//
+// It returns the rewritten key and the keys that style the ghosts, to be compiled after the
+// edges create them.
+func (c *compiler) crossBoardKey(refctx *RefContext) (*d2ast.Key, []*d2ast.Key) {
+	mk := refctx.Key
+	if len(mk.Edges) == 0 || mk.Key != nil {
+		return mk, nil
+	}
+	var mk2 *d2ast.Key
+	var ghosts []*d2ast.Key
+	for i, e := range mk.Edges {
+		src, dst := e.Src, e.Dst
+		srcBoard := crossBoardPrefix(src)
+		dstBoard := crossBoardPrefix(dst)
+		if strings.Join(srcBoard, ".") == strings.Join(dstBoard, ".") {
+			continue
+		}
+		if mk2 == nil {
+			tmp := *mk
+			mk2 = &tmp
+			mk2.Edges = append([]*d2ast.Edge(nil), mk.Edges...)
+		}
+		e2 := *e
+		create := mk.EdgeIndex == nil && mk.Primary.Null == nil && mk.Value.Null == nil
+		if len(srcBoard) > 0 {
+			var ghost *d2ast.Key
+			e2.Src, ghost = c.crossBoardGhost(refctx, src, srcBoard, create)
+			if ghost != nil {
+				ghosts = append(ghosts, ghost)
+			}
+		}
+		if len(dstBoard) > 0 {
+			var ghost *d2ast.Key
+			e2.Dst, ghost = c.crossBoardGhost(refctx, dst, dstBoard, create)
+			if ghost != nil {
+				ghosts = append(ghosts, ghost)
+			}
+		}
+		mk2.Edges[i] = &e2
+	}
+	if mk2 == nil {
+		return mk, nil
+	}
+	return mk2, ghosts
+}
+
+// crossBoardPrefix returns the path of the board the endpoint kp is on from the board of its
+// edge, like layers.infra for layers.infra.db, or nil if it's on the same board.
+func crossBoardPrefix(kp *d2ast.KeyPath) []string {
+	if kp == nil || kp.HasGlob() {
+		return nil
+	}
+	ida := kp.IDA()
+	n := 0
+	for i := 0; i+1 < len(ida); i += 2 {
+		if _, ok := d2graph.BoardKeywords[ida[i]]; !ok {
+			break
+		}
+		n = i + 2
+	}
+	return ida[:n]
+}
+
+// crossBoardGhost returns the path of the ghost of the endpoint kp on board, and if create
+// is set, the key that styles it. The endpoint must exist once everything is compiled.
+func (c *compiler) crossBoardGhost(refctx *RefContext, kp *d2ast.KeyPath, board []string, create bool) (*d2ast.KeyPath, *d2ast.Key) {
+	ida := kp.IDA()
+	id := d2format.Format(kp)
+	ghostKP := &d2ast.KeyPath{
+		Range: kp.Range,
+		Path:  []*d2ast.StringBox{d2ast.MakeValueBox(d2ast.RawString(id, true)).StringBox()},
+	}
+	if !create {
+		return ghostKP, nil
+	}
+	c.crossBoardTargets = append(c.crossBoardTargets, crossBoardTarget{
+		scope: refctx.ScopeMap,
+		ida:   ida,
+		kp:    kp,
+	})
+
+	m := &d2ast.Map{Range: kp.Range}
+	for _, attr := range []struct {
+		key   []string
+		value string
+	}{
+		{[]string{"label"}, ida[len(ida)-1]},
+		{[]string{"link"}, d2format.Format(d2ast.MakeKeyPath(board))},
+		{[]string{"style", "stroke-dash"}, "3"},
+	} {
+		m.Nodes = append(m.Nodes, d2ast.MapNodeBox{MapKey: &d2ast.Key{
+			Range: kp.Range,
+			Key:   d2ast.MakeKeyPath(attr.key),
+			Value: d2ast.MakeValueBox(d2ast.FlatUnquotedString(attr.value)),
+		}})
+	}
+	return ghostKP, &d2ast.Key{
+		Range: kp.Range,
+		Key:   ghostKP,
+		Value: d2ast.MakeValueBox(m),
+	}
+}
+
+// validateCrossBoardTargets checks that what the ghosts of cross-board edges stand in for
+// exists.
+func (c *compiler) validateCrossBoardTargets() {
+	for _, t := range c.crossBoardTargets {
+		if t.scope.GetField(t.ida...) == nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_BOARD_NOT_FOUND, t.kp, "edge to another board ends at %s, which doesn't exist", d2format.Format(t.kp))
+		}
+	}
+}
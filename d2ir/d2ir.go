@@ -14,6 +14,7 @@ import (
 	"oss.terrastruct.com/d2/d2graph"
 	"oss.terrastruct.com/d2/d2parser"
 	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/sliceindex"
 )
 
 // Most errors returned by a node should be created with d2parser.Errorf
@@ -172,6 +173,11 @@ type Map struct {
 	Edges  []*Edge  `json:"edges"`
 
 	globs []*globContext
+
+	// fieldIndex and edgeIndex look up the fields and edges of maps with many of them, see
+	// lookupField and lookupEdges
+	fieldIndex sliceindex.Index[string, *Field]
+	edgeIndex  sliceindex.Index[string, *Edge]
 }
 
 func (m *Map) initRoot() {
@@ -416,6 +422,9 @@ func (eid *EdgeID) resolve(m *Map) (_ *EdgeID, _ *Map, common []string, _ error)
 	eid = eid.Copy()
 	maxUnderscores := go2.Max(countUnderscores(eid.SrcPath), countUnderscores(eid.DstPath))
 	for i := 0; i < maxUnderscores; i++ {
+		if len(eid.SrcPath) == 0 || len(eid.DstPath) == 0 {
+			return nil, nil, nil, errors.New("invalid underscore")
+		}
 		if eid.SrcPath[0] == "_" {
 			eid.SrcPath = eid.SrcPath[1:]
 		} else {
@@ -433,6 +442,9 @@ func (eid *EdgeID) resolve(m *Map) (_ *EdgeID, _ *Map, common []string, _ error)
 			return nil, nil, nil, errors.New("invalid underscore")
 		}
 	}
+	if len(eid.SrcPath) == 0 || len(eid.DstPath) == 0 {
+		return nil, nil, nil, errors.New("invalid underscore")
+	}
 
 	for len(eid.SrcPath) > 1 && len(eid.DstPath) > 1 {
 		if !strings.EqualFold(eid.SrcPath[0], eid.DstPath[0]) || eid.SrcPath[0] == "*" {
@@ -684,16 +696,15 @@ func (m *Map) getField(ida []string) *Field {
 		return nil
 	}
 
-	for _, f := range m.Fields {
-		if !strings.EqualFold(f.Name, s) {
-			continue
-		}
-		if len(rest) == 0 {
-			return f
-		}
-		if f.Map() != nil {
-			return f.Map().getField(rest)
-		}
+	f := m.lookupField(s)
+	if f == nil {
+		return nil
+	}
+	if len(rest) == 0 {
+		return f
+	}
+	if f.Map() != nil {
+		return f.Map().getField(rest)
 	}
 	return nil
 }
@@ -820,10 +831,17 @@ func (m *Map) ensureField(i int, kp *d2ast.KeyPath, refctx *RefContext, create b
 		if _, ok := d2graph.CompositeReservedKeywords[head]; !ok && i < len(kp.Path)-1 {
 			return d2parser.Errorf(kp.Path[i].Unbox(), fmt.Sprintf(`"%s" must be the last part of the key`, head))
 		}
+		// near only holds the options of where to be near an object
+		if head == "near" && i < len(kp.Path)-1 {
+			next := strings.ToLower(kp.Path[i+1].Unbox().ScalarString())
+			if next != "side" && next != "gap" {
+				return d2parser.Errorf(kp.Path[i].Unbox(), fmt.Sprintf(`"%s" must be the last part of the key`, head))
+			}
+		}
 	}
 
 	if head == "_" {
-		return d2parser.Errorf(kp.Path[i].Unbox(), `parent "_" can only be used in the beginning of paths, e.g. "_.x"`)
+		return d2parser.CodeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, kp.Path[i].Unbox(), `parent "_" can only be used in the beginning of paths, e.g. "_.x"`)
 	}
 
 	if head == "classes" && NodeBoardKind(m) == "" {
@@ -834,11 +852,7 @@ func (m *Map) ensureField(i int, kp *d2ast.KeyPath, refctx *RefContext, create b
 		return d2parser.Errorf(kp.Path[i].Unbox(), "%s is only allowed at a board root", head)
 	}
 
-	for _, f := range m.Fields {
-		if !strings.EqualFold(f.Name, head) {
-			continue
-		}
-
+	if f := m.lookupField(head); f != nil {
 		// Don't add references for fake common KeyPath from trimCommon in CreateEdge.
 		if refctx != nil {
 			f.References = append(f.References, &FieldReference{
@@ -949,7 +963,13 @@ func (m *Map) DeleteField(ida ...string) *Field {
 			continue
 		}
 		if len(rest) == 0 {
+			// Connections to the field are deleted with it.
+			// Fields of a connection, like its style, share the connection's references,
+			// so deleting them must leave the connection alone.
 			for _, fr := range f.References {
+				if ParentEdge(f) != nil {
+					break
+				}
 				currM := m
 				for currM != nil {
 					for _, e := range currM.Edges {
@@ -1017,13 +1037,7 @@ func (m *Map) GetEdges(eid *EdgeID, refctx *RefContext, c *compiler) []*Edge {
 		return nil
 	}
 
-	var ea []*Edge
-	for _, e := range m.Edges {
-		if e.ID.Match(eid) {
-			ea = append(ea, e)
-		}
-	}
-	return ea
+	return m.lookupEdges(eid)
 }
 
 func (m *Map) getEdges(eid *EdgeID, refctx *RefContext, gctx *globContext, ea *[]*Edge) error {
@@ -1163,7 +1177,7 @@ func (m *Map) createEdge(eid *EdgeID, refctx *RefContext, gctx *globContext, c *
 
 	ij := findProhibitedEdgeKeyword(eid.SrcPath...)
 	if ij != -1 {
-		return d2parser.Errorf(refctx.Edge.Src.Path[ij].Unbox(), "reserved keywords are prohibited in edges")
+		return d2parser.CodeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, refctx.Edge.Src.Path[ij].Unbox(), "reserved keywords are prohibited in edges")
 	}
 	ij = findBoardKeyword(eid.SrcPath...)
 	if ij == len(eid.SrcPath)-1 {
@@ -1172,7 +1186,7 @@ func (m *Map) createEdge(eid *EdgeID, refctx *RefContext, gctx *globContext, c *
 
 	ij = findProhibitedEdgeKeyword(eid.DstPath...)
 	if ij != -1 {
-		return d2parser.Errorf(refctx.Edge.Dst.Path[ij].Unbox(), "reserved keywords are prohibited in edges")
+		return d2parser.CodeErrorf(d2ast.DIAGNOSTIC_MISPLACED_KEYWORD, refctx.Edge.Dst.Path[ij].Unbox(), "reserved keywords are prohibited in edges")
 	}
 	ij = findBoardKeyword(eid.DstPath...)
 	if ij == len(eid.DstPath)-1 {
@@ -0,0 +1,247 @@
+package d2ir
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"oss.terrastruct.com/d2/d2ast"
+)
+
+// resolveExpression computes the expression of subst, like ${base-width * 2}, with the vars
+// in varsStack. It returns a field with the result as its value.
+//
+// Expressions are numbers, quoted strings and vars combined with + - * / % and parentheses.
+// + concatenates when either side isn't a number.
+func (c *compiler) resolveExpression(varsStack []*Map, node Node, subst *d2ast.Substitution) (*Field, bool) {
+	e := &exprParser{
+		s: subst.Expression,
+		lookup: func(name string) (string, error) {
+			ida := strings.Split(name, ".")
+			for _, vars := range varsStack {
+				f := c.resolveSubstitution(vars, &d2ast.Substitution{Path: d2ast.MakeKeyPath(ida).Path})
+				if f == nil {
+					continue
+				}
+				if f.Primary() == nil {
+					return "", fmt.Errorf("cannot use composite variable %q in an expression", name)
+				}
+				return f.Primary().Value.ScalarString(), nil
+			}
+			return "", fmt.Errorf("could not resolve variable %q", name)
+		},
+	}
+	v, err := e.parse()
+	if err != nil {
+		c.errorf(node.LastRef().AST(), "failed to compute ${%s}: %v", subst.Expression, err)
+		return nil, false
+	}
+
+	f := &Field{}
+	if v.isNum {
+		raw := v.String()
+		r, _ := new(big.Rat).SetString(raw)
+		f.Primary_ = &Scalar{parent: f, Value: &d2ast.Number{Raw: raw, Value: r}}
+	} else {
+		f.Primary_ = &Scalar{parent: f, Value: d2ast.FlatUnquotedString(v.s)}
+	}
+	return f, true
+}
+
+type exprValue struct {
+	s     string
+	num   float64
+	isNum bool
+}
+
+func (v exprValue) String() string {
+	if v.isNum {
+		return strconv.FormatFloat(v.num, 'f', -1, 64)
+	}
+	return v.s
+}
+
+// exprParser parses and computes an expression by recursive descent:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%") unary }
+//	unary   = "-" unary | primary
+//	primary = number | string | var | "(" expr ")"
+type exprParser struct {
+	s      string
+	i      int
+	lookup func(name string) (string, error)
+}
+
+func (e *exprParser) parse() (exprValue, error) {
+	v, err := e.expr()
+	if err != nil {
+		return exprValue{}, err
+	}
+	e.skipSpace()
+	if e.i < len(e.s) {
+		return exprValue{}, fmt.Errorf("unexpected %q", e.s[e.i:])
+	}
+	return v, nil
+}
+
+func (e *exprParser) skipSpace() {
+	for e.i < len(e.s) && (e.s[e.i] == ' ' || e.s[e.i] == '\t') {
+		e.i++
+	}
+}
+
+// op reads the next rune if it's one of ops
+func (e *exprParser) op(ops string) (byte, bool) {
+	e.skipSpace()
+	if e.i < len(e.s) && strings.IndexByte(ops, e.s[e.i]) != -1 {
+		e.i++
+		return e.s[e.i-1], true
+	}
+	return 0, false
+}
+
+func (e *exprParser) expr() (exprValue, error) {
+	a, err := e.term()
+	if err != nil {
+		return a, err
+	}
+	for {
+		op, ok := e.op("+-")
+		if !ok {
+			return a, nil
+		}
+		b, err := e.term()
+		if err != nil {
+			return a, err
+		}
+		if op == '+' && (!a.isNum || !b.isNum) {
+			a = exprValue{s: a.String() + b.String()}
+			continue
+		}
+		x, y, err := numbers(a, b)
+		if err != nil {
+			return a, err
+		}
+		if op == '+' {
+			a = exprValue{num: x + y, isNum: true}
+		} else {
+			a = exprValue{num: x - y, isNum: true}
+		}
+	}
+}
+
+func (e *exprParser) term() (exprValue, error) {
+	a, err := e.unary()
+	if err != nil {
+		return a, err
+	}
+	for {
+		op, ok := e.op("*/%")
+		if !ok {
+			return a, nil
+		}
+		b, err := e.unary()
+		if err != nil {
+			return a, err
+		}
+		x, y, err := numbers(a, b)
+		if err != nil {
+			return a, err
+		}
+		switch op {
+		case '*':
+			a = exprValue{num: x * y, isNum: true}
+		case '/', '%':
+			if y == 0 {
+				return a, fmt.Errorf("division by zero")
+			}
+			if op == '/' {
+				a = exprValue{num: x / y, isNum: true}
+			} else {
+				a = exprValue{num: math.Mod(x, y), isNum: true}
+			}
+		}
+	}
+}
+
+func (e *exprParser) unary() (exprValue, error) {
+	if _, ok := e.op("-"); ok {
+		v, err := e.unary()
+		if err != nil {
+			return v, err
+		}
+		x, _, err := numbers(v, exprValue{isNum: true})
+		if err != nil {
+			return v, err
+		}
+		return exprValue{num: -x, isNum: true}, nil
+	}
+	return e.primary()
+}
+
+func (e *exprParser) primary() (exprValue, error) {
+	e.skipSpace()
+	if e.i == len(e.s) {
+		return exprValue{}, fmt.Errorf("unexpected end of expression")
+	}
+	switch r := e.s[e.i]; {
+	case r == '(':
+		e.i++
+		v, err := e.expr()
+		if err != nil {
+			return v, err
+		}
+		if _, ok := e.op(")"); !ok {
+			return v, fmt.Errorf("missing )")
+		}
+		return v, nil
+	case r == '"' || r == '\'':
+		end := strings.IndexByte(e.s[e.i+1:], r)
+		if end == -1 {
+			return exprValue{}, fmt.Errorf("unterminated string")
+		}
+		s := e.s[e.i+1 : e.i+1+end]
+		e.i += end + 2
+		return exprValue{s: s}, nil
+	case r == '.' || unicode.IsDigit(rune(r)):
+		start := e.i
+		for e.i < len(e.s) && (e.s[e.i] == '.' || unicode.IsDigit(rune(e.s[e.i]))) {
+			e.i++
+		}
+		num, err := strconv.ParseFloat(e.s[start:e.i], 64)
+		if err != nil {
+			return exprValue{}, fmt.Errorf("invalid number %q", e.s[start:e.i])
+		}
+		return exprValue{num: num, isNum: true}, nil
+	}
+
+	// Var names can contain -, so it only subtracts after a space
+	start := e.i
+	for e.i < len(e.s) && !strings.ContainsRune(" \t+*/%()", rune(e.s[e.i])) {
+		e.i++
+	}
+	if start == e.i {
+		return exprValue{}, fmt.Errorf("unexpected %q", e.s[e.i:])
+	}
+	v, err := e.lookup(e.s[start:e.i])
+	if err != nil {
+		return exprValue{}, err
+	}
+	if num, err := strconv.ParseFloat(v, 64); err == nil {
+		return exprValue{s: v, num: num, isNum: true}, nil
+	}
+	return exprValue{s: v}, nil
+}
+
+func numbers(a, b exprValue) (float64, float64, error) {
+	for _, v := range []exprValue{a, b} {
+		if !v.isNum {
+			return 0, 0, fmt.Errorf("%q isn't a number", v.s)
+		}
+	}
+	return a.num, b.num, nil
+}
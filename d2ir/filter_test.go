@@ -225,6 +225,76 @@ classes: {
 				assertQuery(t, m, 9, 3, nil, "")
 			},
 		},
+		{
+			name: "not",
+			run: func(t testing.TB) {
+				m, err := compile(t, `jacob: {
+	shape: circle
+}
+jeremy: {
+	shape: rectangle
+}
+*: {
+	!&shape: rectangle
+	label: I'm not a rectangle
+}`)
+				assert.Success(t, err)
+				assertQuery(t, m, 5, 0, nil, "")
+				assertQuery(t, m, 0, 0, "I'm not a rectangle", "jacob.label")
+				assertQuery(t, m, 1, 0, nil, "jeremy")
+			},
+		},
+		{
+			name: "negated-glob",
+			run: func(t testing.TB) {
+				m, err := compile(t, `api
+users-db
+orders-db
+!*-db.style.fill: red
+`)
+				assert.Success(t, err)
+				assertQuery(t, m, 5, 0, nil, "")
+				assertQuery(t, m, 2, 0, nil, "api")
+				assertQuery(t, m, 0, 0, nil, "users-db")
+				assertQuery(t, m, 0, 0, nil, "orders-db")
+			},
+		},
+		{
+			name: "predicate",
+			run: func(t testing.TB) {
+				m, err := compile(t, `users: {
+	shape: cylinder
+}
+api: {
+	shape: rectangle
+}
+orders.shape: cylinder
+*[shape=cylinder].style.fill: red
+*[shape!=cylinder, shape!=circle]: service
+`)
+				assert.Success(t, err)
+				assertQuery(t, m, 11, 0, nil, "")
+				assertQuery(t, m, 0, 0, "red", "users.style.fill")
+				assertQuery(t, m, 0, 0, "red", "orders.style.fill")
+				assertQuery(t, m, 2, 0, nil, "api")
+				assertQuery(t, m, 0, 0, "service", "api.label")
+			},
+		},
+		{
+			name: "predicate-map",
+			run: func(t testing.TB) {
+				m, err := compile(t, `a.b.shape: cylinder
+a.c
+a.*[shape=cylinder]: {
+	style.fill: red
+}
+`)
+				assert.Success(t, err)
+				assertQuery(t, m, 6, 0, nil, "")
+				assertQuery(t, m, 0, 0, "red", "a.b.style.fill")
+				assertQuery(t, m, 0, 0, nil, "a.c")
+			},
+		},
 	}
 
 	runa(t, tca)
@@ -293,6 +363,47 @@ jasmine.style: {
 					assert.ErrorString(t, err, `TestCompile/filters/errors/composite.d2:6:2: glob filters cannot be composites`)
 				},
 			},
+			{
+				name: "label-without-value",
+				run: func(t testing.TB) {
+					_, err := compile(t, `jacob
+*: {
+	&label
+}
+`)
+					assert.ErrorString(t, err, `TestCompile/filters/errors/label-without-value.d2:3:2: glob filters need a value`)
+				},
+			},
+			{
+				name: "field-without-value",
+				run: func(t testing.TB) {
+					_, err := compile(t, `jacob.shape: circle
+*: {
+	&shape
+}
+`)
+					assert.ErrorString(t, err, `TestCompile/filters/errors/field-without-value.d2:3:2: glob filters need a value`)
+				},
+			},
+			{
+				name: "not-outside-glob",
+				run: func(t testing.TB) {
+					_, err := compile(t, `jacob: {
+	!&shape: circle
+}
+`)
+					assert.ErrorString(t, err, `TestCompile/filters/errors/not-outside-glob.d2:2:2: glob filters cannot be used outside globs`)
+				},
+			},
+			{
+				name: "predicate-edge",
+				run: func(t testing.TB) {
+					_, err := compile(t, `a
+*[shape=circle] -> b
+`)
+					assert.ErrorString(t, err, `TestCompile/filters/errors/predicate-edge.d2:2:1: glob filters in [] cannot be used in edges`)
+				},
+			},
 		}
 		runa(t, tca)
 	})
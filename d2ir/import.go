@@ -1,6 +1,9 @@
 package d2ir
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"io/fs"
 	"os"
 	"path"
@@ -8,17 +11,23 @@ import (
 
 	"oss.terrastruct.com/d2/d2ast"
 	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/lib/remoteimport"
 )
 
 func (c *compiler) pushImportStack(imp *d2ast.Import) (string, bool) {
 	impPath := imp.PathWithPre()
 	if impPath == "" && imp.Range != (d2ast.Range{}) {
-		c.errorf(imp, "imports must specify a path to import")
+		c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp, "imports must specify a path to import")
 		return "", false
 	}
-	if len(c.importStack) > 0 {
+	if len(c.importStack) > 0 && remoteimport.IsRemote(impPath) {
+		if _, err := remoteimport.Parse(impPath); err != nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp, "%v", err)
+			return "", false
+		}
+	} else if len(c.importStack) > 0 {
 		if path.IsAbs(impPath) {
-			c.errorf(imp, "import paths must be relative")
+			c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp, "import paths must be relative")
 			return "", false
 		}
 
@@ -27,12 +36,25 @@ func (c *compiler) pushImportStack(imp *d2ast.Import) (string, bool) {
 		}
 
 		// Imports are always relative to the importing file.
-		impPath = path.Join(path.Dir(c.importStack[len(c.importStack)-1]), impPath)
+		importer := c.importStack[len(c.importStack)-1]
+		if remoteimport.IsRemote(importer) {
+			u, err := remoteimport.Parse(importer)
+			if err == nil {
+				u, err = u.Resolve(impPath)
+			}
+			if err != nil {
+				c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp, "%v", err)
+				return "", false
+			}
+			impPath = u.String()
+		} else {
+			impPath = path.Join(path.Dir(importer), impPath)
+		}
 	}
 
 	for i, p := range c.importStack {
 		if impPath == p {
-			c.errorf(imp, "detected cyclic import chain: %s", formatCyclicChain(c.importStack[i:]))
+			c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp, "detected cyclic import chain: %s", formatCyclicChain(c.importStack[i:]))
 			return "", false
 		}
 	}
@@ -62,10 +84,23 @@ func (c *compiler) _import(imp *d2ast.Import) (Node, bool) {
 		return nil, false
 	}
 	nilScopeMap(ir)
+	if len(imp.Args) > 0 && !c.importArgs(imp, ir) {
+		return nil, false
+	}
+	if imp.Subtree != nil {
+		if len(imp.IDA()) > 0 {
+			c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp, "imports cannot select both a key with . and a subtree with #")
+			return nil, false
+		}
+		if !c.importSubtree(imp, ir) {
+			return nil, false
+		}
+		return ir, true
+	}
 	if len(imp.IDA()) > 0 {
 		f := ir.GetField(imp.IDA()...)
 		if f == nil {
-			c.errorf(imp, "import key %q doesn't exist inside import", imp.IDA())
+			c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp, "import key %q doesn't exist inside import", imp.IDA())
 			return nil, false
 		}
 		return f, true
@@ -73,6 +108,85 @@ func (c *compiler) _import(imp *d2ast.Import) (Node, bool) {
 	return ir, true
 }
 
+// importArgs sets the vars of ir to the arguments of imp. They're substituted along with the
+// rest of the importer, in which vars in the arguments are resolved.
+func (c *compiler) importArgs(imp *d2ast.Import, ir *Map) bool {
+	vars := ir.GetField("vars")
+	ok := true
+	for _, arg := range imp.Args {
+		ida := arg.Key.IDA()
+		var f *Field
+		if vars != nil && vars.Map() != nil {
+			f = vars.Map().GetField(ida...)
+		}
+		if f == nil {
+			c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, arg.Key, "import argument %q isn't a var of the imported file", strings.Join(ida, "."))
+			ok = false
+			continue
+		}
+		f.Primary_ = &Scalar{
+			parent: f,
+			Value:  arg.Value.ScalarBox().Unbox(),
+		}
+		f.Composite = nil
+	}
+	return ok
+}
+
+// importSubtree removes everything but the subtree of ir that imp selects with #, and the
+// connections within it. The classes and vars of the imported file are kept for the subtree
+// to use.
+func (c *compiler) importSubtree(imp *d2ast.Import, ir *Map) bool {
+	ida := imp.Subtree.IDA()
+	m := ir
+	for i, name := range ida {
+		f := m.GetField(name)
+		if f == nil || (i < len(ida)-1 && f.Map() == nil) {
+			c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp.Subtree, "import subtree %q doesn't exist inside import", strings.Join(ida, "."))
+			return false
+		}
+
+		fields := []*Field{f}
+		if m == ir {
+			for _, name := range []string{"classes", "vars"} {
+				if f2 := m.GetField(name); f2 != nil && f2 != f {
+					fields = append(fields, f2)
+				}
+			}
+		}
+		m.Fields = fields
+
+		rest := ida[i:]
+		edges := m.Edges[:0]
+		for _, e := range m.Edges {
+			if hasPrefixFold(e.ID.SrcPath, rest) && hasPrefixFold(e.ID.DstPath, rest) {
+				edges = append(edges, e)
+			}
+		}
+		m.Edges = edges
+
+		if i == len(ida)-1 {
+			break
+		}
+		// Only the fields along the path to the subtree are kept, so their values go too
+		f.Primary_ = nil
+		m = f.Map()
+	}
+	return true
+}
+
+func hasPrefixFold(ida, prefix []string) bool {
+	if len(ida) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if !strings.EqualFold(ida[i], prefix[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *compiler) __import(imp *d2ast.Import) (*Map, bool) {
 	impPath, ok := c.pushImportStack(imp)
 	if !ok {
@@ -87,15 +201,9 @@ func (c *compiler) __import(imp *d2ast.Import) (*Map, bool) {
 		}
 	}
 
-	var f fs.File
-	var err error
-	if c.fs == nil {
-		f, err = os.Open(impPath)
-	} else {
-		f, err = c.fs.Open(impPath)
-	}
+	f, err := c.openImport(impPath)
 	if err != nil {
-		c.errorf(imp, "failed to import %q: %v", impPath, err)
+		c.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp, "failed to import %q: %v", impPath, err)
 		return nil, false
 	}
 	defer f.Close()
@@ -119,6 +227,24 @@ func (c *compiler) __import(imp *d2ast.Import) (*Map, bool) {
 	return ir, true
 }
 
+// openImport opens the file at impPath, or fetches it with fetchImport if it's remote
+func (c *compiler) openImport(impPath string) (io.ReadCloser, error) {
+	if remoteimport.IsRemote(impPath) {
+		if c.fetchImport == nil {
+			return nil, errors.New("remote imports aren't supported here")
+		}
+		b, err := c.fetchImport(impPath)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	if c.fs == nil {
+		return os.Open(impPath)
+	}
+	return c.fs.Open(impPath)
+}
+
 func nilScopeMap(n Node) {
 	switch n := n.(type) {
 	case *Map:
@@ -144,3 +270,38 @@ func nilScopeMap(n Node) {
 		}
 	}
 }
+
+// iconImport returns the icon of an icon pack, like @aws/s3, which is written like an import.
+// Imports are icons when they're the value of an icon and there's no file for them to import.
+func (c *compiler) iconImport(f *Field, imp *d2ast.Import) (*d2ast.UnquotedString, bool) {
+	if imp == nil || imp.Spread || f.Name != "icon" || len(imp.Path) == 0 || len(c.importStack) == 0 {
+		return nil, false
+	}
+	impPath := imp.PathWithPre()
+	if remoteimport.IsRemote(impPath) {
+		return nil, false
+	}
+	// Files of remote imports aren't fetched just to check whether they exist, so their icons
+	// are always icons
+	if importer := c.importStack[len(c.importStack)-1]; !remoteimport.IsRemote(importer) {
+		if path.Ext(impPath) != ".d2" {
+			impPath += ".d2"
+		}
+		impPath = path.Join(path.Dir(importer), impPath)
+		var err error
+		if c.fs == nil {
+			_, err = os.Stat(impPath)
+		} else {
+			_, err = fs.Stat(c.fs, impPath)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, false
+		}
+	}
+
+	icon := "@" + strings.Join(append([]string{imp.PathWithPre()}, imp.IDA()...), ".")
+	return &d2ast.UnquotedString{
+		Range: imp.Range,
+		Value: []d2ast.InterpolationBox{{String: &icon}},
+	}, true
+}
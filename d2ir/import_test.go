@@ -1,11 +1,14 @@
 package d2ir_test
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"oss.terrastruct.com/util-go/assert"
 
 	"oss.terrastruct.com/d2/d2ir"
+	"oss.terrastruct.com/d2/d2parser"
 )
 
 func testCompileImports(t *testing.T) {
@@ -151,6 +154,98 @@ label: meow`,
 				assertQuery(t, m, 0, 0, nil, "q.jon")
 			},
 		},
+		{
+			name: "subtree/spread",
+			run: func(t testing.TB) {
+				m, err := compileFS(t, "index.d2", map[string]string{
+					"index.d2": "...@x#db",
+					"x.d2": `db: { primary -> replica }
+api -> db.primary
+web`,
+				})
+				assert.Success(t, err)
+				assertQuery(t, m, 3, 1, nil, "")
+				assertQuery(t, m, 2, 1, nil, "db")
+				assertQuery(t, m, 0, 0, nil, "(db.primary -> db.replica)[0]")
+			},
+		},
+		{
+			name: "subtree/namespace",
+			run: func(t testing.TB) {
+				m, err := compileFS(t, "index.d2", map[string]string{
+					"index.d2": `infra: @x#lib.db
+db`,
+					"x.d2": `lib: ok {
+  db.primary -> db.replica
+  api
+}`,
+				})
+				assert.Success(t, err)
+				assertQuery(t, m, 6, 1, nil, "")
+				assertQuery(t, m, 4, 1, nil, "infra")
+				assertQuery(t, m, 3, 1, nil, "infra.lib")
+				assertQuery(t, m, 2, 1, nil, "infra.lib.db")
+				assertQuery(t, m, 0, 0, nil, "db")
+			},
+		},
+		{
+			name: "subtree/classes",
+			run: func(t testing.TB) {
+				m, err := compileFS(t, "index.d2", map[string]string{
+					"index.d2": "...@x#db",
+					"x.d2": `classes: { store: { shape: cylinder } }
+db.class: store
+api`,
+				})
+				assert.Success(t, err)
+				assertQuery(t, m, 5, 0, nil, "")
+				assertQuery(t, m, 0, 0, "store", "db.class")
+			},
+		},
+		{
+			name: "args",
+			run: func(t testing.TB) {
+				m, err := compileFS(t, "index.d2", map[string]string{
+					"index.d2": `auth: @svc(label: Auth, color: red)
+billing: @svc(label: "Billing ${n}")
+vars: { n: 2 }`,
+					"svc.d2": `vars: {
+  label: Service
+  color: blue
+}
+label: ${label}
+style.fill: ${color}
+shape: hexagon`,
+				})
+				assert.Success(t, err)
+				assertQuery(t, m, 18, 0, nil, "")
+				assertQuery(t, m, 7, 0, nil, "auth")
+				assertQuery(t, m, 0, 0, "Auth", "auth.label")
+				assertQuery(t, m, 0, 0, "red", "auth.style.fill")
+				assertQuery(t, m, 0, 0, "Billing 2", "billing.label")
+				assertQuery(t, m, 0, 0, "blue", "billing.style.fill")
+			},
+		},
+		{
+			name: "args/spread",
+			run: func(t testing.TB) {
+				m, err := compileFS(t, "index.d2", map[string]string{
+					"index.d2": `users: { ...@svc#db(name: users) }
+vars: { size: 2 }`,
+					"svc.d2": `vars: {
+  name: db
+  size: 1
+}
+db: ${name} {
+  replicas: ${size}
+}`,
+				})
+				assert.Success(t, err)
+				assertQuery(t, m, 8, 0, nil, "")
+				assertQuery(t, m, 1, 0, "users", "users.db")
+				assertQuery(t, m, 0, 0, 1, "users.db.replicas")
+			},
+		},
 		{
 			name: "vars/1",
 			run: func(t testing.TB) {
@@ -211,6 +306,21 @@ label: meow`,
 				assert.Success(t, err)
 			},
 		},
+		{
+			name: "icon-pack",
+			run: func(t testing.TB) {
+				m, err := compileFS(t, "index.d2", map[string]string{
+					"index.d2": `x.icon: @aws/s3.svg
+y.icon: @icons.db
+`,
+					"icons.d2": `db: https://example.com/db.svg`,
+				})
+				assert.Success(t, err)
+				// Icons of icon packs are left to the compiler, as there's no aws/s3.d2 to import
+				assertQuery(t, m, 0, 0, "@aws/s3.svg", "x.icon")
+				assertQuery(t, m, 0, 0, "https://example.com/db.svg", "y.icon")
+			},
+		},
 	}
 
 	runa(t, tca)
@@ -271,6 +381,36 @@ x.d2:1:7: connection missing source`)
 					assert.ErrorString(t, err, `q.d2:1:1: detected cyclic import chain: x.d2 -> y.d2 -> q.d2 -> x.d2`)
 				},
 			},
+			{
+				name: "subtree_not_exist",
+				run: func(t testing.TB) {
+					_, err := compileFS(t, "index.d2", map[string]string{
+						"index.d2": "...@x#y.z",
+						"x.d2":     "y: meow",
+					})
+					assert.ErrorString(t, err, `index.d2:1:7: import subtree "y.z" doesn't exist inside import`)
+				},
+			},
+			{
+				name: "subtree_and_key",
+				run: func(t testing.TB) {
+					_, err := compileFS(t, "index.d2", map[string]string{
+						"index.d2": "...@x.y#z",
+						"x.d2":     "y.z",
+					})
+					assert.ErrorString(t, err, `index.d2:1:1: imports cannot select both a key with . and a subtree with #`)
+				},
+			},
+			{
+				name: "args_not_var",
+				run: func(t testing.TB) {
+					_, err := compileFS(t, "index.d2", map[string]string{
+						"index.d2": "x: @svc(label: x, colour: red)",
+						"svc.d2":   "vars: { label: y; color: blue }",
+					})
+					assert.ErrorString(t, err, `index.d2:1:19: import argument "colour" isn't a var of the imported file`)
+				},
+			},
 			{
 				name: "spread_non_map",
 				run: func(t testing.TB) {
@@ -284,4 +424,72 @@ x.d2:1:7: connection missing source`)
 		}
 		runa(t, tca)
 	})
+
+	t.Run("remote", func(t *testing.T) {
+		t.Parallel()
+
+		tca := []testCase{
+			{
+				name: "spread",
+				run: func(t testing.TB) {
+					m, err := compileRemote(t, `...@"https://example.com/lib/components.d2"
+x: @"git+https://example.com/repo//lib/x.d2@v1".y`, map[string]string{
+						"https://example.com/lib/components.d2":      "...@db\nz",
+						"https://example.com/lib/db.d2":              "db.shape: cylinder",
+						"git+https://example.com/repo//lib/x.d2@v1":  "y: {...@../shared}",
+						"git+https://example.com/repo//shared.d2@v1": "label: meow",
+					})
+					assert.Success(t, err)
+					assertQuery(t, m, 0, 0, "cylinder", "db.shape")
+					assertQuery(t, m, 0, 0, nil, "z")
+					assertQuery(t, m, 0, 0, "meow", "x.label")
+				},
+			},
+			{
+				name: "fetch_error",
+				run: func(t testing.TB) {
+					_, err := compileRemote(t, `...@"https://example.com/x.d2"`, nil)
+					assert.ErrorString(t, err, `index.d2:1:1: failed to import "https://example.com/x.d2": not found`)
+				},
+			},
+			{
+				name: "invalid",
+				run: func(t testing.TB) {
+					_, err := compileRemote(t, `...@"git+https://example.com/repo//x.d2"`, nil)
+					assert.ErrorString(t, err, `index.d2:1:1: git imports must be pinned to a tag, branch or commit, like @v1.0.0: "git+https://example.com/repo//x.d2"`)
+				},
+			},
+			{
+				name: "unsupported",
+				run: func(t testing.TB) {
+					_, err := compileFS(t, "index.d2", map[string]string{
+						"index.d2": `...@"https://example.com/x.d2"`,
+					})
+					assert.ErrorString(t, err, `index.d2:1:1: failed to import "https://example.com/x.d2": remote imports aren't supported here`)
+				},
+			},
+		}
+		runa(t, tca)
+	})
+}
+
+// compileRemote compiles text, the contents of index.d2, with the files of remote imports in
+// remote
+func compileRemote(t testing.TB, text string, remote map[string]string) (*d2ir.Map, error) {
+	t.Helper()
+
+	ast, err := d2parser.Parse("index.d2", strings.NewReader(text), nil)
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := d2ir.Compile(ast, &d2ir.CompileOptions{
+		FetchImport: func(url string) ([]byte, error) {
+			s, ok := remote[url]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return []byte(s), nil
+		},
+	})
+	return m, err
 }
@@ -0,0 +1,83 @@
+package d2ir
+
+import (
+	"strings"
+	"unicode"
+)
+
+// indexThreshold is the number of fields or edges of a map past which they're looked up by an
+// index instead of one by one, so compiling large files isn't quadratic. Most maps have a few,
+// which are faster to go through than to index.
+const indexThreshold = 16
+
+// lookupField returns the first field of m named name, case-insensitively
+func (m *Map) lookupField(name string) *Field {
+	if len(m.Fields) <= indexThreshold {
+		for _, f := range m.Fields {
+			if strings.EqualFold(f.Name, name) {
+				return f
+			}
+		}
+		return nil
+	}
+	m.fieldIndex.Sync(m.Fields, func(f *Field) string {
+		return foldKey(f.Name)
+	})
+	for _, f := range m.fieldIndex.Get(foldKey(name)) {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// lookupEdges returns the edges of m that match eid, in order
+func (m *Map) lookupEdges(eid *EdgeID) []*Edge {
+	edges := m.Edges
+	if len(m.Edges) > indexThreshold {
+		m.edgeIndex.Sync(m.Edges, func(e *Edge) string {
+			return edgeKey(e.ID)
+		})
+		edges = m.edgeIndex.Get(edgeKey(eid))
+	}
+	var ea []*Edge
+	for _, e := range edges {
+		if e.ID.Match(eid) {
+			ea = append(ea, e)
+		}
+	}
+	return ea
+}
+
+// edgeKey is the key of the edges eid matches, whatever their index
+func edgeKey(eid *EdgeID) string {
+	var sb strings.Builder
+	for _, s := range eid.SrcPath {
+		sb.WriteString(foldKey(s))
+		sb.WriteByte(0)
+	}
+	if eid.SrcArrow {
+		sb.WriteByte('<')
+	}
+	sb.WriteByte('-')
+	if eid.DstArrow {
+		sb.WriteByte('>')
+	}
+	for _, s := range eid.DstPath {
+		sb.WriteByte(0)
+		sb.WriteString(foldKey(s))
+	}
+	return sb.String()
+}
+
+// foldKey returns the same key for strings that are equal under strings.EqualFold, by mapping
+// each rune to the smallest rune it folds to
+func foldKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		lowest := r
+		for r2 := unicode.SimpleFold(r); r2 != r; r2 = unicode.SimpleFold(r2) {
+			lowest = min(lowest, r2)
+		}
+		return lowest
+	}, s)
+}
@@ -72,6 +72,14 @@ func matchPattern(s string, pattern []string) bool {
 	if _, ok := d2graph.ReservedKeywords[s]; ok {
 		return false
 	}
+	if strings.HasPrefix(pattern[0], "!") {
+		// !*-db matches everything *-db doesn't.
+		negated := append([]string{strings.TrimPrefix(pattern[0], "!")}, pattern[1:]...)
+		if negated[0] == "" {
+			negated = negated[1:]
+		}
+		return !matchPattern(s, negated)
+	}
 
 	for i := 0; i < len(pattern); i++ {
 		if pattern[i] == "*" {
@@ -0,0 +1,260 @@
+// d2bundle merges the connections of shapes with style.bundle set into trunks
+// Intended to be run after the diagram has undergone layout, so it works the same for every layout engine
+package d2bundle
+
+import (
+	"math"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/lib/geo"
+)
+
+// MIN_BUNDLE_DISTANCE is how far the other ends of a bundle's connections must be from its
+// shape, below which there's no room for a trunk and branches
+const MIN_BUNDLE_DISTANCE = 60.
+
+type side int
+
+const (
+	top side = iota
+	right
+	bottom
+	left
+)
+
+// bundle is the connections either from or to a shape on one side of it
+type bundle struct {
+	obj  *d2graph.Object
+	side side
+	// isSrc is whether obj is the source of the edges, so their routes are reversed
+	isSrc bool
+	// routes are copies of the routes of edges, oriented to end at obj
+	routes [][]*geo.Point
+	edges  []*d2graph.Edge
+}
+
+type bundleKey struct {
+	side  side
+	isSrc bool
+}
+
+// Bundle reroutes the connections to and from each shape with style.bundle set, or every
+// shape when it's set on the root, so that the ones attached to the same side of the shape join
+// in a trunk before it, and branch out to their other ends.
+func Bundle(g *d2graph.Graph) {
+	for _, obj := range g.Objects {
+		if !bundles(obj) {
+			continue
+		}
+		for _, b := range collect(obj, g.Edges) {
+			b.apply()
+		}
+	}
+}
+
+func bundles(obj *d2graph.Object) bool {
+	if obj.Style.Bundle != nil {
+		return obj.Style.Bundle.Value == "true"
+	}
+	root := obj.Graph.Root
+	return root.Style.Bundle != nil && root.Style.Bundle.Value == "true"
+}
+
+// collect groups the connections of obj by whether they come from or go to obj, and the side of
+// obj they're attached to
+func collect(obj *d2graph.Object, edges []*d2graph.Edge) []*bundle {
+	if obj.OuterSequenceDiagram() != nil || obj.Parent.IsGridDiagram() {
+		return nil
+	}
+	vertical := true
+	for curr := obj.Parent; curr != nil; curr = curr.Parent {
+		if curr.Direction.Value != "" {
+			vertical = curr.Direction.Value == "down" || curr.Direction.Value == "up"
+			break
+		}
+	}
+
+	bundles := make(map[bundleKey]*bundle)
+	var order []bundleKey
+	for _, e := range edges {
+		if e.Src == e.Dst || len(e.Route) < 2 {
+			continue
+		}
+		var other *d2graph.Object
+		isSrc := e.Src == obj
+		if isSrc {
+			other = e.Dst
+		} else if e.Dst == obj {
+			other = e.Src
+		} else {
+			continue
+		}
+		if other.IsDescendantOf(obj) || obj.IsDescendantOf(other) {
+			continue
+		}
+
+		route := make([]*geo.Point, len(e.Route))
+		copy(route, e.Route)
+		if isSrc {
+			reverse(route)
+		}
+		key := bundleKey{
+			side:  sideOf(obj, other, vertical),
+			isSrc: isSrc,
+		}
+		b, ok := bundles[key]
+		if !ok {
+			b = &bundle{obj: obj, side: key.side, isSrc: isSrc}
+			bundles[key] = b
+			order = append(order, key)
+		}
+		b.routes = append(b.routes, route)
+		b.edges = append(b.edges, e)
+	}
+
+	var out []*bundle
+	for _, key := range order {
+		if len(bundles[key].edges) > 1 {
+			out = append(out, bundles[key])
+		}
+	}
+	return out
+}
+
+// apply joins the connections at a point a third of the way from obj to the closest of their
+// other ends, and keeps their routes from two thirds of the way on. Connections whose other ends
+// are too close, or behind the side, are left as they are.
+func (b *bundle) apply() {
+	nearest := math.Inf(1)
+	count := 0
+	for _, route := range b.routes {
+		if d := b.distance(route[0]); d >= MIN_BUNDLE_DISTANCE {
+			nearest = math.Min(nearest, d)
+			count++
+		}
+	}
+	if count < 2 {
+		return
+	}
+
+	attach := b.attachPoint()
+	junction := attach.AddVector(b.normal().Multiply(nearest / 3))
+	merge := nearest * 2 / 3
+
+	for i, route := range b.routes {
+		if b.distance(route[0]) < MIN_BUNDLE_DISTANCE {
+			continue
+		}
+		// the last point far enough from obj to be kept
+		k := len(route) - 1
+		for k >= 0 && b.distance(route[k]) < merge {
+			k--
+		}
+		if k < 0 || k == len(route)-1 {
+			continue
+		}
+		d1, d2 := b.distance(route[k]), b.distance(route[k+1])
+		branch := route[k].Interpolate(route[k+1], (d1-merge)/(d1-d2))
+
+		newRoute := make([]*geo.Point, 0, k+4)
+		for _, p := range append(route[:k+1:k+1], branch, junction.Copy(), attach.Copy()) {
+			// the route of another bundle can already end where this one branches
+			if len(newRoute) > 0 {
+				last := newRoute[len(newRoute)-1]
+				if geo.EuclideanDistance(last.X, last.Y, p.X, p.Y) < 1 {
+					continue
+				}
+			}
+			newRoute = append(newRoute, p)
+		}
+		if b.isSrc {
+			reverse(newRoute)
+		}
+
+		e := b.edges[i]
+		e.Route = newRoute
+		// control points of a curve are along the route, so it can be drawn straight through them
+		e.IsCurve = false
+	}
+}
+
+// distance is how far p is out from the side of obj
+func (b *bundle) distance(p *geo.Point) float64 {
+	tl := b.obj.TopLeft
+	switch b.side {
+	case top:
+		return tl.Y - p.Y
+	case bottom:
+		return p.Y - (tl.Y + b.obj.Height)
+	case left:
+		return tl.X - p.X
+	default:
+		return p.X - (tl.X + b.obj.Width)
+	}
+}
+
+// attachPoint is the middle of the side of obj
+func (b *bundle) attachPoint() *geo.Point {
+	tl := b.obj.TopLeft
+	switch b.side {
+	case top:
+		return geo.NewPoint(tl.X+b.obj.Width/2, tl.Y)
+	case bottom:
+		return geo.NewPoint(tl.X+b.obj.Width/2, tl.Y+b.obj.Height)
+	case left:
+		return geo.NewPoint(tl.X, tl.Y+b.obj.Height/2)
+	default:
+		return geo.NewPoint(tl.X+b.obj.Width, tl.Y+b.obj.Height/2)
+	}
+}
+
+func (b *bundle) normal() geo.Vector {
+	switch b.side {
+	case top:
+		return geo.NewVector(0, -1)
+	case bottom:
+		return geo.NewVector(0, 1)
+	case left:
+		return geo.NewVector(-1, 0)
+	default:
+		return geo.NewVector(1, 0)
+	}
+}
+
+// sideOf is the side of obj facing other. Layout engines can end routes on corners, so rather
+// than where a route ends, the side is across the layout's direction when other is on another
+// rank, and along it otherwise.
+func sideOf(obj, other *d2graph.Object, vertical bool) side {
+	if vertical {
+		if other.TopLeft.Y+other.Height <= obj.TopLeft.Y {
+			return top
+		}
+		if other.TopLeft.Y >= obj.TopLeft.Y+obj.Height {
+			return bottom
+		}
+	} else {
+		if other.TopLeft.X+other.Width <= obj.TopLeft.X {
+			return left
+		}
+		if other.TopLeft.X >= obj.TopLeft.X+obj.Width {
+			return right
+		}
+	}
+
+	if vertical {
+		if other.Center().X < obj.Center().X {
+			return left
+		}
+		return right
+	}
+	if other.Center().Y < obj.Center().Y {
+		return top
+	}
+	return bottom
+}
+
+func reverse(points []*geo.Point) {
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+}
@@ -0,0 +1,311 @@
+// d2compact slides the shapes of a laid out diagram together, removing the whitespace layout
+// engines leave by spacing every rank the same. Top-level shapes move whole, with their
+// descendants, and the connections between them stretch to follow, so the nesting and routes
+// the layout engine chose are kept. Grid and sequence diagrams are left as they are.
+package d2compact
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/label"
+)
+
+// GAP is the space left between shapes, and between a connection's ends, after compacting
+const GAP = 40.
+
+// item is what moves as one while compacting: a top-level shape with its descendants, or a set
+// of connected top-level shapes
+type item struct {
+	objects []*d2graph.Object
+	// box is the bounds of objects, with their outside labels and icons
+	box   geo.Box
+	fixed bool
+	shift float64
+}
+
+// Compact slides the top-level shapes of g toward the start of the diagram along its direction,
+// rank by rank, as far as they go without coming closer than GAP to the shapes before them or to
+// the other ends of their connections, or the space their connection labels need. Then it does
+// the same across the direction with the groups of shapes connected to each other. Pinned shapes
+// stay where they are, and shapes near others follow them.
+func Compact(g *d2graph.Graph) {
+	if len(g.Objects) == 0 || g.Root.IsGridDiagram() || g.Root.IsSequenceDiagram() {
+		return
+	}
+	alongY := true
+	switch g.Root.Direction.Value {
+	case "left", "right":
+		alongY = false
+	}
+
+	topLevel := make(map[*d2graph.Object]*d2graph.Object, len(g.Objects))
+	for _, obj := range g.Objects {
+		curr := obj
+		for curr.Parent != g.Root {
+			curr = curr.Parent
+		}
+		topLevel[obj] = curr
+	}
+
+	var objects, constantNears []*d2graph.Object
+	followers := make(map[*d2graph.Object][]*d2graph.Object)
+	for _, obj := range g.Root.ChildrenArray {
+		switch {
+		case obj.NearKey == nil:
+			objects = append(objects, obj)
+		case obj.IsConstantNear():
+			constantNears = append(constantNears, obj)
+		default:
+			if target, ok := g.Root.HasChild(d2graph.Key(obj.NearKey)); ok && topLevel[target] != nil {
+				followers[topLevel[target]] = append(followers[topLevel[target]], obj)
+			} else {
+				objects = append(objects, obj)
+			}
+		}
+	}
+	if len(objects) < 2 {
+		return
+	}
+	tl, br := bounds(objects)
+
+	items := make(map[*d2graph.Object]*item, len(objects))
+	var ranks []*item
+	for _, obj := range objects {
+		it := &item{
+			objects: []*d2graph.Object{obj},
+			box:     obj.OuterBox(),
+			fixed:   obj.Top != nil || obj.Left != nil,
+		}
+		items[obj] = it
+		ranks = append(ranks, it)
+	}
+	itemOf := func(obj *d2graph.Object) *item {
+		return items[topLevel[obj]]
+	}
+
+	// gaps are the space needed between the top-level shapes connected to each other
+	gaps := make(map[[2]*item]float64)
+	for _, e := range g.Edges {
+		src, dst := itemOf(e.Src), itemOf(e.Dst)
+		if src == nil || dst == nil || src == dst {
+			continue
+		}
+		gap := GAP
+		if e.Label.Value != "" {
+			labelSize := float64(e.LabelDimensions.Width)
+			if alongY {
+				labelSize = float64(e.LabelDimensions.Height)
+			}
+			gap = math.Max(gap, labelSize+4*label.PADDING)
+		}
+		for _, k := range [][2]*item{{src, dst}, {dst, src}} {
+			gaps[k] = math.Max(gaps[k], gap)
+		}
+	}
+	compact(ranks, gaps, alongY)
+	move(g, ranks, topLevel, followers, alongY)
+
+	// Across the direction, shapes connected to each other move together, so their connections
+	// keep their shape
+	groups := make(map[*item]*item)
+	var find func(it *item) *item
+	find = func(it *item) *item {
+		if groups[it] == nil || groups[it] == it {
+			return it
+		}
+		groups[it] = find(groups[it])
+		return groups[it]
+	}
+	for k := range gaps {
+		if a, b := find(k[0]), find(k[1]); a != b {
+			groups[a] = b
+		}
+	}
+	components := make(map[*item]*item)
+	var across []*item
+	for _, obj := range objects {
+		it := items[obj]
+		root := find(it)
+		c, ok := components[root]
+		if !ok {
+			c = &item{box: obj.OuterBox()}
+			components[root] = c
+			across = append(across, c)
+		}
+		c.objects = append(c.objects, obj)
+		c.box = union(c.box, obj.OuterBox())
+		c.fixed = c.fixed || it.fixed
+	}
+	if len(across) > 1 {
+		compact(across, nil, !alongY)
+		move(g, across, topLevel, followers, !alongY)
+	}
+
+	// Shapes near constants stay on the same side of the shrunk diagram
+	newTL, newBR := bounds(objects)
+	for _, obj := range constantNears {
+		key := d2graph.Key(obj.NearKey)[0]
+		dx := anchorShift(key, "left", "right", tl.X, br.X, newTL.X, newBR.X)
+		dy := anchorShift(key, "top", "bottom", tl.Y, br.Y, newTL.Y, newBR.Y)
+		moveObject(g, obj, topLevel, dx, dy)
+	}
+}
+
+// compact moves each item as close to the start as it goes, in order of where they start,
+// without moving it past the items before it across from it, or closer than gaps to the ones it's
+// connected to. Items only move toward the start, and fixed ones don't move.
+func compact(items []*item, gaps map[[2]*item]float64, alongY bool) {
+	start := func(b geo.Box) float64 {
+		if alongY {
+			return b.TopLeft.Y
+		}
+		return b.TopLeft.X
+	}
+	end := func(b geo.Box) float64 {
+		if alongY {
+			return b.TopLeft.Y + b.Height
+		}
+		return b.TopLeft.X + b.Width
+	}
+	across := func(a, b geo.Box) bool {
+		if alongY {
+			return a.TopLeft.X < b.TopLeft.X+b.Width && b.TopLeft.X < a.TopLeft.X+a.Width
+		}
+		return a.TopLeft.Y < b.TopLeft.Y+b.Height && b.TopLeft.Y < a.TopLeft.Y+a.Height
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return start(items[i].box) < start(items[j].box)
+	})
+	diagramStart := start(items[0].box)
+	for i, it := range items {
+		if it.fixed {
+			continue
+		}
+		limit := diagramStart
+		for _, before := range items[:i] {
+			gap, connected := gaps[[2]*item{before, it}]
+			if !connected {
+				if !across(before.box, it.box) {
+					continue
+				}
+				gap = GAP
+			}
+			limit = math.Max(limit, end(before.box)+before.shift+gap)
+		}
+		it.shift = math.Min(0, limit-start(it.box))
+	}
+}
+
+// move applies the shifts of items to their shapes and the shapes near them, and stretches or
+// shrinks the connections between them
+func move(g *d2graph.Graph, items []*item, topLevel map[*d2graph.Object]*d2graph.Object, followers map[*d2graph.Object][]*d2graph.Object, alongY bool) {
+	shifts := make(map[*d2graph.Object]float64)
+	for _, it := range items {
+		for _, obj := range it.objects {
+			shifts[obj] = it.shift
+			for _, f := range followers[obj] {
+				shifts[f] = it.shift
+			}
+		}
+	}
+
+	for _, e := range g.Edges {
+		srcShift, srcOK := shifts[topLevel[e.Src]]
+		dstShift, dstOK := shifts[topLevel[e.Dst]]
+		if !srcOK || !dstOK {
+			continue
+		}
+		// The side of each end facing the other
+		a, b := facing(e.Src.Box, e.Dst.Box, alongY)
+		for _, p := range e.Route {
+			if alongY {
+				p.Y += shiftAt(p.Y, a, b, srcShift, dstShift)
+			} else {
+				p.X += shiftAt(p.X, a, b, srcShift, dstShift)
+			}
+		}
+	}
+	for obj, shift := range shifts {
+		if alongY {
+			obj.MoveWithDescendants(0, shift)
+		} else {
+			obj.MoveWithDescendants(shift, 0)
+		}
+	}
+	for _, it := range items {
+		if alongY {
+			it.box.TopLeft.Y += it.shift
+		} else {
+			it.box.TopLeft.X += it.shift
+		}
+		it.shift = 0
+	}
+}
+
+// moveObject moves a top-level shape, its descendants and the connections between them
+func moveObject(g *d2graph.Graph, obj *d2graph.Object, topLevel map[*d2graph.Object]*d2graph.Object, dx, dy float64) {
+	for _, e := range g.Edges {
+		if topLevel[e.Src] == obj && topLevel[e.Dst] == obj {
+			e.Move(dx, dy)
+		}
+	}
+	obj.MoveWithDescendants(dx, dy)
+}
+
+// shiftAt interpolates the shift of a point of a connection at v, between a, where the source
+// ends, and b, where the destination starts
+func shiftAt(v, a, b, shiftA, shiftB float64) float64 {
+	if shiftA == shiftB {
+		return shiftA
+	}
+	if a == b {
+		return (shiftA + shiftB) / 2
+	}
+	t := math.Max(0, math.Min(1, (v-a)/(b-a)))
+	return shiftA + t*(shiftB-shiftA)
+}
+
+func facing(src, dst *geo.Box, alongY bool) (float64, float64) {
+	srcStart, srcEnd, dstStart, dstEnd := src.TopLeft.X, src.TopLeft.X+src.Width, dst.TopLeft.X, dst.TopLeft.X+dst.Width
+	if alongY {
+		srcStart, srcEnd, dstStart, dstEnd = src.TopLeft.Y, src.TopLeft.Y+src.Height, dst.TopLeft.Y, dst.TopLeft.Y+dst.Height
+	}
+	if srcStart+srcEnd <= dstStart+dstEnd {
+		return srcEnd, dstStart
+	}
+	return srcStart, dstEnd
+}
+
+// anchorShift is how far a shape near the side named before or after of a span, or its middle,
+// moves when the span goes from start to end to newStart to newEnd
+func anchorShift(key, before, after string, start, end, newStart, newEnd float64) float64 {
+	switch {
+	case strings.Contains(key, before):
+		return newStart - start
+	case strings.Contains(key, after):
+		return newEnd - end
+	default:
+		return (newStart+newEnd)/2 - (start+end)/2
+	}
+}
+
+func union(a, b geo.Box) geo.Box {
+	x1 := math.Min(a.TopLeft.X, b.TopLeft.X)
+	y1 := math.Min(a.TopLeft.Y, b.TopLeft.Y)
+	x2 := math.Max(a.TopLeft.X+a.Width, b.TopLeft.X+b.Width)
+	y2 := math.Max(a.TopLeft.Y+a.Height, b.TopLeft.Y+b.Height)
+	return geo.Box{TopLeft: geo.NewPoint(x1, y1), Width: x2 - x1, Height: y2 - y1}
+}
+
+func bounds(objects []*d2graph.Object) (*geo.Point, *geo.Point) {
+	b := objects[0].OuterBox()
+	for _, obj := range objects[1:] {
+		b = union(b, obj.OuterBox())
+	}
+	return b.TopLeft, geo.NewPoint(b.TopLeft.X+b.Width, b.TopLeft.Y+b.Height)
+}
@@ -0,0 +1,75 @@
+package d2compact_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2compact"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+)
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	g, _, err := d2compiler.Compile("", strings.NewReader(`a -> b -> c -> d
+a -> e: a label
+e -> d
+x -> y
+pinned: {top: 0; left: 600}
+`), nil)
+	assert.Success(t, err)
+	ruler, err := textmeasure.NewRuler()
+	assert.Success(t, err)
+	assert.Success(t, g.SetDimensions(nil, ruler, nil))
+	assert.Success(t, d2dagrelayout.DefaultLayout(context.Background(), g))
+
+	before := height(g)
+	pinned := *g.Objects[len(g.Objects)-1].TopLeft
+	d2compact.Compact(g)
+
+	if height(g) >= before {
+		t.Fatalf("expected the diagram to be shorter than %v, got %v", before, height(g))
+	}
+	assert.Equal(t, pinned, *g.Objects[len(g.Objects)-1].TopLeft)
+	for i, a := range g.Objects {
+		for _, b := range g.Objects[i+1:] {
+			if a.TopLeft.X < b.TopLeft.X+b.Width && b.TopLeft.X < a.TopLeft.X+a.Width &&
+				a.TopLeft.Y < b.TopLeft.Y+b.Height && b.TopLeft.Y < a.TopLeft.Y+a.Height {
+				t.Fatalf("%s overlaps %s", a.AbsID(), b.AbsID())
+			}
+		}
+	}
+	for _, e := range g.Edges {
+		start, end := e.Route[0], e.Route[len(e.Route)-1]
+		if !touches(e.Src.Box, start) || !touches(e.Dst.Box, end) {
+			t.Fatalf("%s is detached from its shapes", e.AbsID())
+		}
+		if end.Y-start.Y < d2compact.GAP {
+			t.Fatalf("%s is %v long, shorter than the gap", e.AbsID(), end.Y-start.Y)
+		}
+	}
+}
+
+func height(g *d2graph.Graph) float64 {
+	top, bottom := g.Objects[0].TopLeft.Y, g.Objects[0].TopLeft.Y+g.Objects[0].Height
+	for _, obj := range g.Objects {
+		if obj.Top != nil {
+			continue
+		}
+		top = min(top, obj.TopLeft.Y)
+		bottom = max(bottom, obj.TopLeft.Y+obj.Height)
+	}
+	return bottom - top
+}
+
+func touches(b *geo.Box, p *geo.Point) bool {
+	return p.X >= b.TopLeft.X-1 && p.X <= b.TopLeft.X+b.Width+1 &&
+		p.Y >= b.TopLeft.Y-1 && p.Y <= b.TopLeft.Y+b.Height+1
+}
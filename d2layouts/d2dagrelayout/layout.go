@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"strconv"
 	"strings"
 
 	"cdr.dev/slog"
@@ -17,6 +18,7 @@ import (
 	"oss.terrastruct.com/util-go/go2"
 
 	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts"
 	"oss.terrastruct.com/d2/d2target"
 	"oss.terrastruct.com/d2/lib/geo"
 	"oss.terrastruct.com/d2/lib/label"
@@ -27,6 +29,8 @@ import (
 //go:embed setup.js
 var setupJS string
 
+// dagre.js has local modifications, see NOTICE.txt
+//
 //go:embed dagre.js
 var dagreJS string
 
@@ -35,16 +39,29 @@ const (
 	EDGE_LABEL_GAP  = 20
 	DEFAULT_PADDING = 30.
 	MIN_SPACING     = 10.
+	// STRAIGHTEN_WEIGHT is how much more dagre works to keep connections with straighten: true
+	// short and aligned than the others
+	STRAIGHTEN_WEIGHT = 10
+)
+
+// TieBreak controls how dagre orders siblings whose barycenters are equal
+const (
+	// TieBreakBias is dagre's default, alternating between left and right bias across ordering sweeps
+	TieBreakBias = "bias"
+	// TieBreakDeclaration always keeps siblings with equal barycenters in the order they were declared
+	TieBreakDeclaration = "declaration"
 )
 
 type ConfigurableOpts struct {
-	NodeSep int `json:"nodesep"`
-	EdgeSep int `json:"edgesep"`
+	NodeSep  int    `json:"nodesep"`
+	EdgeSep  int    `json:"edgesep"`
+	TieBreak string `json:"tiebreak,omitempty"`
 }
 
 var DefaultOpts = ConfigurableOpts{
-	NodeSep: 60,
-	EdgeSep: 20,
+	NodeSep:  60,
+	EdgeSep:  20,
+	TieBreak: TieBreakBias,
 }
 
 type DagreNode struct {
@@ -87,10 +104,29 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 		return err
 	}
 
+	switch opts.TieBreak {
+	case "", TieBreakBias, TieBreakDeclaration:
+	default:
+		return fmt.Errorf(`invalid tiebreak %#v, expected %#v or %#v`, opts.TieBreak, TieBreakBias, TieBreakDeclaration)
+	}
+
+	// dagre can't place objects near others either, so those are placed after the pinned ones
+	nearObjects, err := d2layouts.ExtractNearObjects(g)
+	if err != nil {
+		return err
+	}
+
+	// dagre can't keep objects in place, so pinned ones are placed after the rest is laid out
+	pinned, err := unpinObjects(g)
+	if err != nil {
+		return err
+	}
+
 	rootAttrs := dagreOpts{
 		ConfigurableOpts: ConfigurableOpts{
-			EdgeSep: opts.EdgeSep,
-			NodeSep: opts.NodeSep,
+			EdgeSep:  opts.EdgeSep,
+			NodeSep:  opts.NodeSep,
+			TieBreak: opts.TieBreak,
 		},
 	}
 	isHorizontal := false
@@ -175,7 +211,8 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 			}
 		}
 
-		loadScript += mapper.generateAddEdgeLine(src, dst, edge.AbsID(), width, height)
+		minlen, weight := edgePreferences(edge)
+		loadScript += mapper.generateAddEdgeLine(src, dst, edge.AbsID(), width, height, minlen, weight)
 	}
 
 	if debugJS {
@@ -336,6 +373,18 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 		startIndex, endIndex = edge.TraceToShape(points, startIndex, endIndex)
 		points = points[startIndex : endIndex+1]
 
+		// dagre routes to the whole sql_table/class, so attach to the referenced row instead
+		if edge.Src != edge.Dst {
+			if index := edge.SrcRowIndex(); index != nil {
+				points = attachToRow(points, edge.Src, *index)
+			}
+			if index := edge.DstRowIndex(); index != nil {
+				reversePoints(points)
+				points = attachToRow(points, edge.Dst, *index)
+				reversePoints(points)
+			}
+		}
+
 		// build a curved path from the dagre route
 		vectors := make([]geo.Vector, 0, len(points)-1)
 		for i := 1; i < len(points); i++ {
@@ -375,7 +424,73 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 		}
 	}
 
-	return nil
+	if err := pinned.pin(ctx, g, isHorizontal); err != nil {
+		return err
+	}
+	return nearObjects.Place(ctx, g, positionLabelsIcons)
+}
+
+// attachToRow moves the start of route onto the side of obj next to the row at index.
+// If the route left obj through its top or bottom, a short stub is added that leaves the row
+// sideways and then rejoins the route at the same height it left obj, so it doesn't cross obj.
+func attachToRow(route []*geo.Point, obj *d2graph.Object, index int) []*geo.Point {
+	row := obj.GetRowBox(index)
+	if row == nil || len(route) < 2 {
+		return route
+	}
+	rowCenter := row.Center().Y
+	start, next := route[0], route[1]
+	left, right := obj.TopLeft.X, obj.TopLeft.X+obj.Width
+
+	onSide := math.Abs(start.X-left) < 1 || math.Abs(start.X-right) < 1
+	if onSide {
+		wasHorizontal := math.Abs(start.Y-next.Y) < 1
+		start.Y = rowCenter
+		if wasHorizontal && len(route) > 2 {
+			next.Y = rowCenter
+		} else if !wasHorizontal {
+			dir := 1.
+			if math.Abs(start.X-left) < 1 {
+				dir = -1.
+			}
+			stub := geo.NewPoint(start.X+dir*d2graph.MIN_SEGMENT_LEN*2, rowCenter)
+			return append([]*geo.Point{start, stub}, route[1:]...)
+		}
+		return route
+	}
+
+	// leave through whichever side faces where the route is headed
+	sideX, dir := right, 1.
+	if next.X < obj.Center().X {
+		sideX, dir = left, -1.
+	}
+	stubX := sideX + dir*d2graph.MIN_SEGMENT_LEN*2
+	return append([]*geo.Point{
+		geo.NewPoint(sideX, rowCenter),
+		geo.NewPoint(stubX, rowCenter),
+		geo.NewPoint(stubX, start.Y),
+	}, route[1:]...)
+}
+
+func reversePoints(points []*geo.Point) {
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+}
+
+// edgePreferences returns the minimum number of ranks an edge spans and its weight, from
+// its min-length and straighten keywords
+func edgePreferences(edge *d2graph.Edge) (minlen, weight int) {
+	minlen, weight = 1, 1
+	if edge.MinLength != nil {
+		if v, err := strconv.Atoi(edge.MinLength.Value); err == nil && v > 0 {
+			minlen = v
+		}
+	}
+	if edge.Straighten != nil && edge.Straighten.Value == "true" {
+		weight = STRAIGHTEN_WEIGHT
+	}
+	return minlen, weight
 }
 
 func getEdgeEndpoints(g *d2graph.Graph, edge *d2graph.Edge) (*d2graph.Object, *d2graph.Object) {
@@ -403,12 +518,14 @@ func setGraphAttrs(attrs dagreOpts) string {
   edgesep: %d,
   nodesep: %d,
   rankdir: "%s",
+  tiebreak: "%s",
 });
 `,
 		attrs.ranksep,
 		attrs.ConfigurableOpts.EdgeSep,
 		attrs.ConfigurableOpts.NodeSep,
 		attrs.rankdir,
+		attrs.ConfigurableOpts.TieBreak,
 	)
 }
 
@@ -44,10 +44,10 @@ func (c objectMapper) generateAddParentLine(child, parent *d2graph.Object) strin
 	return fmt.Sprintf("g.setParent(`%s`, `%s`);\n", c.ToID(child), c.ToID(parent))
 }
 
-func (c objectMapper) generateAddEdgeLine(from, to *d2graph.Object, edgeID string, width, height int) string {
+func (c objectMapper) generateAddEdgeLine(from, to *d2graph.Object, edgeID string, width, height, minlen, weight int) string {
 	return fmt.Sprintf(
-		"g.setEdge({v:`%s`, w:`%s`, name:`%s`}, { width:%d, height:%d, labelpos: `c` });\n",
-		c.ToID(from), c.ToID(to), escapeID(edgeID), width, height,
+		"g.setEdge({v:`%s`, w:`%s`, name:`%s`}, { width:%d, height:%d, labelpos: `c`, minlen:%d, weight:%d });\n",
+		c.ToID(from), c.ToID(to), escapeID(edgeID), width, height, minlen, weight,
 	)
 }
 
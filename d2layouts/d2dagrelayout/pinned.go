@@ -0,0 +1,199 @@
+package d2dagrelayout
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts"
+	"oss.terrastruct.com/d2/lib/geo"
+)
+
+// PINNED_GAP is the space kept between a pinned object and the objects laid out around it
+const PINNED_GAP = 30.
+
+// pinned holds the objects with top or left set, which dagre can't place itself, and their
+// connections while the rest of the graph is laid out
+type pinned struct {
+	objects []*d2graph.Object
+	edges   []*d2graph.Edge
+
+	objectsBefore  []*d2graph.Object
+	childrenBefore []*d2graph.Object
+	edgesBefore    []*d2graph.Edge
+}
+
+// unpinObjects removes the objects of g with top or left set, along with their connections, so
+// the rest of g is laid out without them. Only top-level objects without children can be pinned.
+func unpinObjects(g *d2graph.Graph) (*pinned, error) {
+	p := &pinned{}
+	isPinned := make(map[*d2graph.Object]struct{})
+	for _, obj := range g.Objects {
+		if obj.Top == nil && obj.Left == nil {
+			continue
+		}
+		if obj.Parent != g.Root {
+			return nil, fmt.Errorf(`"%s" has "top" or "left" set, but only top-level objects can be pinned`, obj.AbsID())
+		}
+		if len(obj.ChildrenArray) > 0 {
+			return nil, fmt.Errorf(`"%s" has "top" or "left" set, but containers can't be pinned`, obj.AbsID())
+		}
+		p.objects = append(p.objects, obj)
+		isPinned[obj] = struct{}{}
+	}
+	if len(p.objects) == 0 {
+		return p, nil
+	}
+
+	p.objectsBefore = g.Objects
+	p.childrenBefore = g.Root.ChildrenArray
+	p.edgesBefore = g.Edges
+
+	var objects, children []*d2graph.Object
+	for _, obj := range g.Objects {
+		if _, ok := isPinned[obj]; !ok {
+			objects = append(objects, obj)
+		}
+	}
+	for _, obj := range g.Root.ChildrenArray {
+		if _, ok := isPinned[obj]; !ok {
+			children = append(children, obj)
+		}
+	}
+	var edges []*d2graph.Edge
+	for _, e := range g.Edges {
+		_, srcPinned := isPinned[e.Src]
+		_, dstPinned := isPinned[e.Dst]
+		if srcPinned || dstPinned {
+			p.edges = append(p.edges, e)
+		} else {
+			edges = append(edges, e)
+		}
+	}
+	g.Objects = objects
+	g.Root.ChildrenArray = children
+	g.Edges = edges
+	return p, nil
+}
+
+// pin restores the pinned objects at their positions, moves what was laid out over them out of
+// the way, further along the rank direction, and routes their connections
+func (p *pinned) pin(ctx context.Context, g *d2graph.Graph, isHorizontal bool) error {
+	if len(p.objects) == 0 {
+		return nil
+	}
+	laidOut := g.Root.ChildrenArray
+	laidOutEdges := g.Edges
+	g.Objects = p.objectsBefore
+	g.Root.ChildrenArray = p.childrenBefore
+	g.Edges = p.edgesBefore
+
+	for _, obj := range p.objects {
+		obj.TopLeft = geo.NewPoint(pinnedCoordinate(obj.Left), pinnedCoordinate(obj.Top))
+		positionLabelsIcons(obj)
+	}
+	sort.SliceStable(p.objects, func(i, j int) bool {
+		if isHorizontal {
+			return p.objects[i].TopLeft.X < p.objects[j].TopLeft.X
+		}
+		return p.objects[i].TopLeft.Y < p.objects[j].TopLeft.Y
+	})
+
+	// Moving objects out of the way of one pinned object can move them onto another
+	for pass := 0; pass <= len(p.objects); pass++ {
+		moved := false
+		for _, obj := range p.objects {
+			if makeRoom(obj, laidOut, laidOutEdges, isHorizontal) {
+				moved = true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+
+	return d2layouts.DefaultRouter(ctx, g, p.edges)
+}
+
+// makeRoom moves the objects overlapping obj, and everything laid out after them along the
+// rank direction, to just past obj. It reports whether anything moved.
+func makeRoom(obj *d2graph.Object, laidOut []*d2graph.Object, edges []*d2graph.Edge, isHorizontal bool) bool {
+	box := geo.NewBox(
+		geo.NewPoint(obj.TopLeft.X-PINNED_GAP, obj.TopLeft.Y-PINNED_GAP),
+		obj.Width+2*PINNED_GAP,
+		obj.Height+2*PINNED_GAP,
+	)
+	start := func(o *d2graph.Object) float64 {
+		if isHorizontal {
+			return o.TopLeft.X
+		}
+		return o.TopLeft.Y
+	}
+
+	threshold := 0.
+	overlaps := false
+	for _, o := range laidOut {
+		if !boxesOverlap(box, o.Box) {
+			continue
+		}
+		if !overlaps || start(o) < threshold {
+			threshold = start(o)
+		}
+		overlaps = true
+	}
+	if !overlaps {
+		return false
+	}
+
+	var dx, dy float64
+	if isHorizontal {
+		dx = box.TopLeft.X + box.Width - threshold
+	} else {
+		dy = box.TopLeft.Y + box.Height - threshold
+	}
+	moved := make(map[*d2graph.Object]struct{})
+	for _, o := range laidOut {
+		if start(o) >= threshold {
+			o.MoveWithDescendants(dx, dy)
+			moved[o] = struct{}{}
+		}
+	}
+	topLevel := func(o *d2graph.Object) *d2graph.Object {
+		for o.Parent != obj.Parent {
+			o = o.Parent
+		}
+		return o
+	}
+	for _, e := range edges {
+		_, srcMoved := moved[topLevel(e.Src)]
+		_, dstMoved := moved[topLevel(e.Dst)]
+		if srcMoved && dstMoved {
+			e.Move(dx, dy)
+		} else if srcMoved || dstMoved {
+			// The edge stretches across the gap
+			for _, p := range e.Route {
+				if isHorizontal && p.X >= threshold {
+					p.X += dx
+				} else if !isHorizontal && p.Y >= threshold {
+					p.Y += dy
+				}
+			}
+		}
+	}
+	return true
+}
+
+func boxesOverlap(a, b *geo.Box) bool {
+	return a.TopLeft.X < b.TopLeft.X+b.Width && b.TopLeft.X < a.TopLeft.X+a.Width &&
+		a.TopLeft.Y < b.TopLeft.Y+b.Height && b.TopLeft.Y < a.TopLeft.Y+a.Height
+}
+
+func pinnedCoordinate(s *d2graph.Scalar) float64 {
+	if s == nil {
+		return 0
+	}
+	v, _ := strconv.Atoi(s.Value)
+	return float64(v)
+}
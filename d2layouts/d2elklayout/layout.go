@@ -13,7 +13,6 @@ import (
 	"math"
 	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/dop251/goja"
 
@@ -22,6 +21,7 @@ import (
 	"oss.terrastruct.com/util-go/go2"
 
 	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts"
 	"oss.terrastruct.com/d2/d2target"
 	"oss.terrastruct.com/d2/lib/geo"
 	"oss.terrastruct.com/d2/lib/label"
@@ -55,6 +55,10 @@ const (
 	West  PortSide = "WEST"
 )
 
+// STRAIGHTEN_PRIORITY is how much more ELK works to keep connections with straighten: true
+// straight than the others, whose priority is 0
+const STRAIGHTEN_PRIORITY = 10
+
 type Direction string
 
 const (
@@ -100,6 +104,8 @@ type ELKEdge struct {
 	Sections  []ELKEdgeSection `json:"sections,omitempty"`
 	Labels    []*ELKLabel      `json:"labels,omitempty"`
 	Container string           `json:"container"`
+
+	LayoutOptions *elkOpts `json:"layoutOptions,omitempty"`
 }
 
 type ELKGraph struct {
@@ -149,6 +155,8 @@ type elkOpts struct {
 	PortSide        PortSide `json:"elk.port.side,omitempty"`
 	PortConstraints string   `json:"elk.portConstraints,omitempty"`
 
+	PriorityStraightness int `json:"elk.layered.priority.straightness,omitempty"`
+
 	ConfigurableOpts
 }
 
@@ -213,6 +221,12 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 		elkGraph.LayoutOptions.Direction = Down
 	}
 
+	// ELK can't place objects near others, so those are placed after the rest is laid out
+	nearObjects, err := d2layouts.ExtractNearObjects(g)
+	if err != nil {
+		return err
+	}
+
 	// set label and icon positions for ELK
 	for _, obj := range g.Objects {
 		positionLabelsIcons(obj)
@@ -331,7 +345,7 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 		if obj.SQLTable != nil {
 			n.LayoutOptions.PortConstraints = "FIXED_POS"
 			columns := obj.SQLTable.Columns
-			colHeight := n.Height / float64(len(columns)+1)
+			colHeight := n.Height / float64(obj.SQLTable.Rows()+1)
 			n.Ports = make([]*ELKPort, 0, len(columns)*2)
 			var srcSide, dstSide PortSide
 			switch elkGraph.LayoutOptions.Direction {
@@ -341,6 +355,11 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 				srcSide, dstSide = East, West
 			}
 			for i, col := range columns {
+				if col.Shape != "" {
+					continue
+				}
+				// Connections to hidden columns go to the row they're collapsed into
+				i = obj.SQLTable.RowIndex(i)
 				n.Ports = append(n.Ports, &ELKPort{
 					ID:            srcPortID(obj, col.Name.Label),
 					Y:             float64(i+1)*colHeight + colHeight/2,
@@ -416,6 +435,12 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 			Sources: []string{src},
 			Targets: []string{dst},
 		}
+		if edge.Straighten != nil && edge.Straighten.Value == "true" {
+			// min-length has no equivalent in ELK, but straightness is prioritized the same way
+			e.LayoutOptions = &elkOpts{
+				PriorityStraightness: STRAIGHTEN_PRIORITY,
+			}
+		}
 		if edge.Label.Value != "" {
 			e.Labels = append(e.Labels, &ELKLabel{
 				Text:   edge.Label.Value,
@@ -662,7 +687,7 @@ func Layout(ctx context.Context, g *d2graph.Graph, opts *ConfigurableOpts) (err
 
 	deleteBends(g)
 
-	return nil
+	return nearObjects.Place(ctx, g, positionLabelsIcons)
 }
 
 func srcPortID(obj *d2graph.Object, column string) string {
@@ -712,8 +737,8 @@ func deleteBends(g *d2graph.Graph) {
 			// Make sure it's still attached
 			switch {
 			case columnIndex != nil:
-				rowHeight := endpoint.Height / float64(len(endpoint.SQLTable.Columns)+1)
-				rowCenter := endpoint.TopLeft.Y + rowHeight*float64(*columnIndex+1) + rowHeight/2
+				rowHeight := endpoint.Height / float64(endpoint.SQLTable.Rows()+1)
+				rowCenter := endpoint.TopLeft.Y + rowHeight*float64(endpoint.SQLTable.RowIndex(*columnIndex)+1) + rowHeight/2
 
 				// for row connections new Y coordinate should be within 1/3 row height from the row center
 				if math.Abs(end.Y-rowCenter) > rowHeight/3 {
@@ -742,7 +767,7 @@ func deleteBends(g *d2graph.Graph) {
 				newStart = geo.NewPoint(end.X, start.Y)
 			}
 
-			endpointShape := shape.NewShape(d2target.DSL_SHAPE_TO_SHAPE_TYPE[strings.ToLower(endpoint.Shape.Value)], endpoint.Box)
+			endpointShape := endpoint.ToShape()
 			newStart = shape.TraceToShapeBorder(endpointShape, newStart, end)
 
 			// Check that the new segment doesn't collide with anything new
@@ -246,6 +246,7 @@ func LayoutNested(ctx context.Context, g *d2graph.Graph, graphInfo GraphInfo, co
 
 	// We can now run layout with accurate sizes of nested layout containers
 	// Layout according to the type of diagram
+	ResolveAutoDirection(g)
 	var err error
 	if len(g.Objects) > 0 {
 		switch graphInfo.DiagramType {
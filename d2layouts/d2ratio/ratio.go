@@ -0,0 +1,427 @@
+// d2ratio fits diagrams to an aspect ratio, like that of slides, by choosing the direction of
+// each group of connected shapes, wrapping long chains, and packing the groups into rows
+// Intended to wrap the core layout engine, so it works the same for every layout engine
+package d2ratio
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/lib/geo"
+)
+
+// GAP is the space between the rows a chain wraps onto, and between the groups packed together
+const GAP = 60.
+
+// WRAP_COST is how much closer to the ratio, as a fraction of it, each wrap of a chain must get
+// the diagram to be worth the detours of the connections it cuts
+const WRAP_COST = 0.05
+
+// ParseRatio parses an aspect ratio given as width:height, like 16:9, or as a number, like 1.5
+func ParseRatio(s string) (float64, error) {
+	var ratio float64
+	var err error
+	if w, h, ok := strings.Cut(s, ":"); ok {
+		var width, height float64
+		width, err = strconv.ParseFloat(w, 64)
+		if err == nil {
+			height, err = strconv.ParseFloat(h, 64)
+		}
+		ratio = width / height
+	} else {
+		ratio, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil || ratio <= 0 || math.IsInf(ratio, 0) || math.IsNaN(ratio) {
+		return 0, fmt.Errorf("expected a ratio like 16:9 or 1.5, got %#v", s)
+	}
+	return ratio, nil
+}
+
+// component is a group of top-level shapes connected to each other, with their descendants and
+// connections
+type component struct {
+	objects  []*d2graph.Object
+	children []*d2graph.Object
+	edges    []*d2graph.Edge
+}
+
+// Layout wraps coreLayout so the boards it lays out come out as close as it can to ratio, their
+// width over their height. Each group of connected shapes is laid out both down and right, unless
+// the board has a direction, and the one closer to ratio is kept. A group that's still too long
+// wraps onto rows, or columns, between its ranks. Then the groups are packed into rows. Boards with
+// pinned shapes are laid out as they are.
+func Layout(ratio float64, coreLayout d2graph.LayoutGraph) d2graph.LayoutGraph {
+	return func(ctx context.Context, g *d2graph.Graph) error {
+		if g.RootLevel > 0 || g.Root.IsSequenceDiagram() || g.Root.IsGridDiagram() || hasPinned(g) {
+			return coreLayout(ctx, g)
+		}
+		directions := []string{"down", "right"}
+		rootDirection := g.Root.Direction
+		if rootDirection.Value != "" {
+			directions = []string{rootDirection.Value}
+		}
+
+		components := split(g)
+		for _, c := range components {
+			if err := c.layout(ctx, g, coreLayout, directions, ratio); err != nil {
+				return err
+			}
+		}
+
+		g.Objects, g.Root.ChildrenArray, g.Edges = nil, nil, nil
+		for _, c := range components {
+			g.Objects = append(g.Objects, c.objects...)
+			g.Root.ChildrenArray = append(g.Root.ChildrenArray, c.children...)
+			g.Edges = append(g.Edges, c.edges...)
+		}
+		g.Root.Direction = rootDirection
+		pack(components, ratio)
+		return nil
+	}
+}
+
+func hasPinned(g *d2graph.Graph) bool {
+	for _, obj := range g.Root.ChildrenArray {
+		if obj.Top != nil || obj.Left != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// split groups the top-level shapes of g by the connections between them and their
+// descendants, and by which are near which
+func split(g *d2graph.Graph) []*component {
+	topLevel := func(obj *d2graph.Object) *d2graph.Object {
+		for obj.Parent != g.Root {
+			obj = obj.Parent
+		}
+		return obj
+	}
+	groups := make(map[*d2graph.Object]*d2graph.Object)
+	var find func(obj *d2graph.Object) *d2graph.Object
+	find = func(obj *d2graph.Object) *d2graph.Object {
+		if groups[obj] == nil || groups[obj] == obj {
+			return obj
+		}
+		groups[obj] = find(groups[obj])
+		return groups[obj]
+	}
+	join := func(a, b *d2graph.Object) {
+		if a, b = find(a), find(b); a != b {
+			groups[a] = b
+		}
+	}
+	for _, e := range g.Edges {
+		join(topLevel(e.Src), topLevel(e.Dst))
+	}
+	for _, obj := range g.Root.ChildrenArray {
+		if obj.NearKey != nil && !obj.IsConstantNear() {
+			if target, ok := g.Root.HasChild(d2graph.Key(obj.NearKey)); ok {
+				join(obj, topLevel(target))
+			}
+		}
+	}
+
+	byGroup := make(map[*d2graph.Object]*component)
+	var components []*component
+	for _, obj := range g.Root.ChildrenArray {
+		group := find(obj)
+		if _, ok := byGroup[group]; !ok {
+			byGroup[group] = &component{}
+			components = append(components, byGroup[group])
+		}
+		byGroup[group].children = append(byGroup[group].children, obj)
+	}
+	for _, obj := range g.Objects {
+		c := byGroup[find(topLevel(obj))]
+		c.objects = append(c.objects, obj)
+	}
+	for _, e := range g.Edges {
+		c := byGroup[find(topLevel(e.Src))]
+		c.edges = append(c.edges, e)
+	}
+	return components
+}
+
+// layout lays c out in each direction and keeps the one which, once wrapped, is closest to ratio
+func (c *component) layout(ctx context.Context, g *d2graph.Graph, coreLayout d2graph.LayoutGraph, directions []string, ratio float64) error {
+	run := func(direction string) error {
+		g.Objects, g.Root.ChildrenArray, g.Edges = c.objects, c.children, c.edges
+		g.Root.Direction.Value = direction
+		if err := coreLayout(ctx, g); err != nil {
+			return err
+		}
+		// Layout engines can replace the objects of the graph
+		c.objects, c.children, c.edges = g.Objects, g.Root.ChildrenArray, g.Edges
+		return nil
+	}
+
+	best, bestScore := "", math.Inf(1)
+	for _, direction := range directions {
+		if err := run(direction); err != nil {
+			return err
+		}
+		_, score := c.wrapping(direction, ratio)
+		if score < bestScore {
+			best, bestScore = direction, score
+		}
+	}
+	if best != directions[len(directions)-1] {
+		if err := run(best); err != nil {
+			return err
+		}
+	}
+	segments, _ := c.wrapping(best, ratio)
+	c.wrap(segments, isHorizontal(best))
+	return nil
+}
+
+func isHorizontal(direction string) bool {
+	return direction == "right" || direction == "left"
+}
+
+// rank is the top-level shapes of a component which overlap along its direction
+type rank struct {
+	objects    []*d2graph.Object
+	start, end float64
+}
+
+// segment is the ranks which go on one row, or column, of a wrapped component
+type segment struct {
+	ranks []*rank
+	// box is in the coordinates of the direction, with X along it
+	box geo.Box
+}
+
+// wrapping finds how to split the ranks of c into segments so its bounds are closest to ratio,
+// and how far from ratio that is
+func (c *component) wrapping(direction string, ratio float64) ([]*segment, float64) {
+	horizontal := isHorizontal(direction)
+	ranks := c.ranks(horizontal)
+	total := ranks[len(ranks)-1].end - ranks[0].start
+
+	var best []*segment
+	bestScore := math.Inf(1)
+	// Each segment keeps at least two ranks, so it's a chain rather than scattered shapes
+	for k := 1; k == 1 || k <= len(ranks)/2; k++ {
+		var segments []*segment
+		for i, r := range ranks {
+			// Cut before the rank that starts past the next k-th of the length
+			if i == 0 || r.start-ranks[0].start >= total*float64(len(segments))/float64(k) {
+				segments = append(segments, &segment{})
+			}
+			s := segments[len(segments)-1]
+			s.ranks = append(s.ranks, r)
+		}
+		if k > 1 && len(segments) < k {
+			break
+		}
+
+		var along, across float64
+		for i, s := range segments {
+			s.box = bounds(s.objects(), horizontal)
+			along = math.Max(along, s.box.Width)
+			across += s.box.Height
+			if i > 0 {
+				across += GAP
+			}
+		}
+		w, h := along, across
+		if !horizontal {
+			w, h = across, along
+		}
+		// Wrapping is only worth it when it gets noticeably closer
+		score := distance(w, h, ratio) + WRAP_COST*float64(len(segments)-1)
+		if score < bestScore {
+			best, bestScore = segments, score
+		}
+	}
+	return best, bestScore
+}
+
+func (s *segment) objects() []*d2graph.Object {
+	var objects []*d2graph.Object
+	for _, r := range s.ranks {
+		objects = append(objects, r.objects...)
+	}
+	return objects
+}
+
+// ranks groups the top-level shapes of c by where they are along the direction
+func (c *component) ranks(horizontal bool) []*rank {
+	children := append([]*d2graph.Object(nil), c.children...)
+	sort.SliceStable(children, func(i, j int) bool {
+		return along(*children[i].Box, horizontal).TopLeft.X < along(*children[j].Box, horizontal).TopLeft.X
+	})
+	var ranks []*rank
+	for _, obj := range children {
+		b := along(obj.OuterBox(), horizontal)
+		if len(ranks) == 0 || b.TopLeft.X >= ranks[len(ranks)-1].end {
+			ranks = append(ranks, &rank{start: b.TopLeft.X, end: b.TopLeft.X + b.Width})
+		}
+		r := ranks[len(ranks)-1]
+		r.objects = append(r.objects, obj)
+		r.end = math.Max(r.end, b.TopLeft.X+b.Width)
+	}
+	return ranks
+}
+
+// wrap moves each segment after the first to the start of the direction, past the one before,
+// and routes the connections between segments around the end of the first one's row
+func (c *component) wrap(segments []*segment, horizontal bool) {
+	if len(segments) < 2 {
+		return
+	}
+	segmentOf := make(map[*d2graph.Object]int)
+	topLevel := make(map[*d2graph.Object]*d2graph.Object)
+	for i, s := range segments {
+		for _, obj := range s.objects() {
+			segmentOf[obj] = i
+			topLevel[obj] = obj
+		}
+	}
+	for _, obj := range c.objects {
+		curr := obj
+		for topLevel[curr] == nil {
+			curr = curr.Parent
+		}
+		topLevel[obj] = topLevel[curr]
+	}
+
+	start := segments[0].box.TopLeft.X
+	offset := segments[0].box.TopLeft.Y
+	shifts := make([]geo.Point, len(segments))
+	for i, s := range segments {
+		shifts[i] = geo.Point{X: start - s.box.TopLeft.X, Y: offset - s.box.TopLeft.Y}
+		offset += s.box.Height + GAP
+		for _, obj := range s.objects() {
+			d := unalong(shifts[i], horizontal)
+			obj.MoveWithDescendants(d.X, d.Y)
+		}
+	}
+
+	for _, e := range c.edges {
+		src, dst := segmentOf[topLevel[e.Src]], segmentOf[topLevel[e.Dst]]
+		if src == dst {
+			d := unalong(shifts[src], horizontal)
+			e.Move(d.X, d.Y)
+			continue
+		}
+		srcBox, dstBox := along(*e.Src.Box, horizontal), along(*e.Dst.Box, horizontal)
+		// The middle of the gap after the source's segment, or before it for connections back
+		gapY := segments[src].box.TopLeft.Y + shifts[src].Y + segments[src].box.Height + GAP/2
+		if dst < src {
+			gapY = segments[src].box.TopLeft.Y + shifts[src].Y - GAP/2
+		}
+		srcX := srcBox.TopLeft.X + srcBox.Width
+		srcY := srcBox.TopLeft.Y + srcBox.Height/2
+		dstX := dstBox.TopLeft.X
+		dstY := dstBox.TopLeft.Y + dstBox.Height/2
+		route := []geo.Point{
+			{X: srcX, Y: srcY},
+			{X: srcX + GAP/4, Y: srcY},
+			{X: srcX + GAP/4, Y: gapY},
+			{X: dstX - GAP/4, Y: gapY},
+			{X: dstX - GAP/4, Y: dstY},
+			{X: dstX, Y: dstY},
+		}
+		e.Route = nil
+		for _, p := range route {
+			p = unalong(p, horizontal)
+			e.Route = append(e.Route, geo.NewPoint(p.X, p.Y))
+		}
+		e.IsCurve = false
+	}
+}
+
+// pack places the components in rows, left to right, wrapping them at the width which makes the
+// diagram closest to ratio
+func pack(components []*component, ratio float64) {
+	if len(components) < 2 {
+		return
+	}
+	boxes := make([]geo.Box, len(components))
+	var widths []float64
+	sum := 0.
+	for i, c := range components {
+		boxes[i] = bounds(c.children, true)
+		if i > 0 {
+			sum += GAP
+		}
+		sum += boxes[i].Width
+		widths = append(widths, math.Max(sum, boxes[i].Width))
+	}
+
+	var best []geo.Point
+	bestScore := math.Inf(1)
+	for _, maxWidth := range widths {
+		positions := make([]geo.Point, len(boxes))
+		var x, y, rowHeight, width float64
+		for i, b := range boxes {
+			if x > 0 && x+b.Width > maxWidth {
+				x, y, rowHeight = 0, y+rowHeight+GAP, 0
+			}
+			positions[i] = geo.Point{X: x, Y: y}
+			width = math.Max(width, x+b.Width)
+			rowHeight = math.Max(rowHeight, b.Height)
+			x += b.Width + GAP
+		}
+		if score := distance(width, y+rowHeight, ratio); score < bestScore {
+			best, bestScore = positions, score
+		}
+	}
+
+	for i, c := range components {
+		dx, dy := best[i].X-boxes[i].TopLeft.X, best[i].Y-boxes[i].TopLeft.Y
+		for _, obj := range c.children {
+			obj.MoveWithDescendants(dx, dy)
+		}
+		for _, e := range c.edges {
+			e.Move(dx, dy)
+		}
+	}
+}
+
+// distance is how far the shape of w by h is from ratio, the same for too wide as too tall
+func distance(w, h, ratio float64) float64 {
+	if w <= 0 || h <= 0 {
+		return math.Inf(1)
+	}
+	return math.Abs(math.Log(w / h / ratio))
+}
+
+// along swaps the axes of b when the direction is vertical, so X is along the direction
+func along(b geo.Box, horizontal bool) geo.Box {
+	if horizontal {
+		return b
+	}
+	return geo.Box{TopLeft: geo.NewPoint(b.TopLeft.Y, b.TopLeft.X), Width: b.Height, Height: b.Width}
+}
+
+func unalong(p geo.Point, horizontal bool) geo.Point {
+	if horizontal {
+		return p
+	}
+	return geo.Point{X: p.Y, Y: p.X}
+}
+
+// bounds is the box around objects, with their outside labels, in the coordinates of the
+// direction
+func bounds(objects []*d2graph.Object, horizontal bool) geo.Box {
+	x1, y1 := math.Inf(1), math.Inf(1)
+	x2, y2 := math.Inf(-1), math.Inf(-1)
+	for _, obj := range objects {
+		b := along(obj.OuterBox(), horizontal)
+		x1 = math.Min(x1, b.TopLeft.X)
+		y1 = math.Min(y1, b.TopLeft.Y)
+		x2 = math.Max(x2, b.TopLeft.X+b.Width)
+		y2 = math.Max(y2, b.TopLeft.Y+b.Height)
+	}
+	return geo.Box{TopLeft: geo.NewPoint(x1, y1), Width: x2 - x1, Height: y2 - y1}
+}
@@ -0,0 +1,81 @@
+package d2ratio_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2layouts/d2ratio"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+)
+
+func TestParseRatio(t *testing.T) {
+	t.Parallel()
+
+	for s, exp := range map[string]float64{
+		"16:9": 16. / 9,
+		"1:1":  1,
+		"1.5":  1.5,
+	} {
+		got, err := d2ratio.ParseRatio(s)
+		assert.Success(t, err)
+		assert.Equal(t, exp, got)
+	}
+	for _, s := range []string{"", "16:0", "-1", "wide", "1:2:3"} {
+		_, err := d2ratio.ParseRatio(s)
+		if err == nil {
+			t.Fatalf("expected %#v to fail", s)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	t.Parallel()
+
+	script := `a -> b -> c -> d -> e -> f -> g -> h -> i -> j
+x -> y
+x -> z
+p
+`
+	unwrapped := layout(t, script, d2dagrelayout.DefaultLayout)
+	wrapped := layout(t, script, d2ratio.Layout(16./9, d2dagrelayout.DefaultLayout))
+
+	if distance(wrapped) >= distance(unwrapped) {
+		t.Fatalf("expected %v to be closer to 16:9 than %v", wrapped, unwrapped)
+	}
+}
+
+func layout(t *testing.T, script string, layout d2graph.LayoutGraph) float64 {
+	g, _, err := d2compiler.Compile("", strings.NewReader(script), nil)
+	assert.Success(t, err)
+	ruler, err := textmeasure.NewRuler()
+	assert.Success(t, err)
+	assert.Success(t, g.SetDimensions(nil, ruler, nil))
+	assert.Success(t, layout(context.Background(), g))
+
+	for i, a := range g.Objects {
+		for _, b := range g.Objects[i+1:] {
+			if a.TopLeft.X < b.TopLeft.X+b.Width && b.TopLeft.X < a.TopLeft.X+a.Width &&
+				a.TopLeft.Y < b.TopLeft.Y+b.Height && b.TopLeft.Y < a.TopLeft.Y+a.Height {
+				t.Fatalf("%s overlaps %s", a.AbsID(), b.AbsID())
+			}
+		}
+	}
+	left, top := math.Inf(1), math.Inf(1)
+	right, bottom := math.Inf(-1), math.Inf(-1)
+	for _, obj := range g.Objects {
+		left, top = min(left, obj.TopLeft.X), min(top, obj.TopLeft.Y)
+		right, bottom = max(right, obj.TopLeft.X+obj.Width), max(bottom, obj.TopLeft.Y+obj.Height)
+	}
+	return (right - left) / (bottom - top)
+}
+
+func distance(ratio float64) float64 {
+	return math.Abs(math.Log(ratio / (16. / 9)))
+}
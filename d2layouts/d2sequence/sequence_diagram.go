@@ -113,7 +113,7 @@ func newSequenceDiagram(objects []*d2graph.Object, messages []*d2graph.Edge) (*s
 		if actor.Width < MIN_ACTOR_WIDTH {
 			dslShape := strings.ToLower(actor.Shape.Value)
 			switch dslShape {
-			case d2target.ShapePerson, d2target.ShapeOval, d2target.ShapeSquare, d2target.ShapeCircle:
+			case d2target.ShapePerson, d2target.ShapeActor, d2target.ShapeOval, d2target.ShapeSquare, d2target.ShapeCircle:
 				// scale shape up to min width uniformly
 				actor.Height *= MIN_ACTOR_WIDTH / actor.Width
 			}
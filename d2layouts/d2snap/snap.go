@@ -0,0 +1,110 @@
+// d2snap aligns a laid out diagram to a grid, so that shapes line up and small edits move
+// fewer coordinates when a diagram is rerendered. Sequence diagrams are left as they are,
+// since their spacing comes from the order of their messages.
+package d2snap
+
+import (
+	"math"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/geo"
+)
+
+// Snap moves the sides of every shape of g out to the nearest lines of a grid with cells of size
+// pixels, and the points of connections drawn only with horizontal and vertical segments to the
+// nearest grid points. Shapes only grow, so their labels still fit and they still contain their
+// children. Connections keep their ends on the sides of their shapes.
+func Snap(g *d2graph.Graph, size int) {
+	if size <= 0 {
+		return
+	}
+	grid := float64(size)
+
+	before := make(map[*d2graph.Object]geo.Box, len(g.Objects))
+	for _, obj := range g.Objects {
+		if obj.TopLeft == nil || obj.OuterSequenceDiagram() != nil {
+			continue
+		}
+		before[obj] = *obj.Box
+		snapObject(obj, grid)
+	}
+
+	for _, e := range g.Edges {
+		if len(e.Route) < 2 {
+			continue
+		}
+		src, srcOK := before[e.Src]
+		dst, dstOK := before[e.Dst]
+		if !srcOK || !dstOK {
+			continue
+		}
+		last := len(e.Route) - 1
+		start, end := e.Route[0].Copy(), e.Route[last].Copy()
+		if isOrthogonal(e.Route) {
+			for _, p := range e.Route {
+				p.X = snap(p.X, grid)
+				p.Y = snap(p.Y, grid)
+			}
+		}
+		reattach(e.Route[0], start, e.Route[1], src, *e.Src.Box)
+		reattach(e.Route[last], end, e.Route[last-1], dst, *e.Dst.Box)
+	}
+}
+
+func snapObject(obj *d2graph.Object, grid float64) {
+	x1 := math.Floor(obj.TopLeft.X/grid) * grid
+	y1 := math.Floor(obj.TopLeft.Y/grid) * grid
+	x2 := math.Ceil((obj.TopLeft.X+obj.Width)/grid) * grid
+	y2 := math.Ceil((obj.TopLeft.Y+obj.Height)/grid) * grid
+	obj.TopLeft = geo.NewPoint(x1, y1)
+	obj.Width = math.Max(x2-x1, grid)
+	obj.Height = math.Max(y2-y1, grid)
+
+	switch strings.ToLower(obj.Shape.Value) {
+	case d2target.ShapeCircle, d2target.ShapeSquare:
+		side := math.Max(obj.Width, obj.Height)
+		obj.Width = side
+		obj.Height = side
+	}
+}
+
+// reattach moves the end p of a route, which was at original before snapping, from the side of
+// its shape's box before snapping to the same side after. next is the point after p.
+func reattach(p, original, next *geo.Point, before, after geo.Box) {
+	vertical := p.X == next.X
+	if !vertical && p.Y != next.Y {
+		// A diagonal segment can end on any side, so use the nearest one
+		toHorizontalSide := math.Min(math.Abs(original.Y-before.TopLeft.Y), math.Abs(original.Y-(before.TopLeft.Y+before.Height)))
+		toVerticalSide := math.Min(math.Abs(original.X-before.TopLeft.X), math.Abs(original.X-(before.TopLeft.X+before.Width)))
+		vertical = toHorizontalSide <= toVerticalSide
+	}
+	if vertical {
+		p.Y = moveWithSide(original.Y, before.TopLeft.Y, before.Height, after.TopLeft.Y, after.Height)
+	} else {
+		p.X = moveWithSide(original.X, before.TopLeft.X, before.Width, after.TopLeft.X, after.Width)
+	}
+}
+
+// moveWithSide moves v along with whichever side of a span, from start to start+length, it's
+// nearest to
+func moveWithSide(v, start, length, newStart, newLength float64) float64 {
+	if math.Abs(v-start) <= math.Abs(v-(start+length)) {
+		return v + newStart - start
+	}
+	return v + (newStart + newLength) - (start + length)
+}
+
+func isOrthogonal(route []*geo.Point) bool {
+	for i := 1; i < len(route); i++ {
+		if route[i].X != route[i-1].X && route[i].Y != route[i-1].Y {
+			return false
+		}
+	}
+	return true
+}
+
+func snap(v, grid float64) float64 {
+	return math.Round(v/grid) * grid
+}
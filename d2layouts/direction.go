@@ -0,0 +1,166 @@
+package d2layouts
+
+import (
+	"math"
+
+	"oss.terrastruct.com/util-go/go2"
+
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// DirectionAuto lets the layout pick "down" or "right" based on the shape of the graph
+const DirectionAuto = "auto"
+
+// approximations of the spacing the core layout engines put between nodes
+const (
+	autoRankSep = 100.
+	autoNodeSep = 60.
+)
+
+// ResolveAutoDirection replaces `direction: auto` on the root of g and on its containers with
+// a concrete direction. Containers get the direction that suits what's in them.
+func ResolveAutoDirection(g *d2graph.Graph) {
+	if g.Root.Direction.Value == DirectionAuto {
+		g.Root.Direction.Value = AutoDirection(g)
+	}
+	for _, obj := range g.Objects {
+		if obj.Direction.Value != DirectionAuto {
+			continue
+		}
+		var objects []*d2graph.Object
+		obj.IterDescendants(func(_, child *d2graph.Object) {
+			objects = append(objects, child)
+		})
+		var edges []*d2graph.Edge
+		for _, e := range g.Edges {
+			if e.Src.IsDescendantOf(obj) && e.Dst.IsDescendantOf(obj) && e.Src != obj && e.Dst != obj {
+				edges = append(edges, e)
+			}
+		}
+		obj.Direction.Value = autoDirection(objects, edges)
+	}
+}
+
+// AutoDirection estimates the bounding box of g laid out top-down and left-right, and returns
+// whichever direction produces a smaller area.
+//
+// The estimate ranks every shape by the longest chain of connections leading into it.
+// The number of ranks determines the length of the diagram along its direction,
+// and the widest rank (the fan-out) determines its breadth.
+// Ties go to "down", the default direction.
+func AutoDirection(g *d2graph.Graph) string {
+	return autoDirection(g.Objects, g.Edges)
+}
+
+// autoDirection is AutoDirection of the shapes objects and the connections between them
+func autoDirection(objects []*d2graph.Object, edges []*d2graph.Edge) string {
+	ranks := rankObjects(objects, edges)
+	if len(ranks) == 0 {
+		return "down"
+	}
+
+	var numRanks, breadth int
+	rankSizes := make(map[int]int)
+	var sumWidth, sumHeight float64
+	for obj, r := range ranks {
+		rankSizes[r]++
+		numRanks = go2.Max(numRanks, r+1)
+		breadth = go2.Max(breadth, rankSizes[r])
+		sumWidth += obj.Width
+		sumHeight += obj.Height
+	}
+	avgWidth := sumWidth / float64(len(ranks))
+	avgHeight := sumHeight / float64(len(ranks))
+
+	// edge labels sit between ranks, pushing them apart
+	var maxLabelWidth, maxLabelHeight float64
+	for _, e := range edges {
+		maxLabelWidth = math.Max(maxLabelWidth, float64(e.LabelDimensions.Width))
+		maxLabelHeight = math.Max(maxLabelHeight, float64(e.LabelDimensions.Height))
+	}
+	verticalRankSep := math.Max(autoRankSep, maxLabelHeight+40)
+	horizontalRankSep := math.Max(autoRankSep, maxLabelWidth+40)
+
+	length := float64(numRanks)
+	across := float64(breadth)
+
+	downWidth := across*avgWidth + (across-1)*autoNodeSep
+	downHeight := length*avgHeight + (length-1)*verticalRankSep
+
+	rightWidth := length*avgWidth + (length-1)*horizontalRankSep
+	rightHeight := across*avgHeight + (across-1)*autoNodeSep
+
+	if rightWidth*rightHeight < downWidth*downHeight {
+		return "right"
+	}
+	return "down"
+}
+
+// rankObjects assigns each non-container object of objects the length of the longest path of
+// edges leading to it. Edges that would form a cycle are ignored.
+func rankObjects(objects []*d2graph.Object, edges []*d2graph.Edge) map[*d2graph.Object]int {
+	var leaves []*d2graph.Object
+	isLeaf := make(map[*d2graph.Object]bool)
+	for _, obj := range objects {
+		if !obj.IsContainer() {
+			leaves = append(leaves, obj)
+			isLeaf[obj] = true
+		}
+	}
+
+	outgoing := make(map[*d2graph.Object][]*d2graph.Object)
+	for _, e := range edges {
+		src, dst := e.Src, e.Dst
+		if e.SrcArrow && !e.DstArrow {
+			src, dst = dst, src
+		}
+		if src == dst || !isLeaf[src] || !isLeaf[dst] {
+			continue
+		}
+		outgoing[src] = append(outgoing[src], dst)
+	}
+
+	// depth-first search to drop back edges, collecting a topological order
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*d2graph.Object]int)
+	order := make([]*d2graph.Object, 0, len(leaves))
+	acyclic := make(map[*d2graph.Object][]*d2graph.Object)
+	var visit func(*d2graph.Object)
+	visit = func(obj *d2graph.Object) {
+		state[obj] = visiting
+		for _, next := range outgoing[obj] {
+			switch state[next] {
+			case unvisited:
+				acyclic[obj] = append(acyclic[obj], next)
+				visit(next)
+			case visited:
+				acyclic[obj] = append(acyclic[obj], next)
+			}
+		}
+		state[obj] = visited
+		order = append(order, obj)
+	}
+	for _, obj := range leaves {
+		if state[obj] == unvisited {
+			visit(obj)
+		}
+	}
+
+	ranks := make(map[*d2graph.Object]int, len(leaves))
+	for _, obj := range leaves {
+		ranks[obj] = 0
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		obj := order[i]
+		for _, next := range acyclic[obj] {
+			if ranks[obj]+1 > ranks[next] {
+				ranks[next] = ranks[obj] + 1
+			}
+		}
+	}
+	return ranks
+}
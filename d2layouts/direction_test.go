@@ -0,0 +1,160 @@
+package d2layouts_test
+
+import (
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2layouts"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+)
+
+func TestResolveAutoDirection(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		script string
+		// exp are the directions resolved, by the absolute ID of their object. The root's is "".
+		exp map[string]string
+	}{
+		{
+			name:   "empty",
+			script: `direction: auto`,
+			exp:    map[string]string{"": "down"},
+		},
+		{
+			name: "single",
+			script: `direction: auto
+a`,
+			exp: map[string]string{"": "down"},
+		},
+		{
+			name: "chain",
+			script: `direction: auto
+design -> build -> review -> release -> monitor`,
+			exp: map[string]string{"": "right"},
+		},
+		{
+			name: "chain_of_narrow_shapes",
+			script: `direction: auto
+a -> b -> c -> d -> e`,
+			exp: map[string]string{"": "down"},
+		},
+		{
+			name: "reversed_chain",
+			script: `direction: auto
+design <- build <- review <- release <- monitor`,
+			exp: map[string]string{"": "right"},
+		},
+		{
+			name: "cycle",
+			script: `direction: auto
+design -> build -> review -> release -> monitor -> design`,
+			exp: map[string]string{"": "right"},
+		},
+		{
+			name: "fan_out",
+			script: `direction: auto
+gateway -> authentication
+gateway -> billing
+gateway -> notifications
+gateway -> search
+gateway -> recommendations
+gateway -> inventory
+gateway -> shipping
+gateway -> analytics`,
+			exp: map[string]string{"": "down"},
+		},
+		{
+			name: "fan_out_to_narrow_shapes",
+			script: `direction: auto
+a -> b
+a -> c
+a -> d
+a -> e
+a -> f
+a -> g
+a -> h
+a -> i
+a -> j
+a -> k`,
+			exp: map[string]string{"": "right"},
+		},
+		{
+			name: "edge_labels",
+			script: `direction: auto
+design -> build: a connection label long enough to push its ranks far apart sideways
+build -> review: a connection label long enough to push its ranks far apart sideways`,
+			exp: map[string]string{"": "down"},
+		},
+		{
+			name: "not_auto",
+			script: `direction: left
+design -> build -> review -> release -> monitor`,
+			exp: map[string]string{"": "left"},
+		},
+		{
+			name: "container",
+			script: `x: {
+  direction: auto
+  design -> build -> review -> release -> monitor
+}
+y: {
+  direction: auto
+  a
+}
+z: {
+  direction: up
+  design -> build -> review -> release -> monitor
+}
+x -> y -> z`,
+			exp: map[string]string{
+				"":  "",
+				"x": "right",
+				"y": "down",
+				"z": "up",
+			},
+		},
+		{
+			name: "container_ignores_outside_edges",
+			script: `x: {
+  direction: auto
+  design -> build
+}
+x.design -> y: a connection label long enough to push its ranks far apart sideways`,
+			exp: map[string]string{
+				"":  "",
+				"x": "right",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g, _, err := d2compiler.Compile("", strings.NewReader(tc.script), nil)
+			assert.Success(t, err)
+			ruler, err := textmeasure.NewRuler()
+			assert.Success(t, err)
+			assert.Success(t, g.SetDimensions(nil, ruler, nil))
+			d2layouts.ResolveAutoDirection(g)
+
+			for id, exp := range tc.exp {
+				obj := g.Root
+				if id != "" {
+					var ok bool
+					obj, ok = g.Root.HasChild(strings.Split(id, "."))
+					if !ok {
+						t.Fatalf("%s not found", id)
+					}
+				}
+				assert.Equal(t, exp, obj.Direction.Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package d2layouts
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/lib/geo"
+)
+
+// DEFAULT_NEAR_GAP is the space between a shape and the object it's near when no gap is given
+const DEFAULT_NEAR_GAP = 20
+
+// NearObjects holds the shapes which are near another object, like notes and legends, and their
+// connections, for layout engines which can't place them. They're taken out of the graph before
+// layout and placed beside their objects after.
+type NearObjects struct {
+	objects []*d2graph.Object
+	targets map[*d2graph.Object]*d2graph.Object
+	edges   []*d2graph.Edge
+
+	objectsBefore  []*d2graph.Object
+	childrenBefore []*d2graph.Object
+	edgesBefore    []*d2graph.Edge
+}
+
+// ExtractNearObjects removes the shapes of g which are near another object, along with their
+// connections, so the rest of g is laid out without them. Only top-level shapes without children
+// can be near another object, and that object must be laid out with them.
+func ExtractNearObjects(g *d2graph.Graph) (*NearObjects, error) {
+	n := &NearObjects{
+		targets: make(map[*d2graph.Object]*d2graph.Object),
+	}
+	inGraph := make(map[*d2graph.Object]struct{}, len(g.Objects))
+	for _, obj := range g.Objects {
+		inGraph[obj] = struct{}{}
+	}
+	for _, obj := range g.Objects {
+		if obj.NearKey == nil || obj.Top != nil || obj.Left != nil {
+			continue
+		}
+		if _, isConst := d2graph.NearConstants[d2graph.Key(obj.NearKey)[0]]; isConst {
+			continue
+		}
+		if g.RootLevel > 0 || obj.Parent != g.Root {
+			return nil, fmt.Errorf(`"%s" is near another object, but only top-level objects can be`, obj.AbsID())
+		}
+		if len(obj.ChildrenArray) > 0 {
+			return nil, fmt.Errorf(`"%s" is near another object, but containers can't be`, obj.AbsID())
+		}
+		target, ok := g.Root.HasChild(d2graph.Key(obj.NearKey))
+		if _, laidOut := inGraph[target]; !ok || !laidOut {
+			return nil, fmt.Errorf(`"%s" is near an object which is laid out separately`, obj.AbsID())
+		}
+		n.objects = append(n.objects, obj)
+		n.targets[obj] = target
+	}
+	if len(n.objects) == 0 {
+		return n, nil
+	}
+
+	n.objectsBefore = g.Objects
+	n.childrenBefore = g.Root.ChildrenArray
+	n.edgesBefore = g.Edges
+
+	var objects, children []*d2graph.Object
+	for _, obj := range g.Objects {
+		if _, ok := n.targets[obj]; !ok {
+			objects = append(objects, obj)
+		}
+	}
+	for _, obj := range g.Root.ChildrenArray {
+		if _, ok := n.targets[obj]; !ok {
+			children = append(children, obj)
+		}
+	}
+	var edges []*d2graph.Edge
+	for _, e := range g.Edges {
+		_, srcNear := n.targets[e.Src]
+		_, dstNear := n.targets[e.Dst]
+		if srcNear || dstNear {
+			n.edges = append(n.edges, e)
+		} else {
+			edges = append(edges, e)
+		}
+	}
+	g.Objects = objects
+	g.Root.ChildrenArray = children
+	g.Edges = edges
+	return n, nil
+}
+
+// Place restores the extracted shapes beside the objects they're near and routes their
+// connections. positionLabelsIcons is the layout engine's, for the restored shapes.
+func (n *NearObjects) Place(ctx context.Context, g *d2graph.Graph, positionLabelsIcons func(*d2graph.Object)) error {
+	if len(n.objects) == 0 {
+		return nil
+	}
+	g.Objects = n.objectsBefore
+	g.Root.ChildrenArray = n.childrenBefore
+	g.Edges = n.edgesBefore
+
+	// A shape can be near another one which is itself near something, so place in that order
+	placed := make(map[*d2graph.Object]bool)
+	var place func(obj *d2graph.Object) error
+	place = func(obj *d2graph.Object) error {
+		if done, visited := placed[obj]; visited {
+			if !done {
+				return fmt.Errorf(`"%s" is near an object which is near it`, obj.AbsID())
+			}
+			return nil
+		}
+		placed[obj] = false
+		target := n.targets[obj]
+		if _, ok := n.targets[target]; ok {
+			if err := place(target); err != nil {
+				return err
+			}
+		}
+		obj.TopLeft = nearTopLeft(obj, target)
+		positionLabelsIcons(obj)
+		placed[obj] = true
+		return nil
+	}
+	for _, obj := range n.objects {
+		if err := place(obj); err != nil {
+			return err
+		}
+	}
+
+	return DefaultRouter(ctx, g, n.edges)
+}
+
+// nearTopLeft is where obj goes on its side of target, centered along that side
+func nearTopLeft(obj, target *d2graph.Object) *geo.Point {
+	gap := float64(DEFAULT_NEAR_GAP)
+	if obj.NearGap != nil {
+		v, _ := strconv.Atoi(obj.NearGap.Value)
+		gap = float64(v)
+	}
+	side := "right"
+	if obj.NearSide != nil {
+		side = obj.NearSide.Value
+	}
+
+	centerX := target.TopLeft.X + target.Width/2 - obj.Width/2
+	centerY := target.TopLeft.Y + target.Height/2 - obj.Height/2
+	switch side {
+	case "top":
+		return geo.NewPoint(centerX, target.TopLeft.Y-gap-obj.Height)
+	case "bottom":
+		return geo.NewPoint(centerX, target.TopLeft.Y+target.Height+gap)
+	case "left":
+		return geo.NewPoint(target.TopLeft.X-gap-obj.Width, centerY)
+	default:
+		return geo.NewPoint(target.TopLeft.X+target.Width+gap, centerY)
+	}
+}
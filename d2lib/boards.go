@@ -0,0 +1,201 @@
+package d2lib
+
+import (
+	"context"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// Board describes one board of a diagram and the boards nested in it
+type Board struct {
+	// Name is empty for the root board
+	Name string `json:"name"`
+	// Path leads to the board from the root, e.g. ["layers", "x", "steps", "1"], and is empty for the root.
+	// It can be passed to d2target.Diagram.GetBoard, or joined with "." for the CLI's --target.
+	Path []string `json:"path"`
+	// Kind is "layers", "scenarios", or "steps", or empty for the root board
+	Kind string `json:"kind,omitempty"`
+	// StepIndex is the board's index within its steps, or -1 if it's not a step
+	StepIndex int `json:"stepIndex"`
+	// IsFolderOnly boards have nothing of their own to render and only hold other boards
+	IsFolderOnly bool `json:"isFolderOnly"`
+	// Config is what the board renders with: the passed in options, then the root's
+	// d2-config, then defaults. Every board inherits it from the root.
+	Config *d2target.Config `json:"config"`
+
+	Layers    []*Board `json:"layers,omitempty"`
+	Scenarios []*Board `json:"scenarios,omitempty"`
+	Steps     []*Board `json:"steps,omitempty"`
+}
+
+// ListBoards compiles input and returns its tree of boards without running layout or rendering,
+// so that callers can choose which boards to render and how to name them up front.
+// Neither compileOpts nor renderOpts are modified.
+func ListBoards(ctx context.Context, input string, compileOpts *CompileOptions, renderOpts *d2svg.RenderOpts) (*Board, error) {
+	co := &CompileOptions{}
+	if compileOpts != nil {
+		*co = *compileOpts
+	}
+	ro := &d2svg.RenderOpts{}
+	if renderOpts != nil {
+		*ro = *renderOpts
+	}
+
+	g, config, err := d2compiler.Compile(co.InputPath, strings.NewReader(input), &d2compiler.CompileOptions{
+		UTF16Pos:    co.UTF16Pos,
+		FS:          co.FS,
+		Stylesheet:  co.Stylesheet,
+		IconDir:     co.IconDir,
+		FetchImport: co.FetchImport,
+		Defines:     co.Defines,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	applyConfigs(config, co, ro)
+	if err := applyMedium(co, ro); err != nil {
+		return nil, err
+	}
+	applyDefaults(co, ro)
+	resolved := &d2target.Config{
+		Sketch:             ro.Sketch,
+		ThemeID:            ro.ThemeID,
+		DarkThemeID:        ro.DarkThemeID,
+		Pad:                ro.Pad,
+		Center:             ro.Center,
+		LayoutEngine:       co.Layout,
+		ThemeOverrides:     ro.ThemeOverrides,
+		DarkThemeOverrides: ro.DarkThemeOverrides,
+	}
+
+	return listBoards(g, []string{}, "", -1, resolved), nil
+}
+
+func listBoards(g *d2graph.Graph, path []string, kind string, stepIndex int, config *d2target.Config) *Board {
+	b := &Board{
+		Name:         g.Name,
+		Path:         path,
+		Kind:         kind,
+		StepIndex:    stepIndex,
+		IsFolderOnly: g.IsFolderOnly,
+		Config:       config,
+	}
+	childPath := func(kind, name string) []string {
+		p := make([]string, 0, len(path)+2)
+		p = append(p, path...)
+		return append(p, kind, name)
+	}
+	for _, l := range g.Layers {
+		b.Layers = append(b.Layers, listBoards(l, childPath("layers", l.Name), "layers", -1, config))
+	}
+	for _, s := range g.Scenarios {
+		b.Scenarios = append(b.Scenarios, listBoards(s, childPath("scenarios", s.Name), "scenarios", -1, config))
+	}
+	for i, s := range g.Steps {
+		b.Steps = append(b.Steps, listBoards(s, childPath("steps", s.Name), "steps", i, config))
+	}
+	return b
+}
+
+// Find returns the boards under b, b included, that any of patterns select, in the order
+// they're listed. See MatchBoard for the patterns.
+func (b *Board) Find(patterns ...string) []*Board {
+	var found []*Board
+	if matchBoards(patterns, b.Path) {
+		found = append(found, b)
+	}
+	for _, children := range [][]*Board{b.Layers, b.Scenarios, b.Steps} {
+		for _, c := range children {
+			found = append(found, c.Find(patterns...)...)
+		}
+	}
+	return found
+}
+
+// MatchBoard reports whether pattern selects the board at path.
+//
+// Patterns are board paths with / between their parts, like the paths multi-board exports
+// are written to, e.g. layers/x or scenarios/prod/steps/2. Like globs in D2, * in a part
+// matches any characters, case insensitively, and a part of ** matches any number of parts.
+// A pattern also selects the boards nested in the boards it matches, so scenarios/prod/*
+// selects all the boards in scenarios/prod, and the pattern ** selects every board. The root
+// board is only selected by ** and by the empty pattern.
+func MatchBoard(pattern string, path []string) bool {
+	if pattern == "" {
+		return len(path) == 0
+	}
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	for i := 0; i <= len(path); i++ {
+		if matchBoardParts(parts, path[:i]) && (i > 0 || len(parts) == 1 && parts[0] == "**") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchBoards(patterns []string, path []string) bool {
+	for _, pattern := range patterns {
+		if MatchBoard(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchBoardParts(parts, path []string) bool {
+	if len(parts) == 0 {
+		return len(path) == 0
+	}
+	if parts[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchBoardParts(parts[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 || !d2graph.MatchGlob(parts[0], path[0]) {
+		return false
+	}
+	return matchBoardParts(parts[1:], path[1:])
+}
+
+// selectBoards empties the boards of g that none of patterns select, so that they aren't laid
+// out and are only folders of the boards in them. Boards are kept so that the selected boards
+// keep their place in the tree. It returns whether any board is selected.
+func selectBoards(g *d2graph.Graph, path []string, patterns []string) bool {
+	childPath := func(kind, name string) []string {
+		p := make([]string, 0, len(path)+2)
+		p = append(p, path...)
+		return append(p, kind, name)
+	}
+	selected := matchBoards(patterns, path)
+	for _, kind := range []struct {
+		name   string
+		boards []*d2graph.Graph
+	}{
+		{"layers", g.Layers},
+		{"scenarios", g.Scenarios},
+		{"steps", g.Steps},
+	} {
+		for _, b := range kind.boards {
+			if selectBoards(b, childPath(kind.name, b.Name), patterns) {
+				selected = true
+			}
+		}
+	}
+
+	if !matchBoards(patterns, path) {
+		g.Objects = nil
+		g.Edges = nil
+		g.Root.ChildrenArray = nil
+		g.Root.Children = make(map[string]*d2graph.Object)
+		g.IsFolderOnly = true
+	}
+	return selected
+}
@@ -0,0 +1,159 @@
+package d2lib_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+func TestListBoards(t *testing.T) {
+	t.Parallel()
+
+	renderOpts := &d2svg.RenderOpts{
+		Pad: go2.Pointer(int64(10)),
+	}
+	root, err := d2lib.ListBoards(context.Background(), `vars: {
+  d2-config: {
+    theme-id: 4
+    pad: 50
+  }
+}
+x
+layers: {
+  a: {
+    y
+    scenarios: {
+      s: {
+        z
+      }
+    }
+  }
+}
+steps: {
+  1: {
+    x -> y
+  }
+  2: {
+    y -> z
+  }
+}
+`, nil, renderOpts)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "", root.Name)
+	assert.Equal(t, []string{}, root.Path)
+	assert.Equal(t, -1, root.StepIndex)
+	// Passed in options take precedence over d2-config
+	assert.Equal(t, int64(10), *root.Config.Pad)
+	assert.Equal(t, int64(4), *root.Config.ThemeID)
+	assert.Equal(t, "dagre", *root.Config.LayoutEngine)
+	assert.Equal(t, int64(10), *renderOpts.Pad)
+	assert.Equal(t, (*int64)(nil), renderOpts.ThemeID)
+
+	assert.Equal(t, 1, len(root.Layers))
+	a := root.Layers[0]
+	assert.Equal(t, "layers", a.Kind)
+	assert.Equal(t, []string{"layers", "a"}, a.Path)
+	assert.Equal(t, root.Config, a.Config)
+	assert.Equal(t, []string{"layers", "a", "scenarios", "s"}, a.Scenarios[0].Path)
+
+	assert.Equal(t, 2, len(root.Steps))
+	assert.Equal(t, "2", root.Steps[1].Name)
+	assert.Equal(t, 1, root.Steps[1].StepIndex)
+	assert.Equal(t, []string{"steps", "2"}, root.Steps[1].Path)
+}
+
+func TestMatchBoard(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		pattern string
+		path    []string
+		exp     bool
+	}{
+		{"", []string{}, true},
+		{"", []string{"layers", "x"}, false},
+		{"**", []string{}, true},
+		{"**", []string{"scenarios", "a", "steps", "1"}, true},
+		{"layers/x", []string{"layers", "x"}, true},
+		{"layers/X", []string{"layers", "x"}, true},
+		{"layers/x", []string{"layers", "x", "steps", "1"}, true},
+		{"layers/x", []string{"layers", "xy"}, false},
+		{"layers/x", []string{}, false},
+		{"layers/x*", []string{"layers", "xy"}, true},
+		{"layers/*y", []string{"layers", "xy"}, true},
+		{"layers/*z*", []string{"layers", "xy"}, false},
+		{"scenarios/prod/*", []string{"scenarios", "prod"}, false},
+		{"scenarios/prod/*", []string{"scenarios", "prod", "steps", "2"}, true},
+		{"**/steps/2", []string{"scenarios", "prod", "steps", "2"}, true},
+		{"**/steps/2", []string{"steps", "2"}, true},
+		{"**/steps/2", []string{"steps", "1"}, false},
+		{"/layers/x/", []string{"layers", "x"}, true},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.exp, d2lib.MatchBoard(tc.pattern, tc.path), "%q %v", tc.pattern, tc.path)
+	}
+}
+
+func TestCompileBoards(t *testing.T) {
+	t.Parallel()
+
+	input := `x
+layers: {
+  a: {
+    y
+  }
+}
+scenarios: {
+  prod: {
+    z
+    steps: {
+      1: {
+        w
+      }
+    }
+  }
+}
+`
+	root, err := d2lib.ListBoards(context.Background(), input, nil, nil)
+	assert.Nil(t, err)
+	var paths [][]string
+	for _, b := range root.Find("scenarios/*", "layers/a") {
+		paths = append(paths, b.Path)
+	}
+	assert.Equal(t, [][]string{{"layers", "a"}, {"scenarios", "prod"}, {"scenarios", "prod", "steps", "1"}}, paths)
+
+	ruler, err := textmeasure.NewRuler()
+	assert.Nil(t, err)
+	diagram, _, err := d2lib.Compile(context.Background(), input, &d2lib.CompileOptions{
+		Ruler:  ruler,
+		Layout: go2.Pointer("dagre"),
+		LayoutResolver: func(engine string) (d2graph.LayoutGraph, error) {
+			return func(ctx context.Context, g *d2graph.Graph) error {
+				return d2dagrelayout.Layout(ctx, g, nil)
+			}, nil
+		},
+		Boards: []string{"scenarios/prod/*"},
+	}, nil)
+	assert.Nil(t, err)
+	// Boards that aren't selected are kept as empty folders
+	assert.True(t, diagram.IsFolderOnly)
+	assert.Equal(t, 0, len(diagram.Shapes))
+	assert.True(t, diagram.Layers[0].IsFolderOnly)
+	assert.True(t, diagram.Scenarios[0].IsFolderOnly)
+	assert.False(t, diagram.Scenarios[0].Steps[0].IsFolderOnly)
+	assert.Equal(t, 3, len(diagram.Scenarios[0].Steps[0].Shapes))
+
+	_, _, err = d2lib.Compile(context.Background(), input, &d2lib.CompileOptions{
+		Boards: []string{"layers/b"},
+	}, nil)
+	assert.EqualError(t, err, "no boards match layers/b")
+}
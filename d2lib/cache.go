@@ -0,0 +1,218 @@
+package d2lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sync"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2renderers/d2fonts"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// LayoutCache keeps the boards laid out by previous compiles, keyed by a hash of the contents
+// of each board and the options it's laid out with, so recompiling an input where only some
+// boards changed only lays out those again, e.g. on each save in watch mode. It's safe to
+// share between compiles on multiple goroutines.
+type LayoutCache struct {
+	mu         sync.Mutex
+	generation int
+	boards     map[string]*layoutCacheEntry
+}
+
+type layoutCacheEntry struct {
+	// diagram is the exported board, without its layers, scenarios and steps
+	diagram *d2target.Diagram
+	// generation is the last compile the board was used in
+	generation int
+}
+
+func NewLayoutCache() *LayoutCache {
+	return &LayoutCache{
+		boards: make(map[string]*layoutCacheEntry),
+	}
+}
+
+// Len is the number of boards cached
+func (c *LayoutCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.boards)
+}
+
+// begin starts a compile, and returns its generation for end
+func (c *LayoutCache) begin() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	return c.generation
+}
+
+// end evicts the boards that weren't used since the compile of generation started, once it
+// succeeded, as boards that were edited or removed won't be again
+func (c *LayoutCache) end(generation int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.boards {
+		if e.generation < generation {
+			delete(c.boards, k)
+		}
+	}
+}
+
+// get returns a copy of the board cached under key, as callers may modify it
+func (c *LayoutCache) get(key string) (*d2target.Diagram, error) {
+	c.mu.Lock()
+	e, ok := c.boards[key]
+	if ok {
+		e.generation = c.generation
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	var d d2target.Diagram
+	if err := d2graph.Convert(e.diagram, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (c *LayoutCache) put(key string, d *d2target.Diagram) error {
+	board := *d
+	board.Layers = nil
+	board.Scenarios = nil
+	board.Steps = nil
+	// Copied so that callers modifying d don't modify the cache
+	var cached d2target.Diagram
+	if err := d2graph.Convert(&board, &cached); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.boards[key] = &layoutCacheEntry{
+		diagram:    &cached,
+		generation: c.generation,
+	}
+	return nil
+}
+
+// layoutCacheKey hashes what board g is laid out and exported from: its objects and edges, the
+// order they're written in, and the options that change layouts. Where in the input they're
+// written isn't part of it, so edits to other boards keep it.
+func layoutCacheKey(g *d2graph.Graph, compileOpts *CompileOptions, renderOpts *d2svg.RenderOpts) (string, error) {
+	b, err := d2graph.SerializeGraph(g)
+	if err != nil {
+		return "", err
+	}
+	var sg interface{}
+	if err := json.Unmarshal(b, &sg); err != nil {
+		return "", err
+	}
+	sg = stripRanges(sg)
+
+	// Sequence diagrams order their actors and messages by the line they're first written on
+	var objectLines []int
+	for _, obj := range g.Objects {
+		objectLines = append(objectLines, earliestLine(obj.References))
+	}
+	var edgeLines []int
+	for _, e := range g.Edges {
+		edgeLines = append(edgeLines, earliestEdgeLine(e.References))
+	}
+	relativeLines(objectLines, edgeLines)
+
+	b, err = json.Marshal(struct {
+		Name         string              `json:"name"`
+		IsFolderOnly bool                `json:"isFolderOnly"`
+		Graph        interface{}         `json:"graph"`
+		ObjectLines  []int               `json:"objectLines"`
+		EdgeLines    []int               `json:"edgeLines"`
+		Layout       *string             `json:"layout"`
+		TargetRatio  float64             `json:"targetRatio"`
+		Compact      bool                `json:"compact"`
+		Snap         *int64              `json:"snap"`
+		Legend       *string             `json:"legend"`
+		FontFamily   *d2fonts.FontFamily `json:"fontFamily"`
+		ThemeID      *int64              `json:"themeID"`
+		MeasuredText []*d2target.MText   `json:"measuredTexts"`
+		Medium       *string             `json:"medium"`
+	}{
+		Name:         g.Name,
+		IsFolderOnly: g.IsFolderOnly,
+		Graph:        sg,
+		ObjectLines:  objectLines,
+		EdgeLines:    edgeLines,
+		Layout:       compileOpts.Layout,
+		TargetRatio:  compileOpts.TargetRatio,
+		Compact:      compileOpts.Compact,
+		Snap:         compileOpts.Snap,
+		Legend:       compileOpts.Legend,
+		FontFamily:   compileOpts.FontFamily,
+		ThemeID:      renderOpts.ThemeID,
+		MeasuredText: compileOpts.MeasuredTexts,
+		Medium:       compileOpts.Medium,
+	})
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// stripRanges removes the ranges in the input of the AST nodes in a serialized graph
+func stripRanges(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		delete(v, "range")
+		for k, vv := range v {
+			v[k] = stripRanges(vv)
+		}
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = stripRanges(vv)
+		}
+	}
+	return v
+}
+
+func earliestLine(refs []d2graph.Reference) int {
+	line := math.MaxInt32
+	for _, ref := range refs {
+		if ref.MapKey != nil {
+			line = min(line, ref.MapKey.Range.Start.Line)
+		}
+	}
+	return line
+}
+
+func earliestEdgeLine(refs []d2graph.EdgeReference) int {
+	line := math.MaxInt32
+	for _, ref := range refs {
+		if ref.MapKey != nil {
+			line = min(line, ref.MapKey.Range.Start.Line)
+		}
+	}
+	return line
+}
+
+// relativeLines makes lines relative to the first, so they don't change when the board moves
+func relativeLines(lineSets ...[]int) {
+	first := math.MaxInt32
+	for _, lines := range lineSets {
+		for _, l := range lines {
+			first = min(first, l)
+		}
+	}
+	for _, lines := range lineSets {
+		for i, l := range lines {
+			if l != math.MaxInt32 {
+				lines[i] = l - first
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package d2lib_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+func TestLayoutCache(t *testing.T) {
+	t.Parallel()
+
+	ruler, err := textmeasure.NewRuler()
+	assert.Nil(t, err)
+
+	// laidOut are the boards laid out by the last compile, by their first object
+	var laidOut []string
+	layoutResolver := func(engine string) (d2graph.LayoutGraph, error) {
+		return func(ctx context.Context, g *d2graph.Graph) error {
+			laidOut = append(laidOut, g.Objects[0].AbsID())
+			return d2dagrelayout.Layout(ctx, g, nil)
+		}, nil
+	}
+	cache := d2lib.NewLayoutCache()
+	compile := func(script string) *d2target.Diagram {
+		t.Helper()
+		laidOut = nil
+		d, _, err := d2lib.Compile(context.Background(), script, &d2lib.CompileOptions{
+			Ruler:          ruler,
+			Layout:         go2.Pointer("dagre"),
+			LayoutResolver: layoutResolver,
+			LayoutCache:    cache,
+		}, &d2svg.RenderOpts{})
+		assert.Nil(t, err)
+		return d
+	}
+
+	script := `a -> b
+layers: {
+  x: {
+    c -> d
+  }
+  y: {
+    e -> f
+  }
+}
+`
+	d1 := compile(script)
+	assert.Equal(t, "a, c, e", strings.Join(laidOut, ", "))
+	assert.Equal(t, 3, cache.Len())
+
+	d2 := compile(script)
+	assert.Equal(t, "", strings.Join(laidOut, ", "))
+	assert.Equal(t, d1, d2)
+
+	// Editing a board lays out only it again, even though the boards after it moved down
+	d3 := compile(strings.Replace(script, "a -> b", "a -> b\nb -> a", 1))
+	assert.Equal(t, "a", strings.Join(laidOut, ", "))
+	assert.Equal(t, 3, cache.Len())
+	// and where what's in them is declared moves down with them
+	assert.Equal(t, "4:5", d1.Layers[0].Shapes[0].Range.String())
+	assert.Equal(t, "5:5", d3.Layers[0].Shapes[0].Range.String())
+
+	compile(strings.Replace(script, "e -> f", "e -> f: label", 1))
+	assert.Equal(t, "a, e", strings.Join(laidOut, ", "))
+
+	// Boards that aren't compiled anymore are evicted
+	compile(`a -> b`)
+	assert.Equal(t, "", strings.Join(laidOut, ", "))
+	assert.Equal(t, 1, cache.Len())
+}
@@ -0,0 +1,136 @@
+package d2lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// Changelog compiles two versions of a script and summarizes in Markdown what changed on its
+// board, e.g. for the description of a pull request changing an architecture diagram. Of
+// compileOpts, only UTF16Pos, FS and InputPath are used, for both versions.
+func Changelog(ctx context.Context, oldInput, newInput string, compileOpts *CompileOptions) (string, error) {
+	if compileOpts == nil {
+		compileOpts = &CompileOptions{}
+	}
+	opts := &d2compiler.CompileOptions{
+		UTF16Pos:    compileOpts.UTF16Pos,
+		FS:          compileOpts.FS,
+		IconDir:     compileOpts.IconDir,
+		FetchImport: compileOpts.FetchImport,
+		Defines:     compileOpts.Defines,
+	}
+	oldGraph, _, err := d2compiler.Compile(compileOpts.InputPath, strings.NewReader(oldInput), opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to compile old version: %w", err)
+	}
+	newGraph, _, err := d2compiler.Compile(compileOpts.InputPath, strings.NewReader(newInput), opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to compile new version: %w", err)
+	}
+	return changelog(d2graph.Diff(oldGraph, newGraph)), nil
+}
+
+func changelog(d *d2graph.GraphDiff) string {
+	if d.Empty() {
+		return "No changes.\n"
+	}
+
+	var added, removed, renamed, restyled, changed []string
+	for _, obj := range d.AddedObjects {
+		added = append(added, changelogCode(d2graph.ObjectKey(obj)))
+	}
+	for _, e := range d.AddedEdges {
+		added = append(added, "connection "+changelogEdge(e))
+	}
+	for _, obj := range d.RemovedObjects {
+		removed = append(removed, changelogCode(d2graph.ObjectKey(obj)))
+	}
+	for _, e := range d.RemovedEdges {
+		removed = append(removed, "connection "+changelogEdge(e))
+	}
+	for _, od := range d.RenamedObjects {
+		renamed = append(renamed, fmt.Sprintf("%s to %s", changelogCode(d2graph.ObjectKey(od.Old)), changelogCode(d2graph.ObjectKey(od.New))))
+	}
+	split := func(subject string, changes []d2graph.AttributeChange) {
+		var styles, others []string
+		for _, c := range changes {
+			if strings.HasPrefix(c.Attribute, "style.") {
+				styles = append(styles, changelogChange(c))
+			} else {
+				others = append(others, changelogChange(c))
+			}
+		}
+		if len(styles) > 0 {
+			restyled = append(restyled, subject+": "+strings.Join(styles, ", "))
+		}
+		if len(others) > 0 {
+			changed = append(changed, subject+": "+strings.Join(others, ", "))
+		}
+	}
+	for _, od := range d.ModifiedObjects {
+		split(changelogCode(d2graph.ObjectKey(od.New)), od.Changes)
+	}
+	for _, ed := range d.ModifiedEdges {
+		split("connection "+changelogEdge(ed.New), ed.Changes)
+	}
+
+	var sb strings.Builder
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"Added", added},
+		{"Removed", removed},
+		{"Renamed", renamed},
+		{"Restyled", restyled},
+		{"Changed", changed},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "### %s\n\n", section.title)
+		for _, item := range section.items {
+			fmt.Fprintf(&sb, "- %s\n", item)
+		}
+	}
+	return sb.String()
+}
+
+// changelogEdge names e by its endpoints, with its index only when there are several
+func changelogEdge(e *d2graph.Edge) string {
+	name := fmt.Sprintf("%s %s %s", d2graph.ObjectKey(e.Src), e.ArrowString(), d2graph.ObjectKey(e.Dst))
+	if e.Index > 0 {
+		name = fmt.Sprintf("(%s)[%d]", name, e.Index)
+	}
+	return changelogCode(name)
+}
+
+func changelogChange(c d2graph.AttributeChange) string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s set to %s", changelogCode(c.Attribute), changelogCode(c.New))
+	case c.New == "":
+		return fmt.Sprintf("%s unset (was %s)", changelogCode(c.Attribute), changelogCode(c.Old))
+	default:
+		return fmt.Sprintf("%s from %s to %s", changelogCode(c.Attribute), changelogCode(c.Old), changelogCode(c.New))
+	}
+}
+
+// changelogCode formats s as inline code, with enough backticks to hold the ones in s
+func changelogCode(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
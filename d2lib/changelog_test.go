@@ -0,0 +1,48 @@
+package d2lib_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2lib"
+)
+
+func TestChangelog(t *testing.T) {
+	t.Parallel()
+
+	old := `users -> api: requests
+api -> db
+api -> cache
+cache.style.fill: red
+legacy
+`
+	new := `users -> gateway: requests
+gateway -> db
+gateway -> cache
+gateway -> queue
+cache.style.fill: blue
+cache.tooltip: hot keys
+`
+	got, err := d2lib.Changelog(context.Background(), old, new, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "### Added\n\n"+
+		"- `queue`\n"+
+		"- connection `gateway -> queue`\n"+
+		"\n### Removed\n\n"+
+		"- `legacy`\n"+
+		"\n### Renamed\n\n"+
+		"- `api` to `gateway`\n"+
+		"\n### Restyled\n\n"+
+		"- `cache`: `style.fill` from `red` to `blue`\n"+
+		"\n### Changed\n\n"+
+		"- `cache`: `tooltip` set to `hot keys`\n", got)
+
+	got, err = d2lib.Changelog(context.Background(), old, old, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "No changes.\n", got)
+
+	_, err = d2lib.Changelog(context.Background(), old, "a -> ", nil)
+	assert.ErrorContains(t, err, "failed to compile new version")
+}
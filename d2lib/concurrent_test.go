@@ -0,0 +1,97 @@
+package d2lib_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2layouts/d2elklayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+// TestCompileConcurrent compiles and renders with a shared Ruler from several goroutines, to
+// be run with -race
+func TestCompileConcurrent(t *testing.T) {
+	t.Parallel()
+
+	ruler, err := textmeasure.NewRuler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layoutResolver := func(engine string) (d2graph.LayoutGraph, error) {
+		switch engine {
+		case "elk":
+			return func(ctx context.Context, g *d2graph.Graph) error {
+				return d2elklayout.Layout(ctx, g, nil)
+			}, nil
+		default:
+			return func(ctx context.Context, g *d2graph.Graph) error {
+				return d2dagrelayout.Layout(ctx, g, nil)
+			}, nil
+		}
+	}
+
+	themeIDs := []int64{0, 1, 3, 4}
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			layout := "dagre"
+			if i%2 == 1 {
+				layout = "elk"
+			}
+			script := fmt.Sprintf(`vars: {
+  d2-config: {
+    theme-id: %d
+    theme-overrides: {
+      B1: "#%06d"
+    }
+  }
+}
+x%d: "*bold* label" {shape: hexagon}
+y: |md
+  # Markdown %d
+|
+t: {
+  shape: sql_table
+  id: int {constraint: primary_key}
+}
+x%d -> y -> t: %d
+layers: {
+  l: {
+    a -> b
+  }
+}
+`, themeIDs[i%len(themeIDs)], i, i, i, i, i)
+			diagram, _, err := d2lib.Compile(context.Background(), script, &d2lib.CompileOptions{
+				Ruler:          ruler,
+				Layout:         go2.Pointer(layout),
+				LayoutResolver: layoutResolver,
+			}, &d2svg.RenderOpts{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			_, err = d2svg.Render(diagram, &d2svg.RenderOpts{
+				ThemeID: go2.Pointer(themeIDs[i%len(themeIDs)]),
+			})
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -3,6 +3,7 @@ package d2lib
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"strings"
@@ -12,7 +13,11 @@ import (
 	"oss.terrastruct.com/d2/d2exporter"
 	"oss.terrastruct.com/d2/d2graph"
 	"oss.terrastruct.com/d2/d2layouts"
+	"oss.terrastruct.com/d2/d2layouts/d2bundle"
+	"oss.terrastruct.com/d2/d2layouts/d2compact"
 	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2layouts/d2ratio"
+	"oss.terrastruct.com/d2/d2layouts/d2snap"
 	"oss.terrastruct.com/d2/d2parser"
 	"oss.terrastruct.com/d2/d2renderers/d2fonts"
 	"oss.terrastruct.com/d2/d2renderers/d2svg"
@@ -23,15 +28,42 @@ import (
 )
 
 type CompileOptions struct {
-	UTF16Pos       bool
-	FS             fs.FS
-	MeasuredTexts  []*d2target.MText
-	Ruler          *textmeasure.Ruler
+	UTF16Pos      bool
+	FS            fs.FS
+	MeasuredTexts []*d2target.MText
+	Ruler         *textmeasure.Ruler
+	// TextMeasurer, if given, measures texts instead of Ruler, e.g. with canvas measureText
+	// in browsers.
+	TextMeasurer   textmeasure.TextMeasurer
 	RouterResolver func(engine string) (d2graph.RouteEdges, error)
 	LayoutResolver func(engine string) (d2graph.LayoutGraph, error)
 
 	Layout *string
 
+	// Legend, if "bottom" or "right", adds a legend of the classes and shapes used in each
+	// board on that side of it.
+	Legend *string
+
+	// TargetRatio, if positive, is the width over the height each board is laid out to be
+	// closest to, e.g. 16/9 for slides, see d2ratio.Layout.
+	TargetRatio float64
+
+	// Medium, if given, is the name of the medium to export for, which sets the default font
+	// sizes, stroke widths and padding, see d2graph.Mediums.
+	Medium *string
+
+	// Compact slides the shapes of each board together after layout, removing the whitespace
+	// between ranks that their connections don't need, see d2compact.Compact.
+	Compact bool
+
+	// HighlightSteps styles what each step adds and removes compared to the step before it,
+	// see d2graph.Graph.HighlightSteps.
+	HighlightSteps bool
+
+	// Snap, if positive, snaps the shapes and connections of each board to a grid of this many
+	// pixels after layout, see d2snap.Snap.
+	Snap *int64
+
 	// FontFamily controls the font family used for all texts that are not the following:
 	// - code
 	// - latex
@@ -40,6 +72,45 @@ type CompileOptions struct {
 	FontFamily *d2fonts.FontFamily
 
 	InputPath string
+
+	// Stylesheet, if given, is a file of classes shared by every board, which the script can
+	// override, e.g. so all the diagrams of a repository style services the same way.
+	Stylesheet *d2ast.Map
+
+	// IconDir is the directory of icon packs, which icons like "@aws/s3" are found in.
+	IconDir string
+
+	// FetchImport, if given, returns the file at the URL of a remote import, like
+	// "https://example.com/lib.d2", see remoteimport.Fetcher.
+	FetchImport func(url string) ([]byte, error)
+
+	// Defines set the vars of the root board with the same names, like --define env=prod,
+	// so that ifs can compile parts of the diagram per environment.
+	Defines map[string]string
+
+	// Boards, if given, are patterns of the boards to compile, see MatchBoard. Other boards
+	// are emptied into folders, so they aren't laid out or rendered.
+	Boards []string
+
+	// Collapse are the IDs of containers to draw without their contents, see
+	// d2graph.Graph.CollapseContainer.
+	Collapse []string
+	// Depth, if positive, collapses the objects nested at that depth, see
+	// d2graph.Graph.FilterByDepth.
+	Depth int
+	// Focus, if given, is the ID of the object to only keep the neighborhood of, up to
+	// FocusRadius connections away, see d2graph.Graph.FocusNeighborhood.
+	Focus       string
+	FocusRadius int
+
+	// Partial, if set, compiles what parses of input when some doesn't, and returns its
+	// diagram along with the parse errors, e.g. to preview while input is mid-edit, see
+	// d2compiler.CompileOptions.Partial.
+	Partial bool
+
+	// LayoutCache, if given, keeps the boards laid out by each compile, and reuses them in
+	// the next compiles for boards that didn't change instead of laying them out again.
+	LayoutCache *LayoutCache
 }
 
 func Parse(ctx context.Context, input string, compileOpts *CompileOptions) (*d2ast.Map, error) {
@@ -53,6 +124,12 @@ func Parse(ctx context.Context, input string, compileOpts *CompileOptions) (*d2a
 	return ast, err
 }
 
+// Compile compiles input, lays it out, and exports it and all its boards.
+//
+// Compile is safe to call from multiple goroutines. compileOpts and renderOpts are filled in
+// with the d2-config of input and defaults, so each call needs its own, but one Ruler can be
+// shared by all calls. Bundled layout plugins keep their options process-wide, so layouts
+// with different options per call should be given through LayoutResolver.
 func Compile(ctx context.Context, input string, compileOpts *CompileOptions, renderOpts *d2svg.RenderOpts) (*d2target.Diagram, *d2graph.Graph, error) {
 	if compileOpts == nil {
 		compileOpts = &CompileOptions{}
@@ -62,39 +139,159 @@ func Compile(ctx context.Context, input string, compileOpts *CompileOptions, ren
 	}
 
 	g, config, err := d2compiler.Compile(compileOpts.InputPath, strings.NewReader(input), &d2compiler.CompileOptions{
-		UTF16Pos: compileOpts.UTF16Pos,
-		FS:       compileOpts.FS,
+		UTF16Pos:    compileOpts.UTF16Pos,
+		FS:          compileOpts.FS,
+		Stylesheet:  compileOpts.Stylesheet,
+		IconDir:     compileOpts.IconDir,
+		FetchImport: compileOpts.FetchImport,
+		Defines:     compileOpts.Defines,
+		Partial:     compileOpts.Partial,
 	})
-	if err != nil {
+	if g == nil {
 		return nil, nil, err
 	}
+	// Only parse errors leave a graph, which is compiled and returned with them
+	parseErr := err
 
 	applyConfigs(config, compileOpts, renderOpts)
+	if err := applyMedium(compileOpts, renderOpts); err != nil {
+		return nil, nil, err
+	}
 	applyDefaults(compileOpts, renderOpts)
 
+	// Steps are compared before boards are selected, so each is still compared to the one
+	// before it when that one isn't rendered
+	if compileOpts.HighlightSteps {
+		g.HighlightSteps()
+	}
+	if len(compileOpts.Boards) > 0 && !selectBoards(g, []string{}, compileOpts.Boards) {
+		return nil, nil, fmt.Errorf("no boards match %s", strings.Join(compileOpts.Boards, ", "))
+	}
+	if err := transform(g, compileOpts); err != nil {
+		return nil, nil, err
+	}
+
+	var generation int
+	if compileOpts.LayoutCache != nil {
+		generation = compileOpts.LayoutCache.begin()
+	}
+
 	d, err := compile(ctx, g, compileOpts, renderOpts)
+	if err == nil {
+		err = parseErr
+	}
+	// Boards that didn't parse aren't evicted, as they'll likely be back unchanged
+	if compileOpts.LayoutCache != nil && err == nil {
+		compileOpts.LayoutCache.end(generation)
+	}
 	if d != nil {
 		d.Config = config
+		embedBoards(d, d)
 	}
 	return d, g, err
 }
 
+// embedBoards sets the diagrams board shapes in d and its boards embed, now that every board
+// is laid out. Boards that weren't selected to be compiled are left out.
+func embedBoards(root, d *d2target.Diagram) {
+	for i, s := range d.Shapes {
+		if s.Board == "" {
+			continue
+		}
+		kp, err := d2parser.ParseKey(s.Board)
+		if err != nil {
+			continue
+		}
+		d.Shapes[i].BoardDiagram = root.GetBoard(kp.IDA()[1:])
+	}
+	for _, boards := range [][]*d2target.Diagram{d.Layers, d.Scenarios, d.Steps} {
+		for _, b := range boards {
+			embedBoards(root, b)
+		}
+	}
+}
+
 func compile(ctx context.Context, g *d2graph.Graph, compileOpts *CompileOptions, renderOpts *d2svg.RenderOpts) (*d2target.Diagram, error) {
 	err := g.ApplyTheme(*renderOpts.ThemeID)
 	if err != nil {
 		return nil, err
 	}
 
+	if compileOpts.Medium != nil {
+		m, err := d2graph.FindMedium(*compileOpts.Medium)
+		if err != nil {
+			return nil, err
+		}
+		g.ApplyMedium(m)
+	}
+
+	g.RemoveHidden()
+	g.CollapseMarked()
+
+	d, err := layoutBoard(ctx, g, compileOpts, renderOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range g.Layers {
+		ld, err := compile(ctx, l, compileOpts, renderOpts)
+		if err != nil {
+			return nil, err
+		}
+		d.Layers = append(d.Layers, ld)
+	}
+	for _, l := range g.Scenarios {
+		ld, err := compile(ctx, l, compileOpts, renderOpts)
+		if err != nil {
+			return nil, err
+		}
+		d.Scenarios = append(d.Scenarios, ld)
+	}
+	for _, l := range g.Steps {
+		ld, err := compile(ctx, l, compileOpts, renderOpts)
+		if err != nil {
+			return nil, err
+		}
+		d.Steps = append(d.Steps, ld)
+	}
+	return d, nil
+}
+
+// layoutBoard lays out and exports board g without its layers, scenarios and steps, or reuses
+// the same board laid out before from compileOpts.LayoutCache
+func layoutBoard(ctx context.Context, g *d2graph.Graph, compileOpts *CompileOptions, renderOpts *d2svg.RenderOpts) (*d2target.Diagram, error) {
 	if len(g.Objects) > 0 {
-		err := g.SetDimensions(compileOpts.MeasuredTexts, compileOpts.Ruler, compileOpts.FontFamily)
+		err := g.SetDimensions(compileOpts.MeasuredTexts, compileOpts.textMeasurer(), compileOpts.FontFamily)
 		if err != nil {
 			return nil, err
 		}
+	}
 
+	var cacheKey string
+	if compileOpts.LayoutCache != nil {
+		var err error
+		cacheKey, err = layoutCacheKey(g, compileOpts, renderOpts)
+		if err != nil {
+			return nil, err
+		}
+		d, err := compileOpts.LayoutCache.get(cacheKey)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			d2exporter.ExportRanges(g, d)
+			return d, nil
+		}
+	}
+
+	if len(g.Objects) > 0 {
 		coreLayout, err := getLayout(compileOpts)
 		if err != nil {
 			return nil, err
 		}
+		if compileOpts.TargetRatio > 0 {
+			coreLayout = d2ratio.Layout(compileOpts.TargetRatio, coreLayout)
+		}
 		edgeRouter, err := getEdgeRouter(compileOpts)
 		if err != nil {
 			return nil, err
@@ -105,37 +302,47 @@ func compile(ctx context.Context, g *d2graph.Graph, compileOpts *CompileOptions,
 		if err != nil {
 			return nil, err
 		}
+		if g.IsDirectionMirrored() {
+			g.MirrorDirection()
+		}
+		if compileOpts.Compact {
+			d2compact.Compact(g)
+		}
+		d2bundle.Bundle(g)
+		if compileOpts.Snap != nil {
+			d2snap.Snap(g, int(*compileOpts.Snap))
+		}
 	}
 
 	d, err := d2exporter.Export(ctx, g, compileOpts.FontFamily)
 	if err != nil {
 		return nil, err
 	}
-
-	for _, l := range g.Layers {
-		ld, err := compile(ctx, l, compileOpts, renderOpts)
-		if err != nil {
-			return nil, err
-		}
-		d.Layers = append(d.Layers, ld)
-	}
-	for _, l := range g.Scenarios {
-		ld, err := compile(ctx, l, compileOpts, renderOpts)
+	if compileOpts.Legend != nil {
+		err = addLegend(ctx, g, d, *compileOpts.Legend, compileOpts, renderOpts)
 		if err != nil {
 			return nil, err
 		}
-		d.Scenarios = append(d.Scenarios, ld)
 	}
-	for _, l := range g.Steps {
-		ld, err := compile(ctx, l, compileOpts, renderOpts)
-		if err != nil {
+
+	if compileOpts.LayoutCache != nil {
+		if err := compileOpts.LayoutCache.put(cacheKey, d); err != nil {
 			return nil, err
 		}
-		d.Steps = append(d.Steps, ld)
 	}
 	return d, nil
 }
 
+func (opts *CompileOptions) textMeasurer() textmeasure.TextMeasurer {
+	if opts.TextMeasurer != nil {
+		return opts.TextMeasurer
+	}
+	if opts.Ruler != nil {
+		return opts.Ruler
+	}
+	return nil
+}
+
 func getLayout(opts *CompileOptions) (d2graph.LayoutGraph, error) {
 	if opts.Layout != nil {
 		return opts.LayoutResolver(*opts.Layout)
@@ -172,6 +379,12 @@ func applyConfigs(config *d2target.Config, compileOpts *CompileOptions, renderOp
 	if compileOpts.Layout == nil {
 		compileOpts.Layout = config.LayoutEngine
 	}
+	if compileOpts.Legend == nil {
+		compileOpts.Legend = config.Legend
+	}
+	if compileOpts.Snap == nil {
+		compileOpts.Snap = config.Snap
+	}
 
 	if renderOpts.ThemeID == nil {
 		renderOpts.ThemeID = config.ThemeID
@@ -188,10 +401,28 @@ func applyConfigs(config *d2target.Config, compileOpts *CompileOptions, renderOp
 	if renderOpts.Center == nil {
 		renderOpts.Center = config.Center
 	}
+	if renderOpts.EdgeJumps == nil {
+		renderOpts.EdgeJumps = config.EdgeJumps
+	}
 	renderOpts.ThemeOverrides = config.ThemeOverrides
 	renderOpts.DarkThemeOverrides = config.DarkThemeOverrides
 }
 
+// applyMedium checks the medium of compileOpts, and pads by its default unless a pad was given
+func applyMedium(compileOpts *CompileOptions, renderOpts *d2svg.RenderOpts) error {
+	if compileOpts.Medium == nil {
+		return nil
+	}
+	m, err := d2graph.FindMedium(*compileOpts.Medium)
+	if err != nil {
+		return err
+	}
+	if renderOpts.Pad == nil {
+		renderOpts.Pad = go2.Pointer(m.Pad)
+	}
+	return nil
+}
+
 func applyDefaults(compileOpts *CompileOptions, renderOpts *d2svg.RenderOpts) {
 	if compileOpts.Layout == nil {
 		compileOpts.Layout = go2.Pointer("dagre")
@@ -0,0 +1,172 @@
+package d2lib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2exporter"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// legendGap is the space between a board and its legend
+const legendGap = 50
+
+// legendUnswatchableShapes are shapes that need content to be drawn, so they aren't listed
+// in legends
+var legendUnswatchableShapes = map[string]struct{}{
+	d2target.ShapeRectangle:       {},
+	d2target.ShapeText:            {},
+	d2target.ShapeCode:            {},
+	d2target.ShapeClass:           {},
+	d2target.ShapeSQLTable:        {},
+	d2target.ShapeImage:           {},
+	d2target.ShapeSequenceDiagram: {},
+	d2target.ShapeHierarchy:       {},
+}
+
+// addLegend lays out a legend of the classes and shapes used in g as a separate graph, and
+// adds it to d on the given side, "bottom" or "right"
+func addLegend(ctx context.Context, g *d2graph.Graph, d *d2target.Diagram, side string, compileOpts *CompileOptions, renderOpts *d2svg.RenderOpts) error {
+	script := legendScript(g)
+	if script == "" {
+		return nil
+	}
+
+	lg, _, err := d2compiler.Compile("", strings.NewReader(script), nil)
+	if err != nil {
+		return fmt.Errorf("failed to compile legend: %w", err)
+	}
+	err = lg.ApplyTheme(*renderOpts.ThemeID)
+	if err != nil {
+		return err
+	}
+	err = lg.SetDimensions(compileOpts.MeasuredTexts, compileOpts.textMeasurer(), compileOpts.FontFamily)
+	if err != nil {
+		return err
+	}
+	coreLayout, err := getLayout(compileOpts)
+	if err != nil {
+		return err
+	}
+	edgeRouter, err := getEdgeRouter(compileOpts)
+	if err != nil {
+		return err
+	}
+	err = d2layouts.LayoutNested(ctx, lg, d2layouts.NestedGraphInfo(lg.Root), coreLayout, edgeRouter)
+	if err != nil {
+		return err
+	}
+	ld, err := d2exporter.Export(ctx, lg, compileOpts.FontFamily)
+	if err != nil {
+		return err
+	}
+
+	tl, br := d.BoundingBox()
+	legendTL, _ := ld.BoundingBox()
+	var dx, dy int
+	if side == "right" {
+		dx = br.X + legendGap - legendTL.X
+		dy = tl.Y - legendTL.Y
+	} else {
+		dx = tl.X - legendTL.X
+		dy = br.Y + legendGap - legendTL.Y
+	}
+	for _, s := range ld.Shapes {
+		s.Pos.X += dx
+		s.Pos.Y += dy
+		d.Shapes = append(d.Shapes, s)
+	}
+	return nil
+}
+
+// legendScript returns D2 for a legend with a swatch of each class used by objects of g,
+// styled like the first object with it, and one of each shape that isn't drawn with a class.
+// It returns "" if there's nothing to list.
+func legendScript(g *d2graph.Graph) string {
+	var classes []string
+	classObjects := make(map[string]*d2graph.Object)
+	var shapes []string
+	seenShapes := make(map[string]struct{})
+	for _, obj := range g.Objects {
+		if len(obj.Classes) > 0 {
+			class := obj.Classes[0]
+			if _, ok := classObjects[class]; !ok {
+				classes = append(classes, class)
+				classObjects[class] = obj
+			}
+			continue
+		}
+		shape := strings.ToLower(obj.Shape.Value)
+		if _, ok := legendUnswatchableShapes[shape]; ok || shape == "" {
+			continue
+		}
+		if _, ok := seenShapes[shape]; !ok {
+			shapes = append(shapes, shape)
+			seenShapes[shape] = struct{}{}
+		}
+	}
+	if len(classes) == 0 && len(shapes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	// Defining rows first fills the grid row by row, so each swatch is next to its label
+	fmt.Fprintf(&sb, "d2-legend: Legend {\n  grid-rows: %d\n  grid-columns: 2\n  grid-gap: 12\n", len(classes)+len(shapes))
+	i := 0
+	writeEntry := func(label, shape string, style *d2graph.Style) {
+		fmt.Fprintf(&sb, "  %d: \"\" {\n    width: 40\n    height: 24\n", i)
+		if shape != "" {
+			fmt.Fprintf(&sb, "    shape: %s\n", strconv.Quote(shape))
+		}
+		if style != nil {
+			writeLegendStyle(&sb, style)
+		}
+		sb.WriteString("  }\n")
+		fmt.Fprintf(&sb, "  %d-label: %s {shape: text}\n", i, strconv.Quote(label))
+		i++
+	}
+	for _, class := range classes {
+		obj := classObjects[class]
+		shape := strings.ToLower(obj.Shape.Value)
+		if _, ok := legendUnswatchableShapes[shape]; ok {
+			shape = ""
+		}
+		writeEntry(class, shape, &obj.Style)
+	}
+	for _, shape := range shapes {
+		writeEntry(strings.ReplaceAll(shape, "_", " "), shape, nil)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// writeLegendStyle writes the styles of style that show on a swatch
+func writeLegendStyle(sb *strings.Builder, style *d2graph.Style) {
+	for _, s := range []struct {
+		key   string
+		value *d2graph.Scalar
+	}{
+		{"opacity", style.Opacity},
+		{"stroke", style.Stroke},
+		{"fill", style.Fill},
+		{"fill-pattern", style.FillPattern},
+		{"stroke-width", style.StrokeWidth},
+		{"stroke-dash", style.StrokeDash},
+		{"border-radius", style.BorderRadius},
+		{"shadow", style.Shadow},
+		{"3d", style.ThreeDee},
+		{"multiple", style.Multiple},
+		{"double-border", style.DoubleBorder},
+		{"border-style", style.BorderStyle},
+	} {
+		if s.value != nil {
+			fmt.Fprintf(sb, "    style.%s: %s\n", s.key, strconv.Quote(s.value.Value))
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package d2lib_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+func TestLegend(t *testing.T) {
+	t.Parallel()
+
+	ruler, err := textmeasure.NewRuler()
+	assert.Nil(t, err)
+	compile := func(t *testing.T, input string, legend *string) *d2target.Diagram {
+		diagram, _, err := d2lib.Compile(context.Background(), input, &d2lib.CompileOptions{
+			Ruler:  ruler,
+			Layout: go2.Pointer("dagre"),
+			LayoutResolver: func(engine string) (d2graph.LayoutGraph, error) {
+				return func(ctx context.Context, g *d2graph.Graph) error {
+					return d2dagrelayout.Layout(ctx, g, nil)
+				}, nil
+			},
+			Legend: legend,
+		}, nil)
+		assert.Nil(t, err)
+		return diagram
+	}
+	split := func(d *d2target.Diagram) (shapes, legend []d2target.Shape) {
+		for _, s := range d.Shapes {
+			if strings.HasPrefix(s.ID, "d2-legend") {
+				legend = append(legend, s)
+			} else {
+				shapes = append(shapes, s)
+			}
+		}
+		return shapes, legend
+	}
+
+	input := `classes: {
+  db: {
+    shape: cylinder
+    style.fill: "#f0e0ff"
+  }
+}
+a.class: db
+b.class: db
+c.shape: person
+d.shape: text
+a -> b -> c
+`
+
+	t.Run("bottom", func(t *testing.T) {
+		t.Parallel()
+
+		d := compile(t, "vars: {d2-config: {legend: bottom}}\n"+input, nil)
+		shapes, legend := split(d)
+		assert.Equal(t, 4, len(shapes))
+
+		var labels []string
+		for _, s := range legend {
+			if s.Type == d2target.ShapeText {
+				labels = append(labels, s.Label)
+			}
+		}
+		assert.Equal(t, []string{"db", "person"}, labels)
+		assert.Equal(t, "cylinder", legend[1].Type)
+		assert.Equal(t, "#f0e0ff", legend[1].Fill)
+
+		boardTL, boardBR := (&d2target.Diagram{Shapes: shapes}).BoundingBox()
+		legendTL, _ := (&d2target.Diagram{Shapes: legend}).BoundingBox()
+		assert.Equal(t, boardTL.X, legendTL.X)
+		assert.Equal(t, boardBR.Y+50, legendTL.Y)
+	})
+
+	t.Run("right", func(t *testing.T) {
+		t.Parallel()
+
+		// Passed in options take precedence over d2-config
+		d := compile(t, "vars: {d2-config: {legend: bottom}}\n"+input, go2.Pointer("right"))
+		shapes, legend := split(d)
+		boardTL, boardBR := (&d2target.Diagram{Shapes: shapes}).BoundingBox()
+		legendTL, _ := (&d2target.Diagram{Shapes: legend}).BoundingBox()
+		assert.Equal(t, boardBR.X+50, legendTL.X)
+		assert.Equal(t, boardTL.Y, legendTL.Y)
+	})
+
+	t.Run("nothing to list", func(t *testing.T) {
+		t.Parallel()
+
+		d := compile(t, "vars: {d2-config: {legend: bottom}}\na -> b\n", nil)
+		_, legend := split(d)
+		assert.Equal(t, 0, len(legend))
+	})
+}
@@ -0,0 +1,111 @@
+package d2lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// Session builds a script one statement at a time, for notebooks and REPLs. Each statement is
+// compiled with the ones before it, and only kept when that succeeds, so the session always
+// holds a script that compiles.
+type Session struct {
+	compileOpts *CompileOptions
+	statements  []string
+	graph       *d2graph.Graph
+}
+
+// NewSession starts an empty session. Of compileOpts, only UTF16Pos, FS and InputPath are used
+// to compile each statement, but all of them are used by Compile.
+func NewSession(compileOpts *CompileOptions) *Session {
+	if compileOpts == nil {
+		compileOpts = &CompileOptions{}
+	}
+	return &Session{
+		compileOpts: compileOpts,
+	}
+}
+
+// Eval appends input, one or more statements like `a -> b` or `a.style.fill: red`, to the
+// script and returns the graph it compiles to. If it doesn't compile, the session is left as it
+// was. Errors within input itself are positioned in input rather than in the script.
+func (s *Session) Eval(ctx context.Context, input string) (*d2graph.Graph, error) {
+	if strings.TrimSpace(input) == "" {
+		return s.Graph(), nil
+	}
+	statements := append(s.statements[:len(s.statements):len(s.statements)], input)
+	g, err := s.compile(statements)
+	if err != nil {
+		// Compiled alone, errors within input point into it rather than the whole script
+		if _, _, inputErr := d2compiler.Compile(s.compileOpts.InputPath, strings.NewReader(input), s.compilerOptions()); inputErr != nil {
+			return nil, inputErr
+		}
+		return nil, err
+	}
+	s.statements = statements
+	s.graph = g
+	return g, nil
+}
+
+// Undo removes the last statement evaluated, and returns the graph of the ones before it
+func (s *Session) Undo(ctx context.Context) (*d2graph.Graph, error) {
+	if len(s.statements) == 0 {
+		return nil, fmt.Errorf("nothing to undo")
+	}
+	statements := s.statements[:len(s.statements)-1]
+	var g *d2graph.Graph
+	if len(statements) > 0 {
+		var err error
+		g, err = s.compile(statements)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.statements = statements
+	s.graph = g
+	return s.Graph(), nil
+}
+
+// Graph is the graph of the statements evaluated so far
+func (s *Session) Graph() *d2graph.Graph {
+	if s.graph == nil {
+		g, _ := s.compile(nil)
+		return g
+	}
+	return s.graph
+}
+
+// Script is the statements evaluated so far, one after the other
+func (s *Session) Script() string {
+	if len(s.statements) == 0 {
+		return ""
+	}
+	return strings.Join(s.statements, "\n") + "\n"
+}
+
+// Compile lays out the script so far into a diagram, like the package level Compile
+func (s *Session) Compile(ctx context.Context, renderOpts *d2svg.RenderOpts) (*d2target.Diagram, *d2graph.Graph, error) {
+	return Compile(ctx, s.Script(), s.compileOpts, renderOpts)
+}
+
+func (s *Session) compile(statements []string) (*d2graph.Graph, error) {
+	script := strings.Join(statements, "\n")
+	g, _, err := d2compiler.Compile(s.compileOpts.InputPath, strings.NewReader(script), s.compilerOptions())
+	return g, err
+}
+
+func (s *Session) compilerOptions() *d2compiler.CompileOptions {
+	return &d2compiler.CompileOptions{
+		UTF16Pos:    s.compileOpts.UTF16Pos,
+		FS:          s.compileOpts.FS,
+		Stylesheet:  s.compileOpts.Stylesheet,
+		IconDir:     s.compileOpts.IconDir,
+		FetchImport: s.compileOpts.FetchImport,
+		Defines:     s.compileOpts.Defines,
+	}
+}
@@ -0,0 +1,44 @@
+package d2lib_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2lib"
+)
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := d2lib.NewSession(nil)
+	assert.Len(t, s.Graph().Objects, 0)
+
+	g, err := s.Eval(ctx, "a -> b")
+	assert.Nil(t, err)
+	assert.Len(t, g.Objects, 2)
+	assert.Len(t, g.Edges, 1)
+
+	g, err = s.Eval(ctx, "a.style.fill: red")
+	assert.Nil(t, err)
+	assert.Equal(t, "red", g.Objects[0].Style.Fill.Value)
+
+	_, err = s.Eval(ctx, "b.shape: hexagonal")
+	assert.ErrorContains(t, err, "1:10")
+	_, err = s.Eval(ctx, "c -> ")
+	assert.ErrorContains(t, err, "1:")
+	assert.Equal(t, "a -> b\na.style.fill: red\n", s.Script())
+
+	g, err = s.Undo(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, g.Objects[0].Style.Fill)
+	assert.Equal(t, "a -> b\n", s.Script())
+
+	g, err = s.Undo(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, g.Objects, 0)
+	_, err = s.Undo(ctx)
+	assert.ErrorContains(t, err, "nothing to undo")
+}
@@ -0,0 +1,49 @@
+package d2lib_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2renderers/d2fonts"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+// fixedMeasurer measures every character as 10x20
+type fixedMeasurer struct{}
+
+func (fixedMeasurer) Measure(font d2fonts.Font, s string) (width, height int) {
+	return 10 * len(s), 20
+}
+
+func (fixedMeasurer) MeasureCode(font d2fonts.Font, s string) (width, height int) {
+	return 10 * len(s), 20
+}
+
+func (fixedMeasurer) MeasureMarkdown(mdText string, fontFamily *d2fonts.FontFamily, fontSize int) (width, height int, err error) {
+	return 10 * len(mdText), 20, nil
+}
+
+func TestTextMeasurer(t *testing.T) {
+	t.Parallel()
+
+	diagram, _, err := d2lib.Compile(context.Background(), "a: hello\nb: |md # hi |\na -> b: to\n", &d2lib.CompileOptions{
+		TextMeasurer: fixedMeasurer{},
+		Layout:       go2.Pointer("dagre"),
+		LayoutResolver: func(engine string) (d2graph.LayoutGraph, error) {
+			return func(ctx context.Context, g *d2graph.Graph) error {
+				return d2dagrelayout.Layout(ctx, g, nil)
+			}, nil
+		},
+	}, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 50, diagram.Shapes[0].LabelWidth)
+	assert.Equal(t, 20, diagram.Shapes[0].LabelHeight)
+	assert.Equal(t, 40, diagram.Shapes[1].LabelWidth)
+	assert.Equal(t, 20, diagram.Connections[0].LabelHeight)
+}
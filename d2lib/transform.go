@@ -0,0 +1,61 @@
+package d2lib
+
+import (
+	"fmt"
+
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// transform applies the transforms of compileOpts to every board that has the objects they
+// name. Each object must be in at least one board.
+func transform(g *d2graph.Graph, compileOpts *CompileOptions) error {
+	if len(compileOpts.Collapse) == 0 && compileOpts.Depth <= 0 && compileOpts.Focus == "" {
+		return nil
+	}
+	found := make(map[string]bool)
+	err := transformBoard(g, compileOpts, found)
+	if err != nil {
+		return err
+	}
+	for _, id := range compileOpts.Collapse {
+		if !found[id] {
+			return fmt.Errorf("cannot collapse %q: no board has it", id)
+		}
+	}
+	if compileOpts.Focus != "" && !found[compileOpts.Focus] {
+		return fmt.Errorf("cannot focus on %q: no board has it", compileOpts.Focus)
+	}
+	return nil
+}
+
+func transformBoard(g *d2graph.Graph, compileOpts *CompileOptions, found map[string]bool) error {
+	for _, id := range compileOpts.Collapse {
+		if !g.HasObject(id) {
+			continue
+		}
+		found[id] = true
+		if err := g.CollapseContainer(id); err != nil {
+			return err
+		}
+	}
+	if compileOpts.Depth > 0 {
+		if err := g.FilterByDepth(compileOpts.Depth); err != nil {
+			return err
+		}
+	}
+	if compileOpts.Focus != "" && g.HasObject(compileOpts.Focus) {
+		found[compileOpts.Focus] = true
+		if err := g.FocusNeighborhood(compileOpts.Focus, compileOpts.FocusRadius); err != nil {
+			return err
+		}
+	}
+
+	for _, boards := range [][]*d2graph.Graph{g.Layers, g.Scenarios, g.Steps} {
+		for _, b := range boards {
+			if err := transformBoard(b, compileOpts, found); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+// Package d2lint checks compiled graphs for problems that compile, but make diagrams harder to
+// read or maintain, like shapes connected to nothing or labels that can't be read on their fill.
+package d2lint
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/d2themes"
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/color"
+)
+
+const (
+	// RuleOrphan finds shapes connected to nothing in boards that have connections
+	RuleOrphan = "orphan"
+	// RuleDuplicateLabel finds shapes labeled like another shape of the same board
+	RuleDuplicateLabel = "duplicate-label"
+	// RuleUndeclared finds shapes only written in connections, which create them implicitly. It's
+	// only enabled in strict mode.
+	RuleUndeclared = "undeclared"
+	// RuleUnreachableBoard finds layers that no shape links to
+	RuleUnreachableBoard = "unreachable-board"
+	// RuleContrast finds labels with too little contrast with the fill they're drawn on
+	RuleContrast = "contrast"
+	// RuleOversizedImage finds local images and icons bigger than the maximum size
+	RuleOversizedImage = "oversized-image"
+)
+
+// Rules are the names of all rules
+var Rules = []string{
+	RuleOrphan,
+	RuleDuplicateLabel,
+	RuleUndeclared,
+	RuleUnreachableBoard,
+	RuleContrast,
+	RuleOversizedImage,
+}
+
+const (
+	// DefaultMinContrast is the contrast ratio WCAG AA requires for normal text
+	DefaultMinContrast = 4.5
+	// DefaultMaxImageBytes is 1 MiB
+	DefaultMaxImageBytes = 1 << 20
+)
+
+// Config configures Lint. It's read from JSON files like:
+//
+//	{"rules": {"orphan": false}, "strict": true, "minContrast": 3}
+type Config struct {
+	// Rules enables or disables rules by name. Rules not given are enabled, except for
+	// RuleUndeclared.
+	Rules map[string]bool `json:"rules,omitempty"`
+	// Strict enables RuleUndeclared unless Rules disables it
+	Strict bool `json:"strict,omitempty"`
+	// MinContrast is the minimum contrast ratio of labels, DefaultMinContrast if 0
+	MinContrast float64 `json:"minContrast,omitempty"`
+	// MaxImageBytes is the maximum size of local images, DefaultMaxImageBytes if 0
+	MaxImageBytes int64 `json:"maxImageBytes,omitempty"`
+}
+
+// Validate checks that config only names known rules
+func (config *Config) Validate() error {
+	for rule := range config.Rules {
+		if !isRule(rule) {
+			return fmt.Errorf("unknown rule %q, expected one of %s", rule, strings.Join(Rules, ", "))
+		}
+	}
+	if config.MinContrast < 0 {
+		return fmt.Errorf("minContrast must not be negative")
+	}
+	if config.MaxImageBytes < 0 {
+		return fmt.Errorf("maxImageBytes must not be negative")
+	}
+	return nil
+}
+
+// Enabled returns whether rule is checked
+func (config *Config) Enabled(rule string) bool {
+	if enabled, ok := config.Rules[rule]; ok {
+		return enabled
+	}
+	if rule == RuleUndeclared {
+		return config.Strict
+	}
+	return true
+}
+
+func isRule(rule string) bool {
+	for _, r := range Rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+type Options struct {
+	Config Config
+	// InputPath is the path of the input, which the paths of local images are relative to
+	InputPath string
+	// ThemeID is the theme labels are drawn with, for the contrast of theme colors
+	ThemeID int64
+}
+
+// Problem is what a rule found wrong with a graph
+type Problem struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	// Board is the path of the board it's in, empty for the root board
+	Board []string    `json:"board,omitempty"`
+	Range d2ast.Range `json:"range"`
+}
+
+func (p Problem) Error() string {
+	return fmt.Sprintf("%v: %s (%s)", p.Range, p.Message, p.Rule)
+}
+
+// Lint checks g and all its boards with the rules enabled by opts, and returns the problems
+// found ordered by their position in the input
+func Lint(g *d2graph.Graph, opts *Options) ([]Problem, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if err := opts.Config.Validate(); err != nil {
+		return nil, err
+	}
+	theme := d2themescatalog.Find(opts.ThemeID)
+	if theme == (d2themes.Theme{}) {
+		return nil, fmt.Errorf("theme %d not found", opts.ThemeID)
+	}
+
+	l := &linter{
+		opts:  opts,
+		theme: theme,
+	}
+	if opts.Config.Enabled(RuleUnreachableBoard) {
+		l.linked = linkedBoards(g)
+	}
+	l.lintBoard(g, nil)
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		ri, rj := l.problems[i].Range, l.problems[j].Range
+		if ri.Path != rj.Path {
+			return ri.Path < rj.Path
+		}
+		return ri.Start.Byte < rj.Start.Byte
+	})
+	return l.problems, nil
+}
+
+type linter struct {
+	opts     *Options
+	theme    d2themes.Theme
+	problems []Problem
+	// linked are the paths of the boards linked to, joined by "."
+	linked map[string]struct{}
+}
+
+func (l *linter) add(rule string, boardPath []string, r d2ast.Range, f string, v ...interface{}) {
+	l.problems = append(l.problems, Problem{
+		Rule:    rule,
+		Message: fmt.Sprintf(f, v...),
+		Board:   boardPath,
+		Range:   r,
+	})
+}
+
+func (l *linter) lintBoard(g *d2graph.Graph, boardPath []string) {
+	config := &l.opts.Config
+	if config.Enabled(RuleOrphan) {
+		l.lintOrphans(g, boardPath)
+	}
+	if config.Enabled(RuleDuplicateLabel) {
+		l.lintDuplicateLabels(g, boardPath)
+	}
+	if config.Enabled(RuleUndeclared) {
+		l.lintUndeclared(g, boardPath)
+	}
+	if config.Enabled(RuleContrast) {
+		l.lintContrast(g, boardPath)
+	}
+	if config.Enabled(RuleOversizedImage) {
+		l.lintImages(g, boardPath)
+	}
+
+	for _, b := range g.Layers {
+		layerPath := append(append([]string{}, boardPath...), "layers", b.Name)
+		if config.Enabled(RuleUnreachableBoard) && !b.IsFolderOnly {
+			if _, ok := l.linked[strings.Join(layerPath, ".")]; !ok && b.BaseAST != nil {
+				l.add(RuleUnreachableBoard, layerPath, b.BaseAST.Range, "layer %#v isn't linked to by any shape", b.Name)
+			}
+		}
+		l.lintBoard(b, layerPath)
+	}
+	for _, b := range g.Scenarios {
+		l.lintBoard(b, append(append([]string{}, boardPath...), "scenarios", b.Name))
+	}
+	for _, b := range g.Steps {
+		l.lintBoard(b, append(append([]string{}, boardPath...), "steps", b.Name))
+	}
+}
+
+// lintOrphans finds the shapes without children that neither they nor their ancestors are
+// connected to anything, in boards with connections
+func (l *linter) lintOrphans(g *d2graph.Graph, boardPath []string) {
+	if len(g.Edges) == 0 {
+		return
+	}
+	connected := make(map[*d2graph.Object]struct{})
+	for _, e := range g.Edges {
+		connected[e.Src] = struct{}{}
+		connected[e.Dst] = struct{}{}
+	}
+	for _, obj := range g.Objects {
+		if len(obj.ChildrenArray) > 0 || !canBeOrphan(obj) {
+			continue
+		}
+		orphan := true
+		for o := obj; o != nil && o != g.Root; o = o.Parent {
+			if _, ok := connected[o]; ok {
+				orphan = false
+				break
+			}
+		}
+		if orphan {
+			if r, ok := objectRange(obj); ok {
+				l.add(RuleOrphan, boardPath, r, "%#v isn't connected to anything", obj.AbsID())
+			}
+		}
+	}
+}
+
+// canBeOrphan is false for shapes that aren't meant to be connected, like texts and the cells
+// of grids
+func canBeOrphan(obj *d2graph.Object) bool {
+	switch obj.Shape.Value {
+	case d2target.ShapeText, d2target.ShapeCode:
+		return false
+	}
+	if obj.NearKey != nil {
+		return false
+	}
+	for p := obj.Parent; p != nil; p = p.Parent {
+		if p.IsGridDiagram() || p.IsSequenceDiagram() {
+			return false
+		}
+	}
+	return true
+}
+
+// lintDuplicateLabels finds the shapes labeled explicitly like another shape of the board
+func (l *linter) lintDuplicateLabels(g *d2graph.Graph, boardPath []string) {
+	labeled := make(map[string]*d2graph.Object)
+	for _, obj := range g.Objects {
+		label := strings.TrimSpace(obj.Label.Value)
+		if label == "" {
+			continue
+		}
+		if other, ok := labeled[label]; ok && obj.Label.MapKey != nil {
+			l.add(RuleDuplicateLabel, boardPath, obj.Label.MapKey.Range, "%#v is labeled %q like %#v", obj.AbsID(), label, other.AbsID())
+			continue
+		}
+		if _, ok := labeled[label]; !ok {
+			labeled[label] = obj
+		}
+	}
+}
+
+// lintUndeclared finds the shapes only written in connections
+func (l *linter) lintUndeclared(g *d2graph.Graph, boardPath []string) {
+	for _, obj := range g.Objects {
+		if len(obj.References) == 0 {
+			continue
+		}
+		declared := false
+		for _, ref := range obj.References {
+			if ref.MapKey == nil || ref.MapKeyEdgeIndex < 0 {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			ref := obj.References[0]
+			l.add(RuleUndeclared, boardPath, ref.Key.Range, "%#v is only written in connections, declare it on its own", obj.AbsID())
+		}
+	}
+}
+
+// lintContrast finds labels with a fill or font color given that contrast too little
+func (l *linter) lintContrast(g *d2graph.Graph, boardPath []string) {
+	minContrast := l.opts.Config.MinContrast
+	if minContrast == 0 {
+		minContrast = DefaultMinContrast
+	}
+	for _, obj := range g.Objects {
+		if obj.Style.Fill == nil && obj.Style.FontColor == nil {
+			continue
+		}
+		if obj.Label.Value == "" || !labelOnFill(obj) {
+			continue
+		}
+		fill := obj.GetFill()
+		if obj.Style.Fill != nil {
+			fill = obj.Style.Fill.Value
+		}
+		fontColor := color.N1
+		if obj.Style.FontColor != nil {
+			fontColor = obj.Style.FontColor.Value
+		}
+		fill = d2themes.ResolveThemeColor(l.theme, fill)
+		fontColor = d2themes.ResolveThemeColor(l.theme, fontColor)
+		ratio, err := color.ContrastRatio(fill, fontColor)
+		if err != nil {
+			// Gradients, transparent fills and such
+			continue
+		}
+		if ratio < minContrast {
+			r := obj.Label.MapKey
+			if obj.Style.FontColor != nil && obj.Style.FontColor.MapKey != nil {
+				r = obj.Style.FontColor.MapKey
+			} else if obj.Style.Fill != nil && obj.Style.Fill.MapKey != nil {
+				r = obj.Style.Fill.MapKey
+			}
+			if r == nil {
+				continue
+			}
+			l.add(RuleContrast, boardPath, r.Range, "the label of %#v has a contrast of %.2f:1 with its fill, below %.2f:1", obj.AbsID(), ratio, minContrast)
+		}
+	}
+}
+
+// labelOnFill is whether the label of obj is drawn on its fill
+func labelOnFill(obj *d2graph.Object) bool {
+	switch obj.Shape.Value {
+	case d2target.ShapeText, d2target.ShapeCode, d2target.ShapeImage, d2target.ShapeSQLTable, d2target.ShapeClass:
+		return false
+	}
+	return obj.Style.Fill == nil || !strings.EqualFold(obj.Style.Fill.Value, "transparent")
+}
+
+// lintImages finds local images and icons bigger than the maximum
+func (l *linter) lintImages(g *d2graph.Graph, boardPath []string) {
+	maxBytes := l.opts.Config.MaxImageBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxImageBytes
+	}
+	for _, obj := range g.Objects {
+		path, ok := localPath(obj.Icon)
+		if !ok {
+			continue
+		}
+		if l.opts.InputPath != "" && l.opts.InputPath != "-" && !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(l.opts.InputPath), path)
+		}
+		fi, err := os.Stat(path)
+		if err != nil || fi.Size() <= maxBytes {
+			continue
+		}
+		r, ok := objectRange(obj)
+		if !ok {
+			continue
+		}
+		l.add(RuleOversizedImage, boardPath, r, "the image of %#v is %s, above %s", obj.AbsID(), humanBytes(fi.Size()), humanBytes(maxBytes))
+	}
+}
+
+func localPath(u *url.URL) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+	switch u.Scheme {
+	case "":
+		return u.Path, u.Path != ""
+	case "file":
+		return u.Path, true
+	}
+	return "", false
+}
+
+func humanBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// objectRange is the range of the first key obj is written in
+func objectRange(obj *d2graph.Object) (d2ast.Range, bool) {
+	for _, ref := range obj.References {
+		if ref.Key != nil {
+			return ref.Key.Range, true
+		}
+	}
+	return d2ast.Range{}, false
+}
+
+// linkedBoards returns the paths of the boards that shapes link to, and of their ancestors
+func linkedBoards(g *d2graph.Graph) map[string]struct{} {
+	linked := make(map[string]struct{})
+	var visit func(g *d2graph.Graph)
+	visit = func(g *d2graph.Graph) {
+		for _, obj := range g.Objects {
+			if obj.Link == nil {
+				continue
+			}
+			kp, err := d2parser.ParseKey(obj.Link.Value)
+			if err != nil {
+				continue
+			}
+			ida := kp.IDA()
+			if len(ida) == 0 || ida[0] != "root" {
+				continue
+			}
+			for i := 1; i <= len(ida); i++ {
+				linked[strings.Join(ida[1:i], ".")] = struct{}{}
+			}
+		}
+		for _, b := range g.Layers {
+			visit(b)
+		}
+		for _, b := range g.Scenarios {
+			visit(b)
+		}
+		for _, b := range g.Steps {
+			visit(b)
+		}
+	}
+	visit(g)
+	return linked
+}
@@ -0,0 +1,168 @@
+package d2lint_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2lint"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		script string
+		config d2lint.Config
+		exp    []string
+	}{
+		{
+			name: "orphan",
+			script: `a -> b
+c
+d: {e -> f}
+g: {h}
+d.i
+note: {shape: text}
+legend: {near: top-right}
+grid: {
+  grid-rows: 1
+  x
+}
+`,
+			exp: []string{
+				`index.d2:2:1: "c" isn't connected to anything (orphan)`,
+				`index.d2:4:5: "g.h" isn't connected to anything (orphan)`,
+				`index.d2:5:1: "d.i" isn't connected to anything (orphan)`,
+			},
+		},
+		{
+			name: "no_connections",
+			script: `a
+b
+`,
+		},
+		{
+			name: "duplicate_label",
+			script: `a: Database
+b: Database
+database
+c: database
+a -> b -> c -> database
+`,
+			exp: []string{
+				`index.d2:2:1: "b" is labeled "Database" like "a" (duplicate-label)`,
+				`index.d2:4:1: "c" is labeled "database" like "database" (duplicate-label)`,
+			},
+		},
+		{
+			name: "undeclared",
+			script: `a
+a -> b
+c.d -> a
+c.shape: circle
+`,
+			config: d2lint.Config{Strict: true},
+			exp: []string{
+				`index.d2:2:6: "b" is only written in connections, declare it on its own (undeclared)`,
+				`index.d2:3:1: "c.d" is only written in connections, declare it on its own (undeclared)`,
+			},
+		},
+		{
+			name: "undeclared_not_strict",
+			script: `a -> b
+`,
+		},
+		{
+			name: "unreachable_board",
+			script: `a.link: layers.x
+layers: {
+  x: {
+    b
+    layers: {
+      y: {c}
+    }
+  }
+  z: {d}
+}
+scenarios: {
+  s: {e}
+}
+`,
+			exp: []string{
+				`index.d2:6:10: layer "y" isn't linked to by any shape (unreachable-board)`,
+				`index.d2:9:6: layer "z" isn't linked to by any shape (unreachable-board)`,
+			},
+		},
+		{
+			name: "contrast",
+			script: `a: {style.fill: "#000"; style.font-color: "#111"}
+b: {style.fill: "#000"; style.font-color: "#fff"}
+c: {style.font-color: "#eee"}
+d: {style.fill: black}
+e: {shape: text; style.font-color: white}
+`,
+			config: d2lint.Config{Rules: map[string]bool{d2lint.RuleOrphan: false}},
+			exp: []string{
+				`index.d2:1:25: the label of "a" has a contrast of 1.11:1 with its fill, below 4.50:1 (contrast)`,
+				`index.d2:3:5: the label of "c" has a contrast of 1.09:1 with its fill, below 4.50:1 (contrast)`,
+				`index.d2:4:5: the label of "d" has a contrast of 1.11:1 with its fill, below 4.50:1 (contrast)`,
+			},
+		},
+		{
+			name: "oversized_image",
+			script: `big: {shape: image; icon: ./big.png}
+small: {icon: ./small.png}
+remote: {icon: https://icons.terrastruct.com/essentials/004-picture.svg}
+`,
+			config: d2lint.Config{MaxImageBytes: 1000},
+			exp: []string{
+				`index.d2:1:1: the image of "big" is 2.0 KiB, above 1000 B (oversized-image)`,
+			},
+		},
+		{
+			name: "disabled",
+			script: `a -> b
+c
+`,
+			config: d2lint.Config{Rules: map[string]bool{d2lint.RuleOrphan: false}},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			assert.Success(t, os.WriteFile(filepath.Join(dir, "big.png"), make([]byte, 2048), 0644))
+			assert.Success(t, os.WriteFile(filepath.Join(dir, "small.png"), make([]byte, 10), 0644))
+
+			g, _, err := d2compiler.Compile("index.d2", strings.NewReader(tc.script), nil)
+			assert.Success(t, err)
+			problems, err := d2lint.Lint(g, &d2lint.Options{
+				Config:    tc.config,
+				InputPath: filepath.Join(dir, "index.d2"),
+			})
+			assert.Success(t, err)
+
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.Error())
+			}
+			assert.Equal(t, strings.Join(tc.exp, "\n"), strings.Join(got, "\n"))
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	config := d2lint.Config{Rules: map[string]bool{"orphans": false}}
+	assert.ErrorString(t, config.Validate(), `unknown rule "orphans", expected one of orphan, duplicate-label, undeclared, unreachable-board, contrast, oversized-image`)
+}
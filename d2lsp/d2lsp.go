@@ -0,0 +1,375 @@
+// Package d2lsp implements the language features of the D2 language server: diagnostics, go to
+// definition, completion, hover, rename and formatting. Serve speaks them over the Language
+// Server Protocol so editor integrations don't each reimplement parsing D2.
+//
+// Positions are in UTF-16 code units as LSP requires, so inputs are parsed with UTF16Pos.
+package d2lsp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2oracle"
+	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// Diagnostics compiles text, the contents of the file at path, and returns its errors, or its
+// warnings if it compiles. Errors in files it imports are reported at the start of text.
+func Diagnostics(path, text string) []Diagnostic {
+	diags := []Diagnostic{}
+	g, err := compile(path, text)
+	if err == nil {
+		for _, w := range g.Warnings {
+			if w.Range.Path != path {
+				continue
+			}
+			diags = append(diags, Diagnostic{
+				Range:    toRange(w.Range),
+				Severity: SeverityWarning,
+				Code:     w.Code,
+				Source:   "d2",
+				Message:  w.Message,
+			})
+		}
+		return diags
+	}
+	var pe *d2parser.ParseError
+	if !errors.As(err, &pe) {
+		return append(diags, Diagnostic{
+			Severity: SeverityError,
+			Source:   "d2",
+			Message:  err.Error(),
+		})
+	}
+	for _, e := range pe.Errors {
+		d := Diagnostic{
+			Severity: SeverityError,
+			Code:     d2compiler.NewDiagnostic(d2compiler.SeverityError, e).Code,
+			Source:   "d2",
+			Message:  e.Message,
+		}
+		if e.Range.Path == path {
+			d.Range = toRange(e.Range)
+			d.Message = strings.TrimPrefix(e.Message, e.Range.String()+": ")
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// Definition returns where the shape whose key is at pos is declared, which is the first key it's
+// written in outside of connections if there's one
+func Definition(path, text string, pos Position) (d2ast.Range, bool) {
+	// What parses is enough while the text is mid-edit
+	g, _ := compile(path, text)
+	if g == nil {
+		return d2ast.Range{}, false
+	}
+	obj, _, _, ok := objectAt(g, nil, path, pos)
+	if !ok {
+		return d2ast.Range{}, false
+	}
+	ref := obj.References[0]
+	for _, r := range obj.References {
+		if r.MapKey != nil && !r.InEdge() {
+			ref = r
+			break
+		}
+	}
+	return ref.Key.Path[ref.KeyPathIndex].Unbox().GetRange(), true
+}
+
+// Hover documents the reserved keyword at pos, or describes the shape whose key is at pos
+func Hover(path, text string, pos Position) *HoverInfo {
+	m, _ := d2parser.Parse(path, strings.NewReader(text), &d2parser.ParseOptions{UTF16Pos: true})
+	if sb, ok := keywordAt(m, pos); ok {
+		r := toRange(sb.Unbox().GetRange())
+		return &HoverInfo{
+			Contents: markdown(fmt.Sprintf("`%s`\n\n%s", sb.Unbox().ScalarString(), keywordDocs[sb.Unbox().ScalarString()])),
+			Range:    &r,
+		}
+	}
+
+	g, _ := compile(path, text)
+	if g == nil {
+		return nil
+	}
+	obj, _, r, ok := objectAt(g, nil, path, pos)
+	if !ok {
+		return nil
+	}
+	lr := toRange(r)
+	s := fmt.Sprintf("`%s`\n\nshape: %s", obj.AbsID(), obj.Shape.Value)
+	if obj.Label.Value != obj.ID {
+		s += fmt.Sprintf("\n\nlabel: %s", obj.Label.Value)
+	}
+	return &HoverInfo{
+		Contents: markdown(s),
+		Range:    &lr,
+	}
+}
+
+var (
+	// valueRegexp matches the key of the value being written at the end of a line
+	valueRegexp = regexp.MustCompile(`([\w-]+)\s*:\s*[\w-]*$`)
+	// keyRegexp matches the key being written at the end of a line
+	keyRegexp = regexp.MustCompile(`[\w.-]*$`)
+)
+
+// keywordValues are the values completed for reserved keywords that only take some
+var keywordValues = map[string][]string{
+	"shape":          d2target.Shapes,
+	"near":           d2graph.NearConstantsArray,
+	"direction":      {"up", "down", "right", "left"},
+	"fill-pattern":   d2graph.FillPatterns,
+	"border-style":   d2graph.BorderStyles,
+	"text-align":     d2graph.TextAligns,
+	"text-direction": d2graph.TextDirections,
+	"header":         d2graph.HeaderStyles,
+}
+
+// Completion returns the reserved keywords, styles or values that can be written at pos.
+// Editors filter them by what's already written.
+func Completion(text string, pos Position) []CompletionItem {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return nil
+	}
+	line := utf16Prefix(lines[pos.Line], pos.Character)
+	// Only what's written after the last map opened or key ended on the line matters
+	if i := strings.LastIndexAny(line, "{;"); i >= 0 {
+		line = line[i+1:]
+	}
+
+	if strings.Contains(line, ":") {
+		m := valueRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return nil
+		}
+		var items []CompletionItem
+		for _, v := range keywordValues[m[1]] {
+			items = append(items, CompletionItem{
+				Label: v,
+				Kind:  CompletionKindValue,
+			})
+		}
+		return items
+	}
+
+	key := strings.Split(keyRegexp.FindString(line), ".")
+	inStyle := len(key) > 1 && key[len(key)-2] == "style"
+	if len(key) == 1 {
+		m, _ := d2parser.Parse("", strings.NewReader(text), &d2parser.ParseOptions{UTF16Pos: true})
+		keys := enclosingKeys(m, pos)
+		inStyle = len(keys) > 0 && keys[len(keys)-1] == "style"
+	}
+	if inStyle {
+		return keywordItems(d2graph.StyleKeywords, CompletionKindProperty)
+	}
+	keywords := make(map[string]struct{})
+	for k := range d2graph.ReservedKeywords {
+		if _, ok := d2graph.StyleKeywords[k]; !ok {
+			keywords[k] = struct{}{}
+		}
+	}
+	return keywordItems(keywords, CompletionKindKeyword)
+}
+
+func keywordItems(keywords map[string]struct{}, kind int) []CompletionItem {
+	var items []CompletionItem
+	for k := range keywords {
+		item := CompletionItem{
+			Label: k,
+			Kind:  kind,
+		}
+		if doc, ok := keywordDocs[k]; ok {
+			item.Documentation = &MarkupContent{Kind: "markdown", Value: doc}
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+	return items
+}
+
+// Rename renames the shape whose key is at pos to newName, returning the edits to the keys
+// that name it. The rest of text is left as it is. d2oracle checks the rename, so that shapes
+// aren't merged.
+func Rename(path, text string, pos Position, newName string) ([]TextEdit, error) {
+	g, err := compile(path, text)
+	if err != nil {
+		return nil, err
+	}
+	obj, boardPath, _, ok := objectAt(g, nil, path, pos)
+	if !ok {
+		return nil, errors.New("there's no shape to rename here")
+	}
+
+	// d2oracle rewrites the AST, so the ranges are taken first
+	name := d2format.Format(d2ast.MakeValueBox(d2ast.RawString(newName, true)).StringBox().Unbox())
+	edits := []TextEdit{}
+	seen := make(map[d2ast.Range]struct{})
+	for _, ref := range obj.References {
+		// Globs apply to the shape but don't name it
+		if ref.Key == nil || (ref.MapKey != nil && ref.MapKey.HasGlob()) {
+			continue
+		}
+		r := ref.Key.Path[ref.KeyPathIndex].Unbox().GetRange()
+		if _, ok := seen[r]; ok || r.Path != path {
+			continue
+		}
+		seen[r] = struct{}{}
+		edits = append(edits, TextEdit{Range: toRange(r), NewText: name})
+	}
+
+	_, renamed, err := d2oracle.Rename(g, boardPath, obj.AbsID(), newName)
+	if err != nil {
+		return nil, err
+	}
+	// d2oracle picks another name rather than merging shapes
+	if renamed != newName {
+		return nil, fmt.Errorf("%#v already exists", newName)
+	}
+	return edits, nil
+}
+
+// Format formats text like d2 fmt. The indentation editors ask for is ignored so that files
+// formatted in them pass d2 fmt --check.
+func Format(path, text string) (string, error) {
+	m, err := d2parser.Parse(path, strings.NewReader(text), nil)
+	if err != nil {
+		return "", err
+	}
+	return d2format.Format(m), nil
+}
+
+// compile compiles text, or what parses of it along with the parse errors. The graph of
+// text that doesn't parse must not be formatted back into it.
+func compile(path, text string) (*d2graph.Graph, error) {
+	g, _, err := d2compiler.Compile(path, strings.NewReader(text), &d2compiler.CompileOptions{
+		UTF16Pos: true,
+		Partial:  true,
+	})
+	return g, err
+}
+
+// objectAt returns the object with a key in path at pos, the path of its board and the range
+// of the key
+func objectAt(g *d2graph.Graph, boardPath []string, path string, pos Position) (*d2graph.Object, []string, d2ast.Range, bool) {
+	for _, obj := range g.Objects {
+		for _, ref := range obj.References {
+			if ref.Key == nil {
+				continue
+			}
+			r := ref.Key.Path[ref.KeyPathIndex].Unbox().GetRange()
+			if r.Path == path && inRange(r, pos) {
+				return obj, boardPath, r, true
+			}
+		}
+	}
+	for _, boards := range [][]*d2graph.Graph{g.Layers, g.Scenarios, g.Steps} {
+		for _, b := range boards {
+			bp := append(append([]string{}, boardPath...), b.Name)
+			if obj, bp, r, ok := objectAt(b, bp, path, pos); ok {
+				return obj, bp, r, true
+			}
+		}
+	}
+	return nil, nil, d2ast.Range{}, false
+}
+
+// keywordAt returns the reserved keyword in a key of m at pos
+func keywordAt(m *d2ast.Map, pos Position) (*d2ast.StringBox, bool) {
+	if m == nil {
+		return nil, false
+	}
+	for _, n := range m.Nodes {
+		mk := n.MapKey
+		if mk == nil {
+			continue
+		}
+		for _, kp := range []*d2ast.KeyPath{mk.Key, mk.EdgeKey} {
+			if kp == nil {
+				continue
+			}
+			for _, sb := range kp.Path {
+				if _, ok := keywordDocs[sb.Unbox().ScalarString()]; ok && inRange(sb.Unbox().GetRange(), pos) {
+					return sb, true
+				}
+			}
+		}
+		if mk.Value.Map != nil && inRange(mk.Value.Map.Range, pos) {
+			return keywordAt(mk.Value.Map, pos)
+		}
+	}
+	return nil, false
+}
+
+// enclosingKeys returns the last elements of the keys of the maps in m that pos is in,
+// outermost first
+func enclosingKeys(m *d2ast.Map, pos Position) []string {
+	if m == nil {
+		return nil
+	}
+	for _, n := range m.Nodes {
+		mk := n.MapKey
+		if mk == nil || mk.Value.Map == nil || !inRange(mk.Value.Map.Range, pos) {
+			continue
+		}
+		kp := mk.Key
+		if mk.EdgeKey != nil {
+			kp = mk.EdgeKey
+		}
+		var key string
+		if kp != nil {
+			key = kp.Path[len(kp.Path)-1].Unbox().ScalarString()
+		}
+		return append([]string{key}, enclosingKeys(mk.Value.Map, pos)...)
+	}
+	return nil
+}
+
+// inRange returns whether pos is in r, including its end so that a key is found with the
+// cursor right after it
+func inRange(r d2ast.Range, pos Position) bool {
+	after := pos.Line > r.Start.Line || (pos.Line == r.Start.Line && pos.Character >= r.Start.Column)
+	before := pos.Line < r.End.Line || (pos.Line == r.End.Line && pos.Character <= r.End.Column)
+	return after && before
+}
+
+func toRange(r d2ast.Range) Range {
+	return Range{
+		Start: Position{Line: r.Start.Line, Character: r.Start.Column},
+		End:   Position{Line: r.End.Line, Character: r.End.Column},
+	}
+}
+
+func markdown(s string) MarkupContent {
+	return MarkupContent{
+		Kind:  "markdown",
+		Value: s,
+	}
+}
+
+// utf16Prefix returns the start of s that's n UTF-16 code units long
+func utf16Prefix(s string, n int) string {
+	for i, r := range s {
+		if n <= 0 {
+			return s[:i]
+		}
+		n--
+		if r >= 0x10000 {
+			n--
+		}
+	}
+	return s
+}
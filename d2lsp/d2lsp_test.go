@@ -0,0 +1,386 @@
+package d2lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2lsp"
+)
+
+func TestDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	diags := d2lsp.Diagnostics("index.d2", "a -> b\nb.shape: hexagonn\n🎉: {\n")
+	got, err := json.Marshal(diags)
+	assert.Success(t, err)
+	assert.Equal(t, `[{"range":{"start":{"line":2,"character":4},"end":{"line":3,"character":0}},"severity":1,"code":"unterminated","source":"d2","message":"maps must be terminated with }"},{"range":{"start":{"line":1,"character":9},"end":{"line":1,"character":17}},"severity":1,"code":"unknown-shape","source":"d2","message":"unknown shape \"hexagonn\""}]`, string(got))
+
+	assert.Equal(t, 0, len(d2lsp.Diagnostics("index.d2", "a -> b")))
+
+	diags = d2lsp.Diagnostics("index.d2", "a -> b\na -> b\n")
+	got, err = json.Marshal(diags)
+	assert.Success(t, err)
+	assert.Equal(t, `[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":6}},"severity":2,"code":"duplicate-edge","source":"d2","message":"connection (a -\u003e b)[1] duplicates (a -\u003e b)[0], which has the same shapes and label, so they're drawn on top of each other"}]`, string(got))
+}
+
+func TestDefinition(t *testing.T) {
+	t.Parallel()
+
+	text := `a -> b
+b: Bee
+c: {
+  d -> b
+}
+layers: {
+  x: {
+    e
+    e -> f
+  }
+}
+`
+	testCases := []struct {
+		name string
+		pos  d2lsp.Position
+		exp  string
+	}{
+		{name: "declared_after", pos: d2lsp.Position{Line: 0, Character: 5}, exp: "index.d2:2:1"},
+		{name: "only_in_connection", pos: d2lsp.Position{Line: 0, Character: 0}, exp: "index.d2:1:1"},
+		{name: "nested", pos: d2lsp.Position{Line: 3, Character: 2}, exp: "index.d2:4:3"},
+		{name: "layer", pos: d2lsp.Position{Line: 8, Character: 4}, exp: "index.d2:8:5"},
+		{name: "not_a_key", pos: d2lsp.Position{Line: 1, Character: 5}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, ok := d2lsp.Definition("index.d2", text, tc.pos)
+			if tc.exp == "" {
+				assert.Equal(t, false, ok)
+				return
+			}
+			assert.Equal(t, true, ok)
+			assert.Equal(t, tc.exp, r.String())
+		})
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	t.Parallel()
+
+	text := `a.shape: cyl
+a.style.f
+a: {
+  sty
+  style: {
+    f
+  }
+  near: top
+  label: hello
+}
+`
+	testCases := []struct {
+		name     string
+		pos      d2lsp.Position
+		contains string
+		excludes string
+	}{
+		{name: "shape", pos: d2lsp.Position{Line: 0, Character: 12}, contains: "cylinder", excludes: "fill"},
+		{name: "style_key", pos: d2lsp.Position{Line: 1, Character: 9}, contains: "fill", excludes: "shape"},
+		{name: "key", pos: d2lsp.Position{Line: 3, Character: 5}, contains: "style", excludes: "fill"},
+		{name: "style_map", pos: d2lsp.Position{Line: 5, Character: 5}, contains: "font-color", excludes: "label"},
+		{name: "near", pos: d2lsp.Position{Line: 7, Character: 11}, contains: "top-center"},
+		{name: "label", pos: d2lsp.Position{Line: 8, Character: 14}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var labels []string
+			for _, item := range d2lsp.Completion(text, tc.pos) {
+				labels = append(labels, item.Label)
+			}
+			if tc.contains == "" {
+				assert.Equal(t, 0, len(labels))
+				return
+			}
+			assert.Equal(t, true, contains(labels, tc.contains))
+			if tc.excludes != "" {
+				assert.Equal(t, false, contains(labels, tc.excludes))
+			}
+		})
+	}
+}
+
+func TestHover(t *testing.T) {
+	t.Parallel()
+
+	text := `db: Database {shape: cylinder}
+db.style.fill: red
+x
+`
+	h := d2lsp.Hover("index.d2", text, d2lsp.Position{Line: 0, Character: 16})
+	assert.Equal(t, "`shape`\n\nThe shape drawn, e.g. `rectangle`, `circle`, `cylinder`, `sql_table` or `sequence_diagram`.", h.Contents.Value)
+	assert.Equal(t, d2lsp.Position{Line: 0, Character: 14}, h.Range.Start)
+
+	h = d2lsp.Hover("index.d2", text, d2lsp.Position{Line: 1, Character: 10})
+	assert.Equal(t, "`fill`\n\nThe color a shape is filled with.", h.Contents.Value)
+
+	h = d2lsp.Hover("index.d2", text, d2lsp.Position{Line: 1, Character: 1})
+	assert.Equal(t, "`db`\n\nshape: cylinder\n\nlabel: Database", h.Contents.Value)
+
+	h = d2lsp.Hover("index.d2", text, d2lsp.Position{Line: 2, Character: 0})
+	assert.Equal(t, "`x`\n\nshape: rectangle", h.Contents.Value)
+
+	assert.Equal(t, (*d2lsp.HoverInfo)(nil), d2lsp.Hover("index.d2", text, d2lsp.Position{Line: 0, Character: 6}))
+
+	// Mid-edit
+	h = d2lsp.Hover("index.d2", text+"x -> \n", d2lsp.Position{Line: 1, Character: 1})
+	assert.Equal(t, "`db`\n\nshape: cylinder\n\nlabel: Database", h.Contents.Value)
+}
+
+func TestKeywordDocs(t *testing.T) {
+	t.Parallel()
+
+	for k := range d2graph.ReservedKeywords {
+		h := d2lsp.Hover("index.d2", "a."+k+": x", d2lsp.Position{Line: 0, Character: 2})
+		if h == nil {
+			t.Errorf("reserved keyword %q has no docs", k)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	t.Parallel()
+
+	text := `a -> b
+b.style.fill: red
+layers: {
+  x: {
+    c -> d
+  }
+}
+`
+	edit := func(startLine, startChar, endLine, endChar int, newText string) d2lsp.TextEdit {
+		return d2lsp.TextEdit{
+			Range: d2lsp.Range{
+				Start: d2lsp.Position{Line: startLine, Character: startChar},
+				End:   d2lsp.Position{Line: endLine, Character: endChar},
+			},
+			NewText: newText,
+		}
+	}
+
+	got, err := d2lsp.Rename("index.d2", text, d2lsp.Position{Line: 1, Character: 0}, "bee")
+	assert.Success(t, err)
+	assert.JSON(t, []d2lsp.TextEdit{
+		edit(0, 5, 0, 6, "bee"),
+		edit(1, 0, 1, 1, "bee"),
+	}, got)
+
+	got, err = d2lsp.Rename("index.d2", text, d2lsp.Position{Line: 4, Character: 9}, "e.f")
+	assert.Success(t, err)
+	assert.JSON(t, []d2lsp.TextEdit{
+		edit(4, 9, 4, 10, `"e.f"`),
+	}, got)
+
+	// Globs are left as written, since they match shapes rather than name one
+	got, err = d2lsp.Rename("index.d2", "x: {b}\nx.b\n*.b.style.fill: red\n", d2lsp.Position{Line: 1, Character: 2}, "c")
+	assert.Success(t, err)
+	assert.JSON(t, []d2lsp.TextEdit{
+		edit(0, 4, 0, 5, "c"),
+		edit(1, 2, 1, 3, "c"),
+	}, got)
+
+	_, err = d2lsp.Rename("index.d2", text, d2lsp.Position{Line: 0, Character: 0}, "b")
+	assert.ErrorString(t, err, `"b" already exists`)
+
+	_, err = d2lsp.Rename("index.d2", text, d2lsp.Position{Line: 1, Character: 9}, "b")
+	assert.ErrorString(t, err, `there's no shape to rename here`)
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	got, err := d2lsp.Format("index.d2", "a   ->   b\nc: {\nd\n}")
+	assert.Success(t, err)
+	assert.Equal(t, "a -> b\nc: {\n  d\n}\n", got)
+
+	_, err = d2lsp.Format("index.d2", "a: {")
+	assert.ErrorString(t, err, `index.d2:1:4: maps must be terminated with }`)
+}
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	var in bytes.Buffer
+	send := func(id int, method string, params interface{}) {
+		writeMessage(t, &in, id, method, params)
+	}
+	doc := map[string]string{"uri": "file:///tmp/index.d2"}
+	send(1, "textDocument/hover", map[string]interface{}{})
+	send(2, "initialize", map[string]interface{}{})
+	send(0, "initialized", map[string]interface{}{})
+	send(0, "textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]string{"uri": doc["uri"], "text": "a ->"},
+	})
+	send(0, "textDocument/didChange", map[string]interface{}{
+		"textDocument":   doc,
+		"contentChanges": []map[string]string{{"text": "a   -> b\nb"}},
+	})
+	send(3, "textDocument/definition", map[string]interface{}{
+		"textDocument": doc,
+		"position":     map[string]int{"line": 0, "character": 7},
+	})
+	send(4, "textDocument/rename", map[string]interface{}{
+		"textDocument": doc,
+		"position":     map[string]int{"line": 1, "character": 0},
+		"newName":      "c",
+	})
+	send(5, "textDocument/formatting", map[string]interface{}{
+		"textDocument": doc,
+		"options":      map[string]interface{}{"tabSize": 4, "insertSpaces": true},
+	})
+	send(6, "textDocument/documentSymbol", map[string]interface{}{})
+	send(7, "shutdown", nil)
+	send(0, "exit", nil)
+	// Never read
+	send(8, "shutdown", nil)
+
+	var out bytes.Buffer
+	err := d2lsp.Serve(context.Background(), &in, &out)
+	assert.Success(t, err)
+
+	got := readMessages(t, &out)
+	assert.Equal(t, 9, len(got))
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"error":{"code":-32002,"message":"initialize must be sent first"}}`, got[0])
+	assert.Equal(t, true, strings.Contains(got[1], `"renameProvider":true`))
+	assert.Equal(t, `{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///tmp/index.d2","diagnostics":[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":4}},"severity":1,"code":"syntax","source":"d2","message":"connection missing destination"}]}}`, got[2])
+	assert.Equal(t, `{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///tmp/index.d2","diagnostics":[]}}`, got[3])
+	assert.Equal(t, `{"jsonrpc":"2.0","id":3,"result":{"uri":"file:///tmp/index.d2","range":{"start":{"line":1,"character":0},"end":{"line":1,"character":1}}}}`, got[4])
+	assert.Equal(t, `{"jsonrpc":"2.0","id":4,"result":{"changes":{"file:///tmp/index.d2":[{"range":{"start":{"line":0,"character":7},"end":{"line":0,"character":8}},"newText":"c"},{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":1}},"newText":"c"}]}}}`, got[5])
+	assert.Equal(t, `{"jsonrpc":"2.0","id":5,"result":[{"range":{"start":{"line":0,"character":0},"end":{"line":1,"character":1}},"newText":"a -> b\nb\n"}]}`, got[6])
+	assert.Equal(t, `{"jsonrpc":"2.0","id":6,"error":{"code":-32601,"message":"unsupported method \"textDocument/documentSymbol\""}}`, got[7])
+	assert.Equal(t, `{"jsonrpc":"2.0","id":7,"result":null}`, got[8])
+}
+
+func TestServeContentLength(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		contentLength string
+		expErr        string
+	}{
+		{"abc", `invalid Content-Length header "abc"`},
+		{"-1", `invalid Content-Length header "-1"`},
+		{"1099511627776", `message of 1099511627776 bytes is larger than 67108864 bytes`},
+	} {
+		in := strings.NewReader("Content-Length: " + tc.contentLength + "\r\n\r\n")
+		err := d2lsp.Serve(context.Background(), in, io.Discard)
+		assert.ErrorString(t, err, tc.expErr)
+	}
+}
+
+func TestServeCutOff(t *testing.T) {
+	t.Parallel()
+
+	texts := []string{
+		// Partway through a key
+		"a -> b\nb.shape: cyl",
+		"x: {\n  a -> b\n  (_.a -> _",
+		// Partway through a connection
+		"a -> b\nb -",
+		"a -> b\nx: {\n  _.a -> _",
+		// Partway through vars and classes
+		"vars: {\n  x: 1\n  y: {\n    z\n",
+		"vars: {\n  d2-config: {\n    theme-overrides: {\n      B1",
+		"vars: {\n  y\n    z: 2\n  }\n}\nb: ${y.z}",
+		"classes: {\n  c: { style.fill: red }\n  d: {",
+		"classes: {\n  c: { style.fill: red }\n}\nlayers: {\n  l: {\n    classes",
+	}
+
+	var in bytes.Buffer
+	writeMessage(t, &in, 1, "initialize", map[string]interface{}{})
+	for i, text := range texts {
+		doc := map[string]string{"uri": fmt.Sprintf("file:///tmp/%d.d2", i)}
+		writeMessage(t, &in, 0, "textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": doc["uri"], "text": text},
+		})
+		lines := strings.Split(text, "\n")
+		end := map[string]int{"line": len(lines) - 1, "character": len(lines[len(lines)-1])}
+		for _, method := range []string{"textDocument/completion", "textDocument/hover", "textDocument/definition"} {
+			writeMessage(t, &in, 2, method, map[string]interface{}{
+				"textDocument": doc,
+				"position":     end,
+			})
+		}
+	}
+	writeMessage(t, &in, 3, "shutdown", nil)
+
+	var out bytes.Buffer
+	err := d2lsp.Serve(context.Background(), &in, &out)
+	assert.Success(t, err)
+
+	got := readMessages(t, &out)
+	// The response to initialize, and per document its diagnostics and a response to each request
+	assert.Equal(t, 1+len(texts)*4+1, len(got))
+	for _, msg := range got {
+		assert.Equal(t, false, strings.Contains(msg, `"error"`))
+	}
+	assert.Equal(t, `{"jsonrpc":"2.0","id":3,"result":null}`, got[len(got)-1])
+}
+
+// writeMessage writes a request to w, or a notification if id is 0
+func writeMessage(t *testing.T, w io.Writer, id int, method string, params interface{}) {
+	msg := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+	if id > 0 {
+		msg["id"] = id
+	}
+	b, err := json.Marshal(msg)
+	assert.Success(t, err)
+	fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+}
+
+// readMessages reads the content of every message in r
+func readMessages(t *testing.T, r io.Reader) []string {
+	var msgs []string
+	tr := textproto.NewReader(bufio.NewReader(r))
+	for {
+		header, err := tr.ReadMIMEHeader()
+		if err == io.EOF {
+			return msgs
+		}
+		assert.Success(t, err)
+		n, err := strconv.Atoi(header.Get("Content-Length"))
+		assert.Success(t, err)
+		b := make([]byte, n)
+		_, err = io.ReadFull(tr.R, b)
+		assert.Success(t, err)
+		msgs = append(msgs, string(b))
+	}
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
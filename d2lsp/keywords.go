@@ -0,0 +1,74 @@
+package d2lsp
+
+// keywordDocs are shown when hovering over or completing reserved keywords
+var keywordDocs = map[string]string{
+	"label":            "The text of a shape or connection. Defaults to the shape's key.",
+	"desc":             "A description of a shape or connection.",
+	"shape":            "The shape drawn, e.g. `rectangle`, `circle`, `cylinder`, `sql_table` or `sequence_diagram`.",
+	"icon":             "An image drawn in a shape, by URL, path, or `@pack/name` from an icon pack.",
+	"constraint":       "The SQL constraints of a column of a `sql_table`, e.g. `primary_key`.",
+	"tooltip":          "Text shown when hovering over a shape or connection in SVGs.",
+	"link":             "A URL, or a board like `layers.x`, that clicking a shape or connection goes to.",
+	"near":             "Places a shape near another, or at a constant position like `top-center`. On labels and icons, where they're placed in their shape.",
+	"width":            "The width of a shape, in pixels.",
+	"height":           "The height of a shape, in pixels.",
+	"direction":        "The direction the layout flows in: `up`, `down`, `left` or `right`.",
+	"top":              "The y coordinate of a shape, in pixels, for layout engines that support locking positions.",
+	"left":             "The x coordinate of a shape, in pixels, for layout engines that support locking positions.",
+	"grid-rows":        "Lays out the children of a shape in a grid with this many rows.",
+	"grid-columns":     "Lays out the children of a shape in a grid with this many columns.",
+	"grid-gap":         "The space between the cells of a grid, in pixels.",
+	"vertical-gap":     "The space between the rows of a grid, in pixels.",
+	"horizontal-gap":   "The space between the columns of a grid, in pixels.",
+	"class":            "Applies the fields of one or more classes defined in `classes`.",
+	"classes":          "Defines sets of fields that shapes and connections apply with `class`.",
+	"vars":             "Defines variables, substituted with `${name}`.",
+	"hidden":           "Hides a shape or connection without removing it from the diagram.",
+	"collapsed":        "Draws a container without its children.",
+	"direction-mirror": "Flips the layout of a board horizontally, for right-to-left reading diagrams.",
+	"straighten":       "Keeps a connection straight and short.",
+	"min-length":       "The fewest ranks a connection spans in dagre.",
+	"max-rows":         "The most columns of a `sql_table` drawn before the rest are collapsed into one row.",
+	"stereotype":       "The stereotype of a `class` shape, e.g. `interface`, drawn above its name.",
+	"group-by":         "Groups the members of a `class` shape, e.g. by `visibility`.",
+	"modifier":         "The modifier of a field or method of a `class` shape.",
+	"shape-src":        "The SVG a `custom` shape is drawn from.",
+	"board":            "The board a `board` shape embeds, e.g. `layers.detail`.",
+	"assert":           "Rules the shape or board must hold, e.g. `*.shape != circle` or `count(*.db) >= 1`, checked once it's compiled.",
+	"source-label":     "A label at the source end of a connection.",
+	"target-label":     "A label at the target end of a connection.",
+	"style":            "Holds the styles of a shape or connection, e.g. `style.fill`.",
+	"source-arrowhead": "Styles the arrowhead at the source end of a connection.",
+	"target-arrowhead": "Styles the arrowhead at the target end of a connection.",
+	"layers":           "Boards that start empty, linked to from shapes.",
+	"scenarios":        "Boards that start from their parent board and change it.",
+	"steps":            "Boards that each start from the previous step, for a sequence of changes.",
+
+	"opacity":        "The opacity of a shape or connection, from 0 to 1.",
+	"stroke":         "The color of the border of a shape, or of a connection.",
+	"fill":           "The color a shape is filled with.",
+	"fill-pattern":   "A pattern drawn over the fill of a shape, e.g. `dots` or `lines`.",
+	"stroke-width":   "The width of the border of a shape, or of a connection, in pixels.",
+	"stroke-dash":    "The length of the dashes of a border or connection, 0 for a solid line.",
+	"border-radius":  "How rounded the corners of a shape are, in pixels.",
+	"font":           "The font of a label, e.g. `mono`.",
+	"font-size":      "The size of the font of a label, in pixels.",
+	"font-color":     "The color of a label.",
+	"bold":           "Whether a label is bold.",
+	"italic":         "Whether a label is italic.",
+	"underline":      "Whether a label is underlined.",
+	"text-transform": "Changes the case of a label: `none`, `uppercase`, `lowercase` or `capitalize`.",
+	"text-align":     "How the lines of a label are aligned: `left`, `center` or `right`.",
+	"text-direction": "Which way a label reads: `ltr` or `rtl`. Detected from the label by default.",
+	"latex-scale":    "Scales LaTeX labels.",
+	"shadow":         "Draws a shadow under a shape.",
+	"multiple":       "Draws a shape as a stack of several.",
+	"double-border":  "Draws the border of a shape twice.",
+	"border-style":   "How the border of a shape is drawn: `solid`, `dashed`, `dotted` or `double`.",
+	"3d":             "Draws a square or rectangle as a box.",
+	"header":         "How the label of a container is set apart from its children: `band` or `tab`.",
+	"bundle":         "Joins the connections from or to a shape in a trunk, or of all shapes on the root.",
+	"layer-group":    "Groups shapes and connections in SVGs so they can be toggled together.",
+	"animated":       "Animates a connection in SVGs.",
+	"filled":         "Fills an arrowhead.",
+}
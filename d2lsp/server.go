@@ -0,0 +1,319 @@
+package d2lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"oss.terrastruct.com/d2/lib/version"
+)
+
+// server holds the documents open in the client, by URI
+type server struct {
+	w           io.Writer
+	initialized bool
+	documents   map[string]string
+	// writeErr is the first error writing to w, which ends Serve
+	writeErr error
+}
+
+// Serve serves the Language Server Protocol over r and w, typically stdin and stdout, until the
+// client sends exit or closes r. Requests are handled one at a time, in order.
+func Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s := &server{
+		w:         w,
+		documents: make(map[string]string),
+	}
+	tr := textproto.NewReader(bufio.NewReader(r))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b, err := readMessage(tr)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(b, &req); err != nil {
+			if err := s.respondError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handleRecovered(req)
+		if s.writeErr != nil {
+			return s.writeErr
+		}
+		if req.ID == nil {
+			// Notifications have no response, even when they fail
+			continue
+		}
+		if rerr != nil {
+			err = s.respondError(req.ID, rerr.Code, rerr.Message)
+		} else {
+			err = s.write(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleRecovered handles req, responding to panics with an internal error so that a bug hit
+// by one document doesn't end the server for every other
+func (s *server) handleRecovered(req request) (result interface{}, rerr *responseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, rerr = nil, &responseError{Code: codeInternalError, Message: fmt.Sprintf("failed to handle %s: %v", req.Method, r)}
+		}
+	}()
+	return s.handle(req)
+}
+
+func (s *server) handle(req request) (interface{}, *responseError) {
+	if !s.initialized && req.Method != "initialize" {
+		return nil, &responseError{Code: codeServerNotInitialized, Message: "initialize must be sent first"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		s.initialized = true
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// Full syncs, as D2 files are compiled whole anyway
+				"textDocumentSync":   1,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{".", ":"},
+				},
+				"hoverProvider":              true,
+				"renameProvider":             true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{
+				"name":    "d2",
+				"version": version.Version,
+			},
+		}, nil
+	case "initialized", "shutdown", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.documents[params.TextDocument.URI] = params.TextDocument.Text
+		s.publishDiagnostics(params.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		s.documents[params.TextDocument.URI] = params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.publishDiagnostics(params.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+		return nil, nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		path, text, rerr := s.document(req.Params, &params, &params.TextDocument)
+		if rerr != nil {
+			return nil, rerr
+		}
+		r, ok := Definition(path, text, params.Position)
+		if !ok {
+			return nil, nil
+		}
+		uri := params.TextDocument.URI
+		if r.Path != path {
+			uri = pathToURI(r.Path)
+		}
+		return Location{URI: uri, Range: toRange(r)}, nil
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		_, text, rerr := s.document(req.Params, &params, &params.TextDocument)
+		if rerr != nil {
+			return nil, rerr
+		}
+		items := Completion(text, params.Position)
+		if items == nil {
+			items = []CompletionItem{}
+		}
+		return items, nil
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		path, text, rerr := s.document(req.Params, &params, &params.TextDocument)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return Hover(path, text, params.Position), nil
+	case "textDocument/rename":
+		var params renameParams
+		path, text, rerr := s.document(req.Params, &params, &params.TextDocument)
+		if rerr != nil {
+			return nil, rerr
+		}
+		edits, err := Rename(path, text, params.Position, params.NewName)
+		if err != nil {
+			return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		return WorkspaceEdit{
+			Changes: map[string][]TextEdit{
+				params.TextDocument.URI: edits,
+			},
+		}, nil
+	case "textDocument/formatting":
+		var params formattingParams
+		path, text, rerr := s.document(req.Params, &params, &params.TextDocument)
+		if rerr != nil {
+			return nil, rerr
+		}
+		newText, err := Format(path, text)
+		if err != nil {
+			return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		return replaceAll(text, newText), nil
+	default:
+		return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("unsupported method %q", req.Method)}
+	}
+}
+
+// document decodes the params of a request on an open document into params and returns the
+// path and text of the document td identifies
+func (s *server) document(raw json.RawMessage, params interface{}, td *textDocumentIdentifier) (path, text string, _ *responseError) {
+	if err := json.Unmarshal(raw, params); err != nil {
+		return "", "", invalidParams(err)
+	}
+	text, ok := s.documents[td.URI]
+	if !ok {
+		return "", "", &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("document %s isn't open", td.URI)}
+	}
+	return uriToPath(td.URI), text, nil
+}
+
+func (s *server) publishDiagnostics(uri string) {
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: Diagnostics(uriToPath(uri), s.documents[uri]),
+	})
+}
+
+func (s *server) notify(method string, params interface{}) {
+	err := s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil && s.writeErr == nil {
+		s.writeErr = err
+	}
+}
+
+func (s *server) respondError(id *json.RawMessage, code int, msg string) error {
+	return s.write(errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &responseError{Code: code, Message: msg},
+	})
+}
+
+// write writes v as a message, with the Content-Length header the base protocol requires
+func (s *server) write(v interface{}) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	// Connections would otherwise be written as -\u003e
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	content := bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+	_, err := fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+// maxMessageSize is the largest message read, so a bad Content-Length can't exhaust memory
+const maxMessageSize = 64 << 20
+
+// readMessage reads the content of the next message in r
+func readMessage(r *textproto.Reader) ([]byte, error) {
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Content-Length header %q", header.Get("Content-Length"))
+	}
+	if n > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes is larger than %d bytes", n, maxMessageSize)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r.R, b)
+	return b, err
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// replaceAll returns the edit that replaces text with newText, if they differ
+func replaceAll(text, newText string) []TextEdit {
+	if text == newText {
+		return []TextEdit{}
+	}
+	lastLine := text[strings.LastIndex(text, "\n")+1:]
+	return []TextEdit{{
+		Range: Range{
+			End: Position{
+				Line:      strings.Count(text, "\n"),
+				Character: len(utf16.Encode([]rune(lastLine))),
+			},
+		},
+		NewText: newText,
+	}}
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	u := url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(path),
+	}
+	return u.String()
+}
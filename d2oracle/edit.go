@@ -306,7 +306,9 @@ func pathFromScopeObj(g *d2graph.Graph, key *d2ast.Key, fromScope *d2graph.Objec
 func recompile(g *d2graph.Graph) (*d2graph.Graph, error) {
 	s := d2format.Format(g.AST)
 	g2, _, err := d2compiler.Compile(g.AST.Range.Path, strings.NewReader(s), &d2compiler.CompileOptions{
-		FS: g.FS,
+		FS:          g.FS,
+		IconDir:     g.IconDir,
+		FetchImport: g.FetchImport,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to recompile:\n%s\n%w", s, err)
@@ -477,7 +479,8 @@ func _set(g *d2graph.Graph, baseAST *d2ast.Map, key string, tag, value *string)
 		}
 	}
 	ir, _, err := d2ir.Compile(g.AST, &d2ir.CompileOptions{
-		FS: g.FS,
+		FS:          g.FS,
+		FetchImport: g.FetchImport,
 	})
 	if err != nil {
 		return err
@@ -631,6 +634,61 @@ func _set(g *d2graph.Graph, baseAST *d2ast.Map, key string, tag, value *string)
 					attrs.Tooltip.MapKey.SetScalar(mk.Value.ScalarBox())
 					return nil
 				}
+			case "hidden":
+				if inlined(attrs.Hidden) {
+					attrs.Hidden.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "collapsed":
+				if inlined(attrs.Collapsed) {
+					attrs.Collapsed.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "direction-mirror":
+				if inlined(attrs.DirectionMirror) {
+					attrs.DirectionMirror.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "straighten":
+				if inlined(attrs.Straighten) {
+					attrs.Straighten.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "min-length":
+				if inlined(attrs.MinLength) {
+					attrs.MinLength.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "max-rows":
+				if inlined(attrs.MaxRows) {
+					attrs.MaxRows.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "stereotype":
+				if inlined(attrs.Stereotype) {
+					attrs.Stereotype.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "group-by":
+				if inlined(attrs.GroupBy) {
+					attrs.GroupBy.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "modifier":
+				if inlined(attrs.Modifier) {
+					attrs.Modifier.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "shape-src":
+				if inlined(attrs.ShapeSrc) {
+					attrs.ShapeSrc.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
+			case "board":
+				if inlined(attrs.Board) {
+					attrs.Board.MapKey.SetScalar(mk.Value.ScalarBox())
+					return nil
+				}
 			case "width":
 				if inlined(attrs.WidthAttr) {
 					attrs.WidthAttr.MapKey.SetScalar(mk.Value.ScalarBox())
@@ -813,6 +871,41 @@ func _set(g *d2graph.Graph, baseAST *d2ast.Map, key string, tag, value *string)
 						attrs.Style.FillPattern.MapKey.SetScalar(mk.Value.ScalarBox())
 						return nil
 					}
+				case "border-style":
+					if inlined(attrs.Style.BorderStyle) {
+						attrs.Style.BorderStyle.MapKey.SetScalar(mk.Value.ScalarBox())
+						return nil
+					}
+				case "text-align":
+					if inlined(attrs.Style.TextAlign) {
+						attrs.Style.TextAlign.MapKey.SetScalar(mk.Value.ScalarBox())
+						return nil
+					}
+				case "text-direction":
+					if inlined(attrs.Style.TextDirection) {
+						attrs.Style.TextDirection.MapKey.SetScalar(mk.Value.ScalarBox())
+						return nil
+					}
+				case "latex-scale":
+					if inlined(attrs.Style.LatexScale) {
+						attrs.Style.LatexScale.MapKey.SetScalar(mk.Value.ScalarBox())
+						return nil
+					}
+				case "header":
+					if inlined(attrs.Style.Header) {
+						attrs.Style.Header.MapKey.SetScalar(mk.Value.ScalarBox())
+						return nil
+					}
+				case "bundle":
+					if inlined(attrs.Style.Bundle) {
+						attrs.Style.Bundle.MapKey.SetScalar(mk.Value.ScalarBox())
+						return nil
+					}
+				case "layer-group":
+					if inlined(attrs.Style.LayerGroup) {
+						attrs.Style.LayerGroup.MapKey.SetScalar(mk.Value.ScalarBox())
+						return nil
+					}
 				}
 			case "label":
 				if len(mk.Key.Path[reservedIndex:]) > 1 {
@@ -830,6 +923,22 @@ func _set(g *d2graph.Graph, baseAST *d2ast.Map, key string, tag, value *string)
 						return nil
 					}
 				}
+			case "near":
+				if len(mk.Key.Path[reservedIndex:]) > 1 {
+					reservedTargetKey = mk.Key.Path[reservedIndex+1].Unbox().ScalarString()
+					switch reservedTargetKey {
+					case "side":
+						if inlined(attrs.NearSide) {
+							attrs.NearSide.MapKey.SetScalar(mk.Value.ScalarBox())
+							return nil
+						}
+					case "gap":
+						if inlined(attrs.NearGap) {
+							attrs.NearGap.MapKey.SetScalar(mk.Value.ScalarBox())
+							return nil
+						}
+					}
+				}
 			}
 		}
 	} else if attrs.Label.MapKey != nil {
@@ -1328,7 +1437,8 @@ func deleteReserved(g *d2graph.Graph, boardPath []string, baseAST *d2ast.Map, mk
 				id == "height" ||
 				id == "left" ||
 				id == "top" ||
-				id == "link" {
+				id == "link" ||
+				id == "hidden" {
 				deleted, err := deleteObjField(g, baseAST, obj, id)
 				if err != nil {
 					return nil, err
@@ -1793,6 +1903,15 @@ func move(g *d2graph.Graph, boardPath []string, key, newKey string, includeDesce
 		}
 	}
 
+	// Keys with globs apply to whatever they match, so they're left alone. The edges they
+	// created are written out by restoreEdges if they don't match the moved key anymore.
+	obj.References = go2.Filter(obj.References, func(ref d2graph.Reference) bool {
+		return ref.MapKey == nil || !ref.MapKey.HasGlob()
+	})
+	if len(obj.References) == 0 {
+		return nil, errors.New("cannot move an object only created by globs")
+	}
+
 	toParent := boardG.Root
 	if isCrossScope && len(ak2) > 1 {
 		toParent, ok = boardG.Root.HasChild(ak2[:len(ak2)-1])
@@ -2185,10 +2304,85 @@ func move(g *d2graph.Graph, boardPath []string, key, newKey string, includeDesce
 		if !replaced {
 			return nil, fmt.Errorf("board %v AST not found", boardPath)
 		}
-		return recompile(g)
+		g, err = recompile(g)
+	} else {
+		g, err = recompile(boardG)
+	}
+	if err != nil {
+		return nil, err
 	}
+	return restoreEdges(g, prevG, boardPath, ak, ak2, includeDescendants)
+}
 
-	return recompile(boardG)
+// restoreEdges writes out the edges connected to the object moved from ak to ak2 in prevG
+// that g doesn't have anymore, which are the edges created by globs that don't match it
+// at ak2
+func restoreEdges(g, prevG *d2graph.Graph, boardPath, ak, ak2 []string, includeDescendants bool) (*d2graph.Graph, error) {
+	// movedID returns where the object at ida is after the move, if it's known
+	movedID := func(ida []string) ([]string, bool) {
+		if len(ida) < len(ak) || strings.Join(ida[:len(ak)], ".") != strings.Join(ak, ".") {
+			return ida, true
+		}
+		if len(ida) == len(ak) {
+			return ak2, true
+		}
+		if includeDescendants {
+			return append(append([]string{}, ak2...), ida[len(ak):]...), true
+		}
+		// Children are moved to the parent, and renamed if there's a conflict there
+		return nil, false
+	}
+
+	boardG := GetBoardGraph(g, boardPath)
+	if boardG == nil {
+		return nil, fmt.Errorf("board %v not found", boardPath)
+	}
+	edgeCounts := make(map[string]int)
+	for _, e := range boardG.Edges {
+		edgeCounts[strings.Join(e.Src.AbsIDArray(), ".")+" -> "+strings.Join(e.Dst.AbsIDArray(), ".")]++
+	}
+
+	restored := false
+	for _, e := range prevG.Edges {
+		src, ok := movedID(e.Src.AbsIDArray())
+		if !ok {
+			continue
+		}
+		dst, ok := movedID(e.Dst.AbsIDArray())
+		if !ok {
+			continue
+		}
+		k := strings.Join(src, ".") + " -> " + strings.Join(dst, ".")
+		if edgeCounts[k] > 0 {
+			edgeCounts[k]--
+			continue
+		}
+		edge := &d2ast.Edge{
+			Src: d2ast.MakeKeyPath(src),
+			Dst: d2ast.MakeKeyPath(dst),
+		}
+		if e.SrcArrow {
+			edge.SrcArrow = "<"
+		}
+		if e.DstArrow {
+			edge.DstArrow = ">"
+		}
+		appendMapKey(boardG.BaseAST, &d2ast.Key{
+			Range: d2ast.MakeRange(",1:0:0-1:0:0"),
+			Edges: []*d2ast.Edge{edge},
+		})
+		restored = true
+	}
+	if !restored {
+		return g, nil
+	}
+
+	if len(boardPath) > 0 {
+		if !ReplaceBoardNode(g.AST, boardG.BaseAST, boardPath) {
+			return nil, fmt.Errorf("board %v AST not found", boardPath)
+		}
+	}
+	return recompile(g)
 }
 
 // filterReserved takes a Value and splits it into 2
@@ -5755,6 +5755,86 @@ layers: {
 }
 `,
 		},
+		{
+			name: "glob_edge",
+
+			text: `a: {
+  b
+}
+a.* -> x
+d
+`,
+			key:                `a.b`,
+			newKey:             `d.b`,
+			includeDescendants: true,
+
+			exp: `a
+a.* -> x
+d: {
+  b
+}
+d.b -> x
+`,
+			assertions: func(t *testing.T, g *d2graph.Graph) {
+				assert.JSON(t, len(g.Edges), 1)
+				assert.JSON(t, g.Edges[0].AbsID(), "(d.b -> x)[0]")
+			},
+		},
+		{
+			name: "glob_edge_still_matching",
+
+			text: `a: {
+  b
+}
+c: {
+  d
+}
+** -> z
+`,
+			key:    `a.b`,
+			newKey: `c.b`,
+
+			exp: `a
+c: {
+  d
+  b
+}
+** -> z
+`,
+		},
+		{
+			name: "glob_key",
+
+			text: `a: {
+  b
+  c
+}
+a.*.style.fill: red
+`,
+			key:    `a.b`,
+			newKey: `e`,
+
+			exp: `a: {
+  c
+}
+a.*.style.fill: red
+e
+`,
+		},
+		{
+			name: "glob_only",
+
+			text: `a: {
+  b
+}
+d
+*.b.style.fill: red
+`,
+			key:    `d.b`,
+			newKey: `e`,
+
+			expErr: `failed to move: "d.b" to "e": cannot move an object only created by globs`,
+		},
 		{
 			name: "scenarios-out-of-scope",
 
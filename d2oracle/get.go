@@ -18,6 +18,7 @@ func GetBoardGraph(g *d2graph.Graph, boardPath []string) *d2graph.Graph {
 			g2 := GetBoardGraph(g.Layers[i], boardPath[1:])
 			if g2 != nil {
 				g2.FS = g.FS
+				g2.FetchImport = g.FetchImport
 			}
 			return g2
 		}
@@ -27,6 +28,7 @@ func GetBoardGraph(g *d2graph.Graph, boardPath []string) *d2graph.Graph {
 			g2 := GetBoardGraph(g.Scenarios[i], boardPath[1:])
 			if g2 != nil {
 				g2.FS = g.FS
+				g2.FetchImport = g.FetchImport
 			}
 			return g2
 		}
@@ -36,6 +38,7 @@ func GetBoardGraph(g *d2graph.Graph, boardPath []string) *d2graph.Graph {
 			g2 := GetBoardGraph(g.Steps[i], boardPath[1:])
 			if g2 != nil {
 				g2.FS = g.FS
+				g2.FetchImport = g.FetchImport
 			}
 			return g2
 		}
@@ -0,0 +1,115 @@
+package d2oracle
+
+import (
+	"fmt"
+
+	"oss.terrastruct.com/util-go/xdefer"
+
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// EditType is the function an Edit is made with
+type EditType string
+
+const (
+	EditCreate EditType = "create"
+	EditSet    EditType = "set"
+	EditDelete EditType = "delete"
+	EditRename EditType = "rename"
+	EditMove   EditType = "move"
+)
+
+// Edit is one edit of a transaction, with the arguments of the function of its type
+type Edit struct {
+	Type      EditType `json:"type"`
+	BoardPath []string `json:"boardPath,omitempty"`
+	Key       string   `json:"key"`
+
+	// Tag and Value are what EditSet sets Key to
+	Tag   *string `json:"tag,omitempty"`
+	Value *string `json:"value,omitempty"`
+
+	// NewKey is the new name of EditRename, or the new key of EditMove
+	NewKey             string `json:"newKey,omitempty"`
+	IncludeDescendants bool   `json:"includeDescendants,omitempty"`
+}
+
+// Conflict is the error of a transaction that failed, with the edit it failed at. None of the
+// edits of the transaction are applied.
+type Conflict struct {
+	// Index is the index of Edit in the transaction
+	Index   int    `json:"index"`
+	Edit    Edit   `json:"edit"`
+	Message string `json:"message"`
+
+	err error
+}
+
+func (c *Conflict) Error() string {
+	return fmt.Sprintf("edit %d: %s", c.Index, c.Message)
+}
+
+func (c *Conflict) Unwrap() error {
+	return c.err
+}
+
+// Transact applies edits to g in order, all or none of them. g isn't modified: the edits are
+// applied to a copy of it, which is returned if they all succeed. Each edit compiles its result,
+// so it's valid. Otherwise the error is a *Conflict with the first edit that failed.
+//
+// keys are the keys the edits resulted in, as Create and Rename may pick others than were asked
+// for so as not to overwrite existing objects: the key Create made, the name Rename gave, or
+// else the key of the edit.
+func Transact(g *d2graph.Graph, edits []Edit) (_ *d2graph.Graph, keys []string, err error) {
+	defer xdefer.Errorf(&err, "failed to apply %d edits", len(edits))
+
+	// The edit functions modify the AST they're given even when they fail, so a copy is what's
+	// edited
+	tx, err := recompile(g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, e := range edits {
+		var key string
+		tx, key, err = applyEdit(tx, e)
+		if err != nil {
+			return nil, nil, &Conflict{
+				Index:   i,
+				Edit:    e,
+				Message: err.Error(),
+				err:     err,
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	return tx, keys, nil
+}
+
+func applyEdit(g *d2graph.Graph, e Edit) (_ *d2graph.Graph, key string, err error) {
+	// An edit that panics fails like any other, leaving the original graph as is
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to %s %#v: %v", e.Type, e.Key, r)
+		}
+	}()
+
+	switch e.Type {
+	case EditCreate:
+		return Create(g, e.BoardPath, e.Key)
+	case EditSet:
+		g, err = Set(g, e.BoardPath, e.Key, e.Tag, e.Value)
+		return g, e.Key, err
+	case EditDelete:
+		g, err = Delete(g, e.BoardPath, e.Key)
+		return g, e.Key, err
+	case EditRename:
+		return Rename(g, e.BoardPath, e.Key, e.NewKey)
+	case EditMove:
+		g, err = Move(g, e.BoardPath, e.Key, e.NewKey, e.IncludeDescendants)
+		return g, e.NewKey, err
+	default:
+		return nil, "", fmt.Errorf("unknown edit type %#v", e.Type)
+	}
+}
@@ -0,0 +1,107 @@
+package d2oracle_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+	"oss.terrastruct.com/util-go/go2"
+
+	"oss.terrastruct.com/d2/d2compiler"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2oracle"
+)
+
+func TestTransact(t *testing.T) {
+	t.Parallel()
+
+	text := `a -> b
+
+layers: {
+  x: {
+    c
+  }
+}
+`
+	testCases := []struct {
+		name  string
+		edits []d2oracle.Edit
+
+		exp     string
+		expKeys []string
+		expErr  string
+	}{
+		{
+			name: "all",
+			edits: []d2oracle.Edit{
+				{Type: d2oracle.EditCreate, Key: "a"},
+				{Type: d2oracle.EditSet, Key: "a 2.shape", Value: go2.Pointer("circle")},
+				{Type: d2oracle.EditRename, Key: "b", NewKey: "c"},
+				{Type: d2oracle.EditDelete, BoardPath: []string{"x"}, Key: "c"},
+				{Type: d2oracle.EditMove, Key: "a 2", NewKey: "c.d"},
+			},
+
+			exp: `a -> c
+c: {
+  d: {shape: circle}
+}
+
+layers: {
+  x
+}
+`,
+			expKeys: []string{"a 2", "a 2.shape", "c", "c", "c.d"},
+		},
+		{
+			name: "rollback",
+			edits: []d2oracle.Edit{
+				{Type: d2oracle.EditCreate, Key: "d"},
+				{Type: d2oracle.EditRename, Key: "e", NewKey: "f"},
+			},
+
+			expErr: `failed to apply 2 edits: edit 1: failed to rename "e" to "f": key does not exist`,
+		},
+		{
+			name: "invalid",
+			edits: []d2oracle.Edit{
+				{Type: d2oracle.EditSet, Key: "a.shape", Value: go2.Pointer("hexagonn")},
+			},
+
+			expErr: `failed to apply 1 edits: edit 0: failed to set "a.shape" to "\"hexagonn\"": failed to recompile:`,
+		},
+		{
+			name: "unknown_type",
+			edits: []d2oracle.Edit{
+				{Type: "copy", Key: "a"},
+			},
+
+			expErr: `failed to apply 1 edits: edit 0: unknown edit type "copy"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g, _, err := d2compiler.Compile("", strings.NewReader(text), nil)
+			assert.Success(t, err)
+
+			g2, keys, err := d2oracle.Transact(g, tc.edits)
+			// The graph given is never modified
+			assert.Equal(t, text, d2format.Format(g.AST))
+			if tc.expErr != "" {
+				assert.Error(t, err)
+				assert.Equal(t, true, strings.HasPrefix(err.Error(), tc.expErr))
+				var c *d2oracle.Conflict
+				assert.Equal(t, true, errors.As(err, &c))
+				assert.JSON(t, tc.edits[c.Index], c.Edit)
+				return
+			}
+			assert.Success(t, err)
+			assert.Equal(t, tc.exp, d2format.Format(g2.AST))
+			assert.Equal(t, strings.Join(tc.expKeys, ", "), strings.Join(keys, ", "))
+		})
+	}
+}
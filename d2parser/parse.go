@@ -29,16 +29,16 @@ type ParseOptions struct {
 
 // Parse parses a .d2 Map in r.
 //
-// The returned Map always represents a valid .d2 file. All encountered errors will be in
-// []error.
+// Parse doesn't stop at syntax errors. It recovers from each, e.g. by closing what's
+// unterminated or skipping to the next line, and returns the Map of everything it could
+// parse along with a *ParseError of all the errors encountered.
 //
 // The map may be compiled via Compile even if there are errors to keep language tooling
-// operational. Though autoformat should not run.
+// operational, see d2compiler.CompileOptions.Partial. Though autoformat should not run.
 //
 // If UTF16Pos is true, positions will be recorded in UTF-16 codeunits as required by LSP
 // and browser clients. See
 // https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocuments
-// TODO: update godocs
 func Parse(path string, r io.Reader, opts *ParseOptions) (*d2ast.Map, error) {
 	if opts == nil {
 		opts = &ParseOptions{
@@ -155,6 +155,13 @@ type parser struct {
 	err   *ParseError
 
 	inEdgeGroup bool
+	// inImport ends unquoted strings at the ( of import arguments, and inImportArgs at the , and
+	// ) between and after them
+	inImport     bool
+	inImportArgs bool
+	// inGlobFilter ends unquoted strings at the = or != and , of the filters of a glob, like
+	// *[shape=cylinder]
+	inGlobFilter bool
 
 	depth int
 }
@@ -166,12 +173,19 @@ type ParseError struct {
 	Errors       []d2ast.Error            `json:"errs"`
 }
 
+// Errorf returns an error at n, prefixed with its range
 func Errorf(n d2ast.Node, f string, v ...interface{}) error {
+	return CodeErrorf("", n, f, v...)
+}
+
+// CodeErrorf is Errorf for errors with a diagnostic code, one of d2ast's DIAGNOSTIC_ codes
+func CodeErrorf(code string, n d2ast.Node, f string, v ...interface{}) error {
 	f = "%v: " + f
 	v = append([]interface{}{n.GetRange()}, v...)
 	return d2ast.Error{
 		Range:   n.GetRange(),
 		Message: fmt.Sprintf(f, v...),
+		Code:    code,
 	}
 }
 
@@ -193,7 +207,14 @@ func (pe *ParseError) Error() string {
 	return sb.String()
 }
 
+// errorf adds a syntax error from start to end
 func (p *parser) errorf(start d2ast.Position, end d2ast.Position, f string, v ...interface{}) {
+	p.codeErrorf(d2ast.DIAGNOSTIC_SYNTAX, start, end, f, v...)
+}
+
+// codeErrorf adds an error from start to end with its diagnostic code, and returns it so that
+// a fix can be set on it
+func (p *parser) codeErrorf(code string, start d2ast.Position, end d2ast.Position, f string, v ...interface{}) *d2ast.Error {
 	r := d2ast.Range{
 		Path:  p.path,
 		Start: start,
@@ -204,7 +225,20 @@ func (p *parser) errorf(start d2ast.Position, end d2ast.Position, f string, v ..
 	p.err.Errors = append(p.err.Errors, d2ast.Error{
 		Range:   r,
 		Message: fmt.Sprintf(f, v...),
+		Code:    code,
 	})
+	return &p.err.Errors[len(p.err.Errors)-1]
+}
+
+// unterminatedf adds an error from start to end of what must be closed with terminator, fixed
+// by inserting it at end
+func (p *parser) unterminatedf(terminator string, start d2ast.Position, end d2ast.Position, f string, v ...interface{}) {
+	e := p.codeErrorf(d2ast.DIAGNOSTIC_UNTERMINATED, start, end, f, v...)
+	e.Fix = &d2ast.Fix{
+		Title:   fmt.Sprintf("Insert %s", terminator),
+		Range:   d2ast.Range{Path: p.path, Start: end, End: end},
+		NewText: terminator,
+	}
 }
 
 // _readRune reads the next rune from the underlying reader or from the p.readahead buffer.
@@ -402,7 +436,7 @@ func (p *parser) parseMap(isFileMap bool) *d2ast.Map {
 		r, eof := p.readNotSpace()
 		if eof {
 			if !isFileMap {
-				p.errorf(m.Range.Start, p.readerPos, "maps must be terminated with }")
+				p.unterminatedf("}", m.Range.Start, p.readerPos, "maps must be terminated with }")
 			}
 			return m
 		}
@@ -592,7 +626,7 @@ func (p *parser) parseBlockComment() *d2ast.BlockComment {
 	for {
 		r, eof := p.peek()
 		if eof {
-			p.errorf(bc.Range.Start, p.readerPos, `block comments must be terminated with """`)
+			p.unterminatedf(`"""`, bc.Range.Start, p.readerPos, `block comments must be terminated with """`)
 			return bc
 		}
 
@@ -609,7 +643,7 @@ func (p *parser) parseBlockComment() *d2ast.BlockComment {
 	for {
 		r, eof := p.read()
 		if eof {
-			p.errorf(bc.Range.Start, p.readerPos, `block comments must be terminated with """`)
+			p.unterminatedf(`"""`, bc.Range.Start, p.readerPos, `block comments must be terminated with """`)
 			return bc
 		}
 
@@ -620,7 +654,7 @@ func (p *parser) parseBlockComment() *d2ast.BlockComment {
 
 		s, eof := p.peekn(2)
 		if eof {
-			p.errorf(bc.Range.Start, p.readerPos, `block comments must be terminated with """`)
+			p.unterminatedf(`"""`, bc.Range.Start, p.readerPos, `block comments must be terminated with """`)
 			return bc
 		}
 		if s != `""` {
@@ -791,7 +825,7 @@ func (p *parser) parseEdgeGroup(mk *d2ast.Key) {
 	}
 	if r != ')' {
 		p.rewind()
-		p.errorf(mk.Range.Start, p.pos, "edge groups must be terminated with )")
+		p.unterminatedf(")", mk.Range.Start, p.pos, "edge groups must be terminated with )")
 		return
 	}
 	p.commit()
@@ -847,7 +881,7 @@ func (p *parser) parseEdgeIndex() *d2ast.EdgeIndex {
 			r, newlines, eof = p.peekNotSpace()
 			if eof || newlines > 0 {
 				p.rewind()
-				p.errorf(ei.Range.Start, p.pos, "unterminated edge index")
+				p.codeErrorf(d2ast.DIAGNOSTIC_UNTERMINATED, ei.Range.Start, p.pos, "unterminated edge index")
 				return nil
 			}
 			if r == ']' {
@@ -874,7 +908,7 @@ func (p *parser) parseEdgeIndex() *d2ast.EdgeIndex {
 	r, newlines, eof = p.peekNotSpace()
 	if eof || newlines > 0 || r != ']' {
 		p.rewind()
-		p.errorf(ei.Range.Start, p.pos, "unterminated edge index")
+		p.codeErrorf(d2ast.DIAGNOSTIC_UNTERMINATED, ei.Range.Start, p.pos, "unterminated edge index")
 		return ei
 	}
 	p.commit()
@@ -937,7 +971,7 @@ func (p *parser) parseEdge(e *d2ast.Edge) (ok bool) {
 	for {
 		r, eof := p.peek()
 		if eof {
-			p.errorf(e.Range.Start, p.readerPos, "unterminated connection")
+			p.codeErrorf(d2ast.DIAGNOSTIC_UNTERMINATED, e.Range.Start, p.readerPos, "unterminated connection")
 			return false
 		}
 		switch r {
@@ -1008,7 +1042,12 @@ func (p *parser) parseKey() (k *d2ast.KeyPath) {
 			return k
 		}
 		if sb.UnquotedString != nil && strings.HasPrefix(s.ScalarString(), "@") {
-			p.errorf(s.GetRange().Start, s.GetRange().End, "%s is not a valid import, did you mean ...%[2]s?", s.ScalarString())
+			e := p.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, s.GetRange().Start, s.GetRange().End, "%s is not a valid import, did you mean ...%[2]s?", s.ScalarString())
+			e.Fix = &d2ast.Fix{
+				Title:   fmt.Sprintf("Use the spread import ...%s", s.ScalarString()),
+				Range:   e.Range,
+				NewText: "..." + s.ScalarString(),
+			}
 		}
 
 		if len(k.Path) == 0 {
@@ -1016,6 +1055,10 @@ func (p *parser) parseKey() (k *d2ast.KeyPath) {
 		}
 		k.Path = append(k.Path, &sb)
 
+		if sb.UnquotedString != nil && p.peekAt(s.GetRange().End, '[') {
+			p.parseGlobFilters(sb.UnquotedString)
+		}
+
 		r, newlines, eof = p.peekNotSpace()
 		if eof {
 			return k
@@ -1136,6 +1179,14 @@ func (p *parser) parseUnquotedString(inKey bool) (s *d2ast.UnquotedString) {
 			p.rewind()
 			return s
 		}
+		if (p.inImport && r == '(') || (p.inImportArgs && (r == ',' || r == ')')) {
+			p.rewind()
+			return s
+		}
+		if p.inGlobFilter && (r == ',' || (inKey && (r == '=' || r == '!'))) {
+			p.rewind()
+			return s
+		}
 		if inKey {
 			switch r {
 			case ':', '.', '<', '>', '&':
@@ -1273,12 +1324,12 @@ func (p *parser) parseDoubleQuotedString(inKey bool) *d2ast.DoubleQuotedString {
 	for {
 		r, eof := p.peek()
 		if eof {
-			p.errorf(s.Range.Start, p.readerPos, `double quoted strings must be terminated with "`)
+			p.unterminatedf(`"`, s.Range.Start, p.readerPos, `double quoted strings must be terminated with "`)
 			return s
 		}
 		if r == '\n' {
 			p.rewind()
-			p.errorf(s.Range.Start, p.pos, `double quoted strings must be terminated with "`)
+			p.unterminatedf(`"`, s.Range.Start, p.pos, `double quoted strings must be terminated with "`)
 			return s
 		}
 
@@ -1308,7 +1359,7 @@ func (p *parser) parseDoubleQuotedString(inKey bool) *d2ast.DoubleQuotedString {
 		r2, eof := p.read()
 		if eof {
 			p.errorf(p.pos.Subtract('\\', p.utf16Pos), p.readerPos, "unfinished escape sequence")
-			p.errorf(s.Range.Start, p.readerPos, `double quoted strings must be terminated with "`)
+			p.unterminatedf(`"`, s.Range.Start, p.readerPos, `double quoted strings must be terminated with "`)
 			return s
 		}
 
@@ -1339,12 +1390,12 @@ func (p *parser) parseSingleQuotedString() *d2ast.SingleQuotedString {
 	for {
 		r, eof := p.peek()
 		if eof {
-			p.errorf(s.Range.Start, p.readerPos, `single quoted strings must be terminated with '`)
+			p.unterminatedf("'", s.Range.Start, p.readerPos, `single quoted strings must be terminated with '`)
 			return s
 		}
 		if r == '\n' {
 			p.rewind()
-			p.errorf(s.Range.Start, p.pos, `single quoted strings must be terminated with '`)
+			p.unterminatedf("'", s.Range.Start, p.pos, `single quoted strings must be terminated with '`)
 			return s
 		}
 		p.commit()
@@ -1407,7 +1458,7 @@ func (p *parser) parseBlockString() *d2ast.BlockString {
 	for {
 		r, eof := p.peek()
 		if eof {
-			p.errorf(bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
+			p.unterminatedf(bs.Quote+"|", bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
 			return bs
 		}
 
@@ -1423,7 +1474,7 @@ func (p *parser) parseBlockString() *d2ast.BlockString {
 	for {
 		r, eof := p.peek()
 		if eof {
-			p.errorf(bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
+			p.unterminatedf(bs.Quote+"|", bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
 			return bs
 		}
 
@@ -1447,7 +1498,7 @@ func (p *parser) parseBlockString() *d2ast.BlockString {
 	for {
 		r, eof := p.peek()
 		if eof {
-			p.errorf(bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
+			p.unterminatedf(bs.Quote+"|", bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
 			return bs
 		}
 		if !unicode.IsSpace(r) {
@@ -1473,7 +1524,7 @@ func (p *parser) parseBlockString() *d2ast.BlockString {
 	for {
 		r, eof := p.read()
 		if eof {
-			p.errorf(bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
+			p.unterminatedf(bs.Quote+"|", bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
 			return bs
 		}
 
@@ -1484,7 +1535,7 @@ func (p *parser) parseBlockString() *d2ast.BlockString {
 
 		s, eof := p.peekn(len(endRest))
 		if eof {
-			p.errorf(bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
+			p.unterminatedf(bs.Quote+"|", bs.Range.Start, p.readerPos, `block string must be terminated with %v`, bs.Quote+"|")
 			return bs
 		}
 		if s != endRest {
@@ -1512,7 +1563,7 @@ func (p *parser) parseArray() *d2ast.Array {
 	for {
 		r, eof := p.readNotSpace()
 		if eof {
-			p.errorf(a.Range.Start, p.readerPos, "arrays must be terminated with ]")
+			p.unterminatedf("]", a.Range.Start, p.readerPos, "arrays must be terminated with ]")
 			return a
 		}
 
@@ -1728,19 +1779,23 @@ func (p *parser) parseSubstitution(spread bool) *d2ast.Substitution {
 		p.commit()
 	}
 
-	k := p.parseKey()
-	if k != nil {
-		subst.Path = k.Path
+	if expr, ok := p.peekExpression(); ok {
+		subst.Expression = expr
+	} else {
+		k := p.parseKey()
+		if k != nil {
+			subst.Path = k.Path
+		}
 	}
 
 	r, newlines, eof = p.peekNotSpace()
 	if eof {
-		p.errorf(subst.Range.Start, p.readerPos, "substitutions must be terminated by }")
+		p.unterminatedf("}", subst.Range.Start, p.readerPos, "substitutions must be terminated by }")
 		return subst
 	}
 	if newlines > 0 || r != '}' {
 		p.rewind()
-		p.errorf(subst.Range.Start, p.pos, "substitutions must be terminated by }")
+		p.unterminatedf("}", subst.Range.Start, p.pos, "substitutions must be terminated by }")
 		return subst
 	}
 	p.commit()
@@ -1748,6 +1803,29 @@ func (p *parser) parseSubstitution(spread bool) *d2ast.Substitution {
 	return subst
 }
 
+// peekExpression reads what's left of a substitution if it's an expression, see
+// d2ast.IsExpression
+func (p *parser) peekExpression() (string, bool) {
+	var sb strings.Builder
+	for {
+		r, eof := p.peek()
+		if eof || r == '}' || r == '\n' {
+			break
+		}
+		sb.WriteRune(r)
+	}
+	p.rewind()
+	s := sb.String()
+	if !d2ast.IsExpression(s) {
+		return "", false
+	}
+	for range s {
+		p.peek()
+	}
+	p.commit()
+	return strings.TrimSpace(s), true
+}
+
 func (p *parser) parseImport(spread bool) *d2ast.Import {
 	imp := &d2ast.Import{
 		Range: d2ast.Range{
@@ -1777,7 +1855,9 @@ func (p *parser) parseImport(spread bool) *d2ast.Import {
 	}
 	imp.Pre = pre.String()
 
+	p.inImport = true
 	k := p.parseKey()
+	p.inImport = false
 	if k == nil {
 		return imp
 	}
@@ -1785,9 +1865,147 @@ func (p *parser) parseImport(spread bool) *d2ast.Import {
 		k.Path = append(k.Path[:1], k.Path[2:]...)
 	}
 	imp.Path = k.Path
+
+	// A # right after the path starts the subtree to import rather than a comment
+	end := k.Range.End
+	if p.peekAt(end, '#') {
+		p.inImport = true
+		imp.Subtree = p.parseKey()
+		p.inImport = false
+		if imp.Subtree == nil {
+			p.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp.Range.Start, p.pos, "imports must name the subtree to import after #, like @lib#database")
+			return imp
+		}
+		end = imp.Subtree.Range.End
+	}
+	if p.peekAt(end, '(') {
+		p.parseImportArgs(imp)
+	}
 	return imp
 }
 
+// peekAt reads r if it's the next rune and nothing was read past end, the end of the last
+// node parsed.
+func (p *parser) peekAt(end d2ast.Position, r rune) bool {
+	if p.pos.Byte != end.Byte {
+		return false
+	}
+	r2, eof := p.peek()
+	if eof || r2 != r {
+		p.rewind()
+		return false
+	}
+	p.commit()
+	return true
+}
+
+// parseGlobFilters parses the filters of the pattern us after its [, like
+// *[shape=cylinder, style.fill!=red].
+func (p *parser) parseGlobFilters(us *d2ast.UnquotedString) {
+	if us.Pattern == nil {
+		p.errorf(us.Range.Start, p.pos, "only globs can be filtered in [], like *[shape=cylinder]")
+	}
+	p.inGlobFilter = true
+	defer func() {
+		p.inGlobFilter = false
+		us.Range.End = p.pos
+	}()
+	for {
+		r, eof := p.readNotSpace()
+		if eof {
+			p.errorf(us.Range.Start, p.pos, "glob filters must be closed with ]")
+			return
+		}
+		switch r {
+		case ']':
+			return
+		case ',':
+			continue
+		}
+		p.replay(r)
+
+		filter := &d2ast.Key{
+			Range: d2ast.Range{
+				Path:  p.path,
+				Start: p.pos,
+			},
+		}
+		filter.Key = p.parseKey()
+		r, eof = p.readNotSpace()
+		if !eof && r == '!' {
+			r, eof = p.read()
+			filter.NotAmpersand = true
+		} else {
+			filter.Ampersand = true
+		}
+		if filter.Key == nil || eof || r != '=' {
+			p.errorf(filter.Range.Start, p.pos, "glob filters must be an attribute and its value, like shape=cylinder or shape!=cylinder")
+			return
+		}
+		s := p.parseString(false)
+		if s.Unbox() == nil {
+			p.errorf(filter.Range.Start, p.pos, "glob filter %q needs a value", filter.Key.Path[len(filter.Key.Path)-1].Unbox().ScalarString())
+			if r, _, eof := p.peekNotSpace(); !eof && r == ']' {
+				p.commit()
+			} else {
+				p.rewind()
+			}
+			return
+		}
+		filter.Value = d2ast.MakeValueBox(s.Unbox())
+		filter.Range.End = s.Unbox().GetRange().End
+		us.Filters = append(us.Filters, filter)
+	}
+}
+
+// parseImportArgs parses the arguments to the vars of an import after its (, like
+// @service(name: auth, color: blue).
+func (p *parser) parseImportArgs(imp *d2ast.Import) {
+	p.inImportArgs = true
+	defer func() {
+		p.inImportArgs = false
+	}()
+	for {
+		r, eof := p.readNotSpace()
+		if eof {
+			p.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, imp.Range.Start, p.pos, "imports must close their arguments with )")
+			return
+		}
+		switch r {
+		case ')':
+			return
+		case ',':
+			continue
+		}
+		p.replay(r)
+
+		arg := &d2ast.Key{
+			Range: d2ast.Range{
+				Path:  p.path,
+				Start: p.pos,
+			},
+		}
+		arg.Key = p.parseKey()
+		if arg.Key == nil {
+			p.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, arg.Range.Start, p.pos, "import arguments must be a var and its value, like name: auth")
+			return
+		}
+		r, eof = p.readNotSpace()
+		if eof || r != ':' {
+			p.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, arg.Range.Start, p.pos, "import arguments must be a var and its value, like name: auth")
+			return
+		}
+		s := p.parseString(false)
+		if s.Unbox() == nil {
+			p.codeErrorf(d2ast.DIAGNOSTIC_IMPORT, arg.Range.Start, p.pos, "import argument %q needs a value", arg.Key.Path[len(arg.Key.Path)-1].Unbox().ScalarString())
+			return
+		}
+		arg.Value = d2ast.MakeValueBox(s.Unbox())
+		arg.Range.End = s.Unbox().GetRange().End
+		imp.Args = append(imp.Args, arg)
+	}
+}
+
 // func marshalKey(k *d2ast.Key) string {
 // 	var sb strings.Builder
 // 	for i, s := range k.Path {
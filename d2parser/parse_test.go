@@ -392,6 +392,41 @@ c-
 				assert.True(t, ast.Nodes[1].MapKey.NotAmpersand)
 			},
 		},
+		{
+			name: "glob_filters",
+			text: `
+*[shape=cylinder, style.fill != red].style.stroke: blue
+!*-db: service
+`,
+			assert: func(t testing.TB, ast *d2ast.Map, err error) {
+				assert.Success(t, err)
+				filters := ast.Nodes[0].MapKey.Key.Path[0].UnquotedString.Filters
+				assert.Equal(t, 2, len(filters))
+				assert.True(t, filters[0].Ampersand)
+				assert.Equal(t, "shape", filters[0].Key.Path[0].Unbox().ScalarString())
+				assert.Equal(t, "cylinder", filters[0].Value.ScalarBox().Unbox().ScalarString())
+				assert.True(t, filters[1].NotAmpersand)
+				assert.Equal(t, "style.fill", d2format.Format(filters[1].Key))
+				assert.Equal(t, "red", filters[1].Value.ScalarBox().Unbox().ScalarString())
+				assert.Equal(t, 3, len(ast.Nodes[0].MapKey.Key.Path))
+				assert.Equal(t, "!*-db", ast.Nodes[1].MapKey.Key.Path[0].Unbox().ScalarString())
+			},
+		},
+		{
+			name: "glob_filters_errors",
+			text: `
+a[shape=cylinder]: b
+*[shape]: b
+*[shape=]: b
+*[shape=cylinder: b
+`,
+			assert: func(t testing.TB, ast *d2ast.Map, err error) {
+				assert.ErrorString(t, err, `d2/testdata/d2parser/TestParse/glob_filters_errors.d2:2:1: only globs can be filtered in [], like *[shape=cylinder]
+d2/testdata/d2parser/TestParse/glob_filters_errors.d2:3:3: glob filters must be an attribute and its value, like shape=cylinder or shape!=cylinder
+d2/testdata/d2parser/TestParse/glob_filters_errors.d2:4:3: glob filter "shape" needs a value
+d2/testdata/d2parser/TestParse/glob_filters_errors.d2:5:1: glob filters must be closed with ]`)
+			},
+		},
 		{
 			name: "whitespace_range",
 			text: ` a -> b -> c `,
@@ -500,6 +535,53 @@ func testImport(t *testing.T) {
 				assert.ErrorString(t, err, "d2/testdata/d2parser/TestParse/import/#09.d2:1:7: unquoted strings cannot begin with ...@ as that's import spread syntax")
 			},
 		},
+		{
+			text: "...@file.d2#db.primary",
+			assert: func(t testing.TB, ast *d2ast.Map, err error) {
+				assert.Success(t, err)
+				assert.Equal(t, "file", ast.Nodes[0].Import.PathWithPre())
+				assert.Equal(t, "db.primary", strings.Join(ast.Nodes[0].Import.Subtree.IDA(), "."))
+			},
+		},
+		{
+			text: "...@file #db",
+			assert: func(t testing.TB, ast *d2ast.Map, err error) {
+				assert.Success(t, err)
+				assert.True(t, ast.Nodes[0].Import.Subtree == nil)
+				assert.Equal(t, "db", ast.Nodes[1].Comment.Value)
+			},
+		},
+		{
+			text: "...@file#",
+			assert: func(t testing.TB, ast *d2ast.Map, err error) {
+				assert.ErrorString(t, err, "d2/testdata/d2parser/TestParse/import/#12.d2:1:1: imports must name the subtree to import after #, like @lib#database")
+			},
+		},
+		{
+			text: `...@svc#db(name: auth, color: "#0ff")`,
+			assert: func(t testing.TB, ast *d2ast.Map, err error) {
+				assert.Success(t, err)
+				imp := ast.Nodes[0].Import
+				assert.Equal(t, "svc", imp.PathWithPre())
+				assert.Equal(t, "db", imp.Subtree.Path[0].Unbox().ScalarString())
+				assert.Equal(t, 2, len(imp.Args))
+				assert.Equal(t, "name", imp.Args[0].Key.Path[0].Unbox().ScalarString())
+				assert.Equal(t, "auth", imp.Args[0].Value.ScalarBox().Unbox().ScalarString())
+				assert.Equal(t, "#0ff", imp.Args[1].Value.ScalarBox().Unbox().ScalarString())
+			},
+		},
+		{
+			text: "x: @svc(name: auth",
+			assert: func(t testing.TB, ast *d2ast.Map, err error) {
+				assert.ErrorString(t, err, "d2/testdata/d2parser/TestParse/import/#14.d2:1:4: imports must close their arguments with )")
+			},
+		},
+		{
+			text: "x: @svc(auth)",
+			assert: func(t testing.TB, ast *d2ast.Map, err error) {
+				assert.ErrorString(t, err, "d2/testdata/d2parser/TestParse/import/#15.d2:1:9: import arguments must be a var and its value, like name: auth")
+			},
+		},
 	}
 
 	runa(t, tca)
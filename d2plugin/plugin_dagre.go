@@ -40,6 +40,13 @@ func (p *dagrePlugin) Flags(context.Context) ([]PluginSpecificFlag, error) {
 			Usage:   "number of pixels that separate edges horizontally.",
 			Tag:     "edgesep",
 		},
+		{
+			Name:    "dagre-tiebreak",
+			Type:    "string",
+			Default: d2dagrelayout.DefaultOpts.TieBreak,
+			Usage:   `how to order siblings that are equally good positions. "declaration" keeps them in the order they were written.`,
+			Tag:     "tiebreak",
+		},
 	}, nil
 }
 
@@ -71,9 +78,12 @@ func (p *dagrePlugin) Info(ctx context.Context) (*PluginInfo, error) {
 	}
 
 	return &PluginInfo{
-		Name:      "dagre",
-		Type:      "bundled",
-		Features:  []PluginFeature{},
+		Name: "dagre",
+		Type: "bundled",
+		Features: []PluginFeature{
+			TOP_LEFT,
+			NEAR_OBJECT,
+		},
 		ShortHelp: "The directed graph layout library Dagre",
 		LongHelp: fmt.Sprintf(`dagre is a directed graph layout library for JavaScript.
 See https://d2lang.com/tour/dagre for more.
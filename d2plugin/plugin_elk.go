@@ -90,6 +90,7 @@ func (p elkPlugin) Info(ctx context.Context) (*PluginInfo, error) {
 		Features: []PluginFeature{
 			CONTAINER_DIMENSIONS,
 			DESCENDANT_EDGES,
+			NEAR_OBJECT,
 		},
 		ShortHelp: "Eclipse Layout Kernel (ELK) with the Layered algorithm.",
 		LongHelp: fmt.Sprintf(`ELK is a layout engine offered by Eclipse.
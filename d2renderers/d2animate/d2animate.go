@@ -44,6 +44,13 @@ func makeKeyframe(delayMS, durationMS, totalMS, identifier int, diagramHash stri
 }
 
 func Wrap(rootDiagram *d2target.Diagram, svgs [][]byte, renderOpts d2svg.RenderOpts, intervalMS int) ([]byte, error) {
+	return WrapWithTransitions(rootDiagram, svgs, renderOpts, intervalMS, 0)
+}
+
+// WrapWithTransitions is Wrap, but if transitionMS is positive, boards morph into the next ones
+// instead of cutting to them. Over the first transitionMS of each board, the shapes it shares
+// with the board before move and fade from how they were there, and the rest fade in.
+func WrapWithTransitions(rootDiagram *d2target.Diagram, svgs [][]byte, renderOpts d2svg.RenderOpts, intervalMS, transitionMS int) ([]byte, error) {
 	buf := &bytes.Buffer{}
 
 	// TODO account for stroke width of root border
@@ -101,11 +108,22 @@ func Wrap(rootDiagram *d2target.Diagram, svgs [][]byte, renderOpts d2svg.RenderO
 	for i := range svgs {
 		fmt.Fprint(buf, makeKeyframe(i*intervalMS, intervalMS, len(svgs)*intervalMS, i, diagramHash))
 	}
+	boards := animatedBoards(rootDiagram)
+	tween := transitionMS > 0 && len(boards) == len(svgs)
+	if tween {
+		for i := 1; i < len(boards); i++ {
+			fmt.Fprint(buf, makeTweens(boards[i-1], boards[i], i, i*intervalMS, transitionMS, len(svgs)*intervalMS, diagramHash))
+		}
+	}
 	fmt.Fprint(buf, `]]></style>`)
 
 	for i, svg := range svgs {
 		str := string(svg)
-		str = strings.Replace(str, "<g", fmt.Sprintf(`<g style="animation: d2Transition-%s-%d %dms infinite"`, diagramHash, i, len(svgs)*intervalMS), 1)
+		var boardID string
+		if tween {
+			boardID = fmt.Sprintf(` id="%s"`, tweenBoardID(diagramHash, i))
+		}
+		str = strings.Replace(str, "<g", fmt.Sprintf(`<g%s style="animation: d2Transition-%s-%d %dms infinite"`, boardID, diagramHash, i, len(svgs)*intervalMS), 1)
 		buf.Write([]byte(str))
 	}
 
@@ -114,3 +132,89 @@ func Wrap(rootDiagram *d2target.Diagram, svgs [][]byte, renderOpts d2svg.RenderO
 
 	return buf.Bytes(), nil
 }
+
+// animatedBoards are the boards of rootDiagram in the order they're rendered to be animated
+func animatedBoards(d *d2target.Diagram) []*d2target.Diagram {
+	var boards []*d2target.Diagram
+	if !d.IsFolderOnly {
+		boards = append(boards, d)
+	}
+	for _, children := range [][]*d2target.Diagram{d.Layers, d.Scenarios, d.Steps} {
+		for _, child := range children {
+			boards = append(boards, animatedBoards(child)...)
+		}
+	}
+	return boards
+}
+
+func tweenBoardID(diagramHash string, index int) string {
+	return fmt.Sprintf("%s-board-%d", diagramHash, index)
+}
+
+// makeTweens animates the shapes and connections of curr, the board at index, from how they were
+// in prev, over durationMS starting at delayMS
+func makeTweens(prev, curr *d2target.Diagram, index, delayMS, durationMS, totalMS int, diagramHash string) string {
+	percentageStart := (float64(delayMS) / float64(totalMS)) * 100.
+	percentageEnd := (float64(delayMS+durationMS) / float64(totalMS)) * 100.
+	boardID := tweenBoardID(diagramHash, index)
+
+	prevShapes := make(map[string]d2target.Shape, len(prev.Shapes))
+	for _, s := range prev.Shapes {
+		prevShapes[s.ID] = s
+	}
+
+	var sb strings.Builder
+	count := 0
+	tween := func(id, from, to string) {
+		name := fmt.Sprintf("d2Tween-%s-%d-%d", diagramHash, index, count)
+		count++
+		fmt.Fprintf(&sb, `@keyframes %s {
+		0%%, %f%% {
+				%s
+		}
+		%f%%, 100%% {
+				%s
+		}
+}`, name, percentageStart, from, percentageEnd, to)
+		fmt.Fprintf(&sb, `#%s [id=%s] {
+		animation: %s %dms infinite;
+}`, boardID, cssString(id), name, totalMS)
+	}
+
+	for _, s := range curr.Shapes {
+		p, ok := prevShapes[s.ID]
+		if !ok {
+			tween(s.ID, "opacity: 0;", fmt.Sprintf("opacity: %f;", s.Opacity))
+			continue
+		}
+		dx, dy := p.Pos.X-s.Pos.X, p.Pos.Y-s.Pos.Y
+		if dx == 0 && dy == 0 && p.Opacity == s.Opacity {
+			continue
+		}
+		tween(s.ID,
+			fmt.Sprintf("transform: translate(%dpx, %dpx); opacity: %f;", dx, dy, p.Opacity),
+			fmt.Sprintf("transform: translate(0px, 0px); opacity: %f;", s.Opacity),
+		)
+	}
+	// Routes can't be tweened, so connections fade in while their shapes move
+	for _, c := range curr.Connections {
+		tween(c.ID, "opacity: 0;", fmt.Sprintf("opacity: %f;", c.Opacity))
+	}
+	return sb.String()
+}
+
+// cssString quotes s for a CSS selector in a CDATA section
+func cssString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\', '>', '\n':
+			fmt.Fprintf(&sb, "\\%x ", r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
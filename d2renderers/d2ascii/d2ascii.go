@@ -0,0 +1,464 @@
+// d2ascii renders sequence diagrams as plain text, for places that only take text such as
+// commit messages and RFCs. Actors are boxes with lifelines as vertical pipes, messages are
+// arrows with their labels above them, in the order of the layout, and notes are boxes on
+// their actor's lifeline. Dashed messages are drawn with dots. Groups and spans aren't drawn.
+//
+// Boards with several sequence diagrams render each one under its label. Other objects and
+// boards without sequence diagrams can't be rendered as text.
+package d2ascii
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/idpath"
+)
+
+// lifelineEnd is in the IDs of the ends of the lifeline connections added by the sequence
+// diagram layout
+const lifelineEnd = "-lifeline-end-"
+
+// gap is the least number of columns between boxes and around labels
+const gap = 2
+
+type sequence struct {
+	label  string
+	actors []*actor
+	events []event
+}
+
+type actor struct {
+	label []string
+	// center is the column of the lifeline
+	center int
+}
+
+// event is a message or a note, drawn in order of y
+type event struct {
+	y        float64
+	src, dst int
+	label    []string
+	srcArrow bool
+	dstArrow bool
+	dashed   bool
+	// note is the index of the actor a note is on, or -1 for messages
+	note int
+}
+
+func Render(diagram *d2target.Diagram) ([]byte, error) {
+	sequences, err := findSequences(diagram)
+	if err != nil {
+		return nil, err
+	}
+	if len(sequences) == 0 {
+		return nil, errors.New("only sequence diagrams can be rendered as text")
+	}
+
+	var sb strings.Builder
+	for i, s := range sequences {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		if s.label != "" {
+			sb.WriteString(s.label + ":\n\n")
+		}
+		sb.WriteString(s.render())
+	}
+	return []byte(sb.String()), nil
+}
+
+func findSequences(diagram *d2target.Diagram) ([]*sequence, error) {
+	byContainer := make(map[string]*sequence)
+	var sequences []*sequence
+	actorsByPath := make(idpath.Map[*actor])
+	actorSequence := make(map[*actor]*sequence)
+	for _, shape := range diagram.Shapes {
+		isActor := false
+		for _, c := range diagram.Connections {
+			if c.Src == shape.ID && strings.Contains(c.Dst, lifelineEnd) {
+				isActor = true
+				break
+			}
+		}
+		if !isActor {
+			continue
+		}
+		path, err := idpath.Split(shape.ID)
+		if err != nil {
+			return nil, err
+		}
+		container := path[:len(path)-1]
+		s, ok := byContainer[idpath.Key(container)]
+		if !ok {
+			s = &sequence{}
+			if len(container) > 0 {
+				s.label = strings.Join(container, ".")
+				for _, other := range diagram.Shapes {
+					if otherPath, err := idpath.Split(other.ID); err == nil && idpath.Key(otherPath) == idpath.Key(container) {
+						s.label = other.Label
+					}
+				}
+			}
+			byContainer[idpath.Key(container)] = s
+			sequences = append(sequences, s)
+		}
+		a := &actor{
+
+			label: strings.Split(shape.Label, "\n"),
+		}
+		s.actors = append(s.actors, a)
+		actorsByPath.Set(path, a)
+		actorSequence[a] = s
+	}
+
+	actorIndex := func(a *actor) int {
+		for i, other := range actorSequence[a].actors {
+			if other == a {
+				return i
+			}
+		}
+		return -1
+	}
+	connected := make(map[string]struct{})
+	for _, c := range diagram.Connections {
+		if strings.Contains(c.Dst, lifelineEnd) {
+			continue
+		}
+		connected[c.Src] = struct{}{}
+		connected[c.Dst] = struct{}{}
+		src, err := actorsByPath.ConnectionEnd(c.Src)
+		if err != nil {
+			return nil, err
+		}
+		dst, err := actorsByPath.ConnectionEnd(c.Dst)
+		if err != nil {
+			return nil, err
+		}
+		if src == nil || dst == nil || actorSequence[src] != actorSequence[dst] {
+			continue
+		}
+		var y float64
+		if len(c.Route) > 0 {
+			y = c.Route[0].Y
+		}
+		s := actorSequence[src]
+		s.events = append(s.events, event{
+			y:        y,
+			src:      actorIndex(src),
+			dst:      actorIndex(dst),
+			label:    splitLabel(c.Label),
+			srcArrow: c.SrcArrow != d2target.NoArrowhead,
+			dstArrow: c.DstArrow != d2target.NoArrowhead,
+			dashed:   c.StrokeDash > 0,
+			note:     -1,
+		})
+	}
+
+	// Notes are objects on actors that aren't connected, unlike spans
+	for _, shape := range diagram.Shapes {
+		if _, ok := connected[shape.ID]; ok {
+			continue
+		}
+		path, err := idpath.Split(shape.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) < 2 {
+			continue
+		}
+		a := actorsByPath.Ancestor(path[:len(path)-1])
+		if a == nil {
+			continue
+		}
+		hasConnectedChild := false
+		for id := range connected {
+			if strings.HasPrefix(id, shape.ID+".") {
+				hasConnectedChild = true
+				break
+			}
+		}
+		if hasConnectedChild {
+			continue
+		}
+		s := actorSequence[a]
+		s.events = append(s.events, event{
+			y:     float64(shape.Pos.Y),
+			label: strings.Split(shape.Label, "\n"),
+			note:  actorIndex(a),
+		})
+	}
+
+	for _, s := range sequences {
+		sort.SliceStable(s.events, func(i, j int) bool {
+			return s.events[i].y < s.events[j].y
+		})
+	}
+	return sequences, nil
+}
+
+func (s *sequence) render() string {
+	s.place()
+
+	width := 0
+	for i, a := range s.actors {
+		right := a.center + (boxWidth(a.label)+1)/2
+		if i == len(s.actors)-1 {
+			for _, e := range s.events {
+				if e.note == -1 && e.src == i && e.dst == i {
+					right = max(right, a.center+selfWidth(e.label))
+				}
+			}
+		}
+		width = max(width, right+1)
+	}
+
+	c := &canvas{width: width}
+
+	boxHeight := 0
+	for _, a := range s.actors {
+		boxHeight = max(boxHeight, len(a.label)+2)
+	}
+	top := c.addRows(boxHeight)
+	for _, a := range s.actors {
+		c.box(top, a.center-boxWidth(a.label)/2, boxWidth(a.label), boxHeight, a.label)
+	}
+
+	lifelines := func(n int) int {
+		row := c.addRows(n)
+		for _, a := range s.actors {
+			for i := row; i < row+n; i++ {
+				c.set(i, a.center, '|')
+			}
+		}
+		return row
+	}
+
+	lifelines(1)
+	for _, e := range s.events {
+		switch {
+		case e.note != -1:
+			a := s.actors[e.note]
+			w := boxWidth(e.label)
+			row := lifelines(len(e.label) + 2)
+			c.box(row, a.center-w/2, w, len(e.label)+2, e.label)
+		case e.src == e.dst:
+			s.renderSelfMessage(c, e, lifelines(len(e.label)+2))
+		default:
+			s.renderMessage(c, e, lifelines(len(e.label)+1))
+		}
+		lifelines(1)
+	}
+	return c.String()
+}
+
+func (s *sequence) renderMessage(c *canvas, e event, row int) {
+	left, right := s.actors[e.src].center, s.actors[e.dst].center
+	leftArrow, rightArrow := e.srcArrow, e.dstArrow
+	if left > right {
+		left, right = right, left
+		leftArrow, rightArrow = rightArrow, leftArrow
+	}
+	for i, line := range e.label {
+		col := (left+right)/2 - utf8.RuneCountInString(line)/2
+		c.text(row+i, max(col, left+gap), line)
+	}
+	arrowRow := row + len(e.label)
+	line := '-'
+	if e.dashed {
+		line = '.'
+	}
+	for col := left + 1; col < right; col++ {
+		c.set(arrowRow, col, line)
+	}
+	if leftArrow {
+		c.set(arrowRow, left+1, '<')
+	}
+	if rightArrow {
+		c.set(arrowRow, right-1, '>')
+	}
+}
+
+// renderSelfMessage draws a message from an actor to itself as a loop to the right of its
+// lifeline with the label beside it
+func (s *sequence) renderSelfMessage(c *canvas, e event, row int) {
+	center := s.actors[e.src].center
+	line := '-'
+	if e.dashed {
+		line = '.'
+	}
+	last := row + len(e.label) + 1
+	for col := center + 1; col < center+selfLoopWidth; col++ {
+		c.set(row, col, line)
+		c.set(last, col, line)
+	}
+	c.set(row, center+selfLoopWidth, '.')
+	c.set(last, center+selfLoopWidth, '\'')
+	for i, l := range e.label {
+		c.set(row+1+i, center+selfLoopWidth, '|')
+		c.text(row+1+i, center+selfLoopWidth+gap, l)
+	}
+	if len(e.label) == 0 {
+		c.set(row+1, center+selfLoopWidth, '|')
+	}
+	if e.srcArrow {
+		c.set(row, center+1, '<')
+	}
+	if e.dstArrow {
+		c.set(last, center+1, '<')
+	}
+}
+
+// selfLoopWidth is how many columns a message to the same actor loops out
+const selfLoopWidth = 4
+
+func selfWidth(label []string) int {
+	return selfLoopWidth + gap + labelWidth(label)
+}
+
+// place sets the columns of lifelines so that boxes and labels fit between them
+func (s *sequence) place() {
+	if len(s.actors) == 0 {
+		return
+	}
+	// gaps[i] is the distance between the lifelines of actor i and actor i+1
+	gaps := make([]int, len(s.actors)-1)
+	for i := range gaps {
+		gaps[i] = (boxWidth(s.actors[i].label)+1)/2 + boxWidth(s.actors[i+1].label)/2 + gap
+	}
+	for _, e := range s.events {
+		switch {
+		case e.note != -1:
+			half := (boxWidth(e.label)+1)/2 + gap
+			if e.note > 0 {
+				gaps[e.note-1] = max(gaps[e.note-1], half)
+			}
+			if e.note < len(gaps) {
+				gaps[e.note] = max(gaps[e.note], half)
+			}
+		case e.src == e.dst:
+			if e.src < len(gaps) {
+				gaps[e.src] = max(gaps[e.src], selfWidth(e.label)+gap)
+			}
+		}
+	}
+
+	// Messages across several actors widen the last gap they cross when their labels don't fit
+	messages := make([]event, 0, len(s.events))
+	for _, e := range s.events {
+		if e.note == -1 && e.src != e.dst {
+			messages = append(messages, e)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return span(messages[i]) < span(messages[j])
+	})
+	for _, e := range messages {
+		left, right := min(e.src, e.dst), max(e.src, e.dst)
+		need := labelWidth(e.label) + 2*gap
+		have := 0
+		for i := left; i < right; i++ {
+			have += gaps[i]
+		}
+		if have < need {
+			gaps[right-1] += need - have
+		}
+	}
+
+	s.actors[0].center = boxWidth(s.actors[0].label) / 2
+	for _, e := range s.events {
+		if e.note == 0 {
+			s.actors[0].center = max(s.actors[0].center, boxWidth(e.label)/2)
+		}
+	}
+	for i, g := range gaps {
+		s.actors[i+1].center = s.actors[i].center + g
+	}
+}
+
+func span(e event) int {
+	if e.src > e.dst {
+		return e.src - e.dst
+	}
+	return e.dst - e.src
+}
+
+func boxWidth(label []string) int {
+	return labelWidth(label) + 4
+}
+
+func labelWidth(label []string) int {
+	w := 0
+	for _, l := range label {
+		w = max(w, utf8.RuneCountInString(l))
+	}
+	return w
+}
+
+func splitLabel(label string) []string {
+	if label == "" {
+		return nil
+	}
+	return strings.Split(label, "\n")
+}
+
+type canvas struct {
+	width int
+	rows  [][]rune
+}
+
+// addRows adds n blank rows and returns the index of the first
+func (c *canvas) addRows(n int) int {
+	row := len(c.rows)
+	for i := 0; i < n; i++ {
+		c.rows = append(c.rows, []rune(strings.Repeat(" ", c.width)))
+	}
+	return row
+}
+
+func (c *canvas) set(row, col int, r rune) {
+	if col < 0 || col >= c.width {
+		return
+	}
+	c.rows[row][col] = r
+}
+
+func (c *canvas) text(row, col int, s string) {
+	for _, r := range s {
+		c.set(row, col, r)
+		col++
+	}
+}
+
+// box draws a box with its label centered in it, clearing what's under it
+func (c *canvas) box(row, col, w, h int, label []string) {
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			ch := ' '
+			switch {
+			case (i == 0 || i == h-1) && (j == 0 || j == w-1):
+				ch = '+'
+			case i == 0 || i == h-1:
+				ch = '-'
+			case j == 0 || j == w-1:
+				ch = '|'
+			}
+			c.set(row+i, col+j, ch)
+		}
+	}
+	top := row + 1 + (h-2-len(label))/2
+	for i, l := range label {
+		c.text(top+i, col+(w-utf8.RuneCountInString(l))/2, l)
+	}
+}
+
+func (c *canvas) String() string {
+	var sb strings.Builder
+	for _, row := range c.rows {
+		sb.WriteString(strings.TrimRight(string(row), " "))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,49 @@
+package d2ascii_test
+
+import (
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2renderers/d2ascii"
+	"oss.terrastruct.com/d2/d2renderers/internal/d2rendertest"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	out, err := d2ascii.Render(d2rendertest.Compile(t, `shape: sequence_diagram
+alice: Alice
+bob
+db: Database
+alice -> bob: hello
+bob -> db: a long query across
+bob -> bob: think
+bob.note: "hmm"
+db -> alice: rows {style.stroke-dash: 3}
+`))
+	assert.Success(t, err)
+	assert.Testdata(t, ".txt", out)
+}
+
+func TestRenderNested(t *testing.T) {
+	t.Parallel()
+
+	out, err := d2ascii.Render(d2rendertest.Compile(t, `checkout: Checkout {
+  shape: sequence_diagram
+  a -> b: "1"
+  b <-> a
+}
+user -> checkout
+`))
+	assert.Success(t, err)
+	assert.Testdata(t, ".txt", out)
+}
+
+func TestRenderNoSequenceDiagram(t *testing.T) {
+	t.Parallel()
+
+	_, err := d2ascii.Render(d2rendertest.Compile(t, `a -> b`))
+	assert.Error(t, err)
+	assert.String(t, "only sequence diagrams can be rendered as text", err.Error())
+}
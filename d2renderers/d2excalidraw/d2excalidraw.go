@@ -0,0 +1,487 @@
+// d2excalidraw converts a laid out diagram into an Excalidraw scene (.excalidraw JSON),
+// so that it can be opened and edited further in https://excalidraw.com.
+//
+// Excalidraw has a much smaller set of primitives than D2, so shapes without an Excalidraw
+// equivalent (cylinders, hexagons, etc.) are exported as rectangles of the same bounds.
+package d2excalidraw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/d2themes"
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/color"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/label"
+	"oss.terrastruct.com/d2/lib/shape"
+)
+
+const (
+	SOURCE = "https://d2lang.com"
+
+	// Excalidraw font families
+	fontFamilyHandDrawn = 1
+	fontFamilyNormal    = 2
+	fontFamilyCode      = 3
+
+	lineHeight = 1.25
+)
+
+type RenderOpts struct {
+	ThemeID        *int64
+	ThemeOverrides *d2target.ThemeOverrides
+	// Sketch renders elements with Excalidraw's hand-drawn roughness
+	Sketch *bool
+}
+
+type Scene struct {
+	Type     string                 `json:"type"`
+	Version  int                    `json:"version"`
+	Source   string                 `json:"source"`
+	Elements []*Element             `json:"elements"`
+	AppState AppState               `json:"appState"`
+	Files    map[string]interface{} `json:"files"`
+}
+
+type AppState struct {
+	ViewBackgroundColor string `json:"viewBackgroundColor"`
+	GridSize            *int   `json:"gridSize"`
+}
+
+type Element struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	X               float64         `json:"x"`
+	Y               float64         `json:"y"`
+	Width           float64         `json:"width"`
+	Height          float64         `json:"height"`
+	Angle           float64         `json:"angle"`
+	StrokeColor     string          `json:"strokeColor"`
+	BackgroundColor string          `json:"backgroundColor"`
+	FillStyle       string          `json:"fillStyle"`
+	StrokeWidth     float64         `json:"strokeWidth"`
+	StrokeStyle     string          `json:"strokeStyle"`
+	Roughness       int             `json:"roughness"`
+	Opacity         int             `json:"opacity"`
+	GroupIDs        []string        `json:"groupIds"`
+	FrameID         *string         `json:"frameId"`
+	Roundness       *Roundness      `json:"roundness"`
+	Seed            int64           `json:"seed"`
+	Version         int             `json:"version"`
+	VersionNonce    int64           `json:"versionNonce"`
+	IsDeleted       bool            `json:"isDeleted"`
+	BoundElements   []*BoundElement `json:"boundElements"`
+	Updated         int64           `json:"updated"`
+	Link            *string         `json:"link"`
+	Locked          bool            `json:"locked"`
+
+	// text
+	Text          string  `json:"text,omitempty"`
+	OriginalText  string  `json:"originalText,omitempty"`
+	FontSize      int     `json:"fontSize,omitempty"`
+	FontFamily    int     `json:"fontFamily,omitempty"`
+	TextAlign     string  `json:"textAlign,omitempty"`
+	VerticalAlign string  `json:"verticalAlign,omitempty"`
+	ContainerID   *string `json:"containerId,omitempty"`
+	LineHeight    float64 `json:"lineHeight,omitempty"`
+
+	// arrow
+	Points         [][2]float64 `json:"points,omitempty"`
+	StartBinding   *Binding     `json:"startBinding,omitempty"`
+	EndBinding     *Binding     `json:"endBinding,omitempty"`
+	StartArrowhead *string      `json:"startArrowhead,omitempty"`
+	EndArrowhead   *string      `json:"endArrowhead,omitempty"`
+}
+
+type Roundness struct {
+	Type int `json:"type"`
+}
+
+type BoundElement struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type Binding struct {
+	ElementID string  `json:"elementId"`
+	Focus     float64 `json:"focus"`
+	Gap       float64 `json:"gap"`
+}
+
+// Render converts the diagram into an Excalidraw scene and returns it as JSON
+func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
+	scene, err := Convert(diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(scene)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Convert converts the diagram into an Excalidraw scene
+func Convert(diagram *d2target.Diagram, opts *RenderOpts) (*Scene, error) {
+	if opts == nil {
+		opts = &RenderOpts{}
+	}
+	themeID := d2themescatalog.NeutralDefault.ID
+	if opts.ThemeID != nil {
+		themeID = *opts.ThemeID
+	}
+	theme := d2themescatalog.Find(themeID)
+	if theme.ID != themeID {
+		return nil, fmt.Errorf("theme %d not found", themeID)
+	}
+	theme.ApplyOverrides(opts.ThemeOverrides)
+
+	c := &converter{
+		theme:     theme,
+		sketch:    opts.Sketch != nil && *opts.Sketch,
+		shapeByID: make(map[string]*Element),
+	}
+
+	var objects []diagramObject
+	for _, s := range diagram.Shapes {
+		objects = append(objects, s)
+	}
+	for _, conn := range diagram.Connections {
+		objects = append(objects, conn)
+	}
+	sortObjects(objects)
+
+	for _, obj := range objects {
+		switch obj := obj.(type) {
+		case d2target.Shape:
+			c.convertShape(obj)
+		case d2target.Connection:
+			c.convertConnection(obj)
+		}
+	}
+
+	if c.elements == nil {
+		c.elements = []*Element{}
+	}
+	return &Scene{
+		Type:     "excalidraw",
+		Version:  2,
+		Source:   SOURCE,
+		Elements: c.elements,
+		AppState: AppState{
+			ViewBackgroundColor: c.color(diagram.Root.Fill, theme.Colors.Neutrals.N7),
+		},
+		Files: map[string]interface{}{},
+	}, nil
+}
+
+type converter struct {
+	theme     d2themes.Theme
+	sketch    bool
+	elements  []*Element
+	shapeByID map[string]*Element
+}
+
+func (c *converter) newElement(id, typ string) *Element {
+	el := &Element{
+		ID:              id,
+		Type:            typ,
+		StrokeColor:     c.theme.Colors.Neutrals.N1,
+		BackgroundColor: "transparent",
+		FillStyle:       "solid",
+		StrokeWidth:     2,
+		StrokeStyle:     "solid",
+		Opacity:         100,
+		GroupIDs:        []string{},
+		Seed:            seed(id),
+		Version:         1,
+		VersionNonce:    seed(id + "#nonce"),
+	}
+	if c.sketch {
+		el.Roughness = 1
+	}
+	c.elements = append(c.elements, el)
+	return el
+}
+
+func (c *converter) convertShape(s d2target.Shape) {
+	if s.Type == d2target.ShapeText || s.Type == d2target.ShapeCode {
+		c.addText(s.ID+".label", s.Text, float64(s.Pos.X), float64(s.Pos.Y), float64(s.Width), float64(s.Height), s.Opacity)
+		return
+	}
+
+	typ := "rectangle"
+	switch s.Type {
+	case d2target.ShapeCircle, d2target.ShapeOval:
+		typ = "ellipse"
+	case d2target.ShapeDiamond:
+		typ = "diamond"
+	}
+
+	el := c.newElement(s.ID, typ)
+	el.X = float64(s.Pos.X)
+	el.Y = float64(s.Pos.Y)
+	el.Width = float64(s.Width)
+	el.Height = float64(s.Height)
+	el.StrokeColor = c.color(s.Stroke, c.theme.Colors.Neutrals.N1)
+	el.BackgroundColor = c.color(s.Fill, "transparent")
+	el.StrokeWidth = float64(s.StrokeWidth)
+	el.StrokeStyle = strokeStyle(s.StrokeDash)
+	if s.StrokeDotted {
+		el.StrokeStyle = "dotted"
+	}
+	el.Opacity = opacity(s.Opacity)
+	if s.BorderRadius > 0 && typ == "rectangle" {
+		el.Roundness = &Roundness{Type: 3}
+	}
+	if s.Link != "" {
+		el.Link = &s.Link
+	}
+	c.shapeByID[s.ID] = el
+
+	if s.Label == "" {
+		return
+	}
+
+	box := geo.NewBox(geo.NewPoint(el.X, el.Y), el.Width, el.Height)
+	switch s.Type {
+	case d2target.ShapeSQLTable:
+		columns := s.SQLTable.DrawnRows()
+		rowHeight := box.Height / float64(1+len(columns))
+		header := geo.NewBox(box.TopLeft, box.Width, rowHeight)
+		c.addText(s.ID+".label", s.Text, header.TopLeft.X, header.TopLeft.Y, header.Width, header.Height, s.Opacity)
+		var rows []string
+		for _, col := range columns {
+			rows = append(rows, groupRow(col.Shape, col.Name.Label, strings.TrimSpace(fmt.Sprintf("%s %s %s", col.Name.Label, col.Type.Label, col.ConstraintAbbr()))))
+		}
+		c.addRows(s, rows, box.TopLeft.Y+rowHeight, rowHeight)
+		return
+	case d2target.ShapeClass:
+		rowHeight := box.Height / float64(2+len(s.Fields)+len(s.Methods))
+		headerHeight := math.Max(2*rowHeight, float64(s.LabelHeight)+2*label.PADDING)
+		header := s.Text
+		if s.Class.Stereotype != "" {
+			header.Label = "«" + s.Class.Stereotype + "»\n" + header.Label
+		}
+		c.addText(s.ID+".label", header, box.TopLeft.X, box.TopLeft.Y, box.Width, headerHeight, s.Opacity)
+		var rows []string
+		for _, f := range s.Fields {
+			rows = append(rows, groupRow(f.Shape, f.Name, fmt.Sprintf("%s %s %s", f.VisibilityToken(), f.Name, f.Type)))
+		}
+		for _, m := range s.Methods {
+			rows = append(rows, groupRow(m.Shape, m.Name, fmt.Sprintf("%s %s %s", m.VisibilityToken(), m.Name, m.Return)))
+		}
+		c.addRows(s, rows, box.TopLeft.Y+headerHeight, rowHeight)
+		return
+	}
+
+	labelPosition := label.FromString(s.LabelPosition)
+	var labelBox *geo.Box
+	if labelPosition.IsOutside() {
+		labelBox = box
+	} else {
+		labelBox = shape.NewShape(d2target.DSL_SHAPE_TO_SHAPE_TYPE[s.Type], box).GetInnerBox()
+	}
+	tl := labelPosition.GetPointOnBox(labelBox, label.PADDING, float64(s.LabelWidth), float64(s.LabelHeight))
+	c.addText(s.ID+".label", s.Text, tl.X, tl.Y, float64(s.LabelWidth), float64(s.LabelHeight), s.Opacity)
+}
+
+// groupRow returns the text for a header or separator row, or text for regular rows
+func groupRow(shape, name, text string) string {
+	switch shape {
+	case d2target.ShapeRowHeader:
+		return "— " + name + " —"
+	case d2target.ShapeRowSeparator:
+		return "————"
+	}
+	return text
+}
+
+// addRows adds the rows of a sql_table or class as a single left aligned text element
+func (c *converter) addRows(s d2target.Shape, rows []string, top, rowHeight float64) {
+	if len(rows) == 0 {
+		return
+	}
+	el := c.addText(s.ID+".rows", d2target.Text{
+		Label:      strings.Join(rows, "\n"),
+		FontSize:   s.FontSize,
+		FontFamily: "mono",
+		Color:      s.Color,
+	}, float64(s.Pos.X)+label.PADDING, top, float64(s.Width)-2*label.PADDING, rowHeight*float64(len(rows)), s.Opacity)
+	el.TextAlign = "left"
+	el.LineHeight = rowHeight / float64(s.FontSize)
+}
+
+func (c *converter) addText(id string, text d2target.Text, x, y, width, height, op float64) *Element {
+	el := c.newElement(id, "text")
+	el.X = x
+	el.Y = y
+	el.Width = width
+	el.Height = height
+	el.StrokeColor = c.color(text.Color, c.theme.Colors.Neutrals.N1)
+	el.StrokeWidth = 1
+	el.Opacity = opacity(op)
+	el.Text = text.Label
+	el.OriginalText = text.Label
+	el.FontSize = text.FontSize
+	el.FontFamily = fontFamily(text.FontFamily, c.sketch)
+	el.TextAlign = "center"
+	if text.TextAlign != "" {
+		el.TextAlign = text.TextAlign
+	}
+	el.VerticalAlign = "middle"
+	el.LineHeight = lineHeight
+	return el
+}
+
+func (c *converter) convertConnection(conn d2target.Connection) {
+	if len(conn.Route) < 2 {
+		return
+	}
+	el := c.newElement(conn.ID, "arrow")
+	origin := conn.Route[0]
+	el.X = origin.X
+	el.Y = origin.Y
+	minX, minY, maxX, maxY := 0., 0., 0., 0.
+	for _, p := range conn.Route {
+		dx, dy := p.X-origin.X, p.Y-origin.Y
+		el.Points = append(el.Points, [2]float64{dx, dy})
+		minX, minY = math.Min(minX, dx), math.Min(minY, dy)
+		maxX, maxY = math.Max(maxX, dx), math.Max(maxY, dy)
+	}
+	el.Width = maxX - minX
+	el.Height = maxY - minY
+	el.StrokeColor = c.color(conn.Stroke, c.theme.Colors.Neutrals.N1)
+	el.StrokeWidth = float64(conn.StrokeWidth)
+	el.StrokeStyle = strokeStyle(conn.StrokeDash)
+	el.Opacity = opacity(conn.Opacity)
+	el.StartArrowhead = arrowhead(conn.SrcArrow)
+	el.EndArrowhead = arrowhead(conn.DstArrow)
+	if conn.IsCurve {
+		el.Roundness = &Roundness{Type: 2}
+	}
+	if src, ok := c.shapeByID[conn.Src]; ok {
+		el.StartBinding = &Binding{ElementID: src.ID}
+		src.BoundElements = append(src.BoundElements, &BoundElement{ID: el.ID, Type: "arrow"})
+	}
+	if dst, ok := c.shapeByID[conn.Dst]; ok {
+		el.EndBinding = &Binding{ElementID: dst.ID}
+		dst.BoundElements = append(dst.BoundElements, &BoundElement{ID: el.ID, Type: "arrow"})
+	}
+
+	if conn.Label != "" {
+		tl := conn.GetLabelTopLeft()
+		if tl != nil {
+			c.addText(conn.ID+".label", conn.Text, tl.X, tl.Y, float64(conn.LabelWidth), float64(conn.LabelHeight), conn.Opacity)
+		}
+	}
+}
+
+// color resolves theme color codes to hex, falling back when the color is unset
+// or can't be represented in Excalidraw (e.g. gradients)
+func (c *converter) color(code, fallback string) string {
+	if code == "" || strings.Contains(code, "gradient") {
+		return fallback
+	}
+	if color.IsThemeColor(code) {
+		return d2themes.ResolveThemeColor(c.theme, code)
+	}
+	return code
+}
+
+func strokeStyle(dash float64) string {
+	if dash > 0 {
+		return "dashed"
+	}
+	return "solid"
+}
+
+func opacity(o float64) int {
+	return int(math.Round(o * 100))
+}
+
+func fontFamily(family string, sketch bool) int {
+	if family == "mono" {
+		return fontFamilyCode
+	}
+	if sketch {
+		return fontFamilyHandDrawn
+	}
+	return fontFamilyNormal
+}
+
+// arrowhead maps D2 arrowheads to the closest Excalidraw arrowhead
+func arrowhead(a d2target.Arrowhead) *string {
+	var s string
+	switch a {
+	case d2target.NoArrowhead:
+		return nil
+	case d2target.ArrowArrowhead:
+		s = "arrow"
+	case d2target.TriangleArrowhead:
+		s = "triangle"
+	case d2target.UnfilledTriangleArrowhead:
+		s = "triangle_outline"
+	case d2target.DiamondArrowhead:
+		s = "diamond_outline"
+	case d2target.FilledDiamondArrowhead:
+		s = "diamond"
+	case d2target.CircleArrowhead:
+		s = "circle_outline"
+	case d2target.FilledCircleArrowhead:
+		s = "circle"
+	case d2target.LineArrowhead, d2target.TeeArrowhead:
+		s = "bar"
+	case d2target.CfOne, d2target.CfOneRequired:
+		s = "crowfoot_one"
+	case d2target.CfMany:
+		s = "crowfoot_many"
+	case d2target.CfManyRequired:
+		s = "crowfoot_one_or_many"
+	default:
+		s = "triangle"
+	}
+	return &s
+}
+
+// seed derives a stable seed from the element ID so that exports are deterministic
+func seed(id string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int64(h.Sum32() & math.MaxInt32)
+}
+
+type diagramObject interface {
+	GetID() string
+	GetZIndex() int
+}
+
+// sortObjects orders shapes and connections the same way the SVG renderer draws them:
+// by zIndex, then containers before their children, then shapes before connections
+func sortObjects(objects []diagramObject) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		iZIndex := objects[i].GetZIndex()
+		jZIndex := objects[j].GetZIndex()
+		if iZIndex != jZIndex {
+			return iZIndex < jZIndex
+		}
+		iShape, iIsShape := objects[i].(d2target.Shape)
+		jShape, jIsShape := objects[j].(d2target.Shape)
+		if iIsShape && jIsShape {
+			return iShape.Level < jShape.Level
+		}
+		_, jIsConnection := objects[j].(d2target.Connection)
+		return iIsShape && jIsConnection
+	})
+}
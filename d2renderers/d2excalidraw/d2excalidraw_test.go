@@ -0,0 +1,99 @@
+package d2excalidraw_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/util-go/assert"
+	"oss.terrastruct.com/util-go/go2"
+
+	"oss.terrastruct.com/d2/d2renderers/d2excalidraw"
+	"oss.terrastruct.com/d2/d2renderers/internal/d2rendertest"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	diagram := d2rendertest.Compile(t, `a -> b: hello
+a.shape: circle
+b.style.stroke-dash: 3
+c: {
+  shape: diamond
+  style.fill: "#ff0000"
+}
+b <-> c
+`)
+	out, err := d2excalidraw.Render(diagram, nil)
+	assert.Success(t, err)
+
+	var scene d2excalidraw.Scene
+	err = json.Unmarshal(out, &scene)
+	assert.Success(t, err)
+	assert.String(t, "excalidraw", scene.Type)
+
+	byID := map[string]*d2excalidraw.Element{}
+	for _, el := range scene.Elements {
+		byID[el.ID] = el
+	}
+
+	assert.String(t, "ellipse", byID["a"].Type)
+	assert.String(t, "rectangle", byID["b"].Type)
+	assert.String(t, "dashed", byID["b"].StrokeStyle)
+	assert.String(t, "diamond", byID["c"].Type)
+	assert.String(t, "#ff0000", byID["c"].BackgroundColor)
+	assert.String(t, "a", byID["a.label"].Text)
+
+	edge := byID["(a -> b)[0]"]
+	if !tassert.NotNil(t, edge) {
+		return
+	}
+	assert.String(t, "arrow", edge.Type)
+	tassert.Nil(t, edge.StartArrowhead)
+	assert.String(t, "triangle", *edge.EndArrowhead)
+	assert.String(t, "a", edge.StartBinding.ElementID)
+	assert.String(t, "b", edge.EndBinding.ElementID)
+	tassert.Equal(t, [2]float64{0, 0}, edge.Points[0])
+	tassert.Equal(t, []*d2excalidraw.BoundElement{{ID: "(a -> b)[0]", Type: "arrow"}}, byID["a"].BoundElements)
+	assert.String(t, "hello", byID["(a -> b)[0].label"].Text)
+
+	bidi := byID["(b <-> c)[0]"]
+	if !tassert.NotNil(t, bidi) {
+		return
+	}
+	assert.String(t, "triangle", *bidi.StartArrowhead)
+
+	// shapes are drawn before the connections attached to them
+	idx := map[string]int{}
+	for i, el := range scene.Elements {
+		idx[el.ID] = i
+	}
+	tassert.Less(t, idx["b"], idx["(a -> b)[0]"])
+}
+
+func TestRenderSQLTable(t *testing.T) {
+	t.Parallel()
+
+	diagram := d2rendertest.Compile(t, `users: {
+  shape: sql_table
+  id: int {constraint: primary_key}
+  name: string
+}
+`)
+	scene, err := d2excalidraw.Convert(diagram, &d2excalidraw.RenderOpts{Sketch: go2.Pointer(true)})
+	assert.Success(t, err)
+
+	var rows *d2excalidraw.Element
+	for _, el := range scene.Elements {
+		tassert.Equal(t, 1, el.Roughness)
+		if el.ID == "users.rows" {
+			rows = el
+		}
+	}
+	if !tassert.NotNil(t, rows) {
+		return
+	}
+	assert.String(t, "id int PK\nname string", rows.Text)
+	tassert.Equal(t, 3, rows.FontFamily)
+}
@@ -1,9 +1,12 @@
 package d2fonts
 
 import (
+	"bytes"
 	"path/filepath"
 	"testing"
 
+	"github.com/golang/freetype/truetype"
+
 	"oss.terrastruct.com/d2/lib/font"
 	"oss.terrastruct.com/util-go/assert"
 	"oss.terrastruct.com/util-go/diff"
@@ -21,3 +24,29 @@ func TestCutFont(t *testing.T) {
 	err := diff.Testdata(filepath.Join("testdata", "d2fonts", "cut"), ".txt", fontBuf)
 	assert.Success(t, err)
 }
+
+func TestWoff2Sfnt(t *testing.T) {
+	f := Font{
+		Family: SourceSansPro,
+		Style:  FONT_STYLE_REGULAR,
+	}
+	face := FontFaces.Get(f)
+	fontBuf := make([]byte, len(face))
+	copy(fontBuf, face)
+	woff, err := font.Sfnt2Woff(fontBuf)
+	assert.Success(t, err)
+
+	sfnt, err := font.Woff2Sfnt(woff)
+	assert.Success(t, err)
+	_, err = truetype.Parse(sfnt)
+	assert.Success(t, err)
+	// Converting it back gives the same woff
+	again, err := font.Sfnt2Woff(sfnt)
+	assert.Success(t, err)
+	if !bytes.Equal(woff, again) {
+		t.Fatal("expected the same woff after converting it back")
+	}
+
+	_, err = font.Woff2Sfnt(append([]byte("wOF2"), woff[4:]...))
+	assert.ErrorString(t, err, "WOFF2 fonts are not supported")
+}
@@ -0,0 +1,151 @@
+// d2graphml exports the structure and geometry of a laid out diagram as GraphML or GEXF, so
+// that it can be loaded into graph tools such as yEd and Gephi for further analysis.
+//
+// Containers become nested graphs in GraphML and parent IDs in GEXF. Positions are those of
+// the layout engine that laid the diagram out, in D2's coordinate system where y grows
+// downwards. A connection with only a source arrowhead is exported pointing the other way,
+// and one without arrowheads as undirected. Only the board being rendered is exported.
+package d2graphml
+
+import (
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/d2themes"
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/color"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+const CREATOR = "D2 - https://d2lang.com"
+
+type RenderOpts struct {
+	ThemeID        *int64
+	ThemeOverrides *d2target.ThemeOverrides
+}
+
+// node is a shape and the shapes nested in it
+type node struct {
+	shape    d2target.Shape
+	children []*node
+}
+
+// edge is a connection with its direction normalized
+type edge struct {
+	conn     d2target.Connection
+	src, dst string
+	directed bool
+	// srcArrow and dstArrow are the arrowheads at src and dst
+	srcArrow, dstArrow d2target.Arrowhead
+	route              []*geo.Point
+}
+
+type graph struct {
+	theme d2themes.Theme
+	roots []*node
+	edges []*edge
+}
+
+func newGraph(diagram *d2target.Diagram, opts *RenderOpts) (*graph, error) {
+	if opts == nil {
+		opts = &RenderOpts{}
+	}
+	themeID := d2themescatalog.NeutralDefault.ID
+	if opts.ThemeID != nil {
+		themeID = *opts.ThemeID
+	}
+	theme := d2themescatalog.Find(themeID)
+	if theme.ID != themeID {
+		return nil, fmt.Errorf("theme %d not found", themeID)
+	}
+	theme.ApplyOverrides(opts.ThemeOverrides)
+	g := &graph{
+		theme: theme,
+	}
+
+	nodes := make([]*node, len(diagram.Shapes))
+	paths := make([][]string, len(diagram.Shapes))
+	byPath := make(map[string]*node, len(diagram.Shapes))
+	for i, s := range diagram.Shapes {
+		k, err := d2parser.ParseKey(s.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ID %q: %w", s.ID, err)
+		}
+		nodes[i] = &node{shape: s}
+		paths[i] = k.IDA()
+		byPath[strings.Join(paths[i], "\x00")] = nodes[i]
+	}
+	// Shapes aren't ordered by nesting, so parents are looked up once all are known
+	for i, n := range nodes {
+		path := paths[i]
+		if parent, ok := byPath[strings.Join(path[:len(path)-1], "\x00")]; ok && len(path) > 1 {
+			parent.children = append(parent.children, n)
+		} else {
+			g.roots = append(g.roots, n)
+		}
+	}
+
+	for _, c := range diagram.Connections {
+		e := &edge{
+			conn:     c,
+			src:      c.Src,
+			dst:      c.Dst,
+			srcArrow: c.SrcArrow,
+			dstArrow: c.DstArrow,
+			route:    c.Route,
+			directed: c.SrcArrow != d2target.NoArrowhead || c.DstArrow != d2target.NoArrowhead,
+		}
+		if c.SrcArrow != d2target.NoArrowhead && c.DstArrow == d2target.NoArrowhead {
+			e.src, e.dst = e.dst, e.src
+			e.srcArrow, e.dstArrow = e.dstArrow, e.srcArrow
+			e.route = make([]*geo.Point, len(c.Route))
+			for i, p := range c.Route {
+				e.route[len(c.Route)-1-i] = p
+			}
+		}
+		g.edges = append(g.edges, e)
+	}
+	return g, nil
+}
+
+// color resolves a color to hex, returning "" when it's unset or can't be represented as a
+// single color (e.g. gradients)
+func (g *graph) color(code string) string {
+	rgb, ok := g.rgb(code)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("#%02X%02X%02X", rgb.Red, rgb.Green, rgb.Blue)
+}
+
+func (g *graph) rgb(code string) (color.RGB, bool) {
+	if color.IsThemeColor(code) {
+		code = d2themes.ResolveThemeColor(g.theme, code)
+	}
+	if strings.HasPrefix(code, "#") {
+		hex := code[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return color.RGB{}, false
+		}
+		rgb, err := color.Hex2RGB("#" + hex)
+		return rgb, err == nil
+	}
+	name := strings.ToLower(code)
+	if name != "transparent" && name != "currentcolor" && go2.Contains(color.NamedColors, name) {
+		return color.Name2RGB(name), true
+	}
+	return color.RGB{}, false
+}
+
+func center(s d2target.Shape) *geo.Point {
+	return geo.NewPoint(
+		float64(s.Pos.X)+float64(s.Width)/2,
+		float64(s.Pos.Y)+float64(s.Height)/2,
+	)
+}
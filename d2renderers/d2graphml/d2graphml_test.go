@@ -0,0 +1,138 @@
+package d2graphml_test
+
+import (
+	"encoding/xml"
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2renderers/d2graphml"
+	"oss.terrastruct.com/d2/d2renderers/internal/d2rendertest"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+const script = `a: {
+  b: Bee {shape: circle}
+  c
+  b -> c: hi
+}
+d.style.fill: "#f96"
+a.c <- d
+d -- a.b
+`
+
+func TestConvertGraphML(t *testing.T) {
+	t.Parallel()
+
+	diagram := d2rendertest.Compile(t, script)
+	doc, err := d2graphml.ConvertGraphML(diagram, nil)
+	assert.Success(t, err)
+
+	nodes := doc.Graph.Nodes
+	if !tassert.Len(t, nodes, 2) {
+		return
+	}
+	a, d := nodes[0], nodes[1]
+	assert.String(t, "a", a.ID)
+	assert.String(t, "group", a.FolderType)
+	if !tassert.NotNil(t, a.Graph) || !tassert.Len(t, a.Graph.Nodes, 2) {
+		return
+	}
+	b := a.Graph.Nodes[0]
+	assert.String(t, "a.b", b.ID)
+	assert.String(t, "Bee", data(b.Data, "label").Value)
+	assert.String(t, "ellipse", data(b.Data, "nodegraphics").ShapeNode.Shape.Type)
+
+	assert.String(t, "#FF9966", data(d.Data, "color").Value)
+	bounds := data(d.Data, "nodegraphics").ShapeNode.Geometry
+	dShape := shape(diagram, "d")
+	tassert.Equal(t, float64(dShape.Pos.X), bounds.X)
+	tassert.Equal(t, float64(dShape.Pos.Y), bounds.Y)
+	tassert.Equal(t, float64(dShape.Width), bounds.Width)
+
+	edges := doc.Graph.Edges
+	if !tassert.Len(t, edges, 3) {
+		return
+	}
+	assert.String(t, "a.b", edges[0].Source)
+	assert.String(t, "a.c", edges[0].Target)
+	tassert.Nil(t, edges[0].Directed)
+	// Connections with only a source arrowhead point the other way
+	assert.String(t, "d", edges[1].Source)
+	assert.String(t, "a.c", edges[1].Target)
+	assert.String(t, "none", data(edges[1].Data, "edgegraphics").PolyLineEdge.Arrows.Source)
+	assert.String(t, "delta", data(edges[1].Data, "edgegraphics").PolyLineEdge.Arrows.Target)
+	if tassert.NotNil(t, edges[2].Directed) {
+		tassert.False(t, *edges[2].Directed)
+	}
+
+	out, err := d2graphml.RenderGraphML(diagram, nil)
+	assert.Success(t, err)
+	var parsed struct {
+		XMLName xml.Name
+	}
+	assert.Success(t, xml.Unmarshal(out, &parsed))
+	assert.String(t, "graphml", parsed.XMLName.Local)
+}
+
+func TestConvertGEXF(t *testing.T) {
+	t.Parallel()
+
+	diagram := d2rendertest.Compile(t, script)
+	doc, err := d2graphml.ConvertGEXF(diagram, nil)
+	assert.Success(t, err)
+
+	pids := make(map[string]string)
+	for _, n := range doc.Graph.Nodes {
+		pids[n.ID] = n.PID
+	}
+	tassert.Equal(t, map[string]string{"a": "", "a.b": "a", "a.c": "a", "d": ""}, pids)
+
+	for _, n := range doc.Graph.Nodes {
+		if n.ID != "d" {
+			continue
+		}
+		dShape := shape(diagram, "d")
+		tassert.Equal(t, float64(dShape.Pos.X)+float64(dShape.Width)/2, n.Position.X)
+		if tassert.NotNil(t, n.Color) {
+			tassert.Equal(t, d2graphml.GEXFColor{R: 0xff, G: 0x99, B: 0x66}, *n.Color)
+		}
+	}
+
+	edges := doc.Graph.Edges
+	if !tassert.Len(t, edges, 3) {
+		return
+	}
+	assert.String(t, "hi", edges[0].Label)
+	assert.String(t, "", edges[0].Type)
+	assert.String(t, "d", edges[1].Source)
+	assert.String(t, "undirected", edges[2].Type)
+
+	out, err := d2graphml.RenderGEXF(diagram, nil)
+	assert.Success(t, err)
+	var parsed struct {
+		XMLName xml.Name
+	}
+	assert.Success(t, xml.Unmarshal(out, &parsed))
+	assert.String(t, "gexf", parsed.XMLName.Local)
+}
+
+func data(ds []*d2graphml.Data, key string) *d2graphml.Data {
+	for _, d := range ds {
+		if d.Key == key {
+			return d
+		}
+	}
+	return nil
+}
+
+func shape(diagram *d2target.Diagram, id string) d2target.Shape {
+	for _, s := range diagram.Shapes {
+		if s.ID == id {
+			return s
+		}
+	}
+	return d2target.Shape{}
+}
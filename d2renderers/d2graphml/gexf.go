@@ -0,0 +1,219 @@
+package d2graphml
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// GEXF is Gephi's graph format, https://gexf.net
+type GEXF struct {
+	XMLName  xml.Name  `xml:"gexf"`
+	Xmlns    string    `xml:"xmlns,attr"`
+	XmlnsViz string    `xml:"xmlns:viz,attr"`
+	Version  string    `xml:"version,attr"`
+	Meta     GEXFMeta  `xml:"meta"`
+	Graph    GEXFGraph `xml:"graph"`
+}
+
+type GEXFMeta struct {
+	Creator string `xml:"creator"`
+}
+
+type GEXFGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Mode            string           `xml:"mode,attr"`
+	Attributes      []GEXFAttributes `xml:"attributes"`
+	Nodes           []*GEXFNode      `xml:"nodes>node"`
+	Edges           []*GEXFEdge      `xml:"edges>edge"`
+}
+
+type GEXFAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []GEXFAttribute `xml:"attribute"`
+}
+
+type GEXFAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type GEXFNode struct {
+	ID    string `xml:"id,attr"`
+	Label string `xml:"label,attr"`
+	// PID is the ID of the container the node is in
+	PID       string         `xml:"pid,attr,omitempty"`
+	AttValues []GEXFAttValue `xml:"attvalues>attvalue"`
+	Color     *GEXFColor     `xml:"viz:color"`
+	Position  GEXFPosition   `xml:"viz:position"`
+	Size      GEXFSize       `xml:"viz:size"`
+	Shape     *GEXFNodeShape `xml:"viz:shape"`
+}
+
+type GEXFEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Type      string         `xml:"type,attr,omitempty"`
+	Label     string         `xml:"label,attr,omitempty"`
+	AttValues []GEXFAttValue `xml:"attvalues>attvalue"`
+	Color     *GEXFColor     `xml:"viz:color"`
+	Thickness *GEXFSize      `xml:"viz:thickness"`
+	Shape     *GEXFEdgeShape `xml:"viz:shape"`
+}
+
+type GEXFAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type GEXFColor struct {
+	R uint8 `xml:"r,attr"`
+	G uint8 `xml:"g,attr"`
+	B uint8 `xml:"b,attr"`
+}
+
+type GEXFPosition struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+	Z float64 `xml:"z,attr"`
+}
+
+type GEXFSize struct {
+	Value float64 `xml:"value,attr"`
+}
+
+type GEXFNodeShape struct {
+	Value string `xml:"value,attr"`
+}
+
+type GEXFEdgeShape struct {
+	Value string `xml:"value,attr"`
+}
+
+// Attributes of GEXF nodes and edges, besides their labels and visualization
+const (
+	attrShape  = "shape"
+	attrWidth  = "width"
+	attrHeight = "height"
+	attrRoute  = "route"
+)
+
+// RenderGEXF renders the diagram as GEXF
+func RenderGEXF(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
+	doc, err := ConvertGEXF(diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(doc)
+}
+
+// ConvertGEXF converts the diagram into a GEXF document
+func ConvertGEXF(diagram *d2target.Diagram, opts *RenderOpts) (*GEXF, error) {
+	g, err := newGraph(diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &GEXF{
+		Xmlns:    "http://gexf.net/1.3",
+		XmlnsViz: "http://gexf.net/1.3/viz",
+		Version:  "1.3",
+		Meta: GEXFMeta{
+			Creator: CREATOR,
+		},
+		Graph: GEXFGraph{
+			DefaultEdgeType: "directed",
+			Mode:            "static",
+			Attributes: []GEXFAttributes{
+				{
+					Class: "node",
+					Attributes: []GEXFAttribute{
+						{ID: attrShape, Title: "shape", Type: "string"},
+						{ID: attrWidth, Title: "width", Type: "double"},
+						{ID: attrHeight, Title: "height", Type: "double"},
+					},
+				},
+				{
+					Class: "edge",
+					Attributes: []GEXFAttribute{
+						// Points of the route, as x,y pairs separated by spaces
+						{ID: attrRoute, Title: "route", Type: "string"},
+					},
+				},
+			},
+		},
+	}
+	g.gexfNodes(doc, g.roots, "")
+
+	for _, e := range g.edges {
+		el := &GEXFEdge{
+			ID:     e.conn.ID,
+			Source: e.src,
+			Target: e.dst,
+			Label:  e.conn.Label,
+			Thickness: &GEXFSize{
+				Value: float64(e.conn.StrokeWidth),
+			},
+		}
+		if !e.directed {
+			el.Type = "undirected"
+		}
+		if rgb, ok := g.rgb(e.conn.Stroke); ok {
+			el.Color = &GEXFColor{R: rgb.Red, G: rgb.Green, B: rgb.Blue}
+		}
+		if e.conn.StrokeDash > 0 {
+			el.Shape = &GEXFEdgeShape{Value: "dashed"}
+		}
+		if len(e.route) > 0 {
+			var route []byte
+			for i, p := range e.route {
+				if i > 0 {
+					route = append(route, ' ')
+				}
+				route = strconv.AppendFloat(route, p.X, 'f', -1, 64)
+				route = append(route, ',')
+				route = strconv.AppendFloat(route, p.Y, 'f', -1, 64)
+			}
+			el.AttValues = append(el.AttValues, GEXFAttValue{For: attrRoute, Value: string(route)})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, el)
+	}
+	return doc, nil
+}
+
+func (g *graph) gexfNodes(doc *GEXF, nodes []*node, pid string) {
+	for _, n := range nodes {
+		s := n.shape
+		c := center(s)
+		el := &GEXFNode{
+			ID:    s.ID,
+			Label: s.Label,
+			PID:   pid,
+			AttValues: []GEXFAttValue{
+				{For: attrShape, Value: s.Type},
+				{For: attrWidth, Value: strconv.Itoa(s.Width)},
+				{For: attrHeight, Value: strconv.Itoa(s.Height)},
+			},
+			Position: GEXFPosition{X: c.X, Y: c.Y},
+			// GEXF sizes are radii, so the node spans the longer side of the shape
+			Size: GEXFSize{Value: math.Max(float64(s.Width), float64(s.Height)) / 2},
+		}
+		if rgb, ok := g.rgb(s.Fill); ok {
+			el.Color = &GEXFColor{R: rgb.Red, G: rgb.Green, B: rgb.Blue}
+		}
+		switch s.Type {
+		case d2target.ShapeCircle, d2target.ShapeOval:
+			el.Shape = &GEXFNodeShape{Value: "disc"}
+		case d2target.ShapeDiamond:
+			el.Shape = &GEXFNodeShape{Value: "diamond"}
+		default:
+			el.Shape = &GEXFNodeShape{Value: "square"}
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, el)
+		g.gexfNodes(doc, n.children, s.ID)
+	}
+}
@@ -0,0 +1,383 @@
+package d2graphml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/geo"
+)
+
+// Keys of the GraphML data. Besides the generic attributes read by most tools, nodes and
+// edges carry yEd's graphics so that yEd shows them as laid out.
+const (
+	keyLabel        = "label"
+	keyShape        = "shape"
+	keyX            = "x"
+	keyY            = "y"
+	keyWidth        = "width"
+	keyHeight       = "height"
+	keyColor        = "color"
+	keyNodeGraphics = "nodegraphics"
+	keyEdgeGraphics = "edgegraphics"
+)
+
+type GraphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	XmlnsY  string       `xml:"xmlns:y,attr"`
+	Keys    []GraphMLKey `xml:"key"`
+	Graph   *Graph       `xml:"graph"`
+}
+
+type GraphMLKey struct {
+	ID         string `xml:"id,attr"`
+	For        string `xml:"for,attr"`
+	AttrName   string `xml:"attr.name,attr,omitempty"`
+	AttrType   string `xml:"attr.type,attr,omitempty"`
+	YFilesType string `xml:"yfiles.type,attr,omitempty"`
+}
+
+type Graph struct {
+	ID          string  `xml:"id,attr"`
+	EdgeDefault string  `xml:"edgedefault,attr"`
+	Nodes       []*Node `xml:"node"`
+	Edges       []*Edge `xml:"edge"`
+}
+
+type Node struct {
+	ID string `xml:"id,attr"`
+	// FolderType marks containers as groups for yEd
+	FolderType string  `xml:"yfiles.foldertype,attr,omitempty"`
+	Data       []*Data `xml:"data"`
+	Graph      *Graph  `xml:"graph"`
+}
+
+type Edge struct {
+	ID       string  `xml:"id,attr"`
+	Source   string  `xml:"source,attr"`
+	Target   string  `xml:"target,attr"`
+	Directed *bool   `xml:"directed,attr"`
+	Data     []*Data `xml:"data"`
+}
+
+type Data struct {
+	Key                 string                `xml:"key,attr"`
+	Value               string                `xml:",chardata"`
+	ShapeNode           *YNode                `xml:"y:ShapeNode"`
+	ProxyAutoBoundsNode *YProxyAutoBoundsNode `xml:"y:ProxyAutoBoundsNode"`
+	PolyLineEdge        *YPolyLineEdge        `xml:"y:PolyLineEdge"`
+}
+
+// YNode is yEd's graphics of a node, used for both shape and group nodes
+type YNode struct {
+	Geometry    YGeometry    `xml:"y:Geometry"`
+	Fill        *YFill       `xml:"y:Fill"`
+	BorderStyle *YLineStyle  `xml:"y:BorderStyle"`
+	NodeLabel   *YNodeLabel  `xml:"y:NodeLabel"`
+	Shape       *YShape      `xml:"y:Shape"`
+	State       *YGroupState `xml:"y:State"`
+}
+
+type YProxyAutoBoundsNode struct {
+	Realizers YRealizers `xml:"y:Realizers"`
+}
+
+type YRealizers struct {
+	Active    int    `xml:"active,attr"`
+	GroupNode *YNode `xml:"y:GroupNode"`
+}
+
+type YGeometry struct {
+	X      float64 `xml:"x,attr"`
+	Y      float64 `xml:"y,attr"`
+	Width  float64 `xml:"width,attr"`
+	Height float64 `xml:"height,attr"`
+}
+
+type YFill struct {
+	Color       string `xml:"color,attr,omitempty"`
+	Transparent bool   `xml:"transparent,attr"`
+}
+
+type YLineStyle struct {
+	Color string  `xml:"color,attr,omitempty"`
+	Type  string  `xml:"type,attr"`
+	Width float64 `xml:"width,attr"`
+}
+
+type YNodeLabel struct {
+	ModelName     string `xml:"modelName,attr,omitempty"`
+	ModelPosition string `xml:"modelPosition,attr,omitempty"`
+	Text          string `xml:",chardata"`
+}
+
+type YShape struct {
+	Type string `xml:"type,attr"`
+}
+
+type YGroupState struct {
+	Closed bool `xml:"closed,attr"`
+}
+
+type YPolyLineEdge struct {
+	Path      YPath       `xml:"y:Path"`
+	LineStyle YLineStyle  `xml:"y:LineStyle"`
+	Arrows    YArrows     `xml:"y:Arrows"`
+	EdgeLabel *YEdgeLabel `xml:"y:EdgeLabel"`
+}
+
+// YPath has the offsets of the route's ends from the centers of the nodes they connect,
+// and the points in between
+type YPath struct {
+	SX     float64  `xml:"sx,attr"`
+	SY     float64  `xml:"sy,attr"`
+	TX     float64  `xml:"tx,attr"`
+	TY     float64  `xml:"ty,attr"`
+	Points []YPoint `xml:"y:Point"`
+}
+
+type YPoint struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+type YArrows struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type YEdgeLabel struct {
+	Text string `xml:",chardata"`
+}
+
+// RenderGraphML renders the diagram as GraphML
+func RenderGraphML(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
+	doc, err := ConvertGraphML(diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(doc)
+}
+
+// ConvertGraphML converts the diagram into a GraphML document
+func ConvertGraphML(diagram *d2target.Diagram, opts *RenderOpts) (*GraphML, error) {
+	g, err := newGraph(diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &GraphML{
+		Xmlns:  "http://graphml.graphdrawing.org/xmlns",
+		XmlnsY: "http://www.yworks.com/xml/graphml",
+		Keys: []GraphMLKey{
+			{ID: keyLabel, For: "node", AttrName: "label", AttrType: "string"},
+			{ID: keyShape, For: "node", AttrName: "shape", AttrType: "string"},
+			{ID: keyX, For: "node", AttrName: "x", AttrType: "double"},
+			{ID: keyY, For: "node", AttrName: "y", AttrType: "double"},
+			{ID: keyWidth, For: "node", AttrName: "width", AttrType: "double"},
+			{ID: keyHeight, For: "node", AttrName: "height", AttrType: "double"},
+			{ID: keyColor, For: "node", AttrName: "color", AttrType: "string"},
+			{ID: keyNodeGraphics, For: "node", YFilesType: "nodegraphics"},
+			{ID: "edge" + keyLabel, For: "edge", AttrName: "label", AttrType: "string"},
+			{ID: keyEdgeGraphics, For: "edge", YFilesType: "edgegraphics"},
+		},
+		Graph: &Graph{
+			ID:          "G",
+			EdgeDefault: "directed",
+		},
+	}
+	centers := make(map[string]*geo.Point)
+	doc.Graph.Nodes = g.graphMLNodes(g.roots, centers)
+
+	for _, e := range g.edges {
+		el := &Edge{
+			ID:     e.conn.ID,
+			Source: e.src,
+			Target: e.dst,
+		}
+		if !e.directed {
+			el.Directed = new(bool)
+		}
+		if e.conn.Label != "" {
+			el.Data = append(el.Data, &Data{Key: "edge" + keyLabel, Value: e.conn.Label})
+		}
+
+		pe := &YPolyLineEdge{
+			LineStyle: YLineStyle{
+				Color: g.color(e.conn.Stroke),
+				Type:  lineType(e.conn.StrokeDash),
+				Width: float64(e.conn.StrokeWidth),
+			},
+			Arrows: YArrows{
+				Source: arrow(e.srcArrow),
+				Target: arrow(e.dstArrow),
+			},
+		}
+		if len(e.route) >= 2 {
+			start, end := e.route[0], e.route[len(e.route)-1]
+			if c, ok := centers[e.src]; ok {
+				pe.Path.SX, pe.Path.SY = start.X-c.X, start.Y-c.Y
+			}
+			if c, ok := centers[e.dst]; ok {
+				pe.Path.TX, pe.Path.TY = end.X-c.X, end.Y-c.Y
+			}
+			for _, p := range e.route[1 : len(e.route)-1] {
+				pe.Path.Points = append(pe.Path.Points, YPoint{X: p.X, Y: p.Y})
+			}
+		}
+		if e.conn.Label != "" {
+			pe.EdgeLabel = &YEdgeLabel{Text: e.conn.Label}
+		}
+		el.Data = append(el.Data, &Data{Key: keyEdgeGraphics, PolyLineEdge: pe})
+		doc.Graph.Edges = append(doc.Graph.Edges, el)
+	}
+	return doc, nil
+}
+
+func (g *graph) graphMLNodes(nodes []*node, centers map[string]*geo.Point) []*Node {
+	var out []*Node
+	for _, n := range nodes {
+		s := n.shape
+		c := center(s)
+		centers[s.ID] = c
+
+		fill := g.color(s.Fill)
+		el := &Node{
+			ID: s.ID,
+			Data: []*Data{
+				{Key: keyLabel, Value: s.Label},
+				{Key: keyShape, Value: s.Type},
+				{Key: keyX, Value: formatFloat(c.X)},
+				{Key: keyY, Value: formatFloat(c.Y)},
+				{Key: keyWidth, Value: strconv.Itoa(s.Width)},
+				{Key: keyHeight, Value: strconv.Itoa(s.Height)},
+			},
+		}
+		if fill != "" {
+			el.Data = append(el.Data, &Data{Key: keyColor, Value: fill})
+		}
+
+		yn := &YNode{
+			Geometry: YGeometry{
+				X:      float64(s.Pos.X),
+				Y:      float64(s.Pos.Y),
+				Width:  float64(s.Width),
+				Height: float64(s.Height),
+			},
+			Fill: &YFill{
+				Color:       fill,
+				Transparent: fill == "",
+			},
+			BorderStyle: &YLineStyle{
+				Color: g.color(s.Stroke),
+				Type:  lineType(s.StrokeDash),
+				Width: float64(s.StrokeWidth),
+			},
+			Shape: &YShape{Type: yShape(s)},
+		}
+		if s.Label != "" {
+			yn.NodeLabel = &YNodeLabel{Text: s.Label}
+		}
+
+		if len(n.children) == 0 {
+			el.Data = append(el.Data, &Data{Key: keyNodeGraphics, ShapeNode: yn})
+		} else {
+			if yn.NodeLabel != nil {
+				yn.NodeLabel.ModelName = "internal"
+				yn.NodeLabel.ModelPosition = "t"
+			}
+			yn.State = &YGroupState{}
+			el.FolderType = "group"
+			el.Data = append(el.Data, &Data{
+				Key: keyNodeGraphics,
+				ProxyAutoBoundsNode: &YProxyAutoBoundsNode{
+					Realizers: YRealizers{GroupNode: yn},
+				},
+			})
+			el.Graph = &Graph{
+				ID:          s.ID + ":",
+				EdgeDefault: "directed",
+				Nodes:       g.graphMLNodes(n.children, centers),
+			}
+		}
+		out = append(out, el)
+	}
+	return out
+}
+
+// yShape is the closest of yEd's node shapes
+func yShape(s d2target.Shape) string {
+	switch s.Type {
+	case d2target.ShapeCircle, d2target.ShapeOval:
+		return "ellipse"
+	case d2target.ShapeDiamond:
+		return "diamond"
+	case d2target.ShapeHexagon:
+		return "hexagon"
+	case d2target.ShapeParallelogram:
+		return "parallelogram"
+	}
+	if s.BorderRadius > 0 {
+		return "roundrectangle"
+	}
+	return "rectangle"
+}
+
+func lineType(dash float64) string {
+	if dash > 0 {
+		return "dashed"
+	}
+	return "line"
+}
+
+// arrow is the closest of yEd's arrow types
+func arrow(a d2target.Arrowhead) string {
+	switch a {
+	case d2target.NoArrowhead:
+		return "none"
+	case d2target.DiamondArrowhead:
+		return "white_diamond"
+	case d2target.FilledDiamondArrowhead:
+		return "diamond"
+	case d2target.CircleArrowhead:
+		return "transparent_circle"
+	case d2target.FilledCircleArrowhead:
+		return "circle"
+	case d2target.UnfilledTriangleArrowhead:
+		return "white_delta"
+	case d2target.TriangleArrowhead, d2target.DoubleTriangleArrowhead:
+		return "delta"
+	case d2target.TeeArrowhead:
+		return "t_shape"
+	case d2target.LineArrowhead:
+		return "plain"
+	case d2target.CfOne:
+		return "crows_foot_one"
+	case d2target.CfMany:
+		return "crows_foot_many"
+	case d2target.CfOneRequired:
+		return "crows_foot_one_mandatory"
+	case d2target.CfManyRequired:
+		return "crows_foot_many_mandatory"
+	}
+	return "standard"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func marshal(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	err := enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,275 @@
+// d2json exports laid out diagrams as JSON, for tools such as custom renderers and diff
+// tools that need D2's layout without depending on its internal serialization.
+//
+// The schema is the types of this package. Its version, d2graph.JSON_SCHEMA_VERSION, is
+// written with every export and is bumped whenever a field is removed or changes meaning.
+// Positions are absolute, with y growing downwards, and theme colors are resolved to hex.
+package d2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/d2themes"
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/color"
+)
+
+type RenderOpts struct {
+	ThemeID        *int64
+	ThemeOverrides *d2target.ThemeOverrides
+}
+
+type Document struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Board         *Board `json:"board"`
+}
+
+type Board struct {
+	Name string `json:"name"`
+	// Path of the board from the root board, e.g. ["layers", "x"]. Empty for the root board.
+	Path        []string     `json:"path"`
+	Label       string       `json:"label,omitempty"`
+	Objects     []Object     `json:"objects"`
+	Connections []Connection `json:"connections"`
+	Layers      []*Board     `json:"layers"`
+	Scenarios   []*Board     `json:"scenarios"`
+	Steps       []*Board     `json:"steps"`
+}
+
+type Object struct {
+	// ID is the absolute ID of the object, e.g. "a.b"
+	ID string `json:"id"`
+	// Parent is the ID of the object's container, empty at the top level
+	Parent  string   `json:"parent,omitempty"`
+	Label   string   `json:"label"`
+	Shape   string   `json:"shape"`
+	Bounds  Box      `json:"bounds"`
+	Style   Style    `json:"style"`
+	Link    string   `json:"link,omitempty"`
+	Icon    string   `json:"icon,omitempty"`
+	Classes []string `json:"classes,omitempty"`
+	Tooltip string   `json:"tooltip,omitempty"`
+	// Objects and connections with higher z-indexes are drawn on top
+	ZIndex int `json:"zIndex"`
+}
+
+type Connection struct {
+	// ID is the absolute ID of the connection, e.g. "(a -> b)[0]"
+	ID           string  `json:"id"`
+	Src          string  `json:"src"`
+	Dst          string  `json:"dst"`
+	SrcArrowhead string  `json:"srcArrowhead"`
+	DstArrowhead string  `json:"dstArrowhead"`
+	Label        string  `json:"label"`
+	Route        []Point `json:"route"`
+	// IsCurve is true when the route is the control points of a spline
+	IsCurve bool     `json:"isCurve"`
+	Style   Style    `json:"style"`
+	Classes []string `json:"classes,omitempty"`
+	Tooltip string   `json:"tooltip,omitempty"`
+	ZIndex  int      `json:"zIndex"`
+}
+
+type Box struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type Style struct {
+	Fill         string  `json:"fill,omitempty"`
+	Stroke       string  `json:"stroke,omitempty"`
+	StrokeWidth  int     `json:"strokeWidth"`
+	StrokeDash   float64 `json:"strokeDash"`
+	Opacity      float64 `json:"opacity"`
+	BorderRadius float64 `json:"borderRadius,omitempty"`
+	FontSize     int     `json:"fontSize"`
+	FontColor    string  `json:"fontColor,omitempty"`
+	Bold         bool    `json:"bold,omitempty"`
+	Italic       bool    `json:"italic,omitempty"`
+	Underline    bool    `json:"underline,omitempty"`
+	Shadow       bool    `json:"shadow,omitempty"`
+	ThreeDee     bool    `json:"3d,omitempty"`
+	Multiple     bool    `json:"multiple,omitempty"`
+	DoubleBorder bool    `json:"doubleBorder,omitempty"`
+	Animated     bool    `json:"animated,omitempty"`
+}
+
+// Render renders the diagram and its boards as JSON
+func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
+	doc, err := Convert(diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Convert converts the diagram and its boards into a JSON document
+func Convert(diagram *d2target.Diagram, opts *RenderOpts) (*Document, error) {
+	if opts == nil {
+		opts = &RenderOpts{}
+	}
+	themeID := d2themescatalog.NeutralDefault.ID
+	if opts.ThemeID != nil {
+		themeID = *opts.ThemeID
+	}
+	theme := d2themescatalog.Find(themeID)
+	if theme.ID != themeID {
+		return nil, fmt.Errorf("theme %d not found", themeID)
+	}
+	theme.ApplyOverrides(opts.ThemeOverrides)
+
+	board, err := convertBoard(theme, diagram, []string{})
+	if err != nil {
+		return nil, err
+	}
+	return &Document{
+		SchemaVersion: d2graph.JSON_SCHEMA_VERSION,
+		Board:         board,
+	}, nil
+}
+
+func convertBoard(theme d2themes.Theme, diagram *d2target.Diagram, path []string) (*Board, error) {
+	b := &Board{
+		Name:        diagram.Name,
+		Path:        path,
+		Label:       diagram.Root.Label,
+		Objects:     []Object{},
+		Connections: []Connection{},
+		Layers:      []*Board{},
+		Scenarios:   []*Board{},
+		Steps:       []*Board{},
+	}
+
+	// Shapes aren't ordered by nesting, so parents are looked up once all are known
+	paths := make([][]string, len(diagram.Shapes))
+	byPath := make(map[string]string, len(diagram.Shapes))
+	for i, s := range diagram.Shapes {
+		k, err := d2parser.ParseKey(s.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ID %q: %w", s.ID, err)
+		}
+		paths[i] = k.IDA()
+		byPath[strings.Join(paths[i], "\x00")] = s.ID
+	}
+	for i, s := range diagram.Shapes {
+		obj := Object{
+			ID:     s.ID,
+			Parent: byPath[strings.Join(paths[i][:len(paths[i])-1], "\x00")],
+			Label:  s.Label,
+			Shape:  s.Type,
+			Bounds: Box{
+				X:      float64(s.Pos.X),
+				Y:      float64(s.Pos.Y),
+				Width:  float64(s.Width),
+				Height: float64(s.Height),
+			},
+			Style: Style{
+				Fill:         resolveColor(theme, s.Fill),
+				Stroke:       resolveColor(theme, s.Stroke),
+				StrokeWidth:  s.StrokeWidth,
+				StrokeDash:   s.StrokeDash,
+				Opacity:      s.Opacity,
+				BorderRadius: float64(s.BorderRadius),
+				FontSize:     s.FontSize,
+				FontColor:    resolveColor(theme, s.Color),
+				Bold:         s.Bold,
+				Italic:       s.Italic,
+				Underline:    s.Underline,
+				Shadow:       s.Shadow,
+				ThreeDee:     s.ThreeDee,
+				Multiple:     s.Multiple,
+				DoubleBorder: s.DoubleBorder,
+			},
+			Link:    s.Link,
+			Classes: s.Classes,
+			Tooltip: s.Tooltip,
+			ZIndex:  s.ZIndex,
+		}
+		if s.Icon != nil {
+			obj.Icon = s.Icon.String()
+		}
+		b.Objects = append(b.Objects, obj)
+	}
+
+	for _, c := range diagram.Connections {
+		conn := Connection{
+			ID:           c.ID,
+			Src:          c.Src,
+			Dst:          c.Dst,
+			SrcArrowhead: string(c.SrcArrow),
+			DstArrowhead: string(c.DstArrow),
+			Label:        c.Label,
+			Route:        []Point{},
+			IsCurve:      c.IsCurve,
+			Style: Style{
+				Fill:         resolveColor(theme, c.Fill),
+				Stroke:       resolveColor(theme, c.Stroke),
+				StrokeWidth:  c.StrokeWidth,
+				StrokeDash:   c.StrokeDash,
+				Opacity:      c.Opacity,
+				BorderRadius: c.BorderRadius,
+				FontSize:     c.FontSize,
+				FontColor:    resolveColor(theme, c.Color),
+				Bold:         c.Bold,
+				Italic:       c.Italic,
+				Underline:    c.Underline,
+				Animated:     c.Animated,
+			},
+			Classes: c.Classes,
+			Tooltip: c.Tooltip,
+			ZIndex:  c.ZIndex,
+		}
+		for _, p := range c.Route {
+			conn.Route = append(conn.Route, Point{X: p.X, Y: p.Y})
+		}
+		b.Connections = append(b.Connections, conn)
+	}
+
+	for _, boards := range []struct {
+		keyword string
+		from    []*d2target.Diagram
+		to      *[]*Board
+	}{
+		{"layers", diagram.Layers, &b.Layers},
+		{"scenarios", diagram.Scenarios, &b.Scenarios},
+		{"steps", diagram.Steps, &b.Steps},
+	} {
+		for _, d := range boards.from {
+			childPath := append(append([]string{}, path...), boards.keyword, d.Name)
+			child, err := convertBoard(theme, d, childPath)
+			if err != nil {
+				return nil, err
+			}
+			*boards.to = append(*boards.to, child)
+		}
+	}
+	return b, nil
+}
+
+func resolveColor(theme d2themes.Theme, code string) string {
+	if color.IsThemeColor(code) {
+		return d2themes.ResolveThemeColor(theme, code)
+	}
+	return code
+}
@@ -0,0 +1,57 @@
+package d2json_test
+
+import (
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2renderers/d2json"
+	"oss.terrastruct.com/d2/d2renderers/internal/d2rendertest"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	diagram := d2rendertest.Compile(t, `a: {
+  "b.c" -> d: hi
+}
+a.d.style.fill: "#f96"
+scenarios: {
+  later: {
+    a.d -> e
+  }
+}
+`)
+	doc, err := d2json.Convert(diagram, nil)
+	assert.Success(t, err)
+	tassert.Equal(t, d2graph.JSON_SCHEMA_VERSION, doc.SchemaVersion)
+
+	parents := make(map[string]string)
+	for _, obj := range doc.Board.Objects {
+		parents[obj.ID] = obj.Parent
+		if obj.ID == "a.d" {
+			assert.String(t, "#f96", obj.Style.Fill)
+		}
+	}
+	tassert.Equal(t, map[string]string{"a": "", `a."b.c"`: "a", "a.d": "a"}, parents)
+
+	if !tassert.Len(t, doc.Board.Connections, 1) {
+		return
+	}
+	conn := doc.Board.Connections[0]
+	assert.String(t, `a."b.c"`, conn.Src)
+	assert.String(t, "hi", conn.Label)
+	assert.String(t, string(d2target.TriangleArrowhead), conn.DstArrowhead)
+	tassert.Equal(t, len(diagram.Connections[0].Route), len(conn.Route))
+
+	if !tassert.Len(t, doc.Board.Scenarios, 1) {
+		return
+	}
+	later := doc.Board.Scenarios[0]
+	tassert.Equal(t, []string{"scenarios", "later"}, later.Path)
+	tassert.Len(t, later.Connections, 2)
+}
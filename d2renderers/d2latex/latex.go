@@ -1,11 +1,17 @@
 package d2latex
 
 import (
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
 	"fmt"
 	"math"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/dop251/goja"
 
@@ -27,8 +33,50 @@ var mathjaxJS string
 // <svg style="background: white;" xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="563" height="326" viewBox="-100 -100 563 326"><style type="text/css">
 var svgRe = regexp.MustCompile(`<svg[^>]+width="([0-9\.]+)ex" height="([0-9\.]+)ex"[^>]+>`)
 
-func Render(s string) (_ string, err error) {
+// CacheDir, if set, is the directory rendered expressions are kept in, so builds after the
+// first don't typeset them again. Rendered expressions are always kept in memory.
+var CacheDir string
+
+var cache sync.Map
+
+// Render typesets s as an SVG, scale times its normal size, or its normal size if scale is 0.
+//
+// s is display math, like an equation on its own line, unless it's inline math written between
+// single dollar signs like $x^2$. Display math may also be written between double dollar signs.
+// Display math has larger operators with limits above and below them, like \sum.
+func Render(s string, scale float64) (_ string, err error) {
 	defer xdefer.Errorf(&err, "latex failed to parse")
+	expr, inline := parseMode(s)
+
+	key := cacheKey(expr, inline)
+	svg, ok := cachedRender(key)
+	if !ok {
+		svg, err = render(expr, inline)
+		if err != nil {
+			return "", err
+		}
+		cache.Store(key, svg)
+		if CacheDir != "" {
+			// Failing to cache only slows the next build
+			if err := os.MkdirAll(CacheDir, 0755); err == nil {
+				_ = os.WriteFile(filepath.Join(CacheDir, key+".svg"), []byte(svg), 0644)
+			}
+		}
+	}
+
+	if scale == 0 || scale == 1 {
+		return svg, nil
+	}
+	return svgRe.ReplaceAllStringFunc(svg, func(tag string) string {
+		dims := svgRe.FindStringSubmatch(tag)
+		w, _ := strconv.ParseFloat(dims[1], 64)
+		h, _ := strconv.ParseFloat(dims[2], 64)
+		tag = strings.Replace(tag, fmt.Sprintf(`width="%sex"`, dims[1]), fmt.Sprintf(`width="%sex"`, formatEx(w*scale)), 1)
+		return strings.Replace(tag, fmt.Sprintf(`height="%sex"`, dims[2]), fmt.Sprintf(`height="%sex"`, formatEx(h*scale)), 1)
+	}), nil
+}
+
+func render(expr string, inline bool) (string, error) {
 	vm := goja.New()
 
 	if _, err := vm.RunString(polyfillsJS); err != nil {
@@ -44,9 +92,10 @@ func Render(s string) (_ string, err error) {
 	}
 
 	val, err := vm.RunString(fmt.Sprintf(`adaptor.innerHTML(html.convert(`+"`"+"%s`"+`, {
+  display: %t,
   em: %d,
   ex: %d,
-}))`, s, pxPerEx*2, pxPerEx))
+}))`, expr, !inline, pxPerEx*2, pxPerEx))
 	if err != nil {
 		return "", err
 	}
@@ -54,9 +103,52 @@ func Render(s string) (_ string, err error) {
 	return val.String(), nil
 }
 
-func Measure(s string) (width, height int, err error) {
+// parseMode returns the expression of s, and whether it's inline math
+func parseMode(s string) (expr string, inline bool) {
+	trimmed := strings.TrimSpace(s)
+	switch {
+	case len(trimmed) >= 4 && strings.HasPrefix(trimmed, "$$") && strings.HasSuffix(trimmed, "$$"):
+		return trimmed[2 : len(trimmed)-2], false
+	case len(trimmed) >= 2 && strings.HasPrefix(trimmed, "$") && strings.HasSuffix(trimmed, "$"):
+		return trimmed[1 : len(trimmed)-1], true
+	}
+	return s, false
+}
+
+var mathjaxHash = sync.OnceValue(func() string {
+	h := sha256.Sum256([]byte(mathjaxJS + setupJS))
+	return hex.EncodeToString(h[:])
+})
+
+// cacheKey is the hash of an expression and how it's typeset, and of MathJax, so upgrading
+// MathJax doesn't use expressions rendered by the previous version
+func cacheKey(expr string, inline bool) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%t\x00%s", mathjaxHash(), inline, expr)))
+	return hex.EncodeToString(h[:])
+}
+
+func cachedRender(key string) (string, bool) {
+	if svg, ok := cache.Load(key); ok {
+		return svg.(string), true
+	}
+	if CacheDir == "" {
+		return "", false
+	}
+	b, err := os.ReadFile(filepath.Join(CacheDir, key+".svg"))
+	if err != nil {
+		return "", false
+	}
+	cache.Store(key, string(b))
+	return string(b), true
+}
+
+func formatEx(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1000)/1000, 'f', -1, 64)
+}
+
+func Measure(s string, scale float64) (width, height int, err error) {
 	defer xdefer.Errorf(&err, "latex failed to parse")
-	svg, err := Render(s)
+	svg, err := Render(s, scale)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -2,6 +2,8 @@ package d2latex
 
 import (
 	"encoding/xml"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -14,7 +16,7 @@ func TestRender(t *testing.T) {
 `,
 	}
 	for _, txt := range txts {
-		svg, err := Render(txt)
+		svg, err := Render(txt, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -26,8 +28,68 @@ func TestRender(t *testing.T) {
 }
 
 func TestRenderError(t *testing.T) {
-	_, err := Render(`\frac{1}{2}`)
+	_, err := Render(`\frac{1}{2}`, 0)
 	if err == nil {
 		t.Fatal("expected to error on invalid latex syntax")
 	}
 }
+
+func TestRenderModes(t *testing.T) {
+	display, _, err := Measure(`\\sum_{i=0}^n i`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dollars, _, err := Measure(`$$\\sum_{i=0}^n i$$`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inline, _, err := Measure(`$\\sum_{i=0}^n i$`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if display != dollars {
+		t.Fatalf("expected $$ to be display math, got widths %d and %d", display, dollars)
+	}
+	// Inline sums put their limits to the side, rather than above and below
+	if inline <= display {
+		t.Fatalf("expected inline math to be wider than display math, got widths %d and %d", inline, display)
+	}
+
+	width, height, err := Measure(`a + b = c`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scaledWidth, scaledHeight, err := Measure(`a + b = c`, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scaledWidth < 2*width-2 || scaledWidth > 2*width || scaledHeight < 2*height-2 || scaledHeight > 2*height {
+		t.Fatalf("expected latex-scale 2 to double %dx%d, got %dx%d", width, height, scaledWidth, scaledHeight)
+	}
+}
+
+func TestCacheDir(t *testing.T) {
+	CacheDir = t.TempDir()
+	defer func() {
+		CacheDir = ""
+	}()
+	svg, err := Render(`x^{cached}`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := cacheKey(`x^{cached}`, false)
+	b, err := os.ReadFile(filepath.Join(CacheDir, key+".svg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != svg {
+		t.Fatal("expected the cached render to be the render")
+	}
+
+	// Later builds read what earlier ones cached
+	cache.Delete(key)
+	cached, ok := cachedRender(key)
+	if !ok || cached != svg {
+		t.Fatal("expected the render to be read from the cache directory")
+	}
+}
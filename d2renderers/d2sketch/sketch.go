@@ -416,7 +416,8 @@ func Table(r *Runner, shape d2target.Shape) (string, error) {
 		float64(shape.Width),
 		float64(shape.Height),
 	)
-	rowHeight := box.Height / float64(1+len(shape.SQLTable.Columns))
+	rows := shape.SQLTable.DrawnRows()
+	rowHeight := box.Height / float64(1+len(rows))
 	headerBox := geo.NewBox(box.TopLeft, box.Width, rowHeight)
 
 	js = fmt.Sprintf(`node = rc.rectangle(0, 0, %d, %f, {
@@ -458,13 +459,16 @@ func Table(r *Runner, shape d2target.Shape) (string, error) {
 	}
 
 	var longestNameWidth int
-	for _, f := range shape.Columns {
+	for _, f := range rows {
+		if f.Shape != "" {
+			continue
+		}
 		longestNameWidth = go2.Max(longestNameWidth, f.Name.LabelWidth)
 	}
 
 	rowBox := geo.NewBox(box.TopLeft.Copy(), box.Width, rowHeight)
 	rowBox.TopLeft.Y += headerBox.Height
-	for _, f := range shape.Columns {
+	for _, f := range rows {
 		nameTL := label.InsideMiddleLeft.GetPointOnBox(
 			rowBox,
 			d2target.NamePadding,
@@ -481,23 +485,32 @@ func Table(r *Runner, shape d2target.Shape) (string, error) {
 		textEl := d2themes.NewThemableElement("text")
 		textEl.X = nameTL.X
 		textEl.Y = nameTL.Y + float64(shape.FontSize)*3/4
-		textEl.Fill = shape.PrimaryAccentColor
-		textEl.ClassName = "text"
 		textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "start", float64(shape.FontSize))
-		textEl.Content = svg.EscapeText(f.Name.Label)
-		output += textEl.Render()
-
-		textEl.X = nameTL.X + float64(longestNameWidth) + 2*d2target.NamePadding
-		textEl.Fill = shape.NeutralAccentColor
-		textEl.Content = svg.EscapeText(f.Type.Label)
-		output += textEl.Render()
-
-		textEl.X = constraintTR.X
-		textEl.Y = constraintTR.Y + float64(shape.FontSize)*3/4
-		textEl.Fill = shape.SecondaryAccentColor
-		textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx;letter-spacing:2px", "end", float64(shape.FontSize))
-		textEl.Content = f.ConstraintAbbr()
-		output += textEl.Render()
+		switch f.Shape {
+		case d2target.ShapeRowHeader:
+			textEl.Fill = shape.NeutralAccentColor
+			textEl.ClassName = "text-italic"
+			textEl.Content = svg.EscapeText(f.Name.Label)
+			output += textEl.Render()
+		case d2target.ShapeRowSeparator:
+		default:
+			textEl.Fill = shape.PrimaryAccentColor
+			textEl.ClassName = "text"
+			textEl.Content = svg.EscapeText(f.Name.Label)
+			output += textEl.Render()
+
+			textEl.X = nameTL.X + float64(longestNameWidth) + 2*d2target.NamePadding
+			textEl.Fill = shape.NeutralAccentColor
+			textEl.Content = svg.EscapeText(f.Type.Label)
+			output += textEl.Render()
+
+			textEl.X = constraintTR.X
+			textEl.Y = constraintTR.Y + float64(shape.FontSize)*3/4
+			textEl.Fill = shape.SecondaryAccentColor
+			textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx;letter-spacing:2px", "end", float64(shape.FontSize))
+			textEl.Content = f.ConstraintAbbr()
+			output += textEl.Render()
+		}
 
 		rowBox.TopLeft.Y += rowHeight
 
@@ -590,17 +603,38 @@ func Class(r *Runner, shape d2target.Shape) (string, error) {
 	}
 	output += renderedSO
 
+	// The stereotype is above the name, the two centered together
+	stereotypeHeight := 0.
+	if shape.Class.Stereotype != "" {
+		stereotypeHeight = float64(shape.FontSize)
+		tl := label.InsideMiddleCenter.GetPointOnBox(
+			headerBox,
+			0,
+			float64(shape.LabelWidth),
+			stereotypeHeight+float64(shape.LabelHeight),
+		)
+
+		textEl := d2themes.NewThemableElement("text")
+		textEl.X = headerBox.Center().X
+		textEl.Y = tl.Y + stereotypeHeight*3/4
+		textEl.Fill = shape.GetFontColor()
+		textEl.ClassName = "text-mono"
+		textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "middle", shape.FontSize)
+		textEl.Content = svg.EscapeText("«" + shape.Class.Stereotype + "»")
+		output += textEl.Render()
+	}
+
 	if shape.Label != "" {
 		tl := label.InsideMiddleCenter.GetPointOnBox(
 			headerBox,
 			0,
 			float64(shape.LabelWidth),
-			float64(shape.LabelHeight),
+			stereotypeHeight+float64(shape.LabelHeight),
 		)
 
 		textEl := d2themes.NewThemableElement("text")
 		textEl.X = tl.X + float64(shape.LabelWidth)/2
-		textEl.Y = tl.Y + float64(shape.LabelHeight)*3/4
+		textEl.Y = tl.Y + stereotypeHeight + float64(shape.LabelHeight)*3/4
 		textEl.Fill = shape.GetFontColor()
 		textEl.ClassName = "text-mono"
 		textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx",
@@ -614,7 +648,11 @@ func Class(r *Runner, shape d2target.Shape) (string, error) {
 	rowBox := geo.NewBox(box.TopLeft.Copy(), box.Width, rowHeight)
 	rowBox.TopLeft.Y += headerBox.Height
 	for _, f := range shape.Fields {
-		output += classRow(shape, rowBox, f.VisibilityToken(), f.Name, f.Type, float64(shape.FontSize))
+		if f.Shape == "" {
+			output += classRow(shape, rowBox, f.VisibilityToken(), f.Name, f.Type, f.Static, f.Abstract, float64(shape.FontSize))
+		} else if f.Shape == d2target.ShapeRowHeader {
+			output += classGroupHeader(shape, rowBox, f.Name, float64(shape.FontSize))
+		}
 		rowBox.TopLeft.Y += rowHeight
 	}
 
@@ -635,14 +673,36 @@ func Class(r *Runner, shape d2target.Shape) (string, error) {
 	}
 
 	for _, m := range shape.Methods {
-		output += classRow(shape, rowBox, m.VisibilityToken(), m.Name, m.Return, float64(shape.FontSize))
+		if m.Shape == "" {
+			output += classRow(shape, rowBox, m.VisibilityToken(), m.Name, m.Return, m.Static, m.Abstract, float64(shape.FontSize))
+		} else if m.Shape == d2target.ShapeRowHeader {
+			output += classGroupHeader(shape, rowBox, m.Name, float64(shape.FontSize))
+		}
 		rowBox.TopLeft.Y += rowHeight
 	}
 
 	return output, nil
 }
 
-func classRow(shape d2target.Shape, box *geo.Box, prefix, nameText, typeText string, fontSize float64) string {
+// classGroupHeader draws a header row that groups the members after it
+func classGroupHeader(shape d2target.Shape, box *geo.Box, text string, fontSize float64) string {
+	tl := label.InsideMiddleLeft.GetPointOnBox(
+		box,
+		d2target.PrefixPadding,
+		box.Width,
+		fontSize,
+	)
+	textEl := d2themes.NewThemableElement("text")
+	textEl.X = tl.X
+	textEl.Y = tl.Y + fontSize*3/4
+	textEl.Fill = shape.NeutralAccentColor
+	textEl.ClassName = "text-mono-italic"
+	textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "start", fontSize)
+	textEl.Content = svg.EscapeText(text)
+	return textEl.Render()
+}
+
+func classRow(shape d2target.Shape, box *geo.Box, prefix, nameText, typeText string, static, abstract bool, fontSize float64) string {
 	output := ""
 	prefixTL := label.InsideMiddleLeft.GetPointOnBox(
 		box,
@@ -666,15 +726,24 @@ func classRow(shape d2target.Shape, box *geo.Box, prefix, nameText, typeText str
 	textEl.Content = prefix
 	output += textEl.Render()
 
+	memberStyle := ""
+	if static {
+		memberStyle = ";text-decoration:underline"
+	}
+	if abstract {
+		textEl.ClassName = "text-mono-italic"
+	}
+
 	textEl.X = prefixTL.X + d2target.PrefixWidth
 	textEl.Fill = shape.Fill
+	textEl.Style += memberStyle
 	textEl.Content = svg.EscapeText(nameText)
 	output += textEl.Render()
 
 	textEl.X = typeTR.X
 	textEl.Y = typeTR.Y + fontSize*3/4
 	textEl.Fill = shape.SecondaryAccentColor
-	textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "end", fontSize)
+	textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "end", fontSize) + memberStyle
 	textEl.Content = svg.EscapeText(typeText)
 	output += textEl.Render()
 
@@ -782,6 +851,21 @@ func ArrowheadJS(r *Runner, arrowhead d2target.Arrowhead, stroke string, strokeW
 			stroke,
 			BG_COLOR,
 		)
+	case d2target.TeeArrowhead:
+		arrowJS = fmt.Sprintf(
+			`node = rc.path(%s, { strokeWidth: %d, stroke: "%s", seed: 3 })`,
+			`"M0,-8 0,8 M0,0 -6,0"`,
+			strokeWidth,
+			stroke,
+		)
+	case d2target.DoubleTriangleArrowhead:
+		arrowJS = fmt.Sprintf(
+			`node = rc.polygon(%s, { strokeWidth: %d, stroke: "%s", fill: "%s", fillStyle: "solid", seed: 2 })`,
+			`[[-20, -4], [-10, 0], [-10, -4], [0, 0], [-10, 4], [-10, 0], [-20, 4]]`,
+			strokeWidth,
+			stroke,
+			stroke,
+		)
 	case d2target.DiamondArrowhead:
 		arrowJS = fmt.Sprintf(
 			`node = rc.polygon(%s, { strokeWidth: %d, stroke: "%s", fill: "%s", fillStyle: "solid", seed: 1 })`,
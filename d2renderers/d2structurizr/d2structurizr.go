@@ -0,0 +1,334 @@
+// d2structurizr exports a diagram as a Structurizr workspace, in either the Structurizr DSL
+// or workspace JSON, so that D2 authored models can be used by Structurizr tooling.
+//
+// D2 has no notion of C4 levels, so they are inferred: person shapes become people, top level
+// objects become software systems, their children containers, and their grandchildren
+// components. Objects nested deeper than components are merged into their component, and
+// connections to them are attached to it. Text and code shapes are annotations and are left
+// out. Only the board being rendered is exported.
+package d2structurizr
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/idpath"
+)
+
+// Element types, as named in Structurizr tags
+const (
+	Person         = "Person"
+	SoftwareSystem = "Software System"
+	Container      = "Container"
+	Component      = "Component"
+)
+
+type RenderOpts struct {
+	// Name of the workspace, defaulting to the diagram's name
+	Name string
+}
+
+// Model is the Structurizr model inferred from a diagram
+type Model struct {
+	Name          string
+	Elements      []*Element
+	Relationships []*Relationship
+}
+
+type Element struct {
+	// ID is a unique DSL identifier for the element, derived from its D2 ID
+	ID          string
+	Type        string
+	Name        string
+	Description string
+	Tags        []string
+	URL         string
+	Parent      *Element
+	Children    []*Element
+
+	shape d2target.Shape
+	// jsonID is the numeric ID used in workspace JSON
+	jsonID string
+}
+
+type Relationship struct {
+	Source      *Element
+	Destination *Element
+	Description string
+
+	jsonID string
+}
+
+// Convert infers the Structurizr model of a diagram
+func Convert(diagram *d2target.Diagram, opts *RenderOpts) (*Model, error) {
+	if opts == nil {
+		opts = &RenderOpts{}
+	}
+	m := &Model{
+		Name: opts.Name,
+	}
+	if m.Name == "" {
+		m.Name = diagram.Name
+	}
+
+	byPath := make(idpath.Map[*Element])
+	usedIDs := make(map[string]struct{})
+	for _, s := range diagram.Shapes {
+		if s.Type == d2target.ShapeText || s.Type == d2target.ShapeCode {
+			continue
+		}
+		path, err := idpath.Split(s.ID)
+		if err != nil {
+			return nil, err
+		}
+		parent := byPath.Ancestor(path[:len(path)-1])
+		if parent != nil && parent.Type == Component {
+			// Structurizr has no level below components
+			byPath.Set(path, parent)
+			continue
+		}
+
+		el := &Element{
+			ID:          uniqueID(usedIDs, path),
+			Name:        s.Label,
+			Description: s.Tooltip,
+			URL:         s.Link,
+			shape:       s,
+		}
+		if el.Name == "" {
+			el.Name = path[len(path)-1]
+		}
+		switch {
+		case s.Type == d2target.ShapePerson:
+			el.Type = Person
+		case parent == nil || parent.Type == Person:
+			el.Type = SoftwareSystem
+		case parent.Type == SoftwareSystem:
+			el.Type = Container
+		default:
+			el.Type = Component
+		}
+		switch s.Type {
+		case d2target.ShapeCylinder, d2target.ShapeStoredData:
+			el.Tags = append(el.Tags, "Database")
+		case d2target.ShapeQueue:
+			el.Tags = append(el.Tags, "Queue")
+		}
+		// People always belong to the top level of a Structurizr model
+		if el.Type != Person && parent != nil && parent.Type != Person {
+			el.Parent = parent
+			parent.Children = append(parent.Children, el)
+		}
+		byPath.Set(path, el)
+		m.Elements = append(m.Elements, el)
+	}
+
+	seen := make(map[[2]*Element]struct{})
+	for _, c := range diagram.Connections {
+		src, err := byPath.ConnectionEnd(c.Src)
+		if err != nil {
+			return nil, err
+		}
+		dst, err := byPath.ConnectionEnd(c.Dst)
+		if err != nil {
+			return nil, err
+		}
+		if src == nil || dst == nil {
+			continue
+		}
+		if c.SrcArrow != d2target.NoArrowhead && c.DstArrow == d2target.NoArrowhead {
+			src, dst = dst, src
+		}
+		// Structurizr doesn't allow relationships between an element and its ancestors
+		if isAncestor(src, dst) || isAncestor(dst, src) {
+			continue
+		}
+		// Connections merged into the same elements are only described once
+		if _, ok := seen[[2]*Element{src, dst}]; ok {
+			continue
+		}
+		seen[[2]*Element{src, dst}] = struct{}{}
+		m.Relationships = append(m.Relationships, &Relationship{
+			Source:      src,
+			Destination: dst,
+			Description: c.Label,
+		})
+	}
+
+	// Structurizr JSON uses numeric IDs shared by elements and relationships
+	n := 1
+	for _, el := range m.Elements {
+		el.jsonID = strconv.Itoa(n)
+		n++
+	}
+	for _, r := range m.Relationships {
+		r.jsonID = strconv.Itoa(n)
+		n++
+	}
+	return m, nil
+}
+
+func isAncestor(el, descendant *Element) bool {
+	for p := descendant; p != nil; p = p.Parent {
+		if p == el {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueID converts a D2 ID path into a DSL identifier, which may only contain letters,
+// digits, and underscores
+func uniqueID(used map[string]struct{}, path []string) string {
+	var sb strings.Builder
+	for i, p := range path {
+		if i > 0 {
+			sb.WriteByte('_')
+		}
+		for _, r := range p {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '_' {
+				sb.WriteRune(r)
+			} else {
+				sb.WriteByte('_')
+			}
+		}
+	}
+	id := sb.String()
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		id = "e_" + id
+	}
+	unique := id
+	for i := 2; ; i++ {
+		if _, ok := used[strings.ToLower(unique)]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s_%d", id, i)
+	}
+	used[strings.ToLower(unique)] = struct{}{}
+	return unique
+}
+
+// RenderDSL renders the diagram as a Structurizr DSL workspace
+func RenderDSL(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
+	m, err := Convert(diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var w dslWriter
+	w.line("workspace %s {", quote(m.Name))
+	w.depth++
+	w.line("model {")
+	w.depth++
+	for _, el := range m.Elements {
+		if el.Parent == nil {
+			w.element(el)
+		}
+	}
+	if len(m.Relationships) > 0 {
+		w.line("")
+	}
+	for _, r := range m.Relationships {
+		if r.Description != "" {
+			w.line("%s -> %s %s", r.Source.ID, r.Destination.ID, quote(r.Description))
+		} else {
+			w.line("%s -> %s", r.Source.ID, r.Destination.ID)
+		}
+	}
+	w.depth--
+	w.line("}")
+	w.line("")
+
+	w.line("views {")
+	w.depth++
+	w.view("systemLandscape", "", "SystemLandscape")
+	for _, el := range m.Elements {
+		if len(el.Children) == 0 {
+			continue
+		}
+		switch el.Type {
+		case SoftwareSystem:
+			w.view("container", el.ID, el.ID+"-containers")
+		case Container:
+			w.view("component", el.ID, el.ID+"-components")
+		}
+	}
+	w.depth--
+	w.line("}")
+	w.depth--
+	w.line("}")
+	return w.Bytes(), nil
+}
+
+type dslWriter struct {
+	bytes.Buffer
+	depth int
+}
+
+func (w *dslWriter) line(format string, args ...interface{}) {
+	if format != "" {
+		w.WriteString(strings.Repeat("  ", w.depth))
+		fmt.Fprintf(w, format, args...)
+	}
+	w.WriteByte('\n')
+}
+
+func (w *dslWriter) element(el *Element) {
+	keyword := map[string]string{
+		Person:         "person",
+		SoftwareSystem: "softwareSystem",
+		Container:      "container",
+		Component:      "component",
+	}[el.Type]
+	// Optional arguments are positional, so earlier ones are kept when later ones are set
+	args := []string{quote(el.Name), quote(el.Description)}
+	switch el.Type {
+	case Container, Component:
+		// technology
+		args = append(args, quote(""))
+	}
+	args = append(args, quote(strings.Join(el.Tags, ",")))
+	for len(args) > 1 && args[len(args)-1] == `""` {
+		args = args[:len(args)-1]
+	}
+
+	decl := fmt.Sprintf("%s = %s %s", el.ID, keyword, strings.Join(args, " "))
+	if len(el.Children) == 0 && el.URL == "" {
+		w.line("%s", decl)
+		return
+	}
+	w.line("%s {", decl)
+	w.depth++
+	if el.URL != "" {
+		w.line("url %s", quote(el.URL))
+	}
+	for _, child := range el.Children {
+		w.element(child)
+	}
+	w.depth--
+	w.line("}")
+}
+
+func (w *dslWriter) view(kind, scope, key string) {
+	if scope != "" {
+		w.line("%s %s %s {", kind, scope, quote(key))
+	} else {
+		w.line("%s %s {", kind, quote(key))
+	}
+	w.depth++
+	w.line("include *")
+	w.line("autoLayout")
+	w.depth--
+	w.line("}")
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", " ")
+	return `"` + s + `"`
+}
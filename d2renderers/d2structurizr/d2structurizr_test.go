@@ -0,0 +1,133 @@
+package d2structurizr_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2renderers/d2structurizr"
+	"oss.terrastruct.com/d2/d2renderers/internal/d2rendertest"
+)
+
+const script = `customer: Customer {shape: person}
+shop: Online Shop {
+  web: Web App
+  api: API {
+    orders: Orders
+    orders.validation
+  }
+  db: Database {shape: cylinder}
+  web -> api: calls
+  api.orders.validation -> db
+}
+payments: Payments {tooltip: Card processing}
+customer -> shop.web: browses
+shop.api <- payments: webhooks
+note: just a note {shape: text}
+`
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	m, err := d2structurizr.Convert(d2rendertest.Compile(t, script), &d2structurizr.RenderOpts{Name: "shop"})
+	assert.Success(t, err)
+
+	byID := map[string]*d2structurizr.Element{}
+	for _, el := range m.Elements {
+		byID[el.ID] = el
+	}
+	tassert.Len(t, m.Elements, 7)
+	assert.String(t, d2structurizr.Person, byID["customer"].Type)
+	assert.String(t, d2structurizr.SoftwareSystem, byID["shop"].Type)
+	assert.String(t, d2structurizr.Container, byID["shop_api"].Type)
+	assert.String(t, d2structurizr.Component, byID["shop_api_orders"].Type)
+	assert.String(t, "Card processing", byID["payments"].Description)
+	tassert.Equal(t, []string{"Database"}, byID["shop_db"].Tags)
+
+	var rels []string
+	for _, r := range m.Relationships {
+		rels = append(rels, r.Source.ID+" -> "+r.Destination.ID+": "+r.Description)
+	}
+	tassert.Equal(t, []string{
+		"shop_web -> shop_api: calls",
+		// merged into the component since Structurizr has no deeper level
+		"shop_api_orders -> shop_db: ",
+		"customer -> shop_web: browses",
+		// reversed to follow the arrow
+		"payments -> shop_api: webhooks",
+	}, rels)
+}
+
+func TestRenderDSL(t *testing.T) {
+	t.Parallel()
+
+	out, err := d2structurizr.RenderDSL(d2rendertest.Compile(t, script), &d2structurizr.RenderOpts{Name: "shop"})
+	assert.Success(t, err)
+	assert.String(t, `workspace "shop" {
+  model {
+    customer = person "Customer"
+    shop = softwareSystem "Online Shop" {
+      shop_web = container "Web App"
+      shop_api = container "API" {
+        shop_api_orders = component "Orders"
+      }
+      shop_db = container "Database" "" "" "Database"
+    }
+    payments = softwareSystem "Payments" "Card processing"
+
+    shop_web -> shop_api "calls"
+    shop_api_orders -> shop_db
+    customer -> shop_web "browses"
+    payments -> shop_api "webhooks"
+  }
+
+  views {
+    systemLandscape "SystemLandscape" {
+      include *
+      autoLayout
+    }
+    container shop "shop-containers" {
+      include *
+      autoLayout
+    }
+    component shop_api "shop_api-components" {
+      include *
+      autoLayout
+    }
+  }
+}
+`, string(out))
+}
+
+func TestRenderJSON(t *testing.T) {
+	t.Parallel()
+
+	out, err := d2structurizr.RenderJSON(d2rendertest.Compile(t, script), nil)
+	assert.Success(t, err)
+
+	var ws d2structurizr.Workspace
+	err = json.Unmarshal(out, &ws)
+	assert.Success(t, err)
+
+	tassert.Len(t, ws.Model.People, 1)
+	tassert.Len(t, ws.Model.SoftwareSystems, 2)
+	shop := ws.Model.SoftwareSystems[0]
+	assert.String(t, "Element,Software System", shop.Tags)
+	tassert.Len(t, shop.Containers, 3)
+	tassert.Len(t, shop.Containers[1].Components, 1)
+	assert.String(t, "Element,Container,Database", shop.Containers[2].Tags)
+	tassert.Len(t, ws.Model.People[0].Relationships, 1)
+
+	tassert.Len(t, ws.Views.SystemLandscapeViews, 1)
+	// The landscape has no relationships since they're all between nested elements
+	tassert.Len(t, ws.Views.SystemLandscapeViews[0].Elements, 3)
+	tassert.Len(t, ws.Views.SystemLandscapeViews[0].Relationships, 0)
+	tassert.Len(t, ws.Views.ContainerViews, 1)
+	// The containers, and the customer and payments which relate to them
+	tassert.Len(t, ws.Views.ContainerViews[0].Elements, 5)
+	assert.String(t, shop.ID, ws.Views.ContainerViews[0].SoftwareSystemID)
+	tassert.Len(t, ws.Views.ComponentViews, 1)
+}
@@ -0,0 +1,193 @@
+package d2structurizr
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// Workspace is a Structurizr workspace in its JSON form
+type Workspace struct {
+	Name  string         `json:"name"`
+	Model WorkspaceModel `json:"model"`
+	Views Views          `json:"views"`
+}
+
+type WorkspaceModel struct {
+	People          []*WorkspaceElement `json:"people,omitempty"`
+	SoftwareSystems []*WorkspaceElement `json:"softwareSystems,omitempty"`
+}
+
+type WorkspaceElement struct {
+	ID            string                   `json:"id"`
+	Name          string                   `json:"name"`
+	Description   string                   `json:"description,omitempty"`
+	Tags          string                   `json:"tags"`
+	URL           string                   `json:"url,omitempty"`
+	Relationships []*WorkspaceRelationship `json:"relationships,omitempty"`
+	Containers    []*WorkspaceElement      `json:"containers,omitempty"`
+	Components    []*WorkspaceElement      `json:"components,omitempty"`
+}
+
+type WorkspaceRelationship struct {
+	ID            string `json:"id"`
+	SourceID      string `json:"sourceId"`
+	DestinationID string `json:"destinationId"`
+	Description   string `json:"description,omitempty"`
+	Tags          string `json:"tags"`
+}
+
+type Views struct {
+	SystemLandscapeViews []*View `json:"systemLandscapeViews,omitempty"`
+	ContainerViews       []*View `json:"containerViews,omitempty"`
+	ComponentViews       []*View `json:"componentViews,omitempty"`
+}
+
+type View struct {
+	Key              string              `json:"key"`
+	SoftwareSystemID string              `json:"softwareSystemId,omitempty"`
+	ContainerID      string              `json:"containerId,omitempty"`
+	Elements         []*ElementView      `json:"elements"`
+	Relationships    []*RelationshipView `json:"relationships"`
+}
+
+// ElementView places an element in a view at its position in the laid out diagram
+type ElementView struct {
+	ID string `json:"id"`
+	X  int    `json:"x"`
+	Y  int    `json:"y"`
+}
+
+type RelationshipView struct {
+	ID string `json:"id"`
+}
+
+// RenderJSON renders the diagram as a Structurizr workspace JSON document
+func RenderJSON(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
+	m, err := Convert(diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+	ws := m.Workspace()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(ws)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Workspace converts the model into a workspace with a system landscape view, and container and
+// component views for the software systems and containers that have children
+func (m *Model) Workspace() *Workspace {
+	ws := &Workspace{
+		Name: m.Name,
+	}
+
+	elements := make(map[*Element]*WorkspaceElement)
+	var convert func(el *Element) *WorkspaceElement
+	convert = func(el *Element) *WorkspaceElement {
+		wel := &WorkspaceElement{
+			ID:          el.jsonID,
+			Name:        el.Name,
+			Description: el.Description,
+			Tags:        strings.Join(append([]string{"Element", el.Type}, el.Tags...), ","),
+			URL:         el.URL,
+		}
+		elements[el] = wel
+		for _, child := range el.Children {
+			if child.Type == Container {
+				wel.Containers = append(wel.Containers, convert(child))
+			} else {
+				wel.Components = append(wel.Components, convert(child))
+			}
+		}
+		return wel
+	}
+	for _, el := range m.Elements {
+		if el.Parent != nil {
+			continue
+		}
+		if el.Type == Person {
+			ws.Model.People = append(ws.Model.People, convert(el))
+		} else {
+			ws.Model.SoftwareSystems = append(ws.Model.SoftwareSystems, convert(el))
+		}
+	}
+	for _, r := range m.Relationships {
+		src := elements[r.Source]
+		src.Relationships = append(src.Relationships, &WorkspaceRelationship{
+			ID:            r.jsonID,
+			SourceID:      r.Source.jsonID,
+			DestinationID: r.Destination.jsonID,
+			Description:   r.Description,
+			Tags:          "Relationship",
+		})
+	}
+
+	ws.Views.SystemLandscapeViews = append(ws.Views.SystemLandscapeViews, m.view("SystemLandscape", nil))
+	for _, el := range m.Elements {
+		if len(el.Children) == 0 {
+			continue
+		}
+		switch el.Type {
+		case SoftwareSystem:
+			v := m.view(el.ID+"-containers", el)
+			v.SoftwareSystemID = el.jsonID
+			ws.Views.ContainerViews = append(ws.Views.ContainerViews, v)
+		case Container:
+			v := m.view(el.ID+"-components", el)
+			v.ContainerID = el.jsonID
+			ws.Views.ComponentViews = append(ws.Views.ComponentViews, v)
+		}
+	}
+	return ws
+}
+
+// view includes the children of scope, or the top level elements when scope is nil.
+// Elements outside of scope that are directly related to them are included too.
+func (m *Model) view(key string, scope *Element) *View {
+	included := make(map[*Element]bool)
+	for _, el := range m.Elements {
+		if el.Parent == scope {
+			included[el] = true
+		}
+	}
+	if scope != nil {
+		for _, r := range m.Relationships {
+			switch {
+			case included[r.Source] && !isAncestor(scope, r.Destination):
+				included[r.Destination] = true
+			case included[r.Destination] && !isAncestor(scope, r.Source):
+				included[r.Source] = true
+			}
+		}
+	}
+
+	v := &View{
+		Key:           key,
+		Elements:      []*ElementView{},
+		Relationships: []*RelationshipView{},
+	}
+	for _, el := range m.Elements {
+		if included[el] {
+			v.Elements = append(v.Elements, &ElementView{
+				ID: el.jsonID,
+				X:  el.shape.Pos.X,
+				Y:  el.shape.Pos.Y,
+			})
+		}
+	}
+	for _, r := range m.Relationships {
+		if included[r.Source] && included[r.Destination] {
+			v.Relationships = append(v.Relationships, &RelationshipView{ID: r.jsonID})
+		}
+	}
+	return v
+}
@@ -97,6 +97,63 @@ func Append(diagram *d2target.Diagram, ruler *textmeasure.Ruler, in []byte) []by
 
 	viewboxHeight += h + PAD_TOP
 
+	svg = resize(svg, viewboxMatches, viewboxWidth, viewboxHeight)
+	appendix += fontStyles(svg)
+
+	closingIndex := strings.LastIndex(svg, "</svg></svg>")
+	svg = svg[:closingIndex] + appendix + svg[closingIndex:]
+
+	// icons are numbered according to diagram.Shapes which is based on their order of definition,
+	// but they appear in the svg according to renderOrder so we have to replace in that order
+	type appendixIcon struct {
+		number    int
+		isTooltip bool
+		shape     d2target.Shape
+	}
+	var renderOrder []appendixIcon
+
+	i := 1
+	for _, s := range diagram.Shapes {
+		if s.Tooltip != "" {
+			renderOrder = append(renderOrder, appendixIcon{i, true, s})
+			i++
+		}
+		if s.Link != "" {
+			renderOrder = append(renderOrder, appendixIcon{i, false, s})
+			i++
+		}
+	}
+	// sort to match render order
+	sort.SliceStable(renderOrder, func(i, j int) bool {
+		iZIndex := renderOrder[i].shape.GetZIndex()
+		jZIndex := renderOrder[j].shape.GetZIndex()
+		if iZIndex != jZIndex {
+			return iZIndex < jZIndex
+		}
+		return renderOrder[i].shape.Level < renderOrder[j].shape.Level
+	})
+
+	// replace each rendered svg icon
+	for _, icon := range renderOrder {
+		// The clip-path has a unique ID, so this won't replace any user icons
+		// In the existing SVG, the transform places it top-left, so we adjust
+		var iconStr string
+		if icon.isTooltip {
+			iconStr = d2svg.TooltipIcon
+		} else {
+			iconStr = d2svg.LinkIcon
+		}
+		svg = strings.Replace(svg, iconStr, generateNumberedIcon(icon.number, 0, ICON_RADIUS), 1)
+	}
+
+	return []byte(svg)
+}
+
+// resize sets the dimensions of the outer svg, inner svg, and background rect, keeping the
+// top left of the inner viewbox
+func resize(svg string, viewboxMatches [][]string, viewboxWidth, viewboxHeight int) string {
+	viewboxMatch := viewboxMatches[1]
+	viewboxSlice := strings.Split(viewboxMatch[1], " ")
 	newOuterViewbox := fmt.Sprintf(`viewBox="0 0 %d %d"`, viewboxWidth, viewboxHeight)
 	newViewbox := fmt.Sprintf(`viewBox="%s %s %s %s"`, viewboxSlice[0], viewboxSlice[1], strconv.Itoa(viewboxWidth), strconv.Itoa(viewboxHeight))
 
@@ -119,9 +176,14 @@ func Append(diagram *d2target.Diagram, ruler *textmeasure.Ruler, in []byte) []by
 		svg = strings.Replace(svg, widthMatches[i][0], newWidth, 1)
 		svg = strings.Replace(svg, heightMatches[i][0], newHeight, 1)
 	}
+	return svg
+}
 
+// fontStyles returns the fonts used by appended text that the svg doesn't already embed
+func fontStyles(svg string) string {
+	var styles string
 	if !strings.Contains(svg, `font-family: "font-regular"`) {
-		appendix += fmt.Sprintf(`<style type="text/css"><![CDATA[
+		styles += fmt.Sprintf(`<style type="text/css"><![CDATA[
 .text {
 	font-family: "font-regular";
 }
@@ -132,7 +194,7 @@ func Append(diagram *d2target.Diagram, ruler *textmeasure.Ruler, in []byte) []by
 ]]></style>`, d2fonts.FontEncodings.Get(d2fonts.SourceSansPro.Font(0, d2fonts.FONT_STYLE_REGULAR)))
 	}
 	if !strings.Contains(svg, `font-family: "font-bold"`) {
-		appendix += fmt.Sprintf(`<style type="text/css"><![CDATA[
+		styles += fmt.Sprintf(`<style type="text/css"><![CDATA[
 .text-bold {
 	font-family: "font-bold";
 }
@@ -142,53 +204,56 @@ func Append(diagram *d2target.Diagram, ruler *textmeasure.Ruler, in []byte) []by
 }
 ]]></style>`, d2fonts.FontEncodings.Get(d2fonts.SourceSansPro.Font(0, d2fonts.FONT_STYLE_BOLD)))
 	}
+	return styles
+}
 
-	closingIndex := strings.LastIndex(svg, "</svg></svg>")
-	svg = svg[:closingIndex] + appendix + svg[closingIndex:]
-
-	// icons are numbered according to diagram.Shapes which is based on their order of definition,
-	// but they appear in the svg according to renderOrder so we have to replace in that order
-	type appendixIcon struct {
-		number    int
-		isTooltip bool
-		shape     d2target.Shape
+// AppendAttribution adds a footer with the given lines, such as the sources and licenses of
+// the icons used, below the diagram and any appendix already appended
+func AppendAttribution(ruler *textmeasure.Ruler, in []byte, lines []string) []byte {
+	if len(lines) == 0 {
+		return in
 	}
-	var renderOrder []appendixIcon
+	svg := string(in)
 
-	i := 1
-	for _, s := range diagram.Shapes {
-		if s.Tooltip != "" {
-			renderOrder = append(renderOrder, appendixIcon{i, true, s})
-			i++
-		}
-		if s.Link != "" {
-			renderOrder = append(renderOrder, appendixIcon{i, false, s})
-			i++
-		}
-	}
-	// sort to match render order
-	sort.SliceStable(renderOrder, func(i, j int) bool {
-		iZIndex := renderOrder[i].shape.GetZIndex()
-		jZIndex := renderOrder[j].shape.GetZIndex()
-		if iZIndex != jZIndex {
-			return iZIndex < jZIndex
-		}
-		return renderOrder[i].shape.Level < renderOrder[j].shape.Level
-	})
+	viewboxMatches := viewboxRegex.FindAllStringSubmatch(svg, 2)
+	viewboxSlice := strings.Split(viewboxMatches[1][1], " ")
+	viewboxX, _ := strconv.Atoi(viewboxSlice[0])
+	viewboxY, _ := strconv.Atoi(viewboxSlice[1])
+	viewboxWidth, _ := strconv.Atoi(viewboxSlice[2])
+	viewboxHeight, _ := strconv.Atoi(viewboxSlice[3])
 
-	// replace each rendered svg icon
-	for _, icon := range renderOrder {
-		// The clip-path has a unique ID, so this won't replace any user icons
-		// In the existing SVG, the transform places it top-left, so we adjust
-		var iconStr string
-		if icon.isTooltip {
-			iconStr = d2svg.TooltipIcon
-		} else {
-			iconStr = d2svg.LinkIcon
+	bottom := viewboxY + viewboxHeight
+	maxWidth, totalHeight := 0, 0
+	var footer []string
+	for _, text := range lines {
+		mtext := &d2target.MText{
+			Text:     text,
+			FontSize: FONT_SIZE,
 		}
-		svg = strings.Replace(svg, iconStr, generateNumberedIcon(icon.number, 0, ICON_RADIUS), 1)
+		dims := d2graph.GetTextDimensions(nil, ruler, mtext, nil)
+		footer = append(footer, fmt.Sprintf(`<text class="text" x="%d" y="%d" style="font-size: %dpx;">%s</text>`,
+			viewboxX+PAD_SIDES, bottom+PAD_TOP+totalHeight+FONT_SIZE, FONT_SIZE, d2svg.RenderText(text, float64(viewboxX+PAD_SIDES), float64(dims.Height))))
+		maxWidth = go2.IntMax(maxWidth, dims.Width)
+		totalHeight += dims.Height + SPACER
 	}
 
+	viewboxWidth = go2.IntMax(viewboxWidth, maxWidth+PAD_SIDES*2)
+	viewboxHeight += PAD_TOP + totalHeight + SPACER
+
+	separatorEl := d2themes.NewThemableElement("line")
+	separatorEl.X1 = float64(viewboxX + PAD_SIDES)
+	separatorEl.Y1 = float64(bottom + PAD_TOP/2)
+	separatorEl.X2 = float64(viewboxX + viewboxWidth - PAD_SIDES)
+	separatorEl.Y2 = float64(bottom + PAD_TOP/2)
+	separatorEl.Stroke = color.B2
+
+	svg = resize(svg, viewboxMatches, viewboxWidth, viewboxHeight)
+	attribution := fmt.Sprintf(`<g class="attribution">%s%s</g>
+`, separatorEl.Render(), strings.Join(footer, "\n"))
+	attribution += fontStyles(svg)
+
+	closingIndex := strings.LastIndex(svg, "</svg></svg>")
+	svg = svg[:closingIndex] + attribution + svg[closingIndex:]
 	return []byte(svg)
 }
 
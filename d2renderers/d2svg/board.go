@@ -0,0 +1,53 @@
+package d2svg
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"oss.terrastruct.com/util-go/go2"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// boardPreviewPadding is the space between the border of a board shape and the board it embeds
+const boardPreviewPadding = 8
+
+// renderBoardPreviews renders the boards the board shapes of diagram embed, by the IDs of the
+// shapes. Previews are rendered with opts, but fit to their boards, since they're scaled into
+// the shapes.
+func renderBoardPreviews(diagram *d2target.Diagram, opts *RenderOpts) (map[string][]byte, error) {
+	previews := make(map[string][]byte)
+	for _, s := range diagram.Shapes {
+		if s.Type != d2target.ShapeBoard || s.BoardDiagram == nil {
+			continue
+		}
+		previewOpts := *opts
+		previewOpts.Pad = go2.Pointer(int64(0))
+		previewOpts.Center = nil
+		previewOpts.Scale = nil
+		previewOpts.MasterID = ""
+		previewOpts.SourceMap = false
+		preview, err := Render(s.BoardDiagram, &previewOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render board %s embedded by %s: %w", s.Board, s.ID, err)
+		}
+		previews[s.ID] = preview
+	}
+	return previews, nil
+}
+
+// drawBoardPreview draws the board a board shape embeds inside its border, scaled to fit
+func drawBoardPreview(writer io.Writer, targetShape d2target.Shape, preview []byte) {
+	if preview == nil {
+		return
+	}
+	width := targetShape.Width - 2*boardPreviewPadding
+	height := targetShape.Height - 2*boardPreviewPadding
+	if width <= 0 || height <= 0 {
+		return
+	}
+	fmt.Fprintf(writer, `<image href="data:image/svg+xml;base64,%s" x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="xMidYMid meet" />`,
+		base64.StdEncoding.EncodeToString(preview),
+		targetShape.Pos.X+boardPreviewPadding, targetShape.Pos.Y+boardPreviewPadding, width, height)
+}
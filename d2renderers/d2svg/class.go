@@ -13,6 +13,11 @@ import (
 )
 
 func classHeader(diagramHash string, shape d2target.Shape, box *geo.Box, text string, textWidth, textHeight, fontSize float64) string {
+	// The stereotype is above the name, the two centered together
+	stereotypeHeight := 0.
+	if shape.Class.Stereotype != "" {
+		stereotypeHeight = fontSize
+	}
 	rectEl := d2themes.NewThemableElement("rect")
 	rectEl.X, rectEl.Y = box.TopLeft.X, box.TopLeft.Y
 	rectEl.Width, rectEl.Height = box.Width, box.Height
@@ -24,17 +29,35 @@ func classHeader(diagramHash string, shape d2target.Shape, box *geo.Box, text st
 	}
 	str := rectEl.Render()
 
+	if stereotypeHeight != 0 {
+		tl := label.InsideMiddleCenter.GetPointOnBox(
+			box,
+			0,
+			textWidth,
+			stereotypeHeight+textHeight,
+		)
+
+		textEl := d2themes.NewThemableElement("text")
+		textEl.X = box.Center().X
+		textEl.Y = tl.Y + stereotypeHeight*3/4
+		textEl.Fill = shape.GetFontColor()
+		textEl.ClassName = "text-mono"
+		textEl.Style = fmt.Sprintf(`text-anchor:%s;font-size:%vpx;`, "middle", fontSize)
+		textEl.Content = svg.EscapeText("«" + shape.Class.Stereotype + "»")
+		str += textEl.Render()
+	}
+
 	if text != "" {
 		tl := label.InsideMiddleCenter.GetPointOnBox(
 			box,
 			0,
 			textWidth,
-			textHeight,
+			stereotypeHeight+textHeight,
 		)
 
 		textEl := d2themes.NewThemableElement("text")
 		textEl.X = tl.X + textWidth/2
-		textEl.Y = tl.Y + textHeight*3/4
+		textEl.Y = tl.Y + stereotypeHeight + textHeight*3/4
 		textEl.Fill = shape.GetFontColor()
 		textEl.ClassName = "text-mono"
 		textEl.Style = fmt.Sprintf(`text-anchor:%s;font-size:%vpx;`,
@@ -46,7 +69,7 @@ func classHeader(diagramHash string, shape d2target.Shape, box *geo.Box, text st
 	return str
 }
 
-func classRow(shape d2target.Shape, box *geo.Box, prefix, nameText, typeText string, fontSize float64) string {
+func classRow(shape d2target.Shape, box *geo.Box, prefix, nameText, typeText string, static, abstract bool, fontSize float64) string {
 	// Row is made up of prefix, name, and type
 	// e.g. | + firstName   string  |
 	prefixTL := label.InsideMiddleLeft.GetPointOnBox(
@@ -71,21 +94,58 @@ func classRow(shape d2target.Shape, box *geo.Box, prefix, nameText, typeText str
 	textEl.Content = prefix
 	out := textEl.Render()
 
+	// Static members are underlined and abstract ones italicized, as in UML
+	memberStyle := ""
+	if static {
+		memberStyle = ";text-decoration:underline"
+	}
+	if abstract {
+		textEl.ClassName = "text-mono-italic"
+	}
+
 	textEl.X = prefixTL.X + d2target.PrefixWidth
 	textEl.Fill = shape.Fill
+	textEl.Style += memberStyle
 	textEl.Content = svg.EscapeText(nameText)
 	out += textEl.Render()
 
 	textEl.X = typeTR.X
 	textEl.Y = typeTR.Y + fontSize*3/4
 	textEl.Fill = shape.SecondaryAccentColor
-	textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "end", fontSize)
+	textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "end", fontSize) + memberStyle
 	textEl.Content = svg.EscapeText(typeText)
 	out += textEl.Render()
 
 	return out
 }
 
+// classGroupRow draws a header or separator row that groups the members after it
+func classGroupRow(shape d2target.Shape, box *geo.Box, rowShape, text string, fontSize float64) string {
+	if rowShape == d2target.ShapeRowSeparator {
+		lineEl := d2themes.NewThemableElement("line")
+		lineEl.X1, lineEl.Y1 = box.TopLeft.X+d2target.PrefixPadding, box.Center().Y
+		lineEl.X2, lineEl.Y2 = box.TopLeft.X+box.Width-d2target.PrefixPadding, box.Center().Y
+		lineEl.Stroke = shape.NeutralAccentColor
+		lineEl.Style = "stroke-width:1;stroke-dasharray:4,4"
+		return lineEl.Render()
+	}
+
+	tl := label.InsideMiddleLeft.GetPointOnBox(
+		box,
+		d2target.PrefixPadding,
+		box.Width,
+		fontSize,
+	)
+	textEl := d2themes.NewThemableElement("text")
+	textEl.X = tl.X
+	textEl.Y = tl.Y + fontSize*3/4
+	textEl.Fill = shape.NeutralAccentColor
+	textEl.ClassName = "text-mono-italic"
+	textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "start", fontSize)
+	textEl.Content = svg.EscapeText(text)
+	return textEl.Render()
+}
+
 func drawClass(writer io.Writer, diagramHash string, targetShape d2target.Shape) {
 	el := d2themes.NewThemableElement("rect")
 	el.X = float64(targetShape.Pos.X)
@@ -116,9 +176,13 @@ func drawClass(writer io.Writer, diagramHash string, targetShape d2target.Shape)
 	rowBox := geo.NewBox(box.TopLeft.Copy(), box.Width, rowHeight)
 	rowBox.TopLeft.Y += headerBox.Height
 	for _, f := range targetShape.Fields {
-		fmt.Fprint(writer,
-			classRow(targetShape, rowBox, f.VisibilityToken(), f.Name, f.Type, float64(targetShape.FontSize)),
-		)
+		if f.Shape != "" {
+			fmt.Fprint(writer, classGroupRow(targetShape, rowBox, f.Shape, f.Name, float64(targetShape.FontSize)))
+		} else {
+			fmt.Fprint(writer,
+				classRow(targetShape, rowBox, f.VisibilityToken(), f.Name, f.Type, f.Static, f.Abstract, float64(targetShape.FontSize)),
+			)
+		}
 		rowBox.TopLeft.Y += rowHeight
 	}
 
@@ -137,9 +201,13 @@ func drawClass(writer io.Writer, diagramHash string, targetShape d2target.Shape)
 	fmt.Fprint(writer, lineEl.Render())
 
 	for _, m := range targetShape.Methods {
-		fmt.Fprint(writer,
-			classRow(targetShape, rowBox, m.VisibilityToken(), m.Name, m.Return, float64(targetShape.FontSize)),
-		)
+		if m.Shape != "" {
+			fmt.Fprint(writer, classGroupRow(targetShape, rowBox, m.Shape, m.Name, float64(targetShape.FontSize)))
+		} else {
+			fmt.Fprint(writer,
+				classRow(targetShape, rowBox, m.VisibilityToken(), m.Name, m.Return, m.Static, m.Abstract, float64(targetShape.FontSize)),
+			)
+		}
 		rowBox.TopLeft.Y += rowHeight
 	}
 
@@ -1,10 +1,16 @@
 package d2svg
 
 import (
+	"fmt"
+	"html"
+	"regexp"
 	"strings"
 
 	"github.com/alecthomas/chroma/v2"
+	chromaHtml "github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/alecthomas/chroma/v2/formatters/svg"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
 )
 
 // Copied private functions from chroma. Their public functions do too much (write the whole SVG document)
@@ -54,3 +60,62 @@ func styleAttr(styles map[chroma.TokenType]string, tt chroma.TokenType) string {
 }
 
 // <<< END
+
+const (
+	DEFAULT_CODE_THEME      = "github"
+	DEFAULT_DARK_CODE_THEME = "catppuccin-mocha"
+)
+
+// codeThemes are the names of the chroma styles code is highlighted with, in the light and
+// dark themes
+type codeThemes struct {
+	light, dark string
+}
+
+// ValidateCodeTheme checks that name is a style code can be highlighted with, like "monokai".
+// The styles are listed at https://xyproto.github.io/splash/docs/.
+func ValidateCodeTheme(name string) error {
+	if _, ok := styles.Registry[name]; !ok {
+		return fmt.Errorf("code theme %#v not found", name)
+	}
+	return nil
+}
+
+var mdCodeBlockRegex = regexp.MustCompile(`(?s)<pre><code class="language-([^"]+)">(.*?)</code></pre>`)
+
+// highlightMarkdown highlights the code blocks of rendered markdown which name a known
+// language. Like code shapes, each is written once for the light theme and once for the dark,
+// and the theme's CSS shows one of them.
+func highlightMarkdown(render string, themes codeThemes) (string, error) {
+	var b strings.Builder
+	last := 0
+	for _, match := range mdCodeBlockRegex.FindAllStringSubmatchIndex(render, -1) {
+		lang, code := render[match[2]:match[3]], html.UnescapeString(render[match[4]:match[5]])
+		lexer := lexers.Get(lang)
+		if lexer == nil {
+			continue
+		}
+		b.WriteString(render[last:match[0]])
+		last = match[1]
+		for _, theme := range []struct{ name, class string }{{themes.light, "light-code"}, {themes.dark, "dark-code"}} {
+			style := styles.Get(theme.name)
+			iterator, err := lexer.Tokenise(nil, code)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, `<pre class="%s" style="background-color:%s"><code class="language-%s">`,
+				theme.class, style.Get(chroma.Background).Background.String(), html.EscapeString(lang),
+			)
+			for _, token := range iterator.Tokens() {
+				text := html.EscapeString(token.Value)
+				if css := chromaHtml.StyleEntryToCSS(style.Get(token.Type)); css != "" {
+					text = fmt.Sprintf(`<span style="%s">%s</span>`, css, text)
+				}
+				b.WriteString(text)
+			}
+			b.WriteString("</code></pre>")
+		}
+	}
+	b.WriteString(render[last:])
+	return b.String(), nil
+}
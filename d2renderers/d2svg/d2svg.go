@@ -5,6 +5,7 @@ package d2svg
 import (
 	"bytes"
 	_ "embed"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"hash/fnv"
@@ -20,6 +21,8 @@ import (
 	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
 
+	"oss.terrastruct.com/util-go/go2"
+
 	"oss.terrastruct.com/d2/d2graph"
 	"oss.terrastruct.com/d2/d2renderers/d2fonts"
 	"oss.terrastruct.com/d2/d2renderers/d2latex"
@@ -27,6 +30,7 @@ import (
 	"oss.terrastruct.com/d2/d2target"
 	"oss.terrastruct.com/d2/d2themes"
 	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/arrowhead"
 	"oss.terrastruct.com/d2/lib/color"
 	"oss.terrastruct.com/d2/lib/geo"
 	"oss.terrastruct.com/d2/lib/label"
@@ -68,6 +72,9 @@ var grain string
 //go:embed paper.txt
 var paper string
 
+//go:embed hatch.txt
+var hatch string
+
 type RenderOpts struct {
 	Pad                *int64
 	Sketch             *bool
@@ -79,6 +86,23 @@ type RenderOpts struct {
 	Font               string
 	// the svg will be scaled by this factor, if unset the svg will fit to screen
 	Scale *float64
+	// Quantize rounds the coordinates of the rendered elements to multiples of it, e.g. 1 for
+	// integers, so that rerenders of a barely changed layout give small diffs. It must pass
+	// ValidateQuantize.
+	Quantize *float64
+	// EdgeJumps draws a hop where a straight connection crosses one drawn before it
+	EdgeJumps *bool
+	// CodeTheme and DarkCodeTheme are the chroma styles code shapes and the code blocks of
+	// markdown are highlighted with, DEFAULT_CODE_THEME and DEFAULT_DARK_CODE_THEME if unset.
+	// They must pass ValidateCodeTheme.
+	CodeTheme     string
+	DarkCodeTheme string
+	// HiddenLayerGroups are the layer groups drawn hidden. Like the others, their elements are
+	// still in the SVG, so viewers can toggle them on.
+	HiddenLayerGroups []string
+	// SourceMap sets data-d2-loc attributes, like data-d2-loc="x.d2:3:1", on the elements of
+	// the shapes and connections to where they're declared in the input, see SourceMap
+	SourceMap bool
 
 	// MasterID is passed when the diagram should use something other than its own hash for unique targeting
 	// Currently, that's when multi-boards are collapsed
@@ -109,185 +133,20 @@ func arrowheadMarkerID(isTarget bool, connection d2target.Connection) string {
 }
 
 func arrowheadMarker(isTarget bool, id string, connection d2target.Connection) string {
-	arrowhead := connection.DstArrow
+	head := connection.DstArrow
 	if !isTarget {
-		arrowhead = connection.SrcArrow
+		head = connection.SrcArrow
 	}
 	strokeWidth := float64(connection.StrokeWidth)
-	width, height := arrowhead.Dimensions(strokeWidth)
+	width, height := head.Dimensions(strokeWidth)
 
 	var path string
-	switch arrowhead {
-	case d2target.ArrowArrowhead:
-		polygonEl := d2themes.NewThemableElement("polygon")
-		polygonEl.Fill = connection.Stroke
-		polygonEl.ClassName = "connection"
-		polygonEl.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
-
-		if isTarget {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f %f,%f",
-				0., 0.,
-				width, height/2,
-				0., height,
-				width/4, height/2,
-			)
-		} else {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f %f,%f",
-				0., height/2,
-				width, 0.,
-				width*3/4, height/2,
-				width, height,
-			)
-		}
-		path = polygonEl.Render()
-	case d2target.UnfilledTriangleArrowhead:
-		polygonEl := d2themes.NewThemableElement("polygon")
-		polygonEl.Fill = d2target.BG_COLOR
-		polygonEl.Stroke = connection.Stroke
-		polygonEl.ClassName = "connection"
-		polygonEl.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
-
-		inset := strokeWidth / 2
-		if isTarget {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f",
-				inset, inset,
-				width-inset, height/2.0,
-				inset, height-inset,
-			)
-		} else {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f",
-				width-inset, inset,
-				inset, height/2.0,
-				width-inset, height-inset,
-			)
-		}
-		path = polygonEl.Render()
-
-	case d2target.TriangleArrowhead:
-		polygonEl := d2themes.NewThemableElement("polygon")
-		polygonEl.Fill = connection.Stroke
-		polygonEl.ClassName = "connection"
-		polygonEl.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
-
-		if isTarget {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f",
-				0., 0.,
-				width, height/2.0,
-				0., height,
-			)
-		} else {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f",
-				width, 0.,
-				0., height/2.0,
-				width, height,
-			)
-		}
-		path = polygonEl.Render()
-	case d2target.LineArrowhead:
-		polylineEl := d2themes.NewThemableElement("polyline")
-		polylineEl.Fill = color.None
-		polylineEl.ClassName = "connection"
-		polylineEl.Stroke = connection.Stroke
-		polylineEl.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
-
-		if isTarget {
-			polylineEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f",
-				strokeWidth/2, strokeWidth/2,
-				width-strokeWidth/2, height/2,
-				strokeWidth/2, height-strokeWidth/2,
-			)
-		} else {
-			polylineEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f",
-				width-strokeWidth/2, strokeWidth/2,
-				strokeWidth/2, height/2,
-				width-strokeWidth/2, height-strokeWidth/2,
-			)
-		}
-		path = polylineEl.Render()
-	case d2target.FilledDiamondArrowhead:
-		polygonEl := d2themes.NewThemableElement("polygon")
-		polygonEl.ClassName = "connection"
-		polygonEl.Fill = connection.Stroke
-		polygonEl.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
-
-		if isTarget {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f %f,%f",
-				0., height/2.0,
-				width/2.0, 0.,
-				width, height/2.0,
-				width/2.0, height,
-			)
-		} else {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f %f,%f",
-				0., height/2.0,
-				width/2.0, 0.,
-				width, height/2.0,
-				width/2.0, height,
-			)
-		}
-		path = polygonEl.Render()
-	case d2target.DiamondArrowhead:
-		polygonEl := d2themes.NewThemableElement("polygon")
-		polygonEl.ClassName = "connection"
-		polygonEl.Fill = d2target.BG_COLOR
-		polygonEl.Stroke = connection.Stroke
-		polygonEl.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
-
-		if isTarget {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f %f,%f",
-				0., height/2.0,
-				width/2, height/8,
-				width, height/2.0,
-				width/2.0, height*0.9,
-			)
-		} else {
-			polygonEl.Points = fmt.Sprintf("%f,%f %f,%f %f,%f %f,%f",
-				width/8, height/2.0,
-				width*0.6, height/8,
-				width*1.1, height/2.0,
-				width*0.6, height*7/8,
-			)
-		}
-		path = polygonEl.Render()
-	case d2target.FilledCircleArrowhead:
-		radius := width / 2
-
-		circleEl := d2themes.NewThemableElement("circle")
-		circleEl.Cy = radius
-		circleEl.R = radius - strokeWidth/2
-		circleEl.Fill = connection.Stroke
-		circleEl.ClassName = "connection"
-		circleEl.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
-
-		if isTarget {
-			circleEl.Cx = radius + strokeWidth/2
-		} else {
-			circleEl.Cx = radius - strokeWidth/2
-		}
-
-		path = circleEl.Render()
-	case d2target.CircleArrowhead:
-		radius := width / 2
-
-		circleEl := d2themes.NewThemableElement("circle")
-		circleEl.Cy = radius
-		circleEl.R = radius - strokeWidth
-		circleEl.Fill = d2target.BG_COLOR
-		circleEl.Stroke = connection.Stroke
-		circleEl.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
-
-		if isTarget {
-			circleEl.Cx = radius + strokeWidth/2
-		} else {
-			circleEl.Cx = radius - strokeWidth/2
-		}
-
-		path = circleEl.Render()
+	switch head {
 	case d2target.CfOne, d2target.CfMany, d2target.CfOneRequired, d2target.CfManyRequired:
 		offset := 3.0 + float64(connection.StrokeWidth)*1.8
 
 		var modifierEl *d2themes.ThemableElement
-		if arrowhead == d2target.CfOneRequired || arrowhead == d2target.CfManyRequired {
+		if head == d2target.CfOneRequired || head == d2target.CfManyRequired {
 			modifierEl = d2themes.NewThemableElement("path")
 			modifierEl.D = fmt.Sprintf("M%f,%f %f,%f",
 				offset, 0.,
@@ -309,7 +168,7 @@ func arrowheadMarker(isTarget bool, id string, connection d2target.Connection) s
 		}
 
 		childPathEl := d2themes.NewThemableElement("path")
-		if arrowhead == d2target.CfMany || arrowhead == d2target.CfManyRequired {
+		if head == d2target.CfMany || head == d2target.CfManyRequired {
 			childPathEl.D = fmt.Sprintf("M%f,%f %f,%f M%f,%f %f,%f M%f,%f %f,%f",
 				width-3.0, height/2.0,
 				width+offset, height/2.0,
@@ -340,25 +199,47 @@ func arrowheadMarker(isTarget bool, id string, connection d2target.Connection) s
 		)
 		path = gEl.Render()
 	default:
-		return ""
+		outline := arrowhead.GetOutline(head, isTarget, strokeWidth)
+		if outline == nil {
+			return ""
+		}
+		var el *d2themes.ThemableElement
+		switch {
+		case outline.Points == nil:
+			el = d2themes.NewThemableElement("circle")
+			el.Cx = outline.Center.X
+			el.Cy = outline.Center.Y
+			el.R = outline.Radius
+		case outline.Open:
+			el = d2themes.NewThemableElement("polyline")
+			el.Points = pointsAttr(outline.Points)
+		default:
+			el = d2themes.NewThemableElement("polygon")
+			el.Points = pointsAttr(outline.Points)
+		}
+		switch {
+		case outline.Filled:
+			el.Fill = connection.Stroke
+		case outline.Open:
+			el.Fill = color.None
+			el.Stroke = connection.Stroke
+		default:
+			el.Fill = d2target.BG_COLOR
+			el.Stroke = connection.Stroke
+		}
+		// Unfilled circles have always been drawn without the connection class
+		if head != d2target.CircleArrowhead {
+			el.ClassName = "connection"
+		}
+		el.Attributes = fmt.Sprintf(`stroke-width="%d"`, connection.StrokeWidth)
+		path = el.Render()
 	}
 
-	var refX float64
-	refY := height / 2
-	switch arrowhead {
-	case d2target.DiamondArrowhead:
-		if isTarget {
-			refX = width - 0.6*strokeWidth
-		} else {
-			refX = width/8 + 0.6*strokeWidth
-		}
+	ref := arrowhead.Ref(head, isTarget, strokeWidth)
+	refX, refY := ref.X, ref.Y
+	if head == d2target.DiamondArrowhead {
+		// The source diamond is drawn past the width of its box
 		width *= 1.1
-	default:
-		if isTarget {
-			refX = width - 1.5*strokeWidth
-		} else {
-			refX = 1.5 * strokeWidth
-		}
 	}
 
 	return strings.Join([]string{
@@ -372,15 +253,13 @@ func arrowheadMarker(isTarget bool, id string, connection d2target.Connection) s
 	}, " ")
 }
 
-// compute the (dx, dy) adjustment to apply to get the arrowhead-adjusted end point
-func arrowheadAdjustment(start, end *geo.Point, arrowhead d2target.Arrowhead, edgeStrokeWidth, shapeStrokeWidth int) *geo.Point {
-	distance := (float64(edgeStrokeWidth) + float64(shapeStrokeWidth)) / 2.0
-	if arrowhead != d2target.NoArrowhead {
-		distance += float64(edgeStrokeWidth)
+// pointsAttr returns the points attribute of a polygon or polyline through points
+func pointsAttr(points []*geo.Point) string {
+	var coords []string
+	for _, p := range points {
+		coords = append(coords, fmt.Sprintf("%f,%f", p.X, p.Y))
 	}
-
-	v := geo.NewVector(end.X-start.X, end.Y-start.Y)
-	return v.Unit().Multiply(-distance).ToPoint()
+	return strings.Join(coords, " ")
 }
 
 func getArrowheadAdjustments(connection d2target.Connection, idToShape map[string]d2target.Shape) (srcAdj, dstAdj *geo.Point) {
@@ -388,14 +267,16 @@ func getArrowheadAdjustments(connection d2target.Connection, idToShape map[strin
 	srcShape := idToShape[connection.Src]
 	dstShape := idToShape[connection.Dst]
 
-	sourceAdjustment := arrowheadAdjustment(route[1], route[0], connection.SrcArrow, connection.StrokeWidth, srcShape.StrokeWidth)
+	sourceAdjustment := arrowhead.Adjustment(route[1], route[0], connection.SrcArrow, connection.StrokeWidth, srcShape.StrokeWidth)
 
-	targetAdjustment := arrowheadAdjustment(route[len(route)-2], route[len(route)-1], connection.DstArrow, connection.StrokeWidth, dstShape.StrokeWidth)
+	targetAdjustment := arrowhead.Adjustment(route[len(route)-2], route[len(route)-1], connection.DstArrow, connection.StrokeWidth, dstShape.StrokeWidth)
 	return sourceAdjustment, targetAdjustment
 }
 
 // returns the path's d attribute for the given connection
-func pathData(connection d2target.Connection, srcAdj, dstAdj *geo.Point) string {
+// pathData returns the path of connection. jumps are the points where each segment of a
+// straight route hops over other connections, see edgeJumps.
+func pathData(connection d2target.Connection, srcAdj, dstAdj *geo.Point, jumps [][]*geo.Point) string {
 	var path []string
 	route := connection.Route
 
@@ -436,6 +317,9 @@ func pathData(connection d2target.Connection, srcAdj, dstAdj *geo.Point) string
 			prevTranslations := prevVector.Unit().Multiply(units).ToPoint()
 			currTranslations := currVector.Unit().Multiply(units).ToPoint()
 
+			if jumps != nil {
+				path = append(path, jumpPathData(prevSource, prevTarget, jumps[i-1])...)
+			}
 			path = append(path, fmt.Sprintf("L %f %f",
 				prevTarget.X-prevTranslations.X,
 				prevTarget.Y-prevTranslations.Y,
@@ -472,6 +356,9 @@ func pathData(connection d2target.Connection, srcAdj, dstAdj *geo.Point) string
 		}
 
 		lastPoint := route[len(route)-1]
+		if jumps != nil {
+			path = append(path, jumpPathData(route[len(route)-2], lastPoint, jumps[len(route)-2])...)
+		}
 		path = append(path, fmt.Sprintf("L %f %f",
 			lastPoint.X+dstAdj.X,
 			lastPoint.Y+dstAdj.Y,
@@ -494,7 +381,7 @@ func makeLabelMask(labelTL *geo.Point, width, height int, opacity float64) strin
 	)
 }
 
-func drawConnection(writer io.Writer, labelMaskID string, connection d2target.Connection, markers map[string]struct{}, idToShape map[string]d2target.Shape, sketchRunner *d2sketch.Runner) (labelMask string, _ error) {
+func drawConnection(writer io.Writer, labelMaskID string, connection d2target.Connection, markers map[string]struct{}, idToShape map[string]d2target.Shape, jumps [][]*geo.Point, sketchRunner *d2sketch.Runner) (labelMask string, _ error) {
 	opacityStyle := ""
 	if connection.Opacity != 1.0 {
 		opacityStyle = fmt.Sprintf(" style='opacity:%f'", connection.Opacity)
@@ -504,7 +391,7 @@ func drawConnection(writer io.Writer, labelMaskID string, connection d2target.Co
 	if len(connection.Classes) > 0 {
 		classStr = fmt.Sprintf(` class="%s"`, strings.Join(connection.Classes, " "))
 	}
-	fmt.Fprintf(writer, `<g id="%s"%s%s>`, svg.EscapeText(connection.ID), opacityStyle, classStr)
+	fmt.Fprintf(writer, `<g id="%s"%s%s%s>`, svg.EscapeText(connection.ID), opacityStyle, classStr, sourceLocAttr(connection.Range))
 	var markerStart string
 	if connection.SrcArrow != d2target.NoArrowhead {
 		id := arrowheadMarkerID(false, connection)
@@ -547,7 +434,7 @@ func drawConnection(writer io.Writer, labelMaskID string, connection d2target.Co
 	}
 
 	srcAdj, dstAdj := getArrowheadAdjustments(connection, idToShape)
-	path := pathData(connection, srcAdj, dstAdj)
+	path := pathData(connection, srcAdj, dstAdj, jumps)
 	mask := fmt.Sprintf(`mask="url(#%s)"`, labelMaskID)
 
 	if sketchRunner != nil {
@@ -629,14 +516,53 @@ func drawConnection(writer io.Writer, labelMaskID string, connection d2target.Co
 			fmt.Fprint(writer, rectEl.Render())
 		}
 
-		textEl := d2themes.NewThemableElement("text")
-		textEl.X = labelTL.X + float64(connection.LabelWidth)/2
-		textEl.Y = labelTL.Y + float64(connection.FontSize)
-		textEl.Fill = connection.GetFontColor()
-		textEl.ClassName = fontClass
-		textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "middle", connection.FontSize)
-		textEl.Content = RenderText(connection.Label, textEl.X, float64(connection.LabelHeight))
-		fmt.Fprint(writer, textEl.Render())
+		// The icon goes before the text, which has the rest of the label's space
+		text := connection.Text
+		textTL := labelTL.Copy()
+		if connection.Icon != nil {
+			fmt.Fprintf(writer, `<image href="%s" x="%f" y="%f" width="%d" height="%d" />`,
+				html.EscapeString(connection.Icon.String()),
+				labelTL.X, labelTL.Y+float64(connection.LabelHeight-d2target.CONNECTION_ICON_SIZE)/2,
+				d2target.CONNECTION_ICON_SIZE, d2target.CONNECTION_ICON_SIZE,
+			)
+			textTL.X += d2target.CONNECTION_ICON_SIZE + d2target.CONNECTION_ICON_GAP
+			text.LabelWidth -= d2target.CONNECTION_ICON_SIZE + d2target.CONNECTION_ICON_GAP
+		}
+
+		if connection.Language == "markdown" {
+			render, err := textmeasure.RenderMarkdown(connection.Label)
+			if err != nil {
+				return "", err
+			}
+			// we need the self closing form in this svg/xhtml context
+			render = strings.ReplaceAll(render, "<hr>", "<hr />")
+			fmt.Fprintf(writer, `<g><foreignObject requiredFeatures="http://www.w3.org/TR/SVG11/feature#Extensibility" x="%f" y="%f" width="%d" height="%d">`,
+				textTL.X, textTL.Y, text.LabelWidth, text.LabelHeight,
+			)
+			mdEl := d2themes.NewThemableElement("div")
+			mdEl.ClassName = "md"
+			mdEl.Content = render
+			var styles []string
+			if connection.FontSize != textmeasure.MarkdownFontSize {
+				styles = append(styles, fmt.Sprintf("font-size:%vpx", connection.FontSize))
+			}
+			if !color.IsThemeColor(connection.GetFontColor()) {
+				styles = append(styles, fmt.Sprintf(`color:%s`, connection.GetFontColor()))
+			}
+			mdEl.Style = strings.Join(styles, ";")
+			fmt.Fprint(writer, mdEl.Render())
+			fmt.Fprint(writer, `</foreignObject></g>`)
+		} else {
+			textEl := d2themes.NewThemableElement("text")
+			var anchor string
+			textEl.X, anchor = alignText(text, textTL.X)
+			textEl.Y = textTL.Y + float64(connection.FontSize)
+			textEl.Fill = connection.GetFontColor()
+			textEl.ClassName = fontClass
+			textEl.Style = fmt.Sprintf("%s;font-size:%vpx", anchor, connection.FontSize)
+			textEl.Content = RenderText(connection.Label, textEl.X, float64(connection.LabelHeight))
+			fmt.Fprint(writer, textEl.Render())
+		}
 	}
 
 	if connection.SrcLabel != nil && connection.SrcLabel.Label != "" {
@@ -704,6 +630,15 @@ func renderDoubleOval(tl *geo.Point, width, height float64, fill, fillStroke, st
 	return renderOval(tl, width, height, fill, fillStroke, stroke, style) + renderOval(innerTL, width-10, height-10, fill, "", stroke, style)
 }
 
+// innerDiamondBox is the box of the inner border of a double bordered diamond, which is
+// INNER_BORDER_OFFSET inside the outer one along all its sides
+func innerDiamondBox(tl *geo.Point, width, height float64) *geo.Box {
+	a, b := width/2, height/2
+	scale := 1 - d2target.INNER_BORDER_OFFSET*math.Hypot(a, b)/(a*b)
+	innerWidth, innerHeight := width*scale, height*scale
+	return geo.NewBox(tl.AddVector(geo.NewVector((width-innerWidth)/2, (height-innerHeight)/2)), innerWidth, innerHeight)
+}
+
 func defineShadowFilter(writer io.Writer) {
 	fmt.Fprint(writer, `<defs>
 	<filter id="shadow-filter" width="200%" height="200%" x="-50%" y="-50%">
@@ -937,7 +872,7 @@ func render3DHexagon(targetShape d2target.Shape) string {
 	return borderMask + mainShapeRendered + renderedSides + renderedBorder
 }
 
-func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape d2target.Shape, sketchRunner *d2sketch.Runner) (labelMask string, err error) {
+func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape d2target.Shape, sketchRunner *d2sketch.Runner, themes codeThemes, boardPreview []byte) (labelMask string, err error) {
 	closingTag := "</g>"
 	if targetShape.Link != "" {
 
@@ -958,7 +893,7 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 	if len(targetShape.Classes) > 0 {
 		classStr = fmt.Sprintf(` class="%s"`, strings.Join(targetShape.Classes, " "))
 	}
-	fmt.Fprintf(writer, `<g id="%s"%s%s>`, svg.EscapeText(targetShape.ID), opacityStyle, classStr)
+	fmt.Fprintf(writer, `<g id="%s"%s%s%s>`, svg.EscapeText(targetShape.ID), opacityStyle, classStr, sourceLocAttr(targetShape.Range))
 	tl := geo.NewPoint(float64(targetShape.Pos.X), float64(targetShape.Pos.Y))
 	width := float64(targetShape.Width)
 	height := float64(targetShape.Height)
@@ -970,6 +905,9 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 	if shapeType == shape.CLOUD_TYPE && targetShape.ContentAspectRatio != nil {
 		s.SetInnerBoxAspectRatio(*targetShape.ContentAspectRatio)
 	}
+	if targetShape.CustomShape != nil {
+		s.SetCustomDefinition(targetShape.CustomShape)
+	}
 
 	var shadowAttr string
 	if targetShape.Shadow {
@@ -1065,6 +1003,29 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 		el.Style = style
 		fmt.Fprint(writer, el.Render())
 
+	case d2target.ShapeBoard:
+		el := d2themes.NewThemableElement("rect")
+		el.X = float64(targetShape.Pos.X)
+		el.Y = float64(targetShape.Pos.Y)
+		el.Width = float64(targetShape.Width)
+		el.Height = float64(targetShape.Height)
+		el.Fill = fill
+		el.FillPattern = targetShape.FillPattern
+		el.Stroke = stroke
+		el.Style = style
+		el.Rx = float64(targetShape.BorderRadius)
+		fmt.Fprint(writer, el.Render())
+		drawBoardPreview(writer, targetShape, boardPreview)
+
+	case d2target.ShapeCustom:
+		if targetShape.CustomShape == nil {
+			break
+		}
+		// The SVG is drawn as it is, stretched to the box
+		fmt.Fprintf(writer, `<image href="data:image/svg+xml;base64,%s" x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="none" %s/>`,
+			base64.StdEncoding.EncodeToString([]byte(targetShape.CustomShape.SVG)),
+			targetShape.Pos.X, targetShape.Pos.Y, targetShape.Width, targetShape.Height, shadowAttr)
+
 	// TODO should standardize "" to rectangle
 	case d2target.ShapeRectangle, d2target.ShapeSequenceDiagram, d2target.ShapeHierarchy, "":
 		borderRadius := math.MaxFloat64
@@ -1199,8 +1160,12 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 		}
 	case d2target.ShapeText, d2target.ShapeCode:
 	default:
+		doubleDiamond := targetShape.DoubleBorder && targetShape.Type == d2target.ShapeDiamond
 		if targetShape.Multiple {
 			multiplePathData := shape.NewShape(shapeType, geo.NewBox(multipleTL, width, height)).GetSVGPathData()
+			if doubleDiamond {
+				multiplePathData = append(multiplePathData, shape.NewShape(shapeType, innerDiamondBox(multipleTL, width, height)).GetSVGPathData()...)
+			}
 			el := d2themes.NewThemableElement("path")
 			el.Fill = fill
 			el.Stroke = stroke
@@ -1228,6 +1193,39 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 				fmt.Fprint(writer, el.Render())
 			}
 		}
+
+		if doubleDiamond {
+			innerPathData := shape.NewShape(shapeType, innerDiamondBox(tl, width, height)).GetSVGPathData()
+			if sketchRunner != nil {
+				inner := targetShape
+				// No need for inner to double paint
+				inner.Fill = "transparent"
+				inner.FillPattern = ""
+				out, err := d2sketch.Paths(sketchRunner, inner, innerPathData)
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprint(writer, out)
+			} else {
+				el := d2themes.NewThemableElement("path")
+				el.Fill = "transparent"
+				el.Stroke = stroke
+				el.Style = style
+				for _, pathData := range innerPathData {
+					el.D = pathData
+					fmt.Fprint(writer, el.Render())
+				}
+			}
+		}
+	}
+
+	if header := headerPathData(targetShape); header != "" {
+		el := d2themes.NewThemableElement("path")
+		el.D = header
+		el.Fill = stroke
+		el.Stroke = stroke
+		el.Style = style
+		fmt.Fprint(writer, el.Render())
 	}
 
 	// // to examine shape's innerBox
@@ -1307,17 +1305,21 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 
 		if targetShape.Type == d2target.ShapeCode {
 			lexer := lexers.Get(targetShape.Language)
+			if lexer == nil {
+				// Unknown languages are guessed from the code
+				lexer = lexers.Analyse(targetShape.Label)
+			}
 			if lexer == nil {
 				lexer = lexers.Fallback
 			}
 			for _, isLight := range []bool{true, false} {
-				theme := "github"
+				theme := themes.light
 				if !isLight {
-					theme = "catppuccin-mocha"
+					theme = themes.dark
 				}
 				style := styles.Get(theme)
 				if style == nil {
-					return labelMask, errors.New(`code snippet style "github" not found`)
+					return labelMask, fmt.Errorf("code snippet style %#v not found", theme)
 				}
 				formatter := formatters.Get("svg")
 				if formatter == nil {
@@ -1352,10 +1354,29 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 				fmt.Fprint(writer, rectEl.Render())
 				// Padding = 0.5em
 				padding := float64(targetShape.FontSize) / 2.
-				fmt.Fprintf(writer, `<g transform="translate(%f %f)">`, padding, padding)
-
 				lineHeight := textmeasure.CODE_LINE_HEIGHT
+				// Highlighted lines span the shape inside its border
+				inset := float64(targetShape.StrokeWidth) / 2.
+				for _, line := range targetShape.HighlightLines {
+					fmt.Fprintf(writer, `<rect x="%f" y="%f" width="%f" height="%f" fill="%s" />`,
+						inset, padding+float64(line-1)*lineHeight*float64(targetShape.FontSize),
+						float64(targetShape.Width)-2*inset, lineHeight*float64(targetShape.FontSize),
+						style.Get(chroma.LineHighlight).Background.String(),
+					)
+				}
+				gutter := 0.
+				if targetShape.LineNumbers {
+					gutter = float64(d2target.CodeGutterWidth(targetShape.Label, targetShape.FontSize))
+				}
+				fmt.Fprintf(writer, `<g transform="translate(%f %f)">`, padding+gutter, padding)
+
 				for index, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+					if targetShape.LineNumbers {
+						// Right-aligned, a space from the code
+						fmt.Fprintf(writer, `<text class="text-mono" x="-%fem" y="%fem" text-anchor="end" %s>%d</text>`,
+							d2target.CODE_DIGIT_WIDTH, 1+float64(index)*lineHeight, svgStyles[chroma.LineNumbers], index+1,
+						)
+					}
 					fmt.Fprintf(writer, "<text class=\"text-mono\" x=\"0\" y=\"%fem\">", 1+float64(index)*lineHeight)
 					for _, token := range tokens {
 						text := svgEscaper.Replace(token.String())
@@ -1370,7 +1391,7 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 				fmt.Fprint(writer, "</g></g>")
 			}
 		} else if targetShape.Type == d2target.ShapeText && targetShape.Language == "latex" {
-			render, err := d2latex.Render(targetShape.Label)
+			render, err := d2latex.Render(targetShape.Label, targetShape.LatexScale)
 			if err != nil {
 				return labelMask, err
 			}
@@ -1384,6 +1405,10 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 			if err != nil {
 				return labelMask, err
 			}
+			render, err = highlightMarkdown(render, themes)
+			if err != nil {
+				return labelMask, err
+			}
 			fmt.Fprintf(writer, `<g><foreignObject requiredFeatures="http://www.w3.org/TR/SVG11/feature#Extensibility" x="%f" y="%f" width="%d" height="%d">`,
 				box.TopLeft.X, box.TopLeft.Y, targetShape.Width, targetShape.Height,
 			)
@@ -1422,12 +1447,13 @@ func drawShape(writer, appendixWriter io.Writer, diagramHash string, targetShape
 				fmt.Fprint(writer, rectEl.Render())
 			}
 			textEl := d2themes.NewThemableElement("text")
-			textEl.X = labelTL.X + float64(targetShape.LabelWidth)/2
+			var anchor string
+			textEl.X, anchor = alignText(targetShape.Text, labelTL.X)
 			// text is vertically positioned at its baseline which is at labelTL+FontSize
 			textEl.Y = labelTL.Y + float64(targetShape.FontSize)
 			textEl.Fill = targetShape.GetFontColor()
 			textEl.ClassName = fontClass
-			textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "middle", targetShape.FontSize)
+			textEl.Style = fmt.Sprintf("%s;font-size:%vpx", anchor, targetShape.FontSize)
 			textEl.Content = RenderText(targetShape.Label, textEl.X, float64(targetShape.LabelHeight))
 			fmt.Fprint(writer, textEl.Render())
 			if targetShape.Blend {
@@ -1458,14 +1484,15 @@ func addAppendixItems(writer io.Writer, targetShape d2target.Shape, s shape.Shap
 		offset := geo.Vector{-2 * appendixIconRadius, 0}
 		var leftOnShape bool
 		switch s.GetType() {
-		case shape.STEP_TYPE, shape.HEXAGON_TYPE, shape.QUEUE_TYPE, shape.PAGE_TYPE:
+		case shape.STEP_TYPE, shape.HEXAGON_TYPE, shape.QUEUE_TYPE, shape.PAGE_TYPE, shape.NOTE_TYPE:
 			// trace straight left for these
 			center.Y = float64(targetShape.Pos.Y)
 		case shape.PACKAGE_TYPE:
 			// trace straight down
 			center.X = float64(targetShape.Pos.X + targetShape.Width)
 		case shape.CIRCLE_TYPE, shape.OVAL_TYPE, shape.DIAMOND_TYPE,
-			shape.PERSON_TYPE, shape.CLOUD_TYPE, shape.CYLINDER_TYPE:
+			shape.PERSON_TYPE, shape.CLOUD_TYPE, shape.CYLINDER_TYPE,
+			shape.TRIANGLE_TYPE, shape.CROSS_TYPE:
 			if bothIcons {
 				leftOnShape = true
 				corner = corner.AddVector(offset)
@@ -1509,6 +1536,35 @@ func addAppendixItems(writer io.Writer, targetShape d2target.Shape, s shape.Shap
 	}
 }
 
+// alignText returns the x of the lines of a label whose box starts at left, and the style which
+// anchors them there. Labels which read right to left, set by text-direction or else detected
+// from their first letter, are anchored from their right, so they start and end at the other
+// sides.
+func alignText(t d2target.Text, left float64) (x float64, style string) {
+	rtl := textmeasure.IsRTL(t.Label)
+	if t.TextDirection != "" {
+		rtl = t.TextDirection == "rtl"
+	}
+	x, anchor := left+float64(t.LabelWidth)/2, "middle"
+	switch t.TextAlign {
+	case "left":
+		x, anchor = left, "start"
+		if rtl {
+			anchor = "end"
+		}
+	case "right":
+		x, anchor = left+float64(t.LabelWidth), "end"
+		if rtl {
+			anchor = "start"
+		}
+	}
+	style = "text-anchor:" + anchor
+	if rtl {
+		style += ";direction:rtl"
+	}
+	return x, style
+}
+
 func RenderText(text string, x, height float64) string {
 	if !strings.Contains(text, "\n") {
 		return svg.EscapeText(text)
@@ -1531,11 +1587,19 @@ func RenderText(text string, x, height float64) string {
 }
 
 func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fonts.FontFamily, corpus string) {
+	embedFonts(buf, diagramHash, func(trigger string) bool {
+		return strings.Contains(source, trigger)
+	}, fontFamily, corpus)
+}
+
+// embedFonts takes a function to search the source for triggers, so that the source
+// doesn't have to be copied into a string
+func embedFonts(buf io.Writer, diagramHash string, contains func(string) bool, fontFamily *d2fonts.FontFamily, corpus string) {
 	fmt.Fprint(buf, `<style type="text/css"><![CDATA[`)
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`class="text"`,
 			`class="text `,
@@ -1558,7 +1622,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{`class="md"`},
 		fmt.Sprintf(`
 @font-face {
@@ -1572,7 +1636,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`text-underline`,
 		},
@@ -1584,7 +1648,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`animated-connection`,
 		},
@@ -1599,7 +1663,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`appendix-icon`,
 		},
@@ -1611,7 +1675,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`class="text-bold`,
 			`<b>`,
@@ -1634,7 +1698,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`class="text-italic`,
 			`<em>`,
@@ -1657,7 +1721,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`class="text-mono`,
 			`<pre>`,
@@ -1682,7 +1746,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`class="text-mono-bold`,
 		},
@@ -1703,7 +1767,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`class="text-mono-italic`,
 		},
@@ -1724,7 +1788,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`sketch-overlay-bright`,
 		},
@@ -1737,7 +1801,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`sketch-overlay-normal`,
 		},
@@ -1750,7 +1814,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`sketch-overlay-dark`,
 		},
@@ -1763,7 +1827,7 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 
 	appendOnTrigger(
 		buf,
-		source,
+		contains,
 		[]string{
 			`sketch-overlay-darker`,
 		},
@@ -1777,9 +1841,9 @@ func EmbedFonts(buf *bytes.Buffer, diagramHash, source string, fontFamily *d2fon
 	fmt.Fprint(buf, `]]></style>`)
 }
 
-func appendOnTrigger(buf *bytes.Buffer, source string, triggers []string, newContent string) {
+func appendOnTrigger(buf io.Writer, contains func(string) bool, triggers []string, newContent string) {
 	for _, trigger := range triggers {
-		if strings.Contains(source, trigger) {
+		if contains(trigger) {
 			fmt.Fprint(buf, newContent)
 			break
 		}
@@ -1789,11 +1853,26 @@ func appendOnTrigger(buf *bytes.Buffer, source string, triggers []string, newCon
 var DEFAULT_DARK_THEME *int64 = nil // no theme selected
 
 func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := RenderTo(buf, diagram, opts)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderTo is like Render but writes the SVG to out as it's assembled, instead of building
+// the whole document in memory. The shapes and connections are held once, as the styles and
+// definitions written before them depend on what they use, and are then written out without
+// being copied.
+// Part of the SVG may have been written to out when an error is returned.
+func RenderTo(out io.Writer, diagram *d2target.Diagram, opts *RenderOpts) error {
 	var sketchRunner *d2sketch.Runner
 	pad := DEFAULT_PADDING
 	themeID := d2themescatalog.NeutralDefault.ID
 	darkThemeID := DEFAULT_DARK_THEME
 	var scale *float64
+	themes := codeThemes{DEFAULT_CODE_THEME, DEFAULT_DARK_CODE_THEME}
 	if opts != nil {
 		if opts.Pad != nil {
 			pad = int(*opts.Pad)
@@ -1802,7 +1881,7 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 			var err error
 			sketchRunner, err = d2sketch.InitSketchVM()
 			if err != nil {
-				return nil, err
+				return err
 			}
 		}
 		if opts.ThemeID != nil {
@@ -1810,6 +1889,18 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 		}
 		darkThemeID = opts.DarkThemeID
 		scale = opts.Scale
+		if opts.CodeTheme != "" {
+			if err := ValidateCodeTheme(opts.CodeTheme); err != nil {
+				return err
+			}
+			themes.light = opts.CodeTheme
+		}
+		if opts.DarkCodeTheme != "" {
+			if err := ValidateCodeTheme(opts.DarkCodeTheme); err != nil {
+				return err
+			}
+			themes.dark = opts.DarkCodeTheme
+		}
 	}
 
 	buf := &bytes.Buffer{}
@@ -1825,7 +1916,7 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 	// Apply hash on IDs for targeting, to be specific for this diagram
 	diagramHash, err := diagram.HashID()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	// Some targeting is still per-board, like masks for connections
 	isolatedDiagramHash := diagramHash
@@ -1849,28 +1940,85 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 
 	appendixItemBuf := &bytes.Buffer{}
 
+	var jumps map[string][][]*geo.Point
+	if opts.EdgeJumps != nil && *opts.EdgeJumps {
+		var connections []d2target.Connection
+		for _, obj := range allObjects {
+			if c, is := obj.(d2target.Connection); is {
+				connections = append(connections, c)
+			}
+		}
+		jumps = edgeJumps(connections)
+	}
+
+	boardPreviews, err := renderBoardPreviews(diagram, opts)
+	if err != nil {
+		return err
+	}
+
 	var labelMasks []string
 	markers := map[string]struct{}{}
-	for _, obj := range allObjects {
+	drawObject := func(obj DiagramObject) error {
 		if c, is := obj.(d2target.Connection); is {
-			labelMask, err := drawConnection(buf, isolatedDiagramHash, c, markers, idToShape, sketchRunner)
+			// obj is a copy, so the diagram keeps its ranges
+			if !opts.SourceMap {
+				c.Range = nil
+			}
+			labelMask, err := drawConnection(buf, isolatedDiagramHash, c, markers, idToShape, jumps[c.ID], sketchRunner)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			if labelMask != "" {
 				labelMasks = append(labelMasks, labelMask)
 			}
 		} else if s, is := obj.(d2target.Shape); is {
-			labelMask, err := drawShape(buf, appendixItemBuf, diagramHash, s, sketchRunner)
+			if !opts.SourceMap {
+				s.Range = nil
+			}
+			labelMask, err := drawShape(buf, appendixItemBuf, diagramHash, s, sketchRunner, themes, boardPreviews[s.ID])
 			if err != nil {
-				return nil, err
+				return err
 			} else if labelMask != "" {
 				labelMasks = append(labelMasks, labelMask)
 			}
 		} else {
-			return nil, fmt.Errorf("unknown object of type %T", obj)
+			return fmt.Errorf("unknown object of type %T", obj)
+		}
+		return nil
+	}
+	// The objects of a layer group are drawn together in a <g> of the group, where the first of
+	// them would be drawn, so that viewers can toggle the group by its ID
+	layerGroups := make(map[string][]DiagramObject)
+	for _, obj := range allObjects {
+		if group := layerGroup(obj); group != "" {
+			layerGroups[group] = append(layerGroups[group], obj)
 		}
 	}
+	for _, obj := range allObjects {
+		group := layerGroup(obj)
+		if group == "" {
+			if err := drawObject(obj); err != nil {
+				return err
+			}
+			continue
+		}
+		groupObjects, ok := layerGroups[group]
+		if !ok {
+			continue
+		}
+		delete(layerGroups, group)
+		var display string
+		if go2.Contains(opts.HiddenLayerGroups, group) {
+			display = ` style="display:none"`
+		}
+		fmt.Fprintf(buf, `<g id="layer-group-%s" class="layer-group" data-layer-group="%s"%s>`, group, group, display)
+		for _, obj := range groupObjects {
+			if err := drawObject(obj); err != nil {
+				return err
+			}
+		}
+		fmt.Fprint(buf, `</g>`)
+	}
 	// add all appendix items afterwards so they are always on top
 	fmt.Fprint(buf, appendixItemBuf)
 
@@ -1887,13 +2035,21 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 		`</mask>`,
 	}, "\n"))
 
+	if opts.Quantize != nil {
+		buf = bytes.NewBuffer(quantize(buf.Bytes(), *opts.Quantize))
+	}
+
+	bodyContains := func(s string) bool {
+		return bytes.Contains(buf.Bytes(), []byte(s))
+	}
+
 	// generate style elements that will be appended to the SVG tag
 	upperBuf := &bytes.Buffer{}
 	if opts.MasterID == "" {
-		EmbedFonts(upperBuf, diagramHash, buf.String(), diagram.FontFamily, diagram.GetCorpus()) // EmbedFonts *must* run before `d2sketch.DefineFillPatterns`, but after all elements are appended to `buf`
+		embedFonts(upperBuf, diagramHash, bodyContains, diagram.FontFamily, diagram.GetCorpus()) // embedFonts *must* run before `d2sketch.DefineFillPatterns`, but after all elements are appended to `buf`
 		themeStylesheet, err := ThemeCSS(diagramHash, &themeID, darkThemeID, opts.ThemeOverrides, opts.DarkThemeOverrides)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		fmt.Fprintf(upperBuf, `<style type="text/css"><![CDATA[%s%s]]></style>`, BaseStylesheet, themeStylesheet)
 
@@ -1904,6 +2060,12 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 				break
 			}
 		}
+		for _, c := range diagram.Connections {
+			if c.Label != "" && c.Language == "markdown" {
+				hasMarkdown = true
+				break
+			}
+		}
 		if hasMarkdown {
 			css := MarkdownCSS
 			css = strings.ReplaceAll(css, ".md", fmt.Sprintf(".%s .md", diagramHash))
@@ -1972,10 +2134,9 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 		h += int(math.Ceil(float64(diagram.Root.StrokeWidth)/2.) * 2.)
 	}
 
-	bufStr := buf.String()
 	patternDefs := ""
 	for _, pattern := range d2graph.FillPatterns {
-		if strings.Contains(bufStr, fmt.Sprintf("%s-overlay", pattern)) || diagram.Root.FillPattern == pattern {
+		if bodyContains(fmt.Sprintf("%s-overlay", pattern)) || diagram.Root.FillPattern == pattern {
 			if patternDefs == "" {
 				fmt.Fprint(upperBuf, `<style type="text/css"><![CDATA[`)
 			}
@@ -1988,6 +2149,8 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 				patternDefs += grain
 			case "paper":
 				patternDefs += paper
+			case "hatch":
+				patternDefs += hatch
 			}
 			fmt.Fprintf(upperBuf, `
 .%s-overlay {
@@ -2003,6 +2166,16 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 		fmt.Fprint(upperBuf, "</defs>")
 	}
 
+	gradientDefs, err := defineGradients(diagram)
+	if err != nil {
+		return err
+	}
+	if gradientDefs != "" {
+		fmt.Fprint(upperBuf, "<defs>")
+		fmt.Fprint(upperBuf, gradientDefs)
+		fmt.Fprint(upperBuf, "</defs>")
+	}
+
 	var dimensions string
 	if scale != nil {
 		dimensions = fmt.Sprintf(` width="%d" height="%d"`,
@@ -2034,8 +2207,14 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 		tag = "svg"
 	}
 
+	backgroundElStr := backgroundEl.Render()
+	if opts.Quantize != nil {
+		backgroundElStr = string(quantize([]byte(backgroundElStr), *opts.Quantize))
+		doubleBorderElStr = string(quantize([]byte(doubleBorderElStr), *opts.Quantize))
+	}
+
 	// TODO minify
-	docRendered := fmt.Sprintf(`%s%s<%s %s class="%s" width="%d" height="%d" viewBox="%d %d %d %d">%s%s%s%s</%s>%s`,
+	_, err = fmt.Fprintf(out, `%s%s<%s %s class="%s" width="%d" height="%d" viewBox="%d %d %d %d">%s%s`,
 		xmlTag,
 		fitToScreenWrapperOpening,
 		tag,
@@ -2043,13 +2222,21 @@ func Render(diagram *d2target.Diagram, opts *RenderOpts) ([]byte, error) {
 		diagramHash,
 		w, h, left, top, w, h,
 		doubleBorderElStr,
-		backgroundEl.Render(),
-		upperBuf.String(),
-		buf.String(),
-		tag,
-		fitToScreenWrapperClosing,
+		backgroundElStr,
 	)
-	return []byte(docRendered), nil
+	if err != nil {
+		return err
+	}
+	_, err = upperBuf.WriteTo(out)
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(out)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, `</%s>%s`, tag, fitToScreenWrapperClosing)
+	return err
 }
 
 // TODO include only colors that are being used to reduce size
@@ -2073,6 +2260,36 @@ func ThemeCSS(diagramHash string, themeID *int64, darkThemeID *int64, overrides,
 	return out, nil
 }
 
+// defineGradients returns the definitions of the gradients the board fills with, once each
+func defineGradients(diagram *d2target.Diagram) (string, error) {
+	fills := []string{diagram.Root.Fill}
+	for _, s := range diagram.Shapes {
+		fills = append(fills, s.Fill)
+	}
+	for _, c := range diagram.Connections {
+		fills = append(fills, c.Fill)
+	}
+
+	defs := ""
+	defined := make(map[string]struct{})
+	for _, fill := range fills {
+		if !color.IsGradient(fill) {
+			continue
+		}
+		id := color.GradientID(fill)
+		if _, ok := defined[id]; ok {
+			continue
+		}
+		defined[id] = struct{}{}
+		g, err := color.ParseGradient(fill)
+		if err != nil {
+			return "", err
+		}
+		defs += g.SVG(id)
+	}
+	return defs, nil
+}
+
 func singleThemeRulesets(diagramHash string, themeID int64, overrides *d2target.ThemeOverrides) (rulesets string, err error) {
 	out := ""
 	theme := d2themescatalog.Find(themeID)
@@ -2281,6 +2498,17 @@ type DiagramObject interface {
 	GetZIndex() int
 }
 
+// layerGroup returns the layer group of a shape or connection, if any
+func layerGroup(obj DiagramObject) string {
+	switch obj := obj.(type) {
+	case d2target.Shape:
+		return obj.LayerGroup
+	case d2target.Connection:
+		return obj.LayerGroup
+	}
+	return ""
+}
+
 // sortObjects sorts all diagrams objects (shapes and connections) in the desired drawing order
 // the sorting criteria is:
 // 1. zIndex, lower comes first
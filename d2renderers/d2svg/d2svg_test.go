@@ -1,9 +1,15 @@
 package d2svg
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
 
+	"oss.terrastruct.com/d2/d2renderers/d2fonts"
 	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/util-go/go2"
 )
 
 func TestSortObjects(t *testing.T) {
@@ -81,3 +87,215 @@ func TestSortObjects(t *testing.T) {
 		}
 	}
 }
+
+func TestRenderTo(t *testing.T) {
+	diagram := d2target.NewDiagram()
+	diagram.FontFamily = go2.Pointer(d2fonts.SourceSansPro)
+	for i, id := range []string{"a", "b"} {
+		s := d2target.BaseShape()
+		s.ID = id
+		s.Type = d2target.ShapeRectangle
+		s.Pos = d2target.Point{X: 0, Y: i * 200}
+		s.Width = 100
+		s.Height = 66
+		s.Label = id
+		s.LabelWidth = 7
+		s.LabelHeight = 21
+		s.LabelPosition = "INSIDE_MIDDLE_CENTER"
+		s.FontSize = 16
+		diagram.Shapes = append(diagram.Shapes, *s)
+	}
+	c := d2target.BaseConnection()
+	c.ID = "(a -> b)[0]"
+	c.Src = "a"
+	c.Dst = "b"
+	c.DstArrow = d2target.TriangleArrowhead
+	c.Route = []*geo.Point{geo.NewPoint(50, 66), geo.NewPoint(50, 200)}
+	diagram.Connections = append(diagram.Connections, *c)
+
+	opts := &RenderOpts{
+		Pad: go2.Pointer(int64(DEFAULT_PADDING)),
+	}
+	exp, err := Render(diagram, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	err = RenderTo(&got, diagram, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exp, got.Bytes()) {
+		t.Fatalf("RenderTo differs from Render:\n%s\n%s", got.Bytes(), exp)
+	}
+
+	errWrite := errors.New("disk full")
+	err = RenderTo(failingWriter{errWrite}, diagram, opts)
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("expected write error, got %v", err)
+	}
+}
+
+func TestLayerGroups(t *testing.T) {
+	diagram := d2target.NewDiagram()
+	diagram.FontFamily = go2.Pointer(d2fonts.SourceSansPro)
+	for i, id := range []string{"a", "b", "c"} {
+		s := d2target.BaseShape()
+		s.ID = id
+		s.Type = d2target.ShapeRectangle
+		s.Pos = d2target.Point{X: i * 200, Y: 0}
+		s.Width = 100
+		s.Height = 66
+		if id != "b" {
+			s.LayerGroup = "after"
+		}
+		diagram.Shapes = append(diagram.Shapes, *s)
+	}
+
+	out, err := Render(diagram, &RenderOpts{
+		Pad:               go2.Pointer(int64(DEFAULT_PADDING)),
+		HiddenLayerGroups: []string{"after"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(out)
+	if strings.Count(svg, `class="layer-group"`) != 1 {
+		t.Fatalf("expected the shapes of the group in one <g>:\n%s", svg)
+	}
+	group := strings.Index(svg, `<g id="layer-group-after" class="layer-group" data-layer-group="after" style="display:none">`)
+	if group == -1 {
+		t.Fatalf("expected a hidden <g> of the group:\n%s", svg)
+	}
+	// The group is drawn where its first shape would be, so b, drawn after a, comes after it
+	a := strings.Index(svg, `<g id="a"`)
+	b := strings.Index(svg, `<g id="b"`)
+	c := strings.Index(svg, `<g id="c"`)
+	if !(group < a && a < c && c < b) {
+		t.Fatalf("expected a and c together in the group before b, got group=%d a=%d b=%d c=%d", group, a, b, c)
+	}
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestQuantize(t *testing.T) {
+	tcs := []struct {
+		step float64
+		in   string
+		exp  string
+	}{
+		{
+			step: 1,
+			in:   `<rect x="10.400000" y="-0.300000" width="100.500000" height="66.000000" stroke-width="2.500000" />`,
+			exp:  `<rect x="10" y="0" width="101" height="66" stroke-width="2.500000" />`,
+		},
+		{
+			step: 1,
+			in:   `<path d="M 50.250000 66.750000 A 10.000000 10.000000 0 0 1 60.5 76.49" class="a1"/>`,
+			exp:  `<path d="M 50 67 A 10 10 0 0 1 61 76" class="a1"/>`,
+		},
+		{
+			step: 0.5,
+			in:   `<line x1="1.3" y1="2.8" x2="-1.2" y2="1e2"/><g transform="scale(-1) translate(-10.26, -3.74)"></g>`,
+			exp:  `<line x1="1.5" y1="3" x2="-1" y2="100"/><g transform="scale(-1) translate(-10.5, -3.5)"></g>`,
+		},
+		{
+			step: 0.1,
+			in:   `<polygon points="0.33,1.06 2.049,3" /><text x="5.56">x="5.56"</text>`,
+			exp:  `<polygon points="0.3,1.1 2,3" /><text x="5.6">x="5.56"</text>`,
+		},
+	}
+	for _, tc := range tcs {
+		got := string(quantize([]byte(tc.in), tc.step))
+		if got != tc.exp {
+			t.Errorf("quantize(%q, %v):\ngot  %s\nwant %s", tc.in, tc.step, got, tc.exp)
+		}
+	}
+
+	for _, step := range []float64{1, 0.5, 0.25, 0.1, 0.01} {
+		if err := ValidateQuantize(step); err != nil {
+			t.Errorf("expected step %v to be valid: %v", step, err)
+		}
+	}
+	for _, step := range []float64{0, -1, 2, 0.3, 0.7} {
+		if err := ValidateQuantize(step); err == nil {
+			t.Errorf("expected step %v to be invalid", step)
+		}
+	}
+}
+
+func TestEdgeJumps(t *testing.T) {
+	connections := []d2target.Connection{
+		{
+			ID:    "vertical",
+			Route: []*geo.Point{geo.NewPoint(50, 0), geo.NewPoint(50, 100)},
+		},
+		{
+			ID:    "horizontal",
+			Route: []*geo.Point{geo.NewPoint(0, 50), geo.NewPoint(100, 50), geo.NewPoint(100, 200)},
+		},
+		// Crosses both, but too close to its own end to hop over the vertical one
+		{
+			ID:    "late",
+			Route: []*geo.Point{geo.NewPoint(45, 30), geo.NewPoint(200, 30)},
+		},
+		{
+			ID:      "curved",
+			IsCurve: true,
+			Route:   []*geo.Point{geo.NewPoint(0, 40), geo.NewPoint(30, 40), geo.NewPoint(70, 40), geo.NewPoint(150, 40)},
+		},
+	}
+	jumps := edgeJumps(connections)
+
+	if _, ok := jumps["vertical"]; ok {
+		t.Errorf("expected the first connection drawn not to hop")
+	}
+	if _, ok := jumps["curved"]; ok {
+		t.Errorf("expected curved connections not to hop")
+	}
+	if _, ok := jumps["late"]; ok {
+		t.Errorf("expected no hop next to the end of a connection")
+	}
+	h := jumps["horizontal"]
+	if len(h) != 2 || len(h[0]) != 1 || !h[0][0].Equals(geo.NewPoint(50, 50)) || len(h[1]) != 0 {
+		t.Errorf("expected horizontal to hop over vertical at (50, 50), got %v", h)
+	}
+
+	path := pathData(connections[1], geo.NewPoint(0, 0), geo.NewPoint(0, 0), h)
+	exp := "M 0.000000 50.000000 L 44.000000 50.000000 C 44.000000 42.000000 56.000000 42.000000 56.000000 50.000000 L 100.000000 50.000000"
+	if path[:len(exp)] != exp {
+		t.Errorf("expected the hop to bulge up:\ngot  %s\nwant %s...", path, exp)
+	}
+}
+
+func TestHighlightMarkdown(t *testing.T) {
+	themes := codeThemes{DEFAULT_CODE_THEME, DEFAULT_DARK_CODE_THEME}
+	render := "<p>x</p>\n<pre><code class=\"language-go\">x := &quot;a&quot;\n</code></pre>\n<pre><code class=\"language-nope\">y\n</code></pre>\n"
+	got, err := highlightMarkdown(render, themes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `<pre class="light-code" style="background-color:#ffffff"><code class="language-go">`) ||
+		!strings.Contains(got, `<pre class="dark-code"`) {
+		t.Errorf("expected a light and a dark copy of the go code, got %s", got)
+	}
+	if !strings.Contains(got, `&#34;a&#34;</span>`) {
+		t.Errorf("expected the string to be highlighted, got %s", got)
+	}
+	if !strings.HasPrefix(got, "<p>x</p>\n") || !strings.HasSuffix(got, "<pre><code class=\"language-nope\">y\n</code></pre>\n") {
+		t.Errorf("expected the rest to be kept as is, got %s", got)
+	}
+
+	if err := ValidateCodeTheme("monokai"); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateCodeTheme("nope"); err == nil || err.Error() != `code theme "nope" not found` {
+		t.Errorf("expected nope to be invalid, got %v", err)
+	}
+}
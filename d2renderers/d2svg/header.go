@@ -0,0 +1,52 @@
+package d2svg
+
+import (
+	"fmt"
+	"math"
+
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/label"
+)
+
+// headerPathData returns the path of the header of a container, a band across its top or a
+// tab in its top left corner holding its label, or "" if it has none. Only labels inside the
+// top get one, since there's nothing to hold otherwise.
+func headerPathData(shape d2target.Shape) string {
+	if shape.Header == "" || shape.Label == "" {
+		return ""
+	}
+	switch label.FromString(shape.LabelPosition) {
+	case label.InsideTopLeft, label.InsideTopCenter, label.InsideTopRight:
+	default:
+		return ""
+	}
+
+	x := float64(shape.Pos.X)
+	y := float64(shape.Pos.Y)
+	width := float64(shape.Width)
+	// The label's height already includes the padding below it
+	height := math.Min(float64(shape.LabelHeight+label.PADDING), float64(shape.Height))
+	if shape.Header == "tab" {
+		width = math.Min(float64(shape.LabelWidth+4*label.PADDING), width)
+	}
+	r := math.Min(float64(shape.BorderRadius), math.Min(height, width/2))
+
+	if shape.Header == "tab" {
+		// Only the corner of the container is rounded
+		return fmt.Sprintf("M %f %f L %f %f Q %f %f %f %f L %f %f L %f %f Z",
+			x, y+height,
+			x, y+r,
+			x, y, x+r, y,
+			x+width, y,
+			x+width, y+height,
+		)
+	}
+	return fmt.Sprintf("M %f %f L %f %f Q %f %f %f %f L %f %f Q %f %f %f %f L %f %f Z",
+		x, y+height,
+		x, y+r,
+		x, y, x+r, y,
+		x+width-r, y,
+		x+width, y, x+width, y+r,
+		x+width, y+height,
+	)
+}
@@ -0,0 +1,100 @@
+package d2svg
+
+import (
+	"fmt"
+	"sort"
+
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/geo"
+)
+
+// edgeJumpRadius is half the width of the hop drawn where a connection crosses another
+const edgeJumpRadius = 6
+
+// edgeJumps returns the points where each segment of each connection crosses one drawn
+// before it, keyed by connection ID and ordered along the segment, so it's drawn hopping over
+// them. connections must be in the order they're drawn. Curved routes neither hop nor are
+// hopped over, and crossings too close to a bend aren't marked since the hop wouldn't fit.
+func edgeJumps(connections []d2target.Connection) map[string][][]*geo.Point {
+	jumps := make(map[string][][]*geo.Point)
+	var drawn []d2target.Connection
+	for _, c := range connections {
+		if c.IsCurve || len(c.Route) < 2 {
+			continue
+		}
+		margin := c.BorderRadius + 2*edgeJumpRadius
+		segments := make([][]*geo.Point, len(c.Route)-1)
+		hasJumps := false
+		for i := range segments {
+			a, b := c.Route[i], c.Route[i+1]
+			for _, other := range drawn {
+				for j := 0; j < len(other.Route)-1; j++ {
+					oa, ob := other.Route[j], other.Route[j+1]
+					p := geo.IntersectionPoint(a, b, oa, ob)
+					if p == nil {
+						continue
+					}
+					if geo.EuclideanDistance(a.X, a.Y, p.X, p.Y) < margin || geo.EuclideanDistance(p.X, p.Y, b.X, b.Y) < margin {
+						continue
+					}
+					// Meeting at a bend of the other connection isn't crossing it
+					if geo.EuclideanDistance(oa.X, oa.Y, p.X, p.Y) < edgeJumpRadius || geo.EuclideanDistance(p.X, p.Y, ob.X, ob.Y) < edgeJumpRadius {
+						continue
+					}
+					segments[i] = append(segments[i], p)
+					hasJumps = true
+				}
+			}
+			sort.Slice(segments[i], func(k, l int) bool {
+				return geo.EuclideanDistance(a.X, a.Y, segments[i][k].X, segments[i][k].Y) < geo.EuclideanDistance(a.X, a.Y, segments[i][l].X, segments[i][l].Y)
+			})
+			segments[i] = dedupeJumps(segments[i])
+		}
+		if hasJumps {
+			jumps[c.ID] = segments
+		}
+		drawn = append(drawn, c)
+	}
+	return jumps
+}
+
+// dedupeJumps drops the jumps that would overlap the one before them
+func dedupeJumps(points []*geo.Point) []*geo.Point {
+	if len(points) == 0 {
+		return points
+	}
+	deduped := points[:1]
+	for _, p := range points[1:] {
+		prev := deduped[len(deduped)-1]
+		if geo.EuclideanDistance(prev.X, prev.Y, p.X, p.Y) >= 2*edgeJumpRadius {
+			deduped = append(deduped, p)
+		}
+	}
+	return deduped
+}
+
+// jumpPathData returns the path commands that hop over points on the way from "from" to
+// "to". Hops are semicircles, drawn as cubic curves so animated connections can still split
+// their paths, bulging up on horizontal segments and right on vertical ones.
+func jumpPathData(from, to *geo.Point, points []*geo.Point) []string {
+	dir := from.VectorTo(to).Unit()
+	normal := geo.NewVector(dir[1], -dir[0])
+	if normal[1] > 0 || (normal[1] == 0 && normal[0] < 0) {
+		normal = normal.Multiply(-1)
+	}
+	bulge := normal.Multiply(edgeJumpRadius * 4 / 3).ToPoint()
+	var path []string
+	for _, p := range points {
+		start := p.AddVector(dir.Multiply(-edgeJumpRadius))
+		end := p.AddVector(dir.Multiply(edgeJumpRadius))
+		path = append(path,
+			fmt.Sprintf("L %f %f", start.X, start.Y),
+			fmt.Sprintf("C %f %f %f %f %f %f",
+				start.X+bulge.X, start.Y+bulge.Y,
+				end.X+bulge.X, end.Y+bulge.Y,
+				end.X, end.Y,
+			),
+		)
+	}
+	return path
+}
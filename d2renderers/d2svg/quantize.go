@@ -0,0 +1,58 @@
+package d2svg
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// quantizedAttrRegex matches the attributes holding coordinates and sizes
+var quantizedAttrRegex = regexp.MustCompile(`(\s(?:x|y|x1|y1|x2|y2|cx|cy|r|rx|ry|dx|dy|width|height|d|points|transform)=")([^"]*)"`)
+
+var numberRegex = regexp.MustCompile(`-?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+
+// ValidateQuantize checks that coordinates can be rounded to multiples of step. Steps must
+// divide 1 evenly, e.g. 1, 0.5, or 0.1, so that integers, like the flags of arcs in paths,
+// are kept as is.
+func ValidateQuantize(step float64) error {
+	if step <= 0 || step > 1 {
+		return fmt.Errorf("quantize step must be greater than 0 and at most 1, got %v", step)
+	}
+	n := 1 / step
+	if math.Abs(n-math.Round(n)) > 1e-9 {
+		return fmt.Errorf("quantize step must divide 1 evenly, e.g. 1, 0.5, or 0.1, got %v", step)
+	}
+	return nil
+}
+
+// quantize rounds the coordinates in the attributes of svg elements to multiples of step,
+// so that rerendering a diagram whose layout barely changed gives few changed lines
+func quantize(svg []byte, step float64) []byte {
+	// Decimals needed to write multiples of step exactly, e.g. 2 for 0.25
+	decimals := 0
+	if s := strconv.FormatFloat(step, 'f', -1, 64); strings.Contains(s, ".") {
+		decimals = len(s) - strings.Index(s, ".") - 1
+	}
+	return quantizedAttrRegex.ReplaceAllFunc(svg, func(attr []byte) []byte {
+		// Only the value, not numbers in the name like x1
+		nameEnd := bytes.IndexByte(attr, '"') + 1
+		value := numberRegex.ReplaceAllFunc(attr[nameEnd:], func(num []byte) []byte {
+			v, err := strconv.ParseFloat(string(num), 64)
+			if err != nil {
+				return num
+			}
+			s := strconv.FormatFloat(math.Round(v/step)*step, 'f', decimals, 64)
+			if strings.Contains(s, ".") {
+				s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+			}
+			if s == "-0" {
+				s = "0"
+			}
+			return []byte(s)
+		})
+		return append(attr[:nameEnd:nameEnd], value...)
+	})
+}
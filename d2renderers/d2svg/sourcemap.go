@@ -0,0 +1,37 @@
+package d2svg
+
+import (
+	"fmt"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/svg"
+)
+
+// SourceMap maps the IDs of the elements the shapes and connections of diagram are rendered
+// to, without its layers, scenarios and steps, to where they're declared in the input, so that
+// editors can go from a click on the render to the source. Shapes and connections that aren't
+// declared in the input, like the legend's, aren't in it.
+func SourceMap(diagram *d2target.Diagram) map[string]d2ast.Range {
+	m := make(map[string]d2ast.Range)
+	for _, s := range diagram.Shapes {
+		if s.Range != nil {
+			m[s.ID] = *s.Range
+		}
+	}
+	for _, c := range diagram.Connections {
+		if c.Range != nil {
+			m[c.ID] = *c.Range
+		}
+	}
+	return m
+}
+
+// sourceLocAttr is the data-d2-loc attribute of an element declared at r, like
+// data-d2-loc="x.d2:3:1", or nothing if it isn't declared in the input
+func sourceLocAttr(r *d2ast.Range) string {
+	if r == nil {
+		return ""
+	}
+	return fmt.Sprintf(` data-d2-loc="%s"`, svg.EscapeText(r.String()))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html"
 	"io"
+	"strings"
 
 	"oss.terrastruct.com/d2/d2target"
 	"oss.terrastruct.com/d2/d2themes"
@@ -75,7 +76,28 @@ func tableHeader(diagramHash string, shape d2target.Shape, box *geo.Box, text st
 	return str
 }
 
-func tableRow(shape d2target.Shape, box *geo.Box, nameText, typeText, constraintText string, fontSize, longestNameWidth, longestTypeWidth float64) string {
+// constraintIconPaths are the outlines of the icons of constraints, in a 16x16 box
+var constraintIconPaths = map[string]string{
+	// A key
+	"primary_key": "M 7 8 A 3 3 0 1 1 1 8 A 3 3 0 1 1 7 8 Z M 7 8 H 15 M 12 8 V 11 M 14.5 8 V 10.5",
+	// An arrow out of a box, toward what's referenced
+	"foreign_key": "M 9 2 H 14 V 7 M 14 2 L 7 9 M 12 10 V 14 H 2 V 4 H 6",
+	// A 1 in a circle
+	"unique": "M 14.5 8 A 6.5 6.5 0 1 1 1.5 8 A 6.5 6.5 0 1 1 14.5 8 Z M 6.5 6 L 8.5 4.5 V 11.5",
+}
+
+func constraintIcon(shape d2target.Shape, constraint string, x, y, size float64) string {
+	pathEl := d2themes.NewThemableElement("path")
+	pathEl.D = constraintIconPaths[constraint]
+	pathEl.Transform = fmt.Sprintf("translate(%f %f) scale(%f)", x, y, size/16)
+	pathEl.Fill = "none"
+	pathEl.Stroke = shape.SecondaryAccentColor
+	pathEl.Style = "stroke-width:1.5"
+	pathEl.Content = fmt.Sprintf("<title>%s</title>", strings.ReplaceAll(constraint, "_", " "))
+	return pathEl.Render()
+}
+
+func tableRow(shape d2target.Shape, box *geo.Box, nameText, typeText string, typeWidth float64, constraintText string, constraintIcons []string, fontSize, longestNameWidth, longestTypeWidth float64) string {
 	// Row is made up of name, type, and constraint
 	// e.g. | diagram   int   FK |
 	nameTL := label.InsideMiddleLeft.GetPointOnBox(
@@ -94,20 +116,63 @@ func tableRow(shape d2target.Shape, box *geo.Box, nameText, typeText, constraint
 	textEl.Content = svg.EscapeText(nameText)
 	out := textEl.Render()
 
+	// Types are aligned within the width of the longest
 	textEl.X += longestNameWidth + d2target.TypePadding
+	switch shape.TextAlign {
+	case "center":
+		textEl.X += (longestTypeWidth - typeWidth) / 2
+	case "right":
+		textEl.X += longestTypeWidth - typeWidth
+	}
 	textEl.Fill = shape.NeutralAccentColor
 	textEl.Content = svg.EscapeText(typeText)
 	out += textEl.Render()
 
-	textEl.X = box.TopLeft.X + (box.Width - d2target.NamePadding)
-	textEl.Fill = shape.SecondaryAccentColor
-	textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "end", fontSize)
-	textEl.Content = constraintText
-	out += textEl.Render()
+	// Icons are at the end of the row, after the text of other constraints
+	right := box.TopLeft.X + (box.Width - d2target.NamePadding)
+	for i := len(constraintIcons) - 1; i >= 0; i-- {
+		right -= fontSize
+		out += constraintIcon(shape, constraintIcons[i], right, box.Center().Y-fontSize/2, fontSize)
+		right -= d2target.ConstraintIconGap
+	}
+	if constraintText != "" || len(constraintIcons) == 0 {
+		textEl.X = right
+		textEl.Fill = shape.SecondaryAccentColor
+		textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "end", fontSize)
+		textEl.Content = constraintText
+		out += textEl.Render()
+	}
 
 	return out
 }
 
+// tableGroupRow draws a header or separator row that groups the rows after it
+func tableGroupRow(shape d2target.Shape, box *geo.Box, row d2target.SQLColumn, fontSize float64) string {
+	if row.Shape == d2target.ShapeRowSeparator {
+		lineEl := d2themes.NewThemableElement("line")
+		lineEl.X1, lineEl.Y1 = box.TopLeft.X+d2target.NamePadding, box.Center().Y
+		lineEl.X2, lineEl.Y2 = box.TopLeft.X+box.Width-d2target.NamePadding, box.Center().Y
+		lineEl.Stroke = shape.NeutralAccentColor
+		lineEl.Style = "stroke-width:1;stroke-dasharray:4,4"
+		return lineEl.Render()
+	}
+
+	tl := label.InsideMiddleLeft.GetPointOnBox(
+		box,
+		d2target.NamePadding,
+		0,
+		fontSize,
+	)
+	textEl := d2themes.NewThemableElement("text")
+	textEl.X = tl.X
+	textEl.Y = tl.Y + fontSize*3/4
+	textEl.Fill = shape.NeutralAccentColor
+	textEl.ClassName = "text-italic"
+	textEl.Style = fmt.Sprintf("text-anchor:%s;font-size:%vpx", "start", fontSize)
+	textEl.Content = svg.EscapeText(row.Name.Label)
+	return textEl.Render()
+}
+
 func drawTable(writer io.Writer, diagramHash string, targetShape d2target.Shape) {
 	rectEl := d2themes.NewThemableElement("rect")
 	rectEl.X = float64(targetShape.Pos.X)
@@ -129,7 +194,8 @@ func drawTable(writer io.Writer, diagramHash string, targetShape d2target.Shape)
 		float64(targetShape.Width),
 		float64(targetShape.Height),
 	)
-	rowHeight := box.Height / float64(1+len(targetShape.SQLTable.Columns))
+	table := targetShape.SQLTable
+	rowHeight := box.Height / float64(1+table.Rows())
 	headerBox := geo.NewBox(box.TopLeft, box.Width, rowHeight)
 
 	fmt.Fprint(writer,
@@ -139,32 +205,73 @@ func drawTable(writer io.Writer, diagramHash string, targetShape d2target.Shape)
 
 	var longestNameWidth int
 	var longestTypeWidth int
-	for _, f := range targetShape.Columns {
+	for _, f := range table.VisibleColumns() {
+		if f.Shape != "" {
+			continue
+		}
 		longestNameWidth = go2.Max(longestNameWidth, f.Name.LabelWidth)
 		longestTypeWidth = go2.Max(longestTypeWidth, f.Type.LabelWidth)
 	}
+	for _, idx := range table.Indexes {
+		longestNameWidth = go2.Max(longestNameWidth, idx.Name.LabelWidth)
+		longestTypeWidth = go2.Max(longestTypeWidth, idx.Columns.LabelWidth)
+	}
 
+	fontSize := float64(targetShape.FontSize)
 	rowBox := geo.NewBox(box.TopLeft.Copy(), box.Width, rowHeight)
 	rowBox.TopLeft.Y += headerBox.Height
-	for idx, f := range targetShape.Columns {
-		fmt.Fprint(writer,
-			tableRow(targetShape, rowBox, f.Name.Label, f.Type.Label, f.ConstraintAbbr(), float64(targetShape.FontSize), float64(longestNameWidth), float64(longestTypeWidth)),
-		)
+	row := 0
+	// nextRow moves to the next row, dividing it from the last with a line
+	nextRow := func(stroke string) {
+		row++
 		rowBox.TopLeft.Y += rowHeight
 
 		lineEl := d2themes.NewThemableElement("line")
-		if idx == len(targetShape.Columns)-1 && targetShape.BorderRadius != 0 {
+		if row == table.Rows() && targetShape.BorderRadius != 0 {
 			lineEl.X1, lineEl.Y1 = rowBox.TopLeft.X+float64(targetShape.BorderRadius), rowBox.TopLeft.Y
 			lineEl.X2, lineEl.Y2 = rowBox.TopLeft.X+rowBox.Width-float64(targetShape.BorderRadius), rowBox.TopLeft.Y
 		} else {
 			lineEl.X1, lineEl.Y1 = rowBox.TopLeft.X, rowBox.TopLeft.Y
 			lineEl.X2, lineEl.Y2 = rowBox.TopLeft.X+rowBox.Width, rowBox.TopLeft.Y
 		}
-		lineEl.Stroke = targetShape.Fill
+		lineEl.Stroke = stroke
 		lineEl.Style = "stroke-width:2"
 		fmt.Fprint(writer, lineEl.Render())
 	}
 
+	for _, f := range table.VisibleColumns() {
+		if f.Shape != "" {
+			fmt.Fprint(writer, tableGroupRow(targetShape, rowBox, f, fontSize))
+		} else {
+			fmt.Fprint(writer,
+				tableRow(targetShape, rowBox, f.Name.Label, f.Type.Label, float64(f.Type.LabelWidth), f.ConstraintText(), f.ConstraintIcons(), fontSize, float64(longestNameWidth), float64(longestTypeWidth)),
+			)
+		}
+		nextRow(targetShape.Fill)
+	}
+	if table.HiddenColumns() > 0 {
+		fmt.Fprint(writer, tableGroupRow(targetShape, rowBox, d2target.SQLColumn{
+			Name:  d2target.Text{Label: table.MoreText()},
+			Shape: d2target.ShapeRowHeader,
+		}, fontSize))
+		nextRow(targetShape.Fill)
+	}
+	for i, idx := range table.Indexes {
+		if i == 0 {
+			// The indexes compartment is divided from the columns like the header is
+			lineEl := d2themes.NewThemableElement("line")
+			lineEl.X1, lineEl.Y1 = rowBox.TopLeft.X, rowBox.TopLeft.Y
+			lineEl.X2, lineEl.Y2 = rowBox.TopLeft.X+rowBox.Width, rowBox.TopLeft.Y
+			lineEl.Stroke = targetShape.Stroke
+			lineEl.Style = "stroke-width:2"
+			fmt.Fprint(writer, lineEl.Render())
+		}
+		fmt.Fprint(writer,
+			tableRow(targetShape, rowBox, idx.Name.Label, idx.Columns.Label, float64(idx.Columns.LabelWidth), "", nil, fontSize, float64(longestNameWidth), float64(longestTypeWidth)),
+		)
+		nextRow(targetShape.Fill)
+	}
+
 	if targetShape.Icon != nil && targetShape.Type != d2target.ShapeImage {
 		iconPosition := label.FromString(targetShape.IconPosition)
 		iconSize := d2target.GetIconSize(box, targetShape.IconPosition)
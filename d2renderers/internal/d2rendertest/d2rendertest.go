@@ -0,0 +1,33 @@
+// Package d2rendertest has helpers for the tests of the exporters in d2renderers.
+package d2rendertest
+
+import (
+	"context"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/log"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+)
+
+// Compile compiles script and lays it out with dagre, failing t on any error
+func Compile(t testing.TB, script string) *d2target.Diagram {
+	ctx := log.WithTB(context.Background(), t, nil)
+	ruler, err := textmeasure.NewRuler()
+	assert.Success(t, err)
+	layoutResolver := func(engine string) (d2graph.LayoutGraph, error) {
+		return d2dagrelayout.DefaultLayout, nil
+	}
+	diagram, _, err := d2lib.Compile(ctx, script, &d2lib.CompileOptions{
+		Ruler:          ruler,
+		LayoutResolver: layoutResolver,
+	}, &d2svg.RenderOpts{})
+	assert.Success(t, err)
+	return diagram
+}
@@ -0,0 +1,275 @@
+// Package d2rewrite edits D2 files by their AST without formatting them, so that tools keeping
+// D2 files in sync with other sources only change the text of what they edit. Comments, order
+// and whitespace everywhere else are kept byte for byte.
+//
+// Keys are found by their paths as written, e.g. "a.b" is both "a.b: x" and "b: x" in "a: {...}".
+// Unlike d2oracle, nothing is compiled, so vars, imports and globs aren't resolved.
+package d2rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2format"
+	"oss.terrastruct.com/d2/d2parser"
+)
+
+// File is the text of a D2 file and its AST, which each edit rewrites the text of and then
+// parses again
+type File struct {
+	path string
+	text []byte
+	ast  *d2ast.Map
+}
+
+// Parse parses the text of the D2 file at path to edit it. Files that don't parse can't be
+// edited, as what their edits would change is unclear.
+func Parse(path string, text []byte) (*File, error) {
+	f := &File{
+		path: path,
+	}
+	if err := f.setText(text); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Bytes returns the text of the file with the edits made so far
+func (f *File) Bytes() []byte {
+	return f.text
+}
+
+// AST returns the AST of the text. It's parsed again after each edit, so nodes of an AST
+// returned before an edit are stale.
+func (f *File) AST() *d2ast.Map {
+	return f.ast
+}
+
+// Set sets the value of key, e.g. "a.style.fill", to value. The last key written with that
+// path has its value replaced, or its label if its value is a map. If there's none, the key is
+// inserted in the map its path is most nested in, after the last node of it.
+func (f *File) Set(key, value string) error {
+	kp, err := d2parser.ParseKey(key)
+	if err != nil {
+		return err
+	}
+	path := kp.IDA()
+	v := d2format.Format(d2ast.RawString(value, false))
+
+	matches, m, depth := f.find(path)
+	if len(matches) == 0 {
+		// Parsed keys are reused so their quoting is kept
+		mk := &d2ast.Key{
+			Key: &d2ast.KeyPath{
+				Path: kp.Path[depth:],
+			},
+			Value: d2ast.MakeValueBox(d2ast.RawString(value, false)),
+		}
+		return f.insert(m, d2format.Format(mk))
+	}
+
+	mk := matches[len(matches)-1]
+	switch {
+	case mk.Primary.Unbox() != nil:
+		r := mk.Primary.Unbox().GetRange()
+		return f.replace(r.Start.Byte, r.End.Byte, v)
+	case mk.Value.Map != nil:
+		start := mk.Value.Map.Range.Start.Byte
+		return f.replace(start, start, v+" ")
+	case mk.Value.Unbox() != nil:
+		r := mk.Value.Unbox().GetRange()
+		return f.replace(r.Start.Byte, r.End.Byte, v)
+	default:
+		end := mk.Key.Range.End.Byte
+		return f.replace(end, end, ": "+v)
+	}
+}
+
+// Insert inserts mapKey, e.g. "a -> b: hi", in the map of the key at mapPath, or at the end of
+// the file if mapPath is empty. The map is the value of the last key written with that path.
+func (f *File) Insert(mapPath, mapKey string) error {
+	mk, err := d2parser.ParseMapKey(mapKey)
+	if err != nil {
+		return err
+	}
+	m := f.ast
+	if mapPath != "" {
+		kp, err := d2parser.ParseKey(mapPath)
+		if err != nil {
+			return err
+		}
+		matches, _, _ := f.find(kp.IDA())
+		if len(matches) == 0 {
+			return fmt.Errorf("%s not found", mapPath)
+		}
+		m = matches[len(matches)-1].Value.Map
+		if m == nil {
+			return fmt.Errorf("%s isn't a map", mapPath)
+		}
+	}
+	return f.insert(m, d2format.Format(mk))
+}
+
+// Delete deletes every key written with the path key, with its value. The lines of keys alone
+// on them are deleted with them.
+func (f *File) Delete(key string) error {
+	kp, err := d2parser.ParseKey(key)
+	if err != nil {
+		return err
+	}
+	matches, _, _ := f.find(kp.IDA())
+	if len(matches) == 0 {
+		return fmt.Errorf("%s not found", key)
+	}
+
+	// Deleted one at a time and reparsed in between, since deleting a key can change the span
+	// of the next, like when they share a line
+	text, ast := f.text, f.ast
+	for len(matches) > 0 {
+		start, end := f.lineSpan(matches[len(matches)-1].Range)
+		err = f.setText(append(f.text[:start:start], f.text[end:]...))
+		if err != nil {
+			f.text, f.ast = text, ast
+			return err
+		}
+		matches, _, _ = f.find(kp.IDA())
+	}
+	return nil
+}
+
+// find returns the keys written with path, in the order they're written. If there are none,
+// m is the map path is most nested in, and depth the number of elements of path it's the value of.
+func (f *File) find(path []string) (matches []*d2ast.Key, m *d2ast.Map, depth int) {
+	m = f.ast
+	var walk func(m2 *d2ast.Map, prefix []string)
+	walk = func(m2 *d2ast.Map, prefix []string) {
+		for _, n := range m2.Nodes {
+			mk := n.MapKey
+			if mk == nil || mk.Key == nil || len(mk.Edges) > 0 || mk.Ampersand || mk.NotAmpersand {
+				continue
+			}
+			full := append(append([]string{}, prefix...), mk.Key.IDA()...)
+			if !hasPrefix(path, full) {
+				continue
+			}
+			if len(full) == len(path) {
+				matches = append(matches, mk)
+				continue
+			}
+			if mk.Value.Map != nil {
+				if len(full) >= depth {
+					m, depth = mk.Value.Map, len(full)
+				}
+				walk(mk.Value.Map, full)
+			}
+		}
+	}
+	walk(f.ast, nil)
+	return matches, m, depth
+}
+
+// hasPrefix returns whether prefix is the start of path, as IDs are matched, case-insensitively
+func hasPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if !strings.EqualFold(path[i], prefix[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// insert inserts line in m after its last node, on a line of its own with the same indentation
+// unless m is on one line
+func (f *File) insert(m *d2ast.Map, line string) error {
+	nl := f.newline()
+	var last *d2ast.Range
+	for _, n := range m.Nodes {
+		r := n.Unbox().GetRange()
+		last = &r
+	}
+	if last != nil && last.End.Byte > 0 && f.text[last.End.Byte-1] == '\r' {
+		// Comments end after the \r of \r\n
+		last.End.Byte--
+	}
+
+	switch {
+	case m.IsFileMap() && last == nil:
+		// Only whitespace and nothing else was parsed
+		text := bytes.TrimRight(f.text, " \t\r\n")
+		return f.setText(append(append(text, line...), nl...))
+	case last == nil && m.Range.OneLine():
+		return f.replace(m.Range.Start.Byte+1, m.Range.End.Byte-1, line)
+	case last == nil:
+		indent := f.indent(m.Range.Start.Byte) + "  "
+		return f.replace(m.Range.Start.Byte+1, m.Range.Start.Byte+1, nl+indent+line)
+	case !m.IsFileMap() && m.Range.OneLine():
+		return f.replace(last.End.Byte, last.End.Byte, "; "+line)
+	default:
+		return f.replace(last.End.Byte, last.End.Byte, nl+f.indent(last.Start.Byte)+line)
+	}
+}
+
+// lineSpan returns the span of bytes to delete to delete r: the lines it's on if nothing else
+// is, and else r with the semicolon that separates it from the next or previous node
+func (f *File) lineSpan(r d2ast.Range) (start, end int) {
+	start, end = r.Start.Byte, r.End.Byte
+	lineStart := bytes.LastIndexByte(f.text[:start], '\n') + 1
+	lineEnd := len(f.text)
+	if i := bytes.IndexByte(f.text[end:], '\n'); i >= 0 {
+		lineEnd = end + i + 1
+	}
+	before := f.text[lineStart:start]
+	after := f.text[end:lineEnd]
+	if len(bytes.TrimSpace(before)) == 0 && len(bytes.TrimSpace(after)) == 0 {
+		return lineStart, lineEnd
+	}
+	if rest := bytes.TrimLeft(after, " \t"); bytes.HasPrefix(rest, []byte(";")) {
+		end += len(after) - len(rest) + 1
+		end += len(f.text[end:]) - len(bytes.TrimLeft(f.text[end:], " \t"))
+	} else if rest := bytes.TrimRight(before, " \t"); bytes.HasSuffix(rest, []byte(";")) {
+		start -= len(before) - len(rest) + 1
+	}
+	return start, end
+}
+
+// indent returns the whitespace the line of the byte at i starts with
+func (f *File) indent(i int) string {
+	lineStart := bytes.LastIndexByte(f.text[:i], '\n') + 1
+	line := f.text[lineStart:]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// newline returns the line ending the file uses
+func (f *File) newline() string {
+	if bytes.Contains(f.text, []byte("\r\n")) {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+func (f *File) replace(start, end int, s string) error {
+	text := make([]byte, 0, len(f.text)-(end-start)+len(s))
+	text = append(text, f.text[:start]...)
+	text = append(text, s...)
+	text = append(text, f.text[end:]...)
+	return f.setText(text)
+}
+
+// setText sets the text and parses it, unless it doesn't parse, in which case the file is left
+// as it was
+func (f *File) setText(text []byte) error {
+	ast, err := d2parser.Parse(f.path, bytes.NewReader(text), nil)
+	if err != nil {
+		if f.ast != nil {
+			return fmt.Errorf("edit doesn't parse: %w", err)
+		}
+		return err
+	}
+	f.text, f.ast = text, ast
+	return nil
+}
@@ -0,0 +1,217 @@
+package d2rewrite_test
+
+import (
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2rewrite"
+)
+
+func TestEdit(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		text string
+		edit func(f *d2rewrite.File) error
+		exp  string
+		// expErr, if given, is the error of edit, which leaves the text as it was
+		expErr string
+	}{
+		{
+			name: "set_value",
+			text: `# services
+api:   API   # the public one
+api.style.fill:    red
+db: {shape: cylinder}
+`,
+			edit: func(f *d2rewrite.File) error {
+				return f.Set("api.style.fill", "#fff")
+			},
+			exp: `# services
+api:   API   # the public one
+api.style.fill:    "#fff"
+db: {shape: cylinder}
+`,
+		},
+		{
+			name: "set_last",
+			text: "a: x\na: y\n",
+			edit: func(f *d2rewrite.File) error {
+				return f.Set("A", "z")
+			},
+			exp: "a: x\na: z\n",
+		},
+		{
+			name: "set_nested",
+			text: `a: {
+    # deeply
+    b: {
+        c: 1
+    }
+}
+`,
+			edit: func(f *d2rewrite.File) error {
+				return f.Set("a.b.c", "2")
+			},
+			exp: `a: {
+    # deeply
+    b: {
+        c: 2
+    }
+}
+`,
+		},
+		{
+			name: "set_label",
+			text: "a: A {\n  b\n}\nc: {d}\ne\n",
+			edit: func(f *d2rewrite.File) error {
+				if err := f.Set("a", "new"); err != nil {
+					return err
+				}
+				if err := f.Set("c", "C"); err != nil {
+					return err
+				}
+				return f.Set("e", "E")
+			},
+			exp: "a: new {\n  b\n}\nc: C {d}\ne: E\n",
+		},
+		{
+			name: "insert_nested",
+			text: `a: {
+	# tabs are kept
+	b
+}
+x: {y}
+z: {}
+`,
+			edit: func(f *d2rewrite.File) error {
+				if err := f.Set("a.b.style.fill", "red"); err != nil {
+					return err
+				}
+				if err := f.Set("x.label", "X"); err != nil {
+					return err
+				}
+				return f.Set("z.w", "1")
+			},
+			exp: `a: {
+	# tabs are kept
+	b
+	b.style.fill: red
+}
+x: {y; label: X}
+z: {w: 1}
+`,
+		},
+		{
+			name: "insert_root",
+			text: "a -> b # keep\r\n",
+			edit: func(f *d2rewrite.File) error {
+				if err := f.Set("c.shape", "circle"); err != nil {
+					return err
+				}
+				return f.Insert("", "b -> c: hello world")
+			},
+			exp: "a -> b # keep\r\nc.shape: circle\r\nb -> c: hello world\r\n",
+		},
+		{
+			name: "insert_empty",
+			text: "\n\n",
+			edit: func(f *d2rewrite.File) error {
+				return f.Set("a", "x y")
+			},
+			exp: "a: x y\n",
+		},
+		{
+			name: "insert_map",
+			text: "layers: {\n  x: {\n    a\n  }\n}\n",
+			edit: func(f *d2rewrite.File) error {
+				return f.Insert("layers.x", "a -> b")
+			},
+			exp: "layers: {\n  x: {\n    a\n    a -> b\n  }\n}\n",
+		},
+		{
+			name: "insert_not_map",
+			text: "a: x\n",
+			edit: func(f *d2rewrite.File) error {
+				return f.Insert("a", "b")
+			},
+			expErr: "a isn't a map",
+		},
+		{
+			name: "delete",
+			text: `a
+# b is gone
+b: {
+  c
+}
+a.b: 1; b.c: 2
+x: {b; y}
+x: {y; b}
+b.d
+`,
+			edit: func(f *d2rewrite.File) error {
+				if err := f.Delete("b"); err != nil {
+					return err
+				}
+				if err := f.Delete("x.b"); err != nil {
+					return err
+				}
+				return f.Delete("a.b")
+			},
+			exp: `a
+# b is gone
+b.c: 2
+x: {y}
+x: {y}
+b.d
+`,
+		},
+		{
+			name: "delete_same_line",
+			text: "a: 1; a: 2\nb\n",
+			edit: func(f *d2rewrite.File) error {
+				return f.Delete("a")
+			},
+			exp: "b\n",
+		},
+		{
+			name: "delete_same_line_map",
+			text: "x: {a: 1; a: 2}\n",
+			edit: func(f *d2rewrite.File) error {
+				return f.Delete("x.a")
+			},
+			exp: "x: {}\n",
+		},
+		{
+			name: "delete_missing",
+			text: "a\n",
+			edit: func(f *d2rewrite.File) error {
+				return f.Delete("b")
+			},
+			expErr: "b not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := d2rewrite.Parse("x.d2", []byte(tc.text))
+			assert.Success(t, err)
+			err = tc.edit(f)
+			if tc.expErr != "" {
+				assert.ErrorString(t, err, tc.expErr)
+				assert.Equal(t, tc.text, string(f.Bytes()))
+				return
+			}
+			assert.Success(t, err)
+			assert.Equal(t, tc.exp, string(f.Bytes()))
+		})
+	}
+
+	_, err := d2rewrite.Parse("x.d2", []byte("a: {"))
+	assert.ErrorString(t, err, "x.d2:1:4: maps must be terminated with }")
+}
@@ -13,14 +13,31 @@ const (
 )
 
 type Class struct {
-	Fields  []ClassField  `json:"fields"`
-	Methods []ClassMethod `json:"methods"`
+	// Stereotype is shown above the name, e.g. "interface" as «interface»
+	Stereotype string        `json:"stereotype,omitempty"`
+	Fields     []ClassField  `json:"fields"`
+	Methods    []ClassMethod `json:"methods"`
+}
+
+func (c Class) StereotypeText(fontSize int) *MText {
+	return &MText{
+		Text:     "«" + c.Stereotype + "»",
+		FontSize: fontSize,
+		IsBold:   false,
+		IsItalic: false,
+		Shape:    "class",
+	}
 }
 
 type ClassField struct {
 	Name       string `json:"name"`
 	Type       string `json:"type"`
 	Visibility string `json:"visibility"`
+	// Static members are underlined and abstract ones italicized, as in UML
+	Static   bool `json:"static,omitempty"`
+	Abstract bool `json:"abstract,omitempty"`
+	// Shape is set for rows that group members rather than describe one, see ShapeRowHeader
+	Shape string `json:"shape,omitempty"`
 }
 
 func (cf ClassField) Text(fontSize int) *MText {
@@ -28,7 +45,7 @@ func (cf ClassField) Text(fontSize int) *MText {
 		Text:     fmt.Sprintf("%s%s", cf.Name, cf.Type),
 		FontSize: fontSize,
 		IsBold:   false,
-		IsItalic: false,
+		IsItalic: cf.Abstract,
 		Shape:    "class",
 	}
 }
@@ -48,6 +65,11 @@ type ClassMethod struct {
 	Name       string `json:"name"`
 	Return     string `json:"return"`
 	Visibility string `json:"visibility"`
+	// Static members are underlined and abstract ones italicized, as in UML
+	Static   bool `json:"static,omitempty"`
+	Abstract bool `json:"abstract,omitempty"`
+	// Shape is set for rows that group members rather than describe one, see ShapeRowHeader
+	Shape string `json:"shape,omitempty"`
 }
 
 func (cm ClassMethod) Text(fontSize int) *MText {
@@ -55,7 +77,7 @@ func (cm ClassMethod) Text(fontSize int) *MText {
 		Text:     fmt.Sprintf("%s%s", cm.Name, cm.Return),
 		FontSize: fontSize,
 		IsBold:   false,
-		IsItalic: false,
+		IsItalic: cm.Abstract,
 		Shape:    "class",
 	}
 }
@@ -0,0 +1,52 @@
+package d2target
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CODE_DIGIT_WIDTH is how wide digits are in the monospaced font, in ems
+const CODE_DIGIT_WIDTH = 0.6
+
+// ParseLineRanges parses lines like "3", "3-5" or "1,3-5" into the sorted line numbers they
+// cover, counting from 1
+func ParseLineRanges(s string) ([]int, error) {
+	seen := make(map[int]struct{})
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		start, end, isRange := strings.Cut(r, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(start))
+		if err != nil {
+			return nil, fmt.Errorf("%#v is not a line or a range of lines like 3-5", r)
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(end))
+			if err != nil {
+				return nil, fmt.Errorf("%#v is not a line or a range of lines like 3-5", r)
+			}
+		}
+		if from < 1 || to < from {
+			return nil, fmt.Errorf("%#v must count up from line 1", r)
+		}
+		for line := from; line <= to; line++ {
+			seen[line] = struct{}{}
+		}
+	}
+	lines := make([]int, 0, len(seen))
+	for line := range seen {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines, nil
+}
+
+// CodeGutterWidth is the width of the line numbers beside code, as wide as the number of its
+// last line and a space
+func CodeGutterWidth(code string, fontSize int) int {
+	digits := len(strconv.Itoa(strings.Count(code, "\n") + 1))
+	return int(math.Ceil(float64(digits+1) * CODE_DIGIT_WIDTH * float64(fontSize)))
+}
@@ -10,6 +10,7 @@ import (
 
 	"oss.terrastruct.com/util-go/go2"
 
+	"oss.terrastruct.com/d2/d2ast"
 	"oss.terrastruct.com/d2/d2renderers/d2fonts"
 	"oss.terrastruct.com/d2/lib/color"
 	"oss.terrastruct.com/d2/lib/geo"
@@ -21,6 +22,9 @@ import (
 const (
 	DEFAULT_ICON_SIZE = 32
 	MAX_ICON_SIZE     = 64
+	// Icons of connections go before their labels
+	CONNECTION_ICON_SIZE = 16
+	CONNECTION_ICON_GAP  = 4
 
 	SHADOW_SIZE_X    = 3
 	SHADOW_SIZE_Y    = 5
@@ -45,6 +49,9 @@ type Config struct {
 	Pad                *int64          `json:"pad"`
 	Center             *bool           `json:"center"`
 	LayoutEngine       *string         `json:"layoutEngine"`
+	Legend             *string         `json:"legend,omitempty"`
+	EdgeJumps          *bool           `json:"edgeJumps,omitempty"`
+	Snap               *int64          `json:"snap,omitempty"`
 	ThemeOverrides     *ThemeOverrides `json:"themeOverrides,omitempty"`
 	DarkThemeOverrides *ThemeOverrides `json:"darkThemeOverrides,omitempty"`
 }
@@ -458,6 +465,16 @@ type Shape struct {
 	ThreeDee     bool `json:"3d"`
 	Multiple     bool `json:"multiple"`
 	DoubleBorder bool `json:"double-border"`
+	// StrokeDotted draws the border as dots, instead of with StrokeDash
+	StrokeDotted bool `json:"strokeDotted,omitempty"`
+	// Header is the style of the header of containers, see d2graph.HeaderStyles
+	Header string `json:"header,omitempty"`
+	// LatexScale is how many times their normal size LaTeX labels are, if not 0
+	LatexScale float64 `json:"latexScale,omitempty"`
+	// LineNumbers and HighlightLines are for code, which can have its lines numbered and some
+	// of them highlighted, counting from 1
+	LineNumbers    bool  `json:"lineNumbers,omitempty"`
+	HighlightLines []int `json:"highlightLines,omitempty"`
 
 	Tooltip      string   `json:"tooltip"`
 	Link         string   `json:"link"`
@@ -465,6 +482,9 @@ type Shape struct {
 	Icon         *url.URL `json:"icon"`
 	IconPosition string   `json:"iconPosition"`
 
+	// LayerGroup is the group of shapes and connections the shape is toggled with in SVGs
+	LayerGroup string `json:"layerGroup,omitempty"`
+
 	// Whether the shape should allow shapes behind it to bleed through
 	// Currently just used for sequence diagram groups
 	Blend bool `json:"blend"`
@@ -473,6 +493,15 @@ type Shape struct {
 	SQLTable
 
 	ContentAspectRatio *float64 `json:"contentAspectRatio,omitempty"`
+	// CustomShape is the definition custom shapes are drawn from
+	CustomShape *shape.CustomDefinition `json:"customShape,omitempty"`
+	// Board is the path of the board board shapes embed, like root.layers.detail
+	Board string `json:"board,omitempty"`
+	// BoardDiagram is the diagram of Board, which board shapes draw a preview of. It's set
+	// once all the boards are laid out.
+	BoardDiagram *Diagram `json:"-"`
+	// Range is where the object is first declared in the input, if it's declared in it
+	Range *d2ast.Range `json:"-"`
 
 	Text
 
@@ -505,7 +534,10 @@ func (s Shape) CSSStyle() string {
 	out := ""
 
 	out += fmt.Sprintf(`stroke-width:%d;`, s.StrokeWidth)
-	if s.StrokeDash != 0 {
+	if s.StrokeDotted {
+		// Round caps turn the empty dashes into dots as wide as the stroke
+		out += fmt.Sprintf(`stroke-dasharray:0,%f;stroke-linecap:round;`, 2*float64(s.StrokeWidth))
+	} else if s.StrokeDash != 0 {
 		dashSize, gapSize := svg.GetStrokeDashAttributes(float64(s.StrokeWidth), s.StrokeDash)
 		out += fmt.Sprintf(`stroke-dasharray:%f,%f;`, dashSize, gapSize)
 	}
@@ -542,6 +574,10 @@ type Text struct {
 	Italic    bool `json:"italic"`
 	Bold      bool `json:"bold"`
 	Underline bool `json:"underline"`
+	// TextAlign aligns the lines of the label left or right, instead of centering them
+	TextAlign string `json:"textAlign,omitempty"`
+	// TextDirection is "ltr" or "rtl" to override the direction detected from the label
+	TextDirection string `json:"textDirection,omitempty"`
 
 	LabelWidth  int    `json:"labelWidth"`
 	LabelHeight int    `json:"labelHeight"`
@@ -562,6 +598,8 @@ func BaseShape() *Shape {
 
 type Connection struct {
 	ID string `json:"id"`
+	// Range is where the edge is first declared in the input, if it's declared in it
+	Range *d2ast.Range `json:"-"`
 
 	Classes []string `json:"classes,omitempty"`
 
@@ -591,6 +629,9 @@ type Connection struct {
 	Tooltip  string   `json:"tooltip"`
 	Icon     *url.URL `json:"icon"`
 
+	// LayerGroup is the group of shapes and connections the connection is toggled with in SVGs
+	LayerGroup string `json:"layerGroup,omitempty"`
+
 	ZIndex int `json:"zIndex"`
 }
 
@@ -734,6 +775,10 @@ const (
 	CircleArrowhead           Arrowhead = "circle"
 	FilledCircleArrowhead     Arrowhead = "filled-circle"
 
+	// A bar across the end, and two triangles in a row, as in hardware diagrams
+	TeeArrowhead            Arrowhead = "tee"
+	DoubleTriangleArrowhead Arrowhead = "double-triangle"
+
 	// For fat arrows
 	LineArrowhead Arrowhead = "line"
 
@@ -743,6 +788,10 @@ const (
 	CfOneRequired  Arrowhead = "cf-one-required"
 	CfManyRequired Arrowhead = "cf-many-required"
 
+	// UML presets, both unfilled triangles. Realizations are dashed as well.
+	GeneralizationArrowhead Arrowhead = "generalization"
+	RealizationArrowhead    Arrowhead = "realization"
+
 	DefaultArrowhead Arrowhead = TriangleArrowhead
 )
 
@@ -757,6 +806,12 @@ var Arrowheads = map[string]struct{}{
 	string(CfMany):            {},
 	string(CfOneRequired):     {},
 	string(CfManyRequired):    {},
+
+	string(TeeArrowhead):            {},
+	string(DoubleTriangleArrowhead): {},
+
+	string(GeneralizationArrowhead): {},
+	string(RealizationArrowhead):    {},
 }
 
 func ToArrowhead(arrowheadType string, filled *bool) Arrowhead {
@@ -780,6 +835,10 @@ func ToArrowhead(arrowheadType string, filled *bool) Arrowhead {
 			return UnfilledTriangleArrowhead
 		}
 		return TriangleArrowhead
+	case string(TeeArrowhead):
+		return TeeArrowhead
+	case string(DoubleTriangleArrowhead):
+		return DoubleTriangleArrowhead
 	case string(CfOne):
 		return CfOne
 	case string(CfMany):
@@ -788,6 +847,8 @@ func ToArrowhead(arrowheadType string, filled *bool) Arrowhead {
 		return CfOneRequired
 	case string(CfManyRequired):
 		return CfManyRequired
+	case string(GeneralizationArrowhead), string(RealizationArrowhead):
+		return UnfilledTriangleArrowhead
 	default:
 		if DefaultArrowhead == TriangleArrowhead &&
 			filled != nil && !(*filled) {
@@ -819,6 +880,16 @@ func (arrowhead Arrowhead) Dimensions(strokeWidth float64) (width, height float6
 	case LineArrowhead:
 		widthMultiplier = 5
 		heightMultiplier = 8
+	case TeeArrowhead:
+		baseWidth = 4
+		baseHeight = 10
+		widthMultiplier = 2
+		heightMultiplier = 4
+	case DoubleTriangleArrowhead:
+		baseWidth = 8
+		baseHeight = 4
+		widthMultiplier = 6
+		heightMultiplier = 4
 	case FilledDiamondArrowhead:
 		baseWidth = 11
 		baseHeight = 7
@@ -855,28 +926,36 @@ func NewPoint(x, y int) Point {
 }
 
 const (
-	ShapeRectangle       = "rectangle"
-	ShapeSquare          = "square"
-	ShapePage            = "page"
-	ShapeParallelogram   = "parallelogram"
-	ShapeDocument        = "document"
-	ShapeCylinder        = "cylinder"
-	ShapeQueue           = "queue"
-	ShapePackage         = "package"
-	ShapeStep            = "step"
-	ShapeCallout         = "callout"
-	ShapeStoredData      = "stored_data"
-	ShapePerson          = "person"
-	ShapeDiamond         = "diamond"
-	ShapeOval            = "oval"
-	ShapeCircle          = "circle"
-	ShapeHexagon         = "hexagon"
-	ShapeCloud           = "cloud"
+	ShapeRectangle     = "rectangle"
+	ShapeSquare        = "square"
+	ShapePage          = "page"
+	ShapeParallelogram = "parallelogram"
+	ShapeDocument      = "document"
+	ShapeCylinder      = "cylinder"
+	ShapeQueue         = "queue"
+	ShapePackage       = "package"
+	ShapeStep          = "step"
+	ShapeCallout       = "callout"
+	ShapeStoredData    = "stored_data"
+	ShapePerson        = "person"
+	ShapeDiamond       = "diamond"
+	ShapeOval          = "oval"
+	ShapeCircle        = "circle"
+	ShapeHexagon       = "hexagon"
+	ShapeCloud         = "cloud"
+	ShapeTriangle      = "triangle"
+	ShapeTrapezoid     = "trapezoid"
+	ShapeCross         = "cross"
+	ShapeActor         = "actor"
+	ShapeNote          = "note"
+	// ShapeCustom is drawn from the SVG of its shape-src
+	ShapeCustom          = "custom"
 	ShapeText            = "text"
 	ShapeCode            = "code"
 	ShapeClass           = "class"
 	ShapeSQLTable        = "sql_table"
 	ShapeImage           = "image"
+	ShapeBoard           = "board"
 	ShapeSequenceDiagram = "sequence_diagram"
 	ShapeHierarchy       = "hierarchy"
 )
@@ -899,15 +978,37 @@ var Shapes = []string{
 	ShapeCircle,
 	ShapeHexagon,
 	ShapeCloud,
+	ShapeTriangle,
+	ShapeTrapezoid,
+	ShapeCross,
+	ShapeActor,
+	ShapeNote,
+	ShapeCustom,
 	ShapeText,
 	ShapeCode,
 	ShapeClass,
 	ShapeSQLTable,
 	ShapeImage,
+	ShapeBoard,
 	ShapeSequenceDiagram,
 	ShapeHierarchy,
 }
 
+// Rows of sql_table and class shapes can be given these shapes to group the rows declared after them
+const (
+	// ShapeRowHeader rows show their label as a heading, e.g. "indexes" or "private members"
+	ShapeRowHeader = "header"
+	// ShapeRowSeparator rows are drawn as a divider line
+	ShapeRowSeparator = "separator"
+	// ShapeRowIndex rows are the indexes of sql_tables, drawn below their columns with the
+	// columns they're on as their label
+	ShapeRowIndex = "index"
+)
+
+func IsRowShape(s string) bool {
+	return strings.EqualFold(s, ShapeRowHeader) || strings.EqualFold(s, ShapeRowSeparator) || strings.EqualFold(s, ShapeRowIndex)
+}
+
 func IsShape(s string) bool {
 	if s == "" {
 		// Default shape is rectangle.
@@ -967,11 +1068,18 @@ var DSL_SHAPE_TO_SHAPE_TYPE = map[string]string{
 	ShapeCircle:          shape.CIRCLE_TYPE,
 	ShapeHexagon:         shape.HEXAGON_TYPE,
 	ShapeCloud:           shape.CLOUD_TYPE,
+	ShapeTriangle:        shape.TRIANGLE_TYPE,
+	ShapeTrapezoid:       shape.TRAPEZOID_TYPE,
+	ShapeCross:           shape.CROSS_TYPE,
+	ShapeActor:           shape.ACTOR_TYPE,
+	ShapeNote:            shape.NOTE_TYPE,
+	ShapeCustom:          shape.CUSTOM_TYPE,
 	ShapeText:            shape.TEXT_TYPE,
 	ShapeCode:            shape.CODE_TYPE,
 	ShapeClass:           shape.CLASS_TYPE,
 	ShapeSQLTable:        shape.TABLE_TYPE,
 	ShapeImage:           shape.IMAGE_TYPE,
+	ShapeBoard:           shape.SQUARE_TYPE,
 	ShapeSequenceDiagram: shape.SQUARE_TYPE,
 	ShapeHierarchy:       shape.SQUARE_TYPE,
 }
@@ -1,12 +1,19 @@
 package d2target
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/util-go/go2"
+)
 
 const (
 	NamePadding       = 10
 	TypePadding       = 20
 	ConstraintPadding = 20
 	HeaderPadding     = 10
+	// ConstraintIconGap is the space between the icons of a column's constraints
+	ConstraintIconGap = 4
 
 	// Setting table font size sets it for columns
 	// The header needs to be a little larger for visual hierarchy
@@ -15,6 +22,92 @@ const (
 
 type SQLTable struct {
 	Columns []SQLColumn `json:"columns"`
+	// Indexes are drawn in a compartment below the columns, see ShapeRowIndex
+	Indexes []SQLIndex `json:"indexes,omitempty"`
+	// MaxRows is how many columns are drawn before the rest are collapsed into a row saying how
+	// many more there are, if not 0
+	MaxRows int `json:"maxRows,omitempty"`
+}
+
+type SQLIndex struct {
+	Name Text `json:"name"`
+	// Columns are the columns the index is on, as written, e.g. "(last_name, first_name)"
+	Columns Text `json:"columns"`
+}
+
+func (idx SQLIndex) Texts(fontSize int) []*MText {
+	return []*MText{
+		{
+			Text:     idx.Name.Label,
+			FontSize: fontSize,
+			Shape:    "sql_table",
+		},
+		{
+			Text:     idx.Columns.Label,
+			FontSize: fontSize,
+			Shape:    "sql_table",
+		},
+	}
+}
+
+// VisibleColumns are the columns that are drawn, the rest are collapsed into one row
+func (t SQLTable) VisibleColumns() []SQLColumn {
+	if t.HiddenColumns() > 0 {
+		return t.Columns[:t.MaxRows]
+	}
+	return t.Columns
+}
+
+// HiddenColumns is how many columns are past MaxRows
+func (t SQLTable) HiddenColumns() int {
+	if t.MaxRows <= 0 || len(t.Columns) <= t.MaxRows {
+		return 0
+	}
+	return len(t.Columns) - t.MaxRows
+}
+
+// MoreText is the text of the row the hidden columns are collapsed into
+func (t SQLTable) MoreText() string {
+	return fmt.Sprintf("… %d more", t.HiddenColumns())
+}
+
+func (t SQLTable) MoreMText(fontSize int) *MText {
+	return &MText{
+		Text:     t.MoreText(),
+		FontSize: fontSize,
+		IsItalic: true,
+		Shape:    "sql_table",
+	}
+}
+
+// Rows is how many rows are below the header: the visible columns, the row the hidden ones are
+// collapsed into if there are any, and the indexes
+func (t SQLTable) Rows() int {
+	rows := len(t.VisibleColumns()) + len(t.Indexes)
+	if t.HiddenColumns() > 0 {
+		rows++
+	}
+	return rows
+}
+
+// DrawnRows are the rows below the header as columns, for renderers that draw them all alike:
+// the row the hidden columns are collapsed into is a header, and indexes have the columns
+// they're on as their type
+func (t SQLTable) DrawnRows() []SQLColumn {
+	rows := append([]SQLColumn(nil), t.VisibleColumns()...)
+	if t.HiddenColumns() > 0 {
+		rows = append(rows, SQLColumn{Name: Text{Label: t.MoreText()}, Shape: ShapeRowHeader})
+	}
+	for _, idx := range t.Indexes {
+		rows = append(rows, SQLColumn{Name: idx.Name, Type: idx.Columns})
+	}
+	return rows
+}
+
+// RowIndex returns the row below the header that the column at index is drawn in. Connections
+// to hidden columns go to the row they're collapsed into.
+func (t SQLTable) RowIndex(index int) int {
+	return go2.Min(index, len(t.VisibleColumns()))
 }
 
 type SQLColumn struct {
@@ -22,6 +115,8 @@ type SQLColumn struct {
 	Type       Text     `json:"type"`
 	Constraint []string `json:"constraint"`
 	Reference  string   `json:"reference"`
+	// Shape is set for rows that group columns rather than describe one, see ShapeRowHeader
+	Shape string `json:"shape,omitempty"`
 }
 
 func (c SQLColumn) Texts(fontSize int) []*MText {
@@ -41,7 +136,7 @@ func (c SQLColumn) Texts(fontSize int) []*MText {
 			Shape:    "sql_table",
 		},
 		{
-			Text:     c.ConstraintAbbr(),
+			Text:     c.ConstraintText(),
 			FontSize: fontSize,
 			IsBold:   false,
 			IsItalic: false,
@@ -68,3 +163,43 @@ func (c SQLColumn) ConstraintAbbr() string {
 
 	return strings.Join(constraints, ", ")
 }
+
+// ConstraintIcons are the constraints of c which are drawn as icons, those that ConstraintAbbr
+// abbreviates
+func (c SQLColumn) ConstraintIcons() []string {
+	var icons []string
+	for _, constraint := range c.Constraint {
+		switch constraint {
+		case "primary_key", "foreign_key", "unique":
+			icons = append(icons, constraint)
+		}
+	}
+	return icons
+}
+
+// ConstraintText is the text of the constraints of c which aren't drawn as icons
+func (c SQLColumn) ConstraintText() string {
+	var constraints []string
+	for _, constraint := range c.Constraint {
+		switch constraint {
+		case "primary_key", "foreign_key", "unique":
+		default:
+			constraints = append(constraints, constraint)
+		}
+	}
+	return strings.Join(constraints, ", ")
+}
+
+// ConstraintWidth is the width of the constraints of c, drawn with their icons fontSize wide
+// after the text of the others, given the width of that text
+func (c SQLColumn) ConstraintWidth(textWidth, fontSize int) int {
+	icons := len(c.ConstraintIcons())
+	if icons == 0 {
+		return textWidth
+	}
+	width := icons*fontSize + (icons-1)*ConstraintIconGap
+	if textWidth > 0 {
+		width += ConstraintIconGap + textWidth
+	}
+	return width
+}
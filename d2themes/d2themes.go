@@ -13,6 +13,33 @@ type Theme struct {
 	Colors ColorPalette `json:"colors"`
 
 	SpecialRules SpecialRules `json:"specialRules,omitempty"`
+
+	// Fonts and Styles are only set by themes loaded from files, see d2themescatalog.Load
+	Fonts  *Fonts  `json:"fonts,omitempty"`
+	Styles *Styles `json:"styles,omitempty"`
+}
+
+// Fonts are the paths to the .ttf files of a theme's font family
+type Fonts struct {
+	Regular  string `json:"regular,omitempty"`
+	Italic   string `json:"italic,omitempty"`
+	Bold     string `json:"bold,omitempty"`
+	Semibold string `json:"semibold,omitempty"`
+}
+
+// Styles are the default styles of a theme, for shapes and connections which don't set their own
+type Styles struct {
+	StrokeWidth int `json:"strokeWidth,omitempty"`
+	// Shapes are the styles of each shape type, like "cylinder", over the ones above
+	Shapes map[string]ShapeStyle `json:"shapes,omitempty"`
+}
+
+type ShapeStyle struct {
+	Fill         string `json:"fill,omitempty"`
+	Stroke       string `json:"stroke,omitempty"`
+	FontColor    string `json:"fontColor,omitempty"`
+	StrokeWidth  int    `json:"strokeWidth,omitempty"`
+	BorderRadius int    `json:"borderRadius,omitempty"`
 }
 
 type SpecialRules struct {
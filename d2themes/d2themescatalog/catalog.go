@@ -3,6 +3,7 @@ package d2themescatalog
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	"oss.terrastruct.com/d2/d2themes"
 )
@@ -32,7 +33,36 @@ var DarkCatalog = []d2themes.Theme{
 	DarkFlagshipTerrastruct,
 }
 
+// CustomCatalog are the themes registered at runtime, see Register
+var CustomCatalog []d2themes.Theme
+var customMu sync.RWMutex
+
+// Register adds theme to CustomCatalog, so it can be found by its ID like the built-in themes.
+// It replaces a theme registered before with the same ID, so themes can be reloaded. IDs from
+// 200 to 299 are dark themes.
+func Register(theme d2themes.Theme) error {
+	customMu.Lock()
+	defer customMu.Unlock()
+	for i, t := range CustomCatalog {
+		if t.ID == theme.ID {
+			CustomCatalog[i] = theme
+			return nil
+		}
+	}
+	if existing := find(theme.ID); existing != (d2themes.Theme{}) {
+		return fmt.Errorf("theme ID %d of %#v is already used by %#v", theme.ID, theme.Name, existing.Name)
+	}
+	CustomCatalog = append(CustomCatalog, theme)
+	return nil
+}
+
 func Find(id int64) d2themes.Theme {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	return find(id)
+}
+
+func find(id int64) d2themes.Theme {
 	for _, theme := range LightCatalog {
 		if theme.ID == id {
 			return theme
@@ -45,6 +75,12 @@ func Find(id int64) d2themes.Theme {
 		}
 	}
 
+	for _, theme := range CustomCatalog {
+		if theme.ID == id {
+			return theme
+		}
+	}
+
 	return d2themes.Theme{}
 }
 
@@ -61,5 +97,14 @@ func CLIString() string {
 		s.WriteString(fmt.Sprintf("- %s: %d\n", t.Name, t.ID))
 	}
 
+	customMu.RLock()
+	defer customMu.RUnlock()
+	if len(CustomCatalog) > 0 {
+		s.WriteString("Custom:\n")
+		for _, t := range CustomCatalog {
+			s.WriteString(fmt.Sprintf("- %s: %d\n", t.Name, t.ID))
+		}
+	}
+
 	return s.String()
 }
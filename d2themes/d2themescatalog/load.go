@@ -0,0 +1,251 @@
+package d2themescatalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/util-go/go2"
+
+	"oss.terrastruct.com/d2/d2ast"
+	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/d2themes"
+	"oss.terrastruct.com/d2/lib/color"
+)
+
+// Load reads a theme from a .json file, or a .d2 file with the same keys, like
+//
+//	id: 1000
+//	name: Acme
+//	colors: {
+//	  neutrals: {n1: "#0A0F25"; ...}
+//	  b1: "#0D32B2"
+//	  ...
+//	}
+//	styles.shapes.cylinder.fill: AA4
+//
+// Every color of the palette must be set. Colors in styles may also be those of the palette,
+// like AA4. Font paths are relative to the file.
+func Load(path string) (d2themes.Theme, error) {
+	theme, err := load(path)
+	if err != nil {
+		return d2themes.Theme{}, fmt.Errorf("failed to load theme %s: %w", path, err)
+	}
+	return theme, nil
+}
+
+// LoadDir loads the .json and .d2 themes in dir, in the order of their names
+func LoadDir(dir string) ([]d2themes.Theme, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	var themes []d2themes.Theme
+	for _, e := range entries {
+		switch filepath.Ext(e.Name()) {
+		case ".json", ".d2":
+		default:
+			continue
+		}
+		if e.IsDir() {
+			continue
+		}
+		theme, err := Load(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		themes = append(themes, theme)
+	}
+	return themes, nil
+}
+
+func load(path string) (d2themes.Theme, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return d2themes.Theme{}, err
+	}
+	if filepath.Ext(path) == ".d2" {
+		ast, err := d2parser.Parse(path, bytes.NewReader(b), nil)
+		if err != nil {
+			return d2themes.Theme{}, err
+		}
+		m, err := astToJSON(ast)
+		if err != nil {
+			return d2themes.Theme{}, err
+		}
+		b, err = json.Marshal(m)
+		if err != nil {
+			return d2themes.Theme{}, err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var theme d2themes.Theme
+	if err := dec.Decode(&theme); err != nil {
+		return d2themes.Theme{}, err
+	}
+	if err := validate(theme); err != nil {
+		return d2themes.Theme{}, err
+	}
+
+	if theme.Styles != nil && theme.Styles.Shapes != nil {
+		shapes := make(map[string]d2themes.ShapeStyle, len(theme.Styles.Shapes))
+		for shape, style := range theme.Styles.Shapes {
+			shapes[strings.ToLower(shape)] = style
+		}
+		theme.Styles.Shapes = shapes
+	}
+	if theme.Fonts != nil {
+		for _, font := range []*string{&theme.Fonts.Regular, &theme.Fonts.Italic, &theme.Fonts.Bold, &theme.Fonts.Semibold} {
+			if *font != "" && !filepath.IsAbs(*font) {
+				*font = filepath.Join(filepath.Dir(path), *font)
+			}
+		}
+	}
+	return theme, nil
+}
+
+func validate(theme d2themes.Theme) error {
+	if theme.Name == "" {
+		return fmt.Errorf(`"name" is required`)
+	}
+
+	// The palette is validated through its JSON, so its keys are named as they're written
+	b, err := json.Marshal(theme.Colors)
+	if err != nil {
+		return err
+	}
+	var palette map[string]interface{}
+	if err := json.Unmarshal(b, &palette); err != nil {
+		return err
+	}
+	neutrals := palette["neutrals"].(map[string]interface{})
+	delete(palette, "neutrals")
+	for _, group := range []struct {
+		prefix string
+		colors map[string]interface{}
+	}{{"colors", palette}, {"colors.neutrals", neutrals}} {
+		prefix, colors := group.prefix, group.colors
+		keys := make([]string, 0, len(colors))
+		for k := range colors {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := validateColor(fmt.Sprintf("%s.%s", prefix, k), colors[k].(string), false); err != nil {
+				return err
+			}
+		}
+	}
+
+	if theme.Styles == nil {
+		return nil
+	}
+	if theme.Styles.StrokeWidth < 0 || theme.Styles.StrokeWidth > 15 {
+		return fmt.Errorf(`"styles.strokeWidth" must be between 0 and 15, got %d`, theme.Styles.StrokeWidth)
+	}
+	for shape, style := range theme.Styles.Shapes {
+		if !d2target.IsShape(shape) {
+			return fmt.Errorf(`"styles.shapes.%s" is not a shape`, shape)
+		}
+		for _, c := range [][2]string{{"fill", style.Fill}, {"stroke", style.Stroke}, {"fontColor", style.FontColor}} {
+			if c[1] == "" {
+				continue
+			}
+			if err := validateColor(fmt.Sprintf("styles.shapes.%s.%s", shape, c[0]), c[1], true); err != nil {
+				return err
+			}
+		}
+		if style.StrokeWidth < 0 || style.StrokeWidth > 15 {
+			return fmt.Errorf(`"styles.shapes.%s.strokeWidth" must be between 0 and 15, got %d`, shape, style.StrokeWidth)
+		}
+		if style.BorderRadius < 0 {
+			return fmt.Errorf(`"styles.shapes.%s.borderRadius" must be 0 or more, got %d`, shape, style.BorderRadius)
+		}
+	}
+	return nil
+}
+
+func validateColor(key, value string, themeColors bool) error {
+	switch {
+	case value == "":
+		return fmt.Errorf("%#v is required", key)
+	case themeColors && color.IsThemeColor(value),
+		go2.Contains(color.NamedColors, strings.ToLower(value)),
+		color.ColorHexRegex.MatchString(value):
+		return nil
+	}
+	return fmt.Errorf("%#v is not a valid color, got %#v", key, value)
+}
+
+// astToJSON converts the keys and values of a D2 theme file into what they'd be in JSON
+func astToJSON(m *d2ast.Map) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	for _, n := range m.Nodes {
+		if n.MapKey == nil {
+			if n.Comment != nil || n.BlockComment != nil {
+				continue
+			}
+			return nil, fmt.Errorf("%s: only keys and values are allowed in theme files", n.Unbox().GetRange())
+		}
+		k := n.MapKey
+		if k.Key == nil || len(k.Edges) > 0 {
+			return nil, fmt.Errorf("%s: connections are not allowed in theme files", k.Range)
+		}
+		path := k.Key.IDA()
+		parent := out
+		for _, p := range path[:len(path)-1] {
+			child, ok := parent[p].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				parent[p] = child
+			}
+			parent = child
+		}
+		name := path[len(path)-1]
+
+		switch v := k.Value.Unbox().(type) {
+		case *d2ast.Map:
+			child, err := astToJSON(v)
+			if err != nil {
+				return nil, err
+			}
+			if existing, ok := parent[name].(map[string]interface{}); ok {
+				merge(existing, child)
+			} else {
+				parent[name] = child
+			}
+		case *d2ast.Number:
+			f, _ := v.Value.Float64()
+			parent[name] = f
+		case *d2ast.Boolean:
+			parent[name] = v.Value
+		case d2ast.String:
+			parent[name] = v.ScalarString()
+		default:
+			return nil, fmt.Errorf("%s: %#v needs a number, boolean, string or map", k.Range, strings.Join(path, "."))
+		}
+	}
+	return out, nil
+}
+
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		existing, ok := dst[k].(map[string]interface{})
+		child, childOK := v.(map[string]interface{})
+		if ok && childOK {
+			merge(existing, child)
+		} else {
+			dst[k] = v
+		}
+	}
+}
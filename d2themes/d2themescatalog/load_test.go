@@ -0,0 +1,114 @@
+package d2themescatalog_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+)
+
+const palette = `colors: {
+  neutrals: {n1: "#10162F"; n2: "#4A5068"; n3: "#7A8098"; n4: "#C4C8D8"; n5: "#DDE0EC"; n6: "#EEF0F7"; n7: "#FFFFFF"}
+  b1: "#4B0E6B"; b2: "#7A1FA2"; b3: "#B065D6"; b4: "#E3C8F2"; b5: "#F1E4F9"; b6: "#FAF4FD"
+  aa2: "#00695C"; aa4: "#26A69A"; aa5: "#80CBC4"
+  ab4: "#FF7043"; ab5: "#FFAB91"
+}
+`
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	assert.WriteFile(t, filepath.Join(dir, "acme.d2"), []byte(`id: 1000
+name: Acme
+`+palette+`
+colors.b1: "#000000"
+fonts.regular: fonts/acme.ttf
+styles.shapes.Cylinder.fill: AA5
+`), 0644)
+	assert.WriteFile(t, filepath.Join(dir, "README.md"), []byte("not a theme"), 0644)
+
+	themes, err := d2themescatalog.LoadDir(dir)
+	assert.Success(t, err)
+	assert.Equal(t, 1, len(themes))
+	theme := themes[0]
+	assert.Equal(t, int64(1000), theme.ID)
+	assert.Equal(t, "#000000", theme.Colors.B1)
+	assert.Equal(t, "#FFFFFF", theme.Colors.Neutrals.N7)
+	assert.Equal(t, filepath.Join(dir, "fonts/acme.ttf"), theme.Fonts.Regular)
+	assert.Equal(t, "AA5", theme.Styles.Shapes["cylinder"].Fill)
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		file  string
+		theme string
+		err   string
+	}{
+		{
+			name:  "missing_color",
+			file:  "theme.json",
+			theme: `{"id": 1000, "name": "Acme", "colors": {"b1": "#4B0E6B"}}`,
+			err:   `"colors.aa2" is required`,
+		},
+		{
+			name:  "unknown_key",
+			file:  "theme.json",
+			theme: `{"id": 1000, "name": "Acme", "colour": {}}`,
+			err:   `json: unknown field "colour"`,
+		},
+		{
+			name:  "not_a_shape",
+			file:  "theme.d2",
+			theme: "id: 1000\nname: Acme\n" + palette + "styles.shapes.blob.fill: AA5\n",
+			err:   `"styles.shapes.blob" is not a shape`,
+		},
+		{
+			name:  "bad_color",
+			file:  "theme.d2",
+			theme: "id: 1000\nname: Acme\n" + palette + "styles.shapes.circle.stroke: blurple\n",
+			err:   `"styles.shapes.circle.stroke" is not a valid color, got "blurple"`,
+		},
+		{
+			name:  "connection",
+			file:  "theme.d2",
+			theme: "a -> b\n",
+			err:   `{path}:1:1: connections are not allowed in theme files`,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), tc.file)
+			assert.Success(t, os.WriteFile(path, []byte(tc.theme), 0644))
+			_, err := d2themescatalog.Load(path)
+			assert.ErrorString(t, err, "failed to load theme "+path+": "+strings.ReplaceAll(tc.err, "{path}", path))
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	err := d2themescatalog.Register(d2themescatalog.Origami)
+	assert.ErrorString(t, err, `theme ID 302 of "Origami" is already used by "Origami"`)
+
+	theme := d2themescatalog.Origami
+	theme.ID = 1234
+	theme.Name = "Origami again"
+	assert.Success(t, d2themescatalog.Register(theme))
+	assert.Equal(t, "Origami again", d2themescatalog.Find(1234).Name)
+
+	theme.Name = "Origami reloaded"
+	assert.Success(t, d2themescatalog.Register(theme))
+	assert.Equal(t, "Origami reloaded", d2themescatalog.Find(1234).Name)
+}
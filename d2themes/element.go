@@ -182,6 +182,8 @@ func (el *ThemableElement) Render() string {
 	}
 	if color.IsThemeColor(el.Fill) {
 		class += fmt.Sprintf(" fill-%s", el.Fill)
+	} else if color.IsGradient(el.Fill) {
+		out += fmt.Sprintf(` fill="url(#%s)"`, color.GradientID(el.Fill))
 	} else if len(el.Fill) > 0 {
 		out += fmt.Sprintf(` fill="%s"`, el.Fill)
 	}
@@ -24,7 +24,16 @@ func (o *ThemableSketchOverlay) Render() (string, error) {
 	if color.IsThemeColor(o.fill) {
 		o.el.ClassName += fmt.Sprintf(" sketch-overlay-%s", o.fill) // e.g. sketch-overlay-B3
 	} else {
-		lc, err := color.LuminanceCategory(o.fill)
+		fill := o.fill
+		if color.IsGradient(fill) {
+			// Shaded for the color the gradient starts with
+			g, err := color.ParseGradient(fill)
+			if err != nil {
+				return "", err
+			}
+			fill = g.Stops[0].Color
+		}
+		lc, err := color.LuminanceCategory(fill)
 		if err != nil {
 			return "", err
 		}
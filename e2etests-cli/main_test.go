@@ -3,10 +3,12 @@ package e2etests_cli
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -21,6 +23,7 @@ import (
 	"oss.terrastruct.com/util-go/xos"
 
 	"oss.terrastruct.com/d2/d2cli"
+	fontlib "oss.terrastruct.com/d2/lib/font"
 	"oss.terrastruct.com/d2/lib/pptx"
 	"oss.terrastruct.com/d2/lib/xgif"
 )
@@ -46,6 +49,221 @@ func TestCLI_E2E(t *testing.T) {
 				testdataIgnoreDiff(t, ".png", png)
 			},
 		},
+		{
+			name:   "hello_world_jpg",
+			skipCI: true,
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--quality=80", "hello-world.d2", "hello-world.jpg")
+				assert.Success(t, err)
+				jpg := readFile(t, dir, "hello-world.jpg")
+				testdataIgnoreDiff(t, ".jpg", jpg)
+			},
+		},
+		{
+			name: "invalid_quality",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--quality=0", "hello-world.d2", "hello-world.jpg")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --quality must be between 1 and 100.
+You provided: 0`)
+			},
+		},
+		{
+			name: "invalid_bundle_icons",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--bundle-icons=always", "hello-world.d2", "hello-world.svg")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --bundle-icons must be one of cache, inline, or skip.
+You provided: always`)
+			},
+		},
+		{
+			name: "invalid_render_timeout",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--render-timeout=-1", "hello-world.d2", "hello-world.png")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --render-timeout must be 0 or greater.
+You provided: -1`)
+			},
+		},
+		{
+			name:   "crop_png",
+			skipCI: true,
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `container: {
+  a -> b
+}
+c`)
+				err := runTestMain(t, ctx, dir, env, "--crop=container.a", "hello-world.d2", "hello-world.png")
+				assert.Success(t, err)
+				png := readFile(t, dir, "hello-world.png")
+				testdataIgnoreDiff(t, ".png", png)
+			},
+		},
+		{
+			name: "invalid_crop",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--crop=x", "hello-world.d2", "hello-world.svg")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --crop can only be used when exporting to PNG, JPEG, or WebP.
+You provided: .svg`)
+			},
+		},
+		{
+			name:   "image_map_png",
+			skipCI: true,
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y
+x.tooltip: hello
+y.link: https://d2lang.com`)
+				err := runTestMain(t, ctx, dir, env, "--image-map=html", "hello-world.d2", "hello-world.png")
+				assert.Success(t, err)
+				imageMap := string(readFile(t, dir, "hello-world.map.html"))
+				assert.True(t, strings.HasPrefix(imageMap, "<!DOCTYPE html>"))
+				assert.True(t, strings.Contains(imageMap, `<img src="hello-world.png"`))
+				assert.True(t, strings.Contains(imageMap, `href="https://d2lang.com" alt="y">`))
+				assert.True(t, strings.Contains(imageMap, `title="hello" alt="x">`))
+			},
+		},
+		{
+			name: "invalid_image_map",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--image-map=html", "hello-world.d2", "hello-world.svg")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --image-map can only be used when exporting to PNG, JPEG, or WebP.
+You provided: .svg`)
+				err = runTestMain(t, ctx, dir, env, "--image-map=xml", "hello-world.d2", "hello-world.png")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --image-map must be html or json, got "xml"`)
+			},
+		},
+		{
+			name: "collapse_focus",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `backend: {
+  api -> db
+}
+frontend: {web}
+frontend.web -> backend.api
+users -> frontend
+admin -> users`)
+				err := runTestMain(t, ctx, dir, env, "--collapse=backend", "--focus=frontend", "hello-world.d2", "hello-world.svg")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "hello-world.svg")
+				assert.Testdata(t, ".svg", svg)
+			},
+		},
+		{
+			name: "invalid_collapse",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--collapse=z", "hello-world.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: failed to compile hello-world.d2: cannot collapse "z": no board has it`)
+				err = runTestMain(t, ctx, dir, env, "--depth=-1", "hello-world.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --depth must be 0 or more, got -1`)
+			},
+		},
+		{
+			name: "quantize",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y: hi
+y: {shape: circle}
+z.style.multiple: true`)
+				err := runTestMain(t, ctx, dir, env, "--quantize=0.5", "hello-world.d2", "hello-world.svg")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "hello-world.svg")
+				assert.Testdata(t, ".svg", svg)
+			},
+		},
+		{
+			name: "invalid_quantize",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--quantize=0.3", "hello-world.d2", "hello-world.svg")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --quantize step must divide 1 evenly, e.g. 1, 0.5, or 0.1, got 0.3`)
+			},
+		},
+		{
+			name: "vector_pdf",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "in.d2", `label: vectors
+direction: right
+a: rounded {
+  style.border-radius: 8
+  style.fill: "#fde"
+}
+b: oval {shape: oval}
+c: cloud {shape: cloud}
+d: hexagon {
+  shape: hexagon
+  style.stroke-dash: 3
+}
+e: {
+  shape: cylinder
+  f: {shape: diamond}
+}
+a -> b: on the edge {
+  source-arrowhead: 1
+  target-arrowhead: * {shape: diamond}
+}
+b -> c: {
+  style.animated: true
+  target-arrowhead.shape: circle
+}
+c <-> d: {
+  source-arrowhead.shape: arrow
+  target-arrowhead: {shape: circle; style.filled: true}
+}
+d -> e.f: "multiple\nlines" {
+  style.stroke: red
+}
+a.link: layers.l
+layers: {
+  l: {
+    x -> y: {target-arrowhead.shape: triangle; target-arrowhead.style.filled: false}
+  }
+}
+`)
+				// Boards the vector renderer supports don't start a browser, so this doesn't need skipCI
+				err := runTestMain(t, ctx, dir, env, "--pdf-renderer=auto", "in.d2", "out.pdf")
+				assert.Success(t, err)
+
+				pdf := readFile(t, dir, "out.pdf")
+				if bytes.Contains(pdf, []byte("/Subtype /Image")) {
+					t.Fatal("expected boards to be drawn as vectors, not images")
+				}
+				testdataIgnoreDiff(t, ".pdf", pdf)
+			},
+		},
+		{
+			name:   "vector_pdf_fallback",
+			skipCI: true,
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "in.d2", `x -> y
+layers: {
+  tables: {
+    users: {
+      shape: sql_table
+      id: int {constraint: primary_key}
+    }
+  }
+}
+`)
+				err := runTestMain(t, ctx, dir, env, "--pdf-renderer=auto", "in.d2", "out.pdf")
+				assert.Success(t, err)
+
+				pdf := readFile(t, dir, "out.pdf")
+				testdataIgnoreDiff(t, ".pdf", pdf)
+			},
+		},
+		{
+			name: "invalid_pdf_renderer",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "in.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--pdf-renderer=canvas", "in.d2", "out.pdf")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --pdf-renderer must be browser or auto, got "canvas"`)
+			},
+		},
 		{
 			name:   "hello_world_png_pad",
 			skipCI: true,
@@ -67,6 +285,231 @@ func TestCLI_E2E(t *testing.T) {
 				assert.Testdata(t, ".svg", svg)
 			},
 		},
+		{
+			name: "excalidraw",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y: hi`)
+				err := runTestMain(t, ctx, dir, env, "hello-world.d2", "hello-world.excalidraw")
+				assert.Success(t, err)
+				excalidraw := readFile(t, dir, "hello-world.excalidraw")
+				assert.Testdata(t, ".excalidraw", excalidraw)
+			},
+		},
+		{
+			name: "structurizr",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "shop.d2", `customer: {shape: person}
+shop: {
+  web
+  api: {
+    orders
+  }
+  db: {shape: cylinder}
+  web -> api -> db
+}
+customer -> shop.web: browses
+`)
+				err := runTestMain(t, ctx, dir, env, "shop.d2", "shop.dsl")
+				assert.Success(t, err)
+				dsl := readFile(t, dir, "shop.dsl")
+				assert.Testdata(t, ".dsl", dsl)
+			},
+		},
+		{
+			name: "graphml",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x: {y -> z: hi}
+x.z -> w`)
+				err := runTestMain(t, ctx, dir, env, "--format=graphml", "hello-world.d2", "hello-world.xml")
+				assert.Success(t, err)
+				graphml := readFile(t, dir, "hello-world.xml")
+				assert.Testdata(t, ".graphml", graphml)
+			},
+		},
+		{
+			name: "gexf",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x: {y -> z: hi}
+x.z -> w`)
+				err := runTestMain(t, ctx, dir, env, "hello-world.d2", "hello-world.gexf")
+				assert.Success(t, err)
+				gexf := readFile(t, dir, "hello-world.gexf")
+				assert.Testdata(t, ".gexf", gexf)
+			},
+		},
+		{
+			name: "txt",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `shape: sequence_diagram
+client -> server: GET /
+server -> client: 200 OK`)
+				err := runTestMain(t, ctx, dir, env, "--format=txt", "hello-world.d2")
+				assert.Success(t, err)
+				txt := readFile(t, dir, "hello-world.txt")
+				assert.Testdata(t, ".txt", txt)
+			},
+		},
+		{
+			name: "txt_not_sequence_diagram",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "hello-world.d2", "hello-world.txt")
+				assert.Error(t, err)
+				assert.True(t, strings.Contains(err.Error(), "only sequence diagrams can be rendered as text"))
+			},
+		},
+		{
+			name: "json",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x: {y -> z: hi}
+layers: {
+  detail: {
+    w.style.fill: red
+  }
+}`)
+				err := runTestMain(t, ctx, dir, env, "hello-world.d2", "hello-world.json")
+				assert.Success(t, err)
+				json := readFile(t, dir, "hello-world.json")
+				assert.Testdata(t, ".json", json)
+			},
+		},
+		{
+			name: "format-default-output",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMainPersist(t, ctx, dir, env, "--format=gexf", "hello-world.d2")
+				assert.Success(t, err)
+				readFile(t, dir, "hello-world.gexf")
+			},
+		},
+		{
+			name: "format-unknown",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--format=dot", "hello-world.d2")
+				assert.ErrorString(t, err, "failed to wait xmain test: e2etests-cli/d2: bad usage: --format must be one of svg, png, pdf, pptx, gif, jpg, jpeg, webp, excalidraw, dsl, graphml, gexf, json, or txt.\nYou provided: dot")
+			},
+		},
+		{
+			name: "icon-attribution",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `lambda.icon: https://icons.terrastruct.com/aws%2FCompute%2FAWS-Lambda.svg
+github.icon: https://cdn.simpleicons.org/github
+layers: {
+  detail: {
+    go.icon: https://cdn.jsdelivr.net/gh/devicons/devicon/icons/go/go-original.svg
+    logo: {
+      shape: image
+      icon: https://example.com/logo.png
+    }
+  }
+}`)
+				err := runTestMain(t, ctx, dir, env, "--bundle=false", "--icon-attribution=attribution.json", "--icon-attribution-footer", "hello-world.d2", "hello-world.svg")
+				assert.Success(t, err)
+				attribution := readFile(t, dir, "attribution.json")
+				assert.Testdata(t, ".json", attribution)
+
+				svg := string(readFile(t, dir, "hello-world/index.svg"))
+				assert.True(t, strings.Contains(svg, `class="attribution"`))
+				assert.True(t, strings.Contains(svg, "1 icon from AWS Architecture Icons"))
+				layer := string(readFile(t, dir, "hello-world/detail.svg"))
+				assert.True(t, strings.Contains(layer, "1 icon from Devicon"))
+				assert.True(t, strings.Contains(layer, "1 icon from an unknown source"))
+			},
+		},
+		{
+			name: "icon-attribution-footer-pdf",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--icon-attribution-footer", "hello-world.d2", "hello-world.pdf")
+				assert.ErrorString(t, err, "failed to wait xmain test: e2etests-cli/d2: bad usage: --icon-attribution-footer can only be used when exporting to SVG, PNG, JPEG, or WebP.\nYou provided: .pdf")
+			},
+		},
+		{
+			name: "report",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y
+layers: {
+  z: {
+    a
+  }
+}`)
+				err := runTestMain(t, ctx, dir, env, "--report=report.json", "hello-world.d2")
+				assert.Success(t, err)
+				report := readFile(t, dir, "report.json")
+				assert.Testdata(t, ".json", report)
+			},
+		},
+		{
+			name: "report_errors",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x: {
+  shape: bad
+}
+y -> z: {
+  style.opacity: 2
+}`)
+				err := runTestMain(t, ctx, dir, env, "--report=report.json", "hello-world.d2")
+				assert.Error(t, err)
+				report := readFile(t, dir, "report.json")
+				assert.Testdata(t, ".json", report)
+			},
+		},
+		{
+			name: "diagnostics_json",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x: {
+  shape: rectangel
+}
+y -> z: {
+  style.opacity: 2
+  style.fil: red
+}
+w: "unterminated
+`)
+				stderr := &bytes.Buffer{}
+				tms := testMain(dir, env, "--diagnostics=json", "hello-world.d2")
+				tms.Stderr = stderr
+				tms.Start(t, ctx)
+				defer tms.Cleanup(t)
+				err := tms.Wait(ctx)
+				assert.Error(t, err)
+				assert.Testdata(t, ".jsonl", stderr.Bytes())
+			},
+		},
+		{
+			name: "deny_warnings",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `classes: {
+  unused: {style.fill: red}
+}
+x -> y
+x -> y
+# d2-ignore
+x -> y
+`)
+				stderr := &bytes.Buffer{}
+				tms := testMain(dir, env, "--deny-warnings", "hello-world.d2")
+				tms.Stderr = stderr
+				tms.Start(t, ctx)
+				defer tms.Cleanup(t)
+				err := tms.Wait(ctx)
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: failed to compile hello-world.d2: 2 warnings, and --deny-warnings is set`)
+				assert.True(t, strings.Contains(stderr.String(), `hello-world.d2:2:3: class "unused" is never used (unused-class)`))
+				assert.True(t, strings.Contains(stderr.String(), `hello-world.d2:5:1: connection (x -> y)[1] duplicates (x -> y)[0]`))
+				assert.False(t, strings.Contains(stderr.String(), `hello-world.d2:7:1`))
+				_, err = os.Stat(filepath.Join(dir, "hello-world.svg"))
+				assert.True(t, os.IsNotExist(err))
+			},
+		},
+		{
+			name: "invalid_report",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--report=-", "hello-world.d2", "-")
+				assert.ErrorString(t, err, "failed to wait xmain test: e2etests-cli/d2: bad usage: --report cannot be written to stdout when the output is also written to stdout")
+			},
+		},
 		{
 			name: "flags-panic",
 			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
@@ -83,6 +526,50 @@ func TestCLI_E2E(t *testing.T) {
 				assert.Success(t, err)
 			},
 		},
+		{
+			name: "board_selection",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "in.d2", `x -> y
+layers: {
+  a: {
+    p -> q
+  }
+}
+scenarios: {
+  prod: {
+    x -> z
+    steps: {
+      1: {z -> w}
+    }
+  }
+}
+`)
+				// Boards that aren't selected keep their previous exports
+				writeFile(t, dir, "out/layers/a.svg", "stale")
+				err := runTestMain(t, ctx, dir, env, "--board=scenarios/prod/*", "in.d2", "out.svg")
+				assert.Success(t, err)
+
+				assert.Equal(t, "stale", string(readFile(t, dir, "out/layers/a.svg")))
+				svg := readFile(t, dir, "out/scenarios/prod/1.svg")
+				assert.Testdata(t, ".svg", svg)
+				for _, p := range []string{"out/index.svg", "out/scenarios/prod/index.svg"} {
+					_, err = os.Stat(filepath.Join(dir, p))
+					if !os.IsNotExist(err) {
+						t.Fatalf("expected %s not to be rendered: %v", p, err)
+					}
+				}
+			},
+		},
+		{
+			name: "invalid_board",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "in.d2", `x -> y`)
+				err := runTestMain(t, ctx, dir, env, "--board=layers/*", "--target=layers.x", "in.d2", "out.svg")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --board cannot be combined with --target`)
+				err = runTestMain(t, ctx, dir, env, "--board=layers/*", "in.d2", "out.svg")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: failed to compile in.d2: no boards match layers/*`)
+			},
+		},
 		{
 			name: "layer-link",
 			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
@@ -145,6 +632,182 @@ steps: {
 				assert.Testdata(t, ".svg", svg)
 			},
 		},
+		{
+			name: "animation-transition",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "animation.d2", `steps: {
+  1: {
+    Approach road
+  }
+  2: {
+    Approach road -> Cross road
+  }
+  3: {
+    Cross road -> Make you wonder why
+  }
+}
+`)
+				err := runTestMain(t, ctx, dir, env, "--animate-interval=1400", "--animate-transition=400", "animation.d2")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "animation.svg")
+				assert.Testdata(t, ".svg", svg)
+			},
+		},
+		{
+			name: "animation-transition-too-long",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "x.d2", "x -> y")
+				err := runTestMain(t, ctx, dir, env, "--animate-interval=1400", "--animate-transition=1400", "x.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --animate-transition must be greater than 0 and less than --animate-interval.
+You provided: 1400`)
+			},
+		},
+		{
+			name: "compact",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "compact.d2", `a -> b -> c -> d
+a -> e: a label
+e -> d
+x -> y
+`)
+				err := runTestMain(t, ctx, dir, env, "--compact", "compact.d2")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "compact.svg")
+				assert.Testdata(t, ".svg", svg)
+			},
+		},
+		{
+			name: "highlight-steps",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "walkthrough.d2", `steps: {
+  1: {
+    a -> b
+  }
+  2: {
+    b -> c
+  }
+  3: {
+    b: null
+  }
+}
+`)
+				err := runTestMain(t, ctx, dir, env, "--highlight-steps", "walkthrough.d2")
+				assert.Success(t, err)
+				assert.False(t, strings.Contains(string(readFile(t, dir, "walkthrough/1.svg")), "#0D9F4F"))
+				assert.True(t, strings.Contains(string(readFile(t, dir, "walkthrough/2.svg")), "#0D9F4F"))
+				step3 := string(readFile(t, dir, "walkthrough/3.svg"))
+				assert.False(t, strings.Contains(step3, "#0D9F4F"))
+				assert.True(t, strings.Contains(step3, "opacity:0.3"))
+			},
+		},
+		{
+			name: "board-shape",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "overview.d2", `x -> detail
+detail: {
+  shape: board
+  board: layers.detail
+}
+layers: {
+  detail: {
+    a -> b
+  }
+}
+`)
+				err := runTestMain(t, ctx, dir, env, "overview.d2")
+				assert.Success(t, err)
+				svg := string(readFile(t, dir, "overview/index.svg"))
+				assert.True(t, strings.Contains(svg, `<image href="data:image/svg+xml;base64,`))
+				assert.True(t, strings.Contains(svg, `<a href="detail.svg"`))
+			},
+		},
+		{
+			name: "source-map",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "source.d2", `a -> b
+b: {
+  shape: cylinder
+}
+`)
+				err := runTestMainPersist(t, ctx, dir, env, "source.d2")
+				assert.Success(t, err)
+				assert.False(t, strings.Contains(string(readFile(t, dir, "source.svg")), "data-d2-loc"))
+
+				err = runTestMain(t, ctx, dir, env, "--source-map", "source.d2")
+				assert.Success(t, err)
+				svg := string(readFile(t, dir, "source.svg"))
+				assert.True(t, strings.Contains(svg, `source.d2:1:1"`))
+				assert.True(t, strings.Contains(svg, `source.d2:1:6"`))
+			},
+		},
+		{
+			name: "cross-board-edge",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "system.d2", `api -> layers.infra.db: queries
+layers: {
+  infra: {
+    db: {shape: cylinder}
+  }
+}
+`)
+				err := runTestMain(t, ctx, dir, env, "system.d2")
+				assert.Success(t, err)
+				svg := string(readFile(t, dir, "system/index.svg"))
+				assert.True(t, strings.Contains(svg, `<a href="infra.svg"`))
+				assert.True(t, strings.Contains(svg, `>db</text>`))
+			},
+		},
+		{
+			name: "medium-slide",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "slide.d2", `backend: {
+  api -> db: queries
+}
+user -> backend.api
+`)
+				err := runTestMain(t, ctx, dir, env, "--medium=slide", "slide.d2")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "slide.svg")
+				assert.Testdata(t, ".svg", svg)
+			},
+		},
+		{
+			name: "medium-unknown",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "x.d2", "x -> y")
+				err := runTestMain(t, ctx, dir, env, "--medium=billboard", "x.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --medium: unknown medium "billboard", expected one of (screen, print, slide)`)
+			},
+		},
+		{
+			name: "target-ratio",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "x.d2", `a -> b -> c -> d -> e -> f -> g -> h -> i -> j
+x -> y
+x -> z
+`)
+				err := runTestMain(t, ctx, dir, env, "--target-ratio=16:9", "x.d2", "x.svg")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "x.svg")
+				assert.Testdata(t, ".svg", svg)
+			},
+		},
+		{
+			name: "target-ratio-invalid",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "x.d2", "x -> y")
+				err := runTestMain(t, ctx, dir, env, "--target-ratio=wide", "x.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --target-ratio: expected a ratio like 16:9 or 1.5, got "wide"`)
+			},
+		},
+		{
+			name: "snap-negative",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "x.d2", "x -> y")
+				err := runTestMain(t, ctx, dir, env, "--snap=-8", "x.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --snap must be 0 or more, got -8`)
+			},
+		},
 		{
 			name: "vars-animation",
 			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
@@ -219,6 +882,33 @@ a -> b: italic font
 				assert.Testdata(t, ".svg", svg)
 			},
 		},
+		{
+			name: "with-woff-font",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "font.d2", `a: Why do computers get sick often?
+b: Because their Windows are always open!
+a -> b: italic font
+`)
+				ttf, err := os.ReadFile("RockSalt-Regular.ttf")
+				assert.Success(t, err)
+				woff, err := fontlib.Sfnt2Woff(ttf)
+				assert.Success(t, err)
+				writeFile(t, dir, "RockSalt-Regular.woff", string(woff))
+				err = runTestMain(t, ctx, dir, env, "--font-regular="+filepath.Join(dir, "RockSalt-Regular.woff"), "font.d2")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "font.svg")
+				assert.Testdata(t, ".svg", svg)
+			},
+		},
+		{
+			name: "font-unsupported",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "x.d2", `x -> y`)
+				writeFile(t, dir, "font.otf", "")
+				err := runTestMain(t, ctx, dir, env, "--font-regular=font.otf", "x.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: failed to load specified fonts: expected .ttf or .woff file but font.otf has extension .otf`)
+			},
+		},
 		{
 			name: "incompatible-animation",
 			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
@@ -350,6 +1040,178 @@ layers: {
 				assert.Testdata(t, ".svg", svg)
 			},
 		},
+		{
+			name: "stylesheet",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "styles/corp.d2css", `# Shared by every diagram of the repository
+classes: {
+  service: {
+    shape: hexagon
+    style.fill: "#E3F2FD"
+  }
+  queue: {
+    shape: queue
+    style.stroke: "#6A1B9A"
+  }
+}
+`)
+				writeFile(t, dir, "x.d2", `classes.queue.style.stroke: "#2E7D32"
+
+api.class: service
+jobs.class: queue
+api -> jobs
+
+layers: {
+  billing: {
+    invoices.class: service
+  }
+}
+`)
+				err := runTestMain(t, ctx, dir, env, "--stylesheet=styles/corp.d2css", "x.d2", "x.svg")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "x/index.svg")
+				assert.NotEqual(t, -1, strings.Index(string(svg), "#E3F2FD"))
+				// The diagram's own classes override the stylesheet
+				assert.Equal(t, -1, strings.Index(string(svg), "#6A1B9A"))
+				// and layers use the stylesheet too
+				svg = readFile(t, dir, "x/billing.svg")
+				assert.NotEqual(t, -1, strings.Index(string(svg), "#E3F2FD"))
+				assert.TestdataDir(t, filepath.Join(dir, "x"))
+			},
+		},
+		{
+			name: "stylesheet-not-classes",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "corp.d2css", `classes.service.shape: hexagon
+logo: {shape: image}
+`)
+				writeFile(t, dir, "x.d2", "x -> y")
+				err := runTestMain(t, ctx, dir, env, "--stylesheet=corp.d2css", "x.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: failed to compile x.d2: `+filepath.Join(dir, "corp.d2css")+`:2:1: stylesheets can only define classes`)
+			},
+		},
+		{
+			name: "icon-dir",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "icons/aws/s3.svg", `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10" fill="#7AA116"/></svg>`)
+				writeFile(t, dir, "assets/db.svg", `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><circle cx="5" cy="5" r="5" fill="#C925D1"/></svg>`)
+				writeFile(t, dir, "x.d2", `s3.icon: @aws/s3
+db.icon: ./assets/db.svg
+s3 -> db
+`)
+				err := runTestMain(t, ctx, dir, env, "--bundle=false", "--icon-dir=icons", "x.d2", "x.svg")
+				assert.Success(t, err)
+				svg := string(readFile(t, dir, "x.svg"))
+				// Inlined even without bundling
+				assert.Equal(t, 2, strings.Count(svg, `href="data:image/svg+xml;base64,`))
+			},
+		},
+		{
+			name: "help",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				for _, args := range [][]string{{"--help"}, {"fmt", "--help"}} {
+					stdout := &bytes.Buffer{}
+					tms := testMain(dir, env, args...)
+					tms.Stdout = stdout
+					tms.Start(t, ctx)
+					defer tms.Cleanup(t)
+					err := tms.Wait(ctx)
+					assert.Success(t, err)
+					assert.True(t, strings.Contains(stdout.String(), "--hide-layer-groups names"))
+				}
+			},
+		},
+		{
+			name: "icons-search",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				stdout := &bytes.Buffer{}
+				tms := testMain(dir, env, "icons", "search", "lambda")
+				tms.Stdout = stdout
+				tms.Start(t, ctx)
+				defer tms.Cleanup(t)
+				err := tms.Wait(ctx)
+				assert.Success(t, err)
+				assert.Equal(t, "aws/lambda - https://icons.terrastruct.com/aws%2FCompute%2FAWS-Lambda.svg\n", stdout.String())
+			},
+		},
+		{
+			name: "icon-dir-missing",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "x.d2", `s3.icon: @aws/s3`)
+				err := runTestMain(t, ctx, dir, env, "x.d2", "x.svg")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: failed to compile x.d2: `+filepath.Join(dir, "x.d2")+`:1:10: bad icon "@aws/s3": icon packs need an icon directory`)
+			},
+		},
+		{
+			name: "theme-dark",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "x.d2", "x -> y")
+				err := runTestMain(t, ctx, dir, env, "--theme-dark=200", "x.d2", "x.svg")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "x.svg")
+				assert.Testdata(t, ".svg", svg)
+				if !strings.Contains(string(svg), "prefers-color-scheme:dark") {
+					t.Fatal("expected dark theme styles")
+				}
+			},
+		},
+		{
+			name: "theme-path",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "themes/acme.d2", `# Acme's brand theme
+id: 1000
+name: Acme
+colors: {
+  neutrals: {
+    n1: "#10162F"
+    n2: "#4A5068"
+    n3: "#7A8098"
+    n4: "#C4C8D8"
+    n5: "#DDE0EC"
+    n6: "#EEF0F7"
+    n7: "#FFFFFF"
+  }
+  b1: "#4B0E6B"
+  b2: "#7A1FA2"
+  b3: "#B065D6"
+  b4: "#E3C8F2"
+  b5: "#F1E4F9"
+  b6: "#FAF4FD"
+  aa2: "#00695C"
+  aa4: "#26A69A"
+  aa5: "#80CBC4"
+  ab4: "#FF7043"
+  ab5: "#FFAB91"
+}
+styles: {
+  strokeWidth: 1
+  shapes.cylinder: {
+    fill: AA5
+    stroke: AA2
+    fontColor: N1
+  }
+}
+`)
+				writeFile(t, dir, "x.d2", `app -> db: queries
+db: {shape: cylinder}
+cache: {shape: cylinder; style.fill: "#FFE0B2"}
+`)
+				err := runTestMain(t, ctx, dir, env, "--theme-path=themes", "--theme=1000", "x.d2", "x.svg")
+				assert.Success(t, err)
+				svg := readFile(t, dir, "x.svg")
+				assert.Testdata(t, ".svg", svg)
+				assert.NotEqual(t, -1, strings.Index(string(svg), "#4B0E6B"))
+			},
+		},
+		{
+			name: "theme-path-invalid",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "acme.json", `{"id": 1001, "name": "Acme", "colors": {"b1": "#4B0E6B"}}`)
+				writeFile(t, dir, "x.d2", "x -> y")
+				err := runTestMain(t, ctx, dir, env, "--theme-path=acme.json", "x.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --theme-path: failed to load theme `+filepath.Join(dir, "acme.json")+`: "colors.aa2" is required`)
+			},
+		},
 		{
 			name: "theme-override",
 			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
@@ -711,6 +1573,83 @@ steps: {
 				assert.Testdata(t, ".svg", svg)
 			},
 		},
+		{
+			name: "import_remote",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git isn't installed")
+				}
+				repo := filepath.Join(dir, "repo")
+				writeFile(t, repo, "lib/db.d2", `db.shape: cylinder`)
+				for _, args := range [][]string{
+					{"init", "-q"},
+					{"add", "-A"},
+					{"-c", "user.name=d2", "-c", "user.email=d2@example.com", "commit", "-q", "-m", "db"},
+					{"tag", "v1"},
+				} {
+					out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+					if err != nil {
+						t.Fatalf("git %s: %v\n%s", args[0], err, out)
+					}
+				}
+				url := "git+file://" + filepath.ToSlash(repo) + "//lib/db.d2@v1"
+				writeFile(t, dir, "hello-world.d2", fmt.Sprintf("...@%q\nx -> db", url))
+				env.Setenv("GIT_ALLOW_PROTOCOL", "file")
+
+				err := runTestMainPersist(t, ctx, dir, env, "--frozen", "hello-world.d2")
+				assert.Error(t, err)
+				assert.Equal(t, true, strings.HasSuffix(err.Error(), fmt.Sprintf(`%s isn't pinned in d2.lock, which isn't updated when frozen`, url)))
+
+				// --frozen sets D2_FROZEN
+				env = xos.NewEnv([]string{"GIT_ALLOW_PROTOCOL=file"})
+				err = runTestMainPersist(t, ctx, dir, env, "hello-world.d2")
+				assert.Success(t, err)
+				lock := string(readFile(t, dir, "d2.lock"))
+				assert.Equal(t, true, strings.Contains(lock, fmt.Sprintf(`%q: {`, url)))
+
+				err = runTestMain(t, ctx, dir, env, "--frozen", "hello-world.d2")
+				assert.Success(t, err)
+			},
+		},
+		{
+			name: "import_remote_git_options",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				pwned := filepath.Join(dir, "pwned")
+				writeFile(t, dir, "hello-world.d2", fmt.Sprintf("x: {...@%q}", "git+--upload-pack=touch "+pwned+";://h//a.d2@."))
+				err := runTestMain(t, ctx, dir, env, "hello-world.d2")
+				assert.Error(t, err)
+				_, err = os.Stat(pwned)
+				assert.Equal(t, true, os.IsNotExist(err))
+			},
+		},
+		{
+			name: "define",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "hello-world.d2", `vars: {
+  env: staging
+}
+api: api (${env})
+if: env == prod {
+  cdn -> api
+}`)
+				err := runTestMainPersist(t, ctx, dir, env, "--define", "env=prod", "hello-world.d2")
+				assert.Success(t, err)
+				svg := string(readFile(t, dir, "hello-world.svg"))
+				assert.Equal(t, true, strings.Contains(svg, "api (prod)"))
+				assert.Equal(t, true, strings.Contains(svg, "cdn"))
+
+				// --define sets D2_DEFINE
+				env = xos.NewEnv(nil)
+				err = runTestMainPersist(t, ctx, dir, env, "hello-world.d2")
+				assert.Success(t, err)
+				svg = string(readFile(t, dir, "hello-world.svg"))
+				assert.Equal(t, true, strings.Contains(svg, "api (staging)"))
+				assert.Equal(t, false, strings.Contains(svg, "cdn"))
+
+				err = runTestMain(t, ctx, dir, env, "--define", "prod", "hello-world.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: bad usage: --define: expected name=value, got "prod"`)
+			},
+		},
 		{
 			name: "chain_import",
 			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
@@ -880,6 +1819,316 @@ layers: {
 				assert.Equal(t, "x -> y\n", string(gotBar))
 			},
 		},
+		{
+			name: "fmt-stdin",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				// Written to stdout even when already formatted
+				for _, in := range []string{"x ---> y", "x -> y\n"} {
+					stdout := &bytes.Buffer{}
+					tms := testMain(dir, env, "fmt", "-")
+					tms.Stdin = bytes.NewBufferString(in)
+					tms.Stdout = stdout
+					tms.Start(t, ctx)
+					err := tms.Wait(ctx)
+					tms.Cleanup(t)
+					assert.Success(t, err)
+					assert.Equal(t, "x -> y\n", stdout.String())
+				}
+			},
+		},
+		{
+			name: "fmt-check",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "foo.d2", "a -> b\n")
+				writeFile(t, dir, "bar.d2", `x ---> y`)
+				err := runTestMainPersist(t, ctx, dir, env, "fmt", "--check", "foo.d2")
+				assert.Success(t, err)
+
+				stdout := &bytes.Buffer{}
+				tms := testMain(dir, env, "fmt", "--check", "foo.d2", "bar.d2")
+				tms.Stdout = stdout
+				tms.Start(t, ctx)
+				defer tms.Cleanup(t)
+				err = tms.Wait(ctx)
+				assert.Error(t, err)
+				assert.Equal(t, "bar.d2\n", stdout.String())
+				// Nothing is written
+				assert.Equal(t, "x ---> y", string(readFile(t, dir, "bar.d2")))
+			},
+		},
+		{
+			name: "fmt-options",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "foo.d2", `a: {style: {stroke: red; fill: blue}; label: a long label}`)
+				err := runTestMainPersist(t, ctx, dir, env, "fmt", "--indent=tab", "--width=40", "--sort-styles", "foo.d2")
+				assert.Success(t, err)
+				assert.Equal(t, "a: {\n\tstyle: {fill: blue; stroke: red}\n\tlabel: a long label\n}\n", string(readFile(t, dir, "foo.d2")))
+
+				err = runTestMain(t, ctx, dir, env, "fmt", "--indent=none", "foo.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: failed to fmt: bad usage: --indent must be a number of spaces from 1 to 8 or tab, got "none"`)
+			},
+		},
+		{
+			name: "lint",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "index.d2", `a -> b
+c
+d: {style.fill: "#000"; style.font-color: "#111"}
+`)
+				stdout := &bytes.Buffer{}
+				tms := testMain(dir, env, "lint", "index.d2")
+				tms.Stdout = stdout
+				tms.Start(t, ctx)
+				err := tms.Wait(ctx)
+				tms.Cleanup(t)
+				assert.ErrorString(t, err, "failed to wait xmain test: e2etests-cli/d2: exiting with code 1: 3 problem(s) found")
+				assert.Equal(t, `index.d2:2:1: "c" isn't connected to anything (orphan)
+index.d2:3:1: "d" isn't connected to anything (orphan)
+index.d2:3:25: the label of "d" has a contrast of 1.11:1 with its fill, below 4.50:1 (contrast)
+`, stdout.String())
+
+				// Rules are disabled by the config next to the input
+				writeFile(t, dir, ".d2lint.json", `{"rules": {"orphan": false}}`)
+				stdout.Reset()
+				tms = testMain(dir, env, "lint", "--format=json", "index.d2")
+				tms.Stdout = stdout
+				tms.Start(t, ctx)
+				err = tms.Wait(ctx)
+				tms.Cleanup(t)
+				assert.Error(t, err)
+				var problems []struct {
+					Rule  string `json:"rule"`
+					Range struct {
+						Path  string `json:"path"`
+						Start struct {
+							Line int `json:"line"`
+						} `json:"start"`
+					} `json:"range"`
+				}
+				assert.Success(t, json.Unmarshal(stdout.Bytes(), &problems))
+				assert.Equal(t, 1, len(problems))
+				assert.Equal(t, "contrast", problems[0].Rule)
+				assert.Equal(t, "index.d2", problems[0].Range.Path)
+				assert.Equal(t, 3, problems[0].Range.Start.Line)
+
+				writeFile(t, dir, "index.d2", `a -> b`)
+				err = runTestMain(t, ctx, dir, env, "lint", "index.d2")
+				assert.Success(t, err)
+
+				writeFile(t, dir, "strict.json", `{"strict": true, "rules": {"orphans": false}}`)
+				err = runTestMain(t, ctx, dir, env, "lint", "--lint-config=strict.json", "index.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: failed to lint index.d2: invalid lint config strict.json: unknown rule "orphans", expected one of orphan, duplicate-label, undeclared, unreachable-board, contrast, oversized-image`)
+			},
+		},
+		{
+			name: "lsp",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				stdin := &bytes.Buffer{}
+				for _, msg := range []string{
+					`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`,
+					`{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": {"textDocument": {"uri": "file:///index.d2", "text": "a ->"}}}`,
+					`{"jsonrpc": "2.0", "method": "exit"}`,
+				} {
+					fmt.Fprintf(stdin, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+				}
+				stdout := &bytes.Buffer{}
+				tms := testMain(dir, env, "lsp")
+				tms.Stdin = stdin
+				tms.Stdout = stdout
+				tms.Start(t, ctx)
+				err := tms.Wait(ctx)
+				tms.Cleanup(t)
+				assert.Success(t, err)
+				assert.Equal(t, true, strings.Contains(stdout.String(), `"renameProvider":true`))
+				assert.Equal(t, true, strings.Contains(stdout.String(), `"message":"connection missing destination"`))
+			},
+		},
+		{
+			name: "rename",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				input := `a -> b
+b.style.fill: red
+c: {
+  b -> d
+}
+*.style.stroke: blue
+`
+				writeFile(t, dir, "index.d2", input)
+				stdout := &bytes.Buffer{}
+				tms := testMain(dir, env, "rename", "b", "bee", "index.d2")
+				tms.Stdout = stdout
+				tms.Start(t, ctx)
+				err := tms.Wait(ctx)
+				tms.Cleanup(t)
+				assert.Success(t, err)
+				assert.Equal(t, `--- index.d2
++++ index.d2
+@@ -1,5 +1,5 @@
+-a -> b
+-b.style.fill: red
++a -> bee
++bee.style.fill: red
+ c: {
+   b -> d
+ }
+`, stdout.String())
+				// Only --write writes the file
+				assert.Equal(t, input, string(readFile(t, dir, "index.d2")))
+
+				err = runTestMainPersist(t, ctx, dir, env, "rename", "--write", "c.d", "c.e", "index.d2")
+				assert.Success(t, err)
+				assert.Equal(t, `a -> b
+b.style.fill: red
+c: {
+  b -> e
+}
+*.style.stroke: blue
+`, string(readFile(t, dir, "index.d2")))
+
+				err = runTestMain(t, ctx, dir, env, "rename", "a", "b", "index.d2")
+				assert.ErrorString(t, err, `failed to wait xmain test: e2etests-cli/d2: failed to rename a to b in index.d2: "b" already exists`)
+			},
+		},
+		{
+			name: "convert-mermaid",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "flow.mmd", `flowchart LR
+  A[Start] --> B{Ready?}
+  subgraph done [Done]
+    C((End))
+  end
+  B -->|yes| C
+`)
+				err := runTestMainPersist(t, ctx, dir, env, "convert", "flow.mmd")
+				assert.Success(t, err)
+				got := readFile(t, dir, "flow.d2")
+				assert.Testdata(t, ".d2", got)
+			},
+		},
+		{
+			name: "convert-graphml",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "graph.graphml", `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:y="http://www.yworks.com/xml/graphml">
+  <key for="node" id="d0" yfiles.type="nodegraphics"/>
+  <graph edgedefault="directed" id="G">
+    <node id="n0" yfiles.foldertype="group">
+      <data key="d0">
+        <y:ProxyAutoBoundsNode>
+          <y:Realizers active="0">
+            <y:GroupNode>
+              <y:Geometry height="100.0" width="100.0" x="10.0" y="10.0"/>
+              <y:NodeLabel>cloud</y:NodeLabel>
+            </y:GroupNode>
+          </y:Realizers>
+        </y:ProxyAutoBoundsNode>
+      </data>
+      <graph edgedefault="directed" id="n0:">
+        <node id="n0::n0">
+          <data key="d0">
+            <y:ShapeNode>
+              <y:Geometry height="30.0" width="30.0" x="40.0" y="50.0"/>
+              <y:NodeLabel>server</y:NodeLabel>
+            </y:ShapeNode>
+          </data>
+        </node>
+      </graph>
+    </node>
+    <node id="n1"/>
+    <edge source="n1" target="n0::n0"/>
+  </graph>
+</graphml>
+`)
+				err := runTestMainPersist(t, ctx, dir, env, "convert", "--positions", "graph.graphml")
+				assert.Success(t, err)
+				got := readFile(t, dir, "graph.d2")
+				assert.Testdata(t, ".d2", got)
+			},
+		},
+		{
+			name: "convert-structurizr",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "workspace.dsl", `workspace "Shop" {
+  model {
+    user = person "User"
+    shop = softwareSystem "Shop" {
+      api = container "API" "Takes orders" "Go"
+      db = container "Database" "" "PostgreSQL" "Database"
+      api -> db "Reads and writes"
+    }
+    user -> shop.api "Orders with"
+  }
+  views {
+    systemContext shop "context" {
+      include *
+    }
+    container shop "containers" {
+      include *
+      autoLayout lr
+    }
+  }
+}
+`)
+				err := runTestMainPersist(t, ctx, dir, env, "convert", "workspace.dsl")
+				assert.Success(t, err)
+				got := readFile(t, dir, "workspace.d2")
+				assert.Testdata(t, ".d2", got)
+			},
+		},
+		{
+			name: "convert-unknown-format",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "flow.txt", `graph TD; a --> b`)
+				err := runTestMain(t, ctx, dir, env, "convert", "flow.txt")
+				assert.ErrorString(t, err, "failed to wait xmain test: e2etests-cli/d2: bad usage: --from must be given when the input is not a .mmd, .mermaid, .graphml, or .dsl file")
+			},
+		},
+		{
+			name: "diff",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "old.d2", `a -> b: hi
+b -> c
+c.style.fill: red
+x: {
+  y
+}
+`)
+				writeFile(t, dir, "new.d2", `a -> b: hello
+b -> d
+c.style.fill: blue
+x: {
+  y
+  "z z"
+}
+`)
+				stdout := &bytes.Buffer{}
+				tms := testMain(dir, env, "diff", "old.d2", "new.d2", "diff.d2")
+				tms.Stdout = stdout
+				tms.Start(t, ctx)
+				defer tms.Cleanup(t)
+				err := tms.Wait(ctx)
+				assert.Success(t, err)
+				assert.Equal(t, `+ d
++ x.z z
+~ c
+    style.fill: red -> blue
++ (b -> d)[0]
+- (b -> c)[0]
+~ (a -> b)[0]
+    label: hi -> hello
+`, stdout.String())
+				got := readFile(t, dir, "diff.d2")
+				assert.Testdata(t, ".d2", got)
+			},
+		},
+		{
+			name: "diff-usage",
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "old.d2", `a`)
+				err := runTestMain(t, ctx, dir, env, "diff", "old.d2")
+				assert.ErrorString(t, err, "failed to wait xmain test: e2etests-cli/d2: bad usage: diff must be passed the old and the new file and optionally an output file for the diff board")
+			},
+		},
 		{
 			name:   "watch-regular",
 			serial: true,
@@ -1113,6 +2362,61 @@ c
 				assert.Success(t, err)
 			},
 		},
+		{
+			name:   "watch-error",
+			serial: true,
+			run: func(t *testing.T, ctx context.Context, dir string, env *xos.Env) {
+				writeFile(t, dir, "index.d2", `a -> b`)
+				stderr := &stderrWrapper{}
+				tms := testMain(dir, env, "--watch", "--browser=0", "index.d2")
+				tms.Stderr = stderr
+
+				tms.Start(t, ctx)
+				defer func() {
+					err := tms.Signal(ctx, os.Interrupt)
+					assert.Success(t, err)
+				}()
+
+				urlRE := regexp.MustCompile(`127.0.0.1:([0-9]+)`)
+				watchURL, err := waitLogs(ctx, stderr, urlRE)
+				assert.Success(t, err)
+
+				c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://%s/watch", watchURL), nil)
+				assert.Success(t, err)
+				defer c.CloseNow()
+				_, msg, err := c.Read(ctx)
+				assert.Success(t, err)
+				var res struct {
+					SVG  string `json:"svg"`
+					Err  string `json:"err"`
+					Errs []struct {
+						Message string `json:"message"`
+						Source  []struct {
+							Line int    `json:"line"`
+							Text string `json:"text"`
+						} `json:"source"`
+					} `json:"errs"`
+				}
+				assert.Success(t, json.Unmarshal(msg, &res))
+				assert.Equal(t, "", res.Err)
+				svg := res.SVG
+
+				// The last diagram is kept under the errors, with the lines around them
+				writeFile(t, dir, "index.d2", `a -> b
+b.shape: hexagonal
+c`)
+				_, msg, err = c.Read(ctx)
+				assert.Success(t, err)
+				res.Errs = nil
+				assert.Success(t, json.Unmarshal(msg, &res))
+				assert.Equal(t, svg, res.SVG)
+				assert.Equal(t, 1, len(res.Errs))
+				assert.Equal(t, `unknown shape "hexagonal"`, res.Errs[0].Message)
+				assert.Equal(t, 3, len(res.Errs[0].Source))
+				assert.Equal(t, 2, res.Errs[0].Source[1].Line)
+				assert.Equal(t, "b.shape: hexagonal", res.Errs[0].Source[1].Text)
+			},
+		},
 	}
 
 	ctx := context.Background()
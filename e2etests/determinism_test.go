@@ -0,0 +1,104 @@
+package e2etests
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"oss.terrastruct.com/d2/d2graph"
+)
+
+// Goldens are only stable if layout is deterministic. With -d2-determinism, every test is laid
+// out and rendered a second time, and the output is also recorded to compare against in later
+// passes of the same run, so that e.g.
+//
+//	go test ./e2etests -cpu 1,4 -args -d2-determinism -d2-shuffle
+//
+// checks that GOMAXPROCS doesn't change anything either. See ci/determinism.sh.
+var (
+	determinismFlag = flag.Bool("d2-determinism", false, "lay out every test twice and fail if the outputs differ, including across passes of -cpu")
+	shuffleFlag     = flag.Bool("d2-shuffle", false, "with -d2-determinism, rebuild the children maps of objects in a random order before laying out again")
+)
+
+// determinismRecords holds the first output of every test and layout across passes of -cpu
+var determinismRecords sync.Map
+
+// checkDeterminism compares the output of a test with the one of rerun, and with the one
+// recorded in a previous pass
+func checkDeterminism(t *testing.T, layoutName string, got []byte, rerun func() ([]byte, error)) {
+	again, err := rerun()
+	if err != nil {
+		t.Fatalf("failed to lay out again: %v", err)
+	}
+	if err := compareOutputs(got, again); err != nil {
+		t.Fatalf("%s layout is not deterministic, the second run differs: %v", layoutName, err)
+	}
+
+	key := t.Name() + "/" + layoutName
+	first, loaded := determinismRecords.LoadOrStore(key, recordedOutput{
+		gomaxprocs: runtime.GOMAXPROCS(0),
+		output:     got,
+	})
+	if !loaded {
+		return
+	}
+	rec := first.(recordedOutput)
+	if err := compareOutputs(rec.output, got); err != nil {
+		t.Fatalf("%s layout is not deterministic, the output with GOMAXPROCS=%d differs from the one with GOMAXPROCS=%d: %v", layoutName, runtime.GOMAXPROCS(0), rec.gomaxprocs, err)
+	}
+}
+
+type recordedOutput struct {
+	gomaxprocs int
+	output     []byte
+}
+
+// compareOutputs reports the first line that differs
+func compareOutputs(exp, got []byte) error {
+	if string(exp) == string(got) {
+		return nil
+	}
+	expLines := strings.Split(string(exp), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < len(expLines) && i < len(gotLines); i++ {
+		if expLines[i] != gotLines[i] {
+			return fmt.Errorf("line %d:\n-%s\n+%s", i+1, truncate(expLines[i]), truncate(gotLines[i]))
+		}
+	}
+	return fmt.Errorf("%d lines instead of %d", len(gotLines), len(expLines))
+}
+
+func truncate(s string) string {
+	if len(s) > 200 {
+		return s[:200] + "..."
+	}
+	return s
+}
+
+// shuffleChildren wraps a layout to first rebuild the children maps of all objects with
+// their keys inserted in a random order, which changes the order maps are iterated in beyond
+// the randomization Go already does
+func shuffleChildren(layout d2graph.LayoutGraph) d2graph.LayoutGraph {
+	return func(ctx context.Context, g *d2graph.Graph) error {
+		for _, obj := range append([]*d2graph.Object{g.Root}, g.Objects...) {
+			keys := make([]string, 0, len(obj.Children))
+			for k := range obj.Children {
+				keys = append(keys, k)
+			}
+			rand.Shuffle(len(keys), func(i, j int) {
+				keys[i], keys[j] = keys[j], keys[i]
+			})
+			children := make(map[string]*d2graph.Object, len(keys))
+			for _, k := range keys {
+				children[k] = obj.Children[k]
+			}
+			obj.Children = children
+		}
+		return layout(ctx, g)
+	}
+}
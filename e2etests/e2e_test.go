@@ -103,6 +103,8 @@ type testCase struct {
 	elkFeatureError   string
 	expErr            string
 	themeID           *int64
+	// dagreOpts overrides the default options of the dagre layout
+	dagreOpts *d2dagrelayout.ConfigurableOpts
 }
 
 func runa(t *testing.T, tcs []testCase) {
@@ -161,6 +163,10 @@ func run(t *testing.T, tc testCase) {
 		layout := d2dagrelayout.DefaultLayout
 		if strings.EqualFold(engine, "elk") {
 			layout = d2elklayout.DefaultLayout
+		} else if tc.dagreOpts != nil {
+			layout = func(ctx context.Context, g *d2graph.Graph) error {
+				return d2dagrelayout.Layout(ctx, g, tc.dagreOpts)
+			}
 		}
 		if tc.testSerialization {
 			return func(ctx context.Context, g *d2graph.Graph) error {
@@ -249,20 +255,31 @@ func run(t *testing.T, tc testCase) {
 		dataPath := filepath.Join("testdata", strings.TrimPrefix(t.Name(), "TestE2E/"), layoutName)
 		pathGotSVG := filepath.Join(dataPath, "sketch.got.svg")
 
-		if len(diagram.Layers) > 0 || len(diagram.Scenarios) > 0 || len(diagram.Steps) > 0 {
-			masterID, err := diagram.HashID()
-			assert.Success(t, err)
-			renderOpts.MasterID = masterID
-		}
-		boards, err := d2svg.RenderMultiboard(diagram, renderOpts)
+		svgBytes, err := renderSVG(diagram, renderOpts)
 		assert.Success(t, err)
 
-		var svgBytes []byte
-		if len(boards) == 1 {
-			svgBytes = boards[0]
-		} else {
-			svgBytes, err = d2animate.Wrap(diagram, boards, *renderOpts, 1000)
-			assert.Success(t, err)
+		if *determinismFlag {
+			checkDeterminism(t, layoutName, svgBytes, func() ([]byte, error) {
+				rerunCompileOpts := *compileOpts
+				if *shuffleFlag {
+					rerunCompileOpts.LayoutResolver = func(engine string) (d2graph.LayoutGraph, error) {
+						layout, err := layoutResolver(engine)
+						if err != nil {
+							return nil, err
+						}
+						return shuffleChildren(layout), nil
+					}
+				}
+				rerunRenderOpts := &d2svg.RenderOpts{
+					Pad:     go2.Pointer(int64(0)),
+					ThemeID: tc.themeID,
+				}
+				diagram, _, err := d2lib.Compile(ctx, tc.script, &rerunCompileOpts, rerunRenderOpts)
+				if err != nil {
+					return nil, err
+				}
+				return renderSVG(diagram, rerunRenderOpts)
+			})
 		}
 
 		err = os.MkdirAll(dataPath, 0755)
@@ -313,3 +330,21 @@ func loadFromFileWithOptions(t *testing.T, name string, options testCase) testCa
 	tc.script = loadFromFile(t, name).script
 	return tc
 }
+
+func renderSVG(diagram *d2target.Diagram, renderOpts *d2svg.RenderOpts) ([]byte, error) {
+	if len(diagram.Layers) > 0 || len(diagram.Scenarios) > 0 || len(diagram.Steps) > 0 {
+		masterID, err := diagram.HashID()
+		if err != nil {
+			return nil, err
+		}
+		renderOpts.MasterID = masterID
+	}
+	boards, err := d2svg.RenderMultiboard(diagram, renderOpts)
+	if err != nil {
+		return nil, err
+	}
+	if len(boards) == 1 {
+		return boards[0], nil
+	}
+	return d2animate.Wrap(diagram, boards, *renderOpts, 1000)
+}
@@ -251,6 +251,41 @@ monsters: {
 }
 
 costumes.monster -> monsters.id
+`,
+		},
+		{
+			name: "hatch",
+			script: `x -> y -> z
+x.style.fill-pattern: hatch
+y: {shape: cylinder; style.fill: "#FFE0B2"; style.fill-pattern: hatch}
+z: {style.3d: true; style.fill-pattern: hatch}
+`,
+		},
+		{
+			name: "border-styles",
+			script: `rect: {style.border-style: dashed}
+oval: {shape: oval; style.border-style: dotted}
+diamond: {shape: diamond; style.border-style: double}
+external: {shape: diamond; style.double-border: true; style.multiple: true}
+container: {
+  style.border-style: double
+  inner: {style.border-style: dotted; style.stroke-width: 4}
+  solid: {style.border-style: solid; style.stroke-dash: 3}
+}
+rect -> oval -> diamond -> external
+diamond -> container.inner
+`,
+		},
+		{
+			name: "gradients",
+			script: `style.fill: "linear-gradient(#FFFFFF, #EEF1F8)"
+healthy: {style.fill: "linear-gradient(to right, #C8E6C9, #66BB6A)"}
+degraded: {style.fill: "linear-gradient(45deg, #FFF59D, #FFB300 80%)"}
+down: {shape: circle; style.fill: "radial-gradient(#FFCDD2, #E53935)"}
+also healthy: {style.fill: "linear-gradient(to right, #C8E6C9, #66BB6A)"; style.multiple: true}
+striped: {style.fill: "linear-gradient(to right, #E3F2FD, #90CAF9)"; style.fill-pattern: hatch}
+healthy -> degraded -> down
+also healthy -> striped
 `,
 		},
 	}
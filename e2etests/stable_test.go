@@ -3,6 +3,11 @@ package e2etests
 import (
 	_ "embed"
 	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2target"
 )
 
 // based on https://github.com/mxstbr/markdown-test-file
@@ -292,6 +297,11 @@ oval: {shape: "oval"}
 circle: {shape: "circle"}
 hexagon: {shape: "hexagon"}
 cloud: {shape: "cloud"}
+triangle: {shape: "triangle"}
+trapezoid: {shape: "trapezoid"}
+cross: {shape: "cross"}
+actor: {shape: "actor"}
+note: {shape: "note"}
 
 rectangle -> square -> page
 parallelogram -> document -> cylinder
@@ -299,6 +309,8 @@ queue -> package -> step
 callout -> stored_data -> person
 diamond -> oval -> circle
 hexagon -> cloud
+triangle -> trapezoid -> cross
+actor -> note
 `,
 		},
 		{
@@ -321,6 +333,11 @@ oval: {shape: "oval"}
 circle: {shape: "circle"}
 hexagon: {shape: "hexagon"}
 cloud: {shape: "cloud"}
+triangle: {shape: "triangle"}
+trapezoid: {shape: "trapezoid"}
+cross: {shape: "cross"}
+actor: {shape: "actor"}
+note: {shape: "note"}
 
 rectangle -> square -> page
 parallelogram -> document -> cylinder
@@ -328,6 +345,8 @@ queue -> package -> step
 callout -> stored_data -> person
 diamond -> oval -> circle
 hexagon -> cloud
+triangle -> trapezoid -> cross
+actor -> note
 
 rectangle.style.multiple: true
 square.style.multiple: true
@@ -346,6 +365,11 @@ oval.style.multiple: true
 circle.style.multiple: true
 hexagon.style.multiple: true
 cloud.style.multiple: true
+triangle.style.multiple: true
+trapezoid.style.multiple: true
+cross.style.multiple: true
+actor.style.multiple: true
+note.style.multiple: true
 `,
 		},
 		{
@@ -368,6 +392,11 @@ oval: {shape: "oval"}
 circle: {shape: "circle"}
 hexagon: {shape: "hexagon"}
 cloud: {shape: "cloud"}
+triangle: {shape: "triangle"}
+trapezoid: {shape: "trapezoid"}
+cross: {shape: "cross"}
+actor: {shape: "actor"}
+note: {shape: "note"}
 
 rectangle -> square -> page
 parallelogram -> document -> cylinder
@@ -375,6 +404,8 @@ queue -> package -> step
 callout -> stored_data -> person
 diamond -> oval -> circle
 hexagon -> cloud
+triangle -> trapezoid -> cross
+actor -> note
 
 rectangle.style.shadow: true
 square.style.shadow: true
@@ -393,6 +424,11 @@ oval.style.shadow: true
 circle.style.shadow: true
 hexagon.style.shadow: true
 cloud.style.shadow: true
+triangle.style.shadow: true
+trapezoid.style.shadow: true
+cross.style.shadow: true
+actor.style.shadow: true
+note.style.shadow: true
 `,
 		},
 		{
@@ -2183,6 +2219,27 @@ c: {
 `,
 			dagreFeatureError: `Object "a" has attribute "width" and/or "height" set, but layout engine "dagre" does not support dimensions set on containers. See https://d2lang.com/tour/layouts/#layout-specific-functionality for more.`,
 		},
+		{
+			name: "pinned_positions",
+			script: `
+user -> gateway -> api -> db
+gateway -> cache
+api -> queue
+notes: {
+  shape: page
+  top: 160
+  left: 100
+}
+notes -> api
+admin: {
+  shape: person
+  top: 0
+  left: 400
+}
+admin -> db
+`,
+			elkFeatureError: `Object "notes" has attribute "top" and/or "left" set, but layout engine "elk" does not support locked positions. See https://d2lang.com/tour/layouts/#layout-specific-functionality for more.`,
+		},
 		{
 			name: "crow_foot_arrowhead",
 			script: `
@@ -2383,6 +2440,34 @@ b: {
 a -> b
 `,
 		},
+		{
+			name:      "dagre_tiebreak_bias",
+			justDagre: true,
+			script:    dagreTiebreakScript,
+			dagreOpts: &d2dagrelayout.ConfigurableOpts{
+				NodeSep:  d2dagrelayout.DefaultOpts.NodeSep,
+				EdgeSep:  d2dagrelayout.DefaultOpts.EdgeSep,
+				TieBreak: d2dagrelayout.TieBreakBias,
+			},
+			assertions: func(t *testing.T, diagram *d2target.Diagram) {
+				first, second := getShape(t, diagram, "first"), getShape(t, diagram, "second")
+				assert.True(t, second.Pos.X < first.Pos.X)
+			},
+		},
+		{
+			name:      "dagre_tiebreak_declaration",
+			justDagre: true,
+			script:    dagreTiebreakScript,
+			dagreOpts: &d2dagrelayout.ConfigurableOpts{
+				NodeSep:  d2dagrelayout.DefaultOpts.NodeSep,
+				EdgeSep:  d2dagrelayout.DefaultOpts.EdgeSep,
+				TieBreak: d2dagrelayout.TieBreakDeclaration,
+			},
+			assertions: func(t *testing.T, diagram *d2target.Diagram) {
+				first, second := getShape(t, diagram, "first"), getShape(t, diagram, "second")
+				assert.True(t, first.Pos.X < second.Pos.X)
+			},
+		},
 		{
 			name: "sql_table_tooltip_animated",
 			script: `
@@ -2875,3 +2960,20 @@ y: profits {
 
 	runa(t, tcs)
 }
+
+// dagreTiebreakScript has siblings with equal barycenters, which the bias tiebreak swaps but
+// the declaration tiebreak keeps in the order they were declared
+const dagreTiebreakScript = `first -> shared
+second -> shared
+first -> only first
+`
+
+func getShape(t *testing.T, diagram *d2target.Diagram, id string) d2target.Shape {
+	for _, shape := range diagram.Shapes {
+		if shape.ID == id {
+			return shape
+		}
+	}
+	t.Fatalf("shape %q not found", id)
+	return d2target.Shape{}
+}
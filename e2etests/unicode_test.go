@@ -131,6 +131,40 @@ m -> n -> o -> p
 饭 (fan) - Zhuang
 
 مەن سىزنى ياخشى ئۈمىد ق
+`,
+		},
+		{
+			name: "rtl",
+			script: `hebrew: "שלום עולם, מה שלומך היום?" {
+  width: 120
+}
+arabic: "مرحبا بالعالم، كيف حالك اليوم؟" {
+  width: 120
+  style.text-align: right
+}
+chinese: "今天天气很好，我们去公园散步吧。" {
+  width: 120
+  style.text-align: left
+}
+hebrew -> arabic: "שלום\nעולם" {
+  style.text-align: left
+}
+arabic -> chinese
+`,
+		},
+		{
+			name: "text-direction",
+			script: `mixed: "D2 בעברית" {
+  style.text-direction: rtl
+  style.text-align: left
+}
+quoted: "שלום is hello" {
+  style.text-direction: ltr
+  style.text-align: left
+}
+mixed -> quoted: "D2 בעברית" {
+  style.text-direction: rtl
+}
 `,
 		},
 	}
@@ -0,0 +1,143 @@
+// Package arrowhead is the geometry of the ends of connections: the outlines of arrowheads, how
+// far connections stop short of their shapes to make room for strokes, and where they meet the
+// borders of the shapes they connect. Layout engines and renderers use it so connections end at
+// the same points in all of them.
+//
+// Arrowheads are drawn in a box of their Dimensions, with the connection coming in from the left
+// for a target arrowhead, or leaving to the right for a source one, centered on its y.
+package arrowhead
+
+import (
+	"math"
+
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/shape"
+)
+
+// Outline is the outline of an arrowhead in its box
+type Outline struct {
+	// Points are the vertices of a polygon, or of a polyline if Open
+	Points []*geo.Point
+	Open   bool
+
+	// Center and Radius are those of a circle, for arrowheads without Points
+	Center *geo.Point
+	Radius float64
+
+	// Filled outlines are filled with the color of the connection. The others are filled with
+	// the background and stroked with the color of the connection, unless Open.
+	Filled bool
+}
+
+// GetOutline returns the outline of arrowhead, at the source or target end of a connection with
+// a stroke strokeWidth wide. It returns nil for no arrowhead and for crow's foot arrowheads,
+// which are drawn as several paths.
+func GetOutline(arrowhead d2target.Arrowhead, isTarget bool, strokeWidth float64) *Outline {
+	width, height := arrowhead.Dimensions(strokeWidth)
+	points := func(coords ...float64) []*geo.Point {
+		var points []*geo.Point
+		for i := 0; i < len(coords); i += 2 {
+			points = append(points, geo.NewPoint(coords[i], coords[i+1]))
+		}
+		return points
+	}
+
+	switch arrowhead {
+	case d2target.ArrowArrowhead:
+		if isTarget {
+			return &Outline{Points: points(0, 0, width, height/2, 0, height, width/4, height/2), Filled: true}
+		}
+		return &Outline{Points: points(0, height/2, width, 0, width*3/4, height/2, width, height), Filled: true}
+	case d2target.TriangleArrowhead:
+		if isTarget {
+			return &Outline{Points: points(0, 0, width, height/2, 0, height), Filled: true}
+		}
+		return &Outline{Points: points(width, 0, 0, height/2, width, height), Filled: true}
+	case d2target.UnfilledTriangleArrowhead:
+		// Inset so the stroke stays inside the box
+		inset := strokeWidth / 2
+		if isTarget {
+			return &Outline{Points: points(inset, inset, width-inset, height/2, inset, height-inset)}
+		}
+		return &Outline{Points: points(width-inset, inset, inset, height/2, width-inset, height-inset)}
+	case d2target.LineArrowhead:
+		inset := strokeWidth / 2
+		if isTarget {
+			return &Outline{Points: points(inset, inset, width-inset, height/2, inset, height-inset), Open: true}
+		}
+		return &Outline{Points: points(width-inset, inset, inset, height/2, width-inset, height-inset), Open: true}
+	case d2target.TeeArrowhead:
+		// The bar and a stem back to the end of the connection, which stops short of the bar
+		inset := strokeWidth / 2
+		if isTarget {
+			return &Outline{Points: points(width-inset, inset, width-inset, height-inset, width-inset, height/2, 0, height/2), Open: true}
+		}
+		return &Outline{Points: points(inset, inset, inset, height-inset, inset, height/2, width, height/2), Open: true}
+	case d2target.DoubleTriangleArrowhead:
+		// Both triangles as one polygon, touching at the middle of the box
+		if isTarget {
+			return &Outline{Points: points(0, 0, width/2, height/2, width/2, 0, width, height/2, width/2, height, width/2, height/2, 0, height), Filled: true}
+		}
+		return &Outline{Points: points(width, 0, width/2, height/2, width/2, 0, 0, height/2, width/2, height, width/2, height/2, width, height), Filled: true}
+	case d2target.FilledDiamondArrowhead:
+		return &Outline{Points: points(0, height/2, width/2, 0, width, height/2, width/2, height), Filled: true}
+	case d2target.DiamondArrowhead:
+		if isTarget {
+			return &Outline{Points: points(0, height/2, width/2, height/8, width, height/2, width/2, height*0.9)}
+		}
+		return &Outline{Points: points(width/8, height/2, width*0.6, height/8, width*1.1, height/2, width*0.6, height*7/8)}
+	case d2target.FilledCircleArrowhead, d2target.CircleArrowhead:
+		radius := width / 2
+		cx := radius - strokeWidth/2
+		if isTarget {
+			cx = radius + strokeWidth/2
+		}
+		if arrowhead == d2target.FilledCircleArrowhead {
+			return &Outline{Center: geo.NewPoint(cx, radius), Radius: radius - strokeWidth/2, Filled: true}
+		}
+		return &Outline{Center: geo.NewPoint(cx, radius), Radius: radius - strokeWidth}
+	}
+	return nil
+}
+
+// Ref returns the point of the box of arrowhead which sits on the end of its connection
+func Ref(arrowhead d2target.Arrowhead, isTarget bool, strokeWidth float64) *geo.Point {
+	width, height := arrowhead.Dimensions(strokeWidth)
+	if arrowhead == d2target.DiamondArrowhead {
+		if isTarget {
+			return geo.NewPoint(width-0.6*strokeWidth, height/2)
+		}
+		return geo.NewPoint(width/8+0.6*strokeWidth, height/2)
+	}
+	if isTarget {
+		return geo.NewPoint(width-1.5*strokeWidth, height/2)
+	}
+	return geo.NewPoint(1.5*strokeWidth, height/2)
+}
+
+// Adjustment returns how far to move the end of a connection, going from start to end, so its
+// stroke and arrowhead end at the outside of the stroke of the shape it connects to, rather than
+// over it
+func Adjustment(start, end *geo.Point, arrowhead d2target.Arrowhead, edgeStrokeWidth, shapeStrokeWidth int) *geo.Point {
+	distance := (float64(edgeStrokeWidth) + float64(shapeStrokeWidth)) / 2.0
+	if arrowhead != d2target.NoArrowhead {
+		distance += float64(edgeStrokeWidth)
+	}
+
+	v := geo.NewVector(end.X-start.X, end.Y-start.Y)
+	return v.Unit().Multiply(-distance).ToPoint()
+}
+
+// Clip returns where the segment from prev to end, which ends inside or on the box of s, first
+// meets the border of s. It returns end if the segment doesn't cross the border.
+func Clip(s shape.Shape, end, prev *geo.Point) *geo.Point {
+	closest := math.Inf(1)
+	for _, p := range s.GetBox().Intersections(geo.Segment{Start: prev, End: end}) {
+		if d := geo.EuclideanDistance(prev.X, prev.Y, p.X, p.Y); d < closest {
+			closest = d
+			end = p
+		}
+	}
+	return shape.TraceToShapeBorder(s, end, prev)
+}
@@ -0,0 +1,76 @@
+package arrowhead
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/shape"
+)
+
+func TestGetOutline(t *testing.T) {
+	for _, head := range []d2target.Arrowhead{
+		d2target.ArrowArrowhead,
+		d2target.TriangleArrowhead,
+		d2target.UnfilledTriangleArrowhead,
+		d2target.LineArrowhead,
+		d2target.TeeArrowhead,
+		d2target.DoubleTriangleArrowhead,
+		d2target.FilledDiamondArrowhead,
+		d2target.FilledCircleArrowhead,
+		d2target.CircleArrowhead,
+	} {
+		for _, isTarget := range []bool{false, true} {
+			outline := GetOutline(head, isTarget, 2)
+			if !assert.NotNil(t, outline, head) {
+				continue
+			}
+			// Outlines stay in the box of their arrowhead
+			width, height := head.Dimensions(2)
+			for _, p := range outline.Points {
+				assert.True(t, p.X >= 0 && p.X <= width && p.Y >= 0 && p.Y <= height, "%s point %v outside %vx%v", head, p, width, height)
+			}
+			if outline.Points == nil {
+				assert.True(t, outline.Radius > 0 && outline.Center.X-outline.Radius >= 0 && outline.Center.X+outline.Radius <= width, "%s circle outside %vx%v", head, width, height)
+			}
+		}
+	}
+
+	assert.Nil(t, GetOutline(d2target.NoArrowhead, true, 2))
+	assert.Nil(t, GetOutline(d2target.CfMany, true, 2))
+}
+
+func TestRef(t *testing.T) {
+	width, height := d2target.TriangleArrowhead.Dimensions(2)
+	// The connection ends behind the tip of a target arrowhead, and ahead of the tip of a source
+	// one, so the tip covers the end of the stroke
+	assert.Equal(t, geo.NewPoint(width-3, height/2), Ref(d2target.TriangleArrowhead, true, 2))
+	assert.Equal(t, geo.NewPoint(3, height/2), Ref(d2target.TriangleArrowhead, false, 2))
+}
+
+func TestAdjustment(t *testing.T) {
+	start, end := geo.NewPoint(0, 0), geo.NewPoint(0, 100)
+	// Half of both strokes
+	assert.Equal(t, geo.NewPoint(0, -2), Adjustment(start, end, d2target.NoArrowhead, 2, 2))
+	// and the width of the stroke for the arrowhead
+	assert.Equal(t, geo.NewPoint(0, -4), Adjustment(start, end, d2target.TriangleArrowhead, 2, 2))
+	assert.Equal(t, geo.NewPoint(4, 0), Adjustment(geo.NewPoint(100, 0), geo.NewPoint(0, 0), d2target.TriangleArrowhead, 2, 2))
+}
+
+func TestClip(t *testing.T) {
+	box := geo.NewBox(geo.NewPoint(0, 0), 100, 100)
+
+	// Into the center of a rectangle, through its top
+	rect := shape.NewShape(shape.SQUARE_TYPE, box)
+	assert.Equal(t, geo.NewPoint(50, 0), Clip(rect, geo.NewPoint(50, 50), geo.NewPoint(50, -50)))
+
+	// Diagonally into the corner of a circle, which is outside of it
+	circle := shape.NewShape(shape.CIRCLE_TYPE, box)
+	p := Clip(circle, geo.NewPoint(0, 0), geo.NewPoint(-50, -50))
+	assert.InDelta(t, 50, geo.EuclideanDistance(50, 50, p.X, p.Y), 1)
+
+	// A segment that doesn't reach the shape keeps its end
+	assert.Equal(t, geo.NewPoint(-10, 50), Clip(rect, geo.NewPoint(-10, 50), geo.NewPoint(-50, 50)))
+}
@@ -0,0 +1,242 @@
+// attribution reports where the remote icons and images of a diagram come from, so that
+// the licenses of icon packs can be reviewed before generated diagrams are shipped.
+//
+// Packs are recognized by the URLs icons are fetched from. The license of a pack is only
+// stated when the whole pack is under one license; otherwise the terms page is linked.
+package attribution
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+type Pack struct {
+	Name string `json:"name"`
+	// Source is the homepage of the pack
+	Source string `json:"source"`
+	// License is an SPDX identifier, or a short description when there is none
+	License    string `json:"license"`
+	LicenseURL string `json:"licenseURL"`
+}
+
+// Packs are tried in order, so more specific prefixes come first
+var Packs = []struct {
+	// Prefix is matched against the host and unescaped path of icon URLs
+	Prefix string
+	Pack   Pack
+}{
+	{"icons.terrastruct.com/aws/", Pack{
+		Name:       "AWS Architecture Icons",
+		Source:     "https://aws.amazon.com/architecture/icons/",
+		License:    "AWS Architecture Icons terms",
+		LicenseURL: "https://aws.amazon.com/architecture/icons/",
+	}},
+	{"icons.terrastruct.com/azure/", Pack{
+		Name:       "Azure Architecture Icons",
+		Source:     "https://learn.microsoft.com/en-us/azure/architecture/icons/",
+		License:    "Microsoft Azure Architecture Icons terms",
+		LicenseURL: "https://learn.microsoft.com/en-us/azure/architecture/icons/",
+	}},
+	{"icons.terrastruct.com/gcp/", Pack{
+		Name:       "Google Cloud Icons",
+		Source:     "https://cloud.google.com/icons",
+		License:    "Google Cloud icons terms",
+		LicenseURL: "https://cloud.google.com/icons",
+	}},
+	{"icons.terrastruct.com/", Pack{
+		Name:       "Terrastruct Icons",
+		Source:     "https://icons.terrastruct.com",
+		License:    "See source",
+		LicenseURL: "https://icons.terrastruct.com",
+	}},
+	{"cdn.simpleicons.org/", simpleIcons},
+	{"cdn.jsdelivr.net/npm/simple-icons", simpleIcons},
+	{"cdn.jsdelivr.net/gh/devicons/devicon", devicon},
+	{"cdn.jsdelivr.net/npm/devicon", devicon},
+	{"use.fontawesome.com/", fontAwesome},
+	{"cdn.jsdelivr.net/npm/@fortawesome/", fontAwesome},
+	{"fonts.gstatic.com/s/i/", Pack{
+		Name:       "Material Icons",
+		Source:     "https://fonts.google.com/icons",
+		License:    "Apache-2.0",
+		LicenseURL: "https://www.apache.org/licenses/LICENSE-2.0",
+	}},
+	{"api.iconify.design/", Pack{
+		Name:       "Iconify",
+		Source:     "https://iconify.design",
+		License:    "Varies by icon set",
+		LicenseURL: "https://icon-sets.iconify.design",
+	}},
+}
+
+var simpleIcons = Pack{
+	Name:       "Simple Icons",
+	Source:     "https://simpleicons.org",
+	License:    "CC0-1.0",
+	LicenseURL: "https://github.com/simple-icons/simple-icons/blob/develop/LICENSE.md",
+}
+
+var devicon = Pack{
+	Name:       "Devicon",
+	Source:     "https://devicon.dev",
+	License:    "MIT",
+	LicenseURL: "https://github.com/devicons/devicon/blob/master/LICENSE",
+}
+
+var fontAwesome = Pack{
+	Name:       "Font Awesome Free",
+	Source:     "https://fontawesome.com",
+	License:    "CC-BY-4.0",
+	LicenseURL: "https://fontawesome.com/license/free",
+}
+
+type Manifest struct {
+	Packs []*PackIcons `json:"packs"`
+	// Unknown are remote icons that aren't from a known pack and so must be reviewed by hand
+	Unknown []string `json:"unknown"`
+}
+
+type PackIcons struct {
+	Pack
+	// Icons are the URLs of the pack's icons used in the diagram
+	Icons []string `json:"icons"`
+}
+
+// Match returns the pack an icon URL belongs to, or nil when it isn't from a known pack
+func Match(u *url.URL) *Pack {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	s := strings.ToLower(u.Host) + u.Path
+	for _, p := range Packs {
+		if strings.HasPrefix(s, p.Prefix) {
+			pack := p.Pack
+			return &pack
+		}
+	}
+	return nil
+}
+
+// Collect lists the remote icons of the diagram and all its boards by pack.
+// Local icons are the user's own and are left out.
+func Collect(diagram *d2target.Diagram) *Manifest {
+	m := newManifest()
+	m.collect(diagram, true)
+	return m.sort()
+}
+
+// CollectBoard is like Collect but only for the given board, without its layers, scenarios,
+// and steps
+func CollectBoard(diagram *d2target.Diagram) *Manifest {
+	m := newManifest()
+	m.collect(diagram, false)
+	return m.sort()
+}
+
+func newManifest() *Manifest {
+	return &Manifest{
+		Packs:   []*PackIcons{},
+		Unknown: []string{},
+	}
+}
+
+func (m *Manifest) collect(diagram *d2target.Diagram, recursive bool) {
+	for _, s := range diagram.Shapes {
+		if s.Icon == nil || (s.Icon.Scheme != "http" && s.Icon.Scheme != "https") {
+			continue
+		}
+		m.add(s.Icon)
+	}
+	if !recursive {
+		return
+	}
+	for _, boards := range [][]*d2target.Diagram{diagram.Layers, diagram.Scenarios, diagram.Steps} {
+		for _, d := range boards {
+			m.collect(d, true)
+		}
+	}
+}
+
+func (m *Manifest) add(u *url.URL) {
+	icon := u.String()
+	pack := Match(u)
+	if pack == nil {
+		if !contains(m.Unknown, icon) {
+			m.Unknown = append(m.Unknown, icon)
+		}
+		return
+	}
+	for _, p := range m.Packs {
+		if p.Name == pack.Name {
+			if !contains(p.Icons, icon) {
+				p.Icons = append(p.Icons, icon)
+			}
+			return
+		}
+	}
+	m.Packs = append(m.Packs, &PackIcons{
+		Pack:  *pack,
+		Icons: []string{icon},
+	})
+}
+
+func (m *Manifest) sort() *Manifest {
+	sort.Slice(m.Packs, func(i, j int) bool {
+		return m.Packs[i].Name < m.Packs[j].Name
+	})
+	for _, p := range m.Packs {
+		sort.Strings(p.Icons)
+	}
+	sort.Strings(m.Unknown)
+	return m
+}
+
+func (m *Manifest) Empty() bool {
+	return len(m.Packs) == 0 && len(m.Unknown) == 0
+}
+
+// JSON encodes the manifest for compliance tooling
+func (m *Manifest) JSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Lines describes the manifest in a few human readable lines, one per pack, for footers
+func (m *Manifest) Lines() []string {
+	var lines []string
+	for _, p := range m.Packs {
+		icons := "icons"
+		if len(p.Icons) == 1 {
+			icons = "icon"
+		}
+		lines = append(lines, fmt.Sprintf("%d %s from %s (%s), %s: %s", len(p.Icons), icons, p.Name, p.Source, p.License, p.LicenseURL))
+	}
+	if len(m.Unknown) == 1 {
+		lines = append(lines, "1 icon from an unknown source")
+	} else if len(m.Unknown) > 1 {
+		lines = append(lines, fmt.Sprintf("%d icons from unknown sources", len(m.Unknown)))
+	}
+	return lines
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package attribution
+
+import (
+	"net/url"
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		url  string
+		pack string
+	}{
+		{"https://icons.terrastruct.com/aws%2FCompute%2FAWS-Lambda.svg", "AWS Architecture Icons"},
+		{"https://icons.terrastruct.com/azure%2FCompute%2FFunction-Apps.svg", "Azure Architecture Icons"},
+		{"https://icons.terrastruct.com/gcp%2FProducts%20and%20services%2FCompute%2FCloud%20Functions.svg", "Google Cloud Icons"},
+		{"https://icons.terrastruct.com/essentials%2F005-programmer.svg", "Terrastruct Icons"},
+		{"https://cdn.simpleicons.org/github", "Simple Icons"},
+		{"https://cdn.jsdelivr.net/npm/simple-icons@v9/icons/github.svg", "Simple Icons"},
+		{"https://cdn.jsdelivr.net/gh/devicons/devicon/icons/go/go-original.svg", "Devicon"},
+		{"https://api.iconify.design/mdi/home.svg", "Iconify"},
+		{"https://example.com/logo.png", ""},
+		{"file:///icons.terrastruct.com/aws/x.svg", ""},
+	}
+	for _, tc := range testCases {
+		u, err := url.Parse(tc.url)
+		tassert.Nil(t, err)
+		p := Match(u)
+		if tc.pack == "" {
+			tassert.Nil(t, p, tc.url)
+			continue
+		}
+		if tassert.NotNil(t, p, tc.url) {
+			tassert.Equal(t, tc.pack, p.Name, tc.url)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	shape := func(icon string) d2target.Shape {
+		u, err := url.Parse(icon)
+		tassert.Nil(t, err)
+		return d2target.Shape{Icon: u}
+	}
+	diagram := &d2target.Diagram{
+		Shapes: []d2target.Shape{
+			shape("https://cdn.simpleicons.org/github"),
+			shape("https://cdn.simpleicons.org/github"),
+			shape("https://cdn.simpleicons.org/go"),
+			shape("./local.svg"),
+			{},
+		},
+		Layers: []*d2target.Diagram{
+			{
+				Shapes: []d2target.Shape{
+					shape("https://icons.terrastruct.com/aws%2FCompute%2FAWS-Lambda.svg"),
+					shape("https://example.com/logo.png"),
+				},
+			},
+		},
+	}
+
+	m := Collect(diagram)
+	if tassert.Len(t, m.Packs, 2) {
+		tassert.Equal(t, "AWS Architecture Icons", m.Packs[0].Name)
+		tassert.Equal(t, "Simple Icons", m.Packs[1].Name)
+		tassert.Equal(t, []string{"https://cdn.simpleicons.org/github", "https://cdn.simpleicons.org/go"}, m.Packs[1].Icons)
+	}
+	tassert.Equal(t, []string{"https://example.com/logo.png"}, m.Unknown)
+
+	board := CollectBoard(diagram)
+	tassert.Equal(t, []string{
+		"2 icons from Simple Icons (https://simpleicons.org), CC0-1.0: https://github.com/simple-icons/simple-icons/blob/develop/LICENSE.md",
+	}, board.Lines())
+	tassert.True(t, CollectBoard(&d2target.Diagram{}).Empty())
+}
@@ -0,0 +1,40 @@
+// Package cachefile has helpers for the on-disk caches of the CLI, which are read and written
+// by concurrent runs.
+package cachefile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// Hash returns the hex encoded SHA-256 of b, which cache files are named by
+func Hash(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// Write writes b to path, creating its directory if needed. It writes through a temporary file
+// so that concurrent runs never read a partially written file.
+func Write(path string, b []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,27 @@
+package cachefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+)
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a", Hash([]byte("hello")))
+	assert.Success(t, Write(path, []byte("hello")))
+	assert.Success(t, Write(path, []byte("world")))
+
+	b, err := os.ReadFile(path)
+	assert.Success(t, err)
+	assert.Equal(t, "world", string(b))
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Success(t, err)
+	assert.Equal(t, 1, len(entries))
+}
@@ -116,6 +116,43 @@ func Luminance(colorString string) (float64, error) {
 	return l, nil
 }
 
+// ContrastRatio is the WCAG contrast ratio of two colors, from 1:1 to 21:1, which is how
+// readable text of one color is on the other, see
+// https://www.w3.org/TR/WCAG21/#dfn-contrast-ratio
+func ContrastRatio(colorString1, colorString2 string) (float64, error) {
+	l1, err := relativeLuminance(colorString1)
+	if err != nil {
+		return 0, err
+	}
+	l2, err := relativeLuminance(colorString2)
+	if err != nil {
+		return 0, err
+	}
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	return (l1 + 0.05) / (l2 + 0.05), nil
+}
+
+// relativeLuminance is the WCAG relative luminance of an opaque color, from 0 for black to 1
+// for white
+func relativeLuminance(colorString string) (float64, error) {
+	c, err := csscolorparser.Parse(colorString)
+	if err != nil {
+		return 0, err
+	}
+	if c.A < 1 {
+		return 0, fmt.Errorf("cannot compute the luminance of translucent color %v", colorString)
+	}
+	linear := func(v float64) float64 {
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B), nil
+}
+
 const (
 	N1 = "N1" // foreground color
 	N2 = "N2"
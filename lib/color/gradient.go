@@ -0,0 +1,183 @@
+package color
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/util-go/go2"
+)
+
+const (
+	LinearGradient = "linear"
+	RadialGradient = "radial"
+)
+
+// Gradient is a CSS linear-gradient or radial-gradient, like
+//
+//	linear-gradient(to right, #fff, #ccc 80%)
+//
+// Its colors must be named colors or hex codes.
+type Gradient struct {
+	Type string
+	// Angle is the direction of a linear gradient, in degrees clockwise from up as in CSS
+	Angle float64
+	Stops []ColorStop
+}
+
+type ColorStop struct {
+	Color string
+	// Offset is where the color is along the gradient, from 0 to 1
+	Offset float64
+}
+
+// IsGradient returns whether s is meant to be a gradient, though it may not be a valid one
+func IsGradient(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "linear-gradient(") || strings.HasPrefix(s, "radial-gradient(")
+}
+
+var sides = map[string]float64{
+	"top":          0,
+	"top right":    45,
+	"right":        90,
+	"bottom right": 135,
+	"bottom":       180,
+	"bottom left":  225,
+	"left":         270,
+	"top left":     315,
+}
+
+// ParseGradient parses a gradient. Stops without offsets are spread between the ones around
+// them, as in CSS.
+func ParseGradient(s string) (Gradient, error) {
+	s = strings.TrimSpace(s)
+	open := strings.Index(s, "(")
+	if !IsGradient(s) || !strings.HasSuffix(s, ")") {
+		return Gradient{}, fmt.Errorf(`gradients look like "linear-gradient(#fff, #ccc)" or "radial-gradient(#fff, #ccc)"`)
+	}
+	g := Gradient{
+		Type:  strings.TrimSuffix(strings.ToLower(s[:open]), "-gradient"),
+		Angle: 180,
+	}
+
+	args := strings.Split(s[open+1:len(s)-1], ",")
+	for i := range args {
+		args[i] = strings.Join(strings.Fields(args[i]), " ")
+	}
+	if g.Type == LinearGradient && len(args) > 0 {
+		first := strings.ToLower(args[0])
+		switch {
+		case strings.HasPrefix(first, "to "):
+			side := strings.TrimPrefix(first, "to ")
+			angle, ok := sides[side]
+			if !ok {
+				// "to right top" is "to top right"
+				if parts := strings.Fields(side); len(parts) == 2 {
+					angle, ok = sides[parts[1]+" "+parts[0]]
+				}
+			}
+			if !ok {
+				return Gradient{}, fmt.Errorf("unknown direction %#v", args[0])
+			}
+			g.Angle = angle
+			args = args[1:]
+		case strings.HasSuffix(first, "deg"):
+			angle, err := strconv.ParseFloat(strings.TrimSuffix(first, "deg"), 64)
+			if err != nil {
+				return Gradient{}, fmt.Errorf("invalid angle %#v", args[0])
+			}
+			g.Angle = angle
+			args = args[1:]
+		}
+	}
+	if len(args) < 2 {
+		return Gradient{}, fmt.Errorf("gradients need at least two colors")
+	}
+
+	offsets := make([]float64, len(args))
+	for i, arg := range args {
+		c := arg
+		offsets[i] = math.NaN()
+		if space := strings.LastIndex(arg, " "); space != -1 && strings.HasSuffix(arg, "%") {
+			c = arg[:space]
+			p, err := strconv.ParseFloat(strings.TrimSuffix(arg[space+1:], "%"), 64)
+			if err != nil {
+				return Gradient{}, fmt.Errorf("invalid offset %#v", arg[space+1:])
+			}
+			offsets[i] = p / 100
+		}
+		if !go2.Contains(NamedColors, strings.ToLower(c)) && !ColorHexRegex.MatchString(c) {
+			return Gradient{}, fmt.Errorf("%#v is not a named color or a hex code", c)
+		}
+		g.Stops = append(g.Stops, ColorStop{Color: c})
+	}
+
+	if math.IsNaN(offsets[0]) {
+		offsets[0] = 0
+	}
+	if math.IsNaN(offsets[len(offsets)-1]) {
+		offsets[len(offsets)-1] = 1
+	}
+	for i := 1; i < len(offsets); i++ {
+		if !math.IsNaN(offsets[i]) {
+			// Offsets before the ones they follow are moved up to them
+			offsets[i] = math.Max(offsets[i], offsets[i-1])
+			continue
+		}
+		next := i + 1
+		for math.IsNaN(offsets[next]) {
+			next++
+		}
+		end := math.Max(offsets[next], offsets[i-1])
+		for j := i; j < next; j++ {
+			offsets[j] = offsets[i-1] + (end-offsets[i-1])*float64(j-i+1)/float64(next-i+1)
+		}
+		i = next - 1
+	}
+	for i := range g.Stops {
+		g.Stops[i].Offset = math.Max(0, math.Min(1, offsets[i]))
+	}
+	return g, nil
+}
+
+// GradientID returns the ID of the SVG definition of gradient s. Equal gradients share the
+// same ID, so each is defined once per diagram.
+func GradientID(s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("gradient-%x", h.Sum32())
+}
+
+// SVG returns the definition of g as an SVG gradient, spanning the bounds of what it fills
+func (g Gradient) SVG(id string) string {
+	format := func(f float64) string {
+		// Adding 0 turns -0 into 0
+		return strconv.FormatFloat(math.Round(f*1e4)/1e4+0, 'f', -1, 64)
+	}
+	var b strings.Builder
+	switch g.Type {
+	case RadialGradient:
+		// Reaches the corners, like CSS's default farthest-corner ellipse
+		fmt.Fprintf(&b, `<radialGradient id="%s" cx="0.5" cy="0.5" r="%s">`, id, format(math.Sqrt2/2))
+	default:
+		// The line through the center at the angle, long enough that the corners get the first
+		// and last colors, as in CSS
+		rad := g.Angle * math.Pi / 180
+		dx, dy := math.Sin(rad), -math.Cos(rad)
+		half := (math.Abs(dx) + math.Abs(dy)) / 2
+		fmt.Fprintf(&b, `<linearGradient id="%s" x1="%s" y1="%s" x2="%s" y2="%s">`, id,
+			format(0.5-dx*half), format(0.5-dy*half), format(0.5+dx*half), format(0.5+dy*half))
+	}
+	for _, stop := range g.Stops {
+		fmt.Fprintf(&b, `<stop offset="%s" stop-color="%s" />`, format(stop.Offset), stop.Color)
+	}
+	if g.Type == RadialGradient {
+		b.WriteString("</radialGradient>")
+	} else {
+		b.WriteString("</linearGradient>")
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package color
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGradient(t *testing.T) {
+	tcs := []struct {
+		in     string
+		exp    Gradient
+		expErr string
+	}{
+		{
+			in: "linear-gradient(#fff, #ccc)",
+			exp: Gradient{Type: LinearGradient, Angle: 180, Stops: []ColorStop{
+				{"#fff", 0}, {"#ccc", 1},
+			}},
+		},
+		{
+			in: "Linear-Gradient( to right top , white 20%, orange, #000 )",
+			exp: Gradient{Type: LinearGradient, Angle: 45, Stops: []ColorStop{
+				{"white", 0.2}, {"orange", 0.6}, {"#000", 1},
+			}},
+		},
+		{
+			in: "linear-gradient(30deg, red, green, blue 40%, black 20%)",
+			exp: Gradient{Type: LinearGradient, Angle: 30, Stops: []ColorStop{
+				{"red", 0}, {"green", 0.2}, {"blue", 0.4}, {"black", 0.4},
+			}},
+		},
+		{
+			in: "radial-gradient(#FFCDD2, #E53935)",
+			exp: Gradient{Type: RadialGradient, Angle: 180, Stops: []ColorStop{
+				{"#FFCDD2", 0}, {"#E53935", 1},
+			}},
+		},
+		{
+			in:     "linear-gradient(#fff)",
+			expErr: "gradients need at least two colors",
+		},
+		{
+			in:     "linear-gradient(to middle, #fff, #000)",
+			expErr: `unknown direction "to middle"`,
+		},
+		{
+			in:     "linear-gradient(#fff, N1)",
+			expErr: `"N1" is not a named color or a hex code`,
+		},
+		{
+			in:     "linear-gradient(#fff, #000",
+			expErr: `gradients look like "linear-gradient(#fff, #ccc)" or "radial-gradient(#fff, #ccc)"`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.in, func(t *testing.T) {
+			assert.True(t, IsGradient(tc.in))
+			g, err := ParseGradient(tc.in)
+			if tc.expErr != "" {
+				assert.EqualError(t, err, tc.expErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.exp.Type, g.Type)
+			assert.Equal(t, tc.exp.Angle, g.Angle)
+			assert.Equal(t, len(tc.exp.Stops), len(g.Stops))
+			for i, stop := range tc.exp.Stops {
+				assert.Equal(t, stop.Color, g.Stops[i].Color)
+				assert.InDelta(t, stop.Offset, g.Stops[i].Offset, 1e-9)
+			}
+		})
+	}
+	assert.False(t, IsGradient("#fff"))
+}
+
+func TestGradientSVG(t *testing.T) {
+	g, err := ParseGradient("linear-gradient(to right, #fff, #000)")
+	assert.NoError(t, err)
+	assert.Equal(t, `<linearGradient id="a" x1="0" y1="0.5" x2="1" y2="0.5"><stop offset="0" stop-color="#fff" /><stop offset="1" stop-color="#000" /></linearGradient>`, g.SVG("a"))
+
+	g, err = ParseGradient("linear-gradient(to top right, #fff, #000)")
+	assert.NoError(t, err)
+	assert.Equal(t, `<linearGradient id="a" x1="0" y1="1" x2="1" y2="0"><stop offset="0" stop-color="#fff" /><stop offset="1" stop-color="#000" /></linearGradient>`, g.SVG("a"))
+
+	g, err = ParseGradient("radial-gradient(#fff, #000)")
+	assert.NoError(t, err)
+	assert.Equal(t, `<radialGradient id="a" cx="0.5" cy="0.5" r="0.7071"><stop offset="0" stop-color="#fff" /><stop offset="1" stop-color="#000" /></radialGradient>`, g.SVG("a"))
+
+	assert.Equal(t, GradientID("linear-gradient(#fff, #000)"), GradientID("linear-gradient(#fff, #000)"))
+	assert.NotEqual(t, GradientID("linear-gradient(#fff, #000)"), GradientID("linear-gradient(#000, #fff)"))
+}
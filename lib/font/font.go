@@ -208,3 +208,85 @@ func Sfnt2Woff(fontBuf []byte) ([]byte, error) {
 
 	return out, nil
 }
+
+// Woff2Sfnt converts .woff fonts back to the sfnt fonts they were made from, the reverse of
+// Sfnt2Woff. WOFF2 fonts, which are compressed with Brotli, aren't supported.
+func Woff2Sfnt(woffBuf []byte) ([]byte, error) {
+	if len(woffBuf) < SIZE_OF_WOFF_HEADER {
+		return nil, fmt.Errorf("woff header is truncated")
+	}
+	if binary.BigEndian.Uint32(woffBuf[WOFF_OFFSET_MAGIC:]) != MAGIC_WOFF {
+		if string(woffBuf[:4]) == "wOF2" {
+			return nil, fmt.Errorf("WOFF2 fonts are not supported")
+		}
+		return nil, fmt.Errorf("not a woff font")
+	}
+	flavor := binary.BigEndian.Uint32(woffBuf[WOFF_OFFSET_FLAVOR:])
+	numTables := int(binary.BigEndian.Uint16(woffBuf[WOFF_OFFSET_NUM_TABLES:]))
+	if len(woffBuf) < SIZE_OF_WOFF_HEADER+numTables*SIZE_OF_WOFF_ENTRY {
+		return nil, fmt.Errorf("woff table directory is truncated")
+	}
+
+	// The sfnt header's search fields, from the largest power of 2 tables fit in
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * SIZE_OF_SFNT_TABLE_ENTRY
+	sfntHeader := make([]byte, SIZE_OF_SFNT_HEADER)
+	binary.BigEndian.PutUint32(sfntHeader[0:], flavor)
+	binary.BigEndian.PutUint16(sfntHeader[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(sfntHeader[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(sfntHeader[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(sfntHeader[10:], uint16(numTables*SIZE_OF_SFNT_TABLE_ENTRY-searchRange))
+
+	tableDirectory := make([]byte, numTables*SIZE_OF_SFNT_TABLE_ENTRY)
+	var tableBytes []byte
+	sfntOffset := uint32(SIZE_OF_SFNT_HEADER + numTables*SIZE_OF_SFNT_TABLE_ENTRY)
+	for i := 0; i < numTables; i++ {
+		entry := woffBuf[SIZE_OF_WOFF_HEADER+i*SIZE_OF_WOFF_ENTRY:]
+		tag := binary.BigEndian.Uint32(entry[WOFF_ENTRY_OFFSET_TAG:])
+		offset := binary.BigEndian.Uint32(entry[WOFF_ENTRY_OFFSET_OFFSET:])
+		compLength := binary.BigEndian.Uint32(entry[WOFF_ENTRY_OFFSET_COMPR_LENGTH:])
+		length := binary.BigEndian.Uint32(entry[WOFF_ENTRY_OFFSET_LENGTH:])
+		checksum := binary.BigEndian.Uint32(entry[WOFF_ENTRY_OFFSET_CHECKSUM:])
+		if uint64(offset)+uint64(compLength) > uint64(len(woffBuf)) {
+			return nil, fmt.Errorf("woff table %d is truncated", i)
+		}
+
+		data := woffBuf[offset : offset+compLength]
+		// Tables are only deflated when it makes them smaller
+		if compLength < length {
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to inflate woff table %d: %v", i, err)
+			}
+			var inflated bytes.Buffer
+			_, err = inflated.ReadFrom(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to inflate woff table %d: %v", i, err)
+			}
+			data = inflated.Bytes()
+		}
+		if uint32(len(data)) != length {
+			return nil, fmt.Errorf("woff table %d is %d bytes, expected %d", i, len(data), length)
+		}
+
+		b := tableDirectory[i*SIZE_OF_SFNT_TABLE_ENTRY:]
+		binary.BigEndian.PutUint32(b[SFNT_OFFSET_TAG:], tag)
+		binary.BigEndian.PutUint32(b[SFNT_OFFSET_CHECKSUM:], checksum)
+		binary.BigEndian.PutUint32(b[SFNT_OFFSET_OFFSET:], sfntOffset)
+		binary.BigEndian.PutUint32(b[SFNT_OFFSET_LENGTH:], length)
+
+		table := make([]byte, longAlign(length))
+		copy(table, data)
+		tableBytes = append(tableBytes, table...)
+		sfntOffset += uint32(len(table))
+	}
+
+	var out []byte
+	out = append(out, sfntHeader...)
+	out = append(out, tableDirectory...)
+	out = append(out, tableBytes...)
+	return out, nil
+}
@@ -0,0 +1,123 @@
+// Package iconpack is the registry of the icon packs built into D2, so icons can be written like
+// aws/s3 instead of with the URLs of the icons hosted at https://icons.terrastruct.com.
+//
+// Icons are fetched from there when diagrams are rendered, and cached with --bundle-icons=cache
+// so renders after the first build offline.
+package iconpack
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// BASE_URL is where the icons of the icon packs are hosted
+const BASE_URL = "https://icons.terrastruct.com/"
+
+type Icon struct {
+	// Name is how the icon is written in diagrams, like aws/s3
+	Name string
+	// Path is the path of the icon under BASE_URL
+	Path string
+}
+
+func (i Icon) URL() string {
+	return BASE_URL + url.PathEscape(i.Path)
+}
+
+// Packs are the names of the icon packs, which are the first part of the names of their icons
+var Packs = []string{"aws", "gcp", "azure", "k8s", "dev", "essentials"}
+
+// Lookup returns the icon named name, like aws/s3. Names are case insensitive.
+func Lookup(name string) (Icon, bool) {
+	p, ok := icons[strings.ToLower(name)]
+	if !ok {
+		return Icon{}, false
+	}
+	return Icon{Name: strings.ToLower(name), Path: p}, true
+}
+
+// Search returns the icons whose names or paths contain every word of query, sorted by name.
+// Icons whose names contain them come first.
+func Search(query string) []Icon {
+	words := strings.Fields(strings.ToLower(query))
+	contains := func(s string) bool {
+		s = strings.ToLower(s)
+		for _, w := range words {
+			if !strings.Contains(s, w) {
+				return false
+			}
+		}
+		return true
+	}
+	var byName, byPath []Icon
+	for name, p := range icons {
+		switch {
+		case contains(name):
+			byName = append(byName, Icon{Name: name, Path: p})
+		case contains(p):
+			byPath = append(byPath, Icon{Name: name, Path: p})
+		}
+	}
+	for _, results := range [][]Icon{byName, byPath} {
+		sort.Slice(results, func(i, j int) bool {
+			return results[i].Name < results[j].Name
+		})
+	}
+	return append(byName, byPath...)
+}
+
+var icons = map[string]string{
+	"aws/api-gateway":  "aws/Networking & Content Delivery/Amazon-API-Gateway.svg",
+	"aws/cloudfront":   "aws/Networking & Content Delivery/Amazon-CloudFront.svg",
+	"aws/codedeploy":   "aws/Developer Tools/AWS-CodeDeploy.svg",
+	"aws/compute":      "aws/Compute/Compute.svg",
+	"aws/dynamodb":     "aws/Database/Amazon-DynamoDB.svg",
+	"aws/ec2":          "aws/Compute/Amazon-EC2.svg",
+	"aws/ec2-c4":       "aws/Compute/_Instance/Amazon-EC2_C4-Instance_light-bg.svg",
+	"aws/ec2-group":    "aws/_Group Icons/EC2-instance-container_light-bg.svg",
+	"aws/email":        "aws/_General/AWS-Email_light-bg.svg",
+	"aws/fargate":      "aws/Compute/AWS-Fargate.svg",
+	"aws/lambda":       "aws/Compute/AWS-Lambda.svg",
+	"aws/rds":          "aws/Database/Amazon-RDS.svg",
+	"aws/route53":      "aws/Networking & Content Delivery/Amazon-Route-53.svg",
+	"aws/route53-zone": "aws/Networking & Content Delivery/Amazon-Route-53_Hosted-Zone_light-bg.svg",
+	"aws/s3":           "aws/Storage/Amazon-Simple-Storage-Service-S3.svg",
+	"aws/sns":          "aws/Application Integration/Amazon-Simple-Notification-Service-SNS.svg",
+	"aws/sqs":          "aws/Application Integration/Amazon-Simple-Queue-Service-SQS.svg",
+	"aws/vpc":          "aws/_Group Icons/Virtual-private-cloud-VPC_light-bg.svg",
+
+	"gcp/bigquery":        "gcp/Products and services/Data Analytics/BigQuery.svg",
+	"gcp/cloud-functions": "gcp/Products and services/Compute/Cloud Functions.svg",
+	"gcp/cloud-storage":   "gcp/Products and services/Storage/Cloud Storage.svg",
+	"gcp/compute-engine":  "gcp/Products and services/Compute/Compute Engine.svg",
+
+	"azure/app-service-certificates": "azure/Web Service Color/App Service Certificates.svg",
+	"azure/app-service-domains":      "azure/Web Service Color/App Service Domains.svg",
+	"azure/function-apps":            "azure/Compute/Function-Apps.svg",
+	"azure/identity-governance":      "azure/Identity Service Color/Identity governance.svg",
+
+	"k8s/kubernetes": "azure/_Companies/Kubernetes.svg",
+
+	"dev/docker":     "dev/docker.svg",
+	"dev/git":        "dev/git.svg",
+	"dev/github":     "dev/github.svg",
+	"dev/mongodb":    "dev/mongodb.svg",
+	"dev/mysql":      "dev/mysql.svg",
+	"dev/postgresql": "dev/postgresql.svg",
+	"dev/slack":      "dev/slack.svg",
+	"dev/windows":    "dev/windows.svg",
+
+	"essentials/add":        "essentials/073-add.svg",
+	"essentials/database":   "essentials/117-database.svg",
+	"essentials/layers":     "essentials/220-layers.svg",
+	"essentials/menu":       "essentials/087-menu.svg",
+	"essentials/network":    "infra/019-network.svg",
+	"essentials/picture":    "essentials/004-picture.svg",
+	"essentials/profits":    "essentials/profits.svg",
+	"essentials/programmer": "essentials/005-programmer.svg",
+	"essentials/server":     "essentials/112-server.svg",
+	"essentials/target":     "essentials/142-target.svg",
+	"essentials/time":       "essentials/time.svg",
+	"essentials/user":       "essentials/365-user.svg",
+}
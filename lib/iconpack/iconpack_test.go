@@ -0,0 +1,39 @@
+package iconpack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	i, ok := Lookup("AWS/Lambda")
+	assert.True(t, ok)
+	assert.Equal(t, "aws/lambda", i.Name)
+	assert.Equal(t, "https://icons.terrastruct.com/aws%2FCompute%2FAWS-Lambda.svg", i.URL())
+
+	_, ok = Lookup("aws/nope")
+	assert.False(t, ok)
+}
+
+func TestSearch(t *testing.T) {
+	var names []string
+	for _, i := range Search("compute") {
+		names = append(names, i.Name)
+	}
+	// Icons named after the query come before those whose paths match it
+	assert.Equal(t, []string{"aws/compute", "gcp/compute-engine"}, names[:2])
+	assert.Contains(t, names, "aws/lambda")
+
+	assert.Len(t, Search("storage s3"), 1)
+	assert.Empty(t, Search("nope"))
+}
+
+func TestPacks(t *testing.T) {
+	for name := range icons {
+		pack, _, _ := strings.Cut(name, "/")
+		assert.Contains(t, Packs, pack, name)
+		assert.Equal(t, strings.ToLower(name), name)
+	}
+}
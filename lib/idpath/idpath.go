@@ -0,0 +1,55 @@
+// Package idpath looks up the shapes of a rendered diagram by the paths of their IDs, for
+// exporters that need to know which shape contains which.
+package idpath
+
+import (
+	"fmt"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2parser"
+)
+
+// Split returns the path of the object with the given ID, e.g. ["a", "b.c"] for a."b.c"
+func Split(id string) ([]string, error) {
+	k, err := d2parser.ParseKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ID %q: %w", id, err)
+	}
+	return k.IDA(), nil
+}
+
+// Key returns the key of path in a Map
+func Key(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// Map holds a value for each of a set of paths
+type Map[T any] map[string]T
+
+// Set sets the value of path
+func (m Map[T]) Set(path []string, v T) {
+	m[Key(path)] = v
+}
+
+// Ancestor returns the value of the closest path at or above path, or the zero value of T if
+// there is none
+func (m Map[T]) Ancestor(path []string) T {
+	for i := len(path); i > 0; i-- {
+		if v, ok := m[Key(path[:i])]; ok {
+			return v
+		}
+	}
+	var zero T
+	return zero
+}
+
+// ConnectionEnd returns the Ancestor of the object with the given ID, which is what a connection
+// to it is drawn to
+func (m Map[T]) ConnectionEnd(id string) (T, error) {
+	path, err := Split(id)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return m.Ancestor(path), nil
+}
@@ -0,0 +1,30 @@
+package idpath
+
+import (
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+)
+
+func TestMap(t *testing.T) {
+	t.Parallel()
+
+	m := make(Map[string])
+	m.Set([]string{"a"}, "a")
+	m.Set([]string{"a", "b.c"}, "a.b.c")
+
+	end, err := m.ConnectionEnd(`a."b.c".d`)
+	assert.Success(t, err)
+	assert.Equal(t, "a.b.c", end)
+
+	end, err = m.ConnectionEnd("a.b")
+	assert.Success(t, err)
+	assert.Equal(t, "a", end)
+
+	end, err = m.ConnectionEnd("x")
+	assert.Success(t, err)
+	assert.Equal(t, "", end)
+
+	_, err = m.ConnectionEnd("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+// imagemap describes the clickable regions of raster exports, so that links and tooltips
+// survive rasterization. Regions are written either as an HTML image map to embed with the
+// image or as JSON keyed by object ID.
+package imagemap
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"oss.terrastruct.com/d2/d2parser"
+	"oss.terrastruct.com/d2/d2target"
+)
+
+// Region is the bounding box of an object in image pixels
+type Region struct {
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Label   string `json:"label,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Tooltip string `json:"tooltip,omitempty"`
+}
+
+// Regions returns the region of every object, keyed by ID. viewboxX and viewboxY are the
+// origin of the rendered SVG and scale is how many image pixels there are per SVG unit.
+func Regions(diagram *d2target.Diagram, viewboxX, viewboxY, scale float64) map[string]Region {
+	regions := make(map[string]Region, len(diagram.Shapes))
+	for _, shape := range diagram.Shapes {
+		x1 := scale * (float64(shape.Pos.X) - viewboxX - float64(shape.StrokeWidth))
+		y1 := scale * (float64(shape.Pos.Y) - viewboxY - float64(shape.StrokeWidth))
+		x2 := x1 + scale*(float64(shape.Width)+float64(shape.StrokeWidth*2))
+		y2 := y1 + scale*(float64(shape.Height)+float64(shape.StrokeWidth*2))
+		x, y := int(math.Floor(x1)), int(math.Floor(y1))
+		regions[shape.ID] = Region{
+			X:       x,
+			Y:       y,
+			Width:   int(math.Ceil(x2)) - x,
+			Height:  int(math.Ceil(y2)) - y,
+			Label:   shape.Label,
+			Link:    shape.Link,
+			Tooltip: shape.Tooltip,
+		}
+	}
+	return regions
+}
+
+// JSON returns the regions keyed by object ID
+func JSON(regions map[string]Region) ([]byte, error) {
+	b, err := json.MarshalIndent(regions, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// HTML returns an img of imagePath, relative to where the HTML is written, with a map of the
+// regions that have a link or a tooltip. Links to other boards aren't kept since they don't
+// point anywhere outside of D2.
+func HTML(diagram *d2target.Diagram, regions map[string]Region, imagePath string, width, height int) []byte {
+	// Nested objects come first since the first area containing a click wins
+	shapes := append([]d2target.Shape(nil), diagram.Shapes...)
+	sort.SliceStable(shapes, func(i, j int) bool {
+		return shapes[i].Level > shapes[j].Level
+	})
+
+	name := "d2-" + strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<img src="%s" width="%d" height="%d" usemap="#%s" alt="%s">`+"\n", html.EscapeString(imagePath), width, height, html.EscapeString(name), html.EscapeString(name))
+	fmt.Fprintf(&sb, `<map name="%s">`+"\n", html.EscapeString(name))
+	for _, shape := range shapes {
+		r := regions[shape.ID]
+		link := r.Link
+		if isBoardLink(link) {
+			link = ""
+		}
+		if link == "" && r.Tooltip == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, `  <area shape="rect" coords="%d,%d,%d,%d"`, r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+		if link != "" {
+			fmt.Fprintf(&sb, ` href="%s"`, html.EscapeString(link))
+		}
+		if r.Tooltip != "" {
+			fmt.Fprintf(&sb, ` title="%s"`, html.EscapeString(r.Tooltip))
+		}
+		fmt.Fprintf(&sb, ` alt="%s">`+"\n", html.EscapeString(r.Label))
+	}
+	sb.WriteString("</map>\n")
+	return []byte(sb.String())
+}
+
+// Page returns HTML as a page of its own, to open next to the image so exports stay
+// clickable without embedding them anywhere
+func Page(diagram *d2target.Diagram, regions map[string]Region, imagePath string, width, height int) []byte {
+	title := strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath))
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(title))
+	sb.WriteString("</head>\n<body>\n")
+	sb.Write(HTML(diagram, regions, imagePath, width, height))
+	sb.WriteString("</body>\n</html>\n")
+	return []byte(sb.String())
+}
+
+func isBoardLink(link string) bool {
+	if link == "" {
+		return false
+	}
+	key, err := d2parser.ParseKey(link)
+	return err == nil && key.Path[0].Unbox().ScalarString() == "root"
+}
@@ -0,0 +1,57 @@
+package imagemap
+
+import (
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/d2target"
+)
+
+func TestHTML(t *testing.T) {
+	t.Parallel()
+
+	diagram := d2target.NewDiagram()
+	container := d2target.BaseShape()
+	container.ID = "c"
+	container.Pos = d2target.Point{X: 0, Y: 0}
+	container.Width, container.Height = 200, 100
+	container.StrokeWidth = 2
+	container.Level = 1
+	container.Tooltip = `a "quoted" tooltip`
+
+	child := d2target.BaseShape()
+	child.ID = "c.d"
+	child.Label = "d"
+	child.Pos = d2target.Point{X: 20, Y: 30}
+	child.Width, child.Height = 50, 40
+	child.Level = 2
+	child.Link = "https://d2lang.com"
+
+	board := d2target.BaseShape()
+	board.ID = "e"
+	board.Level = 1
+	board.Link = "root.layers.x"
+
+	plain := d2target.BaseShape()
+	plain.ID = "f"
+	plain.Level = 1
+
+	diagram.Shapes = []d2target.Shape{*container, *child, *board, *plain}
+
+	regions := Regions(diagram, -10, -10, 2)
+	assert.Equal(t, Region{X: 16, Y: 16, Width: 400 + 8, Height: 200 + 8, Tooltip: `a "quoted" tooltip`}, regions["c"])
+	assert.Equal(t, Region{X: 56, Y: 76, Width: 108, Height: 88, Label: "d", Link: "https://d2lang.com"}, regions["c.d"])
+	assert.Equal(t, 4, len(regions))
+
+	got := string(HTML(diagram, regions, "out.png", 440, 240))
+	assert.Equal(t, `<img src="out.png" width="440" height="240" usemap="#d2-out" alt="d2-out">
+<map name="d2-out">
+  <area shape="rect" coords="56,76,164,164" href="https://d2lang.com" alt="d">
+  <area shape="rect" coords="16,16,424,224" title="a &#34;quoted&#34; tooltip" alt="">
+</map>
+`, got)
+
+	page := string(Page(diagram, regions, "out.png", 440, 240))
+	assert.Equal(t, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>out</title>\n</head>\n<body>\n"+got+"</body>\n</html>\n", page)
+}
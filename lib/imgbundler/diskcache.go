@@ -0,0 +1,72 @@
+package imgbundler
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"oss.terrastruct.com/d2/lib/cachefile"
+)
+
+// Ways remote images can be bundled, see the --bundle-icons flag
+const (
+	// ModeCache inlines remote images, reusing copies from a DiskCache when possible
+	ModeCache = "cache"
+	// ModeInline inlines remote images, fetching them on every render
+	ModeInline = "inline"
+	// ModeSkip leaves remote images as links
+	ModeSkip = "skip"
+)
+
+// DiskCache persists fetched remote images across runs so that repeated renders don't refetch
+// them and renders without network access succeed as long as every image was fetched before.
+//
+// Images are stored by the hash of their contents in Dir/blobs, and Dir/urls maps the hash
+// of each URL to the content hash and mime type of the image it returned.
+type DiskCache struct {
+	Dir string
+}
+
+// DefaultDiskCacheDir returns the directory the CLI caches remote images in
+func DefaultDiskCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "d2", "images"), nil
+}
+
+// Get returns the cached image fetched from href.
+// Entries whose blob is missing or doesn't match its hash are treated as misses.
+func (dc *DiskCache) Get(href string) (buf []byte, mimeType string, ok bool) {
+	entry, err := os.ReadFile(filepath.Join(dc.Dir, "urls", cachefile.Hash([]byte(href))))
+	if err != nil {
+		return nil, "", false
+	}
+	contentHash, mimeType, found := strings.Cut(string(bytes.TrimSpace(entry)), " ")
+	if !found {
+		return nil, "", false
+	}
+	buf, err = os.ReadFile(filepath.Join(dc.Dir, "blobs", contentHash))
+	if err != nil || cachefile.Hash(buf) != contentHash {
+		return nil, "", false
+	}
+	return buf, mimeType, true
+}
+
+// Put stores the image fetched from href
+func (dc *DiskCache) Put(href string, buf []byte, mimeType string) error {
+	contentHash := cachefile.Hash(buf)
+	err := cachefile.Write(filepath.Join(dc.Dir, "blobs", contentHash), buf)
+	if err != nil {
+		return fmt.Errorf("failed to cache image: %w", err)
+	}
+	entry := fmt.Sprintf("%s %s\n", contentHash, mimeType)
+	err = cachefile.Write(filepath.Join(dc.Dir, "urls", cachefile.Hash([]byte(href))), []byte(entry))
+	if err != nil {
+		return fmt.Errorf("failed to cache image: %w", err)
+	}
+	return nil
+}
@@ -31,11 +31,17 @@ const maxImageSize int64 = 1 << 25 // 33_554_432
 var imageRegex = regexp.MustCompile(`<image href="([^"]+)"`)
 
 func BundleLocal(ctx context.Context, l simplelog.Logger, inputPath string, in []byte, cacheImages bool) ([]byte, error) {
-	return bundle(ctx, l, inputPath, in, false, cacheImages)
+	return bundle(ctx, l, inputPath, in, false, cacheImages, nil)
 }
 
 func BundleRemote(ctx context.Context, l simplelog.Logger, in []byte, cacheImages bool) ([]byte, error) {
-	return bundle(ctx, l, "", in, true, cacheImages)
+	return bundle(ctx, l, "", in, true, cacheImages, nil)
+}
+
+// BundleRemoteCached is BundleRemote but images are looked up in dc before being fetched,
+// and fetched images are added to it
+func BundleRemoteCached(ctx context.Context, l simplelog.Logger, in []byte, cacheImages bool, dc *DiskCache) ([]byte, error) {
+	return bundle(ctx, l, "", in, true, cacheImages, dc)
 }
 
 type repl struct {
@@ -43,7 +49,7 @@ type repl struct {
 	to   []byte
 }
 
-func bundle(ctx context.Context, l simplelog.Logger, inputPath string, svg []byte, isRemote, cacheImages bool) (_ []byte, err error) {
+func bundle(ctx context.Context, l simplelog.Logger, inputPath string, svg []byte, isRemote, cacheImages bool, dc *DiskCache) (_ []byte, err error) {
 	if isRemote {
 		defer xdefer.Errorf(&err, "failed to bundle remote images")
 	} else {
@@ -59,7 +65,7 @@ func bundle(ctx context.Context, l simplelog.Logger, inputPath string, svg []byt
 	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
 	defer cancel()
 
-	return runWorkers(ctx, l, inputPath, svg, imgs, isRemote, cacheImages)
+	return runWorkers(ctx, l, inputPath, svg, imgs, isRemote, cacheImages, dc)
 }
 
 // filterImageElements finds all unique image elements in imgs that are
@@ -89,7 +95,7 @@ func filterImageElements(imgs [][][]byte, isRemote bool) [][][]byte {
 	return imgs2
 }
 
-func runWorkers(ctx context.Context, l simplelog.Logger, inputPath string, svg []byte, imgs [][][]byte, isRemote, cacheImages bool) (_ []byte, err error) {
+func runWorkers(ctx context.Context, l simplelog.Logger, inputPath string, svg []byte, imgs [][][]byte, isRemote, cacheImages bool, dc *DiskCache) (_ []byte, err error) {
 	var wg sync.WaitGroup
 	replc := make(chan repl)
 
@@ -116,7 +122,7 @@ func runWorkers(ctx context.Context, l simplelog.Logger, inputPath string, svg [
 					<-sema
 				}()
 
-				bundledImage, err := worker(ctx, l, inputPath, img[1], isRemote, cacheImages)
+				bundledImage, err := worker(ctx, l, inputPath, img[1], isRemote, cacheImages, dc)
 				if err != nil {
 					l.Error(fmt.Sprintf("failed to bundle %s: %v", img[1], err))
 					errhrefsMu.Lock()
@@ -155,7 +161,7 @@ func runWorkers(ctx context.Context, l simplelog.Logger, inputPath string, svg [
 	}
 }
 
-func worker(ctx context.Context, l simplelog.Logger, inputPath string, href []byte, isRemote, cacheImages bool) ([]byte, error) {
+func worker(ctx context.Context, l simplelog.Logger, inputPath string, href []byte, isRemote, cacheImages bool, dc *DiskCache) ([]byte, error) {
 	if cacheImages {
 		if hit, ok := imgCache.Load(string(href)); ok {
 			return hit.([]byte), nil
@@ -165,8 +171,22 @@ func worker(ctx context.Context, l simplelog.Logger, inputPath string, href []by
 	var mimeType string
 	var err error
 	if isRemote {
-		l.Debug(fmt.Sprintf("fetching %s remotely", string(href)))
-		buf, mimeType, err = httpGet(ctx, html.UnescapeString(string(href)))
+		u := html.UnescapeString(string(href))
+		var hit bool
+		if dc != nil {
+			buf, mimeType, hit = dc.Get(u)
+		}
+		if hit {
+			l.Debug(fmt.Sprintf("using cached %s", string(href)))
+		} else {
+			l.Debug(fmt.Sprintf("fetching %s remotely", string(href)))
+			buf, mimeType, err = httpGet(ctx, u)
+			if err == nil && dc != nil {
+				if cacheErr := dc.Put(u, buf, mimeType); cacheErr != nil {
+					l.Info(cacheErr.Error())
+				}
+			}
+		}
 	} else {
 		l.Debug(fmt.Sprintf("reading %s from disk", string(href)))
 		path := html.UnescapeString(string(href))
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -377,3 +378,56 @@ width="328" height="587" viewBox="-100 -131 328 587"><style type="text/css">
 	}
 	tassert.Equal(t, 2, count)
 }
+
+func TestDiskCache(t *testing.T) {
+	imgCache = sync.Map{}
+	ctx := log.WithTB(context.Background(), t, &slogtest.Options{IgnoreErrors: true})
+	url := "https://icons.terrastruct.com/essentials/004-picture.svg"
+	sampleSVG := fmt.Sprintf(`<svg><image href="%s" x="0" y="0" width="128" height="128" /></svg>`, url)
+
+	count := 0
+	offline := false
+	httpClient.Transport = roundTripFunc(func(req *http.Request) *http.Response {
+		count++
+		respRecorder := httptest.NewRecorder()
+		if offline {
+			respRecorder.WriteHeader(500)
+			return respRecorder.Result()
+		}
+		respRecorder.Header().Set("Content-Type", "image/svg+xml")
+		respRecorder.WriteString(`<svg xmlns="http://www.w3.org/2000/svg"><rect width="1" height="1"/></svg>`)
+		respRecorder.WriteHeader(200)
+		return respRecorder.Result()
+	})
+
+	l := simplelog.FromLibLog(ctx)
+	dc := &DiskCache{Dir: t.TempDir()}
+	out1, err := BundleRemoteCached(ctx, l, []byte(sampleSVG), false, dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tassert.Equal(t, 1, count)
+
+	// A later run, e.g. another process, reuses the cached copy even without network access
+	offline = true
+	out2, err := BundleRemoteCached(ctx, l, []byte(sampleSVG), false, &DiskCache{Dir: dc.Dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tassert.Equal(t, 1, count)
+	tassert.Equal(t, string(out1), string(out2))
+
+	// Corrupted blobs are not used
+	blobs, err := filepath.Glob(filepath.Join(dc.Dir, "blobs", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tassert.Equal(t, 1, len(blobs))
+	err = os.WriteFile(blobs[0], []byte("corrupted"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = BundleRemoteCached(ctx, l, []byte(sampleSVG), false, dc)
+	tassert.Error(t, err)
+	tassert.Equal(t, 2, count)
+}
@@ -235,6 +235,54 @@ func (position Position) IsOnEdge() bool {
 	}
 }
 
+// HorizontallyMirrored returns the position on the opposite side horizontally, e.g.
+// OutsideTopLeft becomes OutsideTopRight. Centered positions are unchanged.
+func (position Position) HorizontallyMirrored() Position {
+	switch position {
+	case OutsideTopLeft:
+		return OutsideTopRight
+	case OutsideTopRight:
+		return OutsideTopLeft
+
+	case OutsideLeftTop:
+		return OutsideRightTop
+	case OutsideLeftMiddle:
+		return OutsideRightMiddle
+	case OutsideLeftBottom:
+		return OutsideRightBottom
+
+	case OutsideRightTop:
+		return OutsideLeftTop
+	case OutsideRightMiddle:
+		return OutsideLeftMiddle
+	case OutsideRightBottom:
+		return OutsideLeftBottom
+
+	case OutsideBottomLeft:
+		return OutsideBottomRight
+	case OutsideBottomRight:
+		return OutsideBottomLeft
+
+	case InsideTopLeft:
+		return InsideTopRight
+	case InsideTopRight:
+		return InsideTopLeft
+
+	case InsideMiddleLeft:
+		return InsideMiddleRight
+	case InsideMiddleRight:
+		return InsideMiddleLeft
+
+	case InsideBottomLeft:
+		return InsideBottomRight
+	case InsideBottomRight:
+		return InsideBottomLeft
+
+	default:
+		return position
+	}
+}
+
 func (position Position) Mirrored() Position {
 	switch position {
 	case OutsideTopLeft:
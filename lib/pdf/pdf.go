@@ -53,6 +53,15 @@ func (g *GoFPDF) GetFillRGB(themeID int64, fill string) (color.RGB, error) {
 		}, nil
 	}
 
+	if color.IsGradient(fill) {
+		// Pages are filled with the color the gradient starts with
+		g, err := color.ParseGradient(fill)
+		if err != nil {
+			return color.RGB{}, err
+		}
+		fill = g.Stops[0].Color
+	}
+
 	if color.IsThemeColor(fill) {
 		theme := d2themescatalog.Find(themeID)
 		fill = d2themes.ResolveThemeColor(theme, fill)
@@ -80,6 +89,28 @@ func (g *GoFPDF) AddPDFPage(png []byte, titlePath []BoardTitle, themeID int64, f
 	imageWidth := imageInfo.Width() / 2
 	imageHeight := imageInfo.Height() / 2
 
+	imageX, imageY, drawSeparator, err := g.addPage(titlePath, themeID, fill, imageWidth, imageHeight, pageMap, includeNav)
+	if err != nil {
+		return err
+	}
+
+	// Draw image
+	g.pdf.ImageOptions(strings.Join(boardPath, "/"), imageX, imageY, imageWidth, imageHeight, false, opt, 0, "")
+
+	g.drawLinks(shapes, imageX-viewboxX, imageY-viewboxY, pageMap)
+	drawSeparator()
+	return nil
+}
+
+// addPage adds a page with the header for a board whose content is contentWidth by
+// contentHeight, and returns where the content goes. The separator between the header and
+// the content is drawn last, over the content.
+func (g *GoFPDF) addPage(titlePath []BoardTitle, themeID int64, fill string, contentWidth, contentHeight float64, pageMap map[string]int, includeNav bool) (contentX, contentY float64, drawSeparator func(), err error) {
+	boardPath := make([]string, len(titlePath))
+	for i, t := range titlePath {
+		boardPath[i] = t.Name
+	}
+
 	// calculate page dimensions
 	var pageWidth float64
 	var pageHeight float64
@@ -96,12 +127,12 @@ func (g *GoFPDF) AddPDFPage(png []byte, titlePath []BoardTitle, themeID int64, f
 	}
 
 	minPageDimension := 576.0
-	pageWidth = math.Max(math.Max(minPageDimension, imageWidth), headerWidth)
-	pageHeight = math.Max(minPageDimension, imageHeight)
+	pageWidth = math.Max(math.Max(minPageDimension, contentWidth), headerWidth)
+	pageHeight = math.Max(minPageDimension, contentHeight)
 
 	fillRGB, err := g.GetFillRGB(themeID, fill)
 	if err != nil {
-		return err
+		return 0, 0, nil, err
 	}
 
 	// Add page
@@ -146,19 +177,30 @@ func (g *GoFPDF) AddPDFPage(png []byte, titlePath []BoardTitle, themeID int64, f
 		g.pdf.CellFormat(pageWidth-prefixWidth-headerMargin, headerHeight, boardName, "", 0, "", false, 0, "")
 	}
 
-	// Draw image
-	imageX := (pageWidth - imageWidth) / 2
-	imageY := headerHeight + (pageHeight-imageHeight)/2
-	g.pdf.ImageOptions(strings.Join(boardPath, "/"), imageX, imageY, imageWidth, imageHeight, false, opt, 0, "")
+	drawSeparator = func() {
+		// Draw header/img separator
+		g.pdf.SetXY(headerMargin, headerHeight)
+		g.pdf.SetLineWidth(1)
+		if fillRGB.IsLight() {
+			g.pdf.SetDrawColor(10, 15, 37) // steel-900
+		} else {
+			g.pdf.SetDrawColor(255, 255, 255)
+		}
+		g.pdf.CellFormat(pageWidth-(headerMargin*2), 1, "", "T", 0, "", false, 0, "")
+	}
+
+	return (pageWidth - contentWidth) / 2, headerHeight + (pageHeight-contentHeight)/2, drawSeparator, nil
+}
 
-	// Draw links
+// drawLinks adds the links of shapes, whose positions are offset by offsetX and offsetY on the page
+func (g *GoFPDF) drawLinks(shapes []d2target.Shape, offsetX, offsetY float64, pageMap map[string]int) {
 	for _, shape := range shapes {
 		if shape.Link == "" {
 			continue
 		}
 
-		linkX := imageX + float64(shape.Pos.X) - viewboxX - float64(shape.StrokeWidth)
-		linkY := imageY + float64(shape.Pos.Y) - viewboxY - float64(shape.StrokeWidth)
+		linkX := offsetX + float64(shape.Pos.X) - float64(shape.StrokeWidth)
+		linkY := offsetY + float64(shape.Pos.Y) - float64(shape.StrokeWidth)
 		linkWidth := float64(shape.Width) + float64(shape.StrokeWidth*2)
 		linkHeight := float64(shape.Height) + float64(shape.StrokeWidth*2)
 
@@ -175,18 +217,6 @@ func (g *GoFPDF) AddPDFPage(png []byte, titlePath []BoardTitle, themeID int64, f
 			}
 		}
 	}
-
-	// Draw header/img separator
-	g.pdf.SetXY(headerMargin, headerHeight)
-	g.pdf.SetLineWidth(1)
-	if fillRGB.IsLight() {
-		g.pdf.SetDrawColor(10, 15, 37) // steel-900
-	} else {
-		g.pdf.SetDrawColor(255, 255, 255)
-	}
-	g.pdf.CellFormat(pageWidth-(headerMargin*2), 1, "", "T", 0, "", false, 0, "")
-
-	return nil
 }
 
 func (g *GoFPDF) Export(outputPath string) error {
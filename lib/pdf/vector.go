@@ -0,0 +1,712 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"oss.terrastruct.com/d2/d2renderers/d2fonts"
+	"oss.terrastruct.com/d2/d2target"
+	"oss.terrastruct.com/d2/d2themes"
+	"oss.terrastruct.com/d2/d2themes/d2themescatalog"
+	"oss.terrastruct.com/d2/lib/arrowhead"
+	"oss.terrastruct.com/d2/lib/color"
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/label"
+	"oss.terrastruct.com/d2/lib/shape"
+	"oss.terrastruct.com/d2/lib/svg"
+)
+
+// The vector pipeline draws boards into the PDF directly, without rendering them to PNG in a
+// browser first. It covers the common shapes, connections, and plain labels. Boards using
+// anything else are reported by VectorUnsupported, so that they're rendered through the
+// browser instead.
+
+// VectorUnsupported returns why the board can't be drawn by AddVectorPage, or nil if it can.
+// Layers, scenarios, and steps aren't checked.
+func VectorUnsupported(diagram *d2target.Diagram, themeID int64, sketch bool) error {
+	if sketch {
+		return fmt.Errorf("sketch mode")
+	}
+	theme := d2themescatalog.Find(themeID)
+	colors := func(colors ...string) error {
+		for _, c := range colors {
+			_, _, err := parseColor(theme, c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	root := diagram.Root
+	if root.StrokeWidth != 0 && root.Stroke != "" {
+		return fmt.Errorf("board strokes")
+	}
+	if root.DoubleBorder {
+		return fmt.Errorf("board double borders")
+	}
+	if root.FillPattern != "" && root.FillPattern != color.None {
+		return fmt.Errorf("fill patterns")
+	}
+	if color.IsGradient(root.Fill) {
+		return fmt.Errorf("gradients")
+	}
+
+	for _, s := range diagram.Shapes {
+		switch s.Type {
+		case d2target.ShapeClass, d2target.ShapeSQLTable, d2target.ShapeCode, d2target.ShapeImage, d2target.ShapeBoard:
+			return fmt.Errorf("%s shapes", s.Type)
+		case d2target.ShapeText:
+			if s.Language != "" {
+				return fmt.Errorf("markdown and LaTeX text")
+			}
+		}
+		if _, ok := d2target.DSL_SHAPE_TO_SHAPE_TYPE[s.Type]; !ok {
+			return fmt.Errorf("%s shapes", s.Type)
+		}
+		switch {
+		case s.Icon != nil:
+			return fmt.Errorf("icons")
+		case s.Tooltip != "":
+			return fmt.Errorf("tooltips")
+		case s.Shadow:
+			return fmt.Errorf("shadows")
+		case s.ThreeDee:
+			return fmt.Errorf("3d shapes")
+		case s.Multiple:
+			return fmt.Errorf("multiple shapes")
+		case s.DoubleBorder:
+			return fmt.Errorf("double borders")
+		case s.StrokeDotted:
+			return fmt.Errorf("dotted borders")
+		case s.FillPattern != "" && s.FillPattern != color.None:
+			return fmt.Errorf("fill patterns")
+		case color.IsGradient(s.Fill):
+			return fmt.Errorf("gradients")
+		}
+		err := colors(s.Fill, s.Stroke, s.GetFontColor(), s.LabelFill)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range diagram.Connections {
+		for _, arrowhead := range []d2target.Arrowhead{c.SrcArrow, c.DstArrow} {
+			switch arrowhead {
+			case d2target.CfOne, d2target.CfMany, d2target.CfOneRequired, d2target.CfManyRequired:
+				return fmt.Errorf("crow's foot arrowheads")
+			}
+		}
+		switch {
+		case c.Icon != nil:
+			return fmt.Errorf("icons")
+		case c.Language != "":
+			return fmt.Errorf("markdown labels")
+		case c.Tooltip != "":
+			return fmt.Errorf("tooltips")
+		case len(c.Route) < 2:
+			return fmt.Errorf("connections without routes")
+		}
+		err := colors(c.Stroke, c.Fill, c.GetFontColor())
+		if err != nil {
+			return err
+		}
+		for _, l := range []*d2target.Text{c.SrcLabel, c.DstLabel} {
+			if l != nil {
+				err = colors(l.Color)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// AddVectorPage is like AddPDFPage, but draws the board itself instead of a PNG of it.
+// The board must pass VectorUnsupported. Links are kept as clickable areas.
+func (g *GoFPDF) AddVectorPage(diagram *d2target.Diagram, titlePath []BoardTitle, themeID int64, pad int64, pageMap map[string]int, includeNav bool) error {
+	theme := d2themescatalog.Find(themeID)
+
+	// Same viewbox as SVG renders
+	tl, br := diagram.BoundingBox()
+	viewboxX := float64(tl.X) - float64(pad)
+	viewboxY := float64(tl.Y) - float64(pad)
+	width := float64(br.X-tl.X) + float64(pad*2)
+	height := float64(br.Y-tl.Y) + float64(pad*2)
+
+	contentX, contentY, drawSeparator, err := g.addPage(titlePath, themeID, diagram.Root.Fill, width, height, pageMap, includeNav)
+	if err != nil {
+		return err
+	}
+
+	fontFamily := d2fonts.SourceSansPro
+	if diagram.FontFamily != nil {
+		fontFamily = *diagram.FontFamily
+	}
+	for _, style := range []struct {
+		gofpdf string
+		d2     d2fonts.FontStyle
+	}{
+		{"", d2fonts.FONT_STYLE_REGULAR},
+		{"B", d2fonts.FONT_STYLE_BOLD},
+		{"I", d2fonts.FONT_STYLE_ITALIC},
+	} {
+		g.pdf.AddUTF8FontFromBytes(vectorFontName(fontFamily), style.gofpdf, d2fonts.FontFaces.Get(fontFamily.Font(0, style.d2)))
+		g.pdf.AddUTF8FontFromBytes(vectorFontName(d2fonts.SourceCodePro), style.gofpdf, d2fonts.FontFaces.Get(d2fonts.SourceCodePro.Font(0, style.d2)))
+	}
+
+	p := &vectorPainter{
+		pdf:        g.pdf,
+		theme:      theme,
+		fontFamily: fontFamily,
+		idToShape:  make(map[string]d2target.Shape, len(diagram.Shapes)),
+		pageBox:    []gofpdf.PointType{{X: viewboxX, Y: viewboxY}, {X: viewboxX + width, Y: viewboxY}, {X: viewboxX + width, Y: viewboxY + height}, {X: viewboxX, Y: viewboxY + height}},
+	}
+	for _, s := range diagram.Shapes {
+		p.idToShape[s.ID] = s
+	}
+
+	g.pdf.TransformBegin()
+	g.pdf.TransformTranslate(contentX-viewboxX, contentY-viewboxY)
+	if style := p.style(diagram.Root.Fill, "", 0, 0); style != "" {
+		radius := math.Min(float64(diagram.Root.BorderRadius), math.Min(width, height)/2)
+		if radius > 0 {
+			g.pdf.RoundedRect(viewboxX, viewboxY, width, height, radius, "1234", style)
+		} else {
+			g.pdf.Rect(viewboxX, viewboxY, width, height, style)
+		}
+	}
+	for _, obj := range sortObjects(diagram) {
+		switch obj := obj.(type) {
+		case d2target.Shape:
+			err = p.drawShape(obj)
+		case d2target.Connection:
+			err = p.drawConnection(obj)
+		}
+		if err != nil {
+			g.pdf.TransformEnd()
+			return err
+		}
+	}
+	g.pdf.TransformEnd()
+	p.reset()
+
+	g.drawLinks(diagram.Shapes, contentX-viewboxX, contentY-viewboxY, pageMap)
+	drawSeparator()
+	if g.pdf.Err() {
+		return g.pdf.Error()
+	}
+	return nil
+}
+
+func vectorFontName(fontFamily d2fonts.FontFamily) string {
+	return "d2-" + strings.ToLower(strings.ReplaceAll(string(fontFamily), " ", "-"))
+}
+
+type drawable interface {
+	GetID() string
+	GetZIndex() int
+}
+
+// sortObjects orders shapes and connections like the SVG renderer draws them
+func sortObjects(diagram *d2target.Diagram) []drawable {
+	objects := make([]drawable, 0, len(diagram.Shapes)+len(diagram.Connections))
+	for _, s := range diagram.Shapes {
+		objects = append(objects, s)
+	}
+	for _, c := range diagram.Connections {
+		objects = append(objects, c)
+	}
+	sort.SliceStable(objects, func(a, b int) bool {
+		i, j := objects[a], objects[b]
+		if i.GetZIndex() != j.GetZIndex() {
+			return i.GetZIndex() < j.GetZIndex()
+		}
+		iShape, iIsShape := i.(d2target.Shape)
+		jShape, jIsShape := j.(d2target.Shape)
+		if iIsShape && jIsShape {
+			return iShape.Level < jShape.Level
+		}
+		_, jIsConnection := j.(d2target.Connection)
+		return iIsShape && jIsConnection
+	})
+	return objects
+}
+
+type vectorPainter struct {
+	pdf        *gofpdf.Fpdf
+	theme      d2themes.Theme
+	fontFamily d2fonts.FontFamily
+	idToShape  map[string]d2target.Shape
+	// pageBox is the visible area, for clipping out connection labels
+	pageBox []gofpdf.PointType
+}
+
+func (p *vectorPainter) reset() {
+	p.pdf.SetAlpha(1, "Normal")
+	p.pdf.SetDashPattern([]float64{}, 0)
+}
+
+// style sets the colors and stroke for the next drawing, returning the gofpdf draw style, or
+// "" if there's nothing to draw
+func (p *vectorPainter) style(fill, stroke string, strokeWidth int, strokeDash float64) string {
+	fillRGB, hasFill, _ := parseColor(p.theme, fill)
+	strokeRGB, hasStroke, _ := parseColor(p.theme, stroke)
+	if strokeWidth == 0 {
+		hasStroke = false
+	}
+	p.pdf.SetFillColor(int(fillRGB.Red), int(fillRGB.Green), int(fillRGB.Blue))
+	p.pdf.SetDrawColor(int(strokeRGB.Red), int(strokeRGB.Green), int(strokeRGB.Blue))
+	p.pdf.SetLineWidth(float64(strokeWidth))
+	if strokeDash != 0 {
+		dashSize, gapSize := svg.GetStrokeDashAttributes(float64(strokeWidth), strokeDash)
+		p.pdf.SetDashPattern([]float64{dashSize, gapSize}, 0)
+	} else {
+		p.pdf.SetDashPattern([]float64{}, 0)
+	}
+	switch {
+	case hasFill && hasStroke:
+		return "FD"
+	case hasFill:
+		return "F"
+	case hasStroke:
+		return "D"
+	}
+	return ""
+}
+
+func (p *vectorPainter) drawShape(s d2target.Shape) error {
+	if s.Opacity == 0 {
+		return nil
+	}
+	tl := geo.NewPoint(float64(s.Pos.X), float64(s.Pos.Y))
+	width := float64(s.Width)
+	height := float64(s.Height)
+	fill, stroke := d2themes.ShapeTheme(s)
+	shapeType := d2target.DSL_SHAPE_TO_SHAPE_TYPE[s.Type]
+	sh := shape.NewShape(shapeType, geo.NewBox(tl, width, height))
+	if shapeType == shape.CLOUD_TYPE && s.ContentAspectRatio != nil {
+		sh.SetInnerBoxAspectRatio(*s.ContentAspectRatio)
+	}
+	if s.CustomShape != nil {
+		sh.SetCustomDefinition(s.CustomShape)
+	}
+
+	if s.Blend {
+		p.pdf.SetAlpha(s.Opacity*0.5, "Multiply")
+	} else {
+		p.pdf.SetAlpha(s.Opacity, "Normal")
+	}
+	style := p.style(fill, stroke, s.StrokeWidth, s.StrokeDash)
+	if style != "" {
+		switch s.Type {
+		case d2target.ShapeText:
+		case d2target.ShapeRectangle, d2target.ShapeSequenceDiagram, d2target.ShapeHierarchy, "":
+			radius := math.Min(float64(s.BorderRadius), math.Min(width, height)/2)
+			if radius > 0 {
+				p.pdf.RoundedRect(tl.X, tl.Y, width, height, radius, "1234", style)
+			} else {
+				p.pdf.Rect(tl.X, tl.Y, width, height, style)
+			}
+		case d2target.ShapeOval:
+			p.pdf.Ellipse(tl.X+width/2, tl.Y+height/2, width/2, height/2, 0, style)
+		default:
+			for _, pathData := range sh.GetSVGPathData() {
+				err := p.drawPath(pathData, style)
+				if err != nil {
+					return fmt.Errorf("failed to draw %s: %w", s.ID, err)
+				}
+			}
+		}
+	}
+	p.pdf.SetAlpha(s.Opacity, "Normal")
+
+	if s.Label == "" {
+		return nil
+	}
+	labelPosition := label.FromString(s.LabelPosition)
+	var box *geo.Box
+	if labelPosition.IsOutside() {
+		box = sh.GetBox()
+	} else {
+		box = sh.GetInnerBox()
+	}
+	labelTL := labelPosition.GetPointOnBox(box, label.PADDING, float64(s.LabelWidth), float64(s.LabelHeight))
+	if s.LabelFill != "" {
+		if style := p.style(s.LabelFill, "", 0, 0); style != "" {
+			p.pdf.Rect(labelTL.X, labelTL.Y, float64(s.LabelWidth), float64(s.LabelHeight), style)
+		}
+	}
+	p.drawText(s.Text, s.GetFontColor(), labelTL, float64(s.LabelWidth), float64(s.LabelHeight))
+	return nil
+}
+
+func (p *vectorPainter) drawConnection(c d2target.Connection) error {
+	if c.Opacity == 0 {
+		return nil
+	}
+	p.pdf.SetAlpha(c.Opacity, "Normal")
+
+	var labelTL *geo.Point
+	if c.Label != "" {
+		labelTL = c.GetLabelTopLeft()
+		labelTL.X = math.Round(labelTL.X)
+		labelTL.Y = math.Round(labelTL.Y)
+	}
+
+	route := c.Route
+	srcShape := p.idToShape[c.Src]
+	dstShape := p.idToShape[c.Dst]
+	srcAdj := arrowhead.Adjustment(route[1], route[0], c.SrcArrow, c.StrokeWidth, srcShape.StrokeWidth)
+	dstAdj := arrowhead.Adjustment(route[len(route)-2], route[len(route)-1], c.DstArrow, c.StrokeWidth, dstShape.StrokeWidth)
+
+	strokeDash := c.StrokeDash
+	if strokeDash == 0 && c.Animated {
+		strokeDash = 5
+	}
+	style := p.style("", c.Stroke, c.StrokeWidth, strokeDash)
+	if style != "" {
+		// Labels on the connection cut a gap into it, by clipping to the page minus the label
+		if labelTL != nil && label.FromString(c.LabelPosition).IsOnEdge() {
+			p.pdf.ClipPolygon(p.clipOut(labelTL, float64(c.LabelWidth), float64(c.LabelHeight)), false)
+		}
+		err := p.drawPath(connectionPathData(c, srcAdj, dstAdj), style)
+		if labelTL != nil && label.FromString(c.LabelPosition).IsOnEdge() {
+			p.pdf.ClipEnd()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to draw %s: %w", c.ID, err)
+		}
+
+		p.pdf.SetDashPattern([]float64{}, 0)
+		start := route[0].AddVector(geo.NewVector(srcAdj.X, srcAdj.Y))
+		end := route[len(route)-1].AddVector(geo.NewVector(dstAdj.X, dstAdj.Y))
+		p.drawArrowhead(c, c.SrcArrow, false, start, geo.NewVector(route[1].X-start.X, route[1].Y-start.Y))
+		p.drawArrowhead(c, c.DstArrow, true, end, geo.NewVector(end.X-route[len(route)-2].X, end.Y-route[len(route)-2].Y))
+	}
+
+	if labelTL != nil {
+		if c.Fill != color.Empty {
+			if style := p.style(c.Fill, "", 0, 0); style != "" {
+				p.pdf.Rect(labelTL.X, labelTL.Y, float64(c.LabelWidth), float64(c.LabelHeight), style)
+			}
+		}
+		p.drawText(c.Text, c.GetFontColor(), labelTL, float64(c.LabelWidth), float64(c.LabelHeight))
+	}
+
+	for _, isDst := range []bool{false, true} {
+		l := c.SrcLabel
+		if isDst {
+			l = c.DstLabel
+		}
+		if l == nil || l.Label == "" {
+			continue
+		}
+		text := d2target.Text{
+			Label:      l.Label,
+			FontSize:   c.FontSize,
+			FontFamily: c.FontFamily,
+			Italic:     true,
+		}
+		fontColor := d2target.FG_COLOR
+		if l.Color != "" {
+			fontColor = l.Color
+		}
+		p.drawText(text, fontColor, c.GetArrowheadLabelPosition(isDst), float64(l.LabelWidth), float64(l.LabelHeight))
+	}
+	return nil
+}
+
+// clipOut returns a polygon of the page with a hole for the given box. The hole is traced in
+// the opposite direction, which excludes it under the nonzero winding rule.
+func (p *vectorPainter) clipOut(tl *geo.Point, width, height float64) []gofpdf.PointType {
+	points := append([]gofpdf.PointType{}, p.pageBox...)
+	return append(points,
+		p.pageBox[0],
+		gofpdf.PointType{X: tl.X, Y: tl.Y},
+		gofpdf.PointType{X: tl.X, Y: tl.Y + height},
+		gofpdf.PointType{X: tl.X + width, Y: tl.Y + height},
+		gofpdf.PointType{X: tl.X + width, Y: tl.Y},
+		gofpdf.PointType{X: tl.X, Y: tl.Y},
+	)
+}
+
+// drawText draws a label like the SVG renderer, centered in its box with the baseline of the
+// first line a font size down
+func (p *vectorPainter) drawText(text d2target.Text, fontColor string, tl *geo.Point, width, height float64) {
+	family := vectorFontName(p.fontFamily)
+	if text.FontFamily == "mono" {
+		family = vectorFontName(d2fonts.SourceCodePro)
+	}
+	style := ""
+	if text.Bold {
+		style = "B"
+	} else if text.Italic {
+		style = "I"
+	}
+	if text.Underline {
+		style += "U"
+	}
+	p.pdf.SetFont(family, style, float64(text.FontSize))
+	rgb, _, _ := parseColor(p.theme, fontColor)
+	p.pdf.SetTextColor(int(rgb.Red), int(rgb.Green), int(rgb.Blue))
+
+	lines := strings.Split(text.Label, "\n")
+	y := tl.Y + float64(text.FontSize)
+	for i, line := range lines {
+		if i > 0 {
+			y += height / float64(len(lines))
+		}
+		p.pdf.Text(tl.X+width/2-p.pdf.GetStringWidth(line)/2, y, line)
+	}
+}
+
+// drawArrowhead draws an arrowhead at the end of a connection, going in direction dir. The
+// arrowheads are those of the SVG renderer's markers, which are drawn in a box of the
+// arrowhead's dimensions with the connection along the x axis.
+func (p *vectorPainter) drawArrowhead(c d2target.Connection, head d2target.Arrowhead, isTarget bool, at *geo.Point, dir geo.Vector) {
+	outline := arrowhead.GetOutline(head, isTarget, float64(c.StrokeWidth))
+	if outline == nil {
+		return
+	}
+	ref := arrowhead.Ref(head, isTarget, float64(c.StrokeWidth))
+
+	unit := dir.Unit()
+	transform := func(pt *geo.Point) gofpdf.PointType {
+		dx, dy := pt.X-ref.X, pt.Y-ref.Y
+		return gofpdf.PointType{
+			X: at.X + dx*unit[0] - dy*unit[1],
+			Y: at.Y + dx*unit[1] + dy*unit[0],
+		}
+	}
+	var points []gofpdf.PointType
+	for _, pt := range outline.Points {
+		points = append(points, transform(pt))
+	}
+
+	p.pdf.SetLineJoinStyle("miter")
+	defer p.pdf.SetLineJoinStyle("")
+	var style string
+	switch {
+	case outline.Filled:
+		style = p.style(c.Stroke, "", 0, 0)
+	case outline.Open:
+		p.style("", c.Stroke, c.StrokeWidth, 0)
+	default:
+		style = p.style(d2target.BG_COLOR, c.Stroke, c.StrokeWidth, 0)
+	}
+	switch {
+	case outline.Points == nil:
+		center := transform(outline.Center)
+		p.pdf.Circle(center.X, center.Y, outline.Radius, style)
+	case outline.Open:
+		p.pdf.MoveTo(points[0].X, points[0].Y)
+		for _, pt := range points[1:] {
+			p.pdf.LineTo(pt.X, pt.Y)
+		}
+		p.pdf.DrawPath("D")
+	default:
+		p.pdf.Polygon(points, style)
+	}
+}
+
+// connectionPathData returns the same path as the SVG renderer for the connection, with
+// rounded corners on routes that aren't curves
+func connectionPathData(c d2target.Connection, srcAdj, dstAdj *geo.Point) string {
+	var path []string
+	route := c.Route
+	path = append(path, fmt.Sprintf("M %f %f", route[0].X+srcAdj.X, route[0].Y+srcAdj.Y))
+
+	if c.IsCurve {
+		i := 1
+		for ; i < len(route)-3; i += 3 {
+			path = append(path, fmt.Sprintf("C %f %f %f %f %f %f",
+				route[i].X, route[i].Y,
+				route[i+1].X, route[i+1].Y,
+				route[i+2].X, route[i+2].Y,
+			))
+		}
+		path = append(path, fmt.Sprintf("C %f %f %f %f %f %f",
+			route[i].X, route[i].Y,
+			route[i+1].X, route[i+1].Y,
+			route[i+2].X+dstAdj.X, route[i+2].Y+dstAdj.Y,
+		))
+		return strings.Join(path, " ")
+	}
+
+	for i := 1; i < len(route)-1; i++ {
+		prevSource := route[i-1]
+		prevTarget := route[i]
+		currTarget := route[i+1]
+		prevVector := prevSource.VectorTo(prevTarget)
+		currVector := prevTarget.VectorTo(currTarget)
+
+		dist := geo.EuclideanDistance(prevTarget.X, prevTarget.Y, currTarget.X, currTarget.Y)
+		units := math.Min(c.BorderRadius, dist/2)
+
+		prevTranslations := prevVector.Unit().Multiply(units).ToPoint()
+		currTranslations := currVector.Unit().Multiply(units).ToPoint()
+
+		path = append(path, fmt.Sprintf("L %f %f",
+			prevTarget.X-prevTranslations.X,
+			prevTarget.Y-prevTranslations.Y,
+		))
+
+		if units < c.BorderRadius && i < len(route)-2 {
+			nextTarget := route[i+2]
+			nextVector := geo.NewVector(nextTarget.X-currTarget.X, nextTarget.Y-currTarget.Y)
+			i++
+			nextTranslations := nextVector.Unit().Multiply(units).ToPoint()
+			path = append(path, fmt.Sprintf("C %f %f %f %f %f %f",
+				prevTarget.X+prevTranslations.X, prevTarget.Y+prevTranslations.Y,
+				currTarget.X-nextTranslations.X, currTarget.Y-nextTranslations.Y,
+				currTarget.X+nextTranslations.X, currTarget.Y+nextTranslations.Y,
+			))
+		} else {
+			path = append(path, fmt.Sprintf("S %f %f %f %f",
+				prevTarget.X, prevTarget.Y,
+				prevTarget.X+currTranslations.X, prevTarget.Y+currTranslations.Y,
+			))
+		}
+	}
+	lastPoint := route[len(route)-1]
+	path = append(path, fmt.Sprintf("L %f %f", lastPoint.X+dstAdj.X, lastPoint.Y+dstAdj.Y))
+	return strings.Join(path, " ")
+}
+
+// drawPath draws SVG path data with absolute M, L, H, V, C, S, and Z commands, which are the
+// ones shapes and connections are made of
+func (p *vectorPainter) drawPath(pathData, style string) error {
+	tokens := strings.FieldsFunc(pathData, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	var cur, lastControl geo.Point
+	var prevCmd string
+	cmd := ""
+	nums := func(n int) ([]float64, error) {
+		if len(tokens) < n {
+			return nil, fmt.Errorf("%s needs %d numbers", cmd, n)
+		}
+		out := make([]float64, n)
+		for i := 0; i < n; i++ {
+			v, err := strconv.ParseFloat(tokens[i], 64)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		tokens = tokens[n:]
+		return out, nil
+	}
+	for len(tokens) > 0 {
+		// Commands can be written right before their first number, e.g. M0,0
+		if t := tokens[0]; t[0] >= 'A' && t[0] <= 'Z' {
+			cmd = t[:1]
+			if len(t) > 1 {
+				tokens[0] = t[1:]
+			} else {
+				tokens = tokens[1:]
+			}
+		} else if cmd == "" {
+			return fmt.Errorf("path data must start with a command: %q", pathData)
+		}
+		var err error
+		var v []float64
+		switch cmd {
+		case "M":
+			v, err = nums(2)
+			if err == nil {
+				p.pdf.MoveTo(v[0], v[1])
+				cur = geo.Point{X: v[0], Y: v[1]}
+				// Coordinates after a move are lines
+				cmd = "L"
+				prevCmd = "M"
+				continue
+			}
+		case "L":
+			v, err = nums(2)
+			if err == nil {
+				p.pdf.LineTo(v[0], v[1])
+				cur = geo.Point{X: v[0], Y: v[1]}
+			}
+		case "H":
+			v, err = nums(1)
+			if err == nil {
+				p.pdf.LineTo(v[0], cur.Y)
+				cur.X = v[0]
+			}
+		case "V":
+			v, err = nums(1)
+			if err == nil {
+				p.pdf.LineTo(cur.X, v[0])
+				cur.Y = v[0]
+			}
+		case "C":
+			v, err = nums(6)
+			if err == nil {
+				p.pdf.CurveBezierCubicTo(v[0], v[1], v[2], v[3], v[4], v[5])
+				lastControl = geo.Point{X: v[2], Y: v[3]}
+				cur = geo.Point{X: v[4], Y: v[5]}
+			}
+		case "S":
+			v, err = nums(4)
+			if err == nil {
+				// The first control point is the reflection of the last one, or the current
+				// point if the previous command wasn't a curve
+				c1 := cur
+				if prevCmd == "C" || prevCmd == "S" {
+					c1 = geo.Point{X: 2*cur.X - lastControl.X, Y: 2*cur.Y - lastControl.Y}
+				}
+				p.pdf.CurveBezierCubicTo(c1.X, c1.Y, v[0], v[1], v[2], v[3])
+				lastControl = geo.Point{X: v[0], Y: v[1]}
+				cur = geo.Point{X: v[2], Y: v[3]}
+			}
+		case "Z":
+			p.pdf.ClosePath()
+		default:
+			return fmt.Errorf("unsupported path command %s", cmd)
+		}
+		if err != nil {
+			return err
+		}
+		prevCmd = cmd
+	}
+	p.pdf.DrawPath(style)
+	return nil
+}
+
+// parseColor resolves a color of the diagram, with visible false for transparent colors
+func parseColor(theme d2themes.Theme, c string) (rgb color.RGB, visible bool, err error) {
+	if c == color.Empty || c == color.None || strings.EqualFold(c, "transparent") {
+		return color.RGB{}, false, nil
+	}
+	c = d2themes.ResolveThemeColor(theme, c)
+	if strings.HasPrefix(c, "#") {
+		hex := c[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return color.RGB{}, false, fmt.Errorf("colors like %s", c)
+		}
+		rgb, err = color.Hex2RGB("#" + hex)
+		if err != nil {
+			return color.RGB{}, false, fmt.Errorf("colors like %s", c)
+		}
+		return rgb, true, nil
+	}
+	if strings.EqualFold(c, "black") {
+		return color.RGB{}, true, nil
+	}
+	rgb = color.Name2RGB(c)
+	if rgb == (color.RGB{}) {
+		return color.RGB{}, false, fmt.Errorf("colors like %s", c)
+	}
+	return rgb, true, nil
+}
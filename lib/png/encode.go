@@ -0,0 +1,82 @@
+package png
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	stdpng "image/png"
+	"strings"
+
+	_ "embed"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// DEFAULT_QUALITY is the quality used for lossy formats when none is given
+const DEFAULT_QUALITY = 90
+
+//go:embed encode_webp.js
+var encodeWebPScript string
+
+const webpPrefix = "data:image/webp;base64,"
+
+// EncodeJPEG re-encodes a PNG produced by ConvertSVG as a JPEG of the given quality (1-100).
+// JPEG has no alpha channel, so transparent pixels are flattened onto bg first.
+// Otherwise encoders treat them as black, which hides dark text on transparent diagrams.
+func EncodeJPEG(pngBytes []byte, quality int, bg color.Color) ([]byte, error) {
+	if quality < 1 || quality > 100 {
+		return nil, fmt.Errorf("JPEG quality must be between 1 and 100, got %d", quality)
+	}
+	img, err := stdpng.Decode(bytes.NewReader(pngBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode png: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = jpeg.Encode(buf, Flatten(img, bg), &jpeg.Options{
+		Quality: quality,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeWebP re-encodes a PNG produced by ConvertSVG as a lossy WebP of the given quality (1-100).
+// The standard library has no WebP encoder, so the browser's canvas encoder is used.
+// WebP keeps the alpha channel, so no flattening is done.
+func EncodeWebP(ctx context.Context, page playwright.Page, pngBytes []byte, quality int) ([]byte, error) {
+	if quality < 1 || quality > 100 {
+		return nil, fmt.Errorf("WebP quality must be between 1 and 100, got %d", quality)
+	}
+	webpInterface, err := evaluate(ctx, page, encodeWebPScript, map[string]interface{}{
+		"imgString": pngPrefix + base64.StdEncoding.EncodeToString(pngBytes),
+		"quality":   float64(quality) / 100.,
+	})
+	if err != nil {
+		return nil, evaluateError(fmt.Errorf("failed to generate webp: %w", err))
+	}
+
+	webpString, ok := webpInterface.(string)
+	if !ok || !strings.HasPrefix(webpString, webpPrefix) {
+		if len(webpString) > 50 {
+			webpString = webpString[0:50] + "..."
+		}
+		return nil, &RenderError{Err: fmt.Errorf("invalid WebP: %q", webpString)}
+	}
+	return base64.StdEncoding.DecodeString(webpString[len(webpPrefix):])
+}
+
+// Flatten composites img over an opaque bg, returning an image without any transparency
+func Flatten(img image.Image, bg color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+	return flat
+}
@@ -0,0 +1,46 @@
+package png
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	stdpng "image/png"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+)
+
+func TestEncodeJPEG(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	// left half is transparent, right half is opaque red
+	for y := 0; y < 8; y++ {
+		for x := 4; x < 8; x++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	err := stdpng.Encode(buf, img)
+	assert.Success(t, err)
+
+	out, err := EncodeJPEG(buf.Bytes(), 100, color.White)
+	assert.Success(t, err)
+
+	decoded, err := jpeg.Decode(bytes.NewReader(out))
+	assert.Success(t, err)
+	assert.Equal(t, img.Bounds(), decoded.Bounds())
+
+	r, g, b, _ := decoded.At(1, 1).RGBA()
+	if r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Fatalf("expected transparent pixel to be flattened to white, got (%d, %d, %d)", r>>8, g>>8, b>>8)
+	}
+	r, g, b, _ = decoded.At(6, 6).RGBA()
+	if r>>8 < 200 || g>>8 > 50 || b>>8 > 50 {
+		t.Fatalf("expected opaque pixel to stay red, got (%d, %d, %d)", r>>8, g>>8, b>>8)
+	}
+
+	_, err = EncodeJPEG(buf.Bytes(), 0, color.White)
+	assert.Error(t, err)
+}
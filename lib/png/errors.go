@@ -0,0 +1,82 @@
+package png
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// NavigationError is returned when the browser fails to load an SVG, e.g. because an image
+// it references never finishes loading. The page may still be busy afterwards.
+type NavigationError struct {
+	Err error
+}
+
+func (e *NavigationError) Error() string {
+	return fmt.Sprintf("failed to load svg: %v", e.Err)
+}
+
+func (e *NavigationError) Unwrap() error {
+	return e.Err
+}
+
+// RenderError is returned when an SVG loaded but could not be turned into an image.
+type RenderError struct {
+	Err error
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("failed to render svg: %v", e.Err)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// IsNavigationError reports whether err is or wraps a NavigationError
+func IsNavigationError(err error) bool {
+	var nerr *NavigationError
+	return errors.As(err, &nerr)
+}
+
+// evaluate runs script in page, giving up once ctx is done.
+// Playwright evaluations can't be cancelled, so a page that was given up on is closed, which
+// ends the evaluation, and must not be reused. See Playwright.Retry.
+func evaluate(ctx context.Context, page playwright.Page, script string, arg interface{}) (interface{}, error) {
+	type result struct {
+		v   interface{}
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		v, err := page.Evaluate(script, arg)
+		ch <- result{v, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-ctx.Done():
+		_ = page.Close()
+		<-ch
+		return nil, ctx.Err()
+	}
+}
+
+// evaluateError wraps an error from evaluate. Running out of time is a NavigationError so that
+// Retry tries again, but any other failure of the script is a RenderError, since it would only
+// fail the same way again.
+func evaluateError(err error) error {
+	if isTimeout(err) {
+		return &NavigationError{Err: err}
+	}
+	return &RenderError{Err: err}
+}
+
+// isTimeout reports whether err is from running out of time, either as a Playwright timeout or
+// from ctx being done
+func isTimeout(err error) bool {
+	var terr *playwright.TimeoutError
+	return errors.As(err, &terr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
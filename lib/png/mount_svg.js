@@ -0,0 +1,10 @@
+({ scale }) => {
+  const svg = document.querySelector("svg");
+  if (!svg) {
+    throw new Error("no svg mounted");
+  }
+  // Render at the same resolution as ConvertSVG
+  const rect = svg.getBoundingClientRect();
+  svg.setAttribute("width", rect.width * scale);
+  svg.setAttribute("height", rect.height * scale);
+}
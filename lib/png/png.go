@@ -2,9 +2,11 @@ package png
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"strings"
+	"time"
 
 	_ "embed"
 
@@ -19,6 +21,9 @@ import (
 // ConvertSVG scales the image by 2x
 const SCALE = 2.
 
+// MAX_ATTEMPTS is how many times Retry tries an SVG that fails to load
+const MAX_ATTEMPTS = 2
+
 type Playwright struct {
 	PW      *playwright.Playwright
 	Browser playwright.Browser
@@ -32,6 +37,38 @@ func (pw *Playwright) RestartBrowser() (Playwright, error) {
 	return startPlaywright(pw.PW)
 }
 
+// Retry calls f with the current page, giving each attempt up to timeout (0 for no limit).
+// If an attempt fails with a NavigationError, such as a remote image that never loads,
+// the browser is restarted, since the old page may be stuck or closed, and f is tried again.
+// The browser is restarted after the last attempt too, so that pw stays usable.
+func (pw *Playwright) Retry(ctx context.Context, timeout time.Duration, f func(ctx context.Context, page playwright.Page) error) error {
+	var err error
+	for attempt := 1; attempt <= MAX_ATTEMPTS; attempt++ {
+		err = pw.attempt(ctx, timeout, f)
+		if err == nil || !IsNavigationError(err) {
+			return err
+		}
+		newPW, restartErr := pw.RestartBrowser()
+		if restartErr != nil {
+			return fmt.Errorf("%w (and failed to restart browser: %v)", err, restartErr)
+		}
+		*pw = newPW
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", MAX_ATTEMPTS, err)
+}
+
+func (pw *Playwright) attempt(ctx context.Context, timeout time.Duration, f func(ctx context.Context, page playwright.Page) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx, pw.Page)
+}
+
 func (pw *Playwright) Cleanup() error {
 	if err := pw.Browser.Close(); err != nil {
 		return fmt.Errorf("failed to close Playwright browser: %w", err)
@@ -85,25 +122,30 @@ const pngPrefix = "data:image/png;base64,"
 
 // ConvertSVG converts the given SVG into a PNG.
 // Note that the resulting PNG has 2x the size (width and height) of the original SVG (see generate_png.js)
-func ConvertSVG(page playwright.Page, svg []byte) ([]byte, error) {
+// If ctx is done before the PNG is generated, a NavigationError is returned.
+func ConvertSVG(ctx context.Context, page playwright.Page, svg []byte) ([]byte, error) {
 	encodedSVG := base64.StdEncoding.EncodeToString(svg)
-	pngInterface, err := page.Evaluate(genPNGScript, map[string]interface{}{
+	pngInterface, err := evaluate(ctx, page, genPNGScript, map[string]interface{}{
 		"imgString": "data:image/svg+xml;charset=utf-8;base64," + encodedSVG,
 		"scale":     int(SCALE),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate png: %w", err)
+		return nil, evaluateError(err)
 	}
 
-	pngString := pngInterface.(string)
-	if !strings.HasPrefix(pngString, pngPrefix) {
+	pngString, ok := pngInterface.(string)
+	if !ok || !strings.HasPrefix(pngString, pngPrefix) {
 		if len(pngString) > 50 {
 			pngString = pngString[0:50] + "..."
 		}
-		return nil, fmt.Errorf("invalid PNG: %q", pngString)
+		return nil, &RenderError{Err: fmt.Errorf("invalid PNG: %q", pngString)}
 	}
 	splicedPNGString := pngString[len(pngPrefix):]
-	return base64.StdEncoding.DecodeString(splicedPNGString)
+	b, err := base64.StdEncoding.DecodeString(splicedPNGString)
+	if err != nil {
+		return nil, &RenderError{Err: err}
+	}
+	return b, nil
 }
 
 func AddExif(png []byte) ([]byte, error) {
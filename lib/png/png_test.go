@@ -0,0 +1,104 @@
+package png
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/playwright-community/playwright-go"
+
+	"oss.terrastruct.com/util-go/assert"
+)
+
+// fakePage is a playwright.Page whose Evaluate returns err, or blocks until the page is closed
+// if err is nil. SetContent returns setContentErr.
+type fakePage struct {
+	playwright.Page
+	err           error
+	setContentErr error
+	closed        chan struct{}
+	evaluated     chan struct{}
+}
+
+func newFakePage(err error) *fakePage {
+	return &fakePage{
+		err:       err,
+		closed:    make(chan struct{}),
+		evaluated: make(chan struct{}),
+	}
+}
+
+func (p *fakePage) Evaluate(expression string, arg ...interface{}) (interface{}, error) {
+	defer close(p.evaluated)
+	if p.err != nil {
+		return nil, p.err
+	}
+	<-p.closed
+	return nil, errors.New("target closed")
+}
+
+func (p *fakePage) SetContent(html string, options ...playwright.PageSetContentOptions) error {
+	return p.setContentErr
+}
+
+func (p *fakePage) Close(options ...playwright.PageCloseOptions) error {
+	close(p.closed)
+	return nil
+}
+
+func TestConvertSVGErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("script", func(t *testing.T) {
+		t.Parallel()
+
+		page := newFakePage(errors.New("error loading string as an image"))
+		_, err := ConvertSVG(context.Background(), page, []byte("<svg/>"))
+		assert.Error(t, err)
+		assert.False(t, IsNavigationError(err))
+		var rerr *RenderError
+		assert.True(t, errors.As(err, &rerr))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+
+		page := newFakePage(nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := ConvertSVG(ctx, page, []byte("<svg/>"))
+		assert.True(t, IsNavigationError(err))
+		assert.True(t, errors.Is(err, context.Canceled))
+
+		// The abandoned evaluation must have finished
+		select {
+		case <-page.evaluated:
+		default:
+			t.Fatal("evaluation still running after ConvertSVG returned")
+		}
+	})
+}
+
+func TestMountSVGErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+
+		page := newFakePage(nil)
+		page.setContentErr = &playwright.TimeoutError{Message: "Timeout 30000ms exceeded."}
+		err := MountSVG(context.Background(), page, []byte("<svg/>"))
+		assert.True(t, IsNavigationError(err))
+	})
+
+	t.Run("other", func(t *testing.T) {
+		t.Parallel()
+
+		setContentErr := errors.New("target page, context or browser has been closed")
+		page := newFakePage(nil)
+		page.setContentErr = setContentErr
+		err := MountSVG(context.Background(), page, []byte("<svg/>"))
+		assert.False(t, IsNavigationError(err))
+		assert.True(t, err == setContentErr)
+	})
+}
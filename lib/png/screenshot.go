@@ -0,0 +1,106 @@
+package png
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "embed"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+//go:embed mount_svg.js
+var mountSVGScript string
+
+// ScreenshotObject renders svg into the page and returns a PNG of only the bounding box of
+// the element with the given ID, at the same 2x scale as ConvertSVG.
+// IDs are the absolute IDs of shapes and connections, e.g. "container.a".
+func ScreenshotObject(ctx context.Context, page playwright.Page, svg []byte, id string) ([]byte, error) {
+	err := MountSVG(ctx, page, svg)
+	if err != nil {
+		return nil, err
+	}
+
+	locator, err := page.Locator(fmt.Sprintf("[id=%s]", strconv.Quote(id)))
+	if err != nil {
+		return nil, &RenderError{Err: fmt.Errorf("failed to locate %q: %w", id, err)}
+	}
+	locator, err = locator.First()
+	if err != nil {
+		return nil, &RenderError{Err: fmt.Errorf("failed to locate %q: %w", id, err)}
+	}
+	count, err := locator.Count()
+	if err != nil {
+		return nil, &RenderError{Err: fmt.Errorf("failed to locate %q: %w", id, err)}
+	}
+	if count == 0 {
+		return nil, &RenderError{Err: fmt.Errorf("%q not found in rendered diagram", id)}
+	}
+	box, err := locator.BoundingBox()
+	if err != nil {
+		return nil, &RenderError{Err: fmt.Errorf("failed to get bounding box of %q: %w", id, err)}
+	}
+	if box == nil || box.Width == 0 || box.Height == 0 {
+		return nil, &RenderError{Err: fmt.Errorf("%q is not visible in rendered diagram", id)}
+	}
+
+	b, err := page.Screenshot(playwright.PageScreenshotOptions{
+		FullPage:       playwright.Bool(true),
+		OmitBackground: playwright.Bool(true),
+		Type:           playwright.ScreenshotTypePng,
+		Timeout:        timeoutMS(ctx),
+		Clip: &playwright.PageScreenshotOptionsClip{
+			X:      playwright.Float(float64(box.X)),
+			Y:      playwright.Float(float64(box.Y)),
+			Width:  playwright.Float(float64(box.Width)),
+			Height: playwright.Float(float64(box.Height)),
+		},
+	})
+	if err != nil {
+		return nil, &RenderError{Err: fmt.Errorf("failed to screenshot %q: %w", id, err)}
+	}
+	return b, nil
+}
+
+// MountSVG replaces the page's content with svg, scaled up by SCALE.
+// It waits for the network to be idle so that remote images are loaded,
+// returning a NavigationError if that doesn't happen in time.
+func MountSVG(ctx context.Context, page playwright.Page, svg []byte) error {
+	// The XML declaration is not valid inside HTML
+	s := strings.TrimPrefix(string(svg), `<?xml version="1.0" encoding="utf-8"?>`)
+	err := page.SetContent(`<!DOCTYPE html><html><body style="margin:0">`+s+`</body></html>`, playwright.PageSetContentOptions{
+		WaitUntil: playwright.WaitUntilStateNetworkidle,
+		Timeout:   timeoutMS(ctx),
+	})
+	if err != nil {
+		if isTimeout(err) {
+			return &NavigationError{Err: err}
+		}
+		return err
+	}
+	_, err = evaluate(ctx, page, mountSVGScript, map[string]interface{}{
+		"scale": SCALE,
+	})
+	if err != nil {
+		return evaluateError(fmt.Errorf("failed to scale svg: %w", err))
+	}
+	return nil
+}
+
+// timeoutMS converts the deadline of ctx into a Playwright timeout.
+// nil leaves Playwright's default.
+func timeoutMS(ctx context.Context) *float64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	ms := float64(time.Until(deadline).Milliseconds())
+	if ms < 1 {
+		// 0 would mean no timeout
+		ms = 1
+	}
+	return &ms
+}
@@ -0,0 +1,212 @@
+package remoteimport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"oss.terrastruct.com/d2/lib/cachefile"
+)
+
+// maxFileSize is the largest file fetched for an import
+const maxFileSize = 16 << 20
+
+// DefaultCacheDir returns the directory the CLI caches fetched imports in
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "d2", "imports"), nil
+}
+
+// Fetcher fetches the files of remote imports. Files are kept in CacheDir by the SHA-256 of
+// their contents, so files Lockfile pins are only fetched once.
+type Fetcher struct {
+	// CacheDir, if given, is the directory fetched files are cached in
+	CacheDir string
+	Lockfile *Lockfile
+	// Frozen makes imports that Lockfile doesn't pin fail instead of being fetched and added to
+	// it, e.g. for CI
+	Frozen bool
+	// HTTPClient fetches HTTPS imports. It defaults to a client that times out after a minute.
+	HTTPClient *http.Client
+	// GitProtocols are the protocols the repositories of Git imports can be fetched over. They
+	// default to https and ssh, so that imports can't run commands through Git's other
+	// transports.
+	GitProtocols []string
+
+	mu      sync.Mutex
+	changed bool
+}
+
+func (f *Fetcher) gitProtocols() []string {
+	if len(f.GitProtocols) > 0 {
+		return f.GitProtocols
+	}
+	return []string{"https", "ssh"}
+}
+
+// Changed returns whether imports were added to Lockfile, which should then be written
+func (f *Fetcher) Changed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.changed
+}
+
+// Fetch returns the contents of the file at s, the URL of a remote import. Its contents must
+// match the SHA-256 Lockfile or s pins it to.
+func (f *Fetcher) Fetch(s string) ([]byte, error) {
+	u, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	locked, isLocked := f.Lockfile.Imports[s]
+	want := strings.TrimPrefix(u.Version, "sha256:")
+	if u.Git {
+		want = ""
+	}
+	if isLocked && want == "" {
+		want = locked.SHA256
+	}
+	if want != "" {
+		if b, ok := f.cached(want); ok {
+			return b, nil
+		}
+	}
+	if f.Frozen && !isLocked {
+		return nil, fmt.Errorf("%s isn't pinned in %s, which isn't updated when frozen", s, LockfileName)
+	}
+
+	var b []byte
+	var commit string
+	if u.Git {
+		ref := u.Version
+		if isLocked && locked.Commit != "" {
+			ref = locked.Commit
+		}
+		protocols := f.gitProtocols()
+		scheme, _, _ := strings.Cut(u.Repo, "://")
+		if !slices.Contains(protocols, scheme) {
+			return nil, fmt.Errorf("%s can only be fetched over %s", s, strings.Join(protocols, " or "))
+		}
+		b, commit, err = fetchGit(protocols, u.Repo, ref, u.Path)
+	} else {
+		b, err = f.fetchHTTPS(u.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", s, err)
+	}
+
+	hash := cachefile.Hash(b)
+	if want != "" && hash != want {
+		if isLocked {
+			return nil, fmt.Errorf("%s changed since it was pinned in %s: its SHA-256 is %s instead of %s. Remove it from %[2]s to update it", s, LockfileName, hash, want)
+		}
+		return nil, fmt.Errorf("%s doesn't match the SHA-256 it's pinned to: its SHA-256 is %s", s, hash)
+	}
+	if f.CacheDir != "" {
+		// Files can always be fetched again, so failing to cache them doesn't fail the import
+		_ = cachefile.Write(filepath.Join(f.CacheDir, hash), b)
+	}
+	if !isLocked {
+		f.Lockfile.Imports[s] = LockedImport{
+			Commit: commit,
+			SHA256: hash,
+		}
+		f.changed = true
+	}
+	return b, nil
+}
+
+// cached returns the cached file whose SHA-256 is hash
+func (f *Fetcher) cached(hash string) ([]byte, bool) {
+	if f.CacheDir == "" {
+		return nil, false
+	}
+	b, err := os.ReadFile(filepath.Join(f.CacheDir, hash))
+	if err != nil || cachefile.Hash(b) != hash {
+		return nil, false
+	}
+	return b, true
+}
+
+func (f *Fetcher) fetchHTTPS(u string) ([]byte, error) {
+	client := f.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxFileSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxFileSize)
+	}
+	return b, nil
+}
+
+// fetchGit returns the file at p in repo at ref, a tag, branch or commit, and the commit ref
+// resolved to. Only that commit is fetched, and only over protocols.
+func fetchGit(protocols []string, repo, ref, p string) (_ []byte, commit string, _ error) {
+	// ref may come from d2.lock instead of the parsed URL
+	if strings.HasPrefix(repo, "-") || strings.HasPrefix(ref, "-") {
+		return nil, "", fmt.Errorf("invalid repository %q or version %q", repo, ref)
+	}
+	dir, err := os.MkdirTemp("", "d2-import-*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_ALLOW_PROTOCOL="+strings.Join(protocols, ":"))
+		out, err := cmd.Output()
+		if err != nil {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				return nil, fmt.Errorf("git %s: %s", args[0], bytes.TrimSpace(ee.Stderr))
+			}
+			return nil, err
+		}
+		return out, nil
+	}
+	if _, err := git("init", "-q"); err != nil {
+		return nil, "", err
+	}
+	if _, err := git("fetch", "-q", "--depth=1", "--", repo, ref); err != nil {
+		return nil, "", err
+	}
+	out, err := git("rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return nil, "", err
+	}
+	commit = string(bytes.TrimSpace(out))
+	b, err := git("show", commit+":"+p)
+	if err != nil {
+		return nil, "", err
+	}
+	return b, commit, nil
+}
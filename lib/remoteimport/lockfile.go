@@ -0,0 +1,58 @@
+package remoteimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// LockfileName is the name of the lockfile next to the diagrams whose remote imports it pins
+const LockfileName = "d2.lock"
+
+// Lockfile pins remote imports to the contents they were first fetched with, so they don't
+// change under diagrams when the files at their URLs or the tags of their repositories do.
+// Remove an import from it to fetch it again.
+type Lockfile struct {
+	// Imports are the pinned imports, by URL
+	Imports map[string]LockedImport `json:"imports"`
+}
+
+type LockedImport struct {
+	// Commit is what the tag or branch of a Git import resolved to
+	Commit string `json:"commit,omitempty"`
+	// SHA256 is the hash of the contents of the file
+	SHA256 string `json:"sha256"`
+}
+
+// ReadLockfile reads the lockfile at path, which is empty if there's none
+func ReadLockfile(path string) (*Lockfile, error) {
+	l := &Lockfile{
+		Imports: make(map[string]LockedImport),
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if l.Imports == nil {
+		l.Imports = make(map[string]LockedImport)
+	}
+	return l, nil
+}
+
+// Write writes l to path. Imports are sorted by URL so that the lockfile diffs well.
+func (l *Lockfile) Write(path string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
@@ -0,0 +1,244 @@
+package remoteimport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oss.terrastruct.com/util-go/assert"
+
+	"oss.terrastruct.com/d2/lib/cachefile"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	hash := strings.Repeat("ab", 32)
+	testCases := []struct {
+		name   string
+		url    string
+		exp    URL
+		expErr string
+	}{
+		{
+			name: "https",
+			url:  "https://example.com/lib/components.d2",
+			exp:  URL{Path: "https://example.com/lib/components.d2"},
+		},
+		{
+			name: "https_pinned",
+			url:  "https://example.com/lib/components.d2@sha256:" + hash,
+			exp:  URL{Path: "https://example.com/lib/components.d2", Version: "sha256:" + hash},
+		},
+		{
+			name: "git",
+			url:  "git+https://github.com/org/components//lib/components.d2@v1.2.0",
+			exp:  URL{Git: true, Repo: "https://github.com/org/components", Path: "lib/components.d2", Version: "v1.2.0"},
+		},
+		{
+			name:   "https_tag",
+			url:    "https://example.com/components.d2@v1.2.0",
+			expErr: `HTTPS imports can only be pinned to the SHA-256 of their contents, like @sha256:<64 hex digits>: "https://example.com/components.d2@v1.2.0"`,
+		},
+		{
+			name:   "git_unpinned",
+			url:    "git+https://github.com/org/components//components.d2",
+			expErr: `git imports must be pinned to a tag, branch or commit, like @v1.0.0: "git+https://github.com/org/components//components.d2"`,
+		},
+		{
+			name:   "git_no_path",
+			url:    "git+https://github.com/org/components.d2@v1.2.0",
+			expErr: `git imports must separate the repository from the path of the file with //, like git+https://github.com/org/repo//lib.d2@v1.0.0: "git+https://github.com/org/components.d2@v1.2.0"`,
+		},
+		{
+			name:   "git_option_repo",
+			url:    "git+--upload-pack=touch /tmp/pwned;://h//a.d2@.",
+			expErr: `invalid repository "--upload-pack=touch /tmp/pwned;://h" or version ".": "git+--upload-pack=touch /tmp/pwned;://h//a.d2@."`,
+		},
+		{
+			name:   "git_option_version",
+			url:    "git+https://github.com/org/components//components.d2@--upload-pack=touch",
+			expErr: `invalid repository "https://github.com/org/components" or version "--upload-pack=touch": "git+https://github.com/org/components//components.d2@--upload-pack=touch"`,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			u, err := Parse(tc.url)
+			if tc.expErr != "" {
+				assert.ErrorString(t, err, tc.expErr)
+				return
+			}
+			assert.Success(t, err)
+			assert.Equal(t, tc.exp, *u)
+			assert.Equal(t, tc.url, u.String())
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	u, err := Parse("https://example.com/lib/components.d2@sha256:" + strings.Repeat("ab", 32))
+	assert.Success(t, err)
+	r, err := u.Resolve("../shared/db.d2")
+	assert.Success(t, err)
+	assert.Equal(t, "https://example.com/shared/db.d2", r.String())
+
+	u, err = Parse("git+https://github.com/org/components//lib/components.d2@v1.2.0")
+	assert.Success(t, err)
+	r, err = u.Resolve("db.d2")
+	assert.Success(t, err)
+	assert.Equal(t, "git+https://github.com/org/components//lib/db.d2@v1.2.0", r.String())
+	_, err = u.Resolve("../../db.d2")
+	assert.ErrorString(t, err, `"../../db.d2" is outside of the repository of git+https://github.com/org/components//lib/components.d2@v1.2.0`)
+}
+
+func TestFetchHTTPS(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"/a.d2": "a",
+	}
+	var requests int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		s, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(s))
+	}))
+	t.Cleanup(srv.Close)
+
+	f := &Fetcher{
+		CacheDir:   t.TempDir(),
+		Lockfile:   &Lockfile{Imports: make(map[string]LockedImport)},
+		HTTPClient: srv.Client(),
+	}
+	url := srv.URL + "/a.d2"
+	b, err := f.Fetch(url)
+	assert.Success(t, err)
+	assert.Equal(t, "a", string(b))
+	assert.Equal(t, true, f.Changed())
+	assert.Equal(t, cachefile.Hash([]byte("a")), f.Lockfile.Imports[url].SHA256)
+
+	// Pinned files are read from the cache
+	files["/a.d2"] = "b"
+	b, err = f.Fetch(url)
+	assert.Success(t, err)
+	assert.Equal(t, "a", string(b))
+	assert.Equal(t, 1, requests)
+
+	// and must not change when they aren't cached
+	f.CacheDir = t.TempDir()
+	_, err = f.Fetch(url)
+	assert.ErrorString(t, err, url+" changed since it was pinned in d2.lock: its SHA-256 is "+cachefile.Hash([]byte("b"))+" instead of "+cachefile.Hash([]byte("a"))+". Remove it from d2.lock to update it")
+
+	_, err = f.Fetch(srv.URL + "/b.d2@sha256:" + cachefile.Hash([]byte("b")))
+	assert.ErrorString(t, err, "failed to fetch "+srv.URL+"/b.d2@sha256:"+cachefile.Hash([]byte("b"))+": unexpected status 404 Not Found")
+
+	f.Frozen = true
+	_, err = f.Fetch(srv.URL + "/c.d2")
+	assert.ErrorString(t, err, srv.URL+"/c.d2 isn't pinned in d2.lock, which isn't updated when frozen")
+}
+
+func TestFetchGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=d2", "-c", "user.email=d2@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+	git("init", "-q")
+	assert.Success(t, os.MkdirAll(filepath.Join(repo, "lib"), 0755))
+	assert.WriteFile(t, filepath.Join(repo, "lib", "a.d2"), []byte("v1"), 0644)
+	git("add", "-A")
+	git("commit", "-q", "-m", "v1")
+	git("tag", "v1")
+
+	url := "git+file://" + filepath.ToSlash(repo) + "//lib/a.d2@v1"
+	f := &Fetcher{
+		Lockfile: &Lockfile{Imports: make(map[string]LockedImport)},
+	}
+	_, err := f.Fetch(url)
+	assert.ErrorString(t, err, url+" can only be fetched over https or ssh")
+
+	f.GitProtocols = []string{"file"}
+	b, err := f.Fetch(url)
+	assert.Success(t, err)
+	assert.Equal(t, "v1", string(b))
+	commit := f.Lockfile.Imports[url].Commit
+	assert.Equal(t, 40, len(commit))
+
+	// The commit the tag was pinned to is fetched after the tag moves
+	assert.WriteFile(t, filepath.Join(repo, "lib", "a.d2"), []byte("v2"), 0644)
+	git("commit", "-q", "-am", "v2")
+	git("tag", "-f", "v1")
+	b, err = f.Fetch(url)
+	assert.Success(t, err)
+	assert.Equal(t, "v1", string(b))
+	assert.Equal(t, commit, f.Lockfile.Imports[url].Commit)
+}
+
+func TestFetchGitOptions(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	pwned := filepath.Join(t.TempDir(), "pwned")
+	f := &Fetcher{
+		Lockfile: &Lockfile{Imports: make(map[string]LockedImport)},
+	}
+	_, err := f.Fetch("git+--upload-pack=touch " + pwned + ";://h//a.d2@.")
+	assert.Error(t, err)
+	_, _, err = fetchGit([]string{"https"}, "https://example.com/repo", "--upload-pack=touch "+pwned, "a.d2")
+	assert.Error(t, err)
+	_, err = os.Stat(pwned)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLockfile(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), LockfileName)
+	l, err := ReadLockfile(p)
+	assert.Success(t, err)
+	assert.Equal(t, 0, len(l.Imports))
+
+	l.Imports["https://example.com/b.d2"] = LockedImport{SHA256: "b"}
+	l.Imports["git+https://example.com/repo//a.d2@v1"] = LockedImport{Commit: "c", SHA256: "a"}
+	assert.Success(t, l.Write(p))
+	assert.Equal(t, `{
+  "imports": {
+    "git+https://example.com/repo//a.d2@v1": {
+      "commit": "c",
+      "sha256": "a"
+    },
+    "https://example.com/b.d2": {
+      "sha256": "b"
+    }
+  }
+}
+`, string(assert.ReadFile(t, p)))
+
+	l2, err := ReadLockfile(p)
+	assert.Success(t, err)
+	assert.JSON(t, l.Imports, l2.Imports)
+}
@@ -0,0 +1,141 @@
+// Package remoteimport fetches the files of remote imports, which are written with the URL of
+// a file instead of a path, like ...@"https://example.com/lib/components.d2", so that
+// libraries of shared components can be versioned in their own repositories.
+//
+// Fetched files are cached by their contents and pinned by the SHA-256 of their contents in a
+// d2.lock next to the diagram, so renders are reproducible and work offline once every import
+// was fetched.
+package remoteimport
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const gitPrefix = "git+"
+
+// URL is the URL of a remote import: either a file fetched over HTTPS, optionally pinned by the
+// SHA-256 of its contents,
+//
+//	https://example.com/lib/components.d2@sha256:<hex>
+//
+// or a file in a Git repository at a tag, branch or commit, with // between the URL of the
+// repository and the path of the file in it,
+//
+//	git+https://github.com/org/components//lib/components.d2@v1.2.0
+type URL struct {
+	// Git is whether the file is in a Git repository
+	Git bool
+	// Repo is the URL of the Git repository of Git imports
+	Repo string
+	// Path is the URL of HTTPS imports, or the path of the file in Repo of Git imports
+	Path string
+	// Version is the tag, branch or commit of Git imports, or sha256:<hex> for pinned HTTPS
+	// imports
+	Version string
+}
+
+// IsRemote returns whether p, the path of an import, is the URL of a remote import
+func IsRemote(p string) bool {
+	return strings.HasPrefix(p, "https://") || strings.HasPrefix(p, gitPrefix)
+}
+
+// Parse parses the URL of a remote import
+func Parse(s string) (*URL, error) {
+	if strings.HasPrefix(s, gitPrefix) {
+		return parseGit(s)
+	}
+	if !strings.HasPrefix(s, "https://") {
+		return nil, fmt.Errorf("remote imports must start with https:// or git+: %q", s)
+	}
+
+	u := &URL{Path: s}
+	if i := strings.LastIndexByte(s, '@'); i > strings.LastIndexByte(s, '/') {
+		u.Path, u.Version = s[:i], s[i+1:]
+		hash, ok := strings.CutPrefix(u.Version, "sha256:")
+		if !ok || len(hash) != 64 {
+			return nil, fmt.Errorf("HTTPS imports can only be pinned to the SHA-256 of their contents, like @sha256:<64 hex digits>: %q", s)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("invalid SHA-256 %q: %q", hash, s)
+		}
+	}
+	if _, err := url.Parse(u.Path); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func parseGit(s string) (*URL, error) {
+	repo := strings.TrimPrefix(s, gitPrefix)
+	scheme := strings.Index(repo, "://")
+	if scheme < 0 {
+		return nil, fmt.Errorf("git imports must be the URL of a repository, like git+https://github.com/org/repo//lib.d2@v1.0.0: %q", s)
+	}
+	i := strings.Index(repo[scheme+3:], "//")
+	if i < 0 {
+		return nil, fmt.Errorf("git imports must separate the repository from the path of the file with //, like git+https://github.com/org/repo//lib.d2@v1.0.0: %q", s)
+	}
+	i += scheme + 3
+
+	u := &URL{
+		Git:  true,
+		Repo: repo[:i],
+		Path: repo[i+2:],
+	}
+	j := strings.LastIndexByte(u.Path, '@')
+	if j < 0 || j < strings.LastIndexByte(u.Path, '/') || j == len(u.Path)-1 {
+		return nil, fmt.Errorf("git imports must be pinned to a tag, branch or commit, like @v1.0.0: %q", s)
+	}
+	u.Path, u.Version = u.Path[:j], u.Path[j+1:]
+	// They would be taken as options by git fetch
+	if strings.HasPrefix(u.Repo, "-") || strings.HasPrefix(u.Version, "-") {
+		return nil, fmt.Errorf("invalid repository %q or version %q: %q", u.Repo, u.Version, s)
+	}
+	if u.Path == "" || path.Clean(u.Path) != u.Path || strings.HasPrefix(u.Path, "../") || path.IsAbs(u.Path) {
+		return nil, fmt.Errorf("invalid path %q in repository: %q", u.Path, s)
+	}
+	return u, nil
+}
+
+func (u *URL) String() string {
+	s := u.Path
+	if u.Git {
+		s = gitPrefix + u.Repo + "//" + u.Path
+	}
+	if u.Version != "" {
+		s += "@" + u.Version
+	}
+	return s
+}
+
+// Resolve returns the URL of rel, the relative path of an import in the file at u. Files in a
+// Git repository import others from the same version of it, while files fetched over HTTPS are
+// pinned by d2.lock, not by the file importing them.
+func (u *URL) Resolve(rel string) (*URL, error) {
+	if u.Git {
+		p := path.Join(path.Dir(u.Path), rel)
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("%q is outside of the repository of %s", rel, u)
+		}
+		return &URL{
+			Git:     true,
+			Repo:    u.Repo,
+			Path:    p,
+			Version: u.Version,
+		}, nil
+	}
+
+	base, err := url.Parse(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(rel)
+	if err != nil {
+		return nil, err
+	}
+	return &URL{Path: base.ResolveReference(ref).String()}, nil
+}
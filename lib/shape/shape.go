@@ -26,6 +26,12 @@ const (
 	CIRCLE_TYPE        = "Circle"
 	HEXAGON_TYPE       = "Hexagon"
 	CLOUD_TYPE         = "Cloud"
+	TRIANGLE_TYPE      = "Triangle"
+	TRAPEZOID_TYPE     = "Trapezoid"
+	CROSS_TYPE         = "Cross"
+	ACTOR_TYPE         = "Actor"
+	NOTE_TYPE          = "Note"
+	CUSTOM_TYPE        = "Custom"
 
 	TABLE_TYPE = "Table"
 	CLASS_TYPE = "Class"
@@ -48,6 +54,8 @@ type Shape interface {
 	// cloud shape has different innerBoxes depending on content's aspect ratio
 	GetInnerBoxForContent(width, height float64) *geo.Box
 	SetInnerBoxAspectRatio(aspectRatio float64)
+	// custom shapes are drawn from the SVG of their definition
+	SetCustomDefinition(def *CustomDefinition)
 
 	// placing a rectangle of the given size and padding inside the shape, return the position relative to the shape's TopLeft
 	GetInsidePlacement(width, height, paddingX, paddingY float64) geo.Point
@@ -100,6 +108,10 @@ func (s baseShape) SetInnerBoxAspectRatio(aspectRatio float64) {
 	// only used for cloud
 }
 
+func (s baseShape) SetCustomDefinition(def *CustomDefinition) {
+	// only used for custom shapes
+}
+
 func (s baseShape) GetInsidePlacement(_, _, paddingX, paddingY float64) geo.Point {
 	innerTL := (*s.FullShape).GetInnerBox().TopLeft
 	return *geo.NewPoint(innerTL.X+paddingX/2, innerTL.Y+paddingY/2)
@@ -125,6 +137,8 @@ func (s baseShape) GetSVGPathData() []string {
 
 func NewShape(shapeType string, box *geo.Box) Shape {
 	switch shapeType {
+	case ACTOR_TYPE:
+		return NewActor(box)
 	case CALLOUT_TYPE:
 		return NewCallout(box)
 	case CIRCLE_TYPE:
@@ -135,6 +149,10 @@ func NewShape(shapeType string, box *geo.Box) Shape {
 		return NewCloud(box)
 	case CODE_TYPE:
 		return NewCode(box)
+	case CROSS_TYPE:
+		return NewCross(box)
+	case CUSTOM_TYPE:
+		return NewCustom(box)
 	case CYLINDER_TYPE:
 		return NewCylinder(box)
 	case DIAMOND_TYPE:
@@ -145,6 +163,8 @@ func NewShape(shapeType string, box *geo.Box) Shape {
 		return NewHexagon(box)
 	case IMAGE_TYPE:
 		return NewImage(box)
+	case NOTE_TYPE:
+		return NewNote(box)
 	case OVAL_TYPE:
 		return NewOval(box)
 	case PACKAGE_TYPE:
@@ -169,6 +189,10 @@ func NewShape(shapeType string, box *geo.Box) Shape {
 		return NewTable(box)
 	case TEXT_TYPE:
 		return NewText(box)
+	case TRAPEZOID_TYPE:
+		return NewTrapezoid(box)
+	case TRIANGLE_TYPE:
+		return NewTriangle(box)
 
 	default:
 		shape := shapeSquare{
@@ -0,0 +1,84 @@
+package shape
+
+import (
+	"math"
+
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/svg"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+// shapeActor is a stick figure, as for UML actors. Its label goes below it, like the person's.
+type shapeActor struct {
+	*baseShape
+}
+
+const (
+	// ACTOR_AR is how many times taller than wide the figure is drawn
+	ACTOR_AR = 2.
+
+	// The figure is drawn in a 40x80 box
+	actorHeadRadius = 10.
+	actorNeckY      = 20.
+	actorArmsY      = 32.
+	actorHipY       = 52.
+	// circleControl is how far the control points of a bezier quarter circle are from its ends,
+	// as a part of the radius
+	circleControl = 0.5523
+)
+
+func NewActor(box *geo.Box) Shape {
+	shape := shapeActor{
+		baseShape: &baseShape{
+			Type: ACTOR_TYPE,
+			Box:  box,
+		},
+	}
+	shape.FullShape = go2.Pointer(Shape(shape))
+	return shape
+}
+
+// actorPath draws the head as a circle and the body, arms and legs as single segments, so only
+// the head is filled
+func actorPath(box *geo.Box) *svg.SvgPathContext {
+	pc := svg.NewSVGPathContext(box.TopLeft, box.Width/40, box.Height/80)
+	r := actorHeadRadius
+	k := r * circleControl
+	pc.StartAt(pc.Absolute(20, 0))
+	pc.C(false, 20+k, 0, 20+r, r-k, 20+r, r)
+	pc.C(false, 20+r, r+k, 20+k, 2*r, 20, 2*r)
+	pc.C(false, 20-k, 2*r, 20-r, r+k, 20-r, r)
+	pc.C(false, 20-r, r-k, 20-k, 0, 20, 0)
+	pc.Z()
+
+	pc.StartAt(pc.Absolute(20, actorNeckY))
+	pc.V(false, actorHipY)
+	pc.StartAt(pc.Absolute(2, actorArmsY))
+	pc.H(false, 38)
+	pc.StartAt(pc.Absolute(20, actorHipY))
+	pc.L(false, 4, 80)
+	pc.StartAt(pc.Absolute(20, actorHipY))
+	pc.L(false, 36, 80)
+	return pc
+}
+
+// Perimeter is the box, so connections end at the figure's bounds rather than between its limbs
+func (s shapeActor) Perimeter() []geo.Intersectable {
+	return boxPath(s.Box).Path
+}
+
+func (s shapeActor) GetSVGPathData() []string {
+	return []string{
+		actorPath(s.Box).PathData(),
+	}
+}
+
+func (s shapeActor) GetDimensionsToFit(width, height, paddingX, paddingY float64) (float64, float64) {
+	totalWidth := width + paddingX
+	totalHeight := math.Max(height+paddingY, ACTOR_AR*totalWidth)
+	return math.Ceil(totalWidth), math.Ceil(totalHeight)
+}
+
+func (s shapeActor) GetDefaultPadding() (paddingX, paddingY float64) {
+	return 10, defaultPadding
+}
@@ -0,0 +1,76 @@
+package shape
+
+import (
+	"math"
+
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/svg"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+type shapeCross struct {
+	*baseShape
+}
+
+// crossArmFactor is how thick the arms of the cross are, as a part of its width or height
+const crossArmFactor = 1. / 3.
+
+func NewCross(box *geo.Box) Shape {
+	shape := shapeCross{
+		baseShape: &baseShape{
+			Type: CROSS_TYPE,
+			Box:  box,
+		},
+	}
+	shape.FullShape = go2.Pointer(Shape(shape))
+	return shape
+}
+
+// GetInnerBox is the horizontal arm, which is the widest part of the cross
+func (s shapeCross) GetInnerBox() *geo.Box {
+	tl := s.Box.TopLeft.Copy()
+	tl.Y += s.Box.Height * crossArmFactor
+	return geo.NewBox(tl, s.Box.Width, s.Box.Height*crossArmFactor)
+}
+
+func crossPath(box *geo.Box) *svg.SvgPathContext {
+	armX := box.Width * crossArmFactor
+	armY := box.Height * crossArmFactor
+	pc := svg.NewSVGPathContext(box.TopLeft, 1, 1)
+	pc.StartAt(pc.Absolute(armX, 0))
+	pc.H(false, box.Width-armX)
+	pc.V(false, armY)
+	pc.H(false, box.Width)
+	pc.V(false, box.Height-armY)
+	pc.H(false, box.Width-armX)
+	pc.V(false, box.Height)
+	pc.H(false, armX)
+	pc.V(false, box.Height-armY)
+	pc.H(false, 0)
+	pc.V(false, armY)
+	pc.H(false, armX)
+	pc.Z()
+	return pc
+}
+
+func (s shapeCross) Perimeter() []geo.Intersectable {
+	return crossPath(s.Box).Path
+}
+
+func (s shapeCross) GetSVGPathData() []string {
+	return []string{
+		crossPath(s.Box).PathData(),
+	}
+}
+
+func (s shapeCross) GetDimensionsToFit(width, height, paddingX, paddingY float64) (float64, float64) {
+	totalWidth := width + paddingX
+	totalHeight := (height + paddingY) / crossArmFactor
+	// The vertical arm is as thick as the horizontal one
+	totalWidth = math.Max(totalWidth, totalHeight)
+	return math.Ceil(totalWidth), math.Ceil(totalHeight)
+}
+
+func (s shapeCross) GetDefaultPadding() (paddingX, paddingY float64) {
+	return defaultPadding / 2, defaultPadding / 4
+}
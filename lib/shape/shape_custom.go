@@ -0,0 +1,223 @@
+package shape
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/svg"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+const (
+	// CUSTOM_LABEL_ID is the id of the rect in a custom shape's SVG that labels go in
+	CUSTOM_LABEL_ID = "d2-label"
+	// CUSTOM_BORDER_ID is the id of the polygon in a custom shape's SVG that connections are
+	// clipped to
+	CUSTOM_BORDER_ID = "d2-border"
+)
+
+// CustomDefinition is a shape drawn from an SVG, stretched from its viewBox to the shape's box
+type CustomDefinition struct {
+	// SVG is the markup of the shape
+	SVG string `json:"svg"`
+	// ViewBox is the area of the SVG that fills the box, as x, y, width and height
+	ViewBox [4]float64 `json:"viewBox"`
+	// LabelBox is where labels go in the viewBox, as x, y, width and height. It's the whole
+	// viewBox if the SVG has no CUSTOM_LABEL_ID rect.
+	LabelBox *[4]float64 `json:"labelBox,omitempty"`
+	// Border are the points x1, y1, x2, y2... of the outline connections are clipped to, in the
+	// viewBox. It's the edges of the viewBox if the SVG has no CUSTOM_BORDER_ID polygon.
+	Border []float64 `json:"border,omitempty"`
+}
+
+// ParseCustomSVG reads the definition of a custom shape from its SVG
+func ParseCustomSVG(b []byte) (*CustomDefinition, error) {
+	def := &CustomDefinition{}
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	sawRoot := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("invalid SVG: %w", err)
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		attrs := make(map[string]string, len(el.Attr))
+		for _, a := range el.Attr {
+			attrs[a.Name.Local] = a.Value
+		}
+
+		if !sawRoot {
+			sawRoot = true
+			if el.Name.Local != "svg" {
+				return nil, errors.New("not an SVG")
+			}
+			if vb, ok := attrs["viewBox"]; ok {
+				nums, err := parseNumbers(vb)
+				if err != nil || len(nums) != 4 {
+					return nil, fmt.Errorf("invalid viewBox %#v", vb)
+				}
+				copy(def.ViewBox[:], nums)
+			} else {
+				// Without a viewBox, the width and height are the coordinates
+				w, werr := strconv.ParseFloat(strings.TrimSuffix(attrs["width"], "px"), 64)
+				h, herr := strconv.ParseFloat(strings.TrimSuffix(attrs["height"], "px"), 64)
+				if werr != nil || herr != nil {
+					return nil, errors.New("SVG needs a viewBox, or a width and height")
+				}
+				def.ViewBox = [4]float64{0, 0, w, h}
+			}
+			if def.ViewBox[2] <= 0 || def.ViewBox[3] <= 0 {
+				return nil, errors.New("SVG must have a positive width and height")
+			}
+			continue
+		}
+
+		switch attrs["id"] {
+		case CUSTOM_LABEL_ID:
+			if el.Name.Local != "rect" {
+				return nil, fmt.Errorf("%#v must be a rect", CUSTOM_LABEL_ID)
+			}
+			nums, err := parseNumbers(attrs["x"] + " " + attrs["y"] + " " + attrs["width"] + " " + attrs["height"])
+			if err != nil || len(nums) != 4 {
+				return nil, fmt.Errorf("%#v needs a numeric x, y, width and height", CUSTOM_LABEL_ID)
+			}
+			def.LabelBox = &[4]float64{nums[0], nums[1], nums[2], nums[3]}
+		case CUSTOM_BORDER_ID:
+			if el.Name.Local != "polygon" {
+				return nil, fmt.Errorf("%#v must be a polygon", CUSTOM_BORDER_ID)
+			}
+			nums, err := parseNumbers(attrs["points"])
+			if err != nil || len(nums) < 6 || len(nums)%2 != 0 {
+				return nil, fmt.Errorf("%#v needs at least 3 points", CUSTOM_BORDER_ID)
+			}
+			def.Border = nums
+		}
+	}
+	if !sawRoot {
+		return nil, errors.New("not an SVG")
+	}
+
+	// The SVG is stretched to the box like the shapes it stands beside
+	svgMarkup := string(b)
+	if !strings.Contains(svgMarkup, "preserveAspectRatio") {
+		i := strings.Index(svgMarkup, "<svg")
+		svgMarkup = svgMarkup[:i+len("<svg")] + ` preserveAspectRatio="none"` + svgMarkup[i+len("<svg"):]
+	}
+	def.SVG = svgMarkup
+	return def, nil
+}
+
+// parseNumbers parses numbers separated by spaces or commas, like viewBoxes and polygon points
+func parseNumbers(s string) ([]float64, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	nums := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		n, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, n)
+	}
+	return nums, nil
+}
+
+type shapeCustom struct {
+	*baseShape
+	def *CustomDefinition
+}
+
+// NewCustom returns a custom shape, which is a rectangle until its definition is set with
+// SetCustomDefinition
+func NewCustom(box *geo.Box) Shape {
+	shape := shapeCustom{
+		baseShape: &baseShape{
+			Type: CUSTOM_TYPE,
+			Box:  box,
+		},
+		def: &CustomDefinition{},
+	}
+	shape.FullShape = go2.Pointer(Shape(shape))
+	return shape
+}
+
+func (s shapeCustom) SetCustomDefinition(def *CustomDefinition) {
+	*s.def = *def
+}
+
+// scale returns how much larger the box is than the viewBox
+func (s shapeCustom) scale() (float64, float64) {
+	if s.def.ViewBox[2] == 0 || s.def.ViewBox[3] == 0 {
+		return 1, 1
+	}
+	return s.Box.Width / s.def.ViewBox[2], s.Box.Height / s.def.ViewBox[3]
+}
+
+// toBox returns the point in the box of the point x, y in the viewBox
+func (s shapeCustom) toBox(x, y float64) (float64, float64) {
+	sx, sy := s.scale()
+	return (x - s.def.ViewBox[0]) * sx, (y - s.def.ViewBox[1]) * sy
+}
+
+func (s shapeCustom) GetInnerBox() *geo.Box {
+	if s.def.LabelBox == nil {
+		return s.Box
+	}
+	lb := *s.def.LabelBox
+	x, y := s.toBox(lb[0], lb[1])
+	sx, sy := s.scale()
+	tl := s.Box.TopLeft.Copy()
+	tl.X += x
+	tl.Y += y
+	return geo.NewBox(tl, lb[2]*sx, lb[3]*sy)
+}
+
+func (s shapeCustom) borderPath() *svg.SvgPathContext {
+	if len(s.def.Border) == 0 {
+		return boxPath(s.Box)
+	}
+	pc := svg.NewSVGPathContext(s.Box.TopLeft, 1, 1)
+	pc.StartAt(pc.Absolute(s.toBox(s.def.Border[0], s.def.Border[1])))
+	for i := 2; i < len(s.def.Border); i += 2 {
+		x, y := s.toBox(s.def.Border[i], s.def.Border[i+1])
+		pc.L(false, x, y)
+	}
+	pc.Z()
+	return pc
+}
+
+func (s shapeCustom) Perimeter() []geo.Intersectable {
+	return s.borderPath().Path
+}
+
+// GetSVGPathData is the border, for renderers that can't draw the SVG
+func (s shapeCustom) GetSVGPathData() []string {
+	return []string{
+		s.borderPath().PathData(),
+	}
+}
+
+func (s shapeCustom) GetDimensionsToFit(width, height, paddingX, paddingY float64) (float64, float64) {
+	totalWidth := width + paddingX
+	totalHeight := height + paddingY
+	// The label box is scaled up to fit the content, and the rest of the shape with it
+	if s.def.LabelBox != nil && s.def.LabelBox[2] > 0 && s.def.LabelBox[3] > 0 {
+		totalWidth *= s.def.ViewBox[2] / s.def.LabelBox[2]
+		totalHeight *= s.def.ViewBox[3] / s.def.LabelBox[3]
+	}
+	return math.Ceil(totalWidth), math.Ceil(totalHeight)
+}
@@ -0,0 +1,81 @@
+package shape
+
+import (
+	"math"
+
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/svg"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+type shapeNote struct {
+	*baseShape
+}
+
+// noteFoldSize is the size of the folded top right corner
+const noteFoldSize = 16.
+
+func NewNote(box *geo.Box) Shape {
+	shape := shapeNote{
+		baseShape: &baseShape{
+			Type: NOTE_TYPE,
+			Box:  box,
+		},
+	}
+	shape.FullShape = go2.Pointer(Shape(shape))
+	return shape
+}
+
+// GetInnerBox keeps clear of the fold on both sides so labels stay centered
+func (s shapeNote) GetInnerBox() *geo.Box {
+	tl := s.Box.TopLeft.Copy()
+	tl.X += noteFoldSize
+	return geo.NewBox(tl, s.Box.Width-2*noteFoldSize, s.Box.Height)
+}
+
+func noteFold(box *geo.Box) float64 {
+	return math.Min(noteFoldSize, math.Min(box.Width, box.Height)/2)
+}
+
+func noteOuterPath(box *geo.Box) *svg.SvgPathContext {
+	fold := noteFold(box)
+	pc := svg.NewSVGPathContext(box.TopLeft, 1, 1)
+	pc.StartAt(pc.Absolute(0, 0))
+	pc.H(false, box.Width-fold)
+	pc.L(false, box.Width, fold)
+	pc.V(false, box.Height)
+	pc.H(false, 0)
+	pc.Z()
+	return pc
+}
+
+func noteFoldPath(box *geo.Box) *svg.SvgPathContext {
+	fold := noteFold(box)
+	pc := svg.NewSVGPathContext(box.TopLeft, 1, 1)
+	pc.StartAt(pc.Absolute(box.Width-fold, 0))
+	pc.V(false, fold)
+	pc.H(false, box.Width)
+	pc.Z()
+	return pc
+}
+
+func (s shapeNote) Perimeter() []geo.Intersectable {
+	return noteOuterPath(s.Box).Path
+}
+
+func (s shapeNote) GetSVGPathData() []string {
+	return []string{
+		noteOuterPath(s.Box).PathData(),
+		noteFoldPath(s.Box).PathData(),
+	}
+}
+
+func (s shapeNote) GetDimensionsToFit(width, height, paddingX, paddingY float64) (float64, float64) {
+	totalWidth := width + paddingX + 2*noteFoldSize
+	totalHeight := math.Max(height+paddingY, 2*noteFoldSize)
+	return math.Ceil(totalWidth), math.Ceil(totalHeight)
+}
+
+func (s shapeNote) GetDefaultPadding() (paddingX, paddingY float64) {
+	return defaultPadding / 2, defaultPadding / 2
+}
@@ -0,0 +1,68 @@
+package shape
+
+import (
+	"math"
+
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/svg"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+type shapeTrapezoid struct {
+	*baseShape
+}
+
+// trapezoidWedgeWidth is how much narrower the top is than the bottom on each side
+const trapezoidWedgeWidth = 26.
+
+func NewTrapezoid(box *geo.Box) Shape {
+	shape := shapeTrapezoid{
+		baseShape: &baseShape{
+			Type: TRAPEZOID_TYPE,
+			Box:  box,
+		},
+	}
+	shape.FullShape = go2.Pointer(Shape(shape))
+	return shape
+}
+
+func (s shapeTrapezoid) GetInnerBox() *geo.Box {
+	tl := s.Box.TopLeft.Copy()
+	width := s.Box.Width - 2*trapezoidWedgeWidth
+	tl.X += trapezoidWedgeWidth
+	return geo.NewBox(tl, width, s.Box.Height)
+}
+
+func trapezoidPath(box *geo.Box) *svg.SvgPathContext {
+	wedgeWidth := trapezoidWedgeWidth
+	// Narrow trapezoids become triangles rather than crossing over
+	if box.Width <= 2*wedgeWidth {
+		wedgeWidth = box.Width / 2.0
+	}
+	pc := svg.NewSVGPathContext(box.TopLeft, 1, 1)
+	pc.StartAt(pc.Absolute(wedgeWidth, 0))
+	pc.L(false, box.Width-wedgeWidth, 0)
+	pc.L(false, box.Width, box.Height)
+	pc.L(false, 0, box.Height)
+	pc.Z()
+	return pc
+}
+
+func (s shapeTrapezoid) Perimeter() []geo.Intersectable {
+	return trapezoidPath(s.Box).Path
+}
+
+func (s shapeTrapezoid) GetSVGPathData() []string {
+	return []string{
+		trapezoidPath(s.Box).PathData(),
+	}
+}
+
+func (s shapeTrapezoid) GetDimensionsToFit(width, height, paddingX, paddingY float64) (float64, float64) {
+	totalWidth := width + paddingX + trapezoidWedgeWidth*2
+	return math.Ceil(totalWidth), math.Ceil(height + paddingY)
+}
+
+func (s shapeTrapezoid) GetDefaultPadding() (paddingX, paddingY float64) {
+	return defaultPadding / 2, defaultPadding
+}
@@ -0,0 +1,66 @@
+package shape
+
+import (
+	"math"
+
+	"oss.terrastruct.com/d2/lib/geo"
+	"oss.terrastruct.com/d2/lib/svg"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+type shapeTriangle struct {
+	*baseShape
+}
+
+func NewTriangle(box *geo.Box) Shape {
+	shape := shapeTriangle{
+		baseShape: &baseShape{
+			Type: TRIANGLE_TYPE,
+			Box:  box,
+		},
+	}
+	shape.FullShape = go2.Pointer(Shape(shape))
+	return shape
+}
+
+// GetInnerBox is the largest box that fits in the triangle: half as wide and half as tall,
+// standing on its base
+func (s shapeTriangle) GetInnerBox() *geo.Box {
+	width := s.Box.Width
+	height := s.Box.Height
+	tl := s.Box.TopLeft.Copy()
+	tl.X += width / 4.
+	tl.Y += height / 2.
+	width /= 2.
+	height /= 2.
+	return geo.NewBox(tl, width, height)
+}
+
+func trianglePath(box *geo.Box) *svg.SvgPathContext {
+	pc := svg.NewSVGPathContext(box.TopLeft, 1, 1)
+	pc.StartAt(pc.Absolute(box.Width/2, 0))
+	pc.L(false, box.Width, box.Height)
+	pc.L(false, 0, box.Height)
+	pc.Z()
+	return pc
+}
+
+func (s shapeTriangle) Perimeter() []geo.Intersectable {
+	return trianglePath(s.Box).Path
+}
+
+func (s shapeTriangle) GetSVGPathData() []string {
+	return []string{
+		trianglePath(s.Box).PathData(),
+	}
+}
+
+func (s shapeTriangle) GetDimensionsToFit(width, height, paddingX, paddingY float64) (float64, float64) {
+	totalWidth := 2 * (width + paddingX)
+	totalHeight := 2 * (height + paddingY)
+	return math.Ceil(totalWidth), math.Ceil(totalHeight)
+}
+
+func (s shapeTriangle) GetDefaultPadding() (paddingX, paddingY float64) {
+	return defaultPadding / 4, defaultPadding / 4
+}
@@ -0,0 +1,36 @@
+// Package sliceindex indexes slices that are mostly appended to, like the fields and edges of
+// a diagram while it's compiled, so looking up their elements by key doesn't go through them all.
+package sliceindex
+
+// Index groups the elements of a slice by key. It catches up with the elements appended to the
+// slice since it was last synced, and is rebuilt if elements were removed. Elements replaced in
+// place, or whose keys change, aren't noticed, so they're for the caller to check.
+//
+// The zero Index is empty and ready to use. Copies of an Index share its groups until either
+// is synced to another slice.
+type Index[K comparable, T comparable] struct {
+	n           int
+	first, last T
+	byKey       map[K][]T
+}
+
+// Sync updates the index to the elements of s
+func (idx *Index[K, T]) Sync(s []T, key func(T) K) {
+	if idx.byKey == nil || len(s) < idx.n || idx.n > 0 && (s[0] != idx.first || s[idx.n-1] != idx.last) {
+		idx.byKey = make(map[K][]T, len(s))
+		idx.n = 0
+	}
+	for _, el := range s[idx.n:] {
+		k := key(el)
+		idx.byKey[k] = append(idx.byKey[k], el)
+	}
+	idx.n = len(s)
+	if idx.n > 0 {
+		idx.first, idx.last = s[0], s[idx.n-1]
+	}
+}
+
+// Get returns the elements with key k as of the last Sync, in order
+func (idx *Index[K, T]) Get(k K) []T {
+	return idx.byKey[k]
+}
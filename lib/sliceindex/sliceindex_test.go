@@ -0,0 +1,47 @@
+package sliceindex_test
+
+import (
+	"strings"
+	"testing"
+
+	tassert "github.com/stretchr/testify/assert"
+
+	"oss.terrastruct.com/d2/lib/sliceindex"
+)
+
+func TestIndex(t *testing.T) {
+	t.Parallel()
+
+	type el struct {
+		name string
+	}
+	a, b, c, d := &el{"a"}, &el{"B"}, &el{"b"}, &el{"c"}
+	key := func(e *el) string {
+		return strings.ToLower(e.name)
+	}
+
+	var idx sliceindex.Index[string, *el]
+	tassert.Nil(t, idx.Get("a"))
+
+	s := []*el{a, b}
+	idx.Sync(s, key)
+	tassert.Equal(t, []*el{b}, idx.Get("b"))
+
+	// Appended
+	s = append(s, c, d)
+	idx.Sync(s, key)
+	tassert.Equal(t, []*el{b, c}, idx.Get("b"))
+	tassert.Equal(t, []*el{d}, idx.Get("c"))
+
+	// Removed
+	s = []*el{a, c}
+	idx.Sync(s, key)
+	tassert.Equal(t, []*el{c}, idx.Get("b"))
+	tassert.Nil(t, idx.Get("c"))
+
+	// Removed from the start and appended to, as many as were removed
+	s = []*el{c, d}
+	idx.Sync(s, key)
+	tassert.Nil(t, idx.Get("a"))
+	tassert.Equal(t, []*el{d}, idx.Get("c"))
+}
@@ -0,0 +1,112 @@
+package textmeasure
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Characters which can't start a line, like closing brackets, CJK commas and full stops, and
+// Japanese small kana and prolonged sound marks
+const noLineStart = ")]}>,.;:!?%" +
+	"）］｝〕〉》」』】〙〗〟’”｠»" +
+	"、。，．・：；？！ー～々〻ゝゞヽヾ" +
+	"ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶ"
+
+// Characters which can't end a line, like opening brackets and quotes
+const noLineEnd = "([{<" +
+	"（［｛〔〈《「『【〘〖〝‘“｟«"
+
+// Wrap breaks the lines of text so that each is no wider than maxWidth, as measured by measure.
+// Lines only break where LineBreaks allows, so a word wider than maxWidth is left on its own
+// line rather than split.
+func Wrap(text string, maxWidth int, measure func(string) int) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, wrapLine(line, maxWidth, measure)...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func wrapLine(line string, maxWidth int, measure func(string) int) []string {
+	if measure(line) <= maxWidth {
+		return []string{line}
+	}
+	var lines []string
+	start, lastBreak := 0, 0
+	for _, b := range append(LineBreaks(line), len(line)) {
+		if measure(strings.TrimRight(line[start:b], " ")) > maxWidth && lastBreak > start {
+			lines = append(lines, strings.TrimRight(line[start:lastBreak], " "))
+			start = lastBreak
+		}
+		lastBreak = b
+	}
+	return append(lines, line[start:])
+}
+
+// LineBreaks returns the byte offsets in line before which it can break. Latin text breaks after
+// spaces. CJK text breaks between any two characters, except before closing punctuation or after
+// opening punctuation. Thai is written without spaces between words and, without a dictionary,
+// breaks before leading vowels and after vowels and marks which end a syllable.
+func LineBreaks(line string) []int {
+	var breaks []int
+	prev, _ := utf8.DecodeRuneInString(line)
+	for i, r := range line {
+		if i > 0 && canBreak(prev, r) {
+			breaks = append(breaks, i)
+		}
+		prev = r
+	}
+	return breaks
+}
+
+func canBreak(a, b rune) bool {
+	switch {
+	case unicode.IsSpace(b):
+		return false
+	case unicode.IsSpace(a):
+		return true
+	case strings.ContainsRune(noLineStart, b), strings.ContainsRune(noLineEnd, a):
+		return false
+	case isIdeographic(a), isIdeographic(b):
+		return true
+	case isThai(a) && isThai(b):
+		return canBreakThai(a, b)
+	}
+	return false
+}
+
+// ContainsCJKOrRTL returns whether text has CJK, Thai or right-to-left characters. Their
+// labels can't widen past shapes with fixed widths for the Latin text around them to fit, so
+// they're wrapped to the shapes instead.
+func ContainsCJKOrRTL(text string) bool {
+	return strings.ContainsFunc(text, func(r rune) bool {
+		return isIdeographic(r) || isThai(r) || isRTL(r)
+	})
+}
+
+func isIdeographic(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		// Hangul syllables, but not the jamo they're composed of
+		(r >= 0xAC00 && r <= 0xD7A3)
+}
+
+func isThai(r rune) bool {
+	return r >= 0x0E01 && r <= 0x0E5B
+}
+
+func canBreakThai(a, b rune) bool {
+	switch {
+	// Vowels written after, above or below a consonant, and tone marks
+	case b >= 0x0E30 && b <= 0x0E3A, b == 0x0E45, b >= 0x0E47 && b <= 0x0E4E:
+		return false
+	// Vowels written before the consonant they follow in speech
+	case a >= 0x0E40 && a <= 0x0E44:
+		return false
+	case b >= 0x0E40 && b <= 0x0E44:
+		return true
+	}
+	// sara a, sara aa, sara am and thanthakhat end a syllable when a consonant follows
+	isConsonant := b >= 0x0E01 && b <= 0x0E2E
+	return isConsonant && (a == 0x0E30 || a == 0x0E32 || a == 0x0E33 || a == 0x0E4C)
+}
@@ -8,8 +8,13 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/yuin/goldmark"
+	goldmarkAst "github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
+	extensionAst "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
 	goldmarkHtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 	"golang.org/x/net/html"
 
 	"oss.terrastruct.com/util-go/go2"
@@ -48,6 +53,15 @@ const (
 	PaddingTopBottom_code_em = 0.2
 	PaddingLeftRight_code_em = 0.4
 
+	PaddingTopBottom_td_th = 6.
+	PaddingLeftRight_td_th = 13.
+	Border_td_th           = 1.
+	MarginBottom_table     = 16.
+
+	Size_checkbox           = 13.
+	MarginLeft_checkbox_em  = 1.6
+	MarginRight_checkbox_em = 0.2
+
 	PaddingLR_blockquote_em  = 1.
 	MarginBottom_blockquote  = 16
 	BorderLeft_blockquote_em = 0.25
@@ -94,10 +108,34 @@ func init() {
 		),
 		goldmark.WithExtensions(
 			extension.Strikethrough,
+			extension.Table,
+			extension.TaskList,
+		),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(util.Prioritized(taskListClasses{}, 100)),
 		),
 	)
 }
 
+// taskListClasses gives task lists and their items the classes github-markdown.css styles them
+// with, so their items aren't bulleted
+type taskListClasses struct{}
+
+func (taskListClasses) Transform(doc *goldmarkAst.Document, reader text.Reader, pc parser.Context) {
+	_ = goldmarkAst.Walk(doc, func(n goldmarkAst.Node, entering bool) (goldmarkAst.WalkStatus, error) {
+		if !entering || n.Kind() != goldmarkAst.KindListItem {
+			return goldmarkAst.WalkContinue, nil
+		}
+		if block := n.FirstChild(); block != nil {
+			if _, ok := block.FirstChild().(*extensionAst.TaskCheckBox); ok {
+				n.SetAttributeString("class", []byte("task-list-item"))
+				n.Parent().SetAttributeString("class", []byte("contains-task-list"))
+			}
+		}
+		return goldmarkAst.WalkContinue, nil
+	})
+}
+
 func MeasureMarkdown(mdText string, ruler *Ruler, fontFamily *d2fonts.FontFamily, fontSize int) (width, height int, err error) {
 	render, err := RenderMarkdown(mdText)
 	if err != nil {
@@ -109,6 +147,8 @@ func MeasureMarkdown(mdText string, ruler *Ruler, fontFamily *d2fonts.FontFamily
 		return width, height, err
 	}
 
+	ruler.mu.Lock()
+	defer ruler.mu.Unlock()
 	{
 		originalLineHeight := ruler.LineHeightFactor
 		ruler.boundsWithDot = true
@@ -181,6 +221,7 @@ func isBlockElement(elType string) bool {
 		"ol",
 		"p",
 		"pre",
+		"table",
 		"ul":
 		return true
 	default:
@@ -266,7 +307,7 @@ func (ruler *Ruler) measureNode(depth int, n *html.Node, fontFamily *d2fonts.Fon
 				ruler.LineHeightFactor = originalLineHeight
 			}()
 		}
-		w, h := ruler.MeasurePrecise(font, str)
+		w, h := ruler.measurePrecise(font, str)
 		if isCode {
 			w *= FontSize_pre_code_em
 			h *= FontSize_pre_code_em
@@ -278,6 +319,9 @@ func (ruler *Ruler) measureNode(depth int, n *html.Node, fontFamily *d2fonts.Fon
 		}
 		return blockAttrs{w + spaceWidths, h, 0, 0}
 	case html.ElementNode:
+		if n.Data == "table" {
+			return ruler.measureTable(depth, n, fontFamily, fontSize)
+		}
 		isCode := false
 		switch n.Data {
 		case "h1", "h2", "h3", "h4", "h5", "h6":
@@ -421,6 +465,14 @@ func (ruler *Ruler) measureNode(depth int, n *html.Node, fontFamily *d2fonts.Fon
 				block.width += 2 * PaddingLeftRight_code_em * float64(fontSize)
 				block.height += 2 * PaddingTopBottom_code_em * float64(fontSize)
 			}
+		case "input":
+			for _, attr := range n.Attr {
+				if attr.Key == "type" && attr.Val == "checkbox" {
+					// the checkbox hangs into the padding of its list
+					block.width = Size_checkbox + (MarginRight_checkbox_em-MarginLeft_checkbox_em)*float64(fontSize)
+					block.height = Size_checkbox
+				}
+			}
 		case "hr":
 			block.height += Height_hr_em * float64(fontSize)
 			block.marginTop = go2.Max(block.marginTop, MarginTopBottom_hr)
@@ -436,3 +488,54 @@ func (ruler *Ruler) measureNode(depth int, n *html.Node, fontFamily *d2fonts.Fon
 	}
 	return blockAttrs{}
 }
+
+// measureTable measures a table whose columns are as wide as their widest cells, with the
+// borders of neighboring cells collapsed into one
+func (ruler *Ruler) measureTable(depth int, n *html.Node, fontFamily *d2fonts.FontFamily, fontSize int) blockAttrs {
+	lineHeightPx := float64(fontSize) * ruler.LineHeightFactor
+	var colWidths []float64
+	var height float64
+	rows := 0
+
+	var measureRows func(*html.Node)
+	measureRows = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.Data {
+			case "thead", "tbody":
+				measureRows(child)
+			case "tr":
+				rows++
+				rowHeight := lineHeightPx
+				col := 0
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type != html.ElementNode || (cell.Data != "th" && cell.Data != "td") {
+						continue
+					}
+					fontStyle := d2fonts.FONT_STYLE_REGULAR
+					if cell.Data == "th" {
+						fontStyle = d2fonts.FONT_STYLE_SEMIBOLD
+					}
+					cellBlock := ruler.measureNode(depth+1, cell, fontFamily, fontSize, fontStyle)
+					if col == len(colWidths) {
+						colWidths = append(colWidths, 0)
+					}
+					colWidths[col] = go2.Max(colWidths[col], cellBlock.width)
+					rowHeight = go2.Max(rowHeight, cellBlock.height)
+					col++
+				}
+				height += rowHeight + 2*PaddingTopBottom_td_th
+			}
+		}
+	}
+	measureRows(n)
+
+	width := float64(len(colWidths)+1) * Border_td_th
+	for _, w := range colWidths {
+		width += w + 2*PaddingLeftRight_td_th
+	}
+	height += float64(rows+1) * Border_td_th
+	return blockAttrs{width, height, 0, MarginBottom_table}
+}
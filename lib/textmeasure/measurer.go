@@ -0,0 +1,28 @@
+package textmeasure
+
+import (
+	"oss.terrastruct.com/d2/d2renderers/d2fonts"
+)
+
+// TextMeasurer measures the texts of a diagram for layout. Ruler is the default, measuring
+// with the fonts bundled with D2. Hosts can plug in their own without changing layout, e.g.
+// browsers delegating to canvas measureText, or servers shaping complex scripts with
+// HarfBuzz. Implementations must be safe for concurrent use if shared by concurrent compiles.
+type TextMeasurer interface {
+	// Measure returns the size of s in font, in pixels.
+	Measure(font d2fonts.Font, s string) (width, height int)
+	// MeasureCode returns the size of s in the monospaced font, with CODE_LINE_HEIGHT between
+	// lines.
+	MeasureCode(font d2fonts.Font, s string) (width, height int)
+	// MeasureMarkdown returns the size of the HTML that mdText renders to, with fontFamily and
+	// fontSize as the base font. Implementations that only measure plain text can delegate to
+	// a Ruler.
+	MeasureMarkdown(mdText string, fontFamily *d2fonts.FontFamily, fontSize int) (width, height int, err error)
+}
+
+var _ TextMeasurer = &Ruler{}
+
+// MeasureMarkdown is MeasureMarkdown with r
+func (r *Ruler) MeasureMarkdown(mdText string, fontFamily *d2fonts.FontFamily, fontSize int) (width, height int, err error) {
+	return MeasureMarkdown(mdText, r, fontFamily, fontSize)
+}
@@ -0,0 +1,62 @@
+package textmeasure
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"oss.terrastruct.com/d2/d2renderers/d2fonts"
+)
+
+// IsRTL returns whether text reads right to left, which is whether its first letter is from a
+// right-to-left script like Hebrew or Arabic
+func IsRTL(text string) bool {
+	for _, r := range text {
+		if isRTL(r) {
+			return true
+		}
+		if unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return false
+}
+
+func isRTL(r rune) bool {
+	return unicode.In(r, unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko)
+}
+
+// rtlAdvance is how far a right-to-left character advances in ems. The fonts have no glyphs for
+// them, so they're drawn in fallback fonts, which are narrower than the replacement glyph they'd
+// otherwise be measured as. Arabic letters join into narrower forms than Hebrew ones, and marks
+// like vowel points don't advance at all.
+func rtlAdvance(r rune) float64 {
+	switch {
+	case unicode.Is(unicode.Mn, r):
+		return 0
+	case unicode.Is(unicode.Hebrew, r):
+		return 0.55
+	}
+	return 0.45
+}
+
+// scaleRTL replaces the widths measured for right-to-left characters with their estimated advances
+func (t *Ruler) scaleRTL(w float64, font d2fonts.Font, s string) float64 {
+	if !strings.ContainsFunc(s, isRTL) {
+		return w
+	}
+	atlas := t.atlases[font]
+	replacement := atlas.glyph(unicode.ReplacementChar).advance
+	w = 0
+	for _, line := range strings.Split(s, "\n") {
+		lineW, _ := t.measurePrecise(font, line)
+		lineW = t.scaleUnicode(lineW, font, line)
+		for _, r := range line {
+			if (isRTL(r) || unicode.Is(unicode.Mn, r)) && !atlas.contains(r) {
+				lineW += rtlAdvance(r)*float64(font.Size) - replacement
+			}
+		}
+		w = math.Max(w, lineW)
+	}
+	return w
+}
@@ -6,6 +6,7 @@ package textmeasure
 import (
 	"math"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -59,6 +60,10 @@ func init() {
 // will be written. Dot is automatically moved when writing to a Ruler object, but you can also
 // manipulate it manually. Orig specifies the text origin, usually the top-left dot position. Dot is
 // always aligned to Orig when writing newlines. The Clear method resets the Dot to Orig.
+//
+// The methods of Ruler are safe for concurrent use, so one Ruler can be shared by concurrent
+// compiles, but its fields must not be changed while it's in use. Use MeasureCode to measure with
+// the line height of code.
 type Ruler struct {
 	// Orig specifies the text origin, usually the top-left dot position. Dot is always aligned
 	// to Orig when writing newlines.
@@ -92,6 +97,10 @@ type Ruler struct {
 
 	// when drawing text also union Ruler.bounds with Dot
 	boundsWithDot bool
+
+	// mu guards measurements, which write to the fields above, so that one Ruler can be shared
+	// by concurrent compiles
+	mu sync.Mutex
 }
 
 // New creates a new Ruler capable of drawing runes contained in the provided atlas. Orig and Dot
@@ -119,6 +128,8 @@ func NewRuler() (*Ruler, error) {
 		ttfs:             make(map[d2fonts.Font]*truetype.Font),
 	}
 
+	d2fonts.FontFamiliesMu.Lock()
+	defer d2fonts.FontFamiliesMu.Unlock()
 	for _, fontFamily := range d2fonts.FontFamilies {
 		for _, fontStyle := range d2fonts.FontStyles {
 			font := d2fonts.Font{
@@ -181,7 +192,7 @@ func (t *Ruler) scaleUnicode(w float64, font d2fonts.Font, s string) float64 {
 	// but Hans fonts are heavy.
 	if uniseg.GraphemeClusterCount(s) != len(s) {
 		for _, line := range strings.Split(s, "\n") {
-			lineW, _ := t.MeasurePrecise(font, line)
+			lineW, _ := t.measurePrecise(font, line)
 			gr := uniseg.NewGraphemes(line)
 
 			mono := d2fonts.SourceCodePro.Font(font.Size, font.Style)
@@ -217,20 +228,51 @@ func (t *Ruler) scaleUnicode(w float64, font d2fonts.Font, s string) float64 {
 }
 
 func (t *Ruler) MeasureMono(font d2fonts.Font, s string) (width, height int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.measureMono(font, s)
+}
+
+// MeasureCode measures monospaced code, which has CODE_LINE_HEIGHT between lines
+func (t *Ruler) MeasureCode(font d2fonts.Font, s string) (width, height int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	originalLineHeight := t.LineHeightFactor
+	t.LineHeightFactor = CODE_LINE_HEIGHT
+	defer func() {
+		t.LineHeightFactor = originalLineHeight
+	}()
+	return t.measureMono(font, s)
+}
+
+func (t *Ruler) Measure(font d2fonts.Font, s string) (width, height int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.measure(font, s)
+}
+
+func (t *Ruler) MeasurePrecise(font d2fonts.Font, s string) (width, height float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.measurePrecise(font, s)
+}
+
+func (t *Ruler) measureMono(font d2fonts.Font, s string) (width, height int) {
 	originalBoundsWithDot := t.boundsWithDot
 	t.boundsWithDot = true
-	width, height = t.Measure(font, s)
+	width, height = t.measure(font, s)
 	t.boundsWithDot = originalBoundsWithDot
 	return width, height
 }
 
-func (t *Ruler) Measure(font d2fonts.Font, s string) (width, height int) {
-	w, h := t.MeasurePrecise(font, s)
+func (t *Ruler) measure(font d2fonts.Font, s string) (width, height int) {
+	w, h := t.measurePrecise(font, s)
 	w = t.scaleUnicode(w, font, s)
+	w = t.scaleRTL(w, font, s)
 	return int(math.Ceil(w)), int(math.Ceil(h))
 }
 
-func (t *Ruler) MeasurePrecise(font d2fonts.Font, s string) (width, height float64) {
+func (t *Ruler) measurePrecise(font d2fonts.Font, s string) (width, height float64) {
 	if _, ok := t.atlases[font]; !ok {
 		t.addFontSize(font)
 	}
@@ -3,7 +3,9 @@ package textmeasure_test
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 
@@ -101,6 +103,16 @@ _italics are all measured correctly_
 	"`inline code`": {103, 24},
 	"`code`":        {46, 24},
 	"`a`":           {21, 24},
+	`
+| a | b |
+|---|---|
+| 1 | 2 |
+`: {73, 75},
+	`
+- [ ] todo
+- [x] done
+`: {61, 52},
+	"~~old~~": {22, 24},
 }
 
 func TestTextMeasureMarkdown(t *testing.T) {
@@ -119,3 +131,161 @@ func TestTextMeasureMarkdown(t *testing.T) {
 	}
 
 }
+
+func TestConcurrentMeasure(t *testing.T) {
+	ruler, err := textmeasure.NewRuler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	font := d2fonts.SourceSansPro.Font(d2fonts.FONT_SIZE_M, d2fonts.FONT_STYLE_REGULAR)
+	code := d2fonts.SourceCodePro.Font(d2fonts.FONT_SIZE_M, d2fonts.FONT_STYLE_REGULAR)
+
+	type dims struct{ w, h int }
+	measure := func(txt string) [3]dims {
+		var d [3]dims
+		var err error
+		d[0].w, d[0].h = ruler.Measure(font, txt)
+		d[1].w, d[1].h = ruler.MeasureCode(code, txt+"\n"+txt)
+		d[2].w, d[2].h, err = textmeasure.MeasureMarkdown("# "+txt, ruler, nil, textmeasure.MarkdownFontSize)
+		assert.Nil(t, err)
+		return d
+	}
+	exp := make([][3]dims, len(txts))
+	for i, txt := range txts {
+		exp[i] = measure(txt)
+	}
+
+	// Measurements from different goroutines must not affect each other
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j, txt := range txts {
+				assert.Equal(t, exp[j], measure(txt))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWrap(t *testing.T) {
+	t.Parallel()
+
+	// Every character is 10px wide
+	measure := func(s string) int {
+		return 10 * utf8.RuneCountInString(s)
+	}
+	testCases := []struct {
+		name     string
+		text     string
+		maxWidth int
+		exp      string
+	}{
+		{
+			name:     "fits",
+			text:     "hello world",
+			maxWidth: 200,
+			exp:      "hello world",
+		},
+		{
+			name:     "spaces",
+			text:     "the quick brown fox",
+			maxWidth: 100,
+			exp:      "the quick\nbrown fox",
+		},
+		{
+			name:     "long_word",
+			text:     "a supercalifragilistic word",
+			maxWidth: 60,
+			exp:      "a\nsupercalifragilistic\nword",
+		},
+		{
+			name:     "lines",
+			text:     "one two\nthree four",
+			maxWidth: 50,
+			exp:      "one\ntwo\nthree\nfour",
+		},
+		{
+			name:     "cjk",
+			text:     "東京都の天気予報",
+			maxWidth: 30,
+			exp:      "東京都\nの天気\n予報",
+		},
+		{
+			name:     "cjk_closing_punctuation",
+			text:     "晴れです。明日",
+			maxWidth: 40,
+			exp:      "晴れで\nす。明日",
+		},
+		{
+			name:     "cjk_opening_punctuation",
+			text:     "彼は「はい」と",
+			maxWidth: 30,
+			exp:      "彼は\n「は\nい」と",
+		},
+		{
+			name:     "cjk_ascii_word",
+			text:     "使用ABCD语言",
+			maxWidth: 30,
+			exp:      "使用\nABCD\n语言",
+		},
+		{
+			name:     "korean",
+			text:     "안녕하세요",
+			maxWidth: 30,
+			exp:      "안녕하\n세요",
+		},
+		{
+			name:     "thai",
+			text:     "ภาษาไทย",
+			maxWidth: 50,
+			exp:      "ภาษา\nไทย",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.exp, textmeasure.Wrap(tc.text, tc.maxWidth, measure))
+		})
+	}
+}
+
+func TestMeasureRTL(t *testing.T) {
+	ruler, err := textmeasure.NewRuler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	font := d2fonts.SourceSansPro.Font(d2fonts.FONT_SIZE_M, d2fonts.FONT_STYLE_REGULAR)
+
+	// Without glyphs of their own, these would measure as wide as a replacement glyph each
+	replacementW, _ := ruler.Measure(font, strings.Repeat("�", 4))
+	hebrewW, _ := ruler.Measure(font, "שלום")
+	arabicW, _ := ruler.Measure(font, "مرحب")
+	assert.Less(t, hebrewW, replacementW)
+	assert.Less(t, arabicW, hebrewW)
+
+	// Vowel points don't advance
+	pointedW, _ := ruler.Measure(font, "שָׁלוֹם")
+	assert.Equal(t, hebrewW, pointedW)
+
+	// Lines are measured separately
+	twoLinesW, _ := ruler.Measure(font, "שלום\nשלום")
+	assert.Equal(t, hebrewW, twoLinesW)
+}
+
+func TestIsRTL(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, textmeasure.IsRTL("שלום world"))
+	assert.True(t, textmeasure.IsRTL("1. مرحبا"))
+	assert.False(t, textmeasure.IsRTL("hello שלום"))
+	assert.False(t, textmeasure.IsRTL("東京"))
+	assert.False(t, textmeasure.IsRTL("123"))
+
+	assert.True(t, textmeasure.ContainsCJKOrRTL("hello שלום"))
+	assert.True(t, textmeasure.ContainsCJKOrRTL("東京"))
+	assert.False(t, textmeasure.ContainsCJKOrRTL("hello"))
+}